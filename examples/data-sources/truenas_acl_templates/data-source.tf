@@ -0,0 +1,15 @@
+# Templates that apply to a share, with names instead of IDs
+data "truenas_acl_templates" "share" {
+  path          = "/mnt/tank/share"
+  canonicalize  = true
+  resolve_names = true
+}
+
+output "share_templates" {
+  value = [for t in data.truenas_acl_templates.share.templates : t.name]
+}
+
+# A single built-in template
+data "truenas_acl_templates" "restricted" {
+  name = "NFS4_RESTRICTED"
+}
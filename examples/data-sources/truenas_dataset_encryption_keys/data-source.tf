@@ -0,0 +1,17 @@
+# Keys of every dataset of the pool encrypted with a hex key
+data "truenas_dataset_encryption_keys" "tank" {
+  dataset_id = "tank"
+}
+
+# Hand the keys to a secrets manager through an output
+output "tank_keys" {
+  value     = data.truenas_dataset_encryption_keys.tank.keys
+  sensitive = true
+}
+
+# Or write them to a file in the format TrueNAS accepts to unlock datasets
+resource "local_sensitive_file" "tank_keys" {
+  filename        = "${path.module}/tank_keys.json"
+  content         = jsonencode(data.truenas_dataset_encryption_keys.tank.keys)
+  file_permission = "0600"
+}
@@ -0,0 +1,7 @@
+data "truenas_dataset_encryption_summary" "tank" {
+  dataset_id = "tank/secure"
+}
+
+output "locked_datasets" {
+  value = [for d in data.truenas_dataset_encryption_summary.tank.datasets : d.name if d.locked]
+}
@@ -0,0 +1,17 @@
+# Look up how to connect to the consoles of a VM
+data "truenas_vm_display" "ubuntu" {
+  vm_id = truenas_vm.ubuntu.id
+
+  # Optional: the name clients reach TrueNAS under, when it differs from the
+  # host of the provider URL
+  host = "nas.example.com"
+}
+
+output "ubuntu_remote_viewer" {
+  value = data.truenas_vm_display.ubuntu.displays[0].remote_viewer_uri
+}
+
+output "ubuntu_web_console" {
+  value     = data.truenas_vm_display.ubuntu.displays[0].web_uri
+  sensitive = true
+}
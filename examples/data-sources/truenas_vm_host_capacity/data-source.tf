@@ -0,0 +1,14 @@
+# Check what the host can offer to VMs
+data "truenas_vm_host_capacity" "host" {}
+
+output "free_vm_memory_mb" {
+  value = data.truenas_vm_host_capacity.host.available_memory_mb
+}
+
+# Size a VM to what is free, up to 8 GiB
+resource "truenas_vm" "worker" {
+  name          = "worker"
+  memory        = min(8192, data.truenas_vm_host_capacity.host.available_memory_mb)
+  vcpus         = min(4, data.truenas_vm_host_capacity.host.maximum_supported_vcpus)
+  desired_state = "RUNNING"
+}
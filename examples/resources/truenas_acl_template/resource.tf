@@ -0,0 +1,20 @@
+# Standard permissions for department SMB shares, maintained in one place
+resource "truenas_acl_template" "department_share" {
+  name    = "DEPARTMENT_SHARE"
+  acltype = "NFS4"
+  comment = "Department shares: admins full control, department read/write"
+
+  entries = [
+    { tag = "owner@", type = "ALLOW", basic_perms = "FULL_CONTROL", basic_flags = "INHERIT" },
+    { tag = "GROUP", id = truenas_group.it_admins.gid, type = "ALLOW", basic_perms = "FULL_CONTROL", basic_flags = "INHERIT" },
+    { tag = "GROUP", id = truenas_group.finance.gid, type = "ALLOW", basic_perms = "MODIFY", basic_flags = "INHERIT" },
+    { tag = "everyone@", type = "DENY", perms = ["WRITE_DATA", "APPEND_DATA", "DELETE"] },
+  ]
+}
+
+# Each share references the template instead of repeating its entries
+resource "truenas_filesystem_acl" "finance" {
+  path     = "/mnt/tank/finance"
+  acltype  = "NFS4"
+  template = truenas_acl_template.department_share.name
+}
@@ -0,0 +1,19 @@
+resource "truenas_dataset" "secure" {
+  name = "tank/secure"
+
+  encryption = {
+    passphrase = var.secure_passphrase
+  }
+}
+
+# Unlock the dataset again on the next apply after a reboot
+resource "truenas_dataset_unlock" "secure" {
+  dataset_id       = truenas_dataset.secure.id
+  passphrase       = var.secure_passphrase
+  services_restart = ["cifs", "nfs"]
+}
+
+resource "truenas_smb_share" "secure" {
+  name = "secure"
+  path = "/mnt/${truenas_dataset_unlock.secure.dataset_id}"
+}
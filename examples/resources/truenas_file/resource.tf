@@ -0,0 +1,14 @@
+# Installer ISO streamed from the machine running Terraform
+resource "truenas_file" "debian_iso" {
+  destination = "/mnt/tank/isos/debian-12-amd64-netinst.iso"
+  source      = "${path.module}/debian-12-amd64-netinst.iso"
+}
+
+# Script owned by a service account
+resource "truenas_file" "backup_script" {
+  destination = "/mnt/tank/scripts/backup.sh"
+  content     = file("${path.module}/backup.sh")
+  mode        = "0750"
+  owner       = "backup"
+  group       = "backup"
+}
@@ -0,0 +1,43 @@
+resource "truenas_dataset" "share" {
+  name = "tank/share"
+}
+
+resource "truenas_smb_share" "share" {
+  name = "share"
+  path = "/mnt/${truenas_dataset.share.id}"
+}
+
+# NFSv4 ACL for an SMB share on a dataset with acltype NFSV4
+resource "truenas_filesystem_acl" "share" {
+  path    = truenas_smb_share.share.path
+  acltype = "NFS4"
+  uid     = truenas_user.alice.uid
+
+  entries = [
+    { tag = "owner@", type = "ALLOW", basic_perms = "FULL_CONTROL", basic_flags = "INHERIT" },
+    { tag = "GROUP", who = "finance", type = "ALLOW", basic_perms = "MODIFY", basic_flags = "INHERIT" },
+    { tag = "everyone@", type = "ALLOW", basic_perms = "TRAVERSE", basic_flags = "NOINHERIT" },
+  ]
+}
+
+# POSIX.1e ACL, applied to the whole tree
+resource "truenas_filesystem_acl" "backups" {
+  path      = "/mnt/tank/backups"
+  acltype   = "POSIX1E"
+  recursive = true
+
+  entries = [
+    { tag = "USER_OBJ", perms = ["READ", "WRITE", "EXECUTE"] },
+    { tag = "GROUP_OBJ", perms = ["READ", "EXECUTE"] },
+    { tag = "USER", id = 3000, perms = ["READ", "WRITE", "EXECUTE"] },
+    { tag = "MASK", perms = ["READ", "WRITE", "EXECUTE"] },
+    { tag = "OTHER", perms = [] },
+  ]
+}
+
+# NFSv4 ACL from a built-in template or a truenas_acl_template
+resource "truenas_filesystem_acl" "projects" {
+  path     = "/mnt/tank/projects"
+  acltype  = "NFS4"
+  template = "NFS4_RESTRICTED"
+}
@@ -0,0 +1,18 @@
+resource "truenas_dataset" "media" {
+  name = "tank/media"
+}
+
+# Mode and owner of the dataset's mountpoint
+resource "truenas_filesystem_permission" "media" {
+  dataset_id = truenas_dataset.media.id
+  mode       = "0770"
+  uid        = truenas_user.jellyfin.uid
+  gid        = truenas_group.media.gid
+}
+
+# Owner of a directory tree, leaving its mode and ACL alone
+resource "truenas_filesystem_permission" "downloads" {
+  path      = "/mnt/tank/downloads"
+  uid       = 3000
+  recursive = true
+}
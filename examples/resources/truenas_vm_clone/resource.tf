@@ -0,0 +1,29 @@
+# Golden image VM, built once
+data "truenas_vm" "golden" {
+  name = "golden"
+}
+
+# Exact copies of the golden image
+resource "truenas_vm_clone" "lab" {
+  count = 3
+
+  source_vm_id = data.truenas_vm.golden.id
+  name         = "lab${count.index}"
+}
+
+# A clone with its own settings and devices
+resource "truenas_vm" "web" {
+  name          = "web"
+  memory        = 4096
+  vcpus         = 4
+  desired_state = "RUNNING"
+
+  clone_from = {
+    vm_id       = data.truenas_vm.golden.id
+    name_suffix = "web"
+  }
+
+  nic_devices = [
+    { nic_attach = "br0" },
+  ]
+}
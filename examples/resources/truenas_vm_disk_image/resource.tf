@@ -0,0 +1,22 @@
+# Root disk from a Debian cloud image, converted from qcow2 on upload
+resource "truenas_vm_disk_image" "debian" {
+  name        = "tank/vms/debian-root"
+  source      = "${path.module}/debian-12-genericcloud-amd64.qcow2"
+  source_hash = filesha256("${path.module}/debian-12-genericcloud-amd64.qcow2")
+
+  # Grow the disk beyond the image's 2 GiB
+  volsize = 21474836480
+}
+
+resource "truenas_vm" "debian" {
+  name   = "debian"
+  memory = 2048
+
+  disk_devices = [
+    { path = truenas_vm_disk_image.debian.path },
+  ]
+
+  cloud_init = {
+    user_data = file("${path.module}/user-data.yaml")
+  }
+}
@@ -20,11 +20,11 @@ resource "truenas_vm" "ubuntu_static" {
   memory      = 4096
   autostart   = true
 
-  cloud_init {
+  cloud_init = {
     user_data      = file("${path.module}/user-data")
     meta_data      = file("${path.module}/meta-data")
     network_config = file("${path.module}/network-config")
-    filename       = "cloud-init-${self.name}.iso"
+    filename       = "cloud-init-ubuntu-static-ip.iso"
     upload_path    = "/mnt/${var.pool_name}/isos/"
   }
 }
@@ -37,10 +37,10 @@ resource "truenas_vm" "ubuntu_dhcp" {
   memory      = 4096
   autostart   = true
 
-  cloud_init {
+  cloud_init = {
     user_data   = file("${path.module}/user-data-dhcp")
     meta_data   = file("${path.module}/meta-data-dhcp")
-    filename    = "cloud-init-${self.name}.iso"
+    filename    = "cloud-init-ubuntu-dhcp.iso"
     upload_path = "/mnt/${var.pool_name}/isos/"
   }
 }
@@ -0,0 +1,437 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/terraform-plugin-framework-validators/setvalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+)
+
+// ACLEntryModel is an NFSv4 or POSIX.1e access control entry. NFSv4 entries
+// give their permissions and inheritance flags either as a basic set or as
+// advanced ones; POSIX.1e entries give READ, WRITE and EXECUTE in perms.
+type ACLEntryModel struct {
+	Tag        types.String `tfsdk:"tag"`
+	ID         types.Int64  `tfsdk:"id"`
+	Who        types.String `tfsdk:"who"`
+	Type       types.String `tfsdk:"type"`
+	BasicPerms types.String `tfsdk:"basic_perms"`
+	Perms      types.Set    `tfsdk:"perms"`
+	BasicFlags types.String `tfsdk:"basic_flags"`
+	Flags      types.Set    `tfsdk:"flags"`
+	Default    types.Bool   `tfsdk:"default"`
+}
+
+var nfs4ACLTags = []string{"owner@", "group@", "everyone@", "USER", "GROUP"}
+
+var posix1eACLTags = []string{"USER_OBJ", "GROUP_OBJ", "OTHER", "MASK", "USER", "GROUP"}
+
+// aclEntryAttributes returns the schema of the attributes of an ACL entry
+func aclEntryAttributes() map[string]schema.Attribute {
+	perms := append(append([]string{}, truenas.NFS4Perms...), truenas.POSIX1EPerms...)
+
+	return map[string]schema.Attribute{
+		"tag": schema.StringAttribute{
+			MarkdownDescription: "Who the entry applies to: `owner@`, `group@`, `everyone@`, `USER` or `GROUP` for NFS4 ACLs, and `USER_OBJ`, `GROUP_OBJ`, `OTHER`, `MASK`, `USER` or `GROUP` for POSIX1E ACLs",
+			Required:            true,
+			Validators: []validator.String{
+				stringvalidator.OneOf(append(append([]string{}, nfs4ACLTags...), posix1eACLTags[:4]...)...),
+			},
+		},
+		"id": schema.Int64Attribute{
+			MarkdownDescription: "UID or GID of a `USER` or `GROUP` entry. Exactly one of `id` and `who` must be set for these entries.",
+			Optional:            true,
+		},
+		"who": schema.StringAttribute{
+			MarkdownDescription: "Name of the user or group of a `USER` or `GROUP` entry",
+			Optional:            true,
+		},
+		"type": schema.StringAttribute{
+			MarkdownDescription: "`ALLOW` or `DENY`. Required for NFS4 entries.",
+			Optional:            true,
+			Validators: []validator.String{
+				stringvalidator.OneOf("ALLOW", "DENY"),
+			},
+		},
+		"basic_perms": schema.StringAttribute{
+			MarkdownDescription: "Basic permission set of an NFS4 entry: `FULL_CONTROL`, `MODIFY`, `READ` or `TRAVERSE`. NFS4 entries set exactly one of `basic_perms` and `perms`.",
+			Optional:            true,
+			Validators: []validator.String{
+				stringvalidator.OneOf("FULL_CONTROL", "MODIFY", "READ", "TRAVERSE"),
+			},
+		},
+		"perms": schema.SetAttribute{
+			MarkdownDescription: "Advanced permissions of an NFS4 entry, such as `READ_DATA` or `WRITE_ACL`, or the permissions of a POSIX1E entry among `READ`, `WRITE` and `EXECUTE`",
+			Optional:            true,
+			ElementType:         types.StringType,
+			Validators: []validator.Set{
+				setvalidator.ValueStringsAre(stringvalidator.OneOf(perms...)),
+			},
+		},
+		"basic_flags": schema.StringAttribute{
+			MarkdownDescription: "Basic inheritance flags of an NFS4 entry: `INHERIT` or `NOINHERIT`",
+			Optional:            true,
+			Validators: []validator.String{
+				stringvalidator.OneOf("INHERIT", "NOINHERIT"),
+				stringvalidator.ConflictsWith(path.MatchRelative().AtParent().AtName("flags")),
+			},
+		},
+		"flags": schema.SetAttribute{
+			MarkdownDescription: "Advanced inheritance flags of an NFS4 entry: `FILE_INHERIT`, `DIRECTORY_INHERIT`, `NO_PROPAGATE_INHERIT`, `INHERIT_ONLY` or `INHERITED`. Without `basic_flags` or `flags`, the entry is not inherited.",
+			Optional:            true,
+			ElementType:         types.StringType,
+			Validators: []validator.Set{
+				setvalidator.ValueStringsAre(stringvalidator.OneOf(truenas.NFS4Flags...)),
+			},
+		},
+		"default": schema.BoolAttribute{
+			MarkdownDescription: "Whether a POSIX1E entry is a default entry, inherited by new files and directories",
+			Optional:            true,
+		},
+	}
+}
+
+// validateACLEntries checks that entries fit their ACL type, which the
+// schema cannot express. Unknown values are skipped.
+func validateACLEntries(ctx context.Context, acltype string, entries []ACLEntryModel, root path.Path, diags *diag.Diagnostics) {
+	validTags := map[string]bool{}
+	tags := posix1eACLTags
+	if acltype == truenas.ACLTypeNFS4 {
+		tags = nfs4ACLTags
+	}
+	for _, tag := range tags {
+		validTags[tag] = true
+	}
+
+	for i, entry := range entries {
+		entryPath := root.AtListIndex(i)
+		if entry.Tag.IsUnknown() {
+			continue
+		}
+		tag := entry.Tag.ValueString()
+		if !validTags[tag] {
+			diags.AddAttributeError(entryPath.AtName("tag"), "Invalid Attribute Value", fmt.Sprintf("%s ACLs cannot have %q entries.", acltype, tag))
+			continue
+		}
+
+		if tag == "USER" || tag == "GROUP" {
+			if entry.ID.IsNull() == entry.Who.IsNull() {
+				diags.AddAttributeError(entryPath, "Invalid Attribute Combination", fmt.Sprintf("%s entries need exactly one of id and who.", tag))
+			}
+		} else if !entry.ID.IsNull() || !entry.Who.IsNull() {
+			diags.AddAttributeError(entryPath, "Invalid Attribute Combination", fmt.Sprintf("Only USER and GROUP entries take an id or who, not %s.", tag))
+		}
+
+		if acltype == truenas.ACLTypeNFS4 {
+			if entry.Type.IsNull() {
+				diags.AddAttributeError(entryPath.AtName("type"), "Missing Attribute Value", "NFS4 entries need a type.")
+			}
+			if entry.BasicPerms.IsNull() == entry.Perms.IsNull() {
+				diags.AddAttributeError(entryPath, "Invalid Attribute Combination", "NFS4 entries need exactly one of basic_perms and perms.")
+			}
+			validateACLPerms(ctx, entry.Perms, truenas.NFS4Perms, entryPath.AtName("perms"), diags)
+			if !entry.Default.IsNull() {
+				diags.AddAttributeError(entryPath.AtName("default"), "Invalid Attribute Value", "default only applies to POSIX1E entries.")
+			}
+			continue
+		}
+
+		for name, value := range map[string]interface{ IsNull() bool }{
+			"type":        entry.Type,
+			"basic_perms": entry.BasicPerms,
+			"basic_flags": entry.BasicFlags,
+			"flags":       entry.Flags,
+		} {
+			if !value.IsNull() {
+				diags.AddAttributeError(entryPath.AtName(name), "Invalid Attribute Value", fmt.Sprintf("%s only applies to NFS4 entries.", name))
+			}
+		}
+		if entry.Perms.IsNull() {
+			diags.AddAttributeError(entryPath.AtName("perms"), "Missing Attribute Value", "POSIX1E entries need perms, which may be empty.")
+		}
+		validateACLPerms(ctx, entry.Perms, truenas.POSIX1EPerms, entryPath.AtName("perms"), diags)
+	}
+}
+
+// validateACLPerms checks that the known permissions of an entry are valid
+// for its ACL type
+func validateACLPerms(ctx context.Context, perms types.Set, valid []string, attr path.Path, diags *diag.Diagnostics) {
+	if perms.IsNull() || perms.IsUnknown() {
+		return
+	}
+	validSet := map[string]bool{}
+	for _, perm := range valid {
+		validSet[perm] = true
+	}
+	for _, element := range perms.Elements() {
+		perm, ok := element.(types.String)
+		if !ok || perm.IsUnknown() || validSet[perm.ValueString()] {
+			continue
+		}
+		diags.AddAttributeError(attr, "Invalid Attribute Value", fmt.Sprintf("%q is not a valid permission for this ACL type.", perm.ValueString()))
+	}
+}
+
+// aclEntriesToAPI converts entries into the dacl of /filesystem/setacl
+func aclEntriesToAPI(ctx context.Context, acltype string, entries []ACLEntryModel) ([]truenas.ACLEntry, diag.Diagnostics) {
+	var diags diag.Diagnostics
+	result := make([]truenas.ACLEntry, 0, len(entries))
+	for _, entry := range entries {
+		apiEntry := truenas.ACLEntry{Tag: entry.Tag.ValueString()}
+		if !entry.ID.IsNull() {
+			apiEntry.ID = entry.ID.ValueInt64Pointer()
+		}
+		if !entry.Who.IsNull() {
+			apiEntry.Who = entry.Who.ValueStringPointer()
+		}
+
+		var perms []string
+		if !entry.Perms.IsNull() {
+			diags.Append(entry.Perms.ElementsAs(ctx, &perms, false)...)
+		}
+
+		if acltype == truenas.ACLTypeNFS4 {
+			apiEntry.Type = entry.Type.ValueString()
+			apiEntry.Perms = map[string]interface{}{}
+			if !entry.BasicPerms.IsNull() {
+				apiEntry.Perms["BASIC"] = entry.BasicPerms.ValueString()
+			}
+			for _, perm := range perms {
+				apiEntry.Perms[perm] = true
+			}
+
+			apiEntry.Flags = map[string]interface{}{}
+			if !entry.BasicFlags.IsNull() {
+				apiEntry.Flags["BASIC"] = entry.BasicFlags.ValueString()
+			}
+			var flags []string
+			if !entry.Flags.IsNull() {
+				diags.Append(entry.Flags.ElementsAs(ctx, &flags, false)...)
+			}
+			for _, flag := range flags {
+				apiEntry.Flags[flag] = true
+			}
+		} else {
+			if apiEntry.ID == nil && apiEntry.Who == nil {
+				noID := int64(-1)
+				apiEntry.ID = &noID
+			}
+			apiEntry.Perms = map[string]interface{}{}
+			for _, perm := range truenas.POSIX1EPerms {
+				apiEntry.Perms[perm] = false
+			}
+			for _, perm := range perms {
+				apiEntry.Perms[perm] = true
+			}
+			isDefault := entry.Default.ValueBool()
+			apiEntry.Default = &isDefault
+		}
+		result = append(result, apiEntry)
+	}
+	return result, diags
+}
+
+// aclEntriesFromAPI converts the entries returned by /filesystem/getacl or
+// of an ACL template, keeping the form of the prior entries: id or who, and basic or advanced
+// permissions and flags when they match. Without prior entries, as on
+// import, USER and GROUP entries get their id and NFS4 entries the basic
+// sets that match. The order of POSIX1E entries does not matter, so the
+// prior order is kept when the entries are the same.
+func aclEntriesFromAPI(ctx context.Context, acl *truenas.ACL, prior []ACLEntryModel) ([]ACLEntryModel, diag.Diagnostics) {
+	var diags diag.Diagnostics
+	isNFS4 := acl.ACLType == truenas.ACLTypeNFS4
+	used := make([]bool, len(prior))
+
+	result := make([]ACLEntryModel, 0, len(acl.Entries))
+	for i, entry := range acl.Entries {
+		var hint *ACLEntryModel
+		if isNFS4 {
+			if i < len(prior) && prior[i].Tag.ValueString() == entry.Tag {
+				hint = &prior[i]
+			}
+		} else {
+			for j := range prior {
+				if !used[j] && posix1eEntryMatches(prior[j], entry) {
+					hint, used[j] = &prior[j], true
+					break
+				}
+			}
+		}
+
+		model := ACLEntryModel{
+			Tag:        types.StringValue(entry.Tag),
+			ID:         types.Int64Null(),
+			Who:        types.StringNull(),
+			Type:       types.StringNull(),
+			BasicPerms: types.StringNull(),
+			Perms:      types.SetNull(types.StringType),
+			BasicFlags: types.StringNull(),
+			Flags:      types.SetNull(types.StringType),
+			Default:    types.BoolNull(),
+		}
+		if entry.Tag == "USER" || entry.Tag == "GROUP" {
+			if hint != nil && !hint.Who.IsNull() && entry.Who != nil {
+				model.Who = types.StringValue(*entry.Who)
+			} else if entry.ID != nil {
+				model.ID = types.Int64Value(*entry.ID)
+			}
+		}
+
+		perms := setKeys(entry.Perms)
+		if isNFS4 {
+			// Templates may keep the basic sets they were created with
+			perms = expandBasicSet(entry.Perms, truenas.NFS4BasicPerms, perms)
+			model.Type = types.StringValue(entry.Type)
+
+			basic := matchBasicSet(perms, truenas.NFS4BasicPerms)
+			if basic != "" && (hint == nil || !hint.BasicPerms.IsNull()) {
+				model.BasicPerms = types.StringValue(basic)
+			} else {
+				model.Perms = stringSetValue(ctx, perms, &diags)
+			}
+
+			flags := expandBasicSet(entry.Flags, truenas.NFS4BasicFlags, setKeys(entry.Flags))
+			basic = matchBasicSet(flags, truenas.NFS4BasicFlags)
+			switch {
+			case hint != nil && !hint.BasicFlags.IsNull() && basic != "":
+				model.BasicFlags = types.StringValue(basic)
+			case hint != nil && !hint.Flags.IsNull():
+				model.Flags = stringSetValue(ctx, flags, &diags)
+			case len(flags) == 0:
+			case hint == nil && basic != "":
+				model.BasicFlags = types.StringValue(basic)
+			default:
+				model.Flags = stringSetValue(ctx, flags, &diags)
+			}
+		} else {
+			model.Perms = stringSetValue(ctx, perms, &diags)
+			isDefault := entry.Default != nil && *entry.Default
+			if isDefault || (hint != nil && !hint.Default.IsNull()) {
+				model.Default = types.BoolValue(isDefault)
+			}
+		}
+		result = append(result, model)
+	}
+
+	if !isNFS4 && len(result) == len(prior) {
+		same := true
+		for _, u := range used {
+			same = same && u
+		}
+		for i := range result {
+			same = same && aclEntryIn(result[i], prior)
+		}
+		if same {
+			return append([]ACLEntryModel{}, prior...), diags
+		}
+	}
+	return result, diags
+}
+
+// posix1eEntryMatches reports whether a prior POSIX1E entry designates the
+// same user or group as an entry returned by the API
+func posix1eEntryMatches(prior ACLEntryModel, entry truenas.ACLEntry) bool {
+	if prior.Tag.ValueString() != entry.Tag || prior.Default.ValueBool() != (entry.Default != nil && *entry.Default) {
+		return false
+	}
+	if entry.Tag != "USER" && entry.Tag != "GROUP" {
+		return true
+	}
+	if !prior.Who.IsNull() {
+		return entry.Who != nil && prior.Who.ValueString() == *entry.Who
+	}
+	return entry.ID != nil && prior.ID.ValueInt64() == *entry.ID
+}
+
+// aclEntryIn reports whether entries contain an entry equal to entry
+func aclEntryIn(entry ACLEntryModel, entries []ACLEntryModel) bool {
+	for _, other := range entries {
+		if aclEntryEqual(entry, other) {
+			return true
+		}
+	}
+	return false
+}
+
+// aclEntriesEqual reports whether two lists hold equal entries in the same
+// order
+func aclEntriesEqual(a, b []ACLEntryModel) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !aclEntryEqual(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// aclEntryEqual reports whether two entries are equal
+func aclEntryEqual(a, b ACLEntryModel) bool {
+	return a.Tag.Equal(b.Tag) && a.ID.Equal(b.ID) && a.Who.Equal(b.Who) &&
+		a.Type.Equal(b.Type) && a.BasicPerms.Equal(b.BasicPerms) && a.Perms.Equal(b.Perms) &&
+		a.BasicFlags.Equal(b.BasicFlags) && a.Flags.Equal(b.Flags) && a.Default.Equal(b.Default)
+}
+
+// setKeys returns the sorted keys of the permissions or flags that are set
+func setKeys(m map[string]interface{}) []string {
+	keys := []string{}
+	for key, v := range m {
+		if on, _ := v.(bool); on {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// expandBasicSet returns the sorted members of the basic set named under
+// the BASIC key of m, or keys when m has none
+func expandBasicSet(m map[string]interface{}, basic map[string][]string, keys []string) []string {
+	name, ok := m["BASIC"].(string)
+	if !ok {
+		return keys
+	}
+	members := append([]string{}, basic[name]...)
+	sort.Strings(members)
+	return members
+}
+
+// matchBasicSet returns the name of the basic set made of exactly keys, or
+// "" when there is none
+func matchBasicSet(keys []string, basic map[string][]string) string {
+	for name, members := range basic {
+		if len(members) != len(keys) {
+			continue
+		}
+		set := map[string]bool{}
+		for _, member := range members {
+			set[member] = true
+		}
+		matches := true
+		for _, key := range keys {
+			matches = matches && set[key]
+		}
+		if matches {
+			return name
+		}
+	}
+	return ""
+}
+
+// stringSetValue returns a set of strings, appending conversion errors to
+// diags
+func stringSetValue(ctx context.Context, values []string, diags *diag.Diagnostics) types.Set {
+	set, d := types.SetValueFrom(ctx, types.StringType, values)
+	diags.Append(d...)
+	return set
+}
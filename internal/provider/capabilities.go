@@ -0,0 +1,37 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+)
+
+// checkFeatures reports an error for each feature the server release does
+// not provide. Resources call it from ModifyPlan so an incompatible server
+// fails the plan instead of the apply. Nothing is checked before the
+// provider is configured or when the server version could not be detected.
+func checkFeatures(client *truenas.Client, typeName string, diags *diag.Diagnostics, features ...truenas.Feature) {
+	if client == nil {
+		return
+	}
+
+	for _, feature := range features {
+		err := client.CheckFeature(feature)
+		if err == nil {
+			continue
+		}
+
+		var unsupported *truenas.UnsupportedFeatureError
+		if !errors.As(err, &unsupported) {
+			diags.AddError("Client Error", err.Error())
+			continue
+		}
+		diags.AddError(
+			"Unsupported TrueNAS Version",
+			fmt.Sprintf("%s requires the %s API, which is not available on TrueNAS %s (available %s).",
+				typeName, unsupported.Feature, unsupported.Version, unsupported.Required),
+		)
+	}
+}
@@ -0,0 +1,137 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"gopkg.in/yaml.v3"
+)
+
+// CloudInitNetworkModel is the structured network block of cloud_init,
+// rendered to network-config version 2
+type CloudInitNetworkModel struct {
+	Interfaces    []CloudInitInterfaceModel `tfsdk:"interfaces"`
+	Nameservers   types.List                `tfsdk:"nameservers"`
+	SearchDomains types.List                `tfsdk:"search_domains"`
+}
+
+type CloudInitInterfaceModel struct {
+	Name       types.String `tfsdk:"name"`
+	MACAddress types.String `tfsdk:"mac_address"`
+	DHCP4      types.Bool   `tfsdk:"dhcp4"`
+	DHCP6      types.Bool   `tfsdk:"dhcp6"`
+	Addresses  types.List   `tfsdk:"addresses"`
+	Gateway4   types.String `tfsdk:"gateway4"`
+	Gateway6   types.String `tfsdk:"gateway6"`
+	MTU        types.Int64  `tfsdk:"mtu"`
+}
+
+// networkConfigV2 is the network-config version 2 document. Field order is
+// the order of the rendered YAML.
+type networkConfigV2 struct {
+	Version   int                          `yaml:"version"`
+	Ethernets map[string]networkEthernetV2 `yaml:"ethernets"`
+}
+
+type networkEthernetV2 struct {
+	Match       *networkMatchV2       `yaml:"match,omitempty"`
+	SetName     string                `yaml:"set-name,omitempty"`
+	DHCP4       *bool                 `yaml:"dhcp4,omitempty"`
+	DHCP6       *bool                 `yaml:"dhcp6,omitempty"`
+	Addresses   []string              `yaml:"addresses,omitempty"`
+	Routes      []networkRouteV2      `yaml:"routes,omitempty"`
+	MTU         int64                 `yaml:"mtu,omitempty"`
+	Nameservers *networkNameserversV2 `yaml:"nameservers,omitempty"`
+}
+
+type networkMatchV2 struct {
+	MACAddress string `yaml:"macaddress"`
+}
+
+type networkRouteV2 struct {
+	To  string `yaml:"to"`
+	Via string `yaml:"via"`
+}
+
+type networkNameserversV2 struct {
+	Addresses []string `yaml:"addresses,omitempty"`
+	Search    []string `yaml:"search,omitempty"`
+}
+
+// renderNetworkConfig renders the network block to network-config version 2.
+// An interface without addresses uses DHCPv4 unless dhcp4 is set. Gateways
+// become default routes, and the nameservers apply to every interface.
+func renderNetworkConfig(ctx context.Context, network *CloudInitNetworkModel) (string, error) {
+	var nameservers networkNameserversV2
+	var err error
+	if nameservers.Addresses, err = stringElements(ctx, network.Nameservers); err != nil {
+		return "", err
+	}
+	if nameservers.Search, err = stringElements(ctx, network.SearchDomains); err != nil {
+		return "", err
+	}
+
+	config := networkConfigV2{
+		Version:   2,
+		Ethernets: make(map[string]networkEthernetV2, len(network.Interfaces)),
+	}
+	for _, iface := range network.Interfaces {
+		var ethernet networkEthernetV2
+		if ethernet.Addresses, err = stringElements(ctx, iface.Addresses); err != nil {
+			return "", err
+		}
+
+		if mac := iface.MACAddress.ValueString(); mac != "" {
+			ethernet.Match = &networkMatchV2{MACAddress: mac}
+			ethernet.SetName = iface.Name.ValueString()
+		}
+		if !iface.DHCP4.IsNull() {
+			dhcp4 := iface.DHCP4.ValueBool()
+			ethernet.DHCP4 = &dhcp4
+		} else if len(ethernet.Addresses) == 0 {
+			dhcp4 := true
+			ethernet.DHCP4 = &dhcp4
+		}
+		if !iface.DHCP6.IsNull() {
+			dhcp6 := iface.DHCP6.ValueBool()
+			ethernet.DHCP6 = &dhcp6
+		}
+		if gateway := iface.Gateway4.ValueString(); gateway != "" {
+			ethernet.Routes = append(ethernet.Routes, networkRouteV2{To: "0.0.0.0/0", Via: gateway})
+		}
+		if gateway := iface.Gateway6.ValueString(); gateway != "" {
+			ethernet.Routes = append(ethernet.Routes, networkRouteV2{To: "::/0", Via: gateway})
+		}
+		ethernet.MTU = iface.MTU.ValueInt64()
+		if len(nameservers.Addresses) > 0 || len(nameservers.Search) > 0 {
+			ethernet.Nameservers = &nameservers
+		}
+
+		config.Ethernets[iface.Name.ValueString()] = ethernet
+	}
+
+	out, err := yaml.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to render network-config: %w", err)
+	}
+	return string(out), nil
+}
+
+// cloudInitNetworkConfig returns the network-config of the seed ISO: the
+// rendered network block, or network_config as given
+func cloudInitNetworkConfig(ctx context.Context, cloudInit *CloudInitModel) (string, error) {
+	if cloudInit.Network != nil {
+		return renderNetworkConfig(ctx, cloudInit.Network)
+	}
+	return cloudInit.NetworkConfig.ValueString(), nil
+}
+
+// stringElements returns the values of a list of strings
+func stringElements(ctx context.Context, list types.List) ([]string, error) {
+	var values []string
+	if diags := list.ElementsAs(ctx, &values, false); diags.HasError() {
+		return nil, fmt.Errorf("%s: %s", diags.Errors()[0].Summary(), diags.Errors()[0].Detail())
+	}
+	return values, nil
+}
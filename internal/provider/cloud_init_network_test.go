@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stringList(values ...string) types.List {
+	elements := make([]attr.Value, len(values))
+	for i, value := range values {
+		elements[i] = types.StringValue(value)
+	}
+	return types.ListValueMust(types.StringType, elements)
+}
+
+func TestRenderNetworkConfig_Static(t *testing.T) {
+	network := &CloudInitNetworkModel{
+		Interfaces: []CloudInitInterfaceModel{
+			{
+				Name:       types.StringValue("eth0"),
+				MACAddress: types.StringValue("00:a0:98:00:00:01"),
+				Addresses:  stringList("192.168.1.100/24"),
+				Gateway4:   types.StringValue("192.168.1.1"),
+				MTU:        types.Int64Value(9000),
+			},
+		},
+		Nameservers:   stringList("192.168.1.1", "1.1.1.1"),
+		SearchDomains: stringList("lab.example.com"),
+	}
+
+	config, err := renderNetworkConfig(context.Background(), network)
+
+	require.NoError(t, err)
+	assert.Equal(t, `version: 2
+ethernets:
+    eth0:
+        match:
+            macaddress: 00:a0:98:00:00:01
+        set-name: eth0
+        addresses:
+            - 192.168.1.100/24
+        routes:
+            - to: 0.0.0.0/0
+              via: 192.168.1.1
+        mtu: 9000
+        nameservers:
+            addresses:
+                - 192.168.1.1
+                - 1.1.1.1
+            search:
+                - lab.example.com
+`, config)
+}
+
+func TestRenderNetworkConfig_DHCPByDefault(t *testing.T) {
+	network := &CloudInitNetworkModel{
+		Interfaces: []CloudInitInterfaceModel{
+			{Name: types.StringValue("enp1s0"), Addresses: types.ListNull(types.StringType), DHCP6: types.BoolValue(true)},
+			{Name: types.StringValue("enp2s0"), Addresses: stringList("fd00::10/64"), Gateway6: types.StringValue("fd00::1")},
+		},
+		Nameservers:   types.ListNull(types.StringType),
+		SearchDomains: types.ListNull(types.StringType),
+	}
+
+	config, err := renderNetworkConfig(context.Background(), network)
+
+	require.NoError(t, err)
+	assert.Equal(t, `version: 2
+ethernets:
+    enp1s0:
+        dhcp4: true
+        dhcp6: true
+    enp2s0:
+        addresses:
+            - fd00::10/64
+        routes:
+            - to: ::/0
+              via: fd00::1
+`, config)
+}
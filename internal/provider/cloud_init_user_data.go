@@ -0,0 +1,231 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"gopkg.in/yaml.v3"
+)
+
+// cloudConfigHeader starts every cloud-config document
+const cloudConfigHeader = "#cloud-config"
+
+// userDataBoundary separates the parts of multipart user-data. It is fixed,
+// so that the same configuration always produces the same ISO.
+const userDataBoundary = "==TRUENAS-CLOUD-INIT=="
+
+// cloudConfigMergeType makes cloud-init append the lists of the rendered
+// cloud-config to those of raw user-data, instead of replacing them
+const cloudConfigMergeType = "list(append)+dict(no_replace,recurse_list)+str()"
+
+// CloudInitUserDataConfigModel is the structured user_data_config block of
+// cloud_init, rendered to cloud-config
+type CloudInitUserDataConfigModel struct {
+	Users             []CloudInitUserModel      `tfsdk:"users"`
+	SSHAuthorizedKeys types.List                `tfsdk:"ssh_authorized_keys"`
+	Packages          types.List                `tfsdk:"packages"`
+	WriteFiles        []CloudInitWriteFileModel `tfsdk:"write_files"`
+	RunCmd            types.List                `tfsdk:"runcmd"`
+	BootCmd           types.List                `tfsdk:"bootcmd"`
+}
+
+type CloudInitUserModel struct {
+	Name              types.String `tfsdk:"name"`
+	Groups            types.List   `tfsdk:"groups"`
+	Sudo              types.String `tfsdk:"sudo"`
+	Shell             types.String `tfsdk:"shell"`
+	LockPasswd        types.Bool   `tfsdk:"lock_passwd"`
+	SSHAuthorizedKeys types.List   `tfsdk:"ssh_authorized_keys"`
+}
+
+type CloudInitWriteFileModel struct {
+	Path        types.String `tfsdk:"path"`
+	Content     types.String `tfsdk:"content"`
+	Owner       types.String `tfsdk:"owner"`
+	Permissions types.String `tfsdk:"permissions"`
+	Append      types.Bool   `tfsdk:"append"`
+}
+
+// cloudConfig is the rendered cloud-config document. Field order is the
+// order of the rendered YAML.
+type cloudConfig struct {
+	Users             []interface{}          `yaml:"users,omitempty"`
+	SSHAuthorizedKeys []string               `yaml:"ssh_authorized_keys,omitempty"`
+	Packages          []string               `yaml:"packages,omitempty"`
+	WriteFiles        []cloudConfigWriteFile `yaml:"write_files,omitempty"`
+	BootCmd           []string               `yaml:"bootcmd,omitempty"`
+	RunCmd            []string               `yaml:"runcmd,omitempty"`
+}
+
+type cloudConfigUser struct {
+	Name              string   `yaml:"name"`
+	Groups            []string `yaml:"groups,omitempty"`
+	Sudo              string   `yaml:"sudo,omitempty"`
+	Shell             string   `yaml:"shell,omitempty"`
+	LockPasswd        *bool    `yaml:"lock_passwd,omitempty"`
+	SSHAuthorizedKeys []string `yaml:"ssh_authorized_keys,omitempty"`
+}
+
+type cloudConfigWriteFile struct {
+	Path        string `yaml:"path"`
+	Content     string `yaml:"content"`
+	Owner       string `yaml:"owner,omitempty"`
+	Permissions string `yaml:"permissions,omitempty"`
+	Append      bool   `yaml:"append,omitempty"`
+}
+
+// renderCloudConfig renders the user_data_config block to a cloud-config
+// document. A user named "default" is rendered as the distribution's default
+// user, which cloud-init otherwise does not create once users is set.
+func renderCloudConfig(ctx context.Context, config *CloudInitUserDataConfigModel) (string, error) {
+	var out cloudConfig
+	var err error
+
+	for _, user := range config.Users {
+		if user.Name.ValueString() == "default" {
+			out.Users = append(out.Users, "default")
+			continue
+		}
+
+		rendered := cloudConfigUser{
+			Name:  user.Name.ValueString(),
+			Sudo:  user.Sudo.ValueString(),
+			Shell: user.Shell.ValueString(),
+		}
+		if rendered.Groups, err = stringElements(ctx, user.Groups); err != nil {
+			return "", err
+		}
+		if !user.LockPasswd.IsNull() {
+			lockPasswd := user.LockPasswd.ValueBool()
+			rendered.LockPasswd = &lockPasswd
+		}
+		if rendered.SSHAuthorizedKeys, err = stringElements(ctx, user.SSHAuthorizedKeys); err != nil {
+			return "", err
+		}
+		out.Users = append(out.Users, rendered)
+	}
+	if out.SSHAuthorizedKeys, err = stringElements(ctx, config.SSHAuthorizedKeys); err != nil {
+		return "", err
+	}
+	if out.Packages, err = stringElements(ctx, config.Packages); err != nil {
+		return "", err
+	}
+	for _, file := range config.WriteFiles {
+		out.WriteFiles = append(out.WriteFiles, cloudConfigWriteFile{
+			Path:        file.Path.ValueString(),
+			Content:     file.Content.ValueString(),
+			Owner:       file.Owner.ValueString(),
+			Permissions: file.Permissions.ValueString(),
+			Append:      file.Append.ValueBool(),
+		})
+	}
+	if out.BootCmd, err = stringElements(ctx, config.BootCmd); err != nil {
+		return "", err
+	}
+	if out.RunCmd, err = stringElements(ctx, config.RunCmd); err != nil {
+		return "", err
+	}
+
+	rendered, err := yaml.Marshal(out)
+	if err != nil {
+		return "", fmt.Errorf("failed to render cloud-config: %w", err)
+	}
+	return cloudConfigHeader + "\n" + string(rendered), nil
+}
+
+// cloudInitUserData returns the user-data of the seed ISO. When both
+// user_data and user_data_config are set, they are combined into a MIME
+// multipart document, with the rendered cloud-config merged into user_data.
+func cloudInitUserData(ctx context.Context, cloudInit *CloudInitModel) (string, error) {
+	userData := cloudInit.UserData.ValueString()
+	if cloudInit.UserDataConfig == nil {
+		return userData, nil
+	}
+
+	rendered, err := renderCloudConfig(ctx, cloudInit.UserDataConfig)
+	if err != nil {
+		return "", err
+	}
+	if userData == "" {
+		return rendered, nil
+	}
+	return multipartUserData(userData, rendered)
+}
+
+// multipartUserData combines raw user-data and a rendered cloud-config into
+// a MIME multipart document
+func multipartUserData(userData, rendered string) (string, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	if err := writer.SetBoundary(userDataBoundary); err != nil {
+		return "", err
+	}
+
+	parts := []struct {
+		content string
+		header  textproto.MIMEHeader
+	}{
+		{userData, userDataPartHeader(userData, "user-data")},
+		{rendered, userDataPartHeader(rendered, "user-data-config")},
+	}
+	parts[1].header.Set("Merge-Type", cloudConfigMergeType)
+
+	for _, part := range parts {
+		w, err := writer.CreatePart(part.header)
+		if err != nil {
+			return "", err
+		}
+		if _, err := w.Write([]byte(part.content)); err != nil {
+			return "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Content-Type: multipart/mixed; boundary=%q\r\nMIME-Version: 1.0\r\n\r\n", userDataBoundary) + body.String(), nil
+}
+
+// userDataPartHeader returns the MIME header of a user-data part, with the
+// content type cloud-init derives from the part's first line
+func userDataPartHeader(content, filename string) textproto.MIMEHeader {
+	contentType := "text/plain"
+	switch {
+	case strings.HasPrefix(content, cloudConfigHeader):
+		contentType = "text/cloud-config"
+	case strings.HasPrefix(content, "#!"):
+		contentType = "text/x-shellscript"
+	case strings.HasPrefix(content, "#cloud-boothook"):
+		contentType = "text/cloud-boothook"
+	case strings.HasPrefix(content, "#include"):
+		contentType = "text/x-include-url"
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", fmt.Sprintf("%s; charset=\"utf-8\"", contentType))
+	header.Set("MIME-Version", "1.0")
+	header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	return header
+}
+
+// validateCloudConfig parses a cloud-config document and returns an error
+// describing why it is invalid. Other user-data formats are not checked.
+func validateCloudConfig(content string) error {
+	if !strings.HasPrefix(content, cloudConfigHeader) {
+		return nil
+	}
+
+	var document interface{}
+	if err := yaml.Unmarshal([]byte(content), &document); err != nil {
+		return err
+	}
+	if _, ok := document.(map[string]interface{}); !ok && document != nil {
+		return fmt.Errorf("cloud-config must be a YAML mapping")
+	}
+	return nil
+}
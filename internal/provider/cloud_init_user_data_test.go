@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testUserDataConfig() *CloudInitUserDataConfigModel {
+	return &CloudInitUserDataConfigModel{
+		Users: []CloudInitUserModel{
+			{Name: types.StringValue("default")},
+			{
+				Name:              types.StringValue("ops"),
+				Groups:            stringList("sudo", "adm"),
+				Sudo:              types.StringValue("ALL=(ALL) NOPASSWD:ALL"),
+				LockPasswd:        types.BoolValue(true),
+				SSHAuthorizedKeys: stringList("ssh-ed25519 AAAA ops"),
+			},
+		},
+		SSHAuthorizedKeys: types.ListNull(types.StringType),
+		Packages:          stringList("qemu-guest-agent"),
+		WriteFiles: []CloudInitWriteFileModel{
+			{Path: types.StringValue("/etc/motd"), Content: types.StringValue("hello\n"), Permissions: types.StringValue("0644")},
+		},
+		RunCmd:  stringList("systemctl enable --now qemu-guest-agent"),
+		BootCmd: types.ListNull(types.StringType),
+	}
+}
+
+func TestRenderCloudConfig(t *testing.T) {
+	config, err := renderCloudConfig(context.Background(), testUserDataConfig())
+
+	require.NoError(t, err)
+	assert.Equal(t, `#cloud-config
+users:
+    - default
+    - name: ops
+      groups:
+        - sudo
+        - adm
+      sudo: ALL=(ALL) NOPASSWD:ALL
+      lock_passwd: true
+      ssh_authorized_keys:
+        - ssh-ed25519 AAAA ops
+packages:
+    - qemu-guest-agent
+write_files:
+    - path: /etc/motd
+      content: |
+        hello
+      permissions: "0644"
+runcmd:
+    - systemctl enable --now qemu-guest-agent
+`, config)
+	assert.NoError(t, validateCloudConfig(config))
+}
+
+func TestCloudInitUserData_Multipart(t *testing.T) {
+	cloudInit := &CloudInitModel{
+		UserData:       types.StringValue("#!/bin/sh\necho hello\n"),
+		UserDataConfig: testUserDataConfig(),
+	}
+
+	userData, err := cloudInitUserData(context.Background(), cloudInit)
+	require.NoError(t, err)
+
+	message, err := mail.ReadMessage(strings.NewReader(userData))
+	require.NoError(t, err)
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	var contentTypes, mergeTypes, contents []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(part)
+		require.NoError(t, err)
+		contentTypes = append(contentTypes, part.Header.Get("Content-Type"))
+		mergeTypes = append(mergeTypes, part.Header.Get("Merge-Type"))
+		contents = append(contents, string(content))
+	}
+
+	assert.Equal(t, []string{`text/x-shellscript; charset="utf-8"`, `text/cloud-config; charset="utf-8"`}, contentTypes)
+	assert.Equal(t, []string{"", cloudConfigMergeType}, mergeTypes)
+	assert.Equal(t, "#!/bin/sh\necho hello\n", contents[0])
+	assert.True(t, strings.HasPrefix(contents[1], "#cloud-config\n"))
+}
+
+func TestCloudInitUserData_RawOnly(t *testing.T) {
+	userData, err := cloudInitUserData(context.Background(), &CloudInitModel{UserData: types.StringValue("#cloud-config\n")})
+
+	require.NoError(t, err)
+	assert.Equal(t, "#cloud-config\n", userData)
+}
+
+func TestValidateCloudConfig(t *testing.T) {
+	assert.NoError(t, validateCloudConfig("#cloud-config\npackages: [curl]\n"))
+	assert.NoError(t, validateCloudConfig("#cloud-config\n"))
+	assert.NoError(t, validateCloudConfig("#!/bin/sh\n: [\n"))
+	assert.Error(t, validateCloudConfig("#cloud-config\npackages: [curl\n"))
+	assert.Error(t, validateCloudConfig("#cloud-config\n- curl\n"))
+}
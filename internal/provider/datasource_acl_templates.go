@@ -0,0 +1,224 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+)
+
+var _ datasource.DataSource = &ACLTemplatesDataSource{}
+
+func NewACLTemplatesDataSource() datasource.DataSource {
+	return &ACLTemplatesDataSource{}
+}
+
+type ACLTemplatesDataSource struct {
+	client *truenas.Client
+}
+
+type ACLTemplatesDataSourceModel struct {
+	Path           types.String           `tfsdk:"path"`
+	Name           types.String           `tfsdk:"name"`
+	ACLType        types.String           `tfsdk:"acltype"`
+	Canonicalize   types.Bool             `tfsdk:"canonicalize"`
+	EnsureBuiltins types.Bool             `tfsdk:"ensure_builtins"`
+	ResolveNames   types.Bool             `tfsdk:"resolve_names"`
+	Templates      []ACLTemplateItemModel `tfsdk:"templates"`
+}
+
+type ACLTemplateItemModel struct {
+	ID      types.Int64     `tfsdk:"id"`
+	Name    types.String    `tfsdk:"name"`
+	ACLType types.String    `tfsdk:"acltype"`
+	Comment types.String    `tfsdk:"comment"`
+	Builtin types.Bool      `tfsdk:"builtin"`
+	Entries []ACLEntryModel `tfsdk:"entries"`
+}
+
+func (d *ACLTemplatesDataSource) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_acl_templates"
+}
+
+func (d *ACLTemplatesDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Fetches the ACL templates, optionally only those that apply to a path, with their entries formatted as the TrueNAS UI applies them",
+		Attributes: map[string]schema.Attribute{
+			"path": schema.StringAttribute{
+				MarkdownDescription: "Only return the templates of the ACL type of this path, e.g. `/mnt/tank/share`. No templates are returned when ACLs are disabled on the path.",
+				Optional:            true,
+				Validators: []validator.String{
+					stringvalidator.RegexMatches(filesystemPathPattern, "must be a path below /mnt"),
+				},
+			},
+			"name": schema.StringAttribute{
+				MarkdownDescription: "Only return the template with this name",
+				Optional:            true,
+			},
+			"acltype": schema.StringAttribute{
+				MarkdownDescription: "Only return the templates of this ACL type: `NFS4` or `POSIX1E`",
+				Optional:            true,
+				Validators: []validator.String{
+					stringvalidator.OneOf(truenas.ACLTypeNFS4, truenas.ACLTypePOSIX1E),
+				},
+			},
+			"canonicalize": schema.BoolAttribute{
+				MarkdownDescription: "Sort the entries of NFS4 templates into the order Windows expects. Cannot be used with the path of a POSIX1E dataset.",
+				Optional:            true,
+			},
+			"ensure_builtins": schema.BoolAttribute{
+				MarkdownDescription: "Add entries for the `builtin_users` and `builtin_administrators` groups to templates that have none",
+				Optional:            true,
+			},
+			"resolve_names": schema.BoolAttribute{
+				MarkdownDescription: "Set the `who` of `USER` and `GROUP` entries. Requires `path`.",
+				Optional:            true,
+			},
+			"templates": schema.ListNestedAttribute{
+				MarkdownDescription: "Matching templates, built-in ones included",
+				Computed:            true,
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"id": schema.Int64Attribute{
+							MarkdownDescription: "Template ID",
+							Computed:            true,
+						},
+						"name": schema.StringAttribute{
+							MarkdownDescription: "Template name",
+							Computed:            true,
+						},
+						"acltype": schema.StringAttribute{
+							MarkdownDescription: "ACL type of the template: NFS4 or POSIX1E",
+							Computed:            true,
+						},
+						"comment": schema.StringAttribute{
+							MarkdownDescription: "Description of the template",
+							Computed:            true,
+						},
+						"builtin": schema.BoolAttribute{
+							MarkdownDescription: "Whether TrueNAS ships the template, which cannot be changed or deleted",
+							Computed:            true,
+						},
+						"entries": schema.ListNestedAttribute{
+							MarkdownDescription: "Access control entries, in the same form as the `entries` of `truenas_filesystem_acl`",
+							Computed:            true,
+							NestedObject: schema.NestedAttributeObject{
+								Attributes: map[string]schema.Attribute{
+									"tag": schema.StringAttribute{
+										MarkdownDescription: "Who the entry applies to",
+										Computed:            true,
+									},
+									"id": schema.Int64Attribute{
+										MarkdownDescription: "UID or GID of a `USER` or `GROUP` entry",
+										Computed:            true,
+									},
+									"who": schema.StringAttribute{
+										MarkdownDescription: "Name of the user or group of a `USER` or `GROUP` entry, with `resolve_names`",
+										Computed:            true,
+									},
+									"type": schema.StringAttribute{
+										MarkdownDescription: "`ALLOW` or `DENY`, for NFS4 entries",
+										Computed:            true,
+									},
+									"basic_perms": schema.StringAttribute{
+										MarkdownDescription: "Basic permission set of an NFS4 entry, when its permissions form one",
+										Computed:            true,
+									},
+									"perms": schema.SetAttribute{
+										MarkdownDescription: "Advanced permissions of an NFS4 entry, or the permissions of a POSIX1E entry",
+										Computed:            true,
+										ElementType:         types.StringType,
+									},
+									"basic_flags": schema.StringAttribute{
+										MarkdownDescription: "Basic inheritance flags of an NFS4 entry, when its flags form one",
+										Computed:            true,
+									},
+									"flags": schema.SetAttribute{
+										MarkdownDescription: "Advanced inheritance flags of an NFS4 entry",
+										Computed:            true,
+										ElementType:         types.StringType,
+									},
+									"default": schema.BoolAttribute{
+										MarkdownDescription: "Whether a POSIX1E entry is a default entry",
+										Computed:            true,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (d *ACLTemplatesDataSource) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*truenas.Client)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected *truenas.Client, got: %T.", req.ProviderData),
+		)
+		return
+	}
+
+	d.client = client
+}
+
+func (d *ACLTemplatesDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data ACLTemplatesDataSourceModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	filters := []interface{}{}
+	if !data.Name.IsNull() {
+		filters = append(filters, []interface{}{"name", "=", data.Name.ValueString()})
+	}
+	if !data.ACLType.IsNull() {
+		filters = append(filters, []interface{}{"acltype", "=", data.ACLType.ValueString()})
+	}
+
+	templates, err := d.client.ListACLTemplatesByPath(ctx, data.Path.ValueString(), filters, truenas.ACLTemplateFormat{
+		Canonicalize:   data.Canonicalize.ValueBool(),
+		EnsureBuiltins: data.EnsureBuiltins.ValueBool(),
+		ResolveNames:   data.ResolveNames.ValueBool(),
+	})
+	if err != nil {
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to read ACL templates, got error: %s", err))
+		return
+	}
+
+	data.Templates = make([]ACLTemplateItemModel, 0, len(templates))
+	for _, template := range templates {
+		entries, diags := aclEntriesFromAPI(ctx, &truenas.ACL{ACLType: template.ACLType, Entries: template.Entries}, nil)
+		resp.Diagnostics.Append(diags...)
+		for i, entry := range template.Entries {
+			if entry.Who != nil {
+				entries[i].Who = types.StringValue(*entry.Who)
+			}
+		}
+
+		data.Templates = append(data.Templates, ACLTemplateItemModel{
+			ID:      types.Int64Value(template.ID),
+			Name:    types.StringValue(template.Name),
+			ACLType: types.StringValue(template.ACLType),
+			Comment: types.StringValue(template.Comment),
+			Builtin: types.BoolValue(template.Builtin),
+			Entries: entries,
+		})
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
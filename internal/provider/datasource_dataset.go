@@ -97,7 +97,7 @@ func (d *DatasetDataSource) Read(ctx context.Context, req datasource.ReadRequest
 	}
 
 	endpoint := fmt.Sprintf("/pool/dataset/id/%s", data.ID.ValueString())
-	respBody, err := d.client.Get(endpoint)
+	respBody, err := d.client.Get(ctx, endpoint)
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to read dataset, got error: %s", err))
 		return
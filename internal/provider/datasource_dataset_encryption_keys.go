@@ -0,0 +1,150 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+)
+
+var _ datasource.DataSource = &DatasetEncryptionKeysDataSource{}
+
+func NewDatasetEncryptionKeysDataSource() datasource.DataSource {
+	return &DatasetEncryptionKeysDataSource{}
+}
+
+type DatasetEncryptionKeysDataSource struct {
+	client *truenas.Client
+}
+
+type DatasetEncryptionKeysDataSourceModel struct {
+	ID                types.String `tfsdk:"id"`
+	DatasetID         types.String `tfsdk:"dataset_id"`
+	Recursive         types.Bool   `tfsdk:"recursive"`
+	ReplicationTaskID types.Int64  `tfsdk:"replication_task_id"`
+	Keys              types.Map    `tfsdk:"keys"`
+}
+
+func (d *DatasetEncryptionKeysDataSource) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_dataset_encryption_keys"
+}
+
+func (d *DatasetEncryptionKeysDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Exports the hex encryption keys TrueNAS stores for a dataset and its children, such as a whole pool, or for the source datasets of a replication task. Keys derived from a passphrase are not stored and cannot be exported.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				MarkdownDescription: "`dataset_id`, or `replication/<replication_task_id>`",
+				Computed:            true,
+			},
+			"dataset_id": schema.StringAttribute{
+				MarkdownDescription: "Encryption root or pool to export the keys of, e.g. `tank/secure` or `tank`. Exactly one of `dataset_id` and `replication_task_id` must be set.",
+				Optional:            true,
+				Validators: []validator.String{
+					stringvalidator.ExactlyOneOf(path.MatchRoot("replication_task_id")),
+				},
+			},
+			"recursive": schema.BoolAttribute{
+				MarkdownDescription: "Also export the keys of the encryption roots below `dataset_id`, with `/pool/dataset/export_keys`. When false, only the key of the encryption root `dataset_id` is exported, with `/pool/dataset/export_key`. Default: true",
+				Optional:            true,
+			},
+			"replication_task_id": schema.Int64Attribute{
+				MarkdownDescription: "ID of a replication task to export the keys of its source datasets, with `/pool/dataset/export_keys_for_replication`",
+				Optional:            true,
+			},
+			"keys": schema.MapAttribute{
+				MarkdownDescription: "Hex keys by dataset name",
+				Computed:            true,
+				Sensitive:           true,
+				ElementType:         types.StringType,
+			},
+		},
+	}
+}
+
+func (d *DatasetEncryptionKeysDataSource) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*truenas.Client)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected *truenas.Client, got: %T.", req.ProviderData),
+		)
+		return
+	}
+
+	d.client = client
+}
+
+func (d *DatasetEncryptionKeysDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data DatasetEncryptionKeysDataSourceModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	keys := map[string]string{}
+	switch {
+	case !data.ReplicationTaskID.IsNull():
+		taskID := data.ReplicationTaskID.ValueInt64()
+		respBody, err := d.client.ExportReplicationKeys(ctx, taskID)
+		if err != nil {
+			resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to export keys of replication task %d, got error: %s", taskID, err))
+			return
+		}
+		if err := json.Unmarshal(respBody, &keys); err != nil {
+			resp.Diagnostics.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
+			return
+		}
+		data.ID = types.StringValue("replication/" + strconv.FormatInt(taskID, 10))
+
+	case !data.Recursive.IsNull() && !data.Recursive.ValueBool():
+		id := data.DatasetID.ValueString()
+		respBody, err := d.client.ExportDatasetKey(ctx, id)
+		if err != nil {
+			resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to export key of dataset %s, got error: %s", id, err))
+			return
+		}
+		var key string
+		if err := json.Unmarshal(respBody, &key); err != nil {
+			resp.Diagnostics.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
+			return
+		}
+		keys[id] = key
+		data.ID = data.DatasetID
+
+	default:
+		id := data.DatasetID.ValueString()
+		respBody, err := d.client.ExportDatasetKeys(ctx, id)
+		if err != nil {
+			resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to export keys of dataset %s, got error: %s", id, err))
+			return
+		}
+		if err := json.Unmarshal(respBody, &keys); err != nil {
+			resp.Diagnostics.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
+			return
+		}
+		data.ID = data.DatasetID
+	}
+
+	keysValue, diags := types.MapValueFrom(ctx, types.StringType, keys)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	data.Keys = keysValue
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
@@ -0,0 +1,185 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+)
+
+var _ datasource.DataSource = &DatasetEncryptionSummaryDataSource{}
+
+func NewDatasetEncryptionSummaryDataSource() datasource.DataSource {
+	return &DatasetEncryptionSummaryDataSource{}
+}
+
+type DatasetEncryptionSummaryDataSource struct {
+	client *truenas.Client
+}
+
+type DatasetEncryptionSummaryDataSourceModel struct {
+	DatasetID  types.String                        `tfsdk:"dataset_id"`
+	Passphrase types.String                        `tfsdk:"passphrase"`
+	Key        types.String                        `tfsdk:"key"`
+	Datasets   []DatasetEncryptionSummaryItemModel `tfsdk:"datasets"`
+}
+
+type DatasetEncryptionSummaryItemModel struct {
+	Name                 types.String `tfsdk:"name"`
+	KeyFormat            types.String `tfsdk:"key_format"`
+	KeyPresentInDatabase types.Bool   `tfsdk:"key_present_in_database"`
+	ValidKey             types.Bool   `tfsdk:"valid_key"`
+	Locked               types.Bool   `tfsdk:"locked"`
+	UnlockError          types.String `tfsdk:"unlock_error"`
+	UnlockSuccessful     types.Bool   `tfsdk:"unlock_successful"`
+}
+
+func (d *DatasetEncryptionSummaryDataSource) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_dataset_encryption_summary"
+}
+
+func (d *DatasetEncryptionSummaryDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Fetches the encryption roots at or below a dataset, whether they are locked and whether a key can unlock them",
+		Attributes: map[string]schema.Attribute{
+			"dataset_id": schema.StringAttribute{
+				MarkdownDescription: "ID of the encrypted dataset, e.g. `tank/secure`",
+				Required:            true,
+			},
+			"passphrase": schema.StringAttribute{
+				MarkdownDescription: "Passphrase to check against the encryption root `dataset_id`",
+				Optional:            true,
+				Sensitive:           true,
+				Validators: []validator.String{
+					stringvalidator.ConflictsWith(path.MatchRoot("key")),
+				},
+			},
+			"key": schema.StringAttribute{
+				MarkdownDescription: "Hex key to check against the encryption root `dataset_id`. Without `passphrase` or `key`, the keys stored by TrueNAS are checked.",
+				Optional:            true,
+				Sensitive:           true,
+			},
+			"datasets": schema.ListNestedAttribute{
+				MarkdownDescription: "Encryption roots at or below the dataset",
+				Computed:            true,
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"name": schema.StringAttribute{
+							MarkdownDescription: "Name of the encryption root",
+							Computed:            true,
+						},
+						"key_format": schema.StringAttribute{
+							MarkdownDescription: "Format of the key: HEX or PASSPHRASE",
+							Computed:            true,
+						},
+						"key_present_in_database": schema.BoolAttribute{
+							MarkdownDescription: "Whether TrueNAS stores the key, so that the dataset is unlocked at boot",
+							Computed:            true,
+						},
+						"valid_key": schema.BoolAttribute{
+							MarkdownDescription: "Whether the given or stored key matches the dataset",
+							Computed:            true,
+						},
+						"locked": schema.BoolAttribute{
+							MarkdownDescription: "Whether the dataset is locked",
+							Computed:            true,
+						},
+						"unlock_error": schema.StringAttribute{
+							MarkdownDescription: "Why the dataset cannot be unlocked, null when it can",
+							Computed:            true,
+						},
+						"unlock_successful": schema.BoolAttribute{
+							MarkdownDescription: "Whether unlocking the dataset with the key would succeed",
+							Computed:            true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (d *DatasetEncryptionSummaryDataSource) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*truenas.Client)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected *truenas.Client, got: %T.", req.ProviderData),
+		)
+		return
+	}
+
+	d.client = client
+}
+
+func (d *DatasetEncryptionSummaryDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data DatasetEncryptionSummaryDataSourceModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	id := data.DatasetID.ValueString()
+	entry := map[string]interface{}{"name": id}
+	if !data.Passphrase.IsNull() {
+		entry["passphrase"] = data.Passphrase.ValueString()
+	}
+	if !data.Key.IsNull() {
+		entry["key"] = data.Key.ValueString()
+	}
+	datasets := []interface{}{}
+	if len(entry) > 1 {
+		datasets = append(datasets, entry)
+	}
+
+	respBody, err := d.client.GetDatasetEncryptionSummary(ctx, id, map[string]interface{}{"datasets": datasets})
+	if err != nil {
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to read encryption summary of dataset %s, got error: %s", id, err))
+		return
+	}
+
+	var summary []struct {
+		Name                 string  `json:"name"`
+		KeyFormat            string  `json:"key_format"`
+		KeyPresentInDatabase bool    `json:"key_present_in_database"`
+		ValidKey             bool    `json:"valid_key"`
+		Locked               bool    `json:"locked"`
+		UnlockError          *string `json:"unlock_error"`
+		UnlockSuccessful     bool    `json:"unlock_successful"`
+	}
+	if err := json.Unmarshal(respBody, &summary); err != nil {
+		resp.Diagnostics.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
+		return
+	}
+
+	data.Datasets = make([]DatasetEncryptionSummaryItemModel, 0, len(summary))
+	for _, item := range summary {
+		model := DatasetEncryptionSummaryItemModel{
+			Name:                 types.StringValue(item.Name),
+			KeyFormat:            types.StringValue(item.KeyFormat),
+			KeyPresentInDatabase: types.BoolValue(item.KeyPresentInDatabase),
+			ValidKey:             types.BoolValue(item.ValidKey),
+			Locked:               types.BoolValue(item.Locked),
+			UnlockError:          types.StringNull(),
+			UnlockSuccessful:     types.BoolValue(item.UnlockSuccessful),
+		}
+		if item.UnlockError != nil {
+			model.UnlockError = types.StringValue(*item.UnlockError)
+		}
+		data.Datasets = append(data.Datasets, model)
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
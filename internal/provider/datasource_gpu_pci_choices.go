@@ -68,7 +68,7 @@ func (d *GPUPCIChoicesDataSource) Read(ctx context.Context, req datasource.ReadR
 	var data GPUPCIChoicesDataSourceModel
 
 	endpoint := "/device/gpu_pci_ids_choices"
-	respBody, err := d.client.Get(endpoint)
+	respBody, err := d.client.Get(ctx, endpoint)
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to read GPU PCI choices, got error: %s", err))
 		return
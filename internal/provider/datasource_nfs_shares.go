@@ -132,7 +132,7 @@ func (d *NFSSharesDataSource) Read(ctx context.Context, req datasource.ReadReque
 	}
 
 	// Get all NFS shares
-	respBody, err := d.client.Get("/sharing/nfs")
+	respBody, err := d.client.Get(ctx, "/sharing/nfs")
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to read NFS shares, got error: %s", err))
 		return
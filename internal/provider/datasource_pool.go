@@ -104,7 +104,7 @@ func (d *PoolDataSource) Read(ctx context.Context, req datasource.ReadRequest, r
 	if _, errNum := strconv.Atoi(idStr); errNum == nil {
 		// Treat as numeric pool ID
 		endpoint := fmt.Sprintf("/pool/id/%s", idStr)
-		respBody, err := d.client.Get(endpoint)
+		respBody, err := d.client.Get(ctx, endpoint)
 		if err != nil {
 			resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to read pool by id, got error: %s", err))
 			return
@@ -115,7 +115,7 @@ func (d *PoolDataSource) Read(ctx context.Context, req datasource.ReadRequest, r
 		}
 	} else {
 		// Treat as pool name; list and select the matching pool
-		respBody, err := d.client.Get("/pool")
+		respBody, err := d.client.Get(ctx, "/pool")
 		if err != nil {
 			resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to list pools, got error: %s", err))
 			return
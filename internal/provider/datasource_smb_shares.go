@@ -135,7 +135,7 @@ func (d *SMBSharesDataSource) Read(ctx context.Context, req datasource.ReadReque
 	}
 
 	// Get all SMB shares
-	respBody, err := d.client.Get("/sharing/smb")
+	respBody, err := d.client.Get(ctx, "/sharing/smb")
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to read SMB shares, got error: %s", err))
 		return
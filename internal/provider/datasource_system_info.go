@@ -0,0 +1,186 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+)
+
+var _ datasource.DataSource = &SystemInfoDataSource{}
+
+func NewSystemInfoDataSource() datasource.DataSource {
+	return &SystemInfoDataSource{}
+}
+
+type SystemInfoDataSource struct {
+	client *truenas.Client
+}
+
+type SystemInfoDataSourceModel struct {
+	ID                 types.String  `tfsdk:"id"`
+	Version            types.String  `tfsdk:"version"`
+	VersionNumber      types.String  `tfsdk:"version_number"`
+	VersionMajor       types.Int64   `tfsdk:"version_major"`
+	VersionMinor       types.Int64   `tfsdk:"version_minor"`
+	VersionPatch       types.Int64   `tfsdk:"version_patch"`
+	Product            types.String  `tfsdk:"product"`
+	Supported          types.Bool    `tfsdk:"supported"`
+	Hostname           types.String  `tfsdk:"hostname"`
+	Model              types.String  `tfsdk:"model"`
+	Cores              types.Int64   `tfsdk:"cores"`
+	PhysicalCores      types.Int64   `tfsdk:"physical_cores"`
+	PhysMem            types.Int64   `tfsdk:"physmem"`
+	UptimeSeconds      types.Float64 `tfsdk:"uptime_seconds"`
+	SystemProduct      types.String  `tfsdk:"system_product"`
+	SystemManufacturer types.String  `tfsdk:"system_manufacturer"`
+	SystemSerial       types.String  `tfsdk:"system_serial"`
+	Timezone           types.String  `tfsdk:"timezone"`
+	ECCMemory          types.Bool    `tfsdk:"ecc_memory"`
+}
+
+func (d *SystemInfoDataSource) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_system_info"
+}
+
+func (d *SystemInfoDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Retrieves the TrueNAS version and system information from `/system/version` and `/system/info`.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				MarkdownDescription: "Data source identifier (always 'system_info')",
+				Computed:            true,
+			},
+			"version": schema.StringAttribute{
+				MarkdownDescription: "Full version string as reported by the server (e.g., TrueNAS-SCALE-24.04.2)",
+				Computed:            true,
+			},
+			"version_number": schema.StringAttribute{
+				MarkdownDescription: "Parsed release number (e.g., 24.04.2)",
+				Computed:            true,
+			},
+			"version_major": schema.Int64Attribute{
+				MarkdownDescription: "Major release number (e.g., 24)",
+				Computed:            true,
+			},
+			"version_minor": schema.Int64Attribute{
+				MarkdownDescription: "Minor release number (e.g., 4 for 24.04)",
+				Computed:            true,
+			},
+			"version_patch": schema.Int64Attribute{
+				MarkdownDescription: "Patch release number (e.g., 2 for 24.04.2)",
+				Computed:            true,
+			},
+			"product": schema.StringAttribute{
+				MarkdownDescription: "Product name from the version string (e.g., SCALE)",
+				Computed:            true,
+			},
+			"supported": schema.BoolAttribute{
+				MarkdownDescription: "Whether the release is one the provider supports",
+				Computed:            true,
+			},
+			"hostname": schema.StringAttribute{
+				MarkdownDescription: "System hostname",
+				Computed:            true,
+			},
+			"model": schema.StringAttribute{
+				MarkdownDescription: "CPU model",
+				Computed:            true,
+			},
+			"cores": schema.Int64Attribute{
+				MarkdownDescription: "Number of logical CPU cores",
+				Computed:            true,
+			},
+			"physical_cores": schema.Int64Attribute{
+				MarkdownDescription: "Number of physical CPU cores",
+				Computed:            true,
+			},
+			"physmem": schema.Int64Attribute{
+				MarkdownDescription: "Physical memory in bytes",
+				Computed:            true,
+			},
+			"uptime_seconds": schema.Float64Attribute{
+				MarkdownDescription: "System uptime in seconds",
+				Computed:            true,
+			},
+			"system_product": schema.StringAttribute{
+				MarkdownDescription: "Hardware product name",
+				Computed:            true,
+			},
+			"system_manufacturer": schema.StringAttribute{
+				MarkdownDescription: "Hardware manufacturer",
+				Computed:            true,
+			},
+			"system_serial": schema.StringAttribute{
+				MarkdownDescription: "Hardware serial number",
+				Computed:            true,
+			},
+			"timezone": schema.StringAttribute{
+				MarkdownDescription: "System timezone",
+				Computed:            true,
+			},
+			"ecc_memory": schema.BoolAttribute{
+				MarkdownDescription: "Whether the system has ECC memory",
+				Computed:            true,
+			},
+		},
+	}
+}
+
+func (d *SystemInfoDataSource) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*truenas.Client)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected *truenas.Client, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.client = client
+}
+
+func (d *SystemInfoDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data SystemInfoDataSourceModel
+
+	version, err := d.client.GetSystemVersion(ctx)
+	if err != nil {
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to read system version, got error: %s", err))
+		return
+	}
+
+	info, err := d.client.GetSystemInfo(ctx)
+	if err != nil {
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to read system info, got error: %s", err))
+		return
+	}
+
+	data.ID = types.StringValue("system_info")
+	data.Version = types.StringValue(version.Raw)
+	data.VersionNumber = types.StringValue(version.String())
+	data.VersionMajor = types.Int64Value(int64(version.Major))
+	data.VersionMinor = types.Int64Value(int64(version.Minor))
+	data.VersionPatch = types.Int64Value(int64(version.Patch))
+	data.Product = types.StringValue(version.Product)
+	data.Supported = types.BoolValue(truenas.SupportedVersions.Contains(version))
+	data.Hostname = types.StringValue(info.Hostname)
+	data.Model = types.StringValue(info.Model)
+	data.Cores = types.Int64Value(info.Cores)
+	data.PhysicalCores = types.Int64Value(info.PhysicalCores)
+	data.PhysMem = types.Int64Value(info.PhysMem)
+	data.UptimeSeconds = types.Float64Value(info.UptimeSeconds)
+	data.SystemProduct = types.StringValue(info.SystemProduct)
+	data.SystemManufacturer = types.StringValue(info.SystemManufacturer)
+	data.SystemSerial = types.StringValue(info.SystemSerial)
+	data.Timezone = types.StringValue(info.Timezone)
+	data.ECCMemory = types.BoolValue(info.ECCMemory)
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
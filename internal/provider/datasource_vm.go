@@ -143,7 +143,7 @@ func (d *VMDataSource) Read(ctx context.Context, req datasource.ReadRequest, res
 	// If ID is specified, query by ID
 	if !data.ID.IsNull() {
 		endpoint := fmt.Sprintf("/vm/id/%s", data.ID.ValueString())
-		respBody, err := d.client.Get(endpoint)
+		respBody, err := d.client.Get(ctx, endpoint)
 		if err != nil {
 			resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to read VM by ID, got error: %s", err))
 			return
@@ -154,7 +154,7 @@ func (d *VMDataSource) Read(ctx context.Context, req datasource.ReadRequest, res
 		}
 	} else {
 		// Query by name - list all VMs and find matching name
-		respBody, err := d.client.Get("/vm")
+		respBody, err := d.client.Get(ctx, "/vm")
 		if err != nil {
 			resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to list VMs, got error: %s", err))
 			return
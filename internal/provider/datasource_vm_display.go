@@ -0,0 +1,195 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+)
+
+var _ datasource.DataSource = &VMDisplayDataSource{}
+
+func NewVMDisplayDataSource() datasource.DataSource {
+	return &VMDisplayDataSource{}
+}
+
+type VMDisplayDataSource struct {
+	client *truenas.Client
+}
+
+type VMDisplayDataSourceModel struct {
+	VMID     types.String `tfsdk:"vm_id"`
+	Host     types.String `tfsdk:"host"`
+	Console  types.String `tfsdk:"console"`
+	Displays types.List   `tfsdk:"displays"`
+}
+
+// vmDisplayDataSourceAttrTypes are the attributes of the displays of the
+// truenas_vm_display data source
+var vmDisplayDataSourceAttrTypes = map[string]attr.Type{
+	"id":                types.Int64Type,
+	"type":              types.StringType,
+	"bind":              types.StringType,
+	"port":              types.Int64Type,
+	"web_port":          types.Int64Type,
+	"web":               types.BoolType,
+	"password":          types.StringType,
+	"web_uri":           types.StringType,
+	"remote_viewer_uri": types.StringType,
+}
+
+type VMDisplayDataSourceDisplayModel struct {
+	ID              types.Int64  `tfsdk:"id"`
+	Type            types.String `tfsdk:"type"`
+	Bind            types.String `tfsdk:"bind"`
+	Port            types.Int64  `tfsdk:"port"`
+	WebPort         types.Int64  `tfsdk:"web_port"`
+	Web             types.Bool   `tfsdk:"web"`
+	Password        types.String `tfsdk:"password"`
+	WebURI          types.String `tfsdk:"web_uri"`
+	RemoteViewerURI types.String `tfsdk:"remote_viewer_uri"`
+}
+
+func (d *VMDisplayDataSource) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_vm_display"
+}
+
+func (d *VMDisplayDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Fetches the SPICE/VNC display devices of a VM and the URIs to connect to them with a browser or remote-viewer",
+		Attributes: map[string]schema.Attribute{
+			"vm_id": schema.StringAttribute{
+				MarkdownDescription: "ID of the VM",
+				Required:            true,
+			},
+			"host": schema.StringAttribute{
+				MarkdownDescription: "Host name or address the URIs point to. Defaults to the host of the provider's `host` URL",
+				Optional:            true,
+			},
+			"console": schema.StringAttribute{
+				MarkdownDescription: "Name of the serial console of the VM, as used by `virsh console`",
+				Computed:            true,
+			},
+			"displays": schema.ListNestedAttribute{
+				MarkdownDescription: "Display devices of the VM",
+				Computed:            true,
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"id": schema.Int64Attribute{
+							MarkdownDescription: "ID of the display device",
+							Computed:            true,
+						},
+						"type": schema.StringAttribute{
+							MarkdownDescription: "Display type: SPICE or VNC",
+							Computed:            true,
+						},
+						"bind": schema.StringAttribute{
+							MarkdownDescription: "Address the display server listens on",
+							Computed:            true,
+						},
+						"port": schema.Int64Attribute{
+							MarkdownDescription: "Port of the display server",
+							Computed:            true,
+						},
+						"web_port": schema.Int64Attribute{
+							MarkdownDescription: "Port of the web client",
+							Computed:            true,
+						},
+						"web": schema.BoolAttribute{
+							MarkdownDescription: "Whether the web client is enabled",
+							Computed:            true,
+						},
+						"password": schema.StringAttribute{
+							MarkdownDescription: "Password of the display",
+							Computed:            true,
+							Sensitive:           true,
+						},
+						"web_uri": schema.StringAttribute{
+							MarkdownDescription: "URI of the web client, null when web access is disabled. It includes the display password",
+							Computed:            true,
+							Sensitive:           true,
+						},
+						"remote_viewer_uri": schema.StringAttribute{
+							MarkdownDescription: "URI to open with remote-viewer, e.g. `spice://nas.example.com:5900`",
+							Computed:            true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (d *VMDisplayDataSource) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*truenas.Client)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected *truenas.Client, got: %T.", req.ProviderData),
+		)
+		return
+	}
+
+	d.client = client
+}
+
+func (d *VMDisplayDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data VMDisplayDataSourceModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	vmID := data.VMID.ValueString()
+	displays, err := readVMDisplays(ctx, d.client, vmID, data.Host.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to read displays of VM %s, got error: %s", vmID, err))
+		return
+	}
+
+	respBody, err := d.client.GetVMConsole(ctx, vmID)
+	if err != nil {
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to read console of VM %s, got error: %s", vmID, err))
+		return
+	}
+	var console string
+	if err := json.Unmarshal(respBody, &console); err != nil {
+		resp.Diagnostics.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
+		return
+	}
+	data.Console = optionalString(console)
+
+	models := make([]VMDisplayDataSourceDisplayModel, 0, len(displays))
+	for _, display := range displays {
+		models = append(models, VMDisplayDataSourceDisplayModel{
+			ID:              types.Int64Value(display.device.ID),
+			Type:            deviceString(display.device, "type"),
+			Bind:            deviceString(display.device, "bind"),
+			Port:            deviceInt64(display.device, "port"),
+			WebPort:         deviceInt64(display.device, "web_port"),
+			Web:             deviceBool(display.device, "web"),
+			Password:        deviceString(display.device, "password"),
+			WebURI:          optionalString(display.webURI),
+			RemoteViewerURI: optionalString(display.remoteViewerURI),
+		})
+	}
+
+	list, diags := types.ListValueFrom(ctx, types.ObjectType{AttrTypes: vmDisplayDataSourceAttrTypes}, models)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	data.Displays = list
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
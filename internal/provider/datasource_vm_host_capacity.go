@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+)
+
+var _ datasource.DataSource = &VMHostCapacityDataSource{}
+
+func NewVMHostCapacityDataSource() datasource.DataSource {
+	return &VMHostCapacityDataSource{}
+}
+
+type VMHostCapacityDataSource struct {
+	client *truenas.Client
+}
+
+type VMHostCapacityDataSourceModel struct {
+	ID                      types.String `tfsdk:"id"`
+	AvailableMemory         types.Int64  `tfsdk:"available_memory"`
+	AvailableMemoryMB       types.Int64  `tfsdk:"available_memory_mb"`
+	MaximumSupportedVCPUs   types.Int64  `tfsdk:"maximum_supported_vcpus"`
+	VirtualizationSupported types.Bool   `tfsdk:"virtualization_supported"`
+	VirtualizationError     types.String `tfsdk:"virtualization_error"`
+	VMMemoryInUse           types.Int64  `tfsdk:"vm_memory_in_use"`
+	VMMemoryAutostart       types.Int64  `tfsdk:"vm_memory_autostart"`
+}
+
+func (d *VMHostCapacityDataSource) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_vm_host_capacity"
+}
+
+func (d *VMHostCapacityDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Fetches the memory, vCPUs and virtualization support the TrueNAS host offers to VMs",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				MarkdownDescription: "Identifier of the data source, always `vm_host_capacity`",
+				Computed:            true,
+			},
+			"available_memory": schema.Int64Attribute{
+				MarkdownDescription: "Memory in bytes available to start VMs",
+				Computed:            true,
+			},
+			"available_memory_mb": schema.Int64Attribute{
+				MarkdownDescription: "Memory in MiB available to start VMs, comparable to the `memory` of `truenas_vm`",
+				Computed:            true,
+			},
+			"maximum_supported_vcpus": schema.Int64Attribute{
+				MarkdownDescription: "Maximum number of vCPUs (vcpus × cores × threads) of a VM",
+				Computed:            true,
+			},
+			"virtualization_supported": schema.BoolAttribute{
+				MarkdownDescription: "Whether the host can run VMs",
+				Computed:            true,
+			},
+			"virtualization_error": schema.StringAttribute{
+				MarkdownDescription: "Why the host cannot run VMs, null when it can",
+				Computed:            true,
+			},
+			"vm_memory_in_use": schema.Int64Attribute{
+				MarkdownDescription: "Memory in bytes used by running VMs",
+				Computed:            true,
+			},
+			"vm_memory_autostart": schema.Int64Attribute{
+				MarkdownDescription: "Memory in bytes of stopped VMs that start when the host boots",
+				Computed:            true,
+			},
+		},
+	}
+}
+
+func (d *VMHostCapacityDataSource) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*truenas.Client)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected *truenas.Client, got: %T.", req.ProviderData),
+		)
+		return
+	}
+
+	d.client = client
+}
+
+func (d *VMHostCapacityDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data VMHostCapacityDataSourceModel
+
+	capacity, err := readVMHostCapacity(ctx, d.client)
+	if err != nil {
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to read VM host capacity, got error: %s", err))
+		return
+	}
+
+	respBody, err := d.client.GetVMMemoryInUse(ctx)
+	if err != nil {
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to read VM memory in use, got error: %s", err))
+		return
+	}
+	var inUse struct {
+		RNP  int64 `json:"RNP"`
+		PRD  int64 `json:"PRD"`
+		RPRD int64 `json:"RPRD"`
+	}
+	if err := json.Unmarshal(respBody, &inUse); err != nil {
+		resp.Diagnostics.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
+		return
+	}
+
+	data.ID = types.StringValue("vm_host_capacity")
+	data.AvailableMemory = types.Int64Value(capacity.availableMemory)
+	data.AvailableMemoryMB = types.Int64Value(capacity.availableMemory >> 20)
+	data.MaximumSupportedVCPUs = types.Int64Value(capacity.maxVCPUs)
+	data.VirtualizationSupported = types.BoolValue(capacity.virtualizationSupported)
+	data.VirtualizationError = optionalString(capacity.virtualizationError)
+	data.VMMemoryInUse = types.Int64Value(inUse.RNP + inUse.RPRD)
+	data.VMMemoryAutostart = types.Int64Value(inUse.PRD)
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
@@ -67,7 +67,7 @@ func (d *VMIOMMUEnabledDataSource) Read(ctx context.Context, req datasource.Read
 	var data VMIOMMUEnabledDataSourceModel
 
 	endpoint := "/vm/device/iommu_enabled"
-	respBody, err := d.client.Get(endpoint)
+	respBody, err := d.client.Get(ctx, endpoint)
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to check IOMMU status, got error: %s", err))
 		return
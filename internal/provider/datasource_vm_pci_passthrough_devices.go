@@ -108,7 +108,7 @@ func (d *VMPCIPassthroughDevicesDataSource) Read(ctx context.Context, req dataso
 	}
 
 	endpoint := "/vm/device/passthrough_device_choices"
-	respBody, err := d.client.Get(endpoint)
+	respBody, err := d.client.Get(ctx, endpoint)
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to read PCI passthrough devices, got error: %s", err))
 		return
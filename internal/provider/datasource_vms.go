@@ -121,7 +121,7 @@ func (d *VMsDataSource) Read(ctx context.Context, req datasource.ReadRequest, re
 	}
 
 	// Get all VMs
-	respBody, err := d.client.Get("/vm")
+	respBody, err := d.client.Get(ctx, "/vm")
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to read VMs, got error: %s", err))
 		return
@@ -0,0 +1,349 @@
+package provider
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Disk image formats
+const (
+	diskImageFormatRaw   = "raw"
+	diskImageFormatQCOW2 = "qcow2"
+)
+
+// qcow2Magic starts every qcow2 image
+var qcow2Magic = []byte{'Q', 'F', 'I', 0xfb}
+
+const (
+	// qcow2OffsetMask selects the host offset of an L1 or standard L2 entry
+	qcow2OffsetMask = 0x00fffffffffffe00
+	// qcow2CompressedFlag marks an L2 entry describing a compressed cluster
+	qcow2CompressedFlag = 1 << 62
+	// qcow2ZeroFlag marks a standard L2 entry whose cluster reads as zeros
+	qcow2ZeroFlag = 1
+	// qcow2MaxL1Size bounds the L1 table as qemu does, so that a corrupt
+	// header cannot make us allocate an arbitrary amount of memory
+	qcow2MaxL1Size = 32 << 20
+)
+
+// qcow2 incompatible feature bits
+const (
+	qcow2FeatureCorrupt          = 1 << 1
+	qcow2FeatureExternalDataFile = 1 << 2
+	qcow2FeatureCompressionType  = 1 << 3
+	qcow2FeatureExtendedL2       = 1 << 4
+)
+
+// diskImage is a local image file, read as the raw content of the disk it
+// holds
+type diskImage struct {
+	// Format is the format of the file, raw or qcow2
+	Format string
+	// VirtualSize is the size of the disk, the number of bytes Reader returns
+	VirtualSize int64
+
+	file   *os.File
+	reader io.Reader
+}
+
+// openDiskImage opens an image file in the given format, or in the format
+// detected from its content when format is empty. qcow2 images are converted
+// to raw as they are read, so the image is never held in memory.
+func openDiskImage(path, format string) (*diskImage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := newDiskImage(file, format)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	image.file = file
+	return image, nil
+}
+
+func newDiskImage(file *os.File, format string) (*diskImage, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Size() == 0 {
+		return nil, fmt.Errorf("the image is empty")
+	}
+	if format == "" {
+		if format, err = detectDiskImageFormat(file); err != nil {
+			return nil, err
+		}
+	}
+
+	switch format {
+	case diskImageFormatRaw:
+		return &diskImage{
+			Format:      format,
+			VirtualSize: info.Size(),
+			reader:      io.NewSectionReader(file, 0, info.Size()),
+		}, nil
+	case diskImageFormatQCOW2:
+		reader, err := newQCOW2Reader(file)
+		if err != nil {
+			return nil, err
+		}
+		if reader.size == 0 {
+			return nil, fmt.Errorf("the image holds an empty disk")
+		}
+		return &diskImage{
+			Format:      format,
+			VirtualSize: reader.size,
+			reader:      reader,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported image format %q", format)
+	}
+}
+
+// Read reads the raw content of the disk
+func (i *diskImage) Read(p []byte) (int, error) {
+	return i.reader.Read(p)
+}
+
+// Close closes the image file
+func (i *diskImage) Close() error {
+	return i.file.Close()
+}
+
+// detectDiskImageFormat returns qcow2 for files starting with the qcow2
+// magic, and raw for any other file
+func detectDiskImageFormat(r io.ReaderAt) (string, error) {
+	magic := make([]byte, len(qcow2Magic))
+	if _, err := readFullAt(r, magic, 0); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return diskImageFormatRaw, nil
+		}
+		return "", err
+	}
+	if bytes.Equal(magic, qcow2Magic) {
+		return diskImageFormatQCOW2, nil
+	}
+	return diskImageFormatRaw, nil
+}
+
+// qcow2Reader reads the disk held by a qcow2 image from start to end, one
+// cluster at a time. Unallocated and zero clusters read as zeros.
+type qcow2Reader struct {
+	file        io.ReaderAt
+	clusterBits uint
+	clusterSize int64
+	size        int64
+	l1          []uint64
+
+	// l2 is the L2 table of the L1 entry l2Index, or nil
+	l2      []uint64
+	l2Index int64
+
+	// cluster holds the current cluster, of which buf is the unread part
+	cluster []byte
+	buf     []byte
+	// offset is the guest offset of the next cluster
+	offset int64
+}
+
+// newQCOW2Reader parses the header and L1 table of a qcow2 image. Images
+// that are encrypted, use a backing file or an external data file, or use
+// compression other than deflate are not supported.
+func newQCOW2Reader(file io.ReaderAt) (*qcow2Reader, error) {
+	header := make([]byte, 104)
+	if _, err := readFullAt(file, header[:72], 0); err != nil {
+		return nil, fmt.Errorf("reading qcow2 header: %w", err)
+	}
+	if !bytes.Equal(header[:4], qcow2Magic) {
+		return nil, fmt.Errorf("not a qcow2 image")
+	}
+
+	be := binary.BigEndian
+	version := be.Uint32(header[4:])
+	if version != 2 && version != 3 {
+		return nil, fmt.Errorf("unsupported qcow2 version %d", version)
+	}
+	if be.Uint64(header[8:]) != 0 {
+		return nil, fmt.Errorf("qcow2 images with a backing file are not supported, convert the image to a standalone image first")
+	}
+	clusterBits := be.Uint32(header[20:])
+	if clusterBits < 9 || clusterBits > 21 {
+		return nil, fmt.Errorf("invalid qcow2 cluster size 2^%d", clusterBits)
+	}
+	size := be.Uint64(header[24:])
+	if size > 1<<62 {
+		return nil, fmt.Errorf("invalid qcow2 virtual size %d", size)
+	}
+	if be.Uint32(header[32:]) != 0 {
+		return nil, fmt.Errorf("encrypted qcow2 images are not supported")
+	}
+	l1Size := be.Uint32(header[36:])
+	l1Offset := be.Uint64(header[40:])
+
+	if version == 3 {
+		if _, err := readFullAt(file, header[72:], 72); err != nil {
+			return nil, fmt.Errorf("reading qcow2 header: %w", err)
+		}
+		features := be.Uint64(header[72:])
+		switch {
+		case features&qcow2FeatureCorrupt != 0:
+			return nil, fmt.Errorf("the qcow2 image is marked corrupt")
+		case features&qcow2FeatureExternalDataFile != 0:
+			return nil, fmt.Errorf("qcow2 images with an external data file are not supported")
+		case features&qcow2FeatureExtendedL2 != 0:
+			return nil, fmt.Errorf("qcow2 images with extended L2 entries are not supported")
+		case features&qcow2FeatureCompressionType != 0:
+			// Only deflate is supported, which is compression type 0
+			compression := make([]byte, 1)
+			if _, err := readFullAt(file, compression, 104); err != nil {
+				return nil, fmt.Errorf("reading qcow2 compression type: %w", err)
+			}
+			if compression[0] != 0 {
+				return nil, fmt.Errorf("qcow2 compression type %d is not supported, only deflate", compression[0])
+			}
+		}
+	}
+
+	q := &qcow2Reader{
+		file:        file,
+		clusterBits: uint(clusterBits),
+		clusterSize: int64(1) << clusterBits,
+		size:        int64(size),
+		l2Index:     -1,
+	}
+	q.cluster = make([]byte, q.clusterSize)
+
+	l2Entries := q.clusterSize / 8
+	if needed := (q.size + q.clusterSize*l2Entries - 1) / (q.clusterSize * l2Entries); int64(l1Size) < needed {
+		return nil, fmt.Errorf("qcow2 L1 table has %d entries, %d are needed for the virtual size", l1Size, needed)
+	}
+	if int64(l1Size)*8 > qcow2MaxL1Size {
+		return nil, fmt.Errorf("qcow2 L1 table of %d entries is too large", l1Size)
+	}
+	table := make([]byte, int(l1Size)*8)
+	if _, err := readFullAt(file, table, int64(l1Offset)); err != nil {
+		return nil, fmt.Errorf("reading qcow2 L1 table: %w", err)
+	}
+	q.l1 = make([]uint64, l1Size)
+	for i := range q.l1 {
+		q.l1[i] = be.Uint64(table[i*8:])
+	}
+
+	return q, nil
+}
+
+func (q *qcow2Reader) Read(p []byte) (int, error) {
+	if len(q.buf) == 0 {
+		if q.offset >= q.size {
+			return 0, io.EOF
+		}
+		if err := q.readCluster(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, q.buf)
+	q.buf = q.buf[n:]
+	return n, nil
+}
+
+// readCluster reads the cluster at offset into buf. The last cluster is cut
+// short at the virtual size.
+func (q *qcow2Reader) readCluster() error {
+	index := q.offset >> q.clusterBits
+	length := min(q.clusterSize, q.size-q.offset)
+	cluster := q.cluster[:length]
+
+	entry, err := q.l2Entry(index)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case entry&qcow2CompressedFlag != 0:
+		if err := q.readCompressed(entry, cluster); err != nil {
+			return fmt.Errorf("reading qcow2 cluster at %d: %w", q.offset, err)
+		}
+	case entry&qcow2ZeroFlag != 0 || entry&qcow2OffsetMask == 0:
+		clear(cluster)
+	default:
+		if _, err := readFullAt(q.file, cluster, int64(entry&qcow2OffsetMask)); err != nil {
+			return fmt.Errorf("reading qcow2 cluster at %d: %w", q.offset, err)
+		}
+	}
+
+	q.buf = cluster
+	q.offset += length
+	return nil
+}
+
+// l2Entry returns the L2 entry of a guest cluster, loading its L2 table
+// when needed. Clusters without an L2 table have a zero entry.
+func (q *qcow2Reader) l2Entry(index int64) (uint64, error) {
+	l2Entries := q.clusterSize / 8
+	l1Index := index / l2Entries
+
+	if l1Index != q.l2Index {
+		q.l2Index = l1Index
+		q.l2 = nil
+
+		offset := int64(q.l1[l1Index] & qcow2OffsetMask)
+		if offset != 0 {
+			table := make([]byte, q.clusterSize)
+			if _, err := readFullAt(q.file, table, offset); err != nil {
+				return 0, fmt.Errorf("reading qcow2 L2 table at %d: %w", offset, err)
+			}
+			q.l2 = make([]uint64, l2Entries)
+			for i := range q.l2 {
+				q.l2[i] = binary.BigEndian.Uint64(table[i*8:])
+			}
+		}
+	}
+
+	if q.l2 == nil {
+		return 0, nil
+	}
+	return q.l2[index%l2Entries], nil
+}
+
+// readCompressed inflates a compressed cluster. Its descriptor holds the
+// host offset and the number of 512-byte sectors the data spans, the first
+// of which may be shared with the previous cluster.
+func (q *qcow2Reader) readCompressed(entry uint64, cluster []byte) error {
+	offsetBits := 62 - (q.clusterBits - 8)
+	offset := int64(entry & (1<<offsetBits - 1))
+	sectors := int64((entry>>offsetBits)&(1<<(q.clusterBits-8)-1)) + 1
+	data := make([]byte, sectors*512-offset%512)
+
+	// The last compressed cluster may end before its last sector
+	n, err := q.file.ReadAt(data, offset)
+	if err != nil && !(errors.Is(err, io.EOF) && n > 0) {
+		return err
+	}
+
+	inflater := flate.NewReader(bytes.NewReader(data[:n]))
+	defer inflater.Close()
+	_, err = io.ReadFull(inflater, cluster)
+	return err
+}
+
+// readFullAt reads exactly len(buf) bytes at off, like io.ReadFull
+func readFullAt(r io.ReaderAt, buf []byte, off int64) (int, error) {
+	n, err := r.ReadAt(buf, off)
+	if n == len(buf) {
+		return n, nil
+	}
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
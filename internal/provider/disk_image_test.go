@@ -0,0 +1,207 @@
+package provider
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testQCOW2Cluster is a guest cluster of an image written by buildQCOW2
+type testQCOW2Cluster struct {
+	data       []byte
+	compressed bool
+	zero       bool
+}
+
+// buildQCOW2 writes a version 3 qcow2 image holding the given guest
+// clusters. It returns the image and the raw disk it holds.
+func buildQCOW2(t *testing.T, clusterBits uint, size int64, clusters map[int64]testQCOW2Cluster) ([]byte, []byte) {
+	t.Helper()
+
+	be := binary.BigEndian
+	clusterSize := int64(1) << clusterBits
+	l2Entries := clusterSize / 8
+	l1Size := (size + clusterSize*l2Entries - 1) / (clusterSize * l2Entries)
+	require.LessOrEqual(t, l1Size*8, clusterSize, "the L1 table must fit in a cluster")
+
+	// The header is in the first cluster and the L1 table in the second
+	image := make([]byte, 2*clusterSize)
+	copy(image, qcow2Magic)
+	be.PutUint32(image[4:], 3)
+	be.PutUint32(image[20:], uint32(clusterBits))
+	be.PutUint64(image[24:], uint64(size))
+	be.PutUint32(image[36:], uint32(l1Size))
+	be.PutUint64(image[40:], uint64(clusterSize))
+	be.PutUint32(image[96:], 4)
+	be.PutUint32(image[100:], 104)
+
+	allocate := func(n int64) int64 {
+		offset := int64(len(image))
+		image = append(image, make([]byte, n)...)
+		return offset
+	}
+	allocateCluster := func() int64 {
+		if pad := int64(len(image)) % clusterSize; pad != 0 {
+			allocate(clusterSize - pad)
+		}
+		return allocate(clusterSize)
+	}
+
+	raw := make([]byte, size)
+	indexes := make([]int64, 0, len(clusters))
+	for index := range clusters {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	l2Offsets := map[int64]int64{}
+	for _, index := range indexes {
+		cluster := clusters[index]
+		l1Index := index / l2Entries
+		if _, ok := l2Offsets[l1Index]; !ok {
+			l2Offsets[l1Index] = allocateCluster()
+			// Set the copied flag, which readers must ignore
+			be.PutUint64(image[clusterSize+l1Index*8:], uint64(l2Offsets[l1Index])|1<<63)
+		}
+
+		data := make([]byte, clusterSize)
+		copy(data, cluster.data)
+
+		var entry uint64
+		switch {
+		case cluster.zero:
+			entry = qcow2ZeroFlag
+		case cluster.compressed:
+			compressed := &bytes.Buffer{}
+			w, err := flate.NewWriter(compressed, flate.BestCompression)
+			require.NoError(t, err)
+			_, err = w.Write(data)
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+
+			// Compressed clusters are packed at any byte offset
+			allocate(100)
+			offset := allocate(int64(compressed.Len()))
+			copy(image[offset:], compressed.Bytes())
+			offsetBits := 62 - (clusterBits - 8)
+			sectors := (offset%512 + int64(compressed.Len()) - 1) / 512
+			entry = qcow2CompressedFlag | uint64(sectors)<<offsetBits | uint64(offset)
+		default:
+			offset := allocateCluster()
+			copy(image[offset:], data)
+			entry = uint64(offset) | 1<<63
+		}
+		be.PutUint64(image[l2Offsets[l1Index]+(index%l2Entries)*8:], entry)
+
+		if !cluster.zero {
+			copy(raw[index*clusterSize:], data[:min(clusterSize, size-index*clusterSize)])
+		}
+	}
+
+	return image, raw
+}
+
+// writeTestFile writes content to a file in a temporary directory
+func writeTestFile(t *testing.T, name string, content []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+	return path
+}
+
+func TestOpenDiskImage_QCOW2(t *testing.T) {
+	const clusterBits = 10
+	// Two L2 tables, with the last cluster cut short by the virtual size
+	size := int64(129*1024 + 512)
+	qcow2, raw := buildQCOW2(t, clusterBits, size, map[int64]testQCOW2Cluster{
+		0:   {data: bytes.Repeat([]byte("boot"), 256)},
+		3:   {data: bytes.Repeat([]byte("compressed"), 100), compressed: true},
+		4:   {data: bytes.Repeat([]byte{0x5a}, 1024), compressed: true},
+		5:   {zero: true},
+		128: {data: bytes.Repeat([]byte("second table"), 80)},
+		129: {data: bytes.Repeat([]byte("tail"), 256)},
+	})
+
+	image, err := openDiskImage(writeTestFile(t, "disk.qcow2", qcow2), "")
+	require.NoError(t, err)
+	defer image.Close()
+
+	assert.Equal(t, diskImageFormatQCOW2, image.Format)
+	assert.Equal(t, size, image.VirtualSize)
+
+	content, err := io.ReadAll(image)
+	require.NoError(t, err)
+	require.Len(t, content, int(size))
+	assert.True(t, bytes.Equal(raw, content), "converted image differs from the disk it holds")
+	assert.Equal(t, []byte("tail"), content[129*1024:129*1024+4])
+}
+
+func TestOpenDiskImage_Raw(t *testing.T) {
+	content := bytes.Repeat([]byte("raw disk"), 1000)
+
+	image, err := openDiskImage(writeTestFile(t, "disk.img", content), "")
+	require.NoError(t, err)
+	defer image.Close()
+
+	assert.Equal(t, diskImageFormatRaw, image.Format)
+	assert.Equal(t, int64(len(content)), image.VirtualSize)
+
+	read, err := io.ReadAll(image)
+	require.NoError(t, err)
+	assert.Equal(t, content, read)
+}
+
+func TestOpenDiskImage_RawFormatCopiesQCOW2(t *testing.T) {
+	qcow2, _ := buildQCOW2(t, 9, 4096, nil)
+
+	image, err := openDiskImage(writeTestFile(t, "disk.qcow2", qcow2), diskImageFormatRaw)
+	require.NoError(t, err)
+	defer image.Close()
+
+	read, err := io.ReadAll(image)
+	require.NoError(t, err)
+	assert.Equal(t, qcow2, read)
+}
+
+func TestOpenDiskImage_UnsupportedQCOW2(t *testing.T) {
+	tests := map[string]struct {
+		offset int
+		value  uint64
+		width  int
+		want   string
+	}{
+		"version":       {offset: 4, value: 1, width: 4, want: "unsupported qcow2 version 1"},
+		"backing file":  {offset: 8, value: 4096, width: 8, want: "backing file"},
+		"encryption":    {offset: 32, value: 1, width: 4, want: "encrypted"},
+		"corrupt":       {offset: 72, value: qcow2FeatureCorrupt, width: 8, want: "marked corrupt"},
+		"external data": {offset: 72, value: qcow2FeatureExternalDataFile, width: 8, want: "external data file"},
+		"zstd":          {offset: 72, value: qcow2FeatureCompressionType, width: 8, want: "compression type 1"},
+		"small L1":      {offset: 36, value: 0, width: 4, want: "L1 table has 0 entries"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			qcow2, _ := buildQCOW2(t, 9, 4096, nil)
+			if tt.width == 4 {
+				binary.BigEndian.PutUint32(qcow2[tt.offset:], uint32(tt.value))
+			} else {
+				binary.BigEndian.PutUint64(qcow2[tt.offset:], tt.value)
+			}
+			// The compression type follows the version 3 header
+			qcow2[104] = 1
+
+			_, err := openDiskImage(writeTestFile(t, "disk.qcow2", qcow2), "")
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
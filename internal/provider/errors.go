@@ -0,0 +1,97 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+)
+
+// addClientError reports an API error for the given action, e.g. "create
+// dataset". Field-level validation messages are reported on the attribute
+// they refer to: fields is consulted first (keyed by the API field path
+// without its schema prefix, e.g. "ro" or "attributes"), then any top-level
+// attribute of model whose tfsdk tag matches the field name. Messages that
+// cannot be mapped are reported as a single general error.
+func addClientError(diags *diag.Diagnostics, action string, err error, model interface{}, fields map[string]path.Path) {
+	var apiErr *truenas.APIError
+	if !errors.As(err, &apiErr) || len(apiErr.Fields) == 0 {
+		diags.AddError("Client Error", fmt.Sprintf("Unable to %s, got error: %s", action, err))
+		return
+	}
+
+	var unmapped []string
+	for _, field := range apiErr.Fields {
+		attr, ok := apiFieldPath(field.Attribute(), model, fields)
+		if !ok {
+			unmapped = append(unmapped, fmt.Sprintf("%s: %s", field.Field, field.Message))
+			continue
+		}
+		diags.AddAttributeError(
+			attr,
+			"Invalid Attribute Value",
+			fmt.Sprintf("Unable to %s: %s", action, field.Message),
+		)
+	}
+
+	if len(unmapped) > 0 {
+		diags.AddError("Client Error", fmt.Sprintf("Unable to %s, got error: %s", action, strings.Join(unmapped, "; ")))
+	}
+}
+
+// apiFieldPath maps a middleware field path such as "quota" or
+// "attributes.path" to a schema attribute path
+func apiFieldPath(field string, model interface{}, fields map[string]path.Path) (path.Path, bool) {
+	segments := strings.Split(field, ".")
+
+	// Longest prefix match against the explicit mapping; any remaining
+	// segments descend into the mapped attribute
+	for i := len(segments); i > 0; i-- {
+		attr, ok := fields[strings.Join(segments[:i], ".")]
+		if !ok {
+			continue
+		}
+		for _, segment := range segments[i:] {
+			if index, err := strconv.Atoi(segment); err == nil {
+				attr = attr.AtListIndex(index)
+			} else {
+				attr = attr.AtName(segment)
+			}
+		}
+		return attr, true
+	}
+
+	if modelHasAttribute(model, segments[0]) {
+		return path.Root(segments[0]), true
+	}
+
+	return path.Empty(), false
+}
+
+// modelHasAttribute reports whether the model struct has a field tagged
+// with the given tfsdk attribute name
+func modelHasAttribute(model interface{}, name string) bool {
+	if model == nil {
+		return false
+	}
+
+	t := reflect.TypeOf(model)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("tfsdk") == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+)
+
+// TestAddClientError_FieldsMapToAttributes tests that validation messages land on the matching attributes
+func TestAddClientError_FieldsMapToAttributes(t *testing.T) {
+	err := &truenas.APIError{
+		StatusCode: http.StatusUnprocessableEntity,
+		Class:      truenas.ErrorClassValidation,
+		Fields: []truenas.FieldError{
+			{Field: "sharingnfs_create.path", Message: "Path does not exist"},
+			{Field: "sharingnfs_create.ro", Message: "Invalid value"},
+			{Field: "sharingnfs_create.aliases", Message: "Not supported"},
+		},
+	}
+
+	var diags diag.Diagnostics
+	addClientError(&diags, "create NFS share", err, &NFSShareResourceModel{}, nfsShareAPIFields)
+
+	require.Len(t, diags, 3)
+
+	pathDiag, ok := diags[0].(diag.DiagnosticWithPath)
+	require.True(t, ok)
+	assert.Equal(t, path.Root("path"), pathDiag.Path())
+	assert.Equal(t, "Unable to create NFS share: Path does not exist", diags[0].Detail())
+
+	roDiag, ok := diags[1].(diag.DiagnosticWithPath)
+	require.True(t, ok)
+	assert.Equal(t, path.Root("readonly"), roDiag.Path())
+
+	_, ok = diags[2].(diag.DiagnosticWithPath)
+	assert.False(t, ok)
+	assert.Equal(t, "Client Error", diags[2].Summary())
+	assert.Contains(t, diags[2].Detail(), "sharingnfs_create.aliases: Not supported")
+}
+
+// TestAddClientError_NestedFields tests that nested field paths descend into the mapped attribute
+func TestAddClientError_NestedFields(t *testing.T) {
+	err := &truenas.APIError{
+		StatusCode: http.StatusUnprocessableEntity,
+		Class:      truenas.ErrorClassValidation,
+		Fields: []truenas.FieldError{
+			{Field: "vm_device_create.attributes.path", Message: "Disk path must start with /dev/zvol/"},
+		},
+	}
+
+	var diags diag.Diagnostics
+	addClientError(&diags, "create VM device", err, &VMDeviceResourceModel{}, vmDeviceAPIFields("DISK"))
+
+	require.Len(t, diags, 1)
+	pathDiag, ok := diags[0].(diag.DiagnosticWithPath)
+	require.True(t, ok)
+	assert.Equal(t, path.Root("disk_config").AtListIndex(0).AtName("path"), pathDiag.Path())
+}
+
+// TestAddClientError_NonValidation tests that other errors keep the general error format
+func TestAddClientError_NonValidation(t *testing.T) {
+	var diags diag.Diagnostics
+	addClientError(&diags, "create group", errors.New("connection refused"), &GroupResourceModel{}, nil)
+
+	require.Len(t, diags, 1)
+	assert.Equal(t, "Client Error", diags[0].Summary())
+	assert.Equal(t, "Unable to create group, got error: connection refused", diags[0].Detail())
+}
@@ -2,36 +2,116 @@ package provider
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"strings"
 
 	"github.com/kdomanski/iso9660"
 )
 
+// Seed image formats
+const (
+	// seedFormatNoCloud is the cloud-init NoCloud cidata ISO
+	seedFormatNoCloud = "nocloud"
+	// seedFormatTalos is the Talos metal-iso config ISO, read when the
+	// kernel is booted with talos.config=metal-iso
+	seedFormatTalos = "talos"
+	// seedFormatIgnition is an OpenStack config drive, read by Ignition on
+	// Flatcar and Fedora CoreOS
+	seedFormatIgnition = "ignition"
+)
+
+// SeedData is the content of a seed image. Only the NoCloud format uses
+// more than UserData.
+type SeedData struct {
+	UserData      string
+	MetaData      string
+	NetworkConfig string
+	VendorData    string
+}
+
+// seedFile is a file of a seed image
+type seedFile struct {
+	path    string
+	content string
+}
+
+// GenerateSeedISO creates a seed image in the given format:
+//   - nocloud: user-data, meta-data, network-config and vendor-data on a
+//     volume labelled cidata
+//   - talos: the machine configuration as config.yaml on a volume labelled
+//     metal-iso
+//   - ignition: the Ignition config as openstack/latest/user_data on a
+//     volume labelled config-2
+func GenerateSeedISO(format string, seed SeedData) ([]byte, error) {
+	switch format {
+	case seedFormatNoCloud, "":
+		files := []seedFile{
+			{"user-data", seed.UserData},
+			{"meta-data", seed.MetaData},
+		}
+		if seed.NetworkConfig != "" {
+			files = append(files, seedFile{"network-config", seed.NetworkConfig})
+		}
+		if seed.VendorData != "" {
+			files = append(files, seedFile{"vendor-data", seed.VendorData})
+		}
+		return writeSeedISO("cidata", files)
+	case seedFormatTalos:
+		return writeSeedISO("metal-iso", []seedFile{{"config.yaml", seed.UserData}})
+	case seedFormatIgnition:
+		return writeSeedISO("config-2", []seedFile{{"openstack/latest/user_data", seed.UserData}})
+	default:
+		return nil, fmt.Errorf("unsupported seed format %q", format)
+	}
+}
+
+// seedContentHash returns the SHA-256 hash of the content of a seed image.
+// Unlike a hash of the image itself, it does not depend on the time the
+// image was written.
+func seedContentHash(format string, seed SeedData) string {
+	if format == "" {
+		format = seedFormatNoCloud
+	}
+	hash := sha256.New()
+	for _, part := range []string{format, seed.UserData, seed.MetaData, seed.NetworkConfig, seed.VendorData} {
+		fmt.Fprintf(hash, "%d:%s", len(part), part)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
 // GenerateCloudInitISO creates an ISO image containing user-data and meta-data files
-// for Cloud-Init NoCloud datasource.
-func GenerateCloudInitISO(userData, metaData string) ([]byte, error) {
+// for Cloud-Init NoCloud datasource. network-config and vendor-data are only
+// added when they are not empty.
+func GenerateCloudInitISO(userData, metaData, networkConfig, vendorData string) ([]byte, error) {
+	return GenerateSeedISO(seedFormatNoCloud, SeedData{
+		UserData:      userData,
+		MetaData:      metaData,
+		NetworkConfig: networkConfig,
+		VendorData:    vendorData,
+	})
+}
+
+// writeSeedISO writes files to an ISO image with the given volume label
+func writeSeedISO(label string, files []seedFile) ([]byte, error) {
 	writer, err := iso9660.NewWriter()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create ISO writer: %w", err)
 	}
 	defer writer.Cleanup()
 
-	// Add user-data
-	if err := writer.AddFile(strings.NewReader(userData), "user-data"); err != nil {
-		return nil, fmt.Errorf("failed to add user-data to ISO: %w", err)
-	}
-
-	// Add meta-data
-	if err := writer.AddFile(strings.NewReader(metaData), "meta-data"); err != nil {
-		return nil, fmt.Errorf("failed to add meta-data to ISO: %w", err)
+	for _, file := range files {
+		if err := writer.AddFile(strings.NewReader(file.content), file.path); err != nil {
+			return nil, fmt.Errorf("failed to add %s to ISO: %w", file.path, err)
+		}
 	}
 
-	// Write to buffer with volume label "cidata"
+	// Write to buffer with the volume label the guest looks for
 	output := &bytes.Buffer{}
-	if err := writer.WriteTo(output, "cidata"); err != nil {
+	if err := writer.WriteTo(output, label); err != nil {
 		return nil, fmt.Errorf("failed to write ISO to buffer: %w", err)
 	}
 
 	return output.Bytes(), nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,105 @@
+package provider
+
+import (
+	"bytes"
+	"io"
+	"path"
+	"testing"
+
+	"github.com/kdomanski/iso9660"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateCloudInitISO_OptionalFiles(t *testing.T) {
+	iso, err := GenerateCloudInitISO("#cloud-config\n", "instance-id: web\n", "version: 2\n", "")
+	require.NoError(t, err)
+
+	assert.Equal(t, "cidata", testISOLabel(t, iso))
+	files := testISOFiles(t, iso)
+	assert.Equal(t, "#cloud-config\n", files["user-data"])
+	assert.Equal(t, "instance-id: web\n", files["meta-data"])
+	assert.Equal(t, "version: 2\n", files["network-config"])
+	assert.NotContains(t, files, "vendor-data")
+}
+
+func TestGenerateSeedISO_Talos(t *testing.T) {
+	iso, err := GenerateSeedISO(seedFormatTalos, SeedData{UserData: "version: v1alpha1\nmachine:\n  type: worker\n"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "metal-iso", testISOLabel(t, iso))
+	assert.Equal(t, map[string]string{"config.yaml": "version: v1alpha1\nmachine:\n  type: worker\n"}, testISOFiles(t, iso))
+}
+
+func TestGenerateSeedISO_Ignition(t *testing.T) {
+	iso, err := GenerateSeedISO(seedFormatIgnition, SeedData{UserData: `{"ignition":{"version":"3.4.0"}}`})
+	require.NoError(t, err)
+
+	assert.Equal(t, "config-2", testISOLabel(t, iso))
+	assert.Equal(t, map[string]string{"openstack/latest/user_data": `{"ignition":{"version":"3.4.0"}}`}, testISOFiles(t, iso))
+}
+
+func TestGenerateSeedISO_UnsupportedFormat(t *testing.T) {
+	_, err := GenerateSeedISO("configdrive", SeedData{})
+
+	assert.ErrorContains(t, err, `unsupported seed format "configdrive"`)
+}
+
+// testISOLabel returns the volume label of an ISO image
+func testISOLabel(t *testing.T, iso []byte) string {
+	t.Helper()
+
+	image, err := iso9660.OpenImage(bytes.NewReader(iso))
+	require.NoError(t, err)
+	label, err := image.Label()
+	require.NoError(t, err)
+	return label
+}
+
+// testISOFiles returns the files of an ISO image by path
+func testISOFiles(t *testing.T, iso []byte) map[string]string {
+	t.Helper()
+
+	image, err := iso9660.OpenImage(bytes.NewReader(iso))
+	require.NoError(t, err)
+	root, err := image.RootDir()
+	require.NoError(t, err)
+
+	files := map[string]string{}
+	var walk func(dir *iso9660.File, prefix string)
+	walk = func(dir *iso9660.File, prefix string) {
+		children, err := dir.GetChildren()
+		require.NoError(t, err)
+		for _, child := range children {
+			name := path.Join(prefix, child.Name())
+			if child.IsDir() {
+				walk(child, name)
+				continue
+			}
+			content, err := io.ReadAll(child.Reader())
+			require.NoError(t, err)
+			files[name] = string(content)
+		}
+	}
+	walk(root, "")
+	return files
+}
+
+func TestSeedContentHash(t *testing.T) {
+	seed := SeedData{UserData: "#cloud-config\n", MetaData: "instance-id: web\n"}
+
+	assert.Equal(t, seedContentHash(seedFormatNoCloud, seed), seedContentHash("", seed))
+	assert.NotEqual(t, seedContentHash(seedFormatNoCloud, seed), seedContentHash(seedFormatTalos, seed))
+	// Moving text between files changes the hash
+	assert.NotEqual(t, seedContentHash("", SeedData{UserData: "ab"}), seedContentHash("", SeedData{UserData: "a", MetaData: "b"}))
+}
+
+func TestWithInstanceID(t *testing.T) {
+	metaData, err := withInstanceID("instance-id: web\nlocal-hostname: web01\n", "vm", "0123456789abcdef")
+	require.NoError(t, err)
+	assert.Equal(t, "instance-id: web-0123456789ab\nlocal-hostname: web01\n", metaData)
+
+	metaData, err = withInstanceID("", "vm", "0123456789abcdef")
+	require.NoError(t, err)
+	assert.Equal(t, "instance-id: vm-0123456789ab\n", metaData)
+}
@@ -0,0 +1,38 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+)
+
+// useStateForUnknownIfSet works like UseStateForUnknown, except that it
+// keeps the plan unknown when the prior value is null. Elements added to a
+// nested list have a null prior value, and their computed attributes are
+// only known after apply.
+type useStateForUnknownIfSet struct{}
+
+var _ planmodifier.Int64 = useStateForUnknownIfSet{}
+var _ planmodifier.String = useStateForUnknownIfSet{}
+
+func (m useStateForUnknownIfSet) Description(_ context.Context) string {
+	return "Once set, the value of this attribute in state will not change."
+}
+
+func (m useStateForUnknownIfSet) MarkdownDescription(ctx context.Context) string {
+	return m.Description(ctx)
+}
+
+func (m useStateForUnknownIfSet) PlanModifyInt64(_ context.Context, req planmodifier.Int64Request, resp *planmodifier.Int64Response) {
+	if req.State.Raw.IsNull() || req.StateValue.IsNull() || !req.PlanValue.IsUnknown() || req.ConfigValue.IsUnknown() {
+		return
+	}
+	resp.PlanValue = req.StateValue
+}
+
+func (m useStateForUnknownIfSet) PlanModifyString(_ context.Context, req planmodifier.StringRequest, resp *planmodifier.StringResponse) {
+	if req.State.Raw.IsNull() || req.StateValue.IsNull() || !req.PlanValue.IsUnknown() || req.ConfigValue.IsUnknown() {
+		return
+	}
+	resp.PlanValue = req.StateValue
+}
@@ -2,19 +2,29 @@ package provider
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/hashicorp/terraform-plugin-framework-validators/boolvalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/providervalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
 	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/provider"
 	"github.com/hashicorp/terraform-plugin-framework/provider/schema"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
 	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
 )
 
 // Ensure TruenasProvider satisfies various provider interfaces.
 var _ provider.Provider = &TruenasProvider{}
+var _ provider.ProviderWithConfigValidators = &TruenasProvider{}
 
 // TruenasProvider defines the provider implementation.
 type TruenasProvider struct {
@@ -28,6 +38,26 @@ type TruenasProvider struct {
 type TruenasProviderModel struct {
 	BaseURL types.String `tfsdk:"base_url"`
 	APIKey  types.String `tfsdk:"api_key"`
+
+	Username        types.String `tfsdk:"username"`
+	Password        types.String `tfsdk:"password"`
+	UseSessionToken types.Bool   `tfsdk:"use_session_token"`
+	SessionTokenTTL types.String `tfsdk:"session_token_ttl"`
+
+	MaxRetries   types.Int64  `tfsdk:"max_retries"`
+	RetryMinWait types.String `tfsdk:"retry_min_wait"`
+	RetryMaxWait types.String `tfsdk:"retry_max_wait"`
+
+	CACertPEM          types.String `tfsdk:"ca_cert_pem"`
+	CACertFile         types.String `tfsdk:"ca_cert_file"`
+	ClientCert         types.String `tfsdk:"client_cert"`
+	ClientKey          types.String `tfsdk:"client_key"`
+	TLSServerName      types.String `tfsdk:"tls_server_name"`
+	InsecureSkipVerify types.Bool   `tfsdk:"insecure_skip_verify"`
+
+	Transport types.String `tfsdk:"transport"`
+
+	SkipVersionCheck types.Bool `tfsdk:"skip_version_check"`
 }
 
 func (p *TruenasProvider) Metadata(ctx context.Context, req provider.MetadataRequest, resp *provider.MetadataResponse) {
@@ -44,10 +74,81 @@ func (p *TruenasProvider) Schema(ctx context.Context, req provider.SchemaRequest
 				Optional:    true,
 			},
 			"api_key": schema.StringAttribute{
-				Description: "The API key for authenticating with TrueNAS. Can also be set via TRUENAS_API_KEY environment variable.",
+				Description: "The API key for authenticating with TrueNAS. Conflicts with username and password. Can also be set via TRUENAS_API_KEY environment variable.",
 				Optional:    true,
 				Sensitive:   true,
 			},
+			"username": schema.StringAttribute{
+				Description: "Username for basic authentication, e.g. to bootstrap a fresh system before an API key exists. Requires password and conflicts with api_key. Can also be set via TRUENAS_USERNAME environment variable.",
+				Optional:    true,
+			},
+			"password": schema.StringAttribute{
+				Description: "Password for basic authentication. Requires username. Can also be set via TRUENAS_PASSWORD environment variable.",
+				Optional:    true,
+				Sensitive:   true,
+			},
+			"use_session_token": schema.BoolAttribute{
+				Description: "Exchange username and password for a short-lived session token via /auth/generate_token and use it for the rest of the run, instead of sending the password with every request. Default: false",
+				Optional:    true,
+				Validators: []validator.Bool{
+					boolvalidator.ConflictsWith(path.MatchRoot("api_key")),
+				},
+			},
+			"session_token_ttl": schema.StringAttribute{
+				Description: "Lifetime of the session token as a duration string (e.g., \"10m\"). Expired tokens are renewed automatically. Default: 10m",
+				Optional:    true,
+				Validators: []validator.String{
+					stringvalidator.AlsoRequires(path.MatchRoot("use_session_token")),
+				},
+			},
+			"max_retries": schema.Int64Attribute{
+				Description: "Maximum number of retries for transient API failures (connection refused, EOF, HTTP 429/502/503/504). Only idempotent requests are retried. Set to 0 to disable retries. Default: 4",
+				Optional:    true,
+			},
+			"retry_min_wait": schema.StringAttribute{
+				Description: "Backoff before the first retry as a duration string (e.g., \"1s\"). The backoff doubles on each retry, with jitter. Default: 1s",
+				Optional:    true,
+			},
+			"retry_max_wait": schema.StringAttribute{
+				Description: "Maximum backoff between two retries as a duration string (e.g., \"30s\"). Default: 30s",
+				Optional:    true,
+			},
+			"ca_cert_pem": schema.StringAttribute{
+				Description: "PEM-encoded CA certificate bundle used to verify the TrueNAS server certificate, in addition to the system CAs. Conflicts with ca_cert_file. Can also be set via TRUENAS_CA_CERT_PEM environment variable.",
+				Optional:    true,
+			},
+			"ca_cert_file": schema.StringAttribute{
+				Description: "Path to a PEM-encoded CA certificate bundle used to verify the TrueNAS server certificate, in addition to the system CAs. Conflicts with ca_cert_pem. Can also be set via TRUENAS_CA_CERT_FILE environment variable.",
+				Optional:    true,
+			},
+			"client_cert": schema.StringAttribute{
+				Description: "Client certificate for mutual TLS, as PEM content or a path to a PEM file. Requires client_key. Can also be set via TRUENAS_CLIENT_CERT environment variable.",
+				Optional:    true,
+			},
+			"client_key": schema.StringAttribute{
+				Description: "Private key of the client certificate, as PEM content or a path to a PEM file. Requires client_cert. Can also be set via TRUENAS_CLIENT_KEY environment variable.",
+				Optional:    true,
+				Sensitive:   true,
+			},
+			"tls_server_name": schema.StringAttribute{
+				Description: "Server name used to verify the TrueNAS certificate, when it differs from the host in base_url (e.g., when connecting by IP address). Can also be set via TRUENAS_TLS_SERVER_NAME environment variable.",
+				Optional:    true,
+			},
+			"insecure_skip_verify": schema.BoolAttribute{
+				Description: "Skip verification of the TrueNAS server certificate. Only use this for testing. Can also be set via TRUENAS_INSECURE_SKIP_VERIFY environment variable. Default: false",
+				Optional:    true,
+			},
+			"transport": schema.StringAttribute{
+				Description: "Protocol used to call the TrueNAS API: \"rest\" for the REST API at /api/v2.0, or \"websocket\" for the JSON-RPC API at /websocket, which keeps one connection open and is notified of job progress instead of polling. File uploads always use HTTP. Can also be set via TRUENAS_TRANSPORT environment variable. Default: \"rest\"",
+				Optional:    true,
+				Validators: []validator.String{
+					stringvalidator.OneOf(truenas.TransportREST, truenas.TransportWebSocket),
+				},
+			},
+			"skip_version_check": schema.BoolAttribute{
+				Description: "Use the provider with a TrueNAS release outside the supported range instead of failing. Resources are then only checked for the features known to be missing on the release, and others may fail during apply where the API differs. Can also be set via TRUENAS_SKIP_VERSION_CHECK environment variable. Default: false",
+				Optional:    true,
+			},
 		},
 	}
 }
@@ -64,14 +165,27 @@ func (p *TruenasProvider) Configure(ctx context.Context, req provider.ConfigureR
 	// Configuration values are now available.
 	// If practitioners don't configure a value, check environment variables.
 	baseURL := os.Getenv("TRUENAS_BASE_URL")
-	apiKey := os.Getenv("TRUENAS_API_KEY")
 
 	if !config.BaseURL.IsNull() {
 		baseURL = config.BaseURL.ValueString()
 	}
 
-	if !config.APIKey.IsNull() {
-		apiKey = config.APIKey.ValueString()
+	// Credentials set in the configuration take precedence over the
+	// environment. From the environment an API key wins over a username,
+	// unless session tokens were requested, which need a username.
+	apiKey := config.APIKey.ValueString()
+	username := config.Username.ValueString()
+	password := config.Password.ValueString()
+	if config.APIKey.IsNull() && config.Username.IsNull() {
+		if !config.UseSessionToken.ValueBool() {
+			apiKey = os.Getenv("TRUENAS_API_KEY")
+		}
+		if apiKey == "" {
+			username = os.Getenv("TRUENAS_USERNAME")
+		}
+	}
+	if username != "" && config.Password.IsNull() {
+		password = os.Getenv("TRUENAS_PASSWORD")
 	}
 
 	// If any of the expected configurations are missing, return
@@ -86,22 +200,109 @@ func (p *TruenasProvider) Configure(ctx context.Context, req provider.ConfigureR
 		)
 	}
 
-	if apiKey == "" {
+	if apiKey == "" && username == "" {
 		resp.Diagnostics.AddAttributeError(
 			path.Root("api_key"),
 			"Missing TrueNAS API Key",
 			"The provider cannot create the TrueNAS API client as there is a missing or empty value for the TrueNAS API key. "+
-				"Set the api_key value in the configuration or use the TRUENAS_API_KEY environment variable. "+
+				"Set the api_key value in the configuration or use the TRUENAS_API_KEY environment variable, "+
+				"or authenticate with username and password (TRUENAS_USERNAME and TRUENAS_PASSWORD). "+
 				"If either is already set, ensure the value is not empty.",
 		)
 	}
 
+	if username != "" && password == "" {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("password"),
+			"Missing TrueNAS Password",
+			"The provider cannot authenticate as "+username+" as there is a missing or empty value for the password. "+
+				"Set the password value in the configuration or use the TRUENAS_PASSWORD environment variable.",
+		)
+	}
+
+	tokenTTL := parseProviderDuration(config.SessionTokenTTL, path.Root("session_token_ttl"), 0, &resp.Diagnostics)
+
+	retryPolicy := truenas.DefaultRetryPolicy()
+
+	if !config.MaxRetries.IsNull() {
+		if config.MaxRetries.ValueInt64() < 0 {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("max_retries"),
+				"Invalid Max Retries",
+				"The max_retries value must be zero or greater.",
+			)
+		}
+		retryPolicy.MaxRetries = int(config.MaxRetries.ValueInt64())
+	}
+
+	retryPolicy.MinWait = parseProviderDuration(config.RetryMinWait, path.Root("retry_min_wait"), retryPolicy.MinWait, &resp.Diagnostics)
+	retryPolicy.MaxWait = parseProviderDuration(config.RetryMaxWait, path.Root("retry_max_wait"), retryPolicy.MaxWait, &resp.Diagnostics)
+
+	if retryPolicy.MaxWait < retryPolicy.MinWait {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("retry_max_wait"),
+			"Invalid Retry Wait",
+			fmt.Sprintf("The retry_max_wait value (%s) must not be less than retry_min_wait (%s).", retryPolicy.MaxWait, retryPolicy.MinWait),
+		)
+	}
+
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
+	tlsConfig := truenas.TLSConfig{
+		CACertPEM:  stringValueOrEnv(config.CACertPEM, "TRUENAS_CA_CERT_PEM"),
+		CACertFile: stringValueOrEnv(config.CACertFile, "TRUENAS_CA_CERT_FILE"),
+		ClientCert: stringValueOrEnv(config.ClientCert, "TRUENAS_CLIENT_CERT"),
+		ClientKey:  stringValueOrEnv(config.ClientKey, "TRUENAS_CLIENT_KEY"),
+		ServerName: stringValueOrEnv(config.TLSServerName, "TRUENAS_TLS_SERVER_NAME"),
+	}
+
+	if !config.InsecureSkipVerify.IsNull() {
+		tlsConfig.InsecureSkipVerify = config.InsecureSkipVerify.ValueBool()
+	} else if v := os.Getenv("TRUENAS_INSECURE_SKIP_VERIFY"); v != "" {
+		insecure, err := strconv.ParseBool(v)
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("insecure_skip_verify"),
+				"Invalid TRUENAS_INSECURE_SKIP_VERIFY Value",
+				fmt.Sprintf("Unable to parse %q as a boolean.", v),
+			)
+			return
+		}
+		tlsConfig.InsecureSkipVerify = insecure
+	}
+
+	skipVersionCheck := config.SkipVersionCheck.ValueBool()
+	if config.SkipVersionCheck.IsNull() {
+		if v := os.Getenv("TRUENAS_SKIP_VERSION_CHECK"); v != "" {
+			skip, err := strconv.ParseBool(v)
+			if err != nil {
+				resp.Diagnostics.AddAttributeError(
+					path.Root("skip_version_check"),
+					"Invalid TRUENAS_SKIP_VERSION_CHECK Value",
+					fmt.Sprintf("Unable to parse %q as a boolean.", v),
+				)
+				return
+			}
+			skipVersionCheck = skip
+		}
+	}
+
+	opts := []truenas.ClientOption{
+		truenas.WithTLSConfig(tlsConfig),
+		truenas.WithTransport(stringValueOrEnv(config.Transport, "TRUENAS_TRANSPORT")),
+	}
+	if apiKey == "" {
+		if config.UseSessionToken.ValueBool() {
+			opts = append(opts, truenas.WithAuthenticator(truenas.NewSessionTokenAuth(username, password, tokenTTL)))
+		} else {
+			opts = append(opts, truenas.WithAuthenticator(&truenas.BasicAuth{Username: username, Password: password}))
+		}
+	}
+
 	// Create a new TrueNAS client using the configuration values
-	client, err := truenas.NewClient(baseURL, apiKey)
+	client, err := truenas.NewClient(baseURL, apiKey, opts...)
 	if err != nil {
 		resp.Diagnostics.AddError(
 			"Unable to Create TrueNAS API Client",
@@ -111,6 +312,37 @@ func (p *TruenasProvider) Configure(ctx context.Context, req provider.ConfigureR
 		)
 		return
 	}
+	client.RetryPolicy = retryPolicy
+
+	// Detect the server release so resources can fail at plan time when
+	// their API is not available, instead of with a 404 during apply
+	if err := client.DetectServer(ctx); err != nil {
+		resp.Diagnostics.AddWarning(
+			"Unable to Detect TrueNAS Version",
+			"The provider could not determine the TrueNAS version, so resources are not checked for compatibility with it.\n\n"+
+				"TrueNAS Client Error: "+err.Error(),
+		)
+	} else if !truenas.SupportedVersions.Contains(*client.ServerVersion) {
+		summary := fmt.Sprintf("The TrueNAS server runs %s, but this provider supports TrueNAS SCALE %s.", client.ServerVersion.Raw, truenas.SupportedVersions)
+		if skipVersionCheck {
+			resp.Diagnostics.AddWarning(
+				"Unsupported TrueNAS Version",
+				summary+" skip_version_check is set, so resources are only checked for the features known to be missing on this release, and others may fail during apply where the API differs.",
+			)
+		} else {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("skip_version_check"),
+				"Unsupported TrueNAS Version",
+				summary+" Resources may fail during apply where the API of this release differs. Set skip_version_check to true to use the provider anyway.",
+			)
+			return
+		}
+	} else {
+		tflog.Debug(ctx, "Detected TrueNAS version", map[string]interface{}{
+			"version":  client.ServerVersion.String(),
+			"hostname": client.SystemInfo.Hostname,
+		})
+	}
 
 	// Make the TrueNAS client available during DataSource and Resource
 	// type Configure methods.
@@ -118,15 +350,73 @@ func (p *TruenasProvider) Configure(ctx context.Context, req provider.ConfigureR
 	resp.ResourceData = client
 }
 
+// ConfigValidators returns validators for the provider configuration
+func (p *TruenasProvider) ConfigValidators(ctx context.Context) []provider.ConfigValidator {
+	return []provider.ConfigValidator{
+		providervalidator.Conflicting(
+			path.MatchRoot("api_key"),
+			path.MatchRoot("username"),
+		),
+		providervalidator.Conflicting(
+			path.MatchRoot("api_key"),
+			path.MatchRoot("password"),
+		),
+		providervalidator.Conflicting(
+			path.MatchRoot("ca_cert_pem"),
+			path.MatchRoot("ca_cert_file"),
+		),
+		providervalidator.RequiredTogether(
+			path.MatchRoot("client_cert"),
+			path.MatchRoot("client_key"),
+		),
+	}
+}
+
+// stringValueOrEnv returns the configured value, falling back to the
+// environment variable when the attribute is not set
+func stringValueOrEnv(value types.String, env string) string {
+	if !value.IsNull() {
+		return value.ValueString()
+	}
+	return os.Getenv(env)
+}
+
+// parseProviderDuration parses an optional duration string attribute,
+// returning def when it is not set
+func parseProviderDuration(value types.String, attr path.Path, def time.Duration, diags *diag.Diagnostics) time.Duration {
+	if value.IsNull() || value.IsUnknown() {
+		return def
+	}
+
+	d, err := time.ParseDuration(value.ValueString())
+	if err != nil || d < 0 {
+		diags.AddAttributeError(
+			attr,
+			"Invalid Duration",
+			fmt.Sprintf("Unable to parse %q as a non-negative duration (e.g., \"1s\" or \"2m\").", value.ValueString()),
+		)
+		return def
+	}
+
+	return d
+}
+
 func (p *TruenasProvider) Resources(ctx context.Context) []func() resource.Resource {
 	return []func() resource.Resource{
 		NewDatasetResource,
+		NewDatasetUnlockResource,
 		NewNFSShareResource,
 		NewSMBShareResource,
 		NewUserResource,
 		NewGroupResource,
 		NewVMResource,
 		NewVMDeviceResource,
+		NewVMCloneResource,
+		NewVMDiskImageResource,
+		NewFileResource,
+		NewFilesystemACLResource,
+		NewFilesystemPermissionResource,
+		NewACLTemplateResource,
 		NewISCSITargetResource,
 		NewISCSIExtentResource,
 		NewISCSIPortalResource,
@@ -141,6 +431,8 @@ func (p *TruenasProvider) Resources(ctx context.Context) []func() resource.Resou
 func (p *TruenasProvider) DataSources(ctx context.Context) []func() datasource.DataSource {
 	return []func() datasource.DataSource{
 		NewDatasetDataSource,
+		NewDatasetEncryptionSummaryDataSource,
+		NewDatasetEncryptionKeysDataSource,
 		NewPoolDataSource,
 		NewVMGuestInfoDataSource,
 		NewGPUPCIChoicesDataSource,
@@ -148,8 +440,12 @@ func (p *TruenasProvider) DataSources(ctx context.Context) []func() datasource.D
 		NewVMIOMMUEnabledDataSource,
 		NewNFSSharesDataSource,
 		NewSMBSharesDataSource,
+		NewACLTemplatesDataSource,
 		NewVMsDataSource,
 		NewVMDataSource,
+		NewVMDisplayDataSource,
+		NewVMHostCapacityDataSource,
+		NewSystemInfoDataSource,
 	}
 }
 
@@ -0,0 +1,131 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/terraform"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas/fake"
+)
+
+// testAccProtoV6ProviderFactories serves the provider to the acceptance
+// tests. The tests run against an in-memory fake of the TrueNAS API, so
+// they only need TF_ACC=1 and a terraform binary, not a TrueNAS server.
+var testAccProtoV6ProviderFactories = map[string]func() (tfprotov6.ProviderServer, error){
+	"truenas": providerserver.NewProtocol6WithError(New("test")()),
+}
+
+// testAccFakeServer starts a fake TrueNAS API for one acceptance test
+func testAccFakeServer(t *testing.T) *fake.Server {
+	t.Helper()
+
+	server := fake.NewServer()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testAccProviderConfig returns the provider block for a fake server
+func testAccProviderConfig(server *fake.Server) string {
+	return fmt.Sprintf(`
+provider "truenas" {
+  base_url    = %q
+  api_key     = "test-key"
+  max_retries = 0
+}
+`, server.URL)
+}
+
+// testAccCheckDestroyed verifies that the objects of the given type are
+// gone from the fake server after destroy
+func testAccCheckDestroyed(server *fake.Server, namespace, resourceType string) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		for _, rs := range s.RootModule().Resources {
+			if rs.Type != resourceType {
+				continue
+			}
+			if _, ok := server.Object(namespace, rs.Primary.ID); ok {
+				return fmt.Errorf("%s %s still exists", resourceType, rs.Primary.ID)
+			}
+		}
+		return nil
+	}
+}
+
+// testAccCheckExists verifies that the object of a resource exists on the
+// fake server
+func testAccCheckExists(server *fake.Server, namespace, resourceName string) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[resourceName]
+		if !ok {
+			return fmt.Errorf("%s not found in state", resourceName)
+		}
+		if _, ok := server.Object(namespace, rs.Primary.ID); !ok {
+			return fmt.Errorf("%s %s does not exist", resourceName, rs.Primary.ID)
+		}
+		return nil
+	}
+}
+
+// testAccDeleteOutOfBand removes an object from the fake server, as if it
+// had been deleted outside Terraform
+func testAccDeleteOutOfBand(t *testing.T, server *fake.Server, namespace string, id interface{}) func() {
+	return func() {
+		if err := server.Delete(namespace, id); err != nil {
+			t.Fatalf("deleting %s %v: %s", namespace, id, err)
+		}
+	}
+}
+
+// TestAccProvider_unsupportedVersion tests that a release outside the
+// supported range fails unless skip_version_check is set, and that the
+// features missing on the release are still checked then
+func TestAccProvider_unsupportedVersion(t *testing.T) {
+	server := testAccFakeServer(t)
+	server.SetVersion("TrueNAS-SCALE-25.04.0")
+
+	route := `
+resource "truenas_static_route" "test" {
+  destination = "10.20.0.0/16"
+  gateway     = "10.0.0.1"
+}
+`
+	skipConfig := fmt.Sprintf(`
+provider "truenas" {
+  base_url           = %q
+  api_key            = "test-key"
+  max_retries        = 0
+  skip_version_check = true
+}
+`, server.URL)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "staticroute", "truenas_static_route"),
+		Steps: []resource.TestStep{
+			{
+				Config:      testAccProviderConfig(server) + route,
+				ExpectError: regexp.MustCompile(`(?s)runs TrueNAS-SCALE-25\.04\.0, but this provider supports.*skip_version_check`),
+			},
+			{
+				Config: skipConfig + route,
+				Check:  testAccCheckExists(server, "staticroute", "truenas_static_route.test"),
+			},
+			{
+				Config: skipConfig + route + `
+resource "truenas_chart_release" "test" {
+  release_name = "plex"
+  catalog      = "TRUENAS"
+  train        = "charts"
+  item         = "plex"
+  version      = "1.0.0"
+}
+`,
+				ExpectError: regexp.MustCompile(`chart\.release API`),
+			},
+		},
+	})
+}
@@ -0,0 +1,296 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework-validators/listvalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+)
+
+var _ resource.Resource = &ACLTemplateResource{}
+var _ resource.ResourceWithImportState = &ACLTemplateResource{}
+var _ resource.ResourceWithValidateConfig = &ACLTemplateResource{}
+
+func NewACLTemplateResource() resource.Resource {
+	return &ACLTemplateResource{}
+}
+
+type ACLTemplateResource struct {
+	client *truenas.Client
+}
+
+type ACLTemplateResourceModel struct {
+	ID      types.String    `tfsdk:"id"`
+	Name    types.String    `tfsdk:"name"`
+	ACLType types.String    `tfsdk:"acltype"`
+	Comment types.String    `tfsdk:"comment"`
+	Entries []ACLEntryModel `tfsdk:"entries"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
+}
+
+// aclTemplateAPIFields maps /filesystem/acltemplate fields to attributes
+var aclTemplateAPIFields = map[string]path.Path{
+	"acl": path.Root("entries"),
+}
+
+func (r *ACLTemplateResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_acl_template"
+}
+
+func (r *ACLTemplateResource) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Manages an ACL template, a named NFSv4 or POSIX.1e ACL that `truenas_filesystem_acl` and the TrueNAS UI can apply to paths of its ACL type",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Template identifier",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"name": schema.StringAttribute{
+				MarkdownDescription: "Unique name of the template",
+				Required:            true,
+				Validators: []validator.String{
+					stringvalidator.LengthAtLeast(1),
+				},
+			},
+			"acltype": schema.StringAttribute{
+				MarkdownDescription: "`NFS4` or `POSIX1E`: the ACL type of the paths the template applies to",
+				Required:            true,
+				Validators: []validator.String{
+					stringvalidator.OneOf(truenas.ACLTypeNFS4, truenas.ACLTypePOSIX1E),
+				},
+			},
+			"comment": schema.StringAttribute{
+				MarkdownDescription: "Description of the template",
+				Optional:            true,
+				Computed:            true,
+				Default:             stringdefault.StaticString(""),
+			},
+			"entries": schema.ListNestedAttribute{
+				MarkdownDescription: "Access control entries, in order. Templates store the UID or GID of `USER` and `GROUP` entries, so these set `id` rather than `who`.",
+				Required:            true,
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: aclEntryAttributes(),
+				},
+				Validators: []validator.List{
+					listvalidator.SizeAtLeast(1),
+				},
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
+	}
+}
+
+func (r *ACLTemplateResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*truenas.Client)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *truenas.Client, got: %T.", req.ProviderData),
+		)
+		return
+	}
+
+	r.client = client
+}
+
+// ValidateConfig checks that the entries fit the ACL type and name users
+// and groups by id
+func (r *ACLTemplateResource) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var acltype types.String
+	var entries types.List
+	resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root("acltype"), &acltype)...)
+	resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root("entries"), &entries)...)
+	if resp.Diagnostics.HasError() || entries.IsNull() || entries.IsUnknown() || acltype.IsNull() || acltype.IsUnknown() {
+		return
+	}
+
+	var models []ACLEntryModel
+	resp.Diagnostics.Append(entries.ElementsAs(ctx, &models, false)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	validateACLEntries(ctx, acltype.ValueString(), models, path.Root("entries"), &resp.Diagnostics)
+
+	for i, entry := range models {
+		if !entry.Who.IsNull() {
+			resp.Diagnostics.AddAttributeError(path.Root("entries").AtListIndex(i).AtName("who"), "Invalid Attribute Value", "ACL templates store the id of users and groups; set id instead of who.")
+		}
+	}
+}
+
+func (r *ACLTemplateResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data ACLTemplateResourceModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	createTimeout, diags := data.Timeouts.Create(ctx, defaultTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
+	template, diags := r.toAPI(ctx, &data)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	created, err := r.client.CreateACLTemplate(ctx, template)
+	if err != nil {
+		addClientError(&resp.Diagnostics, "create ACL template", err, &data, aclTemplateAPIFields)
+		return
+	}
+	data.ID = types.StringValue(fmt.Sprint(created.ID))
+
+	r.fromAPI(ctx, &data, created, &resp.Diagnostics)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *ACLTemplateResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data ACLTemplateResourceModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	readTimeout, diags := data.Timeouts.Read(ctx, defaultTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	template, err := r.client.GetACLTemplate(ctx, data.ID.ValueString())
+	if err != nil {
+		if truenas.IsNotFound(err) {
+			// Deleted outside of Terraform; drop it from state so it is re-created
+			resp.State.RemoveResource(ctx)
+			return
+		}
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to read ACL template, got error: %s", err))
+		return
+	}
+
+	r.fromAPI(ctx, &data, template, &resp.Diagnostics)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *ACLTemplateResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var data ACLTemplateResourceModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	updateTimeout, diags := data.Timeouts.Update(ctx, defaultTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	template, diags := r.toAPI(ctx, &data)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	updated, err := r.client.UpdateACLTemplate(ctx, data.ID.ValueString(), template)
+	if err != nil {
+		addClientError(&resp.Diagnostics, "update ACL template", err, &data, aclTemplateAPIFields)
+		return
+	}
+
+	r.fromAPI(ctx, &data, updated, &resp.Diagnostics)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *ACLTemplateResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data ACLTemplateResourceModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, defaultTimeouts.Delete)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
+	if err := r.client.DeleteACLTemplate(ctx, data.ID.ValueString()); err != nil && !truenas.IsNotFound(err) {
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete ACL template, got error: %s", err))
+		return
+	}
+}
+
+func (r *ACLTemplateResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+// toAPI converts the planned template into the create and update body
+func (r *ACLTemplateResource) toAPI(ctx context.Context, data *ACLTemplateResourceModel) (truenas.ACLTemplate, diag.Diagnostics) {
+	acltype := data.ACLType.ValueString()
+	entries, diags := aclEntriesToAPI(ctx, acltype, data.Entries)
+	return truenas.ACLTemplate{
+		Name:    data.Name.ValueString(),
+		ACLType: acltype,
+		Comment: data.Comment.ValueString(),
+		Entries: entries,
+	}, diags
+}
+
+// fromAPI refreshes data from a template returned by the API, keeping the
+// form of the prior entries
+func (r *ACLTemplateResource) fromAPI(ctx context.Context, data *ACLTemplateResourceModel, template *truenas.ACLTemplate, diags *diag.Diagnostics) {
+	data.Name = types.StringValue(template.Name)
+	data.ACLType = types.StringValue(template.ACLType)
+	data.Comment = types.StringValue(template.Comment)
+
+	entries, d := aclEntriesFromAPI(ctx, &truenas.ACL{ACLType: template.ACLType, Entries: template.Entries}, data.Entries)
+	diags.Append(d...)
+	data.Entries = entries
+}
@@ -0,0 +1,168 @@
+package provider
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+// TestAccACLTemplateResource tests creating, updating and importing an
+// NFSv4 template
+func TestAccACLTemplateResource(t *testing.T) {
+	server := testAccFakeServer(t)
+	testAccACLDatasets(t, server)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_acl_template" "share" {
+  name    = "DEPARTMENT_SHARE"
+  acltype = "NFS4"
+
+  entries = [
+    { tag = "owner@", type = "ALLOW", basic_perms = "FULL_CONTROL", basic_flags = "INHERIT" },
+    { tag = "USER", id = 3000, type = "ALLOW", basic_perms = "MODIFY", basic_flags = "INHERIT" },
+  ]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttrSet("truenas_acl_template.share", "id"),
+					resource.TestCheckResourceAttr("truenas_acl_template.share", "comment", ""),
+					resource.TestCheckResourceAttr("truenas_acl_template.share", "entries.#", "2"),
+					resource.TestCheckResourceAttr("truenas_acl_template.share", "entries.1.id", "3000"),
+				),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_acl_template" "share" {
+  name    = "DEPARTMENT_SHARE"
+  acltype = "NFS4"
+  comment = "Department shares"
+
+  entries = [
+    { tag = "owner@", type = "ALLOW", basic_perms = "FULL_CONTROL", basic_flags = "INHERIT" },
+    { tag = "USER", id = 3000, type = "ALLOW", perms = ["READ_DATA", "EXECUTE"], flags = ["FILE_INHERIT"] },
+    { tag = "everyone@", type = "DENY", perms = ["WRITE_DATA"] },
+  ]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_acl_template.share", "comment", "Department shares"),
+					resource.TestCheckResourceAttr("truenas_acl_template.share", "entries.#", "3"),
+					resource.TestCheckResourceAttr("truenas_acl_template.share", "entries.1.perms.#", "2"),
+					resource.TestCheckNoResourceAttr("truenas_acl_template.share", "entries.1.basic_perms"),
+				),
+			},
+			{
+				ResourceName:            "truenas_acl_template.share",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"timeouts"},
+			},
+		},
+	})
+}
+
+// TestAccACLTemplateResource_errors tests entries that templates cannot
+// store, and duplicate names
+func TestAccACLTemplateResource_errors(t *testing.T) {
+	server := testAccFakeServer(t)
+	testAccACLDatasets(t, server)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_acl_template" "share" {
+  name    = "SHARE"
+  acltype = "NFS4"
+  entries = [{ tag = "USER", who = "alice", type = "ALLOW", basic_perms = "READ" }]
+}
+`,
+				ExpectError: regexp.MustCompile(`set id instead of who`),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_acl_template" "open" {
+  name    = "NFS4_OPEN"
+  acltype = "NFS4"
+  entries = [{ tag = "owner@", type = "ALLOW", basic_perms = "READ" }]
+}
+`,
+				ExpectError: regexp.MustCompile(`already exists`),
+			},
+		},
+	})
+}
+
+// TestAccACLTemplatesDataSource tests filtering templates by path and name,
+// and the format options
+func TestAccACLTemplatesDataSource(t *testing.T) {
+	server := testAccFakeServer(t)
+	testAccACLDatasets(t, server)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_acl_template" "share" {
+  name    = "DEPARTMENT_SHARE"
+  acltype = "NFS4"
+
+  entries = [
+    { tag = "USER", id = 3000, type = "ALLOW", basic_perms = "MODIFY", basic_flags = "INHERIT" },
+    { tag = "everyone@", type = "DENY", perms = ["WRITE_DATA"] },
+  ]
+}
+
+data "truenas_acl_templates" "smb" {
+  path = "/mnt/tank/smb"
+
+  depends_on = [truenas_acl_template.share]
+}
+
+data "truenas_acl_templates" "share" {
+  path          = "/mnt/tank/smb"
+  name          = truenas_acl_template.share.name
+  canonicalize  = true
+  resolve_names = true
+}
+
+data "truenas_acl_templates" "posix" {
+  name            = "POSIX_RESTRICTED"
+  ensure_builtins = true
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("data.truenas_acl_templates.smb", "templates.#", "4"),
+					resource.TestCheckResourceAttr("data.truenas_acl_templates.smb", "templates.0.name", "NFS4_OPEN"),
+					resource.TestCheckResourceAttr("data.truenas_acl_templates.smb", "templates.0.builtin", "true"),
+					resource.TestCheckResourceAttr("data.truenas_acl_templates.smb", "templates.0.entries.0.basic_perms", "FULL_CONTROL"),
+					resource.TestCheckResourceAttr("data.truenas_acl_templates.smb", "templates.0.entries.0.basic_flags", "INHERIT"),
+					resource.TestCheckResourceAttr("data.truenas_acl_templates.share", "templates.#", "1"),
+					resource.TestCheckResourceAttr("data.truenas_acl_templates.share", "templates.0.builtin", "false"),
+					resource.TestCheckResourceAttr("data.truenas_acl_templates.share", "templates.0.entries.0.tag", "everyone@"),
+					resource.TestCheckResourceAttr("data.truenas_acl_templates.share", "templates.0.entries.1.id", "3000"),
+					resource.TestCheckResourceAttr("data.truenas_acl_templates.share", "templates.0.entries.1.who", "alice"),
+					resource.TestCheckResourceAttr("data.truenas_acl_templates.posix", "templates.0.acltype", "POSIX1E"),
+					resource.TestCheckResourceAttr("data.truenas_acl_templates.posix", "templates.0.entries.#", "12"),
+					resource.TestCheckResourceAttr("data.truenas_acl_templates.posix", "templates.0.entries.6.id", "545"),
+				),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+data "truenas_acl_templates" "posix" {
+  path         = "/mnt/tank/posix"
+  canonicalize = true
+}
+`,
+				ExpectError: regexp.MustCompile(`canonical order`),
+			},
+		},
+	})
+}
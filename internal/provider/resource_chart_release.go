@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
@@ -17,6 +18,7 @@ import (
 
 var _ resource.Resource = &ChartReleaseResource{}
 var _ resource.ResourceWithImportState = &ChartReleaseResource{}
+var _ resource.ResourceWithModifyPlan = &ChartReleaseResource{}
 
 func NewChartReleaseResource() resource.Resource {
 	return &ChartReleaseResource{}
@@ -35,6 +37,8 @@ type ChartReleaseResourceModel struct {
 	Version     types.String `tfsdk:"version"`
 	Values      types.String `tfsdk:"values"`
 	Status      types.String `tfsdk:"status"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
 }
 
 func (r *ChartReleaseResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
@@ -94,6 +98,14 @@ func (r *ChartReleaseResource) Schema(ctx context.Context, req resource.SchemaRe
 				Computed:            true,
 			},
 		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
 	}
 }
 
@@ -114,6 +126,17 @@ func (r *ChartReleaseResource) Configure(ctx context.Context, req resource.Confi
 	r.client = client
 }
 
+// ModifyPlan fails the plan on releases without the chart.release API,
+// which was replaced by Docker based apps in 24.10
+func (r *ChartReleaseResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	// Nothing to check on destroy
+	if req.Plan.Raw.IsNull() {
+		return
+	}
+
+	checkFeatures(r.client, "truenas_chart_release", &resp.Diagnostics, truenas.FeatureChartRelease)
+}
+
 func (r *ChartReleaseResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
 	var data ChartReleaseResourceModel
 
@@ -122,6 +145,15 @@ func (r *ChartReleaseResource) Create(ctx context.Context, req resource.CreateRe
 		return
 	}
 
+	createTimeout, diags := data.Timeouts.Create(ctx, chartReleaseTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
 	createReq := map[string]interface{}{
 		"release_name": data.ReleaseName.ValueString(),
 		"catalog":      data.Catalog.ValueString(),
@@ -140,9 +172,10 @@ func (r *ChartReleaseResource) Create(ctx context.Context, req resource.CreateRe
 		createReq["values"] = values
 	}
 
-	respBody, err := r.client.Post("/chart/release", createReq)
+	// chart.release.create runs as a job; wait for the app to be deployed
+	respBody, err := r.client.PostJob(ctx, "/chart/release", createReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create chart release, got error: %s", err))
+		addClientError(&resp.Diagnostics, "create chart release", err, &data, nil)
 		return
 	}
 
@@ -158,7 +191,9 @@ func (r *ChartReleaseResource) Create(ctx context.Context, req resource.CreateRe
 		data.ID = types.StringValue(name)
 	}
 
-	r.readChartRelease(ctx, &data, &resp.Diagnostics)
+	if !r.readChartRelease(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read chart release: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -170,11 +205,26 @@ func (r *ChartReleaseResource) Read(ctx context.Context, req resource.ReadReques
 		return
 	}
 
-	r.readChartRelease(ctx, &data, &resp.Diagnostics)
+	readTimeout, diags := data.Timeouts.Read(ctx, chartReleaseTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	found := r.readChartRelease(ctx, &data, &resp.Diagnostics)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
+	if !found {
+		// Deleted outside of Terraform; drop it from state so it is re-created
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -186,9 +236,18 @@ func (r *ChartReleaseResource) Update(ctx context.Context, req resource.UpdateRe
 		return
 	}
 
+	updateTimeout, diags := data.Timeouts.Update(ctx, chartReleaseTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
 	updateReq := map[string]interface{}{}
 
-	if !data.Version.IsNull() {
+	if !data.Version.IsNull() && !data.Version.IsUnknown() {
 		updateReq["version"] = data.Version.ValueString()
 	}
 
@@ -203,13 +262,15 @@ func (r *ChartReleaseResource) Update(ctx context.Context, req resource.UpdateRe
 	}
 
 	endpoint := fmt.Sprintf("/chart/release/id/%s", data.ID.ValueString())
-	_, err := r.client.Put(endpoint, updateReq)
+	_, err := r.client.PutJob(ctx, endpoint, updateReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to update chart release, got error: %s", err))
+		addClientError(&resp.Diagnostics, "update chart release", err, &data, nil)
 		return
 	}
 
-	r.readChartRelease(ctx, &data, &resp.Diagnostics)
+	if !r.readChartRelease(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read chart release: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -221,8 +282,17 @@ func (r *ChartReleaseResource) Delete(ctx context.Context, req resource.DeleteRe
 		return
 	}
 
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, chartReleaseTimeouts.Delete)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
 	endpoint := fmt.Sprintf("/chart/release/id/%s", data.ID.ValueString())
-	_, err := r.client.Delete(endpoint)
+	_, err := r.client.DeleteJob(ctx, endpoint, nil)
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete chart release, got error: %s", err))
 		return
@@ -233,18 +303,23 @@ func (r *ChartReleaseResource) ImportState(ctx context.Context, req resource.Imp
 	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
 }
 
-func (r *ChartReleaseResource) readChartRelease(ctx context.Context, data *ChartReleaseResourceModel, diags *diag.Diagnostics) {
+// readChartRelease refreshes data from the API. It returns false, without adding a
+// diagnostic, when the chart release no longer exists.
+func (r *ChartReleaseResource) readChartRelease(ctx context.Context, data *ChartReleaseResourceModel, diags *diag.Diagnostics) bool {
 	endpoint := fmt.Sprintf("/chart/release/id/%s", data.ID.ValueString())
-	respBody, err := r.client.Get(endpoint)
+	respBody, err := r.client.Get(ctx, endpoint)
 	if err != nil {
+		if truenas.IsNotFound(err) {
+			return false
+		}
 		diags.AddError("Client Error", fmt.Sprintf("Unable to read chart release, got error: %s", err))
-		return
+		return false
 	}
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(respBody, &result); err != nil {
 		diags.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
-		return
+		return false
 	}
 
 	if name, ok := result["name"].(string); ok {
@@ -272,4 +347,6 @@ func (r *ChartReleaseResource) readChartRelease(ctx context.Context, data *Chart
 		configJSON, _ := json.Marshal(config)
 		data.Values = types.StringValue(string(configJSON))
 	}
+
+	return true
 }
@@ -0,0 +1,112 @@
+package provider
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas/fake"
+)
+
+// TestAccChartReleaseResource tests installing, importing, upgrading and
+// deleting a chart release through jobs
+func TestAccChartReleaseResource(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "chart/release", "truenas_chart_release"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_chart_release" "test" {
+  release_name = "plex"
+  catalog      = "TRUENAS"
+  train        = "charts"
+  item         = "plex"
+  version      = "1.0.0"
+  values       = jsonencode({ timezone = "UTC" })
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_chart_release.test", "id", "plex"),
+					resource.TestCheckResourceAttr("truenas_chart_release.test", "status", "ACTIVE"),
+					resource.TestCheckResourceAttr("truenas_chart_release.test", "version", "1.0.0"),
+					resource.TestCheckResourceAttr("truenas_chart_release.test", "values", `{"timezone":"UTC"}`),
+				),
+			},
+			{
+				ResourceName:            "truenas_chart_release.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"catalog", "timeouts"},
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_chart_release" "test" {
+  release_name = "plex"
+  catalog      = "TRUENAS"
+  train        = "charts"
+  item         = "plex"
+  version      = "1.1.0"
+  values       = jsonencode({ timezone = "UTC" })
+}
+`,
+				Check: resource.TestCheckResourceAttr("truenas_chart_release.test", "version", "1.1.0"),
+			},
+		},
+	})
+}
+
+// TestAccChartReleaseResource_jobFailure tests that a failed install job is reported
+func TestAccChartReleaseResource_jobFailure(t *testing.T) {
+	server := testAccFakeServer(t)
+	server.InjectFault(fake.Fault{
+		Method:   "POST",
+		Path:     "/chart/release",
+		JobError: "[EFAULT] Failed to install chart release: image pull failed",
+	})
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_chart_release" "test" {
+  release_name = "plex"
+  catalog      = "TRUENAS"
+  train        = "charts"
+  item         = "plex"
+  version      = "1.0.0"
+}
+`,
+				ExpectError: regexp.MustCompile(`image pull failed`),
+			},
+		},
+	})
+}
+
+// TestAccChartReleaseResource_unsupportedVersion tests that chart releases
+// are rejected at plan time on servers without the chart.release API
+func TestAccChartReleaseResource_unsupportedVersion(t *testing.T) {
+	server := testAccFakeServer(t)
+	server.SetVersion("TrueNAS-SCALE-24.10.1")
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_chart_release" "test" {
+  release_name = "plex"
+  catalog      = "TRUENAS"
+  train        = "charts"
+  item         = "plex"
+  version      = "1.0.0"
+}
+`,
+				ExpectError: regexp.MustCompile(`Unsupported TrueNAS Version`),
+			},
+		},
+	})
+}
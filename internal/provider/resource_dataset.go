@@ -5,17 +5,26 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework-validators/boolvalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
-
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/boolplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64default"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/objectplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
 	"github.com/hashicorp/terraform-plugin-framework/types"
 	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
 )
@@ -57,6 +66,56 @@ type DatasetResourceModel struct {
 	Copies     types.Int64  `tfsdk:"copies"`
 	RecordSize types.String `tfsdk:"recordsize"`
 	Volsize    types.Int64  `tfsdk:"volsize"` // Volume size in bytes (required for VOLUME type)
+
+	Encryption     *DatasetEncryptionModel `tfsdk:"encryption"`
+	Encrypted      types.Bool              `tfsdk:"encrypted"`
+	EncryptionRoot types.String            `tfsdk:"encryption_root"`
+	KeyFormat      types.String            `tfsdk:"key_format"`
+	Locked         types.Bool              `tfsdk:"locked"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
+}
+
+// DatasetEncryptionModel describes the encryption of a dataset that is an
+// encryption root
+type DatasetEncryptionModel struct {
+	Algorithm   types.String `tfsdk:"algorithm"`
+	Passphrase  types.String `tfsdk:"passphrase"`
+	Key         types.String `tfsdk:"key"`
+	GenerateKey types.Bool   `tfsdk:"generate_key"`
+	PBKDF2Iters types.Int64  `tfsdk:"pbkdf2iters"`
+}
+
+// options returns the key options of encryption_options and change_key
+func (m *DatasetEncryptionModel) options() map[string]interface{} {
+	options := map[string]interface{}{}
+	switch {
+	case !m.Passphrase.IsNull():
+		options["passphrase"] = m.Passphrase.ValueString()
+		options["pbkdf2iters"] = m.PBKDF2Iters.ValueInt64()
+	case !m.Key.IsNull():
+		options["key"] = m.Key.ValueString()
+	default:
+		options["generate_key"] = true
+	}
+	return options
+}
+
+// keyChanged reports whether the key material differs from the prior
+// encryption. Nothing is known of the key of an imported dataset, so it is
+// taken to be the configured one.
+func (m *DatasetEncryptionModel) keyChanged(prior *DatasetEncryptionModel) bool {
+	if prior.Passphrase.IsNull() && prior.Key.IsNull() && prior.GenerateKey.IsNull() {
+		return false
+	}
+	if !m.Passphrase.Equal(prior.Passphrase) || !m.Key.Equal(prior.Key) {
+		return true
+	}
+	if !m.Passphrase.IsNull() && !m.PBKDF2Iters.Equal(prior.PBKDF2Iters) {
+		return true
+	}
+	// Switching to a generated key; a generated key is kept otherwise
+	return m.GenerateKey.ValueBool() && !prior.GenerateKey.ValueBool()
 }
 
 func (r *DatasetResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
@@ -173,6 +232,100 @@ func (r *DatasetResource) Schema(ctx context.Context, req resource.SchemaRequest
 				Computed:            true,
 				Default:             booldefault.StaticBool(false),
 			},
+			"encryption": schema.SingleNestedAttribute{
+				MarkdownDescription: "Encrypt the dataset with its own key, making it an encryption root. Without this block, the dataset inherits the encryption of its parent. Adding or removing the block, or changing `algorithm`, replaces the dataset; a new key is applied in place with `/pool/dataset/change_key`.",
+				Optional:            true,
+				PlanModifiers: []planmodifier.Object{
+					objectplanmodifier.RequiresReplaceIf(
+						encryptionRequiresReplace,
+						"Encryption cannot be added to or removed from an existing dataset.",
+						"Encryption cannot be added to or removed from an existing dataset.",
+					),
+				},
+				Attributes: map[string]schema.Attribute{
+					"algorithm": schema.StringAttribute{
+						MarkdownDescription: "Encryption algorithm: AES-128-CCM, AES-192-CCM, AES-256-CCM, AES-128-GCM, AES-192-GCM or AES-256-GCM. Default: AES-256-GCM",
+						Optional:            true,
+						Computed:            true,
+						Default:             stringdefault.StaticString("AES-256-GCM"),
+						Validators: []validator.String{
+							stringvalidator.OneOf("AES-128-CCM", "AES-192-CCM", "AES-256-CCM", "AES-128-GCM", "AES-192-GCM", "AES-256-GCM"),
+						},
+						PlanModifiers: []planmodifier.String{
+							stringplanmodifier.RequiresReplace(),
+						},
+					},
+					"passphrase": schema.StringAttribute{
+						MarkdownDescription: "Passphrase the key is derived from, at least 8 characters. Exactly one of `passphrase`, `key` and `generate_key` must be set.",
+						Optional:            true,
+						Sensitive:           true,
+						Validators: []validator.String{
+							stringvalidator.LengthAtLeast(8),
+							stringvalidator.ExactlyOneOf(
+								path.MatchRelative().AtParent().AtName("key"),
+								path.MatchRelative().AtParent().AtName("generate_key"),
+							),
+						},
+					},
+					"key": schema.StringAttribute{
+						MarkdownDescription: "Raw key as 64 hexadecimal characters",
+						Optional:            true,
+						Sensitive:           true,
+						Validators: []validator.String{
+							stringvalidator.RegexMatches(regexp.MustCompile(`^[0-9a-fA-F]{64}$`), "must be 64 hexadecimal characters"),
+						},
+					},
+					"generate_key": schema.BoolAttribute{
+						MarkdownDescription: "Have TrueNAS generate a random key. Use the `truenas_dataset_encryption_keys` data source to back it up.",
+						Optional:            true,
+						Validators: []validator.Bool{
+							boolvalidator.Equals(true),
+						},
+					},
+					"pbkdf2iters": schema.Int64Attribute{
+						MarkdownDescription: "Number of PBKDF2 iterations to derive the key from `passphrase`, at least 100000. Default: 350000",
+						Optional:            true,
+						Computed:            true,
+						Default:             int64default.StaticInt64(350000),
+						Validators: []validator.Int64{
+							int64validator.AtLeast(100000),
+						},
+					},
+				},
+			},
+			"encrypted": schema.BoolAttribute{
+				MarkdownDescription: "Whether the dataset is encrypted, with its own key or one inherited from its encryption root",
+				Computed:            true,
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"encryption_root": schema.StringAttribute{
+				MarkdownDescription: "Dataset whose key encrypts this dataset, null when it is not encrypted",
+				Computed:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"key_format": schema.StringAttribute{
+				MarkdownDescription: "Format of the encryption key: HEX or PASSPHRASE. Null when the dataset is not encrypted.",
+				Computed:            true,
+			},
+			"locked": schema.BoolAttribute{
+				MarkdownDescription: "Whether the dataset is encrypted and its key is not loaded",
+				Computed:            true,
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.UseStateForUnknown(),
+				},
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
 		},
 	}
 }
@@ -203,9 +356,18 @@ func (r *DatasetResource) Create(ctx context.Context, req resource.CreateRequest
 		return
 	}
 
+	createTimeout, diags := data.Timeouts.Create(ctx, datasetTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
 	// Validate volsize based on dataset type
 	datasetType := "FILESYSTEM"
-	if !data.Type.IsNull() {
+	if !data.Type.IsNull() && !data.Type.IsUnknown() {
 		datasetType = data.Type.ValueString()
 	}
 
@@ -287,9 +449,17 @@ func (r *DatasetResource) Create(ctx context.Context, req resource.CreateRequest
 		}
 	}
 
-	respBody, err := r.client.Post("/pool/dataset", createReq)
+	if data.Encryption != nil {
+		options := data.Encryption.options()
+		options["algorithm"] = data.Encryption.Algorithm.ValueString()
+		createReq["encryption"] = true
+		createReq["inherit_encryption"] = false
+		createReq["encryption_options"] = options
+	}
+
+	respBody, err := r.client.PostJob(ctx, "/pool/dataset", createReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create dataset, got error: %s", err))
+		addClientError(&resp.Diagnostics, "create dataset", err, &data, datasetAPIFields)
 		return
 	}
 
@@ -302,7 +472,9 @@ func (r *DatasetResource) Create(ctx context.Context, req resource.CreateRequest
 	data.ID = types.StringValue(data.Name.ValueString())
 
 	// Read back the created dataset to get computed values
-	r.readDataset(ctx, &data, &resp.Diagnostics)
+	if !r.readDataset(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read dataset: it no longer exists")
+	}
 
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
@@ -315,25 +487,50 @@ func (r *DatasetResource) Read(ctx context.Context, req resource.ReadRequest, re
 		return
 	}
 
-	r.readDataset(ctx, &data, &resp.Diagnostics)
+	readTimeout, diags := data.Timeouts.Read(ctx, datasetTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	found := r.readDataset(ctx, &data, &resp.Diagnostics)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
+	if !found {
+		// Deleted outside of Terraform; drop it from state so it is re-created
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
 func (r *DatasetResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
-	var data DatasetResourceModel
+	var data, state DatasetResourceModel
 
 	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
+	updateTimeout, diags := data.Timeouts.Update(ctx, datasetTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
 	// Determine dataset type for conditional property updates
 	datasetType := "FILESYSTEM"
-	if !data.Type.IsNull() {
+	if !data.Type.IsNull() && !data.Type.IsUnknown() {
 		datasetType = data.Type.ValueString()
 	}
 
@@ -396,14 +593,24 @@ func (r *DatasetResource) Update(ctx context.Context, req resource.UpdateRequest
 	}
 
 	endpoint := fmt.Sprintf("/pool/dataset/id/%s", url.PathEscape(data.ID.ValueString()))
-	_, err := r.client.Put(endpoint, updateReq)
+	_, err := r.client.Put(ctx, endpoint, updateReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to update dataset, got error: %s", err))
+		addClientError(&resp.Diagnostics, "update dataset", err, &data, nil)
 		return
 	}
 
+	// The key of an encryption root is changed in place
+	if data.Encryption != nil && state.Encryption != nil && data.Encryption.keyChanged(state.Encryption) {
+		if _, err := r.client.PostJob(ctx, endpoint+"/change_key", data.Encryption.options()); err != nil {
+			addClientError(&resp.Diagnostics, "change dataset key", err, &data, changeKeyAPIFields)
+			return
+		}
+	}
+
 	// Read back the updated dataset
-	r.readDataset(ctx, &data, &resp.Diagnostics)
+	if !r.readDataset(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read dataset: it no longer exists")
+	}
 
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
@@ -416,6 +623,15 @@ func (r *DatasetResource) Delete(ctx context.Context, req resource.DeleteRequest
 		return
 	}
 
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, datasetTimeouts.Delete)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
 	datasetID := data.ID.ValueString()
 	endpoint := fmt.Sprintf("/pool/dataset/id/%s", url.PathEscape(datasetID))
 
@@ -429,7 +645,7 @@ func (r *DatasetResource) Delete(ctx context.Context, req resource.DeleteRequest
 	}
 
 	// First attempt deletion via API
-	_, err := r.client.DeleteWithBody(endpoint, deleteReq)
+	_, err := r.client.DeleteJob(ctx, endpoint, deleteReq)
 	if err != nil {
 		// If force_destroy is set, attempt snapshot cleanup and retry once
 		if force {
@@ -439,7 +655,7 @@ func (r *DatasetResource) Delete(ctx context.Context, req resource.DeleteRequest
 			}
 
 			// Retry deletion after cleaning up snapshots
-			if _, err2 := r.client.DeleteWithBody(endpoint, deleteReq); err2 != nil {
+			if _, err2 := r.client.DeleteJob(ctx, endpoint, deleteReq); err2 != nil {
 				resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete dataset after snapshot cleanup, got error: %s", err2))
 				return
 			}
@@ -455,7 +671,7 @@ func (r *DatasetResource) Delete(ctx context.Context, req resource.DeleteRequest
 
 // deleteSnapshots removes all snapshots belonging to the provided datasetID (matching prefix "<dataset>@").
 func (r *DatasetResource) deleteSnapshots(ctx context.Context, datasetID string, diags *diag.Diagnostics) error {
-	respBody, err := r.client.Get("/zfs/snapshot")
+	respBody, err := r.client.Get(ctx, "/zfs/snapshot")
 	if err != nil {
 		return fmt.Errorf("list snapshots: %w", err)
 	}
@@ -479,7 +695,7 @@ func (r *DatasetResource) deleteSnapshots(ctx context.Context, datasetID string,
 		}
 
 		endpoint := fmt.Sprintf("/zfs/snapshot/id/%s", url.PathEscape(id))
-		if _, err := r.client.DeleteWithBody(endpoint, map[string]bool{"defer": false, "recursive": false}); err != nil {
+		if _, err := r.client.DeleteWithBody(ctx, endpoint, map[string]bool{"defer": false, "recursive": false}); err != nil {
 			return fmt.Errorf("delete snapshot %s: %w", id, err)
 		}
 	}
@@ -490,21 +706,30 @@ func (r *DatasetResource) ImportState(ctx context.Context, req resource.ImportSt
 	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
 }
 
-// Helper function to read dataset data from the API
-func (r *DatasetResource) readDataset(ctx context.Context, data *DatasetResourceModel, diags *diag.Diagnostics) {
+// readDataset refreshes data from the API. It returns false, without adding a
+// diagnostic, when the dataset no longer exists.
+func (r *DatasetResource) readDataset(ctx context.Context, data *DatasetResourceModel, diags *diag.Diagnostics) bool {
 	endpoint := fmt.Sprintf("/pool/dataset/id/%s", url.PathEscape(data.ID.ValueString()))
-	respBody, err := r.client.Get(endpoint)
+	respBody, err := r.client.Get(ctx, endpoint)
 	if err != nil {
+		if truenas.IsNotFound(err) {
+			return false
+		}
 		diags.AddError("Client Error", fmt.Sprintf("Unable to read dataset, got error: %s", err))
-		return
+		return false
 	}
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(respBody, &result); err != nil {
 		diags.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
-		return
+		return false
 	}
 
+	// Only the ID is set when the dataset is being imported
+	importing := data.Name.IsNull()
+
+	readDatasetEncryption(result, data, importing)
+
 	// Update the model with values from the API
 	if name, ok := result["name"].(string); ok {
 		data.Name = types.StringValue(name)
@@ -697,4 +922,90 @@ func (r *DatasetResource) readDataset(ctx context.Context, data *DatasetResource
 		// Set VOLUME-only properties to null for FILESYSTEM datasets
 		data.Volsize = types.Int64Null()
 	}
+
+	return true
+}
+
+// datasetAPIFields maps the encryption fields of dataset validation errors
+// to the encryption block
+var datasetAPIFields = map[string]path.Path{
+	"encryption_options": path.Root("encryption"),
+}
+
+// changeKeyAPIFields maps the fields of change_key validation errors to the
+// encryption block
+var changeKeyAPIFields = map[string]path.Path{
+	"generate_key": path.Root("encryption").AtName("generate_key"),
+	"passphrase":   path.Root("encryption").AtName("passphrase"),
+	"key":          path.Root("encryption").AtName("key"),
+	"pbkdf2iters":  path.Root("encryption").AtName("pbkdf2iters"),
+}
+
+// readDatasetEncryption sets the encryption attributes from the API
+// response. The key material is never returned, so the encryption block
+// keeps its configured values; on import it is filled in for encryption
+// roots without them.
+func readDatasetEncryption(result map[string]interface{}, data *DatasetResourceModel, importing bool) {
+	encrypted, _ := result["encrypted"].(bool)
+	data.Encrypted = types.BoolValue(encrypted)
+	locked, _ := result["locked"].(bool)
+	data.Locked = types.BoolValue(locked)
+
+	if root, ok := result["encryption_root"].(string); ok && encrypted {
+		data.EncryptionRoot = types.StringValue(root)
+	} else {
+		data.EncryptionRoot = types.StringNull()
+	}
+
+	keyFormat := datasetPropertyValue(result, "key_format")
+	if encrypted && keyFormat != "" {
+		data.KeyFormat = types.StringValue(keyFormat)
+	} else {
+		data.KeyFormat = types.StringNull()
+	}
+
+	name, _ := result["name"].(string)
+	isRoot := encrypted && data.EncryptionRoot.ValueString() == name
+	if importing && isRoot {
+		data.Encryption = &DatasetEncryptionModel{
+			Passphrase:  types.StringNull(),
+			Key:         types.StringNull(),
+			GenerateKey: types.BoolNull(),
+			PBKDF2Iters: types.Int64Value(350000),
+		}
+	}
+	if data.Encryption == nil || !isRoot {
+		return
+	}
+
+	if algorithm := datasetPropertyValue(result, "encryption_algorithm"); algorithm != "" {
+		data.Encryption.Algorithm = types.StringValue(algorithm)
+	}
+	if keyFormat == "PASSPHRASE" {
+		if iters, ok := result["pbkdf2iters"].(map[string]interface{}); ok {
+			if parsed, ok := iters["parsed"].(float64); ok {
+				data.Encryption.PBKDF2Iters = types.Int64Value(int64(parsed))
+			}
+		}
+	}
+}
+
+// encryptionRequiresReplace replaces a dataset when the encryption block is
+// added or removed, as ZFS cannot encrypt or decrypt an existing dataset
+func encryptionRequiresReplace(ctx context.Context, req planmodifier.ObjectRequest, resp *objectplanmodifier.RequiresReplaceIfFuncResponse) {
+	if req.PlanValue.IsUnknown() {
+		return
+	}
+	resp.RequiresReplace = req.PlanValue.IsNull() != req.StateValue.IsNull()
+}
+
+// datasetPropertyValue returns the value of a ZFS property of a dataset, or
+// "" when it is unset
+func datasetPropertyValue(result map[string]interface{}, name string) string {
+	property, ok := result[name].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	value, _ := property["value"].(string)
+	return value
 }
@@ -0,0 +1,402 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/terraform"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas/fake"
+)
+
+// TestAccDatasetResource tests creating, importing, updating and deleting a dataset
+func TestAccDatasetResource(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "pool/dataset", "truenas_dataset"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset" "test" {
+  name        = "tank/apps"
+  compression = "ZSTD"
+  comments    = "Managed by Terraform"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_dataset.test", "id", "tank/apps"),
+					resource.TestCheckResourceAttr("truenas_dataset.test", "type", "FILESYSTEM"),
+					resource.TestCheckResourceAttr("truenas_dataset.test", "compression", "ZSTD"),
+					resource.TestCheckResourceAttr("truenas_dataset.test", "comments", "Managed by Terraform"),
+					resource.TestCheckResourceAttr("truenas_dataset.test", "atime", "ON"),
+					resource.TestCheckResourceAttr("truenas_dataset.test", "copies", "1"),
+					resource.TestCheckNoResourceAttr("truenas_dataset.test", "quota"),
+				),
+			},
+			{
+				ResourceName:            "truenas_dataset.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"force_destroy", "recursive_destroy", "timeouts"},
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset" "test" {
+  name        = "tank/apps"
+  compression = "LZ4"
+  comments    = "Managed by Terraform"
+  quota       = 10737418240
+  atime       = "OFF"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_dataset.test", "compression", "LZ4"),
+					resource.TestCheckResourceAttr("truenas_dataset.test", "quota", "10737418240"),
+					resource.TestCheckResourceAttr("truenas_dataset.test", "atime", "OFF"),
+				),
+			},
+		},
+	})
+}
+
+// TestAccDatasetResource_volume tests a zvol
+func TestAccDatasetResource_volume(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "pool/dataset", "truenas_dataset"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset" "test" {
+  name    = "tank/vm-disk"
+  type    = "VOLUME"
+  volsize = 10737418240
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_dataset.test", "type", "VOLUME"),
+					resource.TestCheckResourceAttr("truenas_dataset.test", "volsize", "10737418240"),
+					resource.TestCheckNoResourceAttr("truenas_dataset.test", "atime"),
+				),
+			},
+		},
+	})
+}
+
+// TestAccDatasetResource_forceDestroy tests that force_destroy removes snapshots
+// that would otherwise block deletion
+func TestAccDatasetResource_forceDestroy(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	config := testAccProviderConfig(server) + `
+resource "truenas_dataset" "test" {
+  name          = "tank/scratch"
+  force_destroy = true
+}
+`
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "pool/dataset", "truenas_dataset"),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+			},
+			{
+				PreConfig: func() {
+					if _, err := server.Create("zfs/snapshot", map[string]interface{}{"dataset": "tank/scratch", "name": "manual"}); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config:  config,
+				Destroy: true,
+			},
+		},
+	})
+}
+
+// TestAccDatasetResource_validationError tests that API validation errors are reported
+func TestAccDatasetResource_validationError(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset" "test" {
+  name = "tank/missing/child"
+}
+`,
+				ExpectError: regexp.MustCompile(`Parent dataset tank/missing does not exist`),
+			},
+		},
+	})
+}
+
+// TestAccDatasetResource_disappears tests that a dataset deleted outside
+// Terraform is re-created
+func TestAccDatasetResource_disappears(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	config := testAccProviderConfig(server) + `
+resource "truenas_dataset" "test" {
+  name = "tank/apps"
+}
+`
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+			},
+			{
+				PreConfig: testAccDeleteOutOfBand(t, server, "pool/dataset", "tank/apps"),
+				Config:    config,
+				Check:     testAccCheckExists(server, "pool/dataset", "truenas_dataset.test"),
+			},
+		},
+	})
+}
+
+// TestAccDatasetResource_encryption tests an encryption root with a child
+// that inherits its key, importing it, and changing its key in place
+func TestAccDatasetResource_encryption(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "pool/dataset", "truenas_dataset"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset" "secure" {
+  name = "tank/secure"
+  encryption = {
+    passphrase = "correct horse battery"
+  }
+}
+
+resource "truenas_dataset" "child" {
+  name = "${truenas_dataset.secure.name}/child"
+}
+
+resource "truenas_dataset" "plain" {
+  name = "tank/plain"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_dataset.secure", "encrypted", "true"),
+					resource.TestCheckResourceAttr("truenas_dataset.secure", "encryption_root", "tank/secure"),
+					resource.TestCheckResourceAttr("truenas_dataset.secure", "key_format", "PASSPHRASE"),
+					resource.TestCheckResourceAttr("truenas_dataset.secure", "locked", "false"),
+					resource.TestCheckResourceAttr("truenas_dataset.secure", "encryption.algorithm", "AES-256-GCM"),
+					resource.TestCheckResourceAttr("truenas_dataset.secure", "encryption.pbkdf2iters", "350000"),
+					resource.TestCheckResourceAttr("truenas_dataset.child", "encrypted", "true"),
+					resource.TestCheckResourceAttr("truenas_dataset.child", "encryption_root", "tank/secure"),
+					resource.TestCheckNoResourceAttr("truenas_dataset.child", "encryption.algorithm"),
+					resource.TestCheckResourceAttr("truenas_dataset.plain", "encrypted", "false"),
+					resource.TestCheckNoResourceAttr("truenas_dataset.plain", "encryption_root"),
+					resource.TestCheckNoResourceAttr("truenas_dataset.plain", "key_format"),
+				),
+			},
+			{
+				ResourceName:            "truenas_dataset.secure",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"force_destroy", "recursive_destroy", "timeouts", "encryption.passphrase"},
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset" "secure" {
+  name = "tank/secure"
+  encryption = {
+    key = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+  }
+}
+
+resource "truenas_dataset" "child" {
+  name = "${truenas_dataset.secure.name}/child"
+}
+
+resource "truenas_dataset" "plain" {
+  name = "tank/plain"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_dataset.secure", "key_format", "HEX"),
+					resource.TestCheckResourceAttr("truenas_dataset.child", "encryption_root", "tank/secure"),
+					testAccCheckDatasetKeyChanged(server),
+				),
+			},
+		},
+	})
+}
+
+// TestAccDatasetResource_encryptionKeys tests exporting the keys of a pool,
+// of an encryption root and of the sources of a replication task
+func TestAccDatasetResource_encryptionKeys(t *testing.T) {
+	server := testAccFakeServer(t)
+	key := strings.Repeat("0f", 32)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + fmt.Sprintf(`
+resource "truenas_dataset" "hex" {
+  name = "tank/hex"
+  encryption = {
+    key = %[1]q
+  }
+}
+
+resource "truenas_dataset" "generated" {
+  name = "tank/generated"
+  encryption = {
+    generate_key = true
+  }
+}
+
+resource "truenas_dataset" "secure" {
+  name = "tank/secure"
+  encryption = {
+    passphrase = "correct horse battery"
+  }
+}
+
+data "truenas_dataset_encryption_keys" "pool" {
+  dataset_id = "tank"
+  depends_on = [truenas_dataset.hex, truenas_dataset.generated, truenas_dataset.secure]
+}
+
+data "truenas_dataset_encryption_keys" "hex" {
+  dataset_id = truenas_dataset.hex.id
+  recursive  = false
+}
+`, key),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("data.truenas_dataset_encryption_keys.pool", "id", "tank"),
+					resource.TestCheckResourceAttr("data.truenas_dataset_encryption_keys.pool", "keys.%", "2"),
+					resource.TestCheckResourceAttr("data.truenas_dataset_encryption_keys.pool", "keys.tank/hex", key),
+					resource.TestMatchResourceAttr("data.truenas_dataset_encryption_keys.pool", "keys.tank/generated", regexp.MustCompile(`^[0-9a-f]{64}$`)),
+					resource.TestCheckResourceAttr("data.truenas_dataset_encryption_keys.hex", "keys.%", "1"),
+					resource.TestCheckResourceAttr("data.truenas_dataset_encryption_keys.hex", "keys.tank/hex", key),
+				),
+			},
+			{
+				PreConfig: func() {
+					_, err := server.Create("replication", map[string]interface{}{
+						"name":            "offsite",
+						"source_datasets": []interface{}{"tank/hex"},
+						"target_dataset":  "backup/hex",
+					})
+					if err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: testAccProviderConfig(server) + fmt.Sprintf(`
+resource "truenas_dataset" "hex" {
+  name = "tank/hex"
+  encryption = {
+    key = %[1]q
+  }
+}
+
+data "truenas_dataset_encryption_keys" "replication" {
+  replication_task_id = 1
+  depends_on          = [truenas_dataset.hex]
+}
+
+data "truenas_dataset_encryption_keys" "passphrase" {
+  dataset_id = "tank/secure"
+  recursive  = false
+}
+`, key),
+				ExpectError: regexp.MustCompile(`with a passphrase, which cannot be`),
+			},
+			{
+				Config: testAccProviderConfig(server) + fmt.Sprintf(`
+resource "truenas_dataset" "hex" {
+  name = "tank/hex"
+  encryption = {
+    key = %[1]q
+  }
+}
+
+data "truenas_dataset_encryption_keys" "replication" {
+  replication_task_id = 1
+  depends_on          = [truenas_dataset.hex]
+}
+`, key),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("data.truenas_dataset_encryption_keys.replication", "id", "replication/1"),
+					resource.TestCheckResourceAttr("data.truenas_dataset_encryption_keys.replication", "keys.%", "1"),
+					resource.TestCheckResourceAttr("data.truenas_dataset_encryption_keys.replication", "keys.tank/hex", key),
+				),
+			},
+		},
+	})
+}
+
+// TestAccDatasetResource_encryptionValidation tests that invalid key
+// material is rejected at plan time
+func TestAccDatasetResource_encryptionValidation(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset" "test" {
+  name = "tank/secure"
+  encryption = {
+    key = "not-hex"
+  }
+}
+`,
+				ExpectError: regexp.MustCompile(`must be 64 hexadecimal characters`),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset" "test" {
+  name = "tank/secure"
+  encryption = {
+    passphrase   = "correct horse battery"
+    generate_key = true
+  }
+}
+`,
+				ExpectError: regexp.MustCompile(`Invalid Attribute Combination`),
+			},
+		},
+	})
+}
+
+// testAccCheckDatasetKeyChanged verifies that the key of a dataset was
+// changed in place rather than by replacing it
+func testAccCheckDatasetKeyChanged(server *fake.Server) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		changed := false
+		for _, request := range server.Requests() {
+			if request.Method == "DELETE" && strings.HasPrefix(request.Path, "/pool/dataset/") {
+				return fmt.Errorf("the dataset was replaced: %s %s", request.Method, request.Path)
+			}
+			if request.Method == "POST" && strings.HasSuffix(request.Path, "/change_key") {
+				changed = true
+			}
+		}
+		if !changed {
+			return fmt.Errorf("the key of the dataset was not changed")
+		}
+		return nil
+	}
+}
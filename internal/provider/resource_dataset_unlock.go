@@ -0,0 +1,416 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+)
+
+var _ resource.Resource = &DatasetUnlockResource{}
+var _ resource.ResourceWithImportState = &DatasetUnlockResource{}
+var _ resource.ResourceWithModifyPlan = &DatasetUnlockResource{}
+
+func NewDatasetUnlockResource() resource.Resource {
+	return &DatasetUnlockResource{}
+}
+
+type DatasetUnlockResource struct {
+	client *truenas.Client
+}
+
+type DatasetUnlockResourceModel struct {
+	ID              types.String `tfsdk:"id"`
+	DatasetID       types.String `tfsdk:"dataset_id"`
+	Passphrase      types.String `tfsdk:"passphrase"`
+	Key             types.String `tfsdk:"key"`
+	Recursive       types.Bool   `tfsdk:"recursive"`
+	ServicesRestart types.Set    `tfsdk:"services_restart"`
+	LockOnDestroy   types.Bool   `tfsdk:"lock_on_destroy"`
+	Locked          types.Bool   `tfsdk:"locked"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
+}
+
+func (r *DatasetUnlockResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_dataset_unlock"
+}
+
+func (r *DatasetUnlockResource) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Keeps an encrypted dataset unlocked. Datasets encrypted with a passphrase are locked again when TrueNAS reboots; the next apply unlocks them with `/pool/dataset/unlock`, so that shares and apps depending on this resource find them unlocked.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "ID of the dataset (same as `dataset_id`)",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"dataset_id": schema.StringAttribute{
+				MarkdownDescription: "ID of the encryption root to unlock, e.g. `tank/secure`",
+				Required:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"passphrase": schema.StringAttribute{
+				MarkdownDescription: "Passphrase of the dataset",
+				Optional:            true,
+				Sensitive:           true,
+				Validators: []validator.String{
+					stringvalidator.ConflictsWith(path.MatchRoot("key")),
+				},
+			},
+			"key": schema.StringAttribute{
+				MarkdownDescription: "Hex key of the dataset. Without `passphrase` or `key`, the key stored by TrueNAS is used.",
+				Optional:            true,
+				Sensitive:           true,
+			},
+			"recursive": schema.BoolAttribute{
+				MarkdownDescription: "Also unlock the locked encryption roots below the dataset, with the keys stored by TrueNAS",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(false),
+			},
+			"services_restart": schema.SetAttribute{
+				MarkdownDescription: "Services to restart after unlocking, such as `cifs`, `nfs` or `vms`. The valid choices come from `/pool/dataset/unlock_services_restart_choices`.",
+				Optional:            true,
+				ElementType:         types.StringType,
+			},
+			"lock_on_destroy": schema.BoolAttribute{
+				MarkdownDescription: "Lock the dataset with `/pool/dataset/lock` when the resource is destroyed. Only datasets encrypted with a passphrase can be locked.",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(false),
+			},
+			"locked": schema.BoolAttribute{
+				MarkdownDescription: "Whether the dataset is locked. A dataset found locked, e.g. after a reboot, is unlocked by the next apply.",
+				Computed:            true,
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
+	}
+}
+
+func (r *DatasetUnlockResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*truenas.Client)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *truenas.Client, got: %T.", req.ProviderData),
+		)
+		return
+	}
+
+	r.client = client
+}
+
+// ModifyPlan plans the dataset to be unlocked, so that a dataset found
+// locked by the refresh shows up as a change that unlocks it
+func (r *DatasetUnlockResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	if req.Plan.Raw.IsNull() {
+		return
+	}
+	resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("locked"), false)...)
+}
+
+func (r *DatasetUnlockResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data DatasetUnlockResourceModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	createTimeout, diags := data.Timeouts.Create(ctx, datasetTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
+	data.ID = data.DatasetID
+	r.ensureUnlocked(ctx, &data, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *DatasetUnlockResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data DatasetUnlockResourceModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	readTimeout, diags := data.Timeouts.Read(ctx, datasetTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	locked, found := r.readLocked(ctx, data.ID.ValueString(), &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !found {
+		// The dataset was deleted outside of Terraform
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
+	data.DatasetID = data.ID
+	data.Locked = types.BoolValue(locked)
+	if data.Recursive.IsNull() {
+		data.Recursive = types.BoolValue(false)
+	}
+	if data.LockOnDestroy.IsNull() {
+		data.LockOnDestroy = types.BoolValue(false)
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *DatasetUnlockResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var data DatasetUnlockResourceModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	updateTimeout, diags := data.Timeouts.Update(ctx, datasetTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	// The key and options only matter for the next unlock
+	r.ensureUnlocked(ctx, &data, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *DatasetUnlockResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data DatasetUnlockResourceModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !data.LockOnDestroy.ValueBool() {
+		return
+	}
+
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, datasetTimeouts.Delete)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
+	locked, found := r.readLocked(ctx, data.ID.ValueString(), &resp.Diagnostics)
+	if resp.Diagnostics.HasError() || !found || locked {
+		return
+	}
+
+	if _, err := r.client.LockDataset(ctx, data.ID.ValueString(), false); err != nil && !truenas.IsNotFound(err) {
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to lock dataset %s, got error: %s", data.ID.ValueString(), err))
+	}
+}
+
+func (r *DatasetUnlockResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+// readLocked returns whether a dataset is locked. found is false, without a
+// diagnostic, when the dataset does not exist.
+func (r *DatasetUnlockResource) readLocked(ctx context.Context, id string, diags *diag.Diagnostics) (locked, found bool) {
+	respBody, err := r.client.Get(ctx, fmt.Sprintf("/pool/dataset/id/%s", url.PathEscape(id)))
+	if err != nil {
+		if truenas.IsNotFound(err) {
+			return false, false
+		}
+		diags.AddError("Client Error", fmt.Sprintf("Unable to read dataset %s, got error: %s", id, err))
+		return false, false
+	}
+
+	var result struct {
+		Locked bool `json:"locked"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		diags.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
+		return false, false
+	}
+	return result.Locked, true
+}
+
+// ensureUnlocked unlocks the dataset if it is locked and sets locked
+func (r *DatasetUnlockResource) ensureUnlocked(ctx context.Context, data *DatasetUnlockResourceModel, diags *diag.Diagnostics) {
+	id := data.ID.ValueString()
+
+	locked, found := r.readLocked(ctx, id, diags)
+	if diags.HasError() {
+		return
+	}
+	if !found {
+		diags.AddAttributeError(path.Root("dataset_id"), "Dataset Not Found", fmt.Sprintf("Dataset %s does not exist.", id))
+		return
+	}
+
+	if locked {
+		r.unlock(ctx, data, diags)
+		if diags.HasError() {
+			return
+		}
+		locked, _ = r.readLocked(ctx, id, diags)
+	}
+	data.Locked = types.BoolValue(locked)
+}
+
+// unlock unlocks the dataset with /pool/dataset/unlock. Failing to unlock
+// the dataset itself is an error; failing to unlock encryption roots below
+// it with recursive is a warning.
+func (r *DatasetUnlockResource) unlock(ctx context.Context, data *DatasetUnlockResourceModel, diags *diag.Diagnostics) {
+	id := data.ID.ValueString()
+
+	var services []string
+	if !data.ServicesRestart.IsNull() && !data.ServicesRestart.IsUnknown() {
+		diags.Append(data.ServicesRestart.ElementsAs(ctx, &services, false)...)
+		if diags.HasError() {
+			return
+		}
+	}
+	if len(services) > 0 && !r.checkServicesRestart(ctx, id, services, diags) {
+		return
+	}
+
+	entry := map[string]interface{}{"name": id}
+	if !data.Passphrase.IsNull() {
+		entry["passphrase"] = data.Passphrase.ValueString()
+	}
+	if !data.Key.IsNull() {
+		entry["key"] = data.Key.ValueString()
+	}
+	datasets := []interface{}{}
+	if len(entry) > 1 {
+		datasets = append(datasets, entry)
+	}
+
+	respBody, err := r.client.UnlockDataset(ctx, id, map[string]interface{}{
+		"recursive":        data.Recursive.ValueBool(),
+		"services_restart": append([]string{}, services...),
+		"datasets":         datasets,
+	})
+	if err != nil {
+		addClientError(diags, "unlock dataset", err, data, nil)
+		return
+	}
+
+	var result struct {
+		Unlocked []string `json:"unlocked"`
+		Failed   map[string]struct {
+			Error string `json:"error"`
+		} `json:"failed"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		diags.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
+		return
+	}
+
+	if failure, ok := result.Failed[id]; ok {
+		diags.AddError("Unlock Failed", fmt.Sprintf("Unable to unlock dataset %s: %s", id, failure.Error))
+		return
+	}
+	if len(result.Failed) > 0 {
+		var failed []string
+		for name, failure := range result.Failed {
+			failed = append(failed, fmt.Sprintf("%s: %s", name, failure.Error))
+		}
+		sort.Strings(failed)
+		diags.AddWarning(
+			"Datasets Not Unlocked",
+			fmt.Sprintf("Dataset %s was unlocked, but these encryption roots below it were not:\n%s", id, strings.Join(failed, "\n")),
+		)
+	}
+}
+
+// checkServicesRestart reports services that TrueNAS cannot restart when
+// unlocking the dataset on services_restart
+func (r *DatasetUnlockResource) checkServicesRestart(ctx context.Context, id string, services []string, diags *diag.Diagnostics) bool {
+	respBody, err := r.client.GetDatasetUnlockServicesRestartChoices(ctx, id)
+	if err != nil {
+		diags.AddError("Client Error", fmt.Sprintf("Unable to read the services to restart for dataset %s, got error: %s", id, err))
+		return false
+	}
+
+	var choices map[string]string
+	if err := json.Unmarshal(respBody, &choices); err != nil {
+		diags.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
+		return false
+	}
+
+	valid := make([]string, 0, len(choices))
+	for choice := range choices {
+		valid = append(valid, choice)
+	}
+	sort.Strings(valid)
+
+	ok := true
+	for _, service := range services {
+		if _, found := choices[service]; !found {
+			diags.AddAttributeError(
+				path.Root("services_restart"),
+				"Invalid Attribute Value",
+				fmt.Sprintf("%q cannot be restarted when unlocking dataset %s. Valid choices: %s", service, id, strings.Join(valid, ", ")),
+			)
+			ok = false
+		}
+	}
+	return ok
+}
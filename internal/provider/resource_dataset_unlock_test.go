@@ -0,0 +1,171 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/terraform"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas/fake"
+)
+
+// testAccEncryptedDataset creates tank/secure, encrypted with a passphrase,
+// outside of Terraform
+func testAccEncryptedDataset(t *testing.T, server *fake.Server) {
+	_, err := server.Create("pool/dataset", map[string]interface{}{
+		"name":               "tank/secure",
+		"encryption":         true,
+		"inherit_encryption": false,
+		"encryption_options": map[string]interface{}{"passphrase": "correct horse battery"},
+	})
+	if err != nil {
+		t.Fatalf("creating tank/secure: %s", err)
+	}
+}
+
+// TestAccDatasetUnlockResource tests that a dataset locked by a reboot is
+// unlocked by the next apply, and locked again on destroy
+func TestAccDatasetUnlockResource(t *testing.T) {
+	server := testAccFakeServer(t)
+	testAccEncryptedDataset(t, server)
+
+	config := testAccProviderConfig(server) + `
+resource "truenas_dataset_unlock" "secure" {
+  dataset_id       = "tank/secure"
+  passphrase       = "correct horse battery"
+  services_restart = ["cifs", "nfs"]
+  lock_on_destroy  = true
+}
+
+data "truenas_dataset_encryption_summary" "secure" {
+  dataset_id = truenas_dataset_unlock.secure.dataset_id
+  passphrase = "correct horse battery"
+}
+`
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDatasetLocked(server, "tank/secure", true),
+		Steps: []resource.TestStep{
+			{
+				PreConfig: func() {
+					if err := server.LockDataset("tank/secure"); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: config,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_dataset_unlock.secure", "id", "tank/secure"),
+					resource.TestCheckResourceAttr("truenas_dataset_unlock.secure", "locked", "false"),
+					testAccCheckDatasetLocked(server, "tank/secure", false),
+					resource.TestCheckResourceAttr("data.truenas_dataset_encryption_summary.secure", "datasets.#", "1"),
+					resource.TestCheckResourceAttr("data.truenas_dataset_encryption_summary.secure", "datasets.0.name", "tank/secure"),
+					resource.TestCheckResourceAttr("data.truenas_dataset_encryption_summary.secure", "datasets.0.key_format", "PASSPHRASE"),
+					resource.TestCheckResourceAttr("data.truenas_dataset_encryption_summary.secure", "datasets.0.valid_key", "true"),
+					resource.TestCheckResourceAttr("data.truenas_dataset_encryption_summary.secure", "datasets.0.locked", "false"),
+					resource.TestCheckNoResourceAttr("data.truenas_dataset_encryption_summary.secure", "datasets.0.unlock_error"),
+				),
+			},
+			{
+				// A reboot locks the dataset again
+				PreConfig: func() {
+					if err := server.LockDataset("tank/secure"); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: config,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_dataset_unlock.secure", "locked", "false"),
+					testAccCheckDatasetLocked(server, "tank/secure", false),
+					testAccCheckDatasetUnlockRequests(server, 2),
+				),
+			},
+			{
+				ResourceName:            "truenas_dataset_unlock.secure",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"passphrase", "services_restart", "lock_on_destroy", "timeouts"},
+			},
+		},
+	})
+}
+
+// TestAccDatasetUnlockResource_errors tests that a wrong passphrase and
+// services that cannot be restarted fail the unlock
+func TestAccDatasetUnlockResource_errors(t *testing.T) {
+	server := testAccFakeServer(t)
+	testAccEncryptedDataset(t, server)
+	if err := server.LockDataset("tank/secure"); err != nil {
+		t.Fatal(err)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset_unlock" "secure" {
+  dataset_id = "tank/secure"
+  passphrase = "wrong passphrase"
+}
+`,
+				ExpectError: regexp.MustCompile(`Unable to unlock dataset tank/secure: Invalid Key`),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset_unlock" "secure" {
+  dataset_id       = "tank/secure"
+  passphrase       = "correct horse battery"
+  services_restart = ["docker"]
+}
+`,
+				ExpectError: regexp.MustCompile(`"docker" cannot be restarted`),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+data "truenas_dataset_encryption_summary" "secure" {
+  dataset_id = "tank/secure"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("data.truenas_dataset_encryption_summary.secure", "datasets.0.locked", "true"),
+					resource.TestCheckResourceAttr("data.truenas_dataset_encryption_summary.secure", "datasets.0.valid_key", "false"),
+					resource.TestCheckResourceAttr("data.truenas_dataset_encryption_summary.secure", "datasets.0.unlock_error", "Passphrase not provided"),
+				),
+			},
+		},
+	})
+}
+
+// testAccCheckDatasetLocked verifies whether a dataset is locked on the
+// fake server
+func testAccCheckDatasetLocked(server *fake.Server, name string, want bool) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		dataset, ok := server.Object("pool/dataset", name)
+		if !ok {
+			return fmt.Errorf("dataset %s does not exist", name)
+		}
+		if locked, _ := dataset["locked"].(bool); locked != want {
+			return fmt.Errorf("dataset %s: locked is %t, want %t", name, locked, want)
+		}
+		return nil
+	}
+}
+
+// testAccCheckDatasetUnlockRequests verifies the number of unlock calls
+func testAccCheckDatasetUnlockRequests(server *fake.Server, want int) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		count := 0
+		for _, request := range server.Requests() {
+			if request.Method == "POST" && strings.HasSuffix(request.Path, "/unlock") {
+				count++
+			}
+		}
+		if count != want {
+			return fmt.Errorf("the dataset was unlocked %d times, want %d", count, want)
+		}
+		return nil
+	}
+}
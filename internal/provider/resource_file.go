@@ -0,0 +1,550 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+)
+
+// fileModePattern matches octal permissions such as 644 or 0755
+var fileModePattern = regexp.MustCompile(`^0?[0-7]{3}$`)
+
+var _ resource.Resource = &FileResource{}
+var _ resource.ResourceWithModifyPlan = &FileResource{}
+var _ resource.ResourceWithImportState = &FileResource{}
+
+func NewFileResource() resource.Resource {
+	return &FileResource{}
+}
+
+type FileResource struct {
+	client *truenas.Client
+}
+
+type FileResourceModel struct {
+	ID          types.String `tfsdk:"id"`
+	Destination types.String `tfsdk:"destination"`
+	Source      types.String `tfsdk:"source"`
+	Content     types.String `tfsdk:"content"`
+	Mode        types.String `tfsdk:"mode"`
+	Owner       types.String `tfsdk:"owner"`
+	Group       types.String `tfsdk:"group"`
+	SHA256      types.String `tfsdk:"sha256"`
+	Size        types.Int64  `tfsdk:"size"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
+}
+
+func (r *FileResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_file"
+}
+
+func (r *FileResource) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Uploads a file to the TrueNAS system, such as an installer ISO, a script or a configuration file. The content is streamed from a local file or set inline, and uploads interrupted by a transient failure resume where they stopped.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Path of the file on the TrueNAS system",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"destination": schema.StringAttribute{
+				MarkdownDescription: "Absolute path of the file on the TrueNAS system, under `/mnt` (e.g. `/mnt/tank/isos/debian.iso`). Its directory must exist.",
+				Required:            true,
+				Validators: []validator.String{
+					stringvalidator.RegexMatches(regexp.MustCompile(`^/mnt/[^/]+/.+[^/]$`), "must be the path of a file under /mnt/<pool>/"),
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"source": schema.StringAttribute{
+				MarkdownDescription: "Path of a file on the machine running Terraform to upload. Exactly one of `source` and `content` must be set.",
+				Optional:            true,
+				Validators: []validator.String{
+					stringvalidator.ExactlyOneOf(path.MatchRoot("source"), path.MatchRoot("content")),
+					stringvalidator.LengthAtLeast(1),
+				},
+			},
+			"content": schema.StringAttribute{
+				MarkdownDescription: "Content of the file, for small text files such as scripts and configuration files",
+				Optional:            true,
+			},
+			"mode": schema.StringAttribute{
+				MarkdownDescription: "Permissions of the file in octal notation (e.g. `0644`). Defaults to the permissions the file is created with, usually `0644`.",
+				Optional:            true,
+				Computed:            true,
+				Validators: []validator.String{
+					stringvalidator.RegexMatches(fileModePattern, "must be octal permissions such as 0644"),
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"owner": schema.StringAttribute{
+				MarkdownDescription: "Name or UID of the user owning the file. Defaults to `root`.",
+				Optional:            true,
+				Computed:            true,
+				Validators: []validator.String{
+					stringvalidator.LengthAtLeast(1),
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"group": schema.StringAttribute{
+				MarkdownDescription: "Name or GID of the group owning the file. Defaults to `root`.",
+				Optional:            true,
+				Computed:            true,
+				Validators: []validator.String{
+					stringvalidator.LengthAtLeast(1),
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"sha256": schema.StringAttribute{
+				MarkdownDescription: "Hex encoded SHA-256 checksum of the content, computed from `source` or `content` at plan time. A change uploads the file again in place.",
+				Computed:            true,
+			},
+			"size": schema.Int64Attribute{
+				MarkdownDescription: "Size of the file in bytes. A file whose size changed outside of Terraform is uploaded again.",
+				Computed:            true,
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
+	}
+}
+
+func (r *FileResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*truenas.Client)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *truenas.Client, got: %T.", req.ProviderData),
+		)
+		return
+	}
+
+	r.client = client
+}
+
+// ModifyPlan hashes the content to upload, so that a changed source file or
+// content shows in the plan and an unreadable source fails it
+func (r *FileResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	// Nothing to check on destroy
+	if req.Plan.Raw.IsNull() {
+		return
+	}
+
+	var plan FileResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if plan.Source.IsUnknown() || plan.Content.IsUnknown() {
+		plan.SHA256 = types.StringUnknown()
+		plan.Size = types.Int64Unknown()
+		resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+		return
+	}
+
+	content, size, err := openFileContent(&plan)
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(path.Root("source"), "File Error", fmt.Sprintf("Unable to read the source file: %s", err))
+		return
+	}
+	defer content.Close()
+
+	checksum := sha256.New()
+	if _, err := io.Copy(checksum, content); err != nil {
+		resp.Diagnostics.AddAttributeError(path.Root("source"), "File Error", fmt.Sprintf("Unable to read the source file: %s", err))
+		return
+	}
+	plan.SHA256 = types.StringValue(hex.EncodeToString(checksum.Sum(nil)))
+	plan.Size = types.Int64Value(size)
+
+	resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+}
+
+func (r *FileResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data FileResourceModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	createTimeout, diags := data.Timeouts.Create(ctx, fileTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
+	if !r.uploadFile(ctx, &data, &resp.Diagnostics) {
+		return
+	}
+	data.ID = data.Destination
+
+	if !r.applyFilePermissions(ctx, &data, &resp.Diagnostics) {
+		// The file exists; keep it in state so that it is fixed or removed
+		resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+		return
+	}
+
+	if !r.readFile(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read file: it no longer exists")
+	}
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *FileResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data FileResourceModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	readTimeout, diags := data.Timeouts.Read(ctx, fileTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	found := r.readFile(ctx, &data, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !found {
+		// Deleted outside of Terraform; drop it from state so it is re-created
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *FileResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var data, state FileResourceModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	updateTimeout, diags := data.Timeouts.Update(ctx, fileTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	// Changed content, or a file changed outside of Terraform, is uploaded
+	// again; ownership and permissions alone are changed in place
+	if !data.SHA256.Equal(state.SHA256) || !data.Size.Equal(state.Size) {
+		if !r.uploadFile(ctx, &data, &resp.Diagnostics) {
+			return
+		}
+	}
+
+	if !r.applyFilePermissions(ctx, &data, &resp.Diagnostics) {
+		return
+	}
+
+	if !r.readFile(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read file: it no longer exists")
+	}
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *FileResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data FileResourceModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, fileTimeouts.Delete)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
+	if err := r.client.DeleteFile(ctx, data.ID.ValueString()); err != nil && !truenas.IsNoEntry(err) {
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete file, got error: %s", err))
+	}
+}
+
+// ImportState imports a file by its path. The content is not known until
+// the next apply, which uploads the file again.
+func (r *FileResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+// uploadFile streams the content of the file to its destination, checking
+// that it is the content that was planned
+func (r *FileResource) uploadFile(ctx context.Context, data *FileResourceModel, diags *diag.Diagnostics) bool {
+	content, size, err := openFileContent(data)
+	if err != nil {
+		diags.AddAttributeError(path.Root("source"), "File Error", fmt.Sprintf("Unable to read the source file: %s", err))
+		return false
+	}
+	defer content.Close()
+
+	if !data.Size.IsUnknown() && data.Size.ValueInt64() != size {
+		diags.AddAttributeError(
+			path.Root("source"),
+			"File Error",
+			fmt.Sprintf("The size of the source file changed from %d to %d bytes since the plan was made. Plan again.", data.Size.ValueInt64(), size),
+		)
+		return false
+	}
+
+	var opts []truenas.UploadOption
+	if mode, ok := fileMode(data.Mode); ok {
+		opts = append(opts, truenas.WithUploadMode(mode))
+	}
+
+	destination := data.Destination.ValueString()
+	result, err := r.client.UploadReader(ctx, destination, content, size, opts...)
+	if err != nil {
+		diags.AddError("Client Error", fmt.Sprintf("Unable to upload file %s, got error: %s", destination, err))
+		return false
+	}
+
+	if !data.SHA256.IsUnknown() && data.SHA256.ValueString() != result.SHA256 {
+		diags.AddAttributeError(
+			path.Root("source"),
+			"File Error",
+			fmt.Sprintf("The source file changed since the plan was made: its checksum is %s, %s was planned. Plan again.", result.SHA256, data.SHA256.ValueString()),
+		)
+		return false
+	}
+	data.SHA256 = types.StringValue(result.SHA256)
+	data.Size = types.Int64Value(result.Size)
+	return true
+}
+
+// applyFilePermissions sets the configured mode and ownership of the file
+// where they differ from its current ones
+func (r *FileResource) applyFilePermissions(ctx context.Context, data *FileResourceModel, diags *diag.Diagnostics) bool {
+	destination := data.Destination.ValueString()
+	stat, err := r.client.StatFile(ctx, destination)
+	if err != nil {
+		diags.AddError("Client Error", fmt.Sprintf("Unable to read file %s, got error: %s", destination, err))
+		return false
+	}
+
+	var perm truenas.FilePermissions
+	changed := false
+	if mode, ok := fileMode(data.Mode); ok && mode != stat.Permissions() {
+		perm.Mode = &mode
+		changed = true
+	}
+	if !data.Owner.IsNull() && !data.Owner.IsUnknown() && !isFileAccount(data.Owner, stat.UID, stat.User) {
+		uid, err := r.resolveAccountID(ctx, "/user", "username", "uid", data.Owner.ValueString())
+		if err != nil {
+			diags.AddAttributeError(path.Root("owner"), "Client Error", fmt.Sprintf("Unable to resolve owner %q, got error: %s", data.Owner.ValueString(), err))
+			return false
+		}
+		if uid != stat.UID {
+			perm.UID = &uid
+			changed = true
+		}
+	}
+	if !data.Group.IsNull() && !data.Group.IsUnknown() && !isFileAccount(data.Group, stat.GID, stat.Group) {
+		gid, err := r.resolveAccountID(ctx, "/group", "group", "gid", data.Group.ValueString())
+		if err != nil {
+			diags.AddAttributeError(path.Root("group"), "Client Error", fmt.Sprintf("Unable to resolve group %q, got error: %s", data.Group.ValueString(), err))
+			return false
+		}
+		if gid != stat.GID {
+			perm.GID = &gid
+			changed = true
+		}
+	}
+
+	if !changed {
+		return true
+	}
+	if err := r.client.SetFilePermissions(ctx, destination, perm); err != nil {
+		addClientError(diags, "set file permissions", err, data, map[string]path.Path{
+			"uid": path.Root("owner"),
+			"gid": path.Root("group"),
+		})
+		return false
+	}
+	return true
+}
+
+// isFileAccount reports whether a known owner or group designates the
+// account with the given ID and name
+func isFileAccount(value types.String, id int64, name *string) bool {
+	if value.IsNull() || value.IsUnknown() {
+		return false
+	}
+	account := value.ValueString()
+	return account == strconv.FormatInt(id, 10) || (name != nil && account == *name)
+}
+
+// resolveAccountID returns the numeric ID of a user or group given by name
+// or ID
+func (r *FileResource) resolveAccountID(ctx context.Context, endpoint, nameField, idField, account string) (int64, error) {
+	if id, err := strconv.ParseInt(account, 10, 64); err == nil {
+		return id, nil
+	}
+
+	respBody, err := r.client.Get(ctx, fmt.Sprintf("%s?%s=%s", endpoint, nameField, url.QueryEscape(account)))
+	if err != nil {
+		return 0, err
+	}
+
+	var results []map[string]interface{}
+	if err := json.Unmarshal(respBody, &results); err != nil {
+		return 0, fmt.Errorf("error parsing response: %w", err)
+	}
+	if len(results) == 0 {
+		return 0, fmt.Errorf("%s does not exist", account)
+	}
+	id, ok := results[0][idField].(float64)
+	if !ok {
+		return 0, fmt.Errorf("%s has no %s", account, idField)
+	}
+	return int64(id), nil
+}
+
+// readFile refreshes data from the file. It returns false, without adding
+// a diagnostic, when the file no longer exists.
+func (r *FileResource) readFile(ctx context.Context, data *FileResourceModel, diags *diag.Diagnostics) bool {
+	stat, err := r.client.StatFile(ctx, data.ID.ValueString())
+	if err != nil {
+		if truenas.IsNoEntry(err) {
+			return false
+		}
+		diags.AddError("Client Error", fmt.Sprintf("Unable to read file, got error: %s", err))
+		return false
+	}
+
+	if stat.Type != "FILE" {
+		diags.AddError("Client Error", fmt.Sprintf("%s is a %s, not a regular file", data.ID.ValueString(), strings.ToLower(stat.Type)))
+		return false
+	}
+
+	data.Destination = data.ID
+	data.Size = types.Int64Value(stat.Size)
+
+	// Keep the configured notation of values that did not change
+	if mode, ok := fileMode(data.Mode); !ok || mode != stat.Permissions() {
+		data.Mode = types.StringValue(fmt.Sprintf("%04o", stat.Permissions()))
+	}
+	data.Owner = fileAccount(data.Owner, stat.UID, stat.User)
+	data.Group = fileAccount(data.Group, stat.GID, stat.Group)
+
+	return true
+}
+
+// openFileContent opens the content of the file, returning it with its size
+func openFileContent(data *FileResourceModel) (io.ReadSeekCloser, int64, error) {
+	if data.Source.IsNull() {
+		content := data.Content.ValueString()
+		return nopSeekCloser{strings.NewReader(content)}, int64(len(content)), nil
+	}
+
+	file, err := os.Open(data.Source.ValueString())
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	if !info.Mode().IsRegular() {
+		file.Close()
+		return nil, 0, fmt.Errorf("%s is not a regular file", data.Source.ValueString())
+	}
+	return file, info.Size(), nil
+}
+
+// nopSeekCloser adds a no-op Close method to an io.ReadSeeker
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error {
+	return nil
+}
+
+// fileMode parses a known mode attribute
+func fileMode(value types.String) (os.FileMode, bool) {
+	if value.IsNull() || value.IsUnknown() {
+		return 0, false
+	}
+	mode, err := strconv.ParseUint(value.ValueString(), 8, 32)
+	if err != nil {
+		return 0, false
+	}
+	return os.FileMode(mode), true
+}
+
+// fileAccount returns the owner or group of a file: the current value when
+// it still designates the same account by name or ID, else the name of the
+// account, or its ID when it has no name
+func fileAccount(current types.String, id int64, name *string) types.String {
+	if isFileAccount(current, id, name) {
+		return current
+	}
+	if name != nil && *name != "" {
+		return types.StringValue(*name)
+	}
+	return types.StringValue(strconv.FormatInt(id, 10))
+}
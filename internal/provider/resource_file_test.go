@@ -0,0 +1,255 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/terraform"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas/fake"
+)
+
+func TestAccFileResource(t *testing.T) {
+	server := testAccFakeServer(t)
+	if _, err := server.Create("user", map[string]interface{}{"username": "deploy", "full_name": "Deploy", "uid": 3000, "group_create": true}); err != nil {
+		t.Fatal(err)
+	}
+	iso := strings.Repeat("installer", 10000)
+	source := writeTestFile(t, "installer.iso", []byte(iso))
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckFilesDeleted(server),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_file" "script" {
+  destination = "/mnt/tank/scripts/backup.sh"
+  content     = "#!/bin/sh\necho backup\n"
+  mode        = "0750"
+  owner       = "deploy"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_file.script", "id", "/mnt/tank/scripts/backup.sh"),
+					resource.TestCheckResourceAttr("truenas_file.script", "sha256", testSHA256("#!/bin/sh\necho backup\n")),
+					resource.TestCheckResourceAttr("truenas_file.script", "size", "22"),
+					resource.TestCheckResourceAttr("truenas_file.script", "mode", "0750"),
+					resource.TestCheckResourceAttr("truenas_file.script", "owner", "deploy"),
+					resource.TestCheckResourceAttr("truenas_file.script", "group", "root"),
+					testAccCheckFileContent(server, "/mnt/tank/scripts/backup.sh", "#!/bin/sh\necho backup\n"),
+					testAccCheckFileMode(server, "/mnt/tank/scripts/backup.sh", 0o750, 3000, 0),
+				),
+			},
+			{
+				// New content is uploaded again in place
+				Config: testAccProviderConfig(server) + `
+resource "truenas_file" "script" {
+  destination = "/mnt/tank/scripts/backup.sh"
+  content     = "#!/bin/sh\necho backup --all\n"
+  mode        = "0750"
+  owner       = "3000"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_file.script", "sha256", testSHA256("#!/bin/sh\necho backup --all\n")),
+					resource.TestCheckResourceAttr("truenas_file.script", "owner", "3000"),
+					testAccCheckFileContent(server, "/mnt/tank/scripts/backup.sh", "#!/bin/sh\necho backup --all\n"),
+					testAccCheckFileMode(server, "/mnt/tank/scripts/backup.sh", 0o750, 3000, 0),
+				),
+			},
+			{
+				// Permissions alone are changed without an upload
+				Config: testAccProviderConfig(server) + `
+resource "truenas_file" "script" {
+  destination = "/mnt/tank/scripts/backup.sh"
+  content     = "#!/bin/sh\necho backup --all\n"
+  mode        = "700"
+  owner       = "3000"
+  group       = "deploy"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_file.script", "mode", "700"),
+					resource.TestCheckResourceAttr("truenas_file.script", "group", "deploy"),
+					testAccCheckFileMode(server, "/mnt/tank/scripts/backup.sh", 0o700, 3000, 3000),
+				),
+			},
+			{
+				ResourceName:            "truenas_file.script",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"content", "sha256", "mode", "owner", "timeouts"},
+			},
+			{
+				// A file truncated outside of Terraform is uploaded again
+				PreConfig: func() {
+					server.PutFile("/mnt/tank/scripts/backup.sh", []byte("#!/bin/sh\n"))
+				},
+				Config: testAccProviderConfig(server) + `
+resource "truenas_file" "script" {
+  destination = "/mnt/tank/scripts/backup.sh"
+  content     = "#!/bin/sh\necho backup --all\n"
+  mode        = "700"
+  owner       = "3000"
+  group       = "deploy"
+}
+
+resource "truenas_file" "iso" {
+  destination = "/mnt/tank/isos/installer.iso"
+  source      = "` + source + `"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testAccCheckFileContent(server, "/mnt/tank/scripts/backup.sh", "#!/bin/sh\necho backup --all\n"),
+					testAccCheckFileMode(server, "/mnt/tank/scripts/backup.sh", 0o700, 3000, 3000),
+					resource.TestCheckResourceAttr("truenas_file.iso", "sha256", testSHA256(iso)),
+					resource.TestCheckResourceAttr("truenas_file.iso", "size", fmt.Sprint(len(iso))),
+					resource.TestCheckResourceAttr("truenas_file.iso", "mode", "0644"),
+					resource.TestCheckResourceAttr("truenas_file.iso", "owner", "root"),
+					testAccCheckFileContent(server, "/mnt/tank/isos/installer.iso", iso),
+				),
+			},
+		},
+	})
+}
+
+// TestAccFileResource_deletedOutOfBand tests that a file removed outside of
+// Terraform is uploaded again
+func TestAccFileResource_deletedOutOfBand(t *testing.T) {
+	server := testAccFakeServer(t)
+	config := testAccProviderConfig(server) + `
+resource "truenas_file" "test" {
+  destination = "/mnt/tank/config/app.conf"
+  content     = "listen = 8080\n"
+}
+`
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckFilesDeleted(server),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check:  testAccCheckFileContent(server, "/mnt/tank/config/app.conf", "listen = 8080\n"),
+			},
+			{
+				PreConfig: func() {
+					if err := server.DeleteFile("/mnt/tank/config/app.conf"); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: config,
+				Check:  testAccCheckFileContent(server, "/mnt/tank/config/app.conf", "listen = 8080\n"),
+			},
+		},
+	})
+}
+
+// TestAccFileResource_invalid tests the validation of the configuration
+func TestAccFileResource_invalid(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_file" "test" {
+  destination = "/mnt/tank/config/app.conf"
+}
+`,
+				ExpectError: regexp.MustCompile(`Invalid Attribute Combination`),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_file" "test" {
+  destination = "/etc/passwd"
+  content     = "root::0:0::/root:/bin/sh\n"
+}
+`,
+				ExpectError: regexp.MustCompile(`must be the path of a file under /mnt/<pool>/`),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_file" "test" {
+  destination = "/mnt/tank/config/app.conf"
+  content     = "listen = 8080\n"
+  mode        = "rwxr-xr-x"
+}
+`,
+				ExpectError: regexp.MustCompile(`must be octal permissions`),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_file" "test" {
+  destination = "/mnt/tank/isos/missing.iso"
+  source      = "/nonexistent/missing.iso"
+}
+`,
+				ExpectError: regexp.MustCompile(`Unable to read the source file`),
+			},
+		},
+	})
+}
+
+// testAccCheckFilesDeleted verifies that the files of all truenas_file
+// resources were deleted
+func testAccCheckFilesDeleted(server *fake.Server) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		for _, rs := range s.RootModule().Resources {
+			if rs.Type != "truenas_file" {
+				continue
+			}
+			if _, ok := server.File(rs.Primary.ID); ok {
+				return fmt.Errorf("file %s still exists", rs.Primary.ID)
+			}
+		}
+		return nil
+	}
+}
+
+// testAccCheckFileContent verifies the content of a file on the fake server
+func testAccCheckFileContent(server *fake.Server, path, want string) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		content, ok := server.File(path)
+		if !ok {
+			return fmt.Errorf("file %s does not exist", path)
+		}
+		if string(content) != want {
+			return fmt.Errorf("file %s holds %q, expected %q", path, truncate(string(content), 64), truncate(want, 64))
+		}
+		return nil
+	}
+}
+
+// testAccCheckFileMode verifies the permissions and ownership of a file on
+// the fake server
+func testAccCheckFileMode(server *fake.Server, path string, mode, uid, gid int64) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		gotMode, gotUID, gotGID, ok := server.FileMode(path)
+		if !ok {
+			return fmt.Errorf("file %s does not exist", path)
+		}
+		if gotMode != mode || gotUID != uid || gotGID != gid {
+			return fmt.Errorf("file %s has mode %04o and owner %d:%d, expected %04o and %d:%d", path, gotMode, gotUID, gotGID, mode, uid, gid)
+		}
+		return nil
+	}
+}
+
+func testSHA256(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
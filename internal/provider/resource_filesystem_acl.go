@@ -0,0 +1,435 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+)
+
+// filesystemPathPattern matches the paths the filesystem permission
+// endpoints accept, which are below /mnt
+var filesystemPathPattern = regexp.MustCompile(`^/mnt/.+`)
+
+var _ resource.Resource = &FilesystemACLResource{}
+var _ resource.ResourceWithImportState = &FilesystemACLResource{}
+var _ resource.ResourceWithValidateConfig = &FilesystemACLResource{}
+
+func NewFilesystemACLResource() resource.Resource {
+	return &FilesystemACLResource{}
+}
+
+type FilesystemACLResource struct {
+	client *truenas.Client
+}
+
+type FilesystemACLResourceModel struct {
+	ID        types.String    `tfsdk:"id"`
+	Path      types.String    `tfsdk:"path"`
+	ACLType   types.String    `tfsdk:"acltype"`
+	UID       types.Int64     `tfsdk:"uid"`
+	GID       types.Int64     `tfsdk:"gid"`
+	Entries   []ACLEntryModel `tfsdk:"entries"`
+	Template  types.String    `tfsdk:"template"`
+	Strip     types.Bool      `tfsdk:"strip"`
+	Recursive types.Bool      `tfsdk:"recursive"`
+	Traverse  types.Bool      `tfsdk:"traverse"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
+}
+
+// filesystemACLAPIFields maps /filesystem/setacl fields to attributes
+var filesystemACLAPIFields = map[string]path.Path{
+	"dacl": path.Root("entries"),
+}
+
+func (r *FilesystemACLResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_filesystem_acl"
+}
+
+func (r *FilesystemACLResource) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Manages the NFSv4 or POSIX.1e ACL of a path, such as the mountpoint of a dataset, with `/filesystem/setacl`. Changes made outside Terraform are detected through `/filesystem/getacl`. Destroying the resource leaves the ACL in place.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Path of the ACL (same as `path`)",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"path": schema.StringAttribute{
+				MarkdownDescription: "Path below `/mnt`, e.g. `/mnt/tank/share`",
+				Required:            true,
+				Validators: []validator.String{
+					stringvalidator.RegexMatches(filesystemPathPattern, "must be a path below /mnt"),
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"acltype": schema.StringAttribute{
+				MarkdownDescription: "`NFS4` or `POSIX1E`. It must match the ACL type of the dataset holding the path.",
+				Required:            true,
+				Validators: []validator.String{
+					stringvalidator.OneOf(truenas.ACLTypeNFS4, truenas.ACLTypePOSIX1E),
+				},
+			},
+			"uid": schema.Int64Attribute{
+				MarkdownDescription: "UID of the owner of the path. Defaults to the current owner.",
+				Optional:            true,
+				Computed:            true,
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.UseStateForUnknown(),
+				},
+			},
+			"gid": schema.Int64Attribute{
+				MarkdownDescription: "GID of the group of the path. Defaults to the current group.",
+				Optional:            true,
+				Computed:            true,
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.UseStateForUnknown(),
+				},
+			},
+			"entries": schema.ListNestedAttribute{
+				MarkdownDescription: "Access control entries, in order. NFS4 entries are applied in the order given, without canonicalization. POSIX1E ACLs need `USER_OBJ`, `GROUP_OBJ` and `OTHER` entries, and a `MASK` entry when they name users or groups. Required unless `template` or `strip` is set.",
+				Optional:            true,
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: aclEntryAttributes(),
+				},
+			},
+			"template": schema.StringAttribute{
+				MarkdownDescription: "Name of an ACL template of the same ACL type, such as `NFS4_RESTRICTED` or one managed by `truenas_acl_template`, whose entries to apply instead of `entries`. NFS4 entries are applied in the order Windows expects. The ACL is applied again when it no longer matches the template.",
+				Optional:            true,
+				Validators: []validator.String{
+					stringvalidator.LengthAtLeast(1),
+				},
+			},
+			"strip": schema.BoolAttribute{
+				MarkdownDescription: "Strip the ACL, leaving only the permissions of the mode. `entries` and `template` must then be unset. A non-trivial ACL set outside Terraform is stripped again by the next apply.",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(false),
+			},
+			"recursive": schema.BoolAttribute{
+				MarkdownDescription: "Also apply the ACL to the contents of the directory. Only the ACL of `path` is checked for drift.",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(false),
+			},
+			"traverse": schema.BoolAttribute{
+				MarkdownDescription: "With `recursive`, also apply the ACL to the child datasets mounted below the path",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(false),
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
+	}
+}
+
+func (r *FilesystemACLResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*truenas.Client)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *truenas.Client, got: %T.", req.ProviderData),
+		)
+		return
+	}
+
+	r.client = client
+}
+
+// ValidateConfig checks that exactly one of entries and template is set
+// unless the ACL is stripped, and that the entries fit the ACL type
+func (r *FilesystemACLResource) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var acltype, template types.String
+	var strip types.Bool
+	var entries types.List
+	resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root("acltype"), &acltype)...)
+	resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root("template"), &template)...)
+	resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root("strip"), &strip)...)
+	resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root("entries"), &entries)...)
+	if resp.Diagnostics.HasError() || strip.IsUnknown() || entries.IsUnknown() {
+		return
+	}
+
+	if strip.ValueBool() {
+		if !entries.IsNull() {
+			resp.Diagnostics.AddAttributeError(path.Root("entries"), "Invalid Attribute Combination", "entries cannot be set when strip is true.")
+		}
+		if !template.IsNull() {
+			resp.Diagnostics.AddAttributeError(path.Root("template"), "Invalid Attribute Combination", "template cannot be set when strip is true.")
+		}
+		return
+	}
+	if !template.IsNull() {
+		if !entries.IsNull() {
+			resp.Diagnostics.AddAttributeError(path.Root("entries"), "Invalid Attribute Combination", "entries cannot be set when template is set.")
+		}
+		return
+	}
+	if entries.IsNull() || len(entries.Elements()) == 0 {
+		resp.Diagnostics.AddAttributeError(path.Root("entries"), "Missing Attribute Value", "entries must contain at least one entry unless template or strip is set.")
+		return
+	}
+	if acltype.IsUnknown() || acltype.IsNull() {
+		return
+	}
+
+	var models []ACLEntryModel
+	resp.Diagnostics.Append(entries.ElementsAs(ctx, &models, false)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	validateACLEntries(ctx, acltype.ValueString(), models, path.Root("entries"), &resp.Diagnostics)
+}
+
+func (r *FilesystemACLResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data FilesystemACLResourceModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	createTimeout, diags := data.Timeouts.Create(ctx, permissionTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
+	data.ID = data.Path
+	r.apply(ctx, &data, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *FilesystemACLResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data FilesystemACLResourceModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	readTimeout, diags := data.Timeouts.Read(ctx, permissionTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	found := r.readACL(ctx, &data, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !found {
+		// The path was deleted outside of Terraform
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
+	for _, option := range []*types.Bool{&data.Strip, &data.Recursive, &data.Traverse} {
+		if option.IsNull() {
+			*option = types.BoolValue(false)
+		}
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *FilesystemACLResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var data FilesystemACLResourceModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	updateTimeout, diags := data.Timeouts.Update(ctx, permissionTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	r.apply(ctx, &data, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// Delete removes the resource from the state only: stripping the ACL could
+// lock users out of the share it protects
+func (r *FilesystemACLResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+}
+
+func (r *FilesystemACLResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+// apply sets the ACL, or the entries of its template, with
+// /filesystem/setacl and reads it back
+func (r *FilesystemACLResource) apply(ctx context.Context, data *FilesystemACLResourceModel, diags *diag.Diagnostics) {
+	acltype := data.ACLType.ValueString()
+	var entries []truenas.ACLEntry
+	if !data.Template.IsNull() {
+		template := r.findTemplate(ctx, data, diags)
+		if template == nil {
+			if !diags.HasError() {
+				diags.AddAttributeError(path.Root("template"), "Client Error", fmt.Sprintf("No %s ACL template is named %q.", acltype, data.Template.ValueString()))
+			}
+			return
+		}
+		entries = template.Entries
+	} else {
+		var d diag.Diagnostics
+		entries, d = aclEntriesToAPI(ctx, acltype, data.Entries)
+		diags.Append(d...)
+		if diags.HasError() {
+			return
+		}
+	}
+
+	acl := truenas.ACL{
+		Path:    data.Path.ValueString(),
+		ACLType: acltype,
+		Entries: entries,
+	}
+	if !data.UID.IsNull() && !data.UID.IsUnknown() {
+		acl.UID = data.UID.ValueInt64Pointer()
+	}
+	if !data.GID.IsNull() && !data.GID.IsUnknown() {
+		acl.GID = data.GID.ValueInt64Pointer()
+	}
+	err := r.client.SetFilesystemACL(ctx, acl, truenas.ACLOptions{
+		StripACL:  data.Strip.ValueBool(),
+		Recursive: data.Recursive.ValueBool(),
+		Traverse:  data.Traverse.ValueBool(),
+	})
+	if err != nil {
+		addClientError(diags, "set ACL", err, data, filesystemACLAPIFields)
+		return
+	}
+
+	// The template was just applied, so it stays as planned even if the
+	// middleware rewrote some of its entries
+	template := data.Template
+	if !r.readACL(ctx, data, diags) && !diags.HasError() {
+		diags.AddError("Client Error", fmt.Sprintf("Path %s disappeared after its ACL was set", data.Path.ValueString()))
+	}
+	data.Template = template
+}
+
+// readACL refreshes the owner, ACL type and entries of the path. found is
+// false, without a diagnostic, when the path does not exist.
+func (r *FilesystemACLResource) readACL(ctx context.Context, data *FilesystemACLResourceModel, diags *diag.Diagnostics) bool {
+	id := data.ID.ValueString()
+	acl, err := r.client.GetFilesystemACL(ctx, id)
+	if err != nil {
+		if truenas.IsNoEntry(err) {
+			return false
+		}
+		diags.AddError("Client Error", fmt.Sprintf("Unable to read ACL of %s, got error: %s", id, err))
+		return false
+	}
+
+	data.Path = data.ID
+	data.ACLType = types.StringValue(acl.ACLType)
+	data.UID = types.Int64PointerValue(acl.UID)
+	data.GID = types.Int64PointerValue(acl.GID)
+
+	// An ACL that no longer matches its template shows up as a template
+	// to apply again
+	if !data.Template.IsNull() {
+		template := r.findTemplate(ctx, data, diags)
+		if diags.HasError() {
+			return false
+		}
+		data.Entries = nil
+		if template == nil || acl.Trivial || !aclMatchesTemplate(ctx, acl, template, diags) {
+			data.Template = types.StringNull()
+		}
+		return true
+	}
+
+	// A stripped ACL has no entries to manage; a non-trivial one shows up
+	// as entries to remove
+	if data.Strip.ValueBool() && acl.Trivial {
+		data.Entries = nil
+		return true
+	}
+	entries, d := aclEntriesFromAPI(ctx, acl, data.Entries)
+	diags.Append(d...)
+	data.Entries = entries
+	return true
+}
+
+// findTemplate returns the ACL template named by data.Template, with NFS4
+// entries in the order Windows expects, or nil when there is none of the
+// ACL type of data
+func (r *FilesystemACLResource) findTemplate(ctx context.Context, data *FilesystemACLResourceModel, diags *diag.Diagnostics) *truenas.ACLTemplate {
+	acltype := data.ACLType.ValueString()
+	name := data.Template.ValueString()
+	templates, err := r.client.ListACLTemplatesByPath(ctx, "", []interface{}{
+		[]interface{}{"name", "=", name},
+		[]interface{}{"acltype", "=", acltype},
+	}, truenas.ACLTemplateFormat{Canonicalize: acltype == truenas.ACLTypeNFS4})
+	if err != nil {
+		diags.AddError("Client Error", fmt.Sprintf("Unable to read ACL template %s, got error: %s", name, err))
+		return nil
+	}
+	if len(templates) == 0 {
+		return nil
+	}
+	return &templates[0]
+}
+
+// aclMatchesTemplate reports whether the entries of an ACL are those of a
+// template, in the same order for NFS4 ACLs
+func aclMatchesTemplate(ctx context.Context, acl *truenas.ACL, template *truenas.ACLTemplate, diags *diag.Diagnostics) bool {
+	want, d := aclEntriesFromAPI(ctx, &truenas.ACL{ACLType: template.ACLType, Entries: template.Entries}, nil)
+	diags.Append(d...)
+	got, d := aclEntriesFromAPI(ctx, acl, want)
+	diags.Append(d...)
+	return aclEntriesEqual(got, want)
+}
@@ -0,0 +1,328 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/terraform"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas/fake"
+)
+
+// testAccACLDatasets creates the user alice, the NFSv4 dataset tank/smb and
+// the POSIX dataset tank/posix with a child, outside of Terraform
+func testAccACLDatasets(t *testing.T, server *fake.Server) {
+	if _, err := server.Create("user", map[string]interface{}{"username": "alice", "full_name": "Alice", "uid": 3000, "group_create": true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, dataset := range []map[string]interface{}{
+		{"name": "tank/smb", "acltype": "NFSV4"},
+		{"name": "tank/posix"},
+		{"name": "tank/posix/child"},
+	} {
+		if _, err := server.Create("pool/dataset", dataset); err != nil {
+			t.Fatalf("creating %s: %s", dataset["name"], err)
+		}
+	}
+}
+
+// TestAccFilesystemACLResource_nfs4 tests an NFSv4 ACL, drift when it is
+// stripped outside Terraform, import and strip mode
+func TestAccFilesystemACLResource_nfs4(t *testing.T) {
+	server := testAccFakeServer(t)
+	testAccACLDatasets(t, server)
+
+	config := testAccProviderConfig(server) + `
+resource "truenas_filesystem_acl" "smb" {
+  path    = "/mnt/tank/smb"
+  acltype = "NFS4"
+  uid     = 3000
+
+  entries = [
+    { tag = "owner@", type = "ALLOW", basic_perms = "FULL_CONTROL", basic_flags = "INHERIT" },
+    { tag = "USER", who = "alice", type = "ALLOW", basic_perms = "MODIFY", basic_flags = "INHERIT" },
+    { tag = "everyone@", type = "DENY", perms = ["WRITE_DATA", "APPEND_DATA"] },
+  ]
+}
+`
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_filesystem_acl.smb", "id", "/mnt/tank/smb"),
+					resource.TestCheckResourceAttr("truenas_filesystem_acl.smb", "uid", "3000"),
+					resource.TestCheckResourceAttr("truenas_filesystem_acl.smb", "gid", "0"),
+					resource.TestCheckResourceAttr("truenas_filesystem_acl.smb", "entries.#", "3"),
+					resource.TestCheckResourceAttr("truenas_filesystem_acl.smb", "entries.1.who", "alice"),
+					resource.TestCheckNoResourceAttr("truenas_filesystem_acl.smb", "entries.1.id"),
+					resource.TestCheckResourceAttr("truenas_filesystem_acl.smb", "entries.2.perms.#", "2"),
+					testAccCheckHasACL(server, "/mnt/tank/smb", true),
+				),
+			},
+			{
+				// Stripping the ACL outside Terraform is detected
+				PreConfig: func() {
+					if err := server.StripACL("/mnt/tank/smb"); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: config,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testAccCheckHasACL(server, "/mnt/tank/smb", true),
+					testAccCheckFilesystemRequests(server, "/filesystem/setacl", 2),
+				),
+			},
+			{
+				ResourceName:            "truenas_filesystem_acl.smb",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"entries.1.who", "entries.1.id", "timeouts"},
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_filesystem_acl" "smb" {
+  path    = "/mnt/tank/smb"
+  acltype = "NFS4"
+  strip   = true
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_filesystem_acl.smb", "strip", "true"),
+					resource.TestCheckNoResourceAttr("truenas_filesystem_acl.smb", "entries"),
+					testAccCheckHasACL(server, "/mnt/tank/smb", false),
+				),
+			},
+		},
+	})
+}
+
+// TestAccFilesystemACLResource_posix1e tests a recursive POSIX.1e ACL with
+// default entries, whose entries are not in the order the kernel keeps
+func TestAccFilesystemACLResource_posix1e(t *testing.T) {
+	server := testAccFakeServer(t)
+	testAccACLDatasets(t, server)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_filesystem_acl" "posix" {
+  path      = "/mnt/tank/posix"
+  acltype   = "POSIX1E"
+  recursive = true
+  traverse  = true
+
+  entries = [
+    { tag = "USER_OBJ", perms = ["READ", "WRITE", "EXECUTE"] },
+    { tag = "USER", id = 3000, perms = ["READ", "WRITE", "EXECUTE"] },
+    { tag = "GROUP_OBJ", perms = ["READ", "EXECUTE"] },
+    { tag = "OTHER", perms = [] },
+    { tag = "MASK", perms = ["READ", "WRITE", "EXECUTE"] },
+    { tag = "USER_OBJ", perms = ["READ", "WRITE", "EXECUTE"], default = true },
+    { tag = "GROUP_OBJ", perms = ["READ", "EXECUTE"], default = true },
+    { tag = "OTHER", perms = [], default = true },
+  ]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_filesystem_acl.posix", "acltype", "POSIX1E"),
+					resource.TestCheckResourceAttr("truenas_filesystem_acl.posix", "entries.#", "8"),
+					resource.TestCheckResourceAttr("truenas_filesystem_acl.posix", "entries.1.id", "3000"),
+					resource.TestCheckResourceAttr("truenas_filesystem_acl.posix", "entries.3.perms.#", "0"),
+					resource.TestCheckNoResourceAttr("truenas_filesystem_acl.posix", "entries.0.default"),
+					resource.TestCheckResourceAttr("truenas_filesystem_acl.posix", "entries.5.default", "true"),
+					testAccCheckHasACL(server, "/mnt/tank/posix", true),
+					testAccCheckHasACL(server, "/mnt/tank/posix/child", true),
+				),
+			},
+		},
+	})
+}
+
+// TestAccFilesystemACLResource_template tests an ACL applied from a
+// built-in template and from a managed one, and drift from the template
+func TestAccFilesystemACLResource_template(t *testing.T) {
+	server := testAccFakeServer(t)
+	testAccACLDatasets(t, server)
+
+	config := testAccProviderConfig(server) + `
+resource "truenas_acl_template" "share" {
+  name    = "DEPARTMENT_SHARE"
+  acltype = "NFS4"
+
+  entries = [
+    { tag = "owner@", type = "ALLOW", basic_perms = "FULL_CONTROL", basic_flags = "INHERIT" },
+    { tag = "USER", id = 3000, type = "ALLOW", basic_perms = "MODIFY", basic_flags = "INHERIT" },
+    { tag = "everyone@", type = "DENY", perms = ["WRITE_DATA"] },
+  ]
+}
+
+resource "truenas_filesystem_acl" "smb" {
+  path     = "/mnt/tank/smb"
+  acltype  = "NFS4"
+  template = truenas_acl_template.share.name
+}
+`
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_filesystem_acl" "smb" {
+  path     = "/mnt/tank/smb"
+  acltype  = "NFS4"
+  template = "NFS4_RESTRICTED"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_filesystem_acl.smb", "template", "NFS4_RESTRICTED"),
+					resource.TestCheckNoResourceAttr("truenas_filesystem_acl.smb", "entries"),
+					testAccCheckHasACL(server, "/mnt/tank/smb", true),
+				),
+			},
+			{
+				// DENY entries are applied first, as Windows expects
+				Config: config,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_filesystem_acl.smb", "template", "DEPARTMENT_SHARE"),
+					testAccCheckFilesystemRequests(server, "/filesystem/setacl", 2),
+					testAccCheckFilesystemRequestBody(server, "/filesystem/setacl", `"dacl":[{"tag":"everyone@"`),
+				),
+			},
+			{
+				// An ACL changed outside Terraform is set from the template
+				// again
+				PreConfig: func() {
+					if err := server.StripACL("/mnt/tank/smb"); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: config,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testAccCheckHasACL(server, "/mnt/tank/smb", true),
+					testAccCheckFilesystemRequests(server, "/filesystem/setacl", 3),
+				),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_filesystem_acl" "smb" {
+  path     = "/mnt/tank/smb"
+  acltype  = "NFS4"
+  template = "POSIX_OPEN"
+}
+`,
+				ExpectError: regexp.MustCompile(`No NFS4 ACL template is named`),
+			},
+		},
+	})
+}
+
+// TestAccFilesystemACLResource_errors tests entries that do not fit the
+// ACL type, and ACLs TrueNAS rejects
+func TestAccFilesystemACLResource_errors(t *testing.T) {
+	server := testAccFakeServer(t)
+	testAccACLDatasets(t, server)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_filesystem_acl" "posix" {
+  path    = "/mnt/tank/posix"
+  acltype = "POSIX1E"
+  entries = [{ tag = "owner@", perms = ["READ"] }]
+}
+`,
+				ExpectError: regexp.MustCompile(`POSIX1E ACLs cannot have "owner@"`),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_filesystem_acl" "smb" {
+  path    = "/mnt/tank/smb"
+  acltype = "NFS4"
+  entries = [{ tag = "USER", type = "ALLOW", basic_perms = "READ", perms = ["READ_DATA"] }]
+}
+`,
+				ExpectError: regexp.MustCompile(`exactly one of id and who`),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_filesystem_acl" "posix" {
+  path    = "/mnt/tank/posix"
+  acltype = "POSIX1E"
+  entries = [
+    { tag = "USER_OBJ", perms = ["READ", "WRITE"] },
+    { tag = "GROUP_OBJ", perms = ["READ"] },
+    { tag = "OTHER", perms = [] },
+    { tag = "USER", id = 3000, perms = ["READ"] },
+  ]
+}
+`,
+				ExpectError: regexp.MustCompile(`MASK entry is required`),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_filesystem_acl" "smb" {
+  path    = "/mnt/tank/smb"
+  acltype = "POSIX1E"
+  entries = [{ tag = "USER_OBJ", perms = ["READ"] }]
+}
+`,
+				ExpectError: regexp.MustCompile(`does not match the NFS4 ACL type`),
+			},
+		},
+	})
+}
+
+// testAccCheckHasACL verifies whether a path has a non-trivial ACL on the
+// fake server
+func testAccCheckHasACL(server *fake.Server, path string, want bool) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		if got := server.HasACL(path); got != want {
+			return fmt.Errorf("%s: non-trivial ACL is %t, want %t", path, got, want)
+		}
+		return nil
+	}
+}
+
+// testAccCheckFilesystemRequestBody verifies that the last call to a
+// filesystem endpoint sent a body containing want
+func testAccCheckFilesystemRequestBody(server *fake.Server, endpoint, want string) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		requests := server.Requests()
+		for i := len(requests) - 1; i >= 0; i-- {
+			if requests[i].Method == "POST" && strings.HasSuffix(requests[i].Path, endpoint) {
+				if !strings.Contains(requests[i].Body, want) {
+					return fmt.Errorf("%s was called with %s, want %s", endpoint, requests[i].Body, want)
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("%s was not called", endpoint)
+	}
+}
+
+// testAccCheckFilesystemRequests verifies the number of calls to a
+// filesystem endpoint
+func testAccCheckFilesystemRequests(server *fake.Server, endpoint string, want int) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		count := 0
+		for _, request := range server.Requests() {
+			if request.Method == "POST" && strings.HasSuffix(request.Path, endpoint) {
+				count++
+			}
+		}
+		if count != want {
+			return fmt.Errorf("%s was called %d times, want %d", endpoint, count, want)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,367 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+)
+
+var _ resource.Resource = &FilesystemPermissionResource{}
+var _ resource.ResourceWithImportState = &FilesystemPermissionResource{}
+
+func NewFilesystemPermissionResource() resource.Resource {
+	return &FilesystemPermissionResource{}
+}
+
+type FilesystemPermissionResource struct {
+	client *truenas.Client
+}
+
+type FilesystemPermissionResourceModel struct {
+	ID        types.String `tfsdk:"id"`
+	Path      types.String `tfsdk:"path"`
+	DatasetID types.String `tfsdk:"dataset_id"`
+	Mode      types.String `tfsdk:"mode"`
+	UID       types.Int64  `tfsdk:"uid"`
+	GID       types.Int64  `tfsdk:"gid"`
+	StripACL  types.Bool   `tfsdk:"strip_acl"`
+	Recursive types.Bool   `tfsdk:"recursive"`
+	Traverse  types.Bool   `tfsdk:"traverse"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
+}
+
+func (r *FilesystemPermissionResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_filesystem_permission"
+}
+
+func (r *FilesystemPermissionResource) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Manages the mode and owner of a path, or of the mountpoint of a dataset, with `/filesystem/setperm`, `/filesystem/chown` or `/pool/dataset/permission`. Changes made outside Terraform are detected through `/filesystem/getacl` and `/filesystem/stat`. Destroying the resource leaves the permissions in place.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Path of the permissions (same as `path`)",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"path": schema.StringAttribute{
+				MarkdownDescription: "Path below `/mnt`, e.g. `/mnt/tank/share`. Exactly one of `path` and `dataset_id` must be set; with `dataset_id`, this is the mountpoint of the dataset.",
+				Optional:            true,
+				Computed:            true,
+				Validators: []validator.String{
+					stringvalidator.RegexMatches(filesystemPathPattern, "must be a path below /mnt"),
+					stringvalidator.ExactlyOneOf(path.MatchRoot("dataset_id")),
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplaceIfConfigured(),
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"dataset_id": schema.StringAttribute{
+				MarkdownDescription: "ID of a dataset whose mountpoint to manage through `/pool/dataset/permission`, e.g. `tank/share`",
+				Optional:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"mode": schema.StringAttribute{
+				MarkdownDescription: "Permissions in octal notation (e.g. `0770`). Defaults to the current permissions. Changing the mode of a path with a non-trivial ACL requires `strip_acl`.",
+				Optional:            true,
+				Computed:            true,
+				Validators: []validator.String{
+					stringvalidator.RegexMatches(fileModePattern, "must be octal permissions such as 0770"),
+					stringvalidator.AtLeastOneOf(path.MatchRoot("uid"), path.MatchRoot("gid")),
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"uid": schema.Int64Attribute{
+				MarkdownDescription: "UID of the owner. Defaults to the current owner.",
+				Optional:            true,
+				Computed:            true,
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.UseStateForUnknown(),
+				},
+			},
+			"gid": schema.Int64Attribute{
+				MarkdownDescription: "GID of the group. Defaults to the current group.",
+				Optional:            true,
+				Computed:            true,
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.UseStateForUnknown(),
+				},
+			},
+			"strip_acl": schema.BoolAttribute{
+				MarkdownDescription: "Strip a non-trivial ACL when setting the mode. A non-trivial ACL set outside Terraform is stripped again by the next apply.",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(false),
+			},
+			"recursive": schema.BoolAttribute{
+				MarkdownDescription: "Also apply the permissions to the contents of the directory. Only the permissions of the path itself are checked for drift.",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(false),
+			},
+			"traverse": schema.BoolAttribute{
+				MarkdownDescription: "With `recursive`, also apply the permissions to the child datasets mounted below the path",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(false),
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
+	}
+}
+
+func (r *FilesystemPermissionResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*truenas.Client)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *truenas.Client, got: %T.", req.ProviderData),
+		)
+		return
+	}
+
+	r.client = client
+}
+
+func (r *FilesystemPermissionResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data FilesystemPermissionResourceModel
+	var configMode types.String
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root("mode"), &configMode)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	createTimeout, diags := data.Timeouts.Create(ctx, permissionTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
+	if !data.DatasetID.IsNull() {
+		mountpoint, ok := r.datasetMountpoint(ctx, data.DatasetID.ValueString(), &resp.Diagnostics)
+		if !ok {
+			return
+		}
+		data.Path = types.StringValue(mountpoint)
+	}
+	data.ID = data.Path
+
+	r.apply(ctx, &data, configMode, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *FilesystemPermissionResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data FilesystemPermissionResourceModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	readTimeout, diags := data.Timeouts.Read(ctx, permissionTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	found := r.readPermissions(ctx, &data, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !found {
+		// The path was deleted outside of Terraform
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
+	for _, option := range []*types.Bool{&data.StripACL, &data.Recursive, &data.Traverse} {
+		if option.IsNull() {
+			*option = types.BoolValue(false)
+		}
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *FilesystemPermissionResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var data FilesystemPermissionResourceModel
+	var configMode types.String
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root("mode"), &configMode)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	updateTimeout, diags := data.Timeouts.Update(ctx, permissionTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	r.apply(ctx, &data, configMode, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// Delete removes the resource from the state only: there are no previous
+// permissions to go back to
+func (r *FilesystemPermissionResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+}
+
+func (r *FilesystemPermissionResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+// apply sets the permissions and reads them back. The mode is only sent
+// when configured, since sending the current one would fail on paths with
+// a non-trivial ACL; without it, only the owner changes, with chown.
+func (r *FilesystemPermissionResource) apply(ctx context.Context, data *FilesystemPermissionResourceModel, configMode types.String, diags *diag.Diagnostics) {
+	perm := truenas.FilePermissions{
+		StripACL:  data.StripACL.ValueBool(),
+		Recursive: data.Recursive.ValueBool(),
+		Traverse:  data.Traverse.ValueBool(),
+	}
+	if mode, ok := fileMode(configMode); ok {
+		perm.Mode = &mode
+	}
+	if !data.UID.IsNull() && !data.UID.IsUnknown() {
+		perm.UID = data.UID.ValueInt64Pointer()
+	}
+	if !data.GID.IsNull() && !data.GID.IsUnknown() {
+		perm.GID = data.GID.ValueInt64Pointer()
+	}
+
+	var err error
+	switch {
+	case !data.DatasetID.IsNull():
+		err = r.client.SetDatasetPermission(ctx, data.DatasetID.ValueString(), perm)
+	case perm.Mode != nil || perm.StripACL:
+		err = r.client.SetFilePermissions(ctx, data.Path.ValueString(), perm)
+	default:
+		err = r.client.ChownFile(ctx, data.Path.ValueString(), perm)
+	}
+	if err != nil {
+		addClientError(diags, "set permissions", err, data, map[string]path.Path{
+			"options.stripacl": path.Root("strip_acl"),
+		})
+		return
+	}
+
+	if !r.readPermissions(ctx, data, diags) && !diags.HasError() {
+		diags.AddError("Client Error", fmt.Sprintf("Path %s disappeared after its permissions were set", data.Path.ValueString()))
+	}
+}
+
+// readPermissions refreshes the mode and owner of the path. found is
+// false, without a diagnostic, when the path does not exist.
+func (r *FilesystemPermissionResource) readPermissions(ctx context.Context, data *FilesystemPermissionResourceModel, diags *diag.Diagnostics) bool {
+	id := data.ID.ValueString()
+	acl, err := r.client.GetFilesystemACL(ctx, id)
+	if err != nil {
+		if truenas.IsNoEntry(err) {
+			return false
+		}
+		diags.AddError("Client Error", fmt.Sprintf("Unable to read ACL of %s, got error: %s", id, err))
+		return false
+	}
+	stat, err := r.client.StatFile(ctx, id)
+	if err != nil {
+		if truenas.IsNoEntry(err) {
+			return false
+		}
+		diags.AddError("Client Error", fmt.Sprintf("Unable to read %s, got error: %s", id, err))
+		return false
+	}
+
+	data.Path = data.ID
+	data.UID = types.Int64PointerValue(acl.UID)
+	data.GID = types.Int64PointerValue(acl.GID)
+	if mode, ok := fileMode(data.Mode); !ok || mode != stat.Permissions() {
+		data.Mode = types.StringValue(fmt.Sprintf("%04o", stat.Permissions()))
+	}
+	if data.StripACL.ValueBool() && !acl.Trivial {
+		// An ACL was added outside Terraform; planning strip_acl again
+		// strips it
+		data.StripACL = types.BoolValue(false)
+	}
+	return true
+}
+
+// datasetMountpoint returns the mountpoint of a filesystem dataset
+func (r *FilesystemPermissionResource) datasetMountpoint(ctx context.Context, id string, diags *diag.Diagnostics) (string, bool) {
+	respBody, err := r.client.Get(ctx, fmt.Sprintf("/pool/dataset/id/%s", url.PathEscape(id)))
+	if err != nil {
+		if truenas.IsNotFound(err) {
+			diags.AddAttributeError(path.Root("dataset_id"), "Dataset Not Found", fmt.Sprintf("Dataset %s does not exist.", id))
+			return "", false
+		}
+		diags.AddError("Client Error", fmt.Sprintf("Unable to read dataset %s, got error: %s", id, err))
+		return "", false
+	}
+
+	var result struct {
+		Mountpoint *string `json:"mountpoint"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		diags.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
+		return "", false
+	}
+	if result.Mountpoint == nil || *result.Mountpoint == "" {
+		diags.AddAttributeError(path.Root("dataset_id"), "Invalid Attribute Value", fmt.Sprintf("Dataset %s is not a mounted filesystem.", id))
+		return "", false
+	}
+	return *result.Mountpoint, true
+}
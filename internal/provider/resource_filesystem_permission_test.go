@@ -0,0 +1,138 @@
+package provider
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+// TestAccFilesystemPermissionResource_dataset tests permissions set through
+// the dataset, drift of the mode and import
+func TestAccFilesystemPermissionResource_dataset(t *testing.T) {
+	server := testAccFakeServer(t)
+	testAccACLDatasets(t, server)
+
+	config := testAccProviderConfig(server) + `
+resource "truenas_filesystem_permission" "posix" {
+  dataset_id = "tank/posix"
+  mode       = "0770"
+  uid        = 3000
+}
+`
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_filesystem_permission.posix", "id", "/mnt/tank/posix"),
+					resource.TestCheckResourceAttr("truenas_filesystem_permission.posix", "path", "/mnt/tank/posix"),
+					resource.TestCheckResourceAttr("truenas_filesystem_permission.posix", "gid", "0"),
+					testAccCheckFileMode(server, "/mnt/tank/posix", 0o770, 3000, 0),
+					testAccCheckFilesystemRequests(server, "/pool/dataset/id/tank%2Fposix/permission", 1),
+				),
+			},
+			{
+				// A mode changed outside Terraform is set again
+				PreConfig: func() {
+					if err := server.Chmod("/mnt/tank/posix", 0o777); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: config,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_filesystem_permission.posix", "mode", "0770"),
+					testAccCheckFileMode(server, "/mnt/tank/posix", 0o770, 3000, 0),
+					testAccCheckFilesystemRequests(server, "/pool/dataset/id/tank%2Fposix/permission", 2),
+				),
+			},
+			{
+				ResourceName:            "truenas_filesystem_permission.posix",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"dataset_id", "timeouts"},
+			},
+		},
+	})
+}
+
+// TestAccFilesystemPermissionResource_acl tests chown, the stripacl a mode
+// change needs on a path with an ACL, and an ACL added outside Terraform
+func TestAccFilesystemPermissionResource_acl(t *testing.T) {
+	server := testAccFakeServer(t)
+	testAccACLDatasets(t, server)
+	acl := []interface{}{
+		map[string]interface{}{"tag": "owner@", "type": "ALLOW", "perms": map[string]interface{}{"BASIC": "FULL_CONTROL"}, "flags": map[string]interface{}{"BASIC": "INHERIT"}},
+	}
+	if err := server.SetACL("/mnt/tank/smb", acl); err != nil {
+		t.Fatal(err)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				// Without a mode, only the owner changes and the ACL stays
+				Config: testAccProviderConfig(server) + `
+resource "truenas_filesystem_permission" "smb" {
+  path = "/mnt/tank/smb"
+  uid  = 3000
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_filesystem_permission.smb", "mode", "0755"),
+					testAccCheckFileMode(server, "/mnt/tank/smb", 0o755, 3000, 0),
+					testAccCheckHasACL(server, "/mnt/tank/smb", true),
+					testAccCheckFilesystemRequests(server, "/filesystem/chown", 1),
+				),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_filesystem_permission" "smb" {
+  path = "/mnt/tank/smb"
+  mode = "0750"
+  uid  = 3000
+}
+`,
+				ExpectError: regexp.MustCompile(`Non-trivial ACL present`),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_filesystem_permission" "smb" {
+  path      = "/mnt/tank/smb"
+  mode      = "0750"
+  uid       = 3000
+  strip_acl = true
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testAccCheckFileMode(server, "/mnt/tank/smb", 0o750, 3000, 0),
+					testAccCheckHasACL(server, "/mnt/tank/smb", false),
+				),
+			},
+			{
+				// An ACL added outside Terraform is stripped again
+				PreConfig: func() {
+					if err := server.SetACL("/mnt/tank/smb", acl); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: testAccProviderConfig(server) + `
+resource "truenas_filesystem_permission" "smb" {
+  path      = "/mnt/tank/smb"
+  mode      = "0750"
+  uid       = 3000
+  strip_acl = true
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_filesystem_permission.smb", "strip_acl", "true"),
+					testAccCheckHasACL(server, "/mnt/tank/smb", false),
+				),
+			},
+		},
+	})
+}
+
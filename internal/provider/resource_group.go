@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
@@ -34,6 +35,8 @@ type GroupResourceModel struct {
 	Sudo    types.Bool   `tfsdk:"sudo"`
 	SmbAuth types.Bool   `tfsdk:"smb"`
 	Users   types.List   `tfsdk:"users"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
 }
 
 func (r *GroupResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
@@ -77,6 +80,14 @@ func (r *GroupResource) Schema(ctx context.Context, req resource.SchemaRequest,
 				ElementType:         types.Int64Type,
 			},
 		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
 	}
 }
 
@@ -105,28 +116,39 @@ func (r *GroupResource) Create(ctx context.Context, req resource.CreateRequest,
 		return
 	}
 
+	createTimeout, diags := data.Timeouts.Create(ctx, defaultTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
 	createReq := map[string]interface{}{
 		"name": data.Name.ValueString(),
 	}
 
-	if !data.GID.IsNull() {
+	if !data.GID.IsNull() && !data.GID.IsUnknown() {
 		createReq["gid"] = data.GID.ValueInt64()
 	}
-	if !data.Sudo.IsNull() {
+	if !data.Sudo.IsNull() && !data.Sudo.IsUnknown() {
 		createReq["sudo"] = data.Sudo.ValueBool()
 	}
-	if !data.SmbAuth.IsNull() {
+	if !data.SmbAuth.IsNull() && !data.SmbAuth.IsUnknown() {
 		createReq["smb"] = data.SmbAuth.ValueBool()
 	}
-	if !data.Users.IsNull() {
+	if !data.Users.IsNull() && !data.Users.IsUnknown() {
 		var users []int64
 		resp.Diagnostics.Append(data.Users.ElementsAs(ctx, &users, false)...)
 		createReq["users"] = users
 	}
 
-	respBody, err := r.client.Post("/group", createReq)
+	// Not retried: a retry after a lost response would fail as a duplicate
+	// and leave the created object outside of state
+	respBody, err := r.client.Post(ctx, "/group", createReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create group, got error: %s", err))
+		addClientError(&resp.Diagnostics, "create group", err, &data, nil)
 		return
 	}
 
@@ -140,7 +162,9 @@ func (r *GroupResource) Create(ctx context.Context, req resource.CreateRequest,
 		data.ID = types.StringValue(strconv.Itoa(int(id)))
 	}
 
-	r.readGroup(ctx, &data, &resp.Diagnostics)
+	if !r.readGroup(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read group: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -152,11 +176,26 @@ func (r *GroupResource) Read(ctx context.Context, req resource.ReadRequest, resp
 		return
 	}
 
-	r.readGroup(ctx, &data, &resp.Diagnostics)
+	readTimeout, diags := data.Timeouts.Read(ctx, defaultTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	found := r.readGroup(ctx, &data, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !found {
+		// Deleted outside of Terraform; drop it from state so it is re-created
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -168,31 +207,42 @@ func (r *GroupResource) Update(ctx context.Context, req resource.UpdateRequest,
 		return
 	}
 
+	updateTimeout, diags := data.Timeouts.Update(ctx, defaultTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
 	updateReq := map[string]interface{}{}
 
-	if !data.Name.IsNull() {
+	if !data.Name.IsNull() && !data.Name.IsUnknown() {
 		updateReq["name"] = data.Name.ValueString()
 	}
-	if !data.Sudo.IsNull() {
+	if !data.Sudo.IsNull() && !data.Sudo.IsUnknown() {
 		updateReq["sudo"] = data.Sudo.ValueBool()
 	}
-	if !data.SmbAuth.IsNull() {
+	if !data.SmbAuth.IsNull() && !data.SmbAuth.IsUnknown() {
 		updateReq["smb"] = data.SmbAuth.ValueBool()
 	}
-	if !data.Users.IsNull() {
+	if !data.Users.IsNull() && !data.Users.IsUnknown() {
 		var users []int64
 		resp.Diagnostics.Append(data.Users.ElementsAs(ctx, &users, false)...)
 		updateReq["users"] = users
 	}
 
 	endpoint := fmt.Sprintf("/group/id/%s", data.ID.ValueString())
-	_, err := r.client.Put(endpoint, updateReq)
+	_, err := r.client.Put(ctx, endpoint, updateReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to update group, got error: %s", err))
+		addClientError(&resp.Diagnostics, "update group", err, &data, nil)
 		return
 	}
 
-	r.readGroup(ctx, &data, &resp.Diagnostics)
+	if !r.readGroup(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read group: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -204,8 +254,17 @@ func (r *GroupResource) Delete(ctx context.Context, req resource.DeleteRequest,
 		return
 	}
 
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, defaultTimeouts.Delete)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
 	endpoint := fmt.Sprintf("/group/id/%s", data.ID.ValueString())
-	_, err := r.client.Delete(endpoint)
+	_, err := r.client.Delete(ctx, endpoint)
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete group, got error: %s", err))
 		return
@@ -216,18 +275,23 @@ func (r *GroupResource) ImportState(ctx context.Context, req resource.ImportStat
 	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
 }
 
-func (r *GroupResource) readGroup(ctx context.Context, data *GroupResourceModel, diags *diag.Diagnostics) {
+// readGroup refreshes data from the API. It returns false, without adding a
+// diagnostic, when the group no longer exists.
+func (r *GroupResource) readGroup(ctx context.Context, data *GroupResourceModel, diags *diag.Diagnostics) bool {
 	endpoint := fmt.Sprintf("/group/id/%s", data.ID.ValueString())
-	respBody, err := r.client.Get(endpoint)
+	respBody, err := r.client.Get(ctx, endpoint)
 	if err != nil {
+		if truenas.IsNotFound(err) {
+			return false
+		}
 		diags.AddError("Client Error", fmt.Sprintf("Unable to read group, got error: %s", err))
-		return
+		return false
 	}
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(respBody, &result); err != nil {
 		diags.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
-		return
+		return false
 	}
 
 	if gid, ok := result["gid"].(float64); ok {
@@ -242,4 +306,18 @@ func (r *GroupResource) readGroup(ctx context.Context, data *GroupResourceModel,
 	if smb, ok := result["smb"].(bool); ok {
 		data.SmbAuth = types.BoolValue(smb)
 	}
+
+	users := []int64{}
+	if members, ok := result["users"].([]interface{}); ok {
+		for _, member := range members {
+			if id, ok := member.(float64); ok {
+				users = append(users, int64(id))
+			}
+		}
+	}
+	listValue, d := types.ListValueFrom(ctx, types.Int64Type, users)
+	diags.Append(d...)
+	data.Users = listValue
+
+	return true
 }
@@ -0,0 +1,52 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+// TestAccGroupResource tests creating, importing, updating and deleting a group
+func TestAccGroupResource(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "group", "truenas_group"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_group" "test" {
+  name = "media"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_group.test", "name", "media"),
+					resource.TestCheckResourceAttr("truenas_group.test", "gid", "3000"),
+					resource.TestCheckResourceAttr("truenas_group.test", "sudo", "false"),
+					resource.TestCheckResourceAttr("truenas_group.test", "smb", "true"),
+					resource.TestCheckResourceAttr("truenas_group.test", "users.#", "0"),
+				),
+			},
+			{
+				ResourceName:            "truenas_group.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"timeouts"},
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_group" "test" {
+  name = "media-admins"
+  sudo = true
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_group.test", "name", "media-admins"),
+					resource.TestCheckResourceAttr("truenas_group.test", "gid", "3000"),
+					resource.TestCheckResourceAttr("truenas_group.test", "sudo", "true"),
+				),
+			},
+		},
+	})
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
@@ -44,6 +46,8 @@ type InterfaceResourceModel struct {
 	// LAG specific
 	LAGPorts    types.List   `tfsdk:"lag_ports"`
 	LAGProtocol types.String `tfsdk:"lag_protocol"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
 }
 
 type InterfaceAlias struct {
@@ -145,6 +149,14 @@ func (r *InterfaceResource) Schema(ctx context.Context, req resource.SchemaReque
 				Optional:            true,
 			},
 		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
 	}
 }
 
@@ -173,26 +185,35 @@ func (r *InterfaceResource) Create(ctx context.Context, req resource.CreateReque
 		return
 	}
 
+	createTimeout, diags := data.Timeouts.Create(ctx, defaultTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
 	createReq := map[string]interface{}{
 		"name": data.Name.ValueString(),
 		"type": data.Type.ValueString(),
 	}
 
-	if !data.Description.IsNull() {
+	if !data.Description.IsNull() && !data.Description.IsUnknown() {
 		createReq["description"] = data.Description.ValueString()
 	}
-	if !data.IPV4DHCP.IsNull() {
+	if !data.IPV4DHCP.IsNull() && !data.IPV4DHCP.IsUnknown() {
 		createReq["ipv4_dhcp"] = data.IPV4DHCP.ValueBool()
 	}
-	if !data.IPV6Auto.IsNull() {
+	if !data.IPV6Auto.IsNull() && !data.IPV6Auto.IsUnknown() {
 		createReq["ipv6_auto"] = data.IPV6Auto.ValueBool()
 	}
-	if !data.MTU.IsNull() {
+	if !data.MTU.IsNull() && !data.MTU.IsUnknown() {
 		createReq["mtu"] = data.MTU.ValueInt64()
 	}
 
 	// Handle aliases
-	if !data.Aliases.IsNull() {
+	if !data.Aliases.IsNull() && !data.Aliases.IsUnknown() {
 		var aliasList []InterfaceAlias
 		data.Aliases.ElementsAs(ctx, &aliasList, false)
 
@@ -208,36 +229,36 @@ func (r *InterfaceResource) Create(ctx context.Context, req resource.CreateReque
 	}
 
 	// VLAN specific
-	if !data.VLANParentInterface.IsNull() {
+	if !data.VLANParentInterface.IsNull() && !data.VLANParentInterface.IsUnknown() {
 		createReq["vlan_parent_interface"] = data.VLANParentInterface.ValueString()
 	}
-	if !data.VLANTag.IsNull() {
+	if !data.VLANTag.IsNull() && !data.VLANTag.IsUnknown() {
 		createReq["vlan_tag"] = data.VLANTag.ValueInt64()
 	}
-	if !data.VLANPCP.IsNull() {
+	if !data.VLANPCP.IsNull() && !data.VLANPCP.IsUnknown() {
 		createReq["vlan_pcp"] = data.VLANPCP.ValueInt64()
 	}
 
 	// Bridge specific
-	if !data.BridgeMembers.IsNull() {
+	if !data.BridgeMembers.IsNull() && !data.BridgeMembers.IsUnknown() {
 		var members []string
 		data.BridgeMembers.ElementsAs(ctx, &members, false)
 		createReq["bridge_members"] = members
 	}
 
 	// LAG specific
-	if !data.LAGPorts.IsNull() {
+	if !data.LAGPorts.IsNull() && !data.LAGPorts.IsUnknown() {
 		var ports []string
 		data.LAGPorts.ElementsAs(ctx, &ports, false)
 		createReq["lag_ports"] = ports
 	}
-	if !data.LAGProtocol.IsNull() {
+	if !data.LAGProtocol.IsNull() && !data.LAGProtocol.IsUnknown() {
 		createReq["lag_protocol"] = data.LAGProtocol.ValueString()
 	}
 
-	respBody, err := r.client.Post("/interface", createReq)
+	respBody, err := r.client.Post(ctx, "/interface", createReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create interface, got error: %s", err))
+		addClientError(&resp.Diagnostics, "create interface", err, &data, nil)
 		return
 	}
 
@@ -253,7 +274,9 @@ func (r *InterfaceResource) Create(ctx context.Context, req resource.CreateReque
 		data.ID = types.StringValue(name)
 	}
 
-	r.readInterface(ctx, &data, &resp.Diagnostics)
+	if !r.readInterface(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read interface: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -265,11 +288,26 @@ func (r *InterfaceResource) Read(ctx context.Context, req resource.ReadRequest,
 		return
 	}
 
-	r.readInterface(ctx, &data, &resp.Diagnostics)
+	readTimeout, diags := data.Timeouts.Read(ctx, defaultTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	found := r.readInterface(ctx, &data, &resp.Diagnostics)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
+	if !found {
+		// Deleted outside of Terraform; drop it from state so it is re-created
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -281,26 +319,53 @@ func (r *InterfaceResource) Update(ctx context.Context, req resource.UpdateReque
 		return
 	}
 
+	updateTimeout, diags := data.Timeouts.Update(ctx, defaultTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
 	updateReq := map[string]interface{}{}
 
-	if !data.Description.IsNull() {
+	if !data.Description.IsNull() && !data.Description.IsUnknown() {
 		updateReq["description"] = data.Description.ValueString()
 	}
-	if !data.IPV4DHCP.IsNull() {
+	if !data.IPV4DHCP.IsNull() && !data.IPV4DHCP.IsUnknown() {
 		updateReq["ipv4_dhcp"] = data.IPV4DHCP.ValueBool()
 	}
-	if !data.IPV6Auto.IsNull() {
+	if !data.IPV6Auto.IsNull() && !data.IPV6Auto.IsUnknown() {
 		updateReq["ipv6_auto"] = data.IPV6Auto.ValueBool()
 	}
+	if !data.MTU.IsNull() && !data.MTU.IsUnknown() {
+		updateReq["mtu"] = data.MTU.ValueInt64()
+	}
+	if !data.Aliases.IsNull() && !data.Aliases.IsUnknown() {
+		var aliasList []InterfaceAlias
+		data.Aliases.ElementsAs(ctx, &aliasList, false)
+
+		aliases := make([]map[string]interface{}, 0, len(aliasList))
+		for _, a := range aliasList {
+			aliases = append(aliases, map[string]interface{}{
+				"address": a.Address.ValueString(),
+				"netmask": a.Netmask.ValueInt64(),
+			})
+		}
+		updateReq["aliases"] = aliases
+	}
 
 	endpoint := fmt.Sprintf("/interface/id/%s", data.ID.ValueString())
-	_, err := r.client.Put(endpoint, updateReq)
+	_, err := r.client.Put(ctx, endpoint, updateReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to update interface, got error: %s", err))
+		addClientError(&resp.Diagnostics, "update interface", err, &data, nil)
 		return
 	}
 
-	r.readInterface(ctx, &data, &resp.Diagnostics)
+	if !r.readInterface(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read interface: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -312,8 +377,17 @@ func (r *InterfaceResource) Delete(ctx context.Context, req resource.DeleteReque
 		return
 	}
 
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, defaultTimeouts.Delete)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
 	endpoint := fmt.Sprintf("/interface/id/%s", data.ID.ValueString())
-	_, err := r.client.Delete(endpoint)
+	_, err := r.client.Delete(ctx, endpoint)
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete interface, got error: %s", err))
 		return
@@ -324,18 +398,23 @@ func (r *InterfaceResource) ImportState(ctx context.Context, req resource.Import
 	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
 }
 
-func (r *InterfaceResource) readInterface(ctx context.Context, data *InterfaceResourceModel, diags *diag.Diagnostics) {
+// readInterface refreshes data from the API. It returns false, without adding a
+// diagnostic, when the interface no longer exists.
+func (r *InterfaceResource) readInterface(ctx context.Context, data *InterfaceResourceModel, diags *diag.Diagnostics) bool {
 	endpoint := fmt.Sprintf("/interface/id/%s", data.ID.ValueString())
-	respBody, err := r.client.Get(endpoint)
+	respBody, err := r.client.Get(ctx, endpoint)
 	if err != nil {
+		if truenas.IsNotFound(err) {
+			return false
+		}
 		diags.AddError("Client Error", fmt.Sprintf("Unable to read interface, got error: %s", err))
-		return
+		return false
 	}
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(respBody, &result); err != nil {
 		diags.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
-		return
+		return false
 	}
 
 	if name, ok := result["name"].(string); ok {
@@ -356,5 +435,38 @@ func (r *InterfaceResource) readInterface(ctx context.Context, data *InterfaceRe
 	}
 	if mtu, ok := result["mtu"].(float64); ok {
 		data.MTU = types.Int64Value(int64(mtu))
+	} else {
+		data.MTU = types.Int64Null()
+	}
+	if pcp, ok := result["vlan_pcp"].(float64); ok {
+		data.VLANPCP = types.Int64Value(int64(pcp))
+	} else {
+		data.VLANPCP = types.Int64Null()
+	}
+
+	aliasList := []InterfaceAlias{}
+	if aliases, ok := result["aliases"].([]interface{}); ok {
+		for _, a := range aliases {
+			if aliasMap, ok := a.(map[string]interface{}); ok {
+				alias := InterfaceAlias{}
+				if address, ok := aliasMap["address"].(string); ok {
+					alias.Address = types.StringValue(address)
+				}
+				if netmask, ok := aliasMap["netmask"].(float64); ok {
+					alias.Netmask = types.Int64Value(int64(netmask))
+				}
+				aliasList = append(aliasList, alias)
+			}
+		}
 	}
+	list, d := types.ListValueFrom(ctx, types.ObjectType{
+		AttrTypes: map[string]attr.Type{
+			"address": types.StringType,
+			"netmask": types.Int64Type,
+		},
+	}, aliasList)
+	diags.Append(d...)
+	data.Aliases = list
+
+	return true
 }
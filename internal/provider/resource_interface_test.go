@@ -0,0 +1,93 @@
+package provider
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+// TestAccInterfaceResource tests creating, importing, updating and deleting a VLAN interface
+func TestAccInterfaceResource(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "interface", "truenas_interface"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_interface" "test" {
+  name                  = "vlan20"
+  type                  = "VLAN"
+  vlan_parent_interface = "eno1"
+  vlan_tag              = 20
+  description           = "Storage VLAN"
+
+  aliases = [
+    { address = "10.20.0.10", netmask = 24 },
+  ]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_interface.test", "id", "vlan20"),
+					resource.TestCheckResourceAttr("truenas_interface.test", "description", "Storage VLAN"),
+					resource.TestCheckResourceAttr("truenas_interface.test", "ipv4_dhcp", "false"),
+					resource.TestCheckResourceAttr("truenas_interface.test", "aliases.#", "1"),
+					resource.TestCheckResourceAttr("truenas_interface.test", "aliases.0.address", "10.20.0.10"),
+					resource.TestCheckNoResourceAttr("truenas_interface.test", "mtu"),
+				),
+			},
+			{
+				ResourceName:            "truenas_interface.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"vlan_parent_interface", "vlan_tag", "timeouts"},
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_interface" "test" {
+  name                  = "vlan20"
+  type                  = "VLAN"
+  vlan_parent_interface = "eno1"
+  vlan_tag              = 20
+  description           = "Storage VLAN (jumbo frames)"
+  mtu                   = 9000
+
+  aliases = [
+    { address = "10.20.0.10", netmask = 24 },
+    { address = "10.20.0.11", netmask = 24 },
+  ]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_interface.test", "description", "Storage VLAN (jumbo frames)"),
+					resource.TestCheckResourceAttr("truenas_interface.test", "mtu", "9000"),
+					resource.TestCheckResourceAttr("truenas_interface.test", "aliases.#", "2"),
+				),
+			},
+		},
+	})
+}
+
+// TestAccInterfaceResource_missingParent tests that a VLAN on a missing parent is rejected
+func TestAccInterfaceResource_missingParent(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_interface" "test" {
+  name                  = "vlan30"
+  type                  = "VLAN"
+  vlan_parent_interface = "eno9"
+  vlan_tag              = 30
+}
+`,
+				ExpectError: regexp.MustCompile(`Interface "eno9" not found`),
+			},
+		},
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
@@ -44,6 +45,13 @@ type ISCSIExtentResourceModel struct {
 	RPM            types.String `tfsdk:"rpm"`
 	Xen            types.Bool   `tfsdk:"xen"`
 	InsecureTPC    types.Bool   `tfsdk:"insecure_tpc"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
+}
+
+// iscsiExtentAPIFields maps iSCSI extent API fields whose names differ from the schema
+var iscsiExtentAPIFields = map[string]path.Path{
+	"ro": path.Root("readonly"),
 }
 
 func (r *ISCSIExtentResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
@@ -136,6 +144,14 @@ func (r *ISCSIExtentResource) Schema(ctx context.Context, req resource.SchemaReq
 				Computed:            true,
 			},
 		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
 	}
 }
 
@@ -164,54 +180,63 @@ func (r *ISCSIExtentResource) Create(ctx context.Context, req resource.CreateReq
 		return
 	}
 
+	createTimeout, diags := data.Timeouts.Create(ctx, defaultTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
 	createReq := map[string]interface{}{
 		"name": data.Name.ValueString(),
 		"type": data.Type.ValueString(),
 	}
 
-	if !data.Disk.IsNull() {
+	if !data.Disk.IsNull() && !data.Disk.IsUnknown() {
 		createReq["disk"] = data.Disk.ValueString()
 	}
-	if !data.Path.IsNull() {
+	if !data.Path.IsNull() && !data.Path.IsUnknown() {
 		createReq["path"] = data.Path.ValueString()
 	}
-	if !data.Filesize.IsNull() {
+	if !data.Filesize.IsNull() && !data.Filesize.IsUnknown() {
 		createReq["filesize"] = data.Filesize.ValueInt64()
 	}
-	if !data.Comment.IsNull() {
+	if !data.Comment.IsNull() && !data.Comment.IsUnknown() {
 		createReq["comment"] = data.Comment.ValueString()
 	}
-	if !data.Enabled.IsNull() {
+	if !data.Enabled.IsNull() && !data.Enabled.IsUnknown() {
 		createReq["enabled"] = data.Enabled.ValueBool()
 	}
-	if !data.ReadOnly.IsNull() {
+	if !data.ReadOnly.IsNull() && !data.ReadOnly.IsUnknown() {
 		createReq["ro"] = data.ReadOnly.ValueBool()
 	}
-	if !data.Blocksize.IsNull() {
+	if !data.Blocksize.IsNull() && !data.Blocksize.IsUnknown() {
 		createReq["blocksize"] = data.Blocksize.ValueInt64()
 	}
-	if !data.PBlocksize.IsNull() {
+	if !data.PBlocksize.IsNull() && !data.PBlocksize.IsUnknown() {
 		createReq["pblocksize"] = data.PBlocksize.ValueBool()
 	}
-	if !data.AvailThreshold.IsNull() {
+	if !data.AvailThreshold.IsNull() && !data.AvailThreshold.IsUnknown() {
 		createReq["avail_threshold"] = data.AvailThreshold.ValueInt64()
 	}
-	if !data.Serial.IsNull() {
+	if !data.Serial.IsNull() && !data.Serial.IsUnknown() {
 		createReq["serial"] = data.Serial.ValueString()
 	}
-	if !data.RPM.IsNull() {
+	if !data.RPM.IsNull() && !data.RPM.IsUnknown() {
 		createReq["rpm"] = data.RPM.ValueString()
 	}
-	if !data.Xen.IsNull() {
+	if !data.Xen.IsNull() && !data.Xen.IsUnknown() {
 		createReq["xen"] = data.Xen.ValueBool()
 	}
-	if !data.InsecureTPC.IsNull() {
+	if !data.InsecureTPC.IsNull() && !data.InsecureTPC.IsUnknown() {
 		createReq["insecure_tpc"] = data.InsecureTPC.ValueBool()
 	}
 
-	respBody, err := r.client.Post("/iscsi/extent", createReq)
+	respBody, err := r.client.Post(ctx, "/iscsi/extent", createReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create iSCSI extent, got error: %s", err))
+		addClientError(&resp.Diagnostics, "create iSCSI extent", err, &data, iscsiExtentAPIFields)
 		return
 	}
 
@@ -225,7 +250,9 @@ func (r *ISCSIExtentResource) Create(ctx context.Context, req resource.CreateReq
 		data.ID = types.StringValue(strconv.Itoa(int(id)))
 	}
 
-	r.readISCSIExtent(ctx, &data, &resp.Diagnostics)
+	if !r.readISCSIExtent(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read iSCSI extent: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -237,11 +264,26 @@ func (r *ISCSIExtentResource) Read(ctx context.Context, req resource.ReadRequest
 		return
 	}
 
-	r.readISCSIExtent(ctx, &data, &resp.Diagnostics)
+	readTimeout, diags := data.Timeouts.Read(ctx, defaultTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	found := r.readISCSIExtent(ctx, &data, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !found {
+		// Deleted outside of Terraform; drop it from state so it is re-created
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -253,29 +295,40 @@ func (r *ISCSIExtentResource) Update(ctx context.Context, req resource.UpdateReq
 		return
 	}
 
+	updateTimeout, diags := data.Timeouts.Update(ctx, defaultTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
 	updateReq := map[string]interface{}{}
 
-	if !data.Name.IsNull() {
+	if !data.Name.IsNull() && !data.Name.IsUnknown() {
 		updateReq["name"] = data.Name.ValueString()
 	}
-	if !data.Comment.IsNull() {
+	if !data.Comment.IsNull() && !data.Comment.IsUnknown() {
 		updateReq["comment"] = data.Comment.ValueString()
 	}
-	if !data.Enabled.IsNull() {
+	if !data.Enabled.IsNull() && !data.Enabled.IsUnknown() {
 		updateReq["enabled"] = data.Enabled.ValueBool()
 	}
-	if !data.ReadOnly.IsNull() {
+	if !data.ReadOnly.IsNull() && !data.ReadOnly.IsUnknown() {
 		updateReq["ro"] = data.ReadOnly.ValueBool()
 	}
 
 	endpoint := fmt.Sprintf("/iscsi/extent/id/%s", data.ID.ValueString())
-	_, err := r.client.Put(endpoint, updateReq)
+	_, err := r.client.Put(ctx, endpoint, updateReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to update iSCSI extent, got error: %s", err))
+		addClientError(&resp.Diagnostics, "update iSCSI extent", err, &data, iscsiExtentAPIFields)
 		return
 	}
 
-	r.readISCSIExtent(ctx, &data, &resp.Diagnostics)
+	if !r.readISCSIExtent(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read iSCSI extent: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -287,8 +340,17 @@ func (r *ISCSIExtentResource) Delete(ctx context.Context, req resource.DeleteReq
 		return
 	}
 
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, defaultTimeouts.Delete)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
 	endpoint := fmt.Sprintf("/iscsi/extent/id/%s", data.ID.ValueString())
-	_, err := r.client.Delete(endpoint)
+	_, err := r.client.Delete(ctx, endpoint)
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete iSCSI extent, got error: %s", err))
 		return
@@ -299,18 +361,23 @@ func (r *ISCSIExtentResource) ImportState(ctx context.Context, req resource.Impo
 	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
 }
 
-func (r *ISCSIExtentResource) readISCSIExtent(ctx context.Context, data *ISCSIExtentResourceModel, diags *diag.Diagnostics) {
+// readISCSIExtent refreshes data from the API. It returns false, without adding a
+// diagnostic, when the iSCSI extent no longer exists.
+func (r *ISCSIExtentResource) readISCSIExtent(ctx context.Context, data *ISCSIExtentResourceModel, diags *diag.Diagnostics) bool {
 	endpoint := fmt.Sprintf("/iscsi/extent/id/%s", data.ID.ValueString())
-	respBody, err := r.client.Get(endpoint)
+	respBody, err := r.client.Get(ctx, endpoint)
 	if err != nil {
+		if truenas.IsNotFound(err) {
+			return false
+		}
 		diags.AddError("Client Error", fmt.Sprintf("Unable to read iSCSI extent, got error: %s", err))
-		return
+		return false
 	}
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(respBody, &result); err != nil {
 		diags.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
-		return
+		return false
 	}
 
 	if name, ok := result["name"].(string); ok {
@@ -319,10 +386,12 @@ func (r *ISCSIExtentResource) readISCSIExtent(ctx context.Context, data *ISCSIEx
 	if extentType, ok := result["type"].(string); ok {
 		data.Type = types.StringValue(extentType)
 	}
+	// The API also reports the device path of DISK extents, which is not
+	// part of the configuration
 	if disk, ok := result["disk"].(string); ok && disk != "" {
 		data.Disk = types.StringValue(disk)
 	}
-	if path, ok := result["path"].(string); ok && path != "" {
+	if path, ok := result["path"].(string); ok && path != "" && data.Type.ValueString() == "FILE" {
 		data.Path = types.StringValue(path)
 	}
 	if filesize, ok := result["filesize"].(float64); ok {
@@ -340,4 +409,26 @@ func (r *ISCSIExtentResource) readISCSIExtent(ctx context.Context, data *ISCSIEx
 	if blocksize, ok := result["blocksize"].(float64); ok {
 		data.Blocksize = types.Int64Value(int64(blocksize))
 	}
+	if pblocksize, ok := result["pblocksize"].(bool); ok {
+		data.PBlocksize = types.BoolValue(pblocksize)
+	}
+	if threshold, ok := result["avail_threshold"].(float64); ok {
+		data.AvailThreshold = types.Int64Value(int64(threshold))
+	} else {
+		data.AvailThreshold = types.Int64Null()
+	}
+	if serial, ok := result["serial"].(string); ok {
+		data.Serial = types.StringValue(serial)
+	}
+	if rpm, ok := result["rpm"].(string); ok {
+		data.RPM = types.StringValue(rpm)
+	}
+	if xen, ok := result["xen"].(bool); ok {
+		data.Xen = types.BoolValue(xen)
+	}
+	if insecureTPC, ok := result["insecure_tpc"].(bool); ok {
+		data.InsecureTPC = types.BoolValue(insecureTPC)
+	}
+
+	return true
 }
@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+// TestAccISCSIExtentResource tests creating, importing, updating and deleting
+// a zvol-backed iSCSI extent
+func TestAccISCSIExtentResource(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "iscsi/extent", "truenas_iscsi_extent"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset" "lun" {
+  name    = "tank/lun0"
+  type    = "VOLUME"
+  volsize = 10737418240
+}
+
+resource "truenas_iscsi_extent" "test" {
+  name = "lun0"
+  type = "DISK"
+  disk = "zvol/${truenas_dataset.lun.name}"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_iscsi_extent.test", "name", "lun0"),
+					resource.TestCheckResourceAttr("truenas_iscsi_extent.test", "disk", "zvol/tank/lun0"),
+					resource.TestCheckNoResourceAttr("truenas_iscsi_extent.test", "path"),
+					resource.TestCheckResourceAttr("truenas_iscsi_extent.test", "blocksize", "512"),
+					resource.TestCheckResourceAttr("truenas_iscsi_extent.test", "rpm", "SSD"),
+					resource.TestCheckResourceAttrSet("truenas_iscsi_extent.test", "serial"),
+				),
+			},
+			{
+				ResourceName:            "truenas_iscsi_extent.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"timeouts"},
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset" "lun" {
+  name    = "tank/lun0"
+  type    = "VOLUME"
+  volsize = 10737418240
+}
+
+resource "truenas_iscsi_extent" "test" {
+  name     = "lun0"
+  type     = "DISK"
+  disk     = "zvol/${truenas_dataset.lun.name}"
+  comment  = "Database LUN"
+  readonly = true
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_iscsi_extent.test", "comment", "Database LUN"),
+					resource.TestCheckResourceAttr("truenas_iscsi_extent.test", "readonly", "true"),
+				),
+			},
+		},
+	})
+}
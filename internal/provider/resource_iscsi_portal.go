@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
 	"github.com/hashicorp/terraform-plugin-framework/attr"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
@@ -34,6 +35,8 @@ type ISCSIPortalResourceModel struct {
 	DiscoveryAuthMethod types.String `tfsdk:"discovery_authmethod"`
 	DiscoveryAuthGroup  types.Int64  `tfsdk:"discovery_authgroup"`
 	Listen              types.List   `tfsdk:"listen"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
 }
 
 type ISCSIPortalListen struct {
@@ -89,6 +92,14 @@ func (r *ISCSIPortalResource) Schema(ctx context.Context, req resource.SchemaReq
 				},
 			},
 		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
 	}
 }
 
@@ -117,15 +128,24 @@ func (r *ISCSIPortalResource) Create(ctx context.Context, req resource.CreateReq
 		return
 	}
 
+	createTimeout, diags := data.Timeouts.Create(ctx, defaultTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
 	createReq := map[string]interface{}{}
 
-	if !data.Comment.IsNull() {
+	if !data.Comment.IsNull() && !data.Comment.IsUnknown() {
 		createReq["comment"] = data.Comment.ValueString()
 	}
-	if !data.DiscoveryAuthMethod.IsNull() {
+	if !data.DiscoveryAuthMethod.IsNull() && !data.DiscoveryAuthMethod.IsUnknown() {
 		createReq["discovery_authmethod"] = data.DiscoveryAuthMethod.ValueString()
 	}
-	if !data.DiscoveryAuthGroup.IsNull() {
+	if !data.DiscoveryAuthGroup.IsNull() && !data.DiscoveryAuthGroup.IsUnknown() {
 		createReq["discovery_authgroup"] = data.DiscoveryAuthGroup.ValueInt64()
 	}
 
@@ -138,7 +158,7 @@ func (r *ISCSIPortalResource) Create(ctx context.Context, req resource.CreateReq
 		entry := map[string]interface{}{
 			"ip": l.IP.ValueString(),
 		}
-		if !l.Port.IsNull() {
+		if !l.Port.IsNull() && !l.Port.IsUnknown() {
 			entry["port"] = l.Port.ValueInt64()
 		} else {
 			entry["port"] = 3260
@@ -147,9 +167,9 @@ func (r *ISCSIPortalResource) Create(ctx context.Context, req resource.CreateReq
 	}
 	createReq["listen"] = listen
 
-	respBody, err := r.client.Post("/iscsi/portal", createReq)
+	respBody, err := r.client.Post(ctx, "/iscsi/portal", createReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create iSCSI portal, got error: %s", err))
+		addClientError(&resp.Diagnostics, "create iSCSI portal", err, &data, nil)
 		return
 	}
 
@@ -163,7 +183,9 @@ func (r *ISCSIPortalResource) Create(ctx context.Context, req resource.CreateReq
 		data.ID = types.StringValue(strconv.Itoa(int(id)))
 	}
 
-	r.readISCSIPortal(ctx, &data, &resp.Diagnostics)
+	if !r.readISCSIPortal(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read iSCSI portal: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -175,11 +197,26 @@ func (r *ISCSIPortalResource) Read(ctx context.Context, req resource.ReadRequest
 		return
 	}
 
-	r.readISCSIPortal(ctx, &data, &resp.Diagnostics)
+	readTimeout, diags := data.Timeouts.Read(ctx, defaultTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	found := r.readISCSIPortal(ctx, &data, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !found {
+		// Deleted outside of Terraform; drop it from state so it is re-created
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -191,15 +228,24 @@ func (r *ISCSIPortalResource) Update(ctx context.Context, req resource.UpdateReq
 		return
 	}
 
+	updateTimeout, diags := data.Timeouts.Update(ctx, defaultTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
 	updateReq := map[string]interface{}{}
 
-	if !data.Comment.IsNull() {
+	if !data.Comment.IsNull() && !data.Comment.IsUnknown() {
 		updateReq["comment"] = data.Comment.ValueString()
 	}
-	if !data.DiscoveryAuthMethod.IsNull() {
+	if !data.DiscoveryAuthMethod.IsNull() && !data.DiscoveryAuthMethod.IsUnknown() {
 		updateReq["discovery_authmethod"] = data.DiscoveryAuthMethod.ValueString()
 	}
-	if !data.DiscoveryAuthGroup.IsNull() {
+	if !data.DiscoveryAuthGroup.IsNull() && !data.DiscoveryAuthGroup.IsUnknown() {
 		updateReq["discovery_authgroup"] = data.DiscoveryAuthGroup.ValueInt64()
 	}
 
@@ -212,7 +258,7 @@ func (r *ISCSIPortalResource) Update(ctx context.Context, req resource.UpdateReq
 		entry := map[string]interface{}{
 			"ip": l.IP.ValueString(),
 		}
-		if !l.Port.IsNull() {
+		if !l.Port.IsNull() && !l.Port.IsUnknown() {
 			entry["port"] = l.Port.ValueInt64()
 		} else {
 			entry["port"] = 3260
@@ -222,13 +268,15 @@ func (r *ISCSIPortalResource) Update(ctx context.Context, req resource.UpdateReq
 	updateReq["listen"] = listen
 
 	endpoint := fmt.Sprintf("/iscsi/portal/id/%s", data.ID.ValueString())
-	_, err := r.client.Put(endpoint, updateReq)
+	_, err := r.client.Put(ctx, endpoint, updateReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to update iSCSI portal, got error: %s", err))
+		addClientError(&resp.Diagnostics, "update iSCSI portal", err, &data, nil)
 		return
 	}
 
-	r.readISCSIPortal(ctx, &data, &resp.Diagnostics)
+	if !r.readISCSIPortal(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read iSCSI portal: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -240,8 +288,17 @@ func (r *ISCSIPortalResource) Delete(ctx context.Context, req resource.DeleteReq
 		return
 	}
 
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, defaultTimeouts.Delete)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
 	endpoint := fmt.Sprintf("/iscsi/portal/id/%s", data.ID.ValueString())
-	_, err := r.client.Delete(endpoint)
+	_, err := r.client.Delete(ctx, endpoint)
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete iSCSI portal, got error: %s", err))
 		return
@@ -252,18 +309,23 @@ func (r *ISCSIPortalResource) ImportState(ctx context.Context, req resource.Impo
 	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
 }
 
-func (r *ISCSIPortalResource) readISCSIPortal(ctx context.Context, data *ISCSIPortalResourceModel, diags *diag.Diagnostics) {
+// readISCSIPortal refreshes data from the API. It returns false, without adding a
+// diagnostic, when the iSCSI portal no longer exists.
+func (r *ISCSIPortalResource) readISCSIPortal(ctx context.Context, data *ISCSIPortalResourceModel, diags *diag.Diagnostics) bool {
 	endpoint := fmt.Sprintf("/iscsi/portal/id/%s", data.ID.ValueString())
-	respBody, err := r.client.Get(endpoint)
+	respBody, err := r.client.Get(ctx, endpoint)
 	if err != nil {
+		if truenas.IsNotFound(err) {
+			return false
+		}
 		diags.AddError("Client Error", fmt.Sprintf("Unable to read iSCSI portal, got error: %s", err))
-		return
+		return false
 	}
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(respBody, &result); err != nil {
 		diags.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
-		return
+		return false
 	}
 
 	if comment, ok := result["comment"].(string); ok {
@@ -274,6 +336,8 @@ func (r *ISCSIPortalResource) readISCSIPortal(ctx context.Context, data *ISCSIPo
 	}
 	if authgroup, ok := result["discovery_authgroup"].(float64); ok {
 		data.DiscoveryAuthGroup = types.Int64Value(int64(authgroup))
+	} else {
+		data.DiscoveryAuthGroup = types.Int64Null()
 	}
 
 	if listen, ok := result["listen"].([]interface{}); ok {
@@ -298,4 +362,6 @@ func (r *ISCSIPortalResource) readISCSIPortal(ctx context.Context, data *ISCSIPo
 		}, listenList)
 		data.Listen = list
 	}
+
+	return true
 }
@@ -0,0 +1,60 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+// TestAccISCSIPortalResource tests creating, importing, updating and deleting an iSCSI portal
+func TestAccISCSIPortalResource(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "iscsi/portal", "truenas_iscsi_portal"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_iscsi_portal" "test" {
+  comment = "Storage network"
+
+  listen = [
+    { ip = "10.0.0.10" },
+  ]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_iscsi_portal.test", "comment", "Storage network"),
+					resource.TestCheckResourceAttr("truenas_iscsi_portal.test", "discovery_authmethod", "NONE"),
+					resource.TestCheckResourceAttr("truenas_iscsi_portal.test", "listen.#", "1"),
+					resource.TestCheckResourceAttr("truenas_iscsi_portal.test", "listen.0.ip", "10.0.0.10"),
+					resource.TestCheckResourceAttr("truenas_iscsi_portal.test", "listen.0.port", "3260"),
+				),
+			},
+			{
+				ResourceName:            "truenas_iscsi_portal.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"timeouts"},
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_iscsi_portal" "test" {
+  comment = "Storage networks"
+
+  listen = [
+    { ip = "10.0.0.10" },
+    { ip = "10.0.1.10", port = 3261 },
+  ]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_iscsi_portal.test", "comment", "Storage networks"),
+					resource.TestCheckResourceAttr("truenas_iscsi_portal.test", "listen.#", "2"),
+					resource.TestCheckResourceAttr("truenas_iscsi_portal.test", "listen.1.port", "3261"),
+				),
+			},
+		},
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
@@ -34,6 +35,8 @@ type ISCSITargetResourceModel struct {
 	Mode         types.String `tfsdk:"mode"`
 	Groups       types.List   `tfsdk:"groups"`
 	AuthNetworks types.List   `tfsdk:"auth_networks"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
 }
 
 func (r *ISCSITargetResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
@@ -78,6 +81,14 @@ func (r *ISCSITargetResource) Schema(ctx context.Context, req resource.SchemaReq
 				Computed:            true,
 			},
 		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
 	}
 }
 
@@ -106,30 +117,39 @@ func (r *ISCSITargetResource) Create(ctx context.Context, req resource.CreateReq
 		return
 	}
 
+	createTimeout, diags := data.Timeouts.Create(ctx, defaultTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
 	createReq := map[string]interface{}{
 		"name": data.Name.ValueString(),
 	}
 
-	if !data.Alias.IsNull() {
+	if !data.Alias.IsNull() && !data.Alias.IsUnknown() {
 		createReq["alias"] = data.Alias.ValueString()
 	}
-	if !data.Mode.IsNull() {
+	if !data.Mode.IsNull() && !data.Mode.IsUnknown() {
 		createReq["mode"] = data.Mode.ValueString()
 	}
-	if !data.Groups.IsNull() {
+	if !data.Groups.IsNull() && !data.Groups.IsUnknown() {
 		var groups []int64
 		data.Groups.ElementsAs(ctx, &groups, false)
-		createReq["groups"] = groups
+		createReq["groups"] = iscsiTargetGroups(groups)
 	}
-	if !data.AuthNetworks.IsNull() {
+	if !data.AuthNetworks.IsNull() && !data.AuthNetworks.IsUnknown() {
 		var networks []string
 		data.AuthNetworks.ElementsAs(ctx, &networks, false)
 		createReq["auth_networks"] = networks
 	}
 
-	respBody, err := r.client.Post("/iscsi/target", createReq)
+	respBody, err := r.client.Post(ctx, "/iscsi/target", createReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create iSCSI target, got error: %s", err))
+		addClientError(&resp.Diagnostics, "create iSCSI target", err, &data, nil)
 		return
 	}
 
@@ -143,7 +163,9 @@ func (r *ISCSITargetResource) Create(ctx context.Context, req resource.CreateReq
 		data.ID = types.StringValue(strconv.Itoa(int(id)))
 	}
 
-	r.readISCSITarget(ctx, &data, &resp.Diagnostics)
+	if !r.readISCSITarget(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read iSCSI target: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -155,11 +177,26 @@ func (r *ISCSITargetResource) Read(ctx context.Context, req resource.ReadRequest
 		return
 	}
 
-	r.readISCSITarget(ctx, &data, &resp.Diagnostics)
+	readTimeout, diags := data.Timeouts.Read(ctx, defaultTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	found := r.readISCSITarget(ctx, &data, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !found {
+		// Deleted outside of Terraform; drop it from state so it is re-created
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -171,36 +208,47 @@ func (r *ISCSITargetResource) Update(ctx context.Context, req resource.UpdateReq
 		return
 	}
 
+	updateTimeout, diags := data.Timeouts.Update(ctx, defaultTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
 	updateReq := map[string]interface{}{}
 
-	if !data.Name.IsNull() {
+	if !data.Name.IsNull() && !data.Name.IsUnknown() {
 		updateReq["name"] = data.Name.ValueString()
 	}
-	if !data.Alias.IsNull() {
+	if !data.Alias.IsNull() && !data.Alias.IsUnknown() {
 		updateReq["alias"] = data.Alias.ValueString()
 	}
-	if !data.Mode.IsNull() {
+	if !data.Mode.IsNull() && !data.Mode.IsUnknown() {
 		updateReq["mode"] = data.Mode.ValueString()
 	}
-	if !data.Groups.IsNull() {
+	if !data.Groups.IsNull() && !data.Groups.IsUnknown() {
 		var groups []int64
 		data.Groups.ElementsAs(ctx, &groups, false)
-		updateReq["groups"] = groups
+		updateReq["groups"] = iscsiTargetGroups(groups)
 	}
-	if !data.AuthNetworks.IsNull() {
+	if !data.AuthNetworks.IsNull() && !data.AuthNetworks.IsUnknown() {
 		var networks []string
 		data.AuthNetworks.ElementsAs(ctx, &networks, false)
 		updateReq["auth_networks"] = networks
 	}
 
 	endpoint := fmt.Sprintf("/iscsi/target/id/%s", data.ID.ValueString())
-	_, err := r.client.Put(endpoint, updateReq)
+	_, err := r.client.Put(ctx, endpoint, updateReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to update iSCSI target, got error: %s", err))
+		addClientError(&resp.Diagnostics, "update iSCSI target", err, &data, nil)
 		return
 	}
 
-	r.readISCSITarget(ctx, &data, &resp.Diagnostics)
+	if !r.readISCSITarget(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read iSCSI target: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -212,8 +260,17 @@ func (r *ISCSITargetResource) Delete(ctx context.Context, req resource.DeleteReq
 		return
 	}
 
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, defaultTimeouts.Delete)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
 	endpoint := fmt.Sprintf("/iscsi/target/id/%s", data.ID.ValueString())
-	_, err := r.client.Delete(endpoint)
+	_, err := r.client.Delete(ctx, endpoint)
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete iSCSI target, got error: %s", err))
 		return
@@ -224,18 +281,23 @@ func (r *ISCSITargetResource) ImportState(ctx context.Context, req resource.Impo
 	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
 }
 
-func (r *ISCSITargetResource) readISCSITarget(ctx context.Context, data *ISCSITargetResourceModel, diags *diag.Diagnostics) {
+// readISCSITarget refreshes data from the API. It returns false, without adding a
+// diagnostic, when the iSCSI target no longer exists.
+func (r *ISCSITargetResource) readISCSITarget(ctx context.Context, data *ISCSITargetResourceModel, diags *diag.Diagnostics) bool {
 	endpoint := fmt.Sprintf("/iscsi/target/id/%s", data.ID.ValueString())
-	respBody, err := r.client.Get(endpoint)
+	respBody, err := r.client.Get(ctx, endpoint)
 	if err != nil {
+		if truenas.IsNotFound(err) {
+			return false
+		}
 		diags.AddError("Client Error", fmt.Sprintf("Unable to read iSCSI target, got error: %s", err))
-		return
+		return false
 	}
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(respBody, &result); err != nil {
 		diags.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
-		return
+		return false
 	}
 
 	if name, ok := result["name"].(string); ok {
@@ -269,4 +331,15 @@ func (r *ISCSITargetResource) readISCSITarget(ctx context.Context, data *ISCSITa
 		list, _ := types.ListValueFrom(ctx, types.StringType, networkList)
 		data.AuthNetworks = list
 	}
+
+	return true
+}
+
+// iscsiTargetGroups converts portal IDs into the API's target group objects
+func iscsiTargetGroups(portals []int64) []map[string]interface{} {
+	groups := make([]map[string]interface{}, 0, len(portals))
+	for _, portal := range portals {
+		groups = append(groups, map[string]interface{}{"portal": portal})
+	}
+	return groups
 }
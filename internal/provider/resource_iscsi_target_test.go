@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+// TestAccISCSITargetResource tests creating, importing, updating and deleting
+// an iSCSI target in a portal group
+func TestAccISCSITargetResource(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "iscsi/target", "truenas_iscsi_target"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_iscsi_portal" "main" {
+  listen = [
+    { ip = "0.0.0.0" },
+  ]
+}
+
+resource "truenas_iscsi_target" "test" {
+  name   = "vmstore"
+  alias  = "VM store"
+  groups = [truenas_iscsi_portal.main.id]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_iscsi_target.test", "name", "vmstore"),
+					resource.TestCheckResourceAttr("truenas_iscsi_target.test", "alias", "VM store"),
+					resource.TestCheckResourceAttr("truenas_iscsi_target.test", "mode", "ISCSI"),
+					resource.TestCheckResourceAttr("truenas_iscsi_target.test", "groups.#", "1"),
+					resource.TestCheckResourceAttrPair("truenas_iscsi_target.test", "groups.0", "truenas_iscsi_portal.main", "id"),
+				),
+			},
+			{
+				ResourceName:            "truenas_iscsi_target.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"timeouts"},
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_iscsi_portal" "main" {
+  listen = [
+    { ip = "0.0.0.0" },
+  ]
+}
+
+resource "truenas_iscsi_target" "test" {
+  name          = "vmstore"
+  alias         = "VM store"
+  groups        = [truenas_iscsi_portal.main.id]
+  auth_networks = ["10.0.0.0/24"]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_iscsi_target.test", "auth_networks.#", "1"),
+					resource.TestCheckResourceAttr("truenas_iscsi_target.test", "auth_networks.0", "10.0.0.0/24"),
+				),
+			},
+		},
+	})
+}
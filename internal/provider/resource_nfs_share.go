@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
@@ -38,6 +39,13 @@ type NFSShareResourceModel struct {
 	Mapall   types.String `tfsdk:"mapall_user"`
 	Security types.List   `tfsdk:"security"`
 	Enabled  types.Bool   `tfsdk:"enabled"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
+}
+
+// nfsShareAPIFields maps NFS share API fields whose names differ from the schema
+var nfsShareAPIFields = map[string]path.Path{
+	"ro": path.Root("readonly"),
 }
 
 func (r *NFSShareResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
@@ -103,6 +111,14 @@ func (r *NFSShareResource) Schema(ctx context.Context, req resource.SchemaReques
 				Computed:            true,
 			},
 		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
 	}
 }
 
@@ -131,14 +147,23 @@ func (r *NFSShareResource) Create(ctx context.Context, req resource.CreateReques
 		return
 	}
 
+	createTimeout, diags := data.Timeouts.Create(ctx, defaultTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
 	createReq := map[string]interface{}{
 		"path": data.Path.ValueString(),
 	}
 
-	if !data.Comment.IsNull() {
+	if !data.Comment.IsNull() && !data.Comment.IsUnknown() {
 		createReq["comment"] = data.Comment.ValueString()
 	}
-	if !data.Networks.IsNull() {
+	if !data.Networks.IsNull() && !data.Networks.IsUnknown() {
 		var networks []string
 		resp.Diagnostics.Append(data.Networks.ElementsAs(ctx, &networks, false)...)
 		createReq["networks"] = networks
@@ -153,13 +178,13 @@ func (r *NFSShareResource) Create(ctx context.Context, req resource.CreateReques
 		createReq["hosts"] = []string{} // Default: allow all hosts
 	}
 
-	if !data.ReadOnly.IsNull() {
+	if !data.ReadOnly.IsNull() && !data.ReadOnly.IsUnknown() {
 		createReq["ro"] = data.ReadOnly.ValueBool()
 	}
-	if !data.Maproot.IsNull() {
+	if !data.Maproot.IsNull() && !data.Maproot.IsUnknown() {
 		createReq["maproot_user"] = data.Maproot.ValueString()
 	}
-	if !data.Mapall.IsNull() {
+	if !data.Mapall.IsNull() && !data.Mapall.IsUnknown() {
 		createReq["mapall_user"] = data.Mapall.ValueString()
 	}
 
@@ -172,13 +197,13 @@ func (r *NFSShareResource) Create(ctx context.Context, req resource.CreateReques
 		createReq["security"] = []string{} // Default: no security restrictions
 	}
 
-	if !data.Enabled.IsNull() {
+	if !data.Enabled.IsNull() && !data.Enabled.IsUnknown() {
 		createReq["enabled"] = data.Enabled.ValueBool()
 	}
 
-	respBody, err := r.client.Post("/sharing/nfs", createReq)
+	respBody, err := r.client.Post(ctx, "/sharing/nfs", createReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create NFS share, got error: %s", err))
+		addClientError(&resp.Diagnostics, "create NFS share", err, &data, nfsShareAPIFields)
 		return
 	}
 
@@ -192,7 +217,9 @@ func (r *NFSShareResource) Create(ctx context.Context, req resource.CreateReques
 		data.ID = types.StringValue(strconv.Itoa(int(id)))
 	}
 
-	r.readNFSShare(ctx, &data, &resp.Diagnostics)
+	if !r.readNFSShare(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read NFS share: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -204,11 +231,26 @@ func (r *NFSShareResource) Read(ctx context.Context, req resource.ReadRequest, r
 		return
 	}
 
-	r.readNFSShare(ctx, &data, &resp.Diagnostics)
+	readTimeout, diags := data.Timeouts.Read(ctx, defaultTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	found := r.readNFSShare(ctx, &data, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !found {
+		// Deleted outside of Terraform; drop it from state so it is re-created
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -220,50 +262,61 @@ func (r *NFSShareResource) Update(ctx context.Context, req resource.UpdateReques
 		return
 	}
 
+	updateTimeout, diags := data.Timeouts.Update(ctx, defaultTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
 	updateReq := map[string]interface{}{}
 
-	if !data.Path.IsNull() {
+	if !data.Path.IsNull() && !data.Path.IsUnknown() {
 		updateReq["path"] = data.Path.ValueString()
 	}
-	if !data.Comment.IsNull() {
+	if !data.Comment.IsNull() && !data.Comment.IsUnknown() {
 		updateReq["comment"] = data.Comment.ValueString()
 	}
-	if !data.Networks.IsNull() {
+	if !data.Networks.IsNull() && !data.Networks.IsUnknown() {
 		var networks []string
 		resp.Diagnostics.Append(data.Networks.ElementsAs(ctx, &networks, false)...)
 		updateReq["networks"] = networks
 	}
-	if !data.Hosts.IsNull() {
+	if !data.Hosts.IsNull() && !data.Hosts.IsUnknown() {
 		var hosts []string
 		resp.Diagnostics.Append(data.Hosts.ElementsAs(ctx, &hosts, false)...)
 		updateReq["hosts"] = hosts
 	}
-	if !data.ReadOnly.IsNull() {
+	if !data.ReadOnly.IsNull() && !data.ReadOnly.IsUnknown() {
 		updateReq["ro"] = data.ReadOnly.ValueBool()
 	}
-	if !data.Maproot.IsNull() {
+	if !data.Maproot.IsNull() && !data.Maproot.IsUnknown() {
 		updateReq["maproot_user"] = data.Maproot.ValueString()
 	}
-	if !data.Mapall.IsNull() {
+	if !data.Mapall.IsNull() && !data.Mapall.IsUnknown() {
 		updateReq["mapall_user"] = data.Mapall.ValueString()
 	}
-	if !data.Security.IsNull() {
+	if !data.Security.IsNull() && !data.Security.IsUnknown() {
 		var security []string
 		resp.Diagnostics.Append(data.Security.ElementsAs(ctx, &security, false)...)
 		updateReq["security"] = security
 	}
-	if !data.Enabled.IsNull() {
+	if !data.Enabled.IsNull() && !data.Enabled.IsUnknown() {
 		updateReq["enabled"] = data.Enabled.ValueBool()
 	}
 
 	endpoint := fmt.Sprintf("/sharing/nfs/id/%s", data.ID.ValueString())
-	_, err := r.client.Put(endpoint, updateReq)
+	_, err := r.client.Put(ctx, endpoint, updateReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to update NFS share, got error: %s", err))
+		addClientError(&resp.Diagnostics, "update NFS share", err, &data, nfsShareAPIFields)
 		return
 	}
 
-	r.readNFSShare(ctx, &data, &resp.Diagnostics)
+	if !r.readNFSShare(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read NFS share: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -275,8 +328,17 @@ func (r *NFSShareResource) Delete(ctx context.Context, req resource.DeleteReques
 		return
 	}
 
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, defaultTimeouts.Delete)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
 	endpoint := fmt.Sprintf("/sharing/nfs/id/%s", data.ID.ValueString())
-	_, err := r.client.Delete(endpoint)
+	_, err := r.client.Delete(ctx, endpoint)
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete NFS share, got error: %s", err))
 		return
@@ -287,18 +349,23 @@ func (r *NFSShareResource) ImportState(ctx context.Context, req resource.ImportS
 	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
 }
 
-func (r *NFSShareResource) readNFSShare(ctx context.Context, data *NFSShareResourceModel, diags *diag.Diagnostics) {
+// readNFSShare refreshes data from the API. It returns false, without adding a
+// diagnostic, when the NFS share no longer exists.
+func (r *NFSShareResource) readNFSShare(ctx context.Context, data *NFSShareResourceModel, diags *diag.Diagnostics) bool {
 	endpoint := fmt.Sprintf("/sharing/nfs/id/%s", data.ID.ValueString())
-	respBody, err := r.client.Get(endpoint)
+	respBody, err := r.client.Get(ctx, endpoint)
 	if err != nil {
+		if truenas.IsNotFound(err) {
+			return false
+		}
 		diags.AddError("Client Error", fmt.Sprintf("Unable to read NFS share, got error: %s", err))
-		return
+		return false
 	}
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(respBody, &result); err != nil {
 		diags.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
-		return
+		return false
 	}
 
 	// Read ID
@@ -399,4 +466,6 @@ func (r *NFSShareResource) readNFSShare(ctx context.Context, data *NFSShareResou
 	} else {
 		data.Mapall = types.StringNull()
 	}
+
+	return true
 }
@@ -0,0 +1,101 @@
+package provider
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+// TestAccNFSShareResource tests creating, importing, updating and deleting an NFS share
+func TestAccNFSShareResource(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "sharing/nfs", "truenas_nfs_share"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset" "media" {
+  name = "tank/media"
+}
+
+resource "truenas_nfs_share" "test" {
+  path     = "/mnt/${truenas_dataset.media.name}"
+  comment  = "Media"
+  networks = ["10.0.0.0/24"]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_nfs_share.test", "path", "/mnt/tank/media"),
+					resource.TestCheckResourceAttr("truenas_nfs_share.test", "comment", "Media"),
+					resource.TestCheckResourceAttr("truenas_nfs_share.test", "networks.#", "1"),
+					resource.TestCheckResourceAttr("truenas_nfs_share.test", "networks.0", "10.0.0.0/24"),
+					resource.TestCheckResourceAttr("truenas_nfs_share.test", "enabled", "true"),
+					resource.TestCheckResourceAttr("truenas_nfs_share.test", "readonly", "false"),
+				),
+			},
+			{
+				ResourceName:            "truenas_nfs_share.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"timeouts"},
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset" "media" {
+  name = "tank/media"
+}
+
+resource "truenas_nfs_share" "test" {
+  path         = "/mnt/${truenas_dataset.media.name}"
+  comment      = "Media (read-only)"
+  networks     = ["10.0.0.0/24"]
+  readonly     = true
+  maproot_user = "root"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_nfs_share.test", "comment", "Media (read-only)"),
+					resource.TestCheckResourceAttr("truenas_nfs_share.test", "readonly", "true"),
+					resource.TestCheckResourceAttr("truenas_nfs_share.test", "maproot_user", "root"),
+				),
+			},
+			{
+				PreConfig: testAccDeleteOutOfBand(t, server, "sharing/nfs", 1),
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset" "media" {
+  name = "tank/media"
+}
+
+resource "truenas_nfs_share" "test" {
+  path     = "/mnt/${truenas_dataset.media.name}"
+  comment  = "Media"
+  networks = ["10.0.0.0/24"]
+}
+`,
+				Check: testAccCheckExists(server, "sharing/nfs", "truenas_nfs_share.test"),
+			},
+		},
+	})
+}
+
+// TestAccNFSShareResource_missingPath tests that a share of a missing path is rejected
+func TestAccNFSShareResource_missingPath(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_nfs_share" "test" {
+  path = "/mnt/tank/missing"
+}
+`,
+				ExpectError: regexp.MustCompile(`Path /mnt/tank/missing does not exist`),
+			},
+		},
+	})
+}
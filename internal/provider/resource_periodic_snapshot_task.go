@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
@@ -65,6 +66,8 @@ type PeriodicSnapshotTaskResourceModel struct {
 	LifetimeValue types.Int64  `tfsdk:"lifetime_value"`
 	LifetimeUnit  types.String `tfsdk:"lifetime_unit"`
 	AllowEmpty    types.Bool   `tfsdk:"allow_empty"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
 }
 
 func (r *PeriodicSnapshotTaskResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
@@ -123,6 +126,14 @@ func (r *PeriodicSnapshotTaskResource) Schema(ctx context.Context, req resource.
 				Computed:            true,
 			},
 		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
 	}
 }
 
@@ -151,6 +162,15 @@ func (r *PeriodicSnapshotTaskResource) Create(ctx context.Context, req resource.
 		return
 	}
 
+	createTimeout, diags := data.Timeouts.Create(ctx, defaultTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
 	createReq := map[string]interface{}{
 		"dataset":        data.Dataset.ValueString(),
 		"naming_schema":  data.NamingSchema.ValueString(),
@@ -166,24 +186,24 @@ func (r *PeriodicSnapshotTaskResource) Create(ctx context.Context, req resource.
 	}
 	createReq["schedule"] = schedule
 
-	if !data.Recursive.IsNull() {
+	if !data.Recursive.IsNull() && !data.Recursive.IsUnknown() {
 		createReq["recursive"] = data.Recursive.ValueBool()
 	}
-	if !data.Enabled.IsNull() {
+	if !data.Enabled.IsNull() && !data.Enabled.IsUnknown() {
 		createReq["enabled"] = data.Enabled.ValueBool()
 	}
-	if !data.AllowEmpty.IsNull() {
+	if !data.AllowEmpty.IsNull() && !data.AllowEmpty.IsUnknown() {
 		createReq["allow_empty"] = data.AllowEmpty.ValueBool()
 	}
-	if !data.Exclude.IsNull() {
+	if !data.Exclude.IsNull() && !data.Exclude.IsUnknown() {
 		var exclude []string
 		data.Exclude.ElementsAs(ctx, &exclude, false)
 		createReq["exclude"] = exclude
 	}
 
-	respBody, err := r.client.Post("/pool/snapshottask", createReq)
+	respBody, err := r.client.Post(ctx, "/pool/snapshottask", createReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create periodic snapshot task, got error: %s", err))
+		addClientError(&resp.Diagnostics, "create periodic snapshot task", err, &data, nil)
 		return
 	}
 
@@ -197,7 +217,9 @@ func (r *PeriodicSnapshotTaskResource) Create(ctx context.Context, req resource.
 		data.ID = types.StringValue(fmt.Sprintf("%d", int(id)))
 	}
 
-	r.readPeriodicSnapshotTask(ctx, &data, &resp.Diagnostics)
+	if !r.readPeriodicSnapshotTask(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read periodic snapshot task: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -209,11 +231,26 @@ func (r *PeriodicSnapshotTaskResource) Read(ctx context.Context, req resource.Re
 		return
 	}
 
-	r.readPeriodicSnapshotTask(ctx, &data, &resp.Diagnostics)
+	readTimeout, diags := data.Timeouts.Read(ctx, defaultTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	found := r.readPeriodicSnapshotTask(ctx, &data, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !found {
+		// Deleted outside of Terraform; drop it from state so it is re-created
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -225,32 +262,41 @@ func (r *PeriodicSnapshotTaskResource) Update(ctx context.Context, req resource.
 		return
 	}
 
+	updateTimeout, diags := data.Timeouts.Update(ctx, defaultTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
 	updateReq := map[string]interface{}{}
 
-	if !data.Dataset.IsNull() {
+	if !data.Dataset.IsNull() && !data.Dataset.IsUnknown() {
 		updateReq["dataset"] = data.Dataset.ValueString()
 	}
-	if !data.NamingSchema.IsNull() {
+	if !data.NamingSchema.IsNull() && !data.NamingSchema.IsUnknown() {
 		updateReq["naming_schema"] = data.NamingSchema.ValueString()
 	}
-	if !data.LifetimeValue.IsNull() {
+	if !data.LifetimeValue.IsNull() && !data.LifetimeValue.IsUnknown() {
 		updateReq["lifetime_value"] = data.LifetimeValue.ValueInt64()
 	}
-	if !data.LifetimeUnit.IsNull() {
+	if !data.LifetimeUnit.IsNull() && !data.LifetimeUnit.IsUnknown() {
 		updateReq["lifetime_unit"] = data.LifetimeUnit.ValueString()
 	}
-	if !data.Recursive.IsNull() {
+	if !data.Recursive.IsNull() && !data.Recursive.IsUnknown() {
 		updateReq["recursive"] = data.Recursive.ValueBool()
 	}
-	if !data.Enabled.IsNull() {
+	if !data.Enabled.IsNull() && !data.Enabled.IsUnknown() {
 		updateReq["enabled"] = data.Enabled.ValueBool()
 	}
-	if !data.AllowEmpty.IsNull() {
+	if !data.AllowEmpty.IsNull() && !data.AllowEmpty.IsUnknown() {
 		updateReq["allow_empty"] = data.AllowEmpty.ValueBool()
 	}
 
 	// Parse schedule from cron format to JSON
-	if !data.Schedule.IsNull() {
+	if !data.Schedule.IsNull() && !data.Schedule.IsUnknown() {
 		schedule, err := parseCronSchedule(data.Schedule.ValueString())
 		if err != nil {
 			resp.Diagnostics.AddError("Invalid Schedule Format", fmt.Sprintf("Unable to parse schedule: %s", err))
@@ -259,20 +305,22 @@ func (r *PeriodicSnapshotTaskResource) Update(ctx context.Context, req resource.
 		updateReq["schedule"] = schedule
 	}
 
-	if !data.Exclude.IsNull() {
+	if !data.Exclude.IsNull() && !data.Exclude.IsUnknown() {
 		var exclude []string
 		data.Exclude.ElementsAs(ctx, &exclude, false)
 		updateReq["exclude"] = exclude
 	}
 
 	endpoint := fmt.Sprintf("/pool/snapshottask/id/%s", data.ID.ValueString())
-	_, err := r.client.Put(endpoint, updateReq)
+	_, err := r.client.Put(ctx, endpoint, updateReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to update periodic snapshot task, got error: %s", err))
+		addClientError(&resp.Diagnostics, "update periodic snapshot task", err, &data, nil)
 		return
 	}
 
-	r.readPeriodicSnapshotTask(ctx, &data, &resp.Diagnostics)
+	if !r.readPeriodicSnapshotTask(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read periodic snapshot task: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -284,8 +332,17 @@ func (r *PeriodicSnapshotTaskResource) Delete(ctx context.Context, req resource.
 		return
 	}
 
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, defaultTimeouts.Delete)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
 	endpoint := fmt.Sprintf("/pool/snapshottask/id/%s", data.ID.ValueString())
-	_, err := r.client.Delete(endpoint)
+	_, err := r.client.Delete(ctx, endpoint)
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete periodic snapshot task, got error: %s", err))
 		return
@@ -296,18 +353,23 @@ func (r *PeriodicSnapshotTaskResource) ImportState(ctx context.Context, req reso
 	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
 }
 
-func (r *PeriodicSnapshotTaskResource) readPeriodicSnapshotTask(ctx context.Context, data *PeriodicSnapshotTaskResourceModel, diags *diag.Diagnostics) {
+// readPeriodicSnapshotTask refreshes data from the API. It returns false, without adding a
+// diagnostic, when the periodic snapshot task no longer exists.
+func (r *PeriodicSnapshotTaskResource) readPeriodicSnapshotTask(ctx context.Context, data *PeriodicSnapshotTaskResourceModel, diags *diag.Diagnostics) bool {
 	endpoint := fmt.Sprintf("/pool/snapshottask/id/%s", data.ID.ValueString())
-	respBody, err := r.client.Get(endpoint)
+	respBody, err := r.client.Get(ctx, endpoint)
 	if err != nil {
+		if truenas.IsNotFound(err) {
+			return false
+		}
 		diags.AddError("Client Error", fmt.Sprintf("Unable to read periodic snapshot task, got error: %s", err))
-		return
+		return false
 	}
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(respBody, &result); err != nil {
 		diags.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
-		return
+		return false
 	}
 
 	if id, ok := result["id"].(float64); ok {
@@ -339,4 +401,6 @@ func (r *PeriodicSnapshotTaskResource) readPeriodicSnapshotTask(ctx context.Cont
 		cronStr := scheduleToCron(schedule)
 		data.Schedule = types.StringValue(cronStr)
 	}
+
+	return true
 }
@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+// TestAccPeriodicSnapshotTaskResource tests creating, importing, updating and
+// deleting a periodic snapshot task
+func TestAccPeriodicSnapshotTaskResource(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "pool/snapshottask", "truenas_periodic_snapshot_task"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset" "data" {
+  name = "tank/data"
+}
+
+resource "truenas_periodic_snapshot_task" "test" {
+  dataset        = truenas_dataset.data.name
+  naming_schema  = "auto-%Y-%m-%d_%H-%M"
+  schedule       = "0 * * * *"
+  lifetime_value = 2
+  lifetime_unit  = "WEEK"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_periodic_snapshot_task.test", "dataset", "tank/data"),
+					resource.TestCheckResourceAttr("truenas_periodic_snapshot_task.test", "schedule", "0 * * * *"),
+					resource.TestCheckResourceAttr("truenas_periodic_snapshot_task.test", "recursive", "false"),
+					resource.TestCheckResourceAttr("truenas_periodic_snapshot_task.test", "enabled", "true"),
+					resource.TestCheckResourceAttr("truenas_periodic_snapshot_task.test", "allow_empty", "true"),
+				),
+			},
+			{
+				ResourceName:            "truenas_periodic_snapshot_task.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"exclude", "timeouts"},
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset" "data" {
+  name = "tank/data"
+}
+
+resource "truenas_periodic_snapshot_task" "test" {
+  dataset        = truenas_dataset.data.name
+  naming_schema  = "auto-%Y-%m-%d_%H-%M"
+  schedule       = "30 2 * * *"
+  lifetime_value = 30
+  lifetime_unit  = "DAY"
+  recursive      = true
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_periodic_snapshot_task.test", "schedule", "30 2 * * *"),
+					resource.TestCheckResourceAttr("truenas_periodic_snapshot_task.test", "lifetime_value", "30"),
+					resource.TestCheckResourceAttr("truenas_periodic_snapshot_task.test", "lifetime_unit", "DAY"),
+					resource.TestCheckResourceAttr("truenas_periodic_snapshot_task.test", "recursive", "true"),
+				),
+			},
+		},
+	})
+}
@@ -0,0 +1,121 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+)
+
+// readTestCase describes the instance read by a resource's Read
+type readTestCase struct {
+	name     string
+	resource func() resource.Resource
+	id       string
+	endpoint string
+}
+
+var readTestCases = []readTestCase{
+	{"chart_release", NewChartReleaseResource, "plex", "/api/v2.0/chart/release/id/plex"},
+	{"dataset", NewDatasetResource, "tank/data", "/api/v2.0/pool/dataset/id/tank%2Fdata"},
+	{"group", NewGroupResource, "42", "/api/v2.0/group/id/42"},
+	{"interface", NewInterfaceResource, "br0", "/api/v2.0/interface/id/br0"},
+	{"iscsi_extent", NewISCSIExtentResource, "3", "/api/v2.0/iscsi/extent/id/3"},
+	{"iscsi_portal", NewISCSIPortalResource, "4", "/api/v2.0/iscsi/portal/id/4"},
+	{"iscsi_target", NewISCSITargetResource, "5", "/api/v2.0/iscsi/target/id/5"},
+	{"nfs_share", NewNFSShareResource, "6", "/api/v2.0/sharing/nfs/id/6"},
+	{"periodic_snapshot_task", NewPeriodicSnapshotTaskResource, "7", "/api/v2.0/pool/snapshottask/id/7"},
+	{"smb_share", NewSMBShareResource, "8", "/api/v2.0/sharing/smb/id/8"},
+	{"snapshot", NewSnapshotResource, "tank/data@daily", "/api/v2.0/zfs/snapshot/id/tank%2Fdata@daily"},
+	{"static_route", NewStaticRouteResource, "9", "/api/v2.0/staticroute/id/9"},
+	{"user", NewUserResource, "10", "/api/v2.0/user/id/10"},
+	{"vm", NewVMResource, "11", "/api/v2.0/vm/id/11"},
+	{"vm_device", NewVMDeviceResource, "12", "/api/v2.0/vm/device/id/12"},
+}
+
+// newReadTestResource configures the resource against a stand-in server that
+// answers the instance endpoint with the given status and body
+func newReadTestResource(t *testing.T, tc readTestCase, status int, body string) resource.Resource {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, tc.endpoint, r.URL.EscapedPath())
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := truenas.NewClient(server.URL, "test-key")
+	require.NoError(t, err)
+	client.RetryPolicy.MaxRetries = 0
+
+	res := tc.resource()
+	configureResp := &resource.ConfigureResponse{}
+	res.(resource.ResourceWithConfigure).Configure(context.Background(), resource.ConfigureRequest{ProviderData: client}, configureResp)
+	require.False(t, configureResp.Diagnostics.HasError(), configureResp.Diagnostics)
+
+	return res
+}
+
+// readTestState returns a state holding only the resource ID
+func readTestState(t *testing.T, res resource.Resource, id string) tfsdk.State {
+	t.Helper()
+	ctx := context.Background()
+
+	schemaResp := &resource.SchemaResponse{}
+	res.Schema(ctx, resource.SchemaRequest{}, schemaResp)
+	require.False(t, schemaResp.Diagnostics.HasError(), schemaResp.Diagnostics)
+
+	state := tfsdk.State{
+		Schema: schemaResp.Schema,
+		Raw:    tftypes.NewValue(schemaResp.Schema.Type().TerraformType(ctx), nil),
+	}
+	diags := state.SetAttribute(ctx, path.Root("id"), id)
+	require.False(t, diags.HasError(), diags)
+
+	return state
+}
+
+// TestRead_RemovesResourceOnNotFound tests that every resource drops itself
+// from state when the instance was deleted outside of Terraform
+func TestRead_RemovesResourceOnNotFound(t *testing.T) {
+	for _, tc := range readTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := newReadTestResource(t, tc, http.StatusNotFound, `{"message": "Not Found"}`)
+			state := readTestState(t, res, tc.id)
+
+			resp := &resource.ReadResponse{State: state}
+			res.Read(context.Background(), resource.ReadRequest{State: state}, resp)
+
+			require.False(t, resp.Diagnostics.HasError(), resp.Diagnostics)
+			assert.True(t, resp.State.Raw.IsNull(), "resource should be removed from state")
+		})
+	}
+}
+
+// TestRead_KeepsResourceOnServerError tests that other API errors are reported
+// instead of silently dropping the resource
+func TestRead_KeepsResourceOnServerError(t *testing.T) {
+	for _, tc := range readTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := newReadTestResource(t, tc, http.StatusInternalServerError, `{"message": "[EFAULT] middleware error"}`)
+			state := readTestState(t, res, tc.id)
+
+			resp := &resource.ReadResponse{State: state}
+			res.Read(context.Background(), resource.ReadRequest{State: state}, resp)
+
+			require.True(t, resp.Diagnostics.HasError())
+			assert.Contains(t, resp.Diagnostics.Errors()[0].Detail(), "middleware error")
+			assert.False(t, resp.State.Raw.IsNull(), "resource should stay in state")
+		})
+	}
+}
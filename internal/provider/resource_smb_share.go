@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
@@ -40,6 +41,13 @@ type SMBShareResourceModel struct {
 	Shadowcopy types.Bool   `tfsdk:"shadowcopy"`
 	Hostsallow types.List   `tfsdk:"hostsallow"`
 	Hostsdeny  types.List   `tfsdk:"hostsdeny"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
+}
+
+// smbShareAPIFields maps SMB share API fields whose names differ from the schema
+var smbShareAPIFields = map[string]path.Path{
+	"ro": path.Root("readonly"),
 }
 
 func (r *SMBShareResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
@@ -113,6 +121,14 @@ func (r *SMBShareResource) Schema(ctx context.Context, req resource.SchemaReques
 				ElementType:         types.StringType,
 			},
 		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
 	}
 }
 
@@ -141,46 +157,55 @@ func (r *SMBShareResource) Create(ctx context.Context, req resource.CreateReques
 		return
 	}
 
+	createTimeout, diags := data.Timeouts.Create(ctx, defaultTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
 	createReq := map[string]interface{}{
 		"name": data.Name.ValueString(),
 		"path": data.Path.ValueString(),
 	}
 
-	if !data.Comment.IsNull() {
+	if !data.Comment.IsNull() && !data.Comment.IsUnknown() {
 		createReq["comment"] = data.Comment.ValueString()
 	}
-	if !data.Enabled.IsNull() {
+	if !data.Enabled.IsNull() && !data.Enabled.IsUnknown() {
 		createReq["enabled"] = data.Enabled.ValueBool()
 	}
-	if !data.Browsable.IsNull() {
+	if !data.Browsable.IsNull() && !data.Browsable.IsUnknown() {
 		createReq["browsable"] = data.Browsable.ValueBool()
 	}
-	if !data.Guestok.IsNull() {
+	if !data.Guestok.IsNull() && !data.Guestok.IsUnknown() {
 		createReq["guestok"] = data.Guestok.ValueBool()
 	}
-	if !data.ReadOnly.IsNull() {
+	if !data.ReadOnly.IsNull() && !data.ReadOnly.IsUnknown() {
 		createReq["ro"] = data.ReadOnly.ValueBool()
 	}
-	if !data.Recyclebin.IsNull() {
+	if !data.Recyclebin.IsNull() && !data.Recyclebin.IsUnknown() {
 		createReq["recyclebin"] = data.Recyclebin.ValueBool()
 	}
-	if !data.Shadowcopy.IsNull() {
+	if !data.Shadowcopy.IsNull() && !data.Shadowcopy.IsUnknown() {
 		createReq["shadowcopy"] = data.Shadowcopy.ValueBool()
 	}
-	if !data.Hostsallow.IsNull() {
+	if !data.Hostsallow.IsNull() && !data.Hostsallow.IsUnknown() {
 		var hostsallow []string
 		resp.Diagnostics.Append(data.Hostsallow.ElementsAs(ctx, &hostsallow, false)...)
 		createReq["hostsallow"] = hostsallow
 	}
-	if !data.Hostsdeny.IsNull() {
+	if !data.Hostsdeny.IsNull() && !data.Hostsdeny.IsUnknown() {
 		var hostsdeny []string
 		resp.Diagnostics.Append(data.Hostsdeny.ElementsAs(ctx, &hostsdeny, false)...)
 		createReq["hostsdeny"] = hostsdeny
 	}
 
-	respBody, err := r.client.Post("/sharing/smb", createReq)
+	respBody, err := r.client.Post(ctx, "/sharing/smb", createReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create SMB share, got error: %s", err))
+		addClientError(&resp.Diagnostics, "create SMB share", err, &data, smbShareAPIFields)
 		return
 	}
 
@@ -194,7 +219,9 @@ func (r *SMBShareResource) Create(ctx context.Context, req resource.CreateReques
 		data.ID = types.StringValue(strconv.Itoa(int(id)))
 	}
 
-	r.readSMBShare(ctx, &data, &resp.Diagnostics)
+	if !r.readSMBShare(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read SMB share: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -206,11 +233,26 @@ func (r *SMBShareResource) Read(ctx context.Context, req resource.ReadRequest, r
 		return
 	}
 
-	r.readSMBShare(ctx, &data, &resp.Diagnostics)
+	readTimeout, diags := data.Timeouts.Read(ctx, defaultTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	found := r.readSMBShare(ctx, &data, &resp.Diagnostics)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
+	if !found {
+		// Deleted outside of Terraform; drop it from state so it is re-created
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -222,44 +264,65 @@ func (r *SMBShareResource) Update(ctx context.Context, req resource.UpdateReques
 		return
 	}
 
+	updateTimeout, diags := data.Timeouts.Update(ctx, defaultTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
 	updateReq := map[string]interface{}{}
 
-	if !data.Name.IsNull() {
+	if !data.Name.IsNull() && !data.Name.IsUnknown() {
 		updateReq["name"] = data.Name.ValueString()
 	}
-	if !data.Path.IsNull() {
+	if !data.Path.IsNull() && !data.Path.IsUnknown() {
 		updateReq["path"] = data.Path.ValueString()
 	}
-	if !data.Comment.IsNull() {
+	if !data.Comment.IsNull() && !data.Comment.IsUnknown() {
 		updateReq["comment"] = data.Comment.ValueString()
 	}
-	if !data.Enabled.IsNull() {
+	if !data.Enabled.IsNull() && !data.Enabled.IsUnknown() {
 		updateReq["enabled"] = data.Enabled.ValueBool()
 	}
-	if !data.Browsable.IsNull() {
+	if !data.Browsable.IsNull() && !data.Browsable.IsUnknown() {
 		updateReq["browsable"] = data.Browsable.ValueBool()
 	}
-	if !data.Guestok.IsNull() {
+	if !data.Guestok.IsNull() && !data.Guestok.IsUnknown() {
 		updateReq["guestok"] = data.Guestok.ValueBool()
 	}
-	if !data.ReadOnly.IsNull() {
+	if !data.ReadOnly.IsNull() && !data.ReadOnly.IsUnknown() {
 		updateReq["ro"] = data.ReadOnly.ValueBool()
 	}
-	if !data.Recyclebin.IsNull() {
+	if !data.Recyclebin.IsNull() && !data.Recyclebin.IsUnknown() {
 		updateReq["recyclebin"] = data.Recyclebin.ValueBool()
 	}
-	if !data.Shadowcopy.IsNull() {
+	if !data.Shadowcopy.IsNull() && !data.Shadowcopy.IsUnknown() {
 		updateReq["shadowcopy"] = data.Shadowcopy.ValueBool()
 	}
+	if !data.Hostsallow.IsNull() && !data.Hostsallow.IsUnknown() {
+		var hostsallow []string
+		resp.Diagnostics.Append(data.Hostsallow.ElementsAs(ctx, &hostsallow, false)...)
+		updateReq["hostsallow"] = hostsallow
+	}
+	if !data.Hostsdeny.IsNull() && !data.Hostsdeny.IsUnknown() {
+		var hostsdeny []string
+		resp.Diagnostics.Append(data.Hostsdeny.ElementsAs(ctx, &hostsdeny, false)...)
+		updateReq["hostsdeny"] = hostsdeny
+	}
 
 	endpoint := fmt.Sprintf("/sharing/smb/id/%s", data.ID.ValueString())
-	_, err := r.client.Put(endpoint, updateReq)
+	_, err := r.client.Put(ctx, endpoint, updateReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to update SMB share, got error: %s", err))
+		addClientError(&resp.Diagnostics, "update SMB share", err, &data, smbShareAPIFields)
 		return
 	}
 
-	r.readSMBShare(ctx, &data, &resp.Diagnostics)
+	if !r.readSMBShare(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read SMB share: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -271,8 +334,17 @@ func (r *SMBShareResource) Delete(ctx context.Context, req resource.DeleteReques
 		return
 	}
 
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, defaultTimeouts.Delete)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
 	endpoint := fmt.Sprintf("/sharing/smb/id/%s", data.ID.ValueString())
-	_, err := r.client.Delete(endpoint)
+	_, err := r.client.Delete(ctx, endpoint)
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete SMB share, got error: %s", err))
 		return
@@ -283,18 +355,23 @@ func (r *SMBShareResource) ImportState(ctx context.Context, req resource.ImportS
 	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
 }
 
-func (r *SMBShareResource) readSMBShare(ctx context.Context, data *SMBShareResourceModel, diags *diag.Diagnostics) {
+// readSMBShare refreshes data from the API. It returns false, without adding a
+// diagnostic, when the SMB share no longer exists.
+func (r *SMBShareResource) readSMBShare(ctx context.Context, data *SMBShareResourceModel, diags *diag.Diagnostics) bool {
 	endpoint := fmt.Sprintf("/sharing/smb/id/%s", data.ID.ValueString())
-	respBody, err := r.client.Get(endpoint)
+	respBody, err := r.client.Get(ctx, endpoint)
 	if err != nil {
+		if truenas.IsNotFound(err) {
+			return false
+		}
 		diags.AddError("Client Error", fmt.Sprintf("Unable to read SMB share, got error: %s", err))
-		return
+		return false
 	}
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(respBody, &result); err != nil {
 		diags.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
-		return
+		return false
 	}
 
 	if name, ok := result["name"].(string); ok {
@@ -309,4 +386,45 @@ func (r *SMBShareResource) readSMBShare(ctx context.Context, data *SMBShareResou
 	if enabled, ok := result["enabled"].(bool); ok {
 		data.Enabled = types.BoolValue(enabled)
 	}
+	if browsable, ok := result["browsable"].(bool); ok {
+		data.Browsable = types.BoolValue(browsable)
+	}
+	if guestok, ok := result["guestok"].(bool); ok {
+		data.Guestok = types.BoolValue(guestok)
+	}
+	if ro, ok := result["ro"].(bool); ok {
+		data.ReadOnly = types.BoolValue(ro)
+	}
+	if recyclebin, ok := result["recyclebin"].(bool); ok {
+		data.Recyclebin = types.BoolValue(recyclebin)
+	}
+	if shadowcopy, ok := result["shadowcopy"].(bool); ok {
+		data.Shadowcopy = types.BoolValue(shadowcopy)
+	}
+
+	hostsallow := []string{}
+	if hosts, ok := result["hostsallow"].([]interface{}); ok {
+		for _, host := range hosts {
+			if hostStr, ok := host.(string); ok {
+				hostsallow = append(hostsallow, hostStr)
+			}
+		}
+	}
+	listValue, d := types.ListValueFrom(ctx, types.StringType, hostsallow)
+	diags.Append(d...)
+	data.Hostsallow = listValue
+
+	hostsdeny := []string{}
+	if hosts, ok := result["hostsdeny"].([]interface{}); ok {
+		for _, host := range hosts {
+			if hostStr, ok := host.(string); ok {
+				hostsdeny = append(hostsdeny, hostStr)
+			}
+		}
+	}
+	listValue, d = types.ListValueFrom(ctx, types.StringType, hostsdeny)
+	diags.Append(d...)
+	data.Hostsdeny = listValue
+
+	return true
 }
@@ -0,0 +1,69 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+// TestAccSMBShareResource tests creating, importing, updating and deleting an SMB share
+func TestAccSMBShareResource(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "sharing/smb", "truenas_smb_share"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset" "documents" {
+  name = "tank/documents"
+}
+
+resource "truenas_smb_share" "test" {
+  name    = "documents"
+  path    = "/mnt/${truenas_dataset.documents.name}"
+  comment = "Documents"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_smb_share.test", "name", "documents"),
+					resource.TestCheckResourceAttr("truenas_smb_share.test", "path", "/mnt/tank/documents"),
+					resource.TestCheckResourceAttr("truenas_smb_share.test", "comment", "Documents"),
+					resource.TestCheckResourceAttr("truenas_smb_share.test", "enabled", "true"),
+					resource.TestCheckResourceAttr("truenas_smb_share.test", "browsable", "true"),
+					resource.TestCheckResourceAttr("truenas_smb_share.test", "guestok", "false"),
+					resource.TestCheckResourceAttr("truenas_smb_share.test", "shadowcopy", "true"),
+				),
+			},
+			{
+				ResourceName:            "truenas_smb_share.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"timeouts"},
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset" "documents" {
+  name = "tank/documents"
+}
+
+resource "truenas_smb_share" "test" {
+  name       = "documents"
+  path       = "/mnt/${truenas_dataset.documents.name}"
+  comment    = "Shared documents"
+  browsable  = false
+  recyclebin = true
+  hostsallow = ["10.0.0.0/24"]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_smb_share.test", "comment", "Shared documents"),
+					resource.TestCheckResourceAttr("truenas_smb_share.test", "browsable", "false"),
+					resource.TestCheckResourceAttr("truenas_smb_share.test", "recyclebin", "true"),
+					resource.TestCheckResourceAttr("truenas_smb_share.test", "hostsallow.#", "1"),
+				),
+			},
+		},
+	})
+}
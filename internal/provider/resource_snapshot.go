@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"strings"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
@@ -34,6 +36,8 @@ type SnapshotResourceModel struct {
 	Recursive  types.Bool   `tfsdk:"recursive"`
 	VMSync     types.String `tfsdk:"vmware_sync"`
 	Properties types.Map    `tfsdk:"properties"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
 }
 
 func (r *SnapshotResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
@@ -81,6 +85,14 @@ func (r *SnapshotResource) Schema(ctx context.Context, req resource.SchemaReques
 				Computed:            true,
 			},
 		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
 	}
 }
 
@@ -109,21 +121,32 @@ func (r *SnapshotResource) Create(ctx context.Context, req resource.CreateReques
 		return
 	}
 
+	createTimeout, diags := data.Timeouts.Create(ctx, snapshotTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
 	createReq := map[string]interface{}{
 		"dataset": data.Dataset.ValueString(),
 		"name":    data.Name.ValueString(),
 	}
 
-	if !data.Recursive.IsNull() {
+	if !data.Recursive.IsNull() && !data.Recursive.IsUnknown() {
 		createReq["recursive"] = data.Recursive.ValueBool()
 	}
-	if !data.VMSync.IsNull() {
+	if !data.VMSync.IsNull() && !data.VMSync.IsUnknown() {
 		createReq["vmware_sync"] = data.VMSync.ValueString()
 	}
 
-	respBody, err := r.client.Post("/zfs/snapshot", createReq)
+	// Not retried: a retry after a lost response would fail as a duplicate
+	// and leave the created object outside of state
+	respBody, err := r.client.Post(ctx, "/zfs/snapshot", createReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create snapshot, got error: %s", err))
+		addClientError(&resp.Diagnostics, "create snapshot", err, &data, nil)
 		return
 	}
 
@@ -137,7 +160,18 @@ func (r *SnapshotResource) Create(ctx context.Context, req resource.CreateReques
 	snapshotID := fmt.Sprintf("%s@%s", data.Dataset.ValueString(), data.Name.ValueString())
 	data.ID = types.StringValue(snapshotID)
 
-	r.readSnapshot(ctx, &data, &resp.Diagnostics)
+	// recursive and vmware_sync only apply to the create request and are not
+	// reported back by the API
+	if data.Recursive.IsUnknown() {
+		data.Recursive = types.BoolValue(false)
+	}
+	if data.VMSync.IsUnknown() {
+		data.VMSync = types.StringNull()
+	}
+
+	if !r.readSnapshot(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read snapshot: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -149,11 +183,26 @@ func (r *SnapshotResource) Read(ctx context.Context, req resource.ReadRequest, r
 		return
 	}
 
-	r.readSnapshot(ctx, &data, &resp.Diagnostics)
+	readTimeout, diags := data.Timeouts.Read(ctx, snapshotTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	found := r.readSnapshot(ctx, &data, &resp.Diagnostics)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
+	if !found {
+		// Deleted outside of Terraform; drop it from state so it is re-created
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -170,8 +219,17 @@ func (r *SnapshotResource) Delete(ctx context.Context, req resource.DeleteReques
 		return
 	}
 
-	endpoint := fmt.Sprintf("/zfs/snapshot/id/%s", data.ID.ValueString())
-	_, err := r.client.Delete(endpoint)
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, snapshotTimeouts.Delete)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("/zfs/snapshot/id/%s", url.PathEscape(data.ID.ValueString()))
+	_, err := r.client.Delete(ctx, endpoint)
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete snapshot, got error: %s", err))
 		return
@@ -191,18 +249,23 @@ func (r *SnapshotResource) ImportState(ctx context.Context, req resource.ImportS
 	resp.Diagnostics.Append(resp.State.SetAttribute(ctx, path.Root("name"), parts[1])...)
 }
 
-func (r *SnapshotResource) readSnapshot(ctx context.Context, data *SnapshotResourceModel, diags *diag.Diagnostics) {
-	endpoint := fmt.Sprintf("/zfs/snapshot/id/%s", data.ID.ValueString())
-	respBody, err := r.client.Get(endpoint)
+// readSnapshot refreshes data from the API. It returns false, without adding a
+// diagnostic, when the snapshot no longer exists.
+func (r *SnapshotResource) readSnapshot(ctx context.Context, data *SnapshotResourceModel, diags *diag.Diagnostics) bool {
+	endpoint := fmt.Sprintf("/zfs/snapshot/id/%s", url.PathEscape(data.ID.ValueString()))
+	respBody, err := r.client.Get(ctx, endpoint)
 	if err != nil {
+		if truenas.IsNotFound(err) {
+			return false
+		}
 		diags.AddError("Client Error", fmt.Sprintf("Unable to read snapshot, got error: %s", err))
-		return
+		return false
 	}
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(respBody, &result); err != nil {
 		diags.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
-		return
+		return false
 	}
 
 	if name, ok := result["name"].(string); ok {
@@ -227,4 +290,6 @@ func (r *SnapshotResource) readSnapshot(ctx context.Context, data *SnapshotResou
 		propTypes, _ := types.MapValueFrom(ctx, types.StringType, propsMap)
 		data.Properties = propTypes
 	}
+
+	return true
 }
@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+// TestAccSnapshotResource tests creating, importing and deleting a recursive snapshot
+func TestAccSnapshotResource(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "zfs/snapshot", "truenas_snapshot"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset" "data" {
+  name = "tank/data"
+}
+
+resource "truenas_snapshot" "test" {
+  dataset = truenas_dataset.data.name
+  name    = "before-upgrade"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_snapshot.test", "id", "tank/data@before-upgrade"),
+					resource.TestCheckResourceAttr("truenas_snapshot.test", "recursive", "false"),
+					resource.TestCheckResourceAttr("truenas_snapshot.test", "properties.referenced", "96K"),
+					testAccCheckExists(server, "zfs/snapshot", "truenas_snapshot.test"),
+				),
+			},
+			{
+				ResourceName:            "truenas_snapshot.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"recursive", "vmware_sync", "timeouts"},
+			},
+		},
+	})
+}
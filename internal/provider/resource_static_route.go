@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
@@ -32,6 +33,8 @@ type StaticRouteResourceModel struct {
 	Destination types.String `tfsdk:"destination"`
 	Gateway     types.String `tfsdk:"gateway"`
 	Description types.String `tfsdk:"description"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
 }
 
 func (r *StaticRouteResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
@@ -66,6 +69,14 @@ func (r *StaticRouteResource) Schema(ctx context.Context, req resource.SchemaReq
 				Computed:            true,
 			},
 		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
 	}
 }
 
@@ -94,18 +105,27 @@ func (r *StaticRouteResource) Create(ctx context.Context, req resource.CreateReq
 		return
 	}
 
+	createTimeout, diags := data.Timeouts.Create(ctx, defaultTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
 	createReq := map[string]interface{}{
 		"destination": data.Destination.ValueString(),
 		"gateway":     data.Gateway.ValueString(),
 	}
 
-	if !data.Description.IsNull() {
+	if !data.Description.IsNull() && !data.Description.IsUnknown() {
 		createReq["description"] = data.Description.ValueString()
 	}
 
-	respBody, err := r.client.Post("/staticroute", createReq)
+	respBody, err := r.client.Post(ctx, "/staticroute", createReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create static route, got error: %s", err))
+		addClientError(&resp.Diagnostics, "create static route", err, &data, nil)
 		return
 	}
 
@@ -119,7 +139,9 @@ func (r *StaticRouteResource) Create(ctx context.Context, req resource.CreateReq
 		data.ID = types.StringValue(strconv.Itoa(int(id)))
 	}
 
-	r.readStaticRoute(ctx, &data, &resp.Diagnostics)
+	if !r.readStaticRoute(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read static route: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -131,11 +153,26 @@ func (r *StaticRouteResource) Read(ctx context.Context, req resource.ReadRequest
 		return
 	}
 
-	r.readStaticRoute(ctx, &data, &resp.Diagnostics)
+	readTimeout, diags := data.Timeouts.Read(ctx, defaultTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	found := r.readStaticRoute(ctx, &data, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !found {
+		// Deleted outside of Terraform; drop it from state so it is re-created
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -147,23 +184,34 @@ func (r *StaticRouteResource) Update(ctx context.Context, req resource.UpdateReq
 		return
 	}
 
+	updateTimeout, diags := data.Timeouts.Update(ctx, defaultTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
 	updateReq := map[string]interface{}{}
 
-	if !data.Gateway.IsNull() {
+	if !data.Gateway.IsNull() && !data.Gateway.IsUnknown() {
 		updateReq["gateway"] = data.Gateway.ValueString()
 	}
-	if !data.Description.IsNull() {
+	if !data.Description.IsNull() && !data.Description.IsUnknown() {
 		updateReq["description"] = data.Description.ValueString()
 	}
 
 	endpoint := fmt.Sprintf("/staticroute/id/%s", data.ID.ValueString())
-	_, err := r.client.Put(endpoint, updateReq)
+	_, err := r.client.Put(ctx, endpoint, updateReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to update static route, got error: %s", err))
+		addClientError(&resp.Diagnostics, "update static route", err, &data, nil)
 		return
 	}
 
-	r.readStaticRoute(ctx, &data, &resp.Diagnostics)
+	if !r.readStaticRoute(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read static route: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -175,8 +223,17 @@ func (r *StaticRouteResource) Delete(ctx context.Context, req resource.DeleteReq
 		return
 	}
 
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, defaultTimeouts.Delete)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
 	endpoint := fmt.Sprintf("/staticroute/id/%s", data.ID.ValueString())
-	_, err := r.client.Delete(endpoint)
+	_, err := r.client.Delete(ctx, endpoint)
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete static route, got error: %s", err))
 		return
@@ -187,18 +244,23 @@ func (r *StaticRouteResource) ImportState(ctx context.Context, req resource.Impo
 	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
 }
 
-func (r *StaticRouteResource) readStaticRoute(ctx context.Context, data *StaticRouteResourceModel, diags *diag.Diagnostics) {
+// readStaticRoute refreshes data from the API. It returns false, without adding a
+// diagnostic, when the static route no longer exists.
+func (r *StaticRouteResource) readStaticRoute(ctx context.Context, data *StaticRouteResourceModel, diags *diag.Diagnostics) bool {
 	endpoint := fmt.Sprintf("/staticroute/id/%s", data.ID.ValueString())
-	respBody, err := r.client.Get(endpoint)
+	respBody, err := r.client.Get(ctx, endpoint)
 	if err != nil {
+		if truenas.IsNotFound(err) {
+			return false
+		}
 		diags.AddError("Client Error", fmt.Sprintf("Unable to read static route, got error: %s", err))
-		return
+		return false
 	}
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(respBody, &result); err != nil {
 		diags.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
-		return
+		return false
 	}
 
 	if destination, ok := result["destination"].(string); ok {
@@ -210,4 +272,6 @@ func (r *StaticRouteResource) readStaticRoute(ctx context.Context, data *StaticR
 	if description, ok := result["description"].(string); ok {
 		data.Description = types.StringValue(description)
 	}
+
+	return true
 }
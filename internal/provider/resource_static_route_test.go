@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+// TestAccStaticRouteResource tests creating, importing, updating and deleting a static route
+func TestAccStaticRouteResource(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "staticroute", "truenas_static_route"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_static_route" "test" {
+  destination = "10.20.0.0/16"
+  gateway     = "10.0.0.1"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_static_route.test", "destination", "10.20.0.0/16"),
+					resource.TestCheckResourceAttr("truenas_static_route.test", "gateway", "10.0.0.1"),
+					resource.TestCheckResourceAttr("truenas_static_route.test", "description", ""),
+				),
+			},
+			{
+				ResourceName:            "truenas_static_route.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"timeouts"},
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_static_route" "test" {
+  destination = "10.20.0.0/16"
+  gateway     = "10.0.0.254"
+  description = "Lab network"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_static_route.test", "gateway", "10.0.0.254"),
+					resource.TestCheckResourceAttr("truenas_static_route.test", "description", "Lab network"),
+				),
+			},
+		},
+	})
+}
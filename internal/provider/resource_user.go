@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
@@ -41,6 +42,8 @@ type UserResourceModel struct {
 	Locked    types.Bool   `tfsdk:"locked"`
 	Sudo      types.Bool   `tfsdk:"sudo"`
 	SmbAuth   types.Bool   `tfsdk:"smb"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
 }
 
 func (r *UserResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
@@ -118,6 +121,14 @@ func (r *UserResource) Schema(ctx context.Context, req resource.SchemaRequest, r
 				Computed:            true,
 			},
 		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
 	}
 }
 
@@ -146,47 +157,58 @@ func (r *UserResource) Create(ctx context.Context, req resource.CreateRequest, r
 		return
 	}
 
+	createTimeout, diags := data.Timeouts.Create(ctx, defaultTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
 	createReq := map[string]interface{}{
 		"username": data.Username.ValueString(),
 	}
 
-	if !data.UID.IsNull() {
+	if !data.UID.IsNull() && !data.UID.IsUnknown() {
 		createReq["uid"] = data.UID.ValueInt64()
 	}
-	if !data.FullName.IsNull() {
+	if !data.FullName.IsNull() && !data.FullName.IsUnknown() {
 		createReq["full_name"] = data.FullName.ValueString()
 	}
-	if !data.Email.IsNull() {
+	if !data.Email.IsNull() && !data.Email.IsUnknown() {
 		createReq["email"] = data.Email.ValueString()
 	}
-	if !data.Password.IsNull() {
+	if !data.Password.IsNull() && !data.Password.IsUnknown() {
 		createReq["password"] = data.Password.ValueString()
 	}
-	if !data.Group.IsNull() {
+	if !data.Group.IsNull() && !data.Group.IsUnknown() {
 		createReq["group"] = data.Group.ValueInt64()
 	}
-	if !data.Home.IsNull() {
+	if !data.Home.IsNull() && !data.Home.IsUnknown() {
 		createReq["home"] = data.Home.ValueString()
 	}
-	if !data.Shell.IsNull() {
+	if !data.Shell.IsNull() && !data.Shell.IsUnknown() {
 		createReq["shell"] = data.Shell.ValueString()
 	}
-	if !data.SshPubkey.IsNull() {
+	if !data.SshPubkey.IsNull() && !data.SshPubkey.IsUnknown() {
 		createReq["sshpubkey"] = data.SshPubkey.ValueString()
 	}
-	if !data.Locked.IsNull() {
+	if !data.Locked.IsNull() && !data.Locked.IsUnknown() {
 		createReq["locked"] = data.Locked.ValueBool()
 	}
-	if !data.Sudo.IsNull() {
+	if !data.Sudo.IsNull() && !data.Sudo.IsUnknown() {
 		createReq["sudo"] = data.Sudo.ValueBool()
 	}
-	if !data.SmbAuth.IsNull() {
+	if !data.SmbAuth.IsNull() && !data.SmbAuth.IsUnknown() {
 		createReq["smb"] = data.SmbAuth.ValueBool()
 	}
 
-	respBody, err := r.client.Post("/user", createReq)
+	// Not retried: a retry after a lost response would fail as a duplicate
+	// and leave the created object outside of state
+	respBody, err := r.client.Post(ctx, "/user", createReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create user, got error: %s", err))
+		addClientError(&resp.Diagnostics, "create user", err, &data, nil)
 		return
 	}
 
@@ -200,7 +222,9 @@ func (r *UserResource) Create(ctx context.Context, req resource.CreateRequest, r
 		data.ID = types.StringValue(strconv.Itoa(int(id)))
 	}
 
-	r.readUser(ctx, &data, &resp.Diagnostics)
+	if !r.readUser(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read user: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -212,11 +236,26 @@ func (r *UserResource) Read(ctx context.Context, req resource.ReadRequest, resp
 		return
 	}
 
-	r.readUser(ctx, &data, &resp.Diagnostics)
+	readTimeout, diags := data.Timeouts.Read(ctx, defaultTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	found := r.readUser(ctx, &data, &resp.Diagnostics)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
+	if !found {
+		// Deleted outside of Terraform; drop it from state so it is re-created
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -228,50 +267,61 @@ func (r *UserResource) Update(ctx context.Context, req resource.UpdateRequest, r
 		return
 	}
 
+	updateTimeout, diags := data.Timeouts.Update(ctx, defaultTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
 	updateReq := map[string]interface{}{}
 
-	if !data.Username.IsNull() {
+	if !data.Username.IsNull() && !data.Username.IsUnknown() {
 		updateReq["username"] = data.Username.ValueString()
 	}
-	if !data.FullName.IsNull() {
+	if !data.FullName.IsNull() && !data.FullName.IsUnknown() {
 		updateReq["full_name"] = data.FullName.ValueString()
 	}
-	if !data.Email.IsNull() {
+	if !data.Email.IsNull() && !data.Email.IsUnknown() {
 		updateReq["email"] = data.Email.ValueString()
 	}
-	if !data.Password.IsNull() {
+	if !data.Password.IsNull() && !data.Password.IsUnknown() {
 		updateReq["password"] = data.Password.ValueString()
 	}
-	if !data.Group.IsNull() {
+	if !data.Group.IsNull() && !data.Group.IsUnknown() {
 		updateReq["group"] = data.Group.ValueInt64()
 	}
-	if !data.Home.IsNull() {
+	if !data.Home.IsNull() && !data.Home.IsUnknown() {
 		updateReq["home"] = data.Home.ValueString()
 	}
-	if !data.Shell.IsNull() {
+	if !data.Shell.IsNull() && !data.Shell.IsUnknown() {
 		updateReq["shell"] = data.Shell.ValueString()
 	}
-	if !data.SshPubkey.IsNull() {
+	if !data.SshPubkey.IsNull() && !data.SshPubkey.IsUnknown() {
 		updateReq["sshpubkey"] = data.SshPubkey.ValueString()
 	}
-	if !data.Locked.IsNull() {
+	if !data.Locked.IsNull() && !data.Locked.IsUnknown() {
 		updateReq["locked"] = data.Locked.ValueBool()
 	}
-	if !data.Sudo.IsNull() {
+	if !data.Sudo.IsNull() && !data.Sudo.IsUnknown() {
 		updateReq["sudo"] = data.Sudo.ValueBool()
 	}
-	if !data.SmbAuth.IsNull() {
+	if !data.SmbAuth.IsNull() && !data.SmbAuth.IsUnknown() {
 		updateReq["smb"] = data.SmbAuth.ValueBool()
 	}
 
 	endpoint := fmt.Sprintf("/user/id/%s", data.ID.ValueString())
-	_, err := r.client.Put(endpoint, updateReq)
+	_, err := r.client.Put(ctx, endpoint, updateReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to update user, got error: %s", err))
+		addClientError(&resp.Diagnostics, "update user", err, &data, nil)
 		return
 	}
 
-	r.readUser(ctx, &data, &resp.Diagnostics)
+	if !r.readUser(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read user: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -283,8 +333,17 @@ func (r *UserResource) Delete(ctx context.Context, req resource.DeleteRequest, r
 		return
 	}
 
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, defaultTimeouts.Delete)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
 	endpoint := fmt.Sprintf("/user/id/%s", data.ID.ValueString())
-	_, err := r.client.Delete(endpoint)
+	_, err := r.client.Delete(ctx, endpoint)
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete user, got error: %s", err))
 		return
@@ -295,18 +354,23 @@ func (r *UserResource) ImportState(ctx context.Context, req resource.ImportState
 	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
 }
 
-func (r *UserResource) readUser(ctx context.Context, data *UserResourceModel, diags *diag.Diagnostics) {
+// readUser refreshes data from the API. It returns false, without adding a
+// diagnostic, when the user no longer exists.
+func (r *UserResource) readUser(ctx context.Context, data *UserResourceModel, diags *diag.Diagnostics) bool {
 	endpoint := fmt.Sprintf("/user/id/%s", data.ID.ValueString())
-	respBody, err := r.client.Get(endpoint)
+	respBody, err := r.client.Get(ctx, endpoint)
 	if err != nil {
+		if truenas.IsNotFound(err) {
+			return false
+		}
 		diags.AddError("Client Error", fmt.Sprintf("Unable to read user, got error: %s", err))
-		return
+		return false
 	}
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(respBody, &result); err != nil {
 		diags.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
-		return
+		return false
 	}
 
 	if uid, ok := result["uid"].(float64); ok {
@@ -320,6 +384,8 @@ func (r *UserResource) readUser(ctx context.Context, data *UserResourceModel, di
 	}
 	if email, ok := result["email"].(string); ok {
 		data.Email = types.StringValue(email)
+	} else {
+		data.Email = types.StringNull()
 	}
 	if group, ok := result["group"].(map[string]interface{}); ok {
 		if gid, ok := group["id"].(float64); ok {
@@ -332,4 +398,20 @@ func (r *UserResource) readUser(ctx context.Context, data *UserResourceModel, di
 	if shell, ok := result["shell"].(string); ok {
 		data.Shell = types.StringValue(shell)
 	}
+	if sshpubkey, ok := result["sshpubkey"].(string); ok {
+		data.SshPubkey = types.StringValue(sshpubkey)
+	} else {
+		data.SshPubkey = types.StringNull()
+	}
+	if locked, ok := result["locked"].(bool); ok {
+		data.Locked = types.BoolValue(locked)
+	}
+	if sudo, ok := result["sudo"].(bool); ok {
+		data.Sudo = types.BoolValue(sudo)
+	}
+	if smb, ok := result["smb"].(bool); ok {
+		data.SmbAuth = types.BoolValue(smb)
+	}
+
+	return true
 }
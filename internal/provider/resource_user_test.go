@@ -0,0 +1,175 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/terraform"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas/fake"
+)
+
+// TestAccUserResource tests creating, importing, updating and deleting a user
+func TestAccUserResource(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "user", "truenas_user"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_group" "media" {
+  name = "media"
+}
+
+resource "truenas_user" "test" {
+  username  = "jellyfin"
+  full_name = "Jellyfin"
+  password  = "hunter22"
+  group     = truenas_group.media.id
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_user.test", "username", "jellyfin"),
+					resource.TestCheckResourceAttr("truenas_user.test", "full_name", "Jellyfin"),
+					resource.TestCheckResourceAttr("truenas_user.test", "uid", "3000"),
+					resource.TestCheckResourceAttrPair("truenas_user.test", "group", "truenas_group.media", "id"),
+					resource.TestCheckResourceAttr("truenas_user.test", "smb", "true"),
+					resource.TestCheckResourceAttr("truenas_user.test", "locked", "false"),
+					resource.TestCheckNoResourceAttr("truenas_user.test", "email"),
+				),
+			},
+			{
+				ResourceName:            "truenas_user.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"password", "timeouts"},
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_group" "media" {
+  name = "media"
+}
+
+resource "truenas_user" "test" {
+  username  = "jellyfin"
+  full_name = "Jellyfin Media Server"
+  password  = "hunter22"
+  group     = truenas_group.media.id
+  email     = "jellyfin@example.com"
+  shell     = "/usr/sbin/nologin"
+  smb       = false
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_user.test", "full_name", "Jellyfin Media Server"),
+					resource.TestCheckResourceAttr("truenas_user.test", "email", "jellyfin@example.com"),
+					resource.TestCheckResourceAttr("truenas_user.test", "shell", "/usr/sbin/nologin"),
+					resource.TestCheckResourceAttr("truenas_user.test", "smb", "false"),
+				),
+			},
+		},
+	})
+}
+
+// TestAccUserResource_duplicateUsername tests that the API's uniqueness
+// validation is reported
+func TestAccUserResource_duplicateUsername(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				PreConfig: func() {
+					if _, err := server.Create("user", map[string]interface{}{"username": "jellyfin", "full_name": "Jellyfin", "group_create": true}); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: testAccProviderConfig(server) + `
+resource "truenas_group" "media" {
+  name = "media"
+}
+
+resource "truenas_user" "test" {
+  username  = "jellyfin"
+  full_name = "Jellyfin"
+  group     = truenas_group.media.id
+}
+`,
+				ExpectError: regexp.MustCompile(`Object with this username already exists`),
+			},
+		},
+	})
+}
+
+// TestAccUserResource_createNotRetried tests that a failed create is
+// reported rather than retried, since a retry after a lost response would
+// fail as a duplicate and leave the user outside of state
+func TestAccUserResource_createNotRetried(t *testing.T) {
+	server := testAccFakeServer(t)
+	server.InjectFault(fake.Fault{
+		Method:     "POST",
+		Path:       "/user",
+		StatusCode: 503,
+		Count:      1,
+	})
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+provider "truenas" {
+  base_url       = %q
+  api_key        = "test-key"
+  max_retries    = 3
+  retry_min_wait = "10ms"
+}
+
+resource "truenas_group" "media" {
+  name = "media"
+}
+
+resource "truenas_user" "test" {
+  username  = "jellyfin"
+  full_name = "Jellyfin"
+  group     = truenas_group.media.id
+}
+`, server.URL),
+				ExpectError: regexp.MustCompile(`status 503`),
+			},
+			{
+				// The fault only failed the first request, so a retry would
+				// have created the user
+				Config: testAccProviderConfig(server),
+				Check:  testAccCheckUserNotCreated(server, "jellyfin"),
+			},
+		},
+	})
+}
+
+// testAccCheckUserNotCreated verifies that the user was requested once and
+// does not exist
+func testAccCheckUserNotCreated(server *fake.Server, username string) func(*terraform.State) error {
+	return func(*terraform.State) error {
+		count := 0
+		for _, request := range server.Requests() {
+			if request.Method == "POST" && strings.HasSuffix(request.Path, "/user") {
+				count++
+			}
+		}
+		if count != 1 {
+			return fmt.Errorf("/user was called %d times, want 1", count)
+		}
+		for _, user := range server.Objects("user") {
+			if user["username"] == username {
+				return fmt.Errorf("user %s was created", username)
+			}
+		}
+		return nil
+	}
+}
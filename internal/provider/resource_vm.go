@@ -8,20 +8,31 @@ import (
 	"strings"
 	"time"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework-validators/objectvalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
 	"github.com/hashicorp/terraform-plugin-framework/attr"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/listplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/objectplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
 	"github.com/hashicorp/terraform-plugin-framework/types"
+	"gopkg.in/yaml.v3"
 	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
 )
 
 var _ resource.Resource = &VMResource{}
 var _ resource.ResourceWithImportState = &VMResource{}
+var _ resource.ResourceWithValidateConfig = &VMResource{}
+var _ resource.ResourceWithModifyPlan = &VMResource{}
 
 func NewVMResource() resource.Resource {
 	return &VMResource{}
@@ -51,6 +62,7 @@ type VMResourceModel struct {
 	Time                types.String `tfsdk:"time"`
 	Status              types.String `tfsdk:"status"`
 	MACAddresses        types.List   `tfsdk:"mac_addresses"`
+	Displays            types.List   `tfsdk:"displays"`
 	HideFromMSR         types.Bool   `tfsdk:"hide_from_msr"`
 	EnsureDisplayDevice types.Bool   `tfsdk:"ensure_display_device"`
 	NICDevices          types.List   `tfsdk:"nic_devices"`
@@ -59,14 +71,43 @@ type VMResourceModel struct {
 	DisplayDevices      types.List      `tfsdk:"display_devices"`
 	PCIDevices          types.List      `tfsdk:"pci_devices"`
 	CloudInit           *CloudInitModel `tfsdk:"cloud_init"`
+	Seed                *CloudInitModel `tfsdk:"seed"`
+	CloneFrom           *VMCloneFromModel `tfsdk:"clone_from"`
+
+	AllowStopForDeviceChanges types.Bool `tfsdk:"allow_stop_for_device_changes"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
 }
 
 type CloudInitModel struct {
-	UserData    types.String `tfsdk:"user_data"`
-	MetaData    types.String `tfsdk:"meta_data"`
-	Filename    types.String `tfsdk:"filename"`
-	UploadPath  types.String `tfsdk:"upload_path"`
-	DeviceOrder types.Int64  `tfsdk:"device_order"`
+	SeedFormat     types.String                  `tfsdk:"seed_format"`
+	UserData       types.String                  `tfsdk:"user_data"`
+	UserDataConfig *CloudInitUserDataConfigModel `tfsdk:"user_data_config"`
+	MetaData       types.String                  `tfsdk:"meta_data"`
+	NetworkConfig  types.String                  `tfsdk:"network_config"`
+	VendorData     types.String                  `tfsdk:"vendor_data"`
+	Network        *CloudInitNetworkModel        `tfsdk:"network"`
+	Filename       types.String                  `tfsdk:"filename"`
+	UploadPath     types.String                  `tfsdk:"upload_path"`
+	DeviceOrder    types.Int64                   `tfsdk:"device_order"`
+	DeviceID       types.Int64                   `tfsdk:"device_id"`
+	ContentHash    types.String                  `tfsdk:"content_hash"`
+
+	RegenerateOnChange types.Bool `tfsdk:"regenerate_on_change"`
+}
+
+// seedConfig returns the cloud_init block, or the seed block that aliases it
+func (m *VMResourceModel) seedConfig() *CloudInitModel {
+	if m.Seed != nil {
+		return m.Seed
+	}
+	return m.CloudInit
+}
+
+type VMCloneFromModel struct {
+	VMID       types.String `tfsdk:"vm_id"`
+	NameSuffix types.String `tfsdk:"name_suffix"`
+	Zvols      types.List   `tfsdk:"zvols"`
 }
 
 type NICDeviceModel struct {
@@ -213,8 +254,47 @@ func (r *VMResource) Schema(ctx context.Context, req resource.SchemaRequest, res
 				Computed:            true,
 				ElementType:         types.StringType,
 			},
+			"displays": schema.ListNestedAttribute{
+				MarkdownDescription: "How to connect to each display device of the VM, including those managed by `truenas_vm_device`",
+				Computed:            true,
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"id": schema.Int64Attribute{
+							MarkdownDescription: "ID of the display device",
+							Computed:            true,
+						},
+						"type": schema.StringAttribute{
+							MarkdownDescription: "Display type: SPICE or VNC",
+							Computed:            true,
+						},
+						"port": schema.Int64Attribute{
+							MarkdownDescription: "Port of the display server",
+							Computed:            true,
+						},
+						"web_port": schema.Int64Attribute{
+							MarkdownDescription: "Port of the web client",
+							Computed:            true,
+						},
+						"web_uri": schema.StringAttribute{
+							MarkdownDescription: "URI of the web client, null when web access is disabled. It includes the display password",
+							Computed:            true,
+							Sensitive:           true,
+						},
+						"remote_viewer_uri": schema.StringAttribute{
+							MarkdownDescription: "URI to open with remote-viewer, e.g. `spice://nas.example.com:5900`",
+							Computed:            true,
+						},
+					},
+				},
+			},
+			"allow_stop_for_device_changes": schema.BoolAttribute{
+				MarkdownDescription: "Stop the VM to apply changes to its inline device lists and restore its state afterwards. When false, device changes to a running VM take effect the next time it is started. Default: false",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(false),
+			},
 			"nic_devices": schema.ListNestedAttribute{
-				MarkdownDescription: "Network interface devices to attach to the VM",
+				MarkdownDescription: "Network interface devices to attach to the VM. Changes are reconciled with the VM's existing NICs, matched by MAC address",
 				Optional:            true,
 				NestedObject: schema.NestedAttributeObject{
 					Attributes: map[string]schema.Attribute{
@@ -224,9 +304,12 @@ func (r *VMResource) Schema(ctx context.Context, req resource.SchemaRequest, res
 							Computed:            true,
 						},
 						"mac": schema.StringAttribute{
-							MarkdownDescription: "MAC address (leave empty for auto-generation)",
+							MarkdownDescription: "MAC address (leave empty for auto-generation). NICs are matched to existing devices by MAC address, so set it to keep a NIC's identity when the list is reordered",
 							Optional:            true,
 							Computed:            true,
+							PlanModifiers: []planmodifier.String{
+								useStateForUnknownIfSet{},
+							},
 						},
 						"nic_attach": schema.StringAttribute{
 							MarkdownDescription: "Physical network interface to attach to (e.g., eno1, br0)",
@@ -242,14 +325,14 @@ func (r *VMResource) Schema(ctx context.Context, req resource.SchemaRequest, res
 							Optional:            true,
 							Computed:            true,
 							PlanModifiers: []planmodifier.Int64{
-								int64planmodifier.UseStateForUnknown(),
+								useStateForUnknownIfSet{},
 							},
 						},
 					},
 				},
 			},
 			"disk_devices": schema.ListNestedAttribute{
-				MarkdownDescription: "Disk devices to attach to the VM",
+				MarkdownDescription: "Disk devices to attach to the VM. Changes are reconciled with the VM's existing disks, matched by path",
 				Optional:            true,
 				NestedObject: schema.NestedAttributeObject{
 					Attributes: map[string]schema.Attribute{
@@ -282,14 +365,14 @@ func (r *VMResource) Schema(ctx context.Context, req resource.SchemaRequest, res
 							Optional:            true,
 							Computed:            true,
 							PlanModifiers: []planmodifier.Int64{
-								int64planmodifier.UseStateForUnknown(),
+								useStateForUnknownIfSet{},
 							},
 						},
 					},
 				},
 			},
 			"cdrom_devices": schema.ListNestedAttribute{
-				MarkdownDescription: "CD-ROM devices to attach to the VM",
+				MarkdownDescription: "CD-ROM devices to attach to the VM. Changes are reconciled with the VM's existing CD-ROMs, matched by path",
 				Optional:            true,
 				NestedObject: schema.NestedAttributeObject{
 					Attributes: map[string]schema.Attribute{
@@ -302,14 +385,14 @@ func (r *VMResource) Schema(ctx context.Context, req resource.SchemaRequest, res
 							Optional:            true,
 							Computed:            true,
 							PlanModifiers: []planmodifier.Int64{
-								int64planmodifier.UseStateForUnknown(),
+								useStateForUnknownIfSet{},
 							},
 						},
 					},
 				},
 			},
 			"display_devices": schema.ListNestedAttribute{
-				MarkdownDescription: "Display devices (SPICE/VNC) to attach to the VM for console access",
+				MarkdownDescription: "Display devices (SPICE/VNC) to attach to the VM for console access. Changes are reconciled with the VM's existing displays by position",
 				Optional:            true,
 				NestedObject: schema.NestedAttributeObject{
 					Attributes: map[string]schema.Attribute{
@@ -358,14 +441,14 @@ func (r *VMResource) Schema(ctx context.Context, req resource.SchemaRequest, res
 							Optional:            true,
 							Computed:            true,
 							PlanModifiers: []planmodifier.Int64{
-								int64planmodifier.UseStateForUnknown(),
+								useStateForUnknownIfSet{},
 							},
 						},
 					},
 				},
 			},
 			"pci_devices": schema.ListNestedAttribute{
-				MarkdownDescription: "PCI passthrough devices to attach to the VM (requires IOMMU enabled)",
+				MarkdownDescription: "PCI passthrough devices to attach to the VM (requires IOMMU enabled). Changes are reconciled with the VM's existing PCI devices, matched by pptdev",
 				Optional:            true,
 				NestedObject: schema.NestedAttributeObject{
 					Attributes: map[string]schema.Attribute{
@@ -378,7 +461,7 @@ func (r *VMResource) Schema(ctx context.Context, req resource.SchemaRequest, res
 							Optional:            true,
 							Computed:            true,
 							PlanModifiers: []planmodifier.Int64{
-								int64planmodifier.UseStateForUnknown(),
+								useStateForUnknownIfSet{},
 							},
 						},
 					},
@@ -394,45 +477,388 @@ func (r *VMResource) Schema(ctx context.Context, req resource.SchemaRequest, res
 				Optional:            true,
 				Computed:            true,
 			},
-			"cloud_init": schema.SingleNestedAttribute{
-				MarkdownDescription: "Cloud-init configuration",
+			"clone_from": schema.SingleNestedAttribute{
+				MarkdownDescription: "Create the VM as a clone of another VM, such as a golden image, with zvol clones of its disks. The cloned VM's devices are kept, and the settings and device lists of this resource are applied over them. Changing `vm_id` or `name_suffix` replaces the VM.",
 				Optional:            true,
+				PlanModifiers: []planmodifier.Object{
+					objectplanmodifier.RequiresReplaceIf(
+						cloneFromRequiresReplace,
+						"Changing the source of a cloned VM replaces it.",
+						"Changing the source of a cloned VM replaces it.",
+					),
+				},
 				Attributes: map[string]schema.Attribute{
-					"user_data": schema.StringAttribute{
-						MarkdownDescription: "Cloud-init user-data",
-						Optional:            true,
+					"vm_id": schema.StringAttribute{
+						MarkdownDescription: "ID of the VM to clone",
+						Required:            true,
 					},
-					"meta_data": schema.StringAttribute{
-						MarkdownDescription: "Cloud-init meta-data",
+					"name_suffix": schema.StringAttribute{
+						MarkdownDescription: "Clone the VM as the source VM's name followed by this suffix, then rename it to `name`. TrueNAS names the cloned zvols `<zvol>_<clone name>`, so this keeps them named after the source VM.",
 						Optional:            true,
 					},
-					"filename": schema.StringAttribute{
-						MarkdownDescription: "Name of the ISO file. Defaults to cloud-init-{vm_name}.iso",
-						Optional:            true,
+					"zvols": schema.ListAttribute{
+						MarkdownDescription: "Zvols cloned for the VM's disks. They are deleted with the VM.",
 						Computed:            true,
-						PlanModifiers: []planmodifier.String{
-							stringplanmodifier.UseStateForUnknown(),
+						ElementType:         types.StringType,
+						PlanModifiers: []planmodifier.List{
+							listplanmodifier.UseStateForUnknown(),
 						},
 					},
-					"upload_path": schema.StringAttribute{
-						MarkdownDescription: "Directory to upload the ISO to. Defaults to /mnt/{first_pool}/isos/",
-						Optional:            true,
-						Computed:            true,
-						PlanModifiers: []planmodifier.String{
-							stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"cloud_init": schema.SingleNestedAttribute{
+				MarkdownDescription: "Cloud-init configuration, written to a seed ISO attached to the VM. Conflicts with `seed`.",
+				Optional:            true,
+				Attributes:          seedSchemaAttributes(),
+				Validators: []validator.Object{
+					objectvalidator.ConflictsWith(path.MatchRoot("seed")),
+				},
+			},
+			"seed": schema.SingleNestedAttribute{
+				MarkdownDescription: "Alias of `cloud_init`, for seed formats other than cloud-init. Conflicts with `cloud_init`.",
+				Optional:            true,
+				Attributes:          seedSchemaAttributes(),
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
+	}
+}
+
+// seedSchemaAttributes returns the attributes of the cloud_init and seed
+// blocks
+func seedSchemaAttributes() map[string]schema.Attribute {
+	return map[string]schema.Attribute{
+		"seed_format": schema.StringAttribute{
+			MarkdownDescription: "Format of the seed ISO: `nocloud` (cloud-init `cidata` ISO), `talos` (`metal-iso` ISO with `config.yaml`) or `ignition` (OpenStack `config-2` config drive). Defaults to `nocloud`.",
+			Optional:            true,
+			Computed:            true,
+			Default:             stringdefault.StaticString(seedFormatNoCloud),
+			Validators: []validator.String{
+				stringvalidator.OneOf(seedFormatNoCloud, seedFormatTalos, seedFormatIgnition),
+			},
+		},
+		"user_data": schema.StringAttribute{
+			MarkdownDescription: "Cloud-init user-data, or the Talos machine configuration or Ignition config for the `talos` and `ignition` formats. It is checked to be valid YAML or JSON at plan time.",
+			Optional:            true,
+		},
+		"user_data_config": schema.SingleNestedAttribute{
+			MarkdownDescription: "Cloud-config settings, rendered to `#cloud-config` user-data. When `user_data` is also set, both are combined into MIME multipart user-data, with the lists of this block appended to those of `user_data`.",
+			Optional:            true,
+			Attributes: map[string]schema.Attribute{
+				"users": schema.ListNestedAttribute{
+					MarkdownDescription: "Users to create. A user named `default` is the distribution's default user, which is otherwise not created.",
+					Optional:            true,
+					NestedObject: schema.NestedAttributeObject{
+						Attributes: map[string]schema.Attribute{
+							"name": schema.StringAttribute{
+								MarkdownDescription: "User name",
+								Required:            true,
+							},
+							"groups": schema.ListAttribute{
+								MarkdownDescription: "Supplementary groups",
+								Optional:            true,
+								ElementType:         types.StringType,
+							},
+							"sudo": schema.StringAttribute{
+								MarkdownDescription: "Sudo rule (e.g., `ALL=(ALL) NOPASSWD:ALL`)",
+								Optional:            true,
+							},
+							"shell": schema.StringAttribute{
+								MarkdownDescription: "Login shell",
+								Optional:            true,
+							},
+							"lock_passwd": schema.BoolAttribute{
+								MarkdownDescription: "Disable password login",
+								Optional:            true,
+							},
+							"ssh_authorized_keys": schema.ListAttribute{
+								MarkdownDescription: "SSH public keys of the user",
+								Optional:            true,
+								ElementType:         types.StringType,
+							},
 						},
 					},
-					"device_order": schema.Int64Attribute{
-						MarkdownDescription: "Boot order for the cloud-init ISO device. If not specified, automatically calculates as max(existing_device_orders) + 1, or 1000 if no devices exist",
-						Optional:            true,
-						Computed:            true,
-						PlanModifiers: []planmodifier.Int64{
-							int64planmodifier.UseStateForUnknown(),
+				},
+				"ssh_authorized_keys": schema.ListAttribute{
+					MarkdownDescription: "SSH public keys of the default user",
+					Optional:            true,
+					ElementType:         types.StringType,
+				},
+				"packages": schema.ListAttribute{
+					MarkdownDescription: "Packages to install",
+					Optional:            true,
+					ElementType:         types.StringType,
+				},
+				"write_files": schema.ListNestedAttribute{
+					MarkdownDescription: "Files to write",
+					Optional:            true,
+					NestedObject: schema.NestedAttributeObject{
+						Attributes: map[string]schema.Attribute{
+							"path": schema.StringAttribute{
+								MarkdownDescription: "Path of the file",
+								Required:            true,
+							},
+							"content": schema.StringAttribute{
+								MarkdownDescription: "Content of the file",
+								Required:            true,
+							},
+							"owner": schema.StringAttribute{
+								MarkdownDescription: "Owner of the file, as `user:group`",
+								Optional:            true,
+							},
+							"permissions": schema.StringAttribute{
+								MarkdownDescription: "Octal permissions of the file (e.g., `0644`)",
+								Optional:            true,
+							},
+							"append": schema.BoolAttribute{
+								MarkdownDescription: "Append to the file instead of replacing it",
+								Optional:            true,
+							},
+						},
+					},
+				},
+				"runcmd": schema.ListAttribute{
+					MarkdownDescription: "Commands to run on first boot",
+					Optional:            true,
+					ElementType:         types.StringType,
+				},
+				"bootcmd": schema.ListAttribute{
+					MarkdownDescription: "Commands to run early on every boot",
+					Optional:            true,
+					ElementType:         types.StringType,
+				},
+			},
+		},
+		"meta_data": schema.StringAttribute{
+			MarkdownDescription: "Cloud-init meta-data",
+			Optional:            true,
+		},
+		"network_config": schema.StringAttribute{
+			MarkdownDescription: "Cloud-init network-config, in netplan version 1 or 2 format. Conflicts with `network`.",
+			Optional:            true,
+			Validators: []validator.String{
+				stringvalidator.ConflictsWith(path.MatchRelative().AtParent().AtName("network")),
+			},
+		},
+		"vendor_data": schema.StringAttribute{
+			MarkdownDescription: "Cloud-init vendor-data",
+			Optional:            true,
+		},
+		"network": schema.SingleNestedAttribute{
+			MarkdownDescription: "Guest network settings, rendered to network-config version 2. Conflicts with `network_config`.",
+			Optional:            true,
+			Attributes: map[string]schema.Attribute{
+				"interfaces": schema.ListNestedAttribute{
+					MarkdownDescription: "Guest network interfaces",
+					Required:            true,
+					NestedObject: schema.NestedAttributeObject{
+						Attributes: map[string]schema.Attribute{
+							"name": schema.StringAttribute{
+								MarkdownDescription: "Interface name in the guest (e.g., eth0, enp1s0)",
+								Required:            true,
+							},
+							"mac_address": schema.StringAttribute{
+								MarkdownDescription: "Match the interface by MAC address and rename it to `name`",
+								Optional:            true,
+							},
+							"dhcp4": schema.BoolAttribute{
+								MarkdownDescription: "Use DHCPv4. Defaults to true when no addresses are set.",
+								Optional:            true,
+							},
+							"dhcp6": schema.BoolAttribute{
+								MarkdownDescription: "Use DHCPv6",
+								Optional:            true,
+							},
+							"addresses": schema.ListAttribute{
+								MarkdownDescription: "Static addresses in CIDR notation (e.g., 192.168.1.100/24)",
+								Optional:            true,
+								ElementType:         types.StringType,
+							},
+							"gateway4": schema.StringAttribute{
+								MarkdownDescription: "IPv4 default gateway",
+								Optional:            true,
+							},
+							"gateway6": schema.StringAttribute{
+								MarkdownDescription: "IPv6 default gateway",
+								Optional:            true,
+							},
+							"mtu": schema.Int64Attribute{
+								MarkdownDescription: "Interface MTU",
+								Optional:            true,
+							},
 						},
 					},
 				},
+				"nameservers": schema.ListAttribute{
+					MarkdownDescription: "DNS servers, applied to every interface",
+					Optional:            true,
+					ElementType:         types.StringType,
+				},
+				"search_domains": schema.ListAttribute{
+					MarkdownDescription: "DNS search domains, applied to every interface",
+					Optional:            true,
+					ElementType:         types.StringType,
+				},
+			},
+		},
+		"filename": schema.StringAttribute{
+			MarkdownDescription: "Name of the ISO file. Defaults to cloud-init-{vm_name}.iso",
+			Optional:            true,
+			Computed:            true,
+			PlanModifiers: []planmodifier.String{
+				stringplanmodifier.UseStateForUnknown(),
+			},
+		},
+		"upload_path": schema.StringAttribute{
+			MarkdownDescription: "Directory to upload the ISO to. Defaults to /mnt/{first_pool}/isos/",
+			Optional:            true,
+			Computed:            true,
+			PlanModifiers: []planmodifier.String{
+				stringplanmodifier.UseStateForUnknown(),
 			},
 		},
+		"device_order": schema.Int64Attribute{
+			MarkdownDescription: "Boot order for the cloud-init ISO device. If not specified, automatically calculates as max(existing_device_orders) + 1, or 1000 if no devices exist",
+			Optional:            true,
+			Computed:            true,
+			PlanModifiers: []planmodifier.Int64{
+				int64planmodifier.UseStateForUnknown(),
+			},
+		},
+		"regenerate_on_change": schema.BoolAttribute{
+			MarkdownDescription: "Change the instance-id in meta-data whenever the content of the ISO changes, so that cloud-init runs again on the next boot. Only supported with the `nocloud` format.",
+			Optional:            true,
+			Computed:            true,
+			Default:             booldefault.StaticBool(false),
+		},
+		"device_id": schema.Int64Attribute{
+			MarkdownDescription: "ID of the CD-ROM device of the seed ISO",
+			Computed:            true,
+			PlanModifiers: []planmodifier.Int64{
+				useStateForUnknownIfSet{},
+			},
+		},
+		"content_hash": schema.StringAttribute{
+			MarkdownDescription: "SHA-256 hash of the content of the seed ISO. A new ISO is uploaded when it changes.",
+			Computed:            true,
+		},
+	}
+}
+
+// ValidateConfig checks that the documents in cloud_init or seed are valid
+// for the seed format, so that mistakes are reported at plan time instead of
+// being ignored by the guest when it boots
+func (r *VMResource) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	for _, root := range []string{"cloud_init", "seed"} {
+		var format types.String
+		resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root(root).AtName("seed_format"), &format)...)
+		if format.IsUnknown() {
+			continue
+		}
+
+		switch format.ValueString() {
+		case seedFormatTalos, seedFormatIgnition:
+			validateMachineConfigSeed(ctx, req, resp, path.Root(root), format.ValueString())
+		default:
+			validateCloudInitSeed(ctx, req, resp, path.Root(root))
+		}
+	}
+}
+
+// ModifyPlan checks the planned VM against the memory, vCPUs and
+// virtualization support of the host, so that a VM the host cannot run
+// fails the plan instead of timing out when it is started
+func (r *VMResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	// Nothing to check on destroy or before the provider is configured
+	if req.Plan.Raw.IsNull() || r.client == nil {
+		return
+	}
+
+	var plan VMResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var state *VMResourceModel
+	if !req.State.Raw.IsNull() {
+		state = &VMResourceModel{}
+		resp.Diagnostics.Append(req.State.Get(ctx, state)...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	}
+
+	checkVMCapacity(ctx, r.client, &plan, state, &resp.Diagnostics)
+}
+
+// validateCloudInitSeed checks that the cloud-config documents and
+// network-config of a nocloud seed are valid YAML
+func validateCloudInitSeed(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse, root path.Path) {
+	for _, name := range []string{"user_data", "vendor_data", "network_config"} {
+		attrPath := root.AtName(name)
+
+		var value types.String
+		resp.Diagnostics.Append(req.Config.GetAttribute(ctx, attrPath, &value)...)
+		if value.IsNull() || value.IsUnknown() {
+			continue
+		}
+
+		content := value.ValueString()
+		if name == "network_config" {
+			// network-config has no header, but is always YAML
+			content = cloudConfigHeader + "\n" + content
+		}
+		if err := validateCloudConfig(content); err != nil {
+			resp.Diagnostics.AddAttributeError(
+				attrPath,
+				"Invalid Cloud-Init Configuration",
+				fmt.Sprintf("The %s is not valid YAML: %s", strings.ReplaceAll(name, "_", "-"), err),
+			)
+		}
+	}
+}
+
+// validateMachineConfigSeed checks that a talos or ignition seed only sets
+// user_data, and that it is a YAML machine configuration or a JSON Ignition
+// config
+func validateMachineConfigSeed(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse, root path.Path, format string) {
+	for _, name := range []string{"user_data_config", "meta_data", "network_config", "vendor_data", "network", "regenerate_on_change"} {
+		var value attr.Value
+		resp.Diagnostics.Append(req.Config.GetAttribute(ctx, root.AtName(name), &value)...)
+		if value != nil && !value.IsNull() {
+			resp.Diagnostics.AddAttributeError(
+				root.AtName(name),
+				"Unsupported Seed Attribute",
+				fmt.Sprintf("%s is only supported with seed_format %q. The %s seed only contains user_data.", name, seedFormatNoCloud, format),
+			)
+		}
+	}
+
+	var userData types.String
+	resp.Diagnostics.Append(req.Config.GetAttribute(ctx, root.AtName("user_data"), &userData)...)
+	if userData.IsNull() || userData.IsUnknown() {
+		return
+	}
+
+	kind, unmarshal := "YAML Talos machine configuration", yaml.Unmarshal
+	if format == seedFormatIgnition {
+		kind, unmarshal = "JSON Ignition config", json.Unmarshal
+	}
+	var config map[string]interface{}
+	if err := unmarshal([]byte(userData.ValueString()), &config); err != nil {
+		resp.Diagnostics.AddAttributeError(
+			root.AtName("user_data"),
+			"Invalid Machine Configuration",
+			fmt.Sprintf("The user_data of a %s seed is not a valid %s: %s", format, kind, err),
+		)
 	}
 }
 
@@ -461,6 +887,15 @@ func (r *VMResource) Create(ctx context.Context, req resource.CreateRequest, res
 		return
 	}
 
+	createTimeout, diags := data.Timeouts.Create(ctx, vmTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
 	createReq := map[string]interface{}{
 		"name":   data.Name.ValueString(),
 		"memory": data.Memory.ValueInt64(),
@@ -491,13 +926,13 @@ func (r *VMResource) Create(ctx context.Context, req resource.CreateRequest, res
 	}
 
 	// Handle optional boolean fields
-	if !data.Autostart.IsNull() {
+	if !data.Autostart.IsNull() && !data.Autostart.IsUnknown() {
 		createReq["autostart"] = data.Autostart.ValueBool()
 	}
-	if !data.HideFromMSR.IsNull() {
+	if !data.HideFromMSR.IsNull() && !data.HideFromMSR.IsUnknown() {
 		createReq["hide_from_msr"] = data.HideFromMSR.ValueBool()
 	}
-	if !data.EnsureDisplayDevice.IsNull() {
+	if !data.EnsureDisplayDevice.IsNull() && !data.EnsureDisplayDevice.IsUnknown() {
 		createReq["ensure_display_device"] = data.EnsureDisplayDevice.ValueBool()
 	}
 
@@ -521,34 +956,40 @@ func (r *VMResource) Create(ctx context.Context, req resource.CreateRequest, res
 		createReq["time"] = data.Time.ValueString()
 	}
 
-	respBody, err := r.client.Post("/vm", createReq)
-	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create VM, got error: %s", err))
-		return
-	}
+	if data.CloneFrom != nil {
+		if !r.createFromClone(ctx, &data, createReq, &resp.Diagnostics) {
+			return
+		}
+	} else {
+		respBody, err := r.client.Post(ctx, "/vm", createReq)
+		if err != nil {
+			addClientError(&resp.Diagnostics, "create VM", err, &data, nil)
+			return
+		}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		resp.Diagnostics.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
-		return
-	}
+		var result map[string]interface{}
+		if err := json.Unmarshal(respBody, &result); err != nil {
+			resp.Diagnostics.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
+			return
+		}
 
-	if id, ok := result["id"].(float64); ok {
-		data.ID = types.StringValue(strconv.Itoa(int(id)))
-	}
+		if id, ok := result["id"].(float64); ok {
+			data.ID = types.StringValue(strconv.Itoa(int(id)))
+		}
 
-	// Handle Cloud-Init
-	if data.CloudInit != nil {
-		if err := r.handleCloudInitCreate(ctx, &data); err != nil {
-			resp.Diagnostics.AddError("Cloud-Init Error", fmt.Sprintf("Failed to setup cloud-init: %s", err))
-			return
+		// Handle Cloud-Init
+		if data.seedConfig() != nil {
+			if err := r.handleCloudInitCreate(ctx, &data); err != nil {
+				resp.Diagnostics.AddError("Cloud-Init Error", fmt.Sprintf("Failed to setup cloud-init: %s", err))
+				return
+			}
 		}
-	}
 
-	// Create devices after VM creation
-	r.createDevices(ctx, &data, &resp.Diagnostics)
-	if resp.Diagnostics.HasError() {
-		return
+		// Create devices after VM creation
+		r.createDevices(ctx, &data, &resp.Diagnostics)
+		if resp.Diagnostics.HasError() {
+			return
+		}
 	}
 
 	// Determine desired state for the VM
@@ -566,7 +1007,9 @@ func (r *VMResource) Create(ctx context.Context, req resource.CreateRequest, res
 	// Transition VM to desired state
 	r.transitionVMState(ctx, data.ID.ValueString(), desiredState, &resp.Diagnostics)
 
-	r.readVM(ctx, &data, &resp.Diagnostics)
+	if !r.readVM(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read VM: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -578,11 +1021,26 @@ func (r *VMResource) Read(ctx context.Context, req resource.ReadRequest, resp *r
 		return
 	}
 
-	r.readVM(ctx, &data, &resp.Diagnostics)
+	readTimeout, diags := data.Timeouts.Read(ctx, vmTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	found := r.readVM(ctx, &data, &resp.Diagnostics)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
+	if !found {
+		// Deleted outside of Terraform; drop it from state so it is re-created
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -596,6 +1054,15 @@ func (r *VMResource) Update(ctx context.Context, req resource.UpdateRequest, res
 		return
 	}
 
+	updateTimeout, diags := plan.Timeouts.Update(ctx, vmTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
 	// Build update payload with only changed, valid values
 	updateReq := make(map[string]interface{})
 
@@ -701,56 +1168,22 @@ func (r *VMResource) Update(ctx context.Context, req resource.UpdateRequest, res
 	}
 
 	endpoint := fmt.Sprintf("/vm/id/%s", plan.ID.ValueString())
-	_, err := r.client.Put(endpoint, updateReq)
+	_, err := r.client.Put(ctx, endpoint, updateReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to update VM, got error: %s", err))
+		addClientError(&resp.Diagnostics, "update VM", err, &plan, nil)
 		return
 	}
 
-	// Handle Cloud-Init updates
-	if plan.CloudInit != nil {
-		// If cloud-init config changed, regenerate and upload ISO
-		// We assume the path hasn't changed for simplicity in this iteration, or if it has, we handle it.
-		// Since we don't track the device ID of the cloud-init ISO, replacing it is tricky if path changes.
-		// For now, we'll just overwrite the file if the path is the same.
-		
-		// Determine path (re-using logic from Create, should probably be shared)
-		filename := plan.CloudInit.Filename.ValueString()
-		if filename == "" {
-			filename = fmt.Sprintf("cloud-init-%s.iso", plan.Name.ValueString())
-			// Update plan with computed value
-			plan.CloudInit.Filename = types.StringValue(filename)
-		}
-
-		uploadPath := plan.CloudInit.UploadPath.ValueString()
-		if uploadPath == "" {
-			// If not in plan, try state, or fetch default
-			if !state.CloudInit.UploadPath.IsNull() {
-				uploadPath = state.CloudInit.UploadPath.ValueString()
-			} else {
-				poolName, err := r.getFirstPoolName()
-				if err == nil {
-					uploadPath = fmt.Sprintf("/mnt/%s/isos", poolName)
-				}
-			}
-			plan.CloudInit.UploadPath = types.StringValue(uploadPath)
-		}
+	// Regenerate the seed ISO and point its CD-ROM device at it
+	r.updateSeed(ctx, &plan, &state, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
 
-		if uploadPath != "" {
-			fullPath := fmt.Sprintf("%s/%s", strings.TrimRight(uploadPath, "/"), filename)
-			
-			userData := plan.CloudInit.UserData.ValueString()
-			metaData := plan.CloudInit.MetaData.ValueString()
-			
-			isoBytes, err := GenerateCloudInitISO(userData, metaData)
-			if err == nil {
-				if err := r.client.UploadFile(fullPath, isoBytes); err != nil {
-					resp.Diagnostics.AddWarning("Cloud-Init Update", fmt.Sprintf("Failed to upload updated cloud-init ISO: %s", err))
-				}
-			} else {
-				resp.Diagnostics.AddWarning("Cloud-Init Update", fmt.Sprintf("Failed to generate cloud-init ISO: %s", err))
-			}
-		}
+	// Reconcile the inline device lists with the VM's devices
+	r.updateDevices(ctx, &plan, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
 	}
 
 	// Handle state transitions if desired_state is specified
@@ -758,12 +1191,78 @@ func (r *VMResource) Update(ctx context.Context, req resource.UpdateRequest, res
 		r.transitionVMState(ctx, plan.ID.ValueString(), plan.DesiredState.ValueString(), &resp.Diagnostics)
 	}
 
-	r.readVM(ctx, &plan, &resp.Diagnostics)
+	if !r.readVM(ctx, &plan, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read VM: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
 }
 
-func (r *VMResource) getFirstPoolName() (string, error) {
-	respBody, err := r.client.Get("/pool")
+// createFromClone creates the VM as a clone of clone_from.vm_id, then
+// applies the settings in createReq, the cloud-init ISO and the device lists
+// over the clone. If any step fails the clone and its zvols are removed, and
+// false is returned.
+func (r *VMResource) createFromClone(ctx context.Context, data *VMResourceModel, createReq map[string]interface{}, diags *diag.Diagnostics) bool {
+	clone, err := cloneVM(ctx, r.client, data.CloneFrom.VMID.ValueString(), data.Name.ValueString(), data.CloneFrom.NameSuffix.ValueString())
+	if err != nil {
+		addClientError(diags, "clone VM", err, data, nil)
+		return false
+	}
+	data.ID = types.StringValue(clone.ID)
+
+	zvols, d := types.ListValueFrom(ctx, types.StringType, clone.Zvols)
+	diags.Append(d...)
+	data.CloneFrom.Zvols = zvols
+
+	// The settings of the configuration override the cloned ones
+	endpoint := fmt.Sprintf("/vm/id/%s", clone.ID)
+	if _, err := r.client.Put(ctx, endpoint, createReq); err != nil {
+		addClientError(diags, "update cloned VM", err, data, nil)
+	}
+
+	if !diags.HasError() && data.seedConfig() != nil {
+		if err := r.handleCloudInitCreate(ctx, data); err != nil {
+			diags.AddError("Cloud-Init Error", fmt.Sprintf("Failed to setup cloud-init: %s", err))
+		}
+	}
+
+	// Reconcile the device lists with the devices of the clone. NICs
+	// without a MAC address keep the one TrueNAS generated for the clone.
+	if !diags.HasError() {
+		r.updateDevices(ctx, data, diags)
+	}
+
+	if diags.HasError() {
+		cleanupCtx, cancel := cleanupContext(ctx)
+		defer cancel()
+		removeVMClone(cleanupCtx, r.client, clone.ID, clone.Zvols, diags)
+		return false
+	}
+	return true
+}
+
+// cloneFromRequiresReplace replaces a VM whose clone source changes. Adding
+// clone_from to an existing VM replaces it too, while removing it does not.
+func cloneFromRequiresReplace(ctx context.Context, req planmodifier.ObjectRequest, resp *objectplanmodifier.RequiresReplaceIfFuncResponse) {
+	if req.PlanValue.IsNull() || req.PlanValue.IsUnknown() {
+		return
+	}
+	if req.StateValue.IsNull() {
+		resp.RequiresReplace = true
+		return
+	}
+
+	plan := req.PlanValue.Attributes()
+	state := req.StateValue.Attributes()
+	for _, field := range []string{"vm_id", "name_suffix"} {
+		if !plan[field].Equal(state[field]) {
+			resp.RequiresReplace = true
+			return
+		}
+	}
+}
+
+func (r *VMResource) getFirstPoolName(ctx context.Context) (string, error) {
+	respBody, err := r.client.Get(ctx, "/pool")
 	if err != nil {
 		return "", err
 	}
@@ -781,9 +1280,9 @@ func (r *VMResource) getFirstPoolName() (string, error) {
 }
 
 // getMaxDeviceOrder retrieves the maximum device order from existing VM devices
-func (r *VMResource) getMaxDeviceOrder(vmID string) (int64, error) {
+func (r *VMResource) getMaxDeviceOrder(ctx context.Context, vmID string) (int64, error) {
 	endpoint := fmt.Sprintf("/vm/id/%s", vmID)
-	respBody, err := r.client.Get(endpoint)
+	respBody, err := r.client.Get(ctx, endpoint)
 	if err != nil {
 		return 0, err
 	}
@@ -809,47 +1308,119 @@ func (r *VMResource) getMaxDeviceOrder(vmID string) (int64, error) {
 	return maxOrder, nil
 }
 
-func (r *VMResource) handleCloudInitCreate(ctx context.Context, data *VMResourceModel) error {
-	userData := data.CloudInit.UserData.ValueString()
-	metaData := data.CloudInit.MetaData.ValueString()
+// cloudInitISO generates the seed ISO for the cloud_init or seed block and
+// returns it with the hash of its content. With regenerate_on_change, the
+// instance-id in meta-data is derived from the hash, so that cloud-init runs
+// again whenever the content changes.
+func cloudInitISO(ctx context.Context, vmName string, cloudInit *CloudInitModel) ([]byte, string, error) {
+	userData, err := cloudInitUserData(ctx, cloudInit)
+	if err != nil {
+		return nil, "", err
+	}
+	networkConfig, err := cloudInitNetworkConfig(ctx, cloudInit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	format := cloudInit.SeedFormat.ValueString()
+	seed := SeedData{
+		UserData:      userData,
+		MetaData:      cloudInit.MetaData.ValueString(),
+		NetworkConfig: networkConfig,
+		VendorData:    cloudInit.VendorData.ValueString(),
+	}
+	if cloudInit.RegenerateOnChange.ValueBool() {
+		if seed.MetaData, err = withInstanceID(seed.MetaData, vmName, seedContentHash(format, seed)); err != nil {
+			return nil, "", err
+		}
+	}
 
-	isoBytes, err := GenerateCloudInitISO(userData, metaData)
+	iso, err := GenerateSeedISO(format, seed)
+	return iso, seedContentHash(format, seed), err
+}
+
+// withInstanceID sets the instance-id of a meta-data document to its current
+// value, or the VM name, followed by the first characters of hash
+func withInstanceID(metaData, vmName, hash string) (string, error) {
+	document := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(metaData), &document); err != nil {
+		return "", fmt.Errorf("failed to parse meta-data: %w", err)
+	}
+	if document == nil {
+		document = map[string]interface{}{}
+	}
+
+	base := vmName
+	if id, ok := document["instance-id"].(string); ok && id != "" {
+		base = id
+	}
+	document["instance-id"] = fmt.Sprintf("%s-%s", base, hash[:12])
+
+	out, err := yaml.Marshal(document)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("failed to render meta-data: %w", err)
 	}
+	return string(out), nil
+}
+
+// resolveSeedPath fills in the default filename and upload_path of the seed
+// ISO and returns its full path
+func (r *VMResource) resolveSeedPath(ctx context.Context, data *VMResourceModel) (string, error) {
+	cloudInit := data.seedConfig()
 
-	// Determine path
-	filename := data.CloudInit.Filename.ValueString()
+	filename := cloudInit.Filename.ValueString()
 	if filename == "" {
 		filename = fmt.Sprintf("cloud-init-%s.iso", data.Name.ValueString())
-		data.CloudInit.Filename = types.StringValue(filename)
+		cloudInit.Filename = types.StringValue(filename)
 	}
 
-	uploadPath := data.CloudInit.UploadPath.ValueString()
+	uploadPath := cloudInit.UploadPath.ValueString()
 	if uploadPath == "" {
-		poolName, err := r.getFirstPoolName()
+		poolName, err := r.getFirstPoolName(ctx)
 		if err != nil {
-			return err
+			return "", err
 		}
 		uploadPath = fmt.Sprintf("/mnt/%s/isos", poolName)
-		data.CloudInit.UploadPath = types.StringValue(uploadPath)
+		cloudInit.UploadPath = types.StringValue(uploadPath)
 	}
 
-	fullPath := fmt.Sprintf("%s/%s", strings.TrimRight(uploadPath, "/"), filename)
+	return fmt.Sprintf("%s/%s", strings.TrimRight(uploadPath, "/"), filename), nil
+}
 
-	// Upload
-	if err := r.client.UploadFile(fullPath, isoBytes); err != nil {
+func (r *VMResource) handleCloudInitCreate(ctx context.Context, data *VMResourceModel) error {
+	cloudInit := data.seedConfig()
+	isoBytes, hash, err := cloudInitISO(ctx, data.Name.ValueString(), cloudInit)
+	if err != nil {
 		return err
 	}
+	cloudInit.ContentHash = types.StringValue(hash)
 
-	// Determine device order for cloud-init ISO
-	var deviceOrder int64
-	if !data.CloudInit.DeviceOrder.IsNull() {
+	fullPath, err := r.resolveSeedPath(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	// Upload
+	if err := r.client.UploadFile(ctx, fullPath, isoBytes); err != nil {
+		return err
+	}
+
+	return r.attachSeedDevice(ctx, data, fullPath)
+}
+
+// attachSeedDevice adds the CD-ROM device of the seed ISO to the VM and
+// records its ID
+func (r *VMResource) attachSeedDevice(ctx context.Context, data *VMResourceModel, fullPath string) error {
+	cloudInit := data.seedConfig()
+
+	// Determine device order for cloud-init ISO
+	var deviceOrder int64
+	if !cloudInit.DeviceOrder.IsNull() && !cloudInit.DeviceOrder.IsUnknown() {
 		// Use user-specified order if provided
-		deviceOrder = data.CloudInit.DeviceOrder.ValueInt64()
+		deviceOrder = cloudInit.DeviceOrder.ValueInt64()
 	} else {
 		// Auto-calculate next available order based on existing devices
-		maxOrder, err := r.getMaxDeviceOrder(data.ID.ValueString())
+		maxOrder, err := r.getMaxDeviceOrder(ctx, data.ID.ValueString())
 		if err != nil {
 			// If we can't get existing devices, default to 1000
 			deviceOrder = 1000
@@ -861,7 +1432,7 @@ func (r *VMResource) handleCloudInitCreate(ctx context.Context, data *VMResource
 			deviceOrder = 1000
 		}
 		// Set computed value
-		data.CloudInit.DeviceOrder = types.Int64Value(deviceOrder)
+		cloudInit.DeviceOrder = types.Int64Value(deviceOrder)
 	}
 
 	// Add CDROM device
@@ -874,8 +1445,139 @@ func (r *VMResource) handleCloudInitCreate(ctx context.Context, data *VMResource
 		},
 	}
 
-	_, err = r.client.Post("/vm/device", deviceReq)
-	return err
+	respBody, err := r.client.CreateVMDevice(ctx, deviceReq)
+	if err != nil {
+		return err
+	}
+
+	var device map[string]interface{}
+	if err := json.Unmarshal(respBody, &device); err != nil {
+		return fmt.Errorf("failed to parse device: %w", err)
+	}
+	if id, ok := device["id"].(float64); ok {
+		cloudInit.DeviceID = types.Int64Value(int64(id))
+	}
+	return nil
+}
+
+// findSeedDevice returns the CD-ROM device of the seed ISO in the prior
+// state: the device with its recorded ID, or for state written before the
+// ID was recorded, the CD-ROM with its path. It returns nil if the device no
+// longer exists.
+func (r *VMResource) findSeedDevice(ctx context.Context, state *VMResourceModel) (*vmDevice, error) {
+	result, err := r.client.GetVMStatus(ctx, state.ID.ValueString())
+	if err != nil {
+		return nil, err
+	}
+
+	prior := state.seedConfig()
+	priorPath := cloudInitISOPath(state)
+	for _, device := range parseVMDevices(result) {
+		if device.DType != "CDROM" {
+			continue
+		}
+		if prior.DeviceID.IsNull() || prior.DeviceID.IsUnknown() {
+			if device.key() == priorPath {
+				return &device, nil
+			}
+		} else if device.ID == prior.DeviceID.ValueInt64() {
+			return &device, nil
+		}
+	}
+	return nil, nil
+}
+
+// updateSeed applies changes to the cloud_init or seed block. When the
+// content or path of the ISO changes, the new ISO is uploaded, the CD-ROM
+// device is pointed at it and the ISO at the old path is deleted. Removing
+// the block detaches the device and deletes the ISO.
+func (r *VMResource) updateSeed(ctx context.Context, plan, state *VMResourceModel, diags *diag.Diagnostics) {
+	cloudInit, prior := plan.seedConfig(), state.seedConfig()
+	if cloudInit == nil && prior == nil {
+		return
+	}
+
+	var device *vmDevice
+	if prior != nil {
+		var err error
+		if device, err = r.findSeedDevice(ctx, state); err != nil {
+			diags.AddError("Client Error", fmt.Sprintf("Unable to read VM devices, got error: %s", err))
+			return
+		}
+	}
+	priorPath := cloudInitISOPath(state)
+
+	if cloudInit == nil {
+		if device != nil {
+			if _, err := r.client.DeleteVMDevice(ctx, strconv.FormatInt(device.ID, 10)); err != nil {
+				diags.AddError("Cloud-Init Error", fmt.Sprintf("Unable to remove cloud-init ISO device %d: %s", device.ID, err))
+				return
+			}
+		}
+		r.deleteSeedISO(ctx, priorPath, diags)
+		return
+	}
+
+	isoBytes, hash, err := cloudInitISO(ctx, plan.Name.ValueString(), cloudInit)
+	if err != nil {
+		diags.AddError("Cloud-Init Error", fmt.Sprintf("Failed to generate cloud-init ISO: %s", err))
+		return
+	}
+	cloudInit.ContentHash = types.StringValue(hash)
+
+	fullPath, err := r.resolveSeedPath(ctx, plan)
+	if err != nil {
+		diags.AddError("Cloud-Init Error", fmt.Sprintf("Failed to determine cloud-init ISO path: %s", err))
+		return
+	}
+
+	if prior == nil || fullPath != priorPath || hash != prior.ContentHash.ValueString() || device == nil {
+		if err := r.client.UploadFile(ctx, fullPath, isoBytes); err != nil {
+			diags.AddError("Cloud-Init Error", fmt.Sprintf("Failed to upload cloud-init ISO: %s", err))
+			return
+		}
+	}
+
+	if device == nil {
+		if err := r.attachSeedDevice(ctx, plan, fullPath); err != nil {
+			diags.AddError("Cloud-Init Error", fmt.Sprintf("Failed to attach cloud-init ISO: %s", err))
+			return
+		}
+	} else {
+		cloudInit.DeviceID = types.Int64Value(device.ID)
+		if cloudInit.DeviceOrder.IsNull() || cloudInit.DeviceOrder.IsUnknown() {
+			cloudInit.DeviceOrder = types.Int64Value(device.Order)
+		}
+
+		params := map[string]interface{}{}
+		if device.key() != fullPath {
+			params["attributes"] = map[string]interface{}{"path": fullPath}
+		}
+		if cloudInit.DeviceOrder.ValueInt64() != device.Order {
+			params["order"] = cloudInit.DeviceOrder.ValueInt64()
+		}
+		if len(params) > 0 {
+			if _, err := r.client.UpdateVMDevice(ctx, strconv.FormatInt(device.ID, 10), params); err != nil {
+				diags.AddError("Cloud-Init Error", fmt.Sprintf("Unable to update cloud-init ISO device %d: %s", device.ID, err))
+				return
+			}
+		}
+	}
+
+	if priorPath != "" && priorPath != fullPath {
+		r.deleteSeedISO(ctx, priorPath, diags)
+	}
+}
+
+// deleteSeedISO deletes a seed ISO that is no longer used. Failures are only
+// reported as warnings, since the VM itself is up to date.
+func (r *VMResource) deleteSeedISO(ctx context.Context, fullPath string, diags *diag.Diagnostics) {
+	if fullPath == "" {
+		return
+	}
+	if err := r.client.DeleteFile(ctx, fullPath); err != nil && !truenas.IsNoEntry(err) {
+		diags.AddWarning("Cloud-Init Cleanup", fmt.Sprintf("Failed to delete cloud-init ISO at %s: %s", fullPath, err))
+	}
 }
 
 func (r *VMResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
@@ -886,33 +1588,54 @@ func (r *VMResource) Delete(ctx context.Context, req resource.DeleteRequest, res
 		return
 	}
 
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, vmTimeouts.Delete)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
 	endpoint := fmt.Sprintf("/vm/id/%s", data.ID.ValueString())
-	_, err := r.client.Delete(endpoint)
+	_, err := r.client.Delete(ctx, endpoint)
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete VM, got error: %s", err))
 		return
 	}
 
-	// Delete Cloud-Init ISO if it exists
-	if data.CloudInit != nil {
-		uploadPath := data.CloudInit.UploadPath.ValueString()
-		filename := data.CloudInit.Filename.ValueString()
-		if uploadPath != "" && filename != "" {
-			fullPath := fmt.Sprintf("%s/%s", strings.TrimRight(uploadPath, "/"), filename)
-			if err := r.client.DeleteFile(fullPath); err != nil {
-				resp.Diagnostics.AddWarning("Cloud-Init Cleanup", fmt.Sprintf("Failed to delete cloud-init ISO at %s: %s", fullPath, err))
-			}
+	// Delete the zvols cloned for the VM
+	if data.CloneFrom != nil && !data.CloneFrom.Zvols.IsNull() && !data.CloneFrom.Zvols.IsUnknown() {
+		var zvols []string
+		resp.Diagnostics.Append(data.CloneFrom.Zvols.ElementsAs(ctx, &zvols, false)...)
+		if err := deleteClonedZvols(ctx, r.client, zvols); err != nil {
+			resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete cloned zvols, got error: %s", err))
+			return
 		}
 	}
+
+	// Delete Cloud-Init ISO if it exists
+	r.deleteSeedISO(ctx, cloudInitISOPath(&data), &resp.Diagnostics)
 }
 
 func (r *VMResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
 	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
 }
 
+const (
+	// vmStateTransitionAttempts is how many times a state change is attempted
+	vmStateTransitionAttempts = 3
+	// vmStateRetryDelay is the pause between transition attempts
+	vmStateRetryDelay = 5 * time.Second
+	// vmStateSettleDelay is the pause between the steps of a compound transition
+	vmStateSettleDelay = 2 * time.Second
+	// vmStatePollInterval is how often the VM state is polled during a transition
+	vmStatePollInterval = 2 * time.Second
+)
+
 // getCurrentVMState retrieves the current state of the VM
-func (r *VMResource) getCurrentVMState(vmID string) (string, error) {
-	result, err := r.client.GetVMStatus(vmID)
+func (r *VMResource) getCurrentVMState(ctx context.Context, vmID string) (string, error) {
+	result, err := r.client.GetVMStatus(ctx, vmID)
 	if err != nil {
 		return "", err
 	}
@@ -952,7 +1675,7 @@ func (r *VMResource) transitionVMState(ctx context.Context, vmID string, desired
 	}
 
 	// Get current state
-	currentState, err := r.getCurrentVMState(vmID)
+	currentState, err := r.getCurrentVMState(ctx, vmID)
 	if err != nil {
 		diags.AddWarning(
 			"VM State Check Warning",
@@ -966,19 +1689,21 @@ func (r *VMResource) transitionVMState(ctx context.Context, vmID string, desired
 		return
 	}
 
-	// Define state transition logic
+	// Define state transition logic. The overall deadline comes from the
+	// operation context, which honours the resource timeouts block.
 	var transitionErr error
-	maxRetries := 3
-	retryDelay := 5 * time.Second
-	timeout := 5 * time.Minute
+	attempts := 0
 
-	for attempt := 0; attempt < maxRetries; attempt++ {
+	for attempt := 0; attempt < vmStateTransitionAttempts; attempt++ {
 		if attempt > 0 {
-			time.Sleep(retryDelay)
+			if err := sleepWithContext(ctx, vmStateRetryDelay); err != nil {
+				break
+			}
 		}
+		attempts++
 
 		// Re-check current state before attempting transition
-		currentState, err = r.getCurrentVMState(vmID)
+		currentState, err = r.getCurrentVMState(ctx, vmID)
 		if err != nil {
 			transitionErr = err
 			continue
@@ -992,41 +1717,53 @@ func (r *VMResource) transitionVMState(ctx context.Context, vmID string, desired
 		// Perform state transition based on current and desired states
 		switch {
 		case desiredState == "RUNNING" && currentState == "STOPPED":
-			_, transitionErr = r.client.StartVM(vmID)
+			_, transitionErr = r.client.StartVM(ctx, vmID)
 		case desiredState == "RUNNING" && currentState == "SUSPENDED":
-			_, transitionErr = r.client.ResumeVM(vmID)
+			_, transitionErr = r.client.ResumeVM(ctx, vmID)
 		case desiredState == "STOPPED" && currentState == "RUNNING":
 			// Try graceful stop first
-			_, transitionErr = r.client.StopVM(vmID)
+			_, transitionErr = r.client.StopVM(ctx, vmID)
 			if transitionErr != nil {
 				// If graceful stop fails, try power off
-				time.Sleep(2 * time.Second)
-				_, transitionErr = r.client.PowerOffVM(vmID)
+				if err := sleepWithContext(ctx, vmStateSettleDelay); err != nil {
+					transitionErr = err
+					continue
+				}
+				_, transitionErr = r.client.PowerOffVM(ctx, vmID)
 			}
 		case desiredState == "STOPPED" && currentState == "SUSPENDED":
 			// Resume first, then stop
-			_, err = r.client.ResumeVM(vmID)
+			_, err = r.client.ResumeVM(ctx, vmID)
 			if err != nil {
 				transitionErr = err
 				continue
 			}
-			time.Sleep(2 * time.Second)
-			_, transitionErr = r.client.StopVM(vmID)
+			if err := sleepWithContext(ctx, vmStateSettleDelay); err != nil {
+				transitionErr = err
+				continue
+			}
+			_, transitionErr = r.client.StopVM(ctx, vmID)
 			if transitionErr != nil {
-				time.Sleep(2 * time.Second)
-				_, transitionErr = r.client.PowerOffVM(vmID)
+				if err := sleepWithContext(ctx, vmStateSettleDelay); err != nil {
+					transitionErr = err
+					continue
+				}
+				_, transitionErr = r.client.PowerOffVM(ctx, vmID)
 			}
 		case desiredState == "SUSPENDED" && currentState == "RUNNING":
-			_, transitionErr = r.client.SuspendVM(vmID)
+			_, transitionErr = r.client.SuspendVM(ctx, vmID)
 		case desiredState == "SUSPENDED" && currentState == "STOPPED":
 			// Start first, then suspend
-			_, err = r.client.StartVM(vmID)
+			_, err = r.client.StartVM(ctx, vmID)
 			if err != nil {
 				transitionErr = err
 				continue
 			}
-			time.Sleep(2 * time.Second)
-			_, transitionErr = r.client.SuspendVM(vmID)
+			if err := sleepWithContext(ctx, vmStateSettleDelay); err != nil {
+				transitionErr = err
+				continue
+			}
+			_, transitionErr = r.client.SuspendVM(ctx, vmID)
 		default:
 			diags.AddWarning(
 				"Unsupported State Transition",
@@ -1039,12 +1776,14 @@ func (r *VMResource) transitionVMState(ctx context.Context, vmID string, desired
 			continue
 		}
 
-		// Wait for state transition to complete
-		startTime := time.Now()
-		for time.Since(startTime) < timeout {
-			time.Sleep(2 * time.Second)
+		// Wait for state transition to complete or the operation to time out
+		for {
+			if err := sleepWithContext(ctx, vmStatePollInterval); err != nil {
+				transitionErr = fmt.Errorf("timeout waiting for VM to reach %s state: %w", desiredState, err)
+				break
+			}
 
-			newState, err := r.getCurrentVMState(vmID)
+			newState, err := r.getCurrentVMState(ctx, vmID)
 			if err != nil {
 				continue
 			}
@@ -1053,33 +1792,39 @@ func (r *VMResource) transitionVMState(ctx context.Context, vmID string, desired
 				return
 			}
 		}
-
-		transitionErr = fmt.Errorf("timeout waiting for VM to reach %s state", desiredState)
 	}
 
 	// If we get here, all retries failed
 	if transitionErr != nil {
 		diags.AddWarning(
 			"VM State Transition Warning",
-			fmt.Sprintf("Unable to transition VM to %s state after %d attempts: %s. You may need to manually manage the VM state.", desiredState, maxRetries, transitionErr),
+			fmt.Sprintf("Unable to transition VM to %s state after %d attempts: %s. You may need to manually manage the VM state.", desiredState, attempts, transitionErr),
 		)
 	}
 }
 
-func (r *VMResource) readVM(ctx context.Context, data *VMResourceModel, diags *diag.Diagnostics) {
+// readVM refreshes data from the API. It returns false, without adding a
+// diagnostic, when the VM no longer exists.
+func (r *VMResource) readVM(ctx context.Context, data *VMResourceModel, diags *diag.Diagnostics) bool {
 	endpoint := fmt.Sprintf("/vm/id/%s", data.ID.ValueString())
-	respBody, err := r.client.Get(endpoint)
+	respBody, err := r.client.Get(ctx, endpoint)
 	if err != nil {
+		if truenas.IsNotFound(err) {
+			return false
+		}
 		diags.AddError("Client Error", fmt.Sprintf("Unable to read VM, got error: %s", err))
-		return
+		return false
 	}
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(respBody, &result); err != nil {
 		diags.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
-		return
+		return false
 	}
 
+	// Only the ID is set when the VM is being imported
+	importing := data.Name.IsNull()
+
 	// Read ID
 	if id, ok := result["id"].(float64); ok {
 		data.ID = types.StringValue(strconv.Itoa(int(id)))
@@ -1189,179 +1934,31 @@ func (r *VMResource) readVM(ctx context.Context, data *VMResourceModel, diags *d
 		}
 	}
 
-	// Read devices from API response
-	macAddresses := []string{}
-	var nics []NICDeviceModel
-	var disks []DiskDeviceModel
-	var cdroms []CDROMDeviceModel
-	var displays []DisplayDeviceModel
-	var pciDevices []PCIDeviceModel
+	// Read devices from API response. mac_addresses covers every NIC, while
+	// the inline lists only cover the device types they manage.
+	devices := parseVMDevices(result)
 
-	if devices, ok := result["devices"].([]interface{}); ok {
+	// Forget the seed ISO device if it was removed outside of Terraform, so
+	// that the next update attaches it again
+	if cloudInit := data.seedConfig(); cloudInit != nil && !cloudInit.DeviceID.IsNull() && !cloudInit.DeviceID.IsUnknown() {
+		found := false
 		for _, device := range devices {
-			if deviceMap, ok := device.(map[string]interface{}); ok {
-				dtype, _ := deviceMap["dtype"].(string)
-				attributes, _ := deviceMap["attributes"].(map[string]interface{})
-
-				switch dtype {
-				case "NIC":
-					nic := NICDeviceModel{}
-					if nicType, ok := attributes["type"].(string); ok {
-						nic.Type = types.StringValue(nicType)
-					} else {
-						nic.Type = types.StringNull()
-					}
-					if mac, ok := attributes["mac"].(string); ok && mac != "" {
-						nic.MAC = types.StringValue(mac)
-						macAddresses = append(macAddresses, mac)
-					} else {
-						nic.MAC = types.StringNull()
-					}
-					if nicAttach, ok := attributes["nic_attach"].(string); ok {
-						nic.NICAttach = types.StringValue(nicAttach)
-					} else {
-						nic.NICAttach = types.StringNull()
-					}
-					if trustRx, ok := attributes["trust_guest_rx_filters"].(bool); ok {
-						nic.TrustGuestRxFilters = types.BoolValue(trustRx)
-					} else {
-						nic.TrustGuestRxFilters = types.BoolNull()
-					}
-					// Read order from device level (not attributes)
-					if order, ok := deviceMap["order"].(float64); ok {
-						nic.Order = types.Int64Value(int64(order))
-					} else {
-						nic.Order = types.Int64Null()
-					}
-					nics = append(nics, nic)
-
-				case "DISK":
-					disk := DiskDeviceModel{}
-					if path, ok := attributes["path"].(string); ok {
-						disk.Path = types.StringValue(path)
-					} else {
-						disk.Path = types.StringNull()
-					}
-					if diskType, ok := attributes["type"].(string); ok {
-						disk.Type = types.StringValue(diskType)
-					} else {
-						disk.Type = types.StringNull()
-					}
-					if iotype, ok := attributes["iotype"].(string); ok {
-						disk.IOType = types.StringValue(iotype)
-					} else {
-						disk.IOType = types.StringNull()
-					}
-					if physSector, ok := attributes["physical_sectorsize"].(float64); ok {
-						disk.PhysicalSectorSize = types.Int64Value(int64(physSector))
-					} else {
-						disk.PhysicalSectorSize = types.Int64Null()
-					}
-					if logSector, ok := attributes["logical_sectorsize"].(float64); ok {
-						disk.LogicalSectorSize = types.Int64Value(int64(logSector))
-					} else {
-						disk.LogicalSectorSize = types.Int64Null()
-					}
-					// Read order from device level (not attributes)
-					if order, ok := deviceMap["order"].(float64); ok {
-						disk.Order = types.Int64Value(int64(order))
-					} else {
-						disk.Order = types.Int64Null()
-					}
-					disks = append(disks, disk)
-
-				case "CDROM":
-					cdrom := CDROMDeviceModel{}
-					if path, ok := attributes["path"].(string); ok {
-						// Check if this is the cloud-init ISO and skip it if so
-						if data.CloudInit != nil && !data.CloudInit.UploadPath.IsNull() && !data.CloudInit.Filename.IsNull() {
-							cloudInitPath := fmt.Sprintf("%s/%s", strings.TrimRight(data.CloudInit.UploadPath.ValueString(), "/"), data.CloudInit.Filename.ValueString())
-							if path == cloudInitPath {
-								continue
-							}
-						}
-						cdrom.Path = types.StringValue(path)
-					} else {
-						cdrom.Path = types.StringNull()
-					}
-					// Read order from device level (not attributes)
-					if order, ok := deviceMap["order"].(float64); ok {
-						cdrom.Order = types.Int64Value(int64(order))
-					} else {
-						cdrom.Order = types.Int64Null()
-					}
-					cdroms = append(cdroms, cdrom)
-
-				case "DISPLAY":
-					display := DisplayDeviceModel{}
-					if port, ok := attributes["port"].(float64); ok {
-						display.Port = types.Int64Value(int64(port))
-					} else {
-						display.Port = types.Int64Null()
-					}
-					if bind, ok := attributes["bind"].(string); ok {
-						display.Bind = types.StringValue(bind)
-					} else {
-						display.Bind = types.StringNull()
-					}
-					if password, ok := attributes["password"].(string); ok {
-						display.Password = types.StringValue(password)
-					} else {
-						display.Password = types.StringNull()
-					}
-					if web, ok := attributes["web"].(bool); ok {
-						display.Web = types.BoolValue(web)
-					} else {
-						display.Web = types.BoolNull()
-					}
-					if displayType, ok := attributes["type"].(string); ok {
-						display.Type = types.StringValue(displayType)
-					} else {
-						display.Type = types.StringNull()
-					}
-					if resolution, ok := attributes["resolution"].(string); ok {
-						display.Resolution = types.StringValue(resolution)
-					} else {
-						display.Resolution = types.StringNull()
-					}
-					if webPort, ok := attributes["web_port"].(float64); ok {
-						display.WebPort = types.Int64Value(int64(webPort))
-					} else {
-						display.WebPort = types.Int64Null()
-					}
-					if wait, ok := attributes["wait"].(bool); ok {
-						display.Wait = types.BoolValue(wait)
-					} else {
-						display.Wait = types.BoolNull()
-					}
-					// Read order from device level (not attributes)
-					if order, ok := deviceMap["order"].(float64); ok {
-						display.Order = types.Int64Value(int64(order))
-					} else {
-						display.Order = types.Int64Null()
-					}
-					displays = append(displays, display)
-
-				case "PCI":
-					pci := PCIDeviceModel{}
-					if pptdev, ok := attributes["pptdev"].(string); ok {
-						pci.PPTDev = types.StringValue(pptdev)
-					} else {
-						pci.PPTDev = types.StringNull()
-					}
-					// Read order from device level (not attributes)
-					if order, ok := deviceMap["order"].(float64); ok {
-						pci.Order = types.Int64Value(int64(order))
-					} else {
-						pci.Order = types.Int64Null()
-					}
-					pciDevices = append(pciDevices, pci)
-				}
+			if device.ID == cloudInit.DeviceID.ValueInt64() {
+				found = true
+				break
 			}
 		}
+		if !found {
+			cloudInit.DeviceID = types.Int64Null()
+		}
 	}
 
-	// Convert MAC addresses to types.List
+	macAddresses := []string{}
+	for _, device := range managedVMDevices(devices, "NIC", "") {
+		if mac := device.key(); mac != "" {
+			macAddresses = append(macAddresses, mac)
+		}
+	}
 	if len(macAddresses) > 0 {
 		macList, diagErr := types.ListValueFrom(ctx, types.StringType, macAddresses)
 		if diagErr.HasError() {
@@ -1373,415 +1970,129 @@ func (r *VMResource) readVM(ctx context.Context, data *VMResourceModel, diags *d
 		data.MACAddresses = types.ListNull(types.StringType)
 	}
 
-	// Convert device lists to types.List
-	if len(nics) > 0 {
-		nicList, diagErr := types.ListValueFrom(ctx, types.ObjectType{
-			AttrTypes: map[string]attr.Type{
-				"type":                   types.StringType,
-				"mac":                    types.StringType,
-				"nic_attach":             types.StringType,
-				"trust_guest_rx_filters": types.BoolType,
-				"order":                  types.Int64Type,
-			},
-		}, nics)
-		if diagErr.HasError() {
-			diags.Append(diagErr...)
-		} else {
-			data.NICDevices = nicList
-		}
-	} else {
-		data.NICDevices = types.ListNull(types.ObjectType{
-			AttrTypes: map[string]attr.Type{
-				"type":                   types.StringType,
-				"mac":                    types.StringType,
-				"nic_attach":             types.StringType,
-				"trust_guest_rx_filters": types.BoolType,
-				"order":                  types.Int64Type,
-			},
-		})
-	}
-
-	if len(disks) > 0 {
-		diskList, diagErr := types.ListValueFrom(ctx, types.ObjectType{
-			AttrTypes: map[string]attr.Type{
-				"path":                types.StringType,
-				"type":                types.StringType,
-				"iotype":              types.StringType,
-				"physical_sectorsize": types.Int64Type,
-				"logical_sectorsize":  types.Int64Type,
-				"order":               types.Int64Type,
-			},
-		}, disks)
-		if diagErr.HasError() {
-			diags.Append(diagErr...)
-		} else {
-			data.DiskDevices = diskList
-		}
-	} else {
-		data.DiskDevices = types.ListNull(types.ObjectType{
-			AttrTypes: map[string]attr.Type{
-				"path":                types.StringType,
-				"type":                types.StringType,
-				"iotype":              types.StringType,
-				"physical_sectorsize": types.Int64Type,
-				"logical_sectorsize":  types.Int64Type,
-				"order":               types.Int64Type,
-			},
-		})
+	displays, err := vmDisplays(ctx, r.client, data.ID.ValueString(), "", managedVMDevices(devices, "DISPLAY", ""))
+	if err != nil {
+		diags.AddError("Client Error", fmt.Sprintf("Unable to read VM displays, got error: %s", err))
+		return false
+	}
+	if data.Displays, err = vmDisplayModels(ctx, displays); err != nil {
+		diags.AddError("Parse Error", err.Error())
+		return false
 	}
 
-	if len(cdroms) > 0 {
-		cdromList, diagErr := types.ListValueFrom(ctx, types.ObjectType{
-			AttrTypes: map[string]attr.Type{
-				"path":  types.StringType,
-				"order": types.Int64Type,
-			},
-		}, cdroms)
-		if diagErr.HasError() {
-			diags.Append(diagErr...)
-		} else {
-			data.CDROMDevices = cdromList
-		}
-	} else {
-		data.CDROMDevices = types.ListNull(types.ObjectType{
-			AttrTypes: map[string]attr.Type{
-				"path":  types.StringType,
-				"order": types.Int64Type,
-			},
-		})
-	}
-
-	if len(displays) > 0 {
-		displayList, diagErr := types.ListValueFrom(ctx, types.ObjectType{
-			AttrTypes: map[string]attr.Type{
-				"port":       types.Int64Type,
-				"bind":       types.StringType,
-				"password":   types.StringType,
-				"web":        types.BoolType,
-				"type":       types.StringType,
-				"resolution": types.StringType,
-				"web_port":   types.Int64Type,
-				"wait":       types.BoolType,
-				"order":      types.Int64Type,
-			},
-		}, displays)
-		if diagErr.HasError() {
-			diags.Append(diagErr...)
-		} else {
-			data.DisplayDevices = displayList
+	// A device type whose list is null is left to truenas_vm_device, except
+	// on import where every list is filled in
+	cloudInitPath := cloudInitISOPath(data)
+	for _, dtype := range vmDeviceTypes {
+		typeDevices := managedVMDevices(devices, dtype, cloudInitPath)
+		if vmDeviceList(data, dtype).IsNull() && (!importing || len(typeDevices) == 0) {
+			continue
 		}
-	} else {
-		data.DisplayDevices = types.ListNull(types.ObjectType{
-			AttrTypes: map[string]attr.Type{
-				"port":       types.Int64Type,
-				"bind":       types.StringType,
-				"password":   types.StringType,
-				"web":        types.BoolType,
-				"type":       types.StringType,
-				"resolution": types.StringType,
-				"web_port":   types.Int64Type,
-				"wait":       types.BoolType,
-				"order":      types.Int64Type,
-			},
-		})
+		diags.Append(readVMDeviceList(ctx, data, dtype, typeDevices)...)
 	}
 
-	if len(pciDevices) > 0 {
-		pciList, diagErr := types.ListValueFrom(ctx, types.ObjectType{
-			AttrTypes: map[string]attr.Type{
-				"pptdev": types.StringType,
-				"order":  types.Int64Type,
-			},
-		}, pciDevices)
-		if diagErr.HasError() {
-			diags.Append(diagErr...)
-		} else {
-			data.PCIDevices = pciList
-		}
-	} else {
-		data.PCIDevices = types.ListNull(types.ObjectType{
-			AttrTypes: map[string]attr.Type{
-				"pptdev": types.StringType,
-				"order":  types.Int64Type,
-			},
-		})
+	if data.AllowStopForDeviceChanges.IsNull() {
+		data.AllowStopForDeviceChanges = types.BoolValue(false)
 	}
+
+	return true
 }
 
-// createDevices creates NIC, disk, and CDROM devices for a VM
+// createDevices creates the devices of the inline device lists for a new VM.
+// Devices without an order are numbered from 1000 in list order, NICs
+// first, then disks, CD-ROMs, displays and PCI devices.
 func (r *VMResource) createDevices(ctx context.Context, data *VMResourceModel, diags *diag.Diagnostics) {
-	vmID := data.ID.ValueString()
-	deviceOrder := 1000 // Starting order for devices
-
-	// Create NIC devices
-	if !data.NICDevices.IsNull() && !data.NICDevices.IsUnknown() {
-		var nics []NICDeviceModel
-		diagErr := data.NICDevices.ElementsAs(ctx, &nics, false)
-		if diagErr.HasError() {
-			diags.Append(diagErr...)
-			return
-		}
-
-		for _, nic := range nics {
-			// Use user-specified order if provided, otherwise use auto-incrementing order
-			order := deviceOrder
-			if !nic.Order.IsNull() && nic.Order.ValueInt64() > 0 {
-				order = int(nic.Order.ValueInt64())
-			}
-
-			deviceReq := map[string]interface{}{
-				"vm":    vmID,
-				"dtype": "NIC",
-				"order": order,
-				"attributes": map[string]interface{}{
-					"nic_attach": nic.NICAttach.ValueString(),
-				},
-			}
-			
-			// Log diagnostic information for debugging order issues
-			diags.AddWarning(
-				"Device Creation Debug",
-				fmt.Sprintf("Creating NIC device with order=%d (user specified: %v, auto-increment base: %d)",
-					order,
-					!nic.Order.IsNull() && nic.Order.ValueInt64() > 0,
-					deviceOrder))
-
-			// Add optional NIC attributes
-			if !nic.Type.IsNull() && nic.Type.ValueString() != "" {
-				deviceReq["attributes"].(map[string]interface{})["type"] = nic.Type.ValueString()
-			} else {
-				deviceReq["attributes"].(map[string]interface{})["type"] = "VIRTIO"
-			}
-
-			if !nic.MAC.IsNull() && nic.MAC.ValueString() != "" {
-				deviceReq["attributes"].(map[string]interface{})["mac"] = nic.MAC.ValueString()
-			}
-
-			if !nic.TrustGuestRxFilters.IsNull() {
-				deviceReq["attributes"].(map[string]interface{})["trust_guest_rx_filters"] = nic.TrustGuestRxFilters.ValueBool()
-			} else {
-				deviceReq["attributes"].(map[string]interface{})["trust_guest_rx_filters"] = false
-			}
-
-			_, err := r.client.Post("/vm/device", deviceReq)
-			if err != nil {
-				diags.AddError("Device Creation Error", fmt.Sprintf("Unable to create NIC device: %s", err))
-				return
-			}
-			deviceOrder++
-		}
+	changes, d := planVMDeviceChanges(ctx, data, nil, firstVMDeviceOrder)
+	diags.Append(d...)
+	if diags.HasError() {
+		return
 	}
 
-	// Create Disk devices
-	if !data.DiskDevices.IsNull() && !data.DiskDevices.IsUnknown() {
-		var disks []DiskDeviceModel
-		diagErr := data.DiskDevices.ElementsAs(ctx, &disks, false)
-		if diagErr.HasError() {
-			diags.Append(diagErr...)
-			return
-		}
-
-		for _, disk := range disks {
-			// Use user-specified order if provided, otherwise use auto-incrementing order
-			order := deviceOrder
-			if !disk.Order.IsNull() && disk.Order.ValueInt64() > 0 {
-				order = int(disk.Order.ValueInt64())
-			}
-
-			deviceReq := map[string]interface{}{
-				"vm":    vmID,
-				"dtype": "DISK",
-				"order": order,
-				"attributes": map[string]interface{}{
-					"path": disk.Path.ValueString(),
-				},
-			}
-			
-			// Log diagnostic information for debugging order issues
-			diags.AddWarning(
-				"Device Creation Debug",
-				fmt.Sprintf("Creating DISK device with order=%d (user specified: %v, auto-increment base: %d)",
-					order,
-					!disk.Order.IsNull() && disk.Order.ValueInt64() > 0,
-					deviceOrder))
-
-			// Add optional disk attributes
-			if !disk.Type.IsNull() && disk.Type.ValueString() != "" {
-				deviceReq["attributes"].(map[string]interface{})["type"] = disk.Type.ValueString()
-			} else {
-				deviceReq["attributes"].(map[string]interface{})["type"] = "VIRTIO"
-			}
-
-			if !disk.IOType.IsNull() && disk.IOType.ValueString() != "" {
-				deviceReq["attributes"].(map[string]interface{})["iotype"] = disk.IOType.ValueString()
-			}
-
-			if !disk.PhysicalSectorSize.IsNull() && disk.PhysicalSectorSize.ValueInt64() > 0 {
-				deviceReq["attributes"].(map[string]interface{})["physical_sectorsize"] = disk.PhysicalSectorSize.ValueInt64()
-			}
+	r.applyVMDeviceChanges(ctx, data.ID.ValueString(), changes, diags)
+}
 
-			if !disk.LogicalSectorSize.IsNull() && disk.LogicalSectorSize.ValueInt64() > 0 {
-				deviceReq["attributes"].(map[string]interface{})["logical_sectorsize"] = disk.LogicalSectorSize.ValueInt64()
-			}
+// updateDevices reconciles the devices of a VM with its inline device lists.
+// A VM that is not stopped is stopped first when the plan stops it anyway or
+// allow_stop_for_device_changes is set, and restored to its state afterwards.
+func (r *VMResource) updateDevices(ctx context.Context, plan *VMResourceModel, diags *diag.Diagnostics) {
+	vmID := plan.ID.ValueString()
 
-			_, err := r.client.Post("/vm/device", deviceReq)
-			if err != nil {
-				diags.AddError("Device Creation Error", fmt.Sprintf("Unable to create disk device: %s", err))
-				return
-			}
-			deviceOrder++
-		}
+	result, err := r.client.GetVMStatus(ctx, vmID)
+	if err != nil {
+		diags.AddError("Client Error", fmt.Sprintf("Unable to read VM devices, got error: %s", err))
+		return
 	}
 
-	// Create CDROM devices
-	if !data.CDROMDevices.IsNull() && !data.CDROMDevices.IsUnknown() {
-		var cdroms []CDROMDeviceModel
-		diagErr := data.CDROMDevices.ElementsAs(ctx, &cdroms, false)
-		if diagErr.HasError() {
-			diags.Append(diagErr...)
-			return
-		}
-
-		for _, cdrom := range cdroms {
-			// Use user-specified order if provided, otherwise use auto-incrementing order
-			order := deviceOrder
-			if !cdrom.Order.IsNull() && cdrom.Order.ValueInt64() > 0 {
-				order = int(cdrom.Order.ValueInt64())
-			}
-
-			deviceReq := map[string]interface{}{
-				"vm":    vmID,
-				"dtype": "CDROM",
-				"order": order,
-				"attributes": map[string]interface{}{
-					"path": cdrom.Path.ValueString(),
-				},
-			}
-			
-			// Log diagnostic information for debugging order issues
-			diags.AddWarning(
-				"Device Creation Debug",
-				fmt.Sprintf("Creating CDROM device with order=%d (user specified: %v, auto-increment base: %d)",
-					order,
-					!cdrom.Order.IsNull() && cdrom.Order.ValueInt64() > 0,
-					deviceOrder))
-
-			_, err := r.client.Post("/vm/device", deviceReq)
-			if err != nil {
-				diags.AddError("Device Creation Error", fmt.Sprintf("Unable to create CDROM device: %s", err))
-				return
-			}
-			deviceOrder++
-		}
+	// The cloud-init ISO is not an inline CD-ROM either. updateSeed has
+	// already pointed its device at the planned path.
+	devices := parseVMDevices(result)
+	if path := cloudInitISOPath(plan); path != "" {
+		devices = managedVMDevices(devices, "", path)
 	}
 
-	// Create Display devices
-	if !data.DisplayDevices.IsNull() && !data.DisplayDevices.IsUnknown() {
-		var displays []DisplayDeviceModel
-		diagErr := data.DisplayDevices.ElementsAs(ctx, &displays, false)
-		if diagErr.HasError() {
-			diags.Append(diagErr...)
-			return
+	var maxOrder int64
+	for _, device := range devices {
+		if device.Order > maxOrder {
+			maxOrder = device.Order
 		}
+	}
+	nextOrder := int64(firstVMDeviceOrder)
+	if maxOrder > 0 {
+		nextOrder = maxOrder + 1
+	}
 
-		for _, display := range displays {
-			// Use user-specified order if provided, otherwise use auto-incrementing order
-			order := deviceOrder
-			if !display.Order.IsNull() && display.Order.ValueInt64() > 0 {
-				order = int(display.Order.ValueInt64())
-			}
+	changes, d := planVMDeviceChanges(ctx, plan, devices, nextOrder)
+	diags.Append(d...)
+	if diags.HasError() || changes.empty() {
+		return
+	}
 
-			attributes := make(map[string]interface{})
+	currentState, err := r.getCurrentVMState(ctx, vmID)
+	if err != nil {
+		diags.AddError("Client Error", fmt.Sprintf("Unable to check VM state, got error: %s", err))
+		return
+	}
 
-			// Add optional attributes only if they're specified
-			if !display.Port.IsNull() {
-				attributes["port"] = int(display.Port.ValueInt64())
-			}
-			if !display.Bind.IsNull() {
-				attributes["bind"] = display.Bind.ValueString()
-			}
-			if !display.Password.IsNull() {
-				attributes["password"] = display.Password.ValueString()
-			}
-			if !display.Web.IsNull() {
-				attributes["web"] = display.Web.ValueBool()
-			}
-			if !display.Type.IsNull() {
-				attributes["type"] = display.Type.ValueString()
-			}
-			if !display.Resolution.IsNull() {
-				attributes["resolution"] = display.Resolution.ValueString()
-			}
-			if !display.WebPort.IsNull() {
-				attributes["web_port"] = int(display.WebPort.ValueInt64())
-			}
-			if !display.Wait.IsNull() {
-				attributes["wait"] = display.Wait.ValueBool()
-			}
+	desiredState := ""
+	if !plan.DesiredState.IsNull() && !plan.DesiredState.IsUnknown() {
+		desiredState = strings.ToUpper(plan.DesiredState.ValueString())
+	}
 
-			deviceReq := map[string]interface{}{
-				"vm":         vmID,
-				"dtype":      "DISPLAY",
-				"order":      order,
-				"attributes": attributes,
+	restoreState := ""
+	if currentState != "STOPPED" {
+		switch {
+		case desiredState == "STOPPED":
+			r.transitionVMState(ctx, vmID, "STOPPED", diags)
+		case plan.AllowStopForDeviceChanges.ValueBool():
+			r.transitionVMState(ctx, vmID, "STOPPED", diags)
+			restoreState = currentState
+			if desiredState != "" {
+				restoreState = desiredState
 			}
-			
-			// Log diagnostic information for debugging order issues
+		default:
 			diags.AddWarning(
-				"Device Creation Debug",
-				fmt.Sprintf("Creating DISPLAY device with order=%d (user specified: %v, auto-increment base: %d)",
-					order,
-					!display.Order.IsNull() && display.Order.ValueInt64() > 0,
-					deviceOrder))
+				"VM Device Changes Pending",
+				fmt.Sprintf("VM %s is %s, so its device changes take effect the next time it is started. Set allow_stop_for_device_changes to let the provider stop and restart the VM around device changes.", vmID, currentState),
+			)
+		}
 
-			_, err := r.client.Post("/vm/device", deviceReq)
-			if err != nil {
-				diags.AddError("Device Creation Error", fmt.Sprintf("Unable to create DISPLAY device: %s", err))
+		if desiredState == "STOPPED" || restoreState != "" {
+			newState, err := r.getCurrentVMState(ctx, vmID)
+			if err != nil || newState != "STOPPED" {
+				diags.AddError(
+					"VM Stop Error",
+					fmt.Sprintf("Unable to stop VM %s to change its devices; no device changes were made.", vmID),
+				)
 				return
 			}
-			deviceOrder++
 		}
 	}
 
-	// Create PCI passthrough devices
-	if !data.PCIDevices.IsNull() && !data.PCIDevices.IsUnknown() {
-		var pciDevices []PCIDeviceModel
-		diagErr := data.PCIDevices.ElementsAs(ctx, &pciDevices, false)
-		if diagErr.HasError() {
-			diags.Append(diagErr...)
-			return
-		}
-
-		for _, pci := range pciDevices {
-			// Use user-specified order if provided, otherwise use auto-incrementing order
-			order := deviceOrder
-			if !pci.Order.IsNull() && pci.Order.ValueInt64() > 0 {
-				order = int(pci.Order.ValueInt64())
-			}
-
-			deviceReq := map[string]interface{}{
-				"vm":    vmID,
-				"dtype": "PCI",
-				"order": order,
-				"attributes": map[string]interface{}{
-					"pptdev": pci.PPTDev.ValueString(),
-				},
-			}
-			
-			// Log diagnostic information for debugging order issues
-			diags.AddWarning(
-				"Device Creation Debug",
-				fmt.Sprintf("Creating PCI device with order=%d (user specified: %v, auto-increment base: %d)",
-					order,
-					!pci.Order.IsNull() && pci.Order.ValueInt64() > 0,
-					deviceOrder))
+	r.applyVMDeviceChanges(ctx, vmID, changes, diags)
 
-			_, err := r.client.Post("/vm/device", deviceReq)
-			if err != nil {
-				diags.AddError("Device Creation Error", fmt.Sprintf("Unable to create PCI passthrough device: %s", err))
-				return
-			}
-			deviceOrder++
-		}
+	// Restore the VM even if a device change failed, so that it is not
+	// left stopped
+	if restoreState != "" {
+		r.transitionVMState(ctx, vmID, restoreState, diags)
 	}
 }
@@ -0,0 +1,525 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/listplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+)
+
+var _ resource.Resource = &VMCloneResource{}
+var _ resource.ResourceWithImportState = &VMCloneResource{}
+
+func NewVMCloneResource() resource.Resource {
+	return &VMCloneResource{}
+}
+
+type VMCloneResource struct {
+	client *truenas.Client
+}
+
+type VMCloneResourceModel struct {
+	ID         types.String `tfsdk:"id"`
+	SourceVMID types.String `tfsdk:"source_vm_id"`
+	Name       types.String `tfsdk:"name"`
+	NameSuffix types.String `tfsdk:"name_suffix"`
+	Zvols      types.List   `tfsdk:"zvols"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
+}
+
+func (r *VMCloneResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_vm_clone"
+}
+
+func (r *VMCloneResource) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Clones a VM on TrueNAS, including zvol clones of its disks. Use `clone_from` on `truenas_vm` to change the settings or devices of the clone.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "ID of the cloned VM",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"source_vm_id": schema.StringAttribute{
+				MarkdownDescription: "ID of the VM to clone",
+				Required:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"name": schema.StringAttribute{
+				MarkdownDescription: "Name of the cloned VM",
+				Required:            true,
+			},
+			"name_suffix": schema.StringAttribute{
+				MarkdownDescription: "Clone the VM as the source VM's name followed by this suffix, then rename it to `name`. TrueNAS names the cloned zvols `<zvol>_<clone name>`, so this keeps them named after the source VM.",
+				Optional:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"zvols": schema.ListAttribute{
+				MarkdownDescription: "Zvols cloned for the VM's disks. They are deleted with the VM. On import, these are the zvols of the VM's disks that are clones of a snapshot.",
+				Computed:            true,
+				ElementType:         types.StringType,
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.UseStateForUnknown(),
+				},
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
+	}
+}
+
+func (r *VMCloneResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*truenas.Client)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *truenas.Client, got: %T.", req.ProviderData),
+		)
+		return
+	}
+
+	r.client = client
+}
+
+func (r *VMCloneResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data VMCloneResourceModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	createTimeout, diags := data.Timeouts.Create(ctx, vmTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
+	clone, err := cloneVM(ctx, r.client, data.SourceVMID.ValueString(), data.Name.ValueString(), data.NameSuffix.ValueString())
+	if err != nil {
+		addClientError(&resp.Diagnostics, "clone VM", err, &data, nil)
+		return
+	}
+	data.ID = types.StringValue(clone.ID)
+
+	zvols, d := types.ListValueFrom(ctx, types.StringType, clone.Zvols)
+	resp.Diagnostics.Append(d...)
+	data.Zvols = zvols
+
+	if clone.Name != data.Name.ValueString() {
+		endpoint := fmt.Sprintf("/vm/id/%s", clone.ID)
+		if _, err := r.client.Put(ctx, endpoint, map[string]interface{}{"name": data.Name.ValueString()}); err != nil {
+			addClientError(&resp.Diagnostics, "rename cloned VM", err, &data, nil)
+			cleanupCtx, cleanupCancel := cleanupContext(ctx)
+			defer cleanupCancel()
+			removeVMClone(cleanupCtx, r.client, clone.ID, clone.Zvols, &resp.Diagnostics)
+			return
+		}
+	}
+
+	if !r.readVMClone(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read cloned VM: it no longer exists")
+	}
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *VMCloneResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data VMCloneResourceModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	readTimeout, diags := data.Timeouts.Read(ctx, vmTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	found := r.readVMClone(ctx, &data, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !found {
+		// Deleted outside of Terraform; drop it from state so it is re-created
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *VMCloneResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var data VMCloneResourceModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	updateTimeout, diags := data.Timeouts.Update(ctx, vmTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	// Only the name can change in place
+	endpoint := fmt.Sprintf("/vm/id/%s", data.ID.ValueString())
+	if _, err := r.client.Put(ctx, endpoint, map[string]interface{}{"name": data.Name.ValueString()}); err != nil {
+		addClientError(&resp.Diagnostics, "rename cloned VM", err, &data, nil)
+		return
+	}
+
+	if !r.readVMClone(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read cloned VM: it no longer exists")
+	}
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *VMCloneResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data VMCloneResourceModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, vmTimeouts.Delete)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
+	var zvols []string
+	if !data.Zvols.IsNull() && !data.Zvols.IsUnknown() {
+		resp.Diagnostics.Append(data.Zvols.ElementsAs(ctx, &zvols, false)...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	}
+
+	endpoint := fmt.Sprintf("/vm/id/%s", data.ID.ValueString())
+	if _, err := r.client.Delete(ctx, endpoint); err != nil && !truenas.IsNotFound(err) {
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete VM, got error: %s", err))
+		return
+	}
+
+	if err := deleteClonedZvols(ctx, r.client, zvols); err != nil {
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete cloned zvols, got error: %s", err))
+	}
+}
+
+func (r *VMCloneResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
+}
+
+// readVMClone refreshes data from the API. It returns false, without adding
+// a diagnostic, when the VM no longer exists.
+func (r *VMCloneResource) readVMClone(ctx context.Context, data *VMCloneResourceModel, diags *diag.Diagnostics) bool {
+	result, err := r.client.GetVMStatus(ctx, data.ID.ValueString())
+	if err != nil {
+		if truenas.IsNotFound(err) {
+			return false
+		}
+		diags.AddError("Client Error", fmt.Sprintf("Unable to read VM, got error: %s", err))
+		return false
+	}
+
+	if id, ok := result["id"].(float64); ok {
+		data.ID = types.StringValue(strconv.Itoa(int(id)))
+	}
+	if name, ok := result["name"].(string); ok {
+		data.Name = types.StringValue(name)
+	}
+	if data.Zvols.IsNull() || data.Zvols.IsUnknown() {
+		// An imported clone takes over the cloned zvols of its disks, so
+		// that they are deleted with it
+		zvols, err := clonedDiskZvols(ctx, r.client, result)
+		if err != nil {
+			diags.AddError("Client Error", fmt.Sprintf("Unable to read the zvols of the VM, got error: %s", err))
+			return false
+		}
+		list, d := types.ListValueFrom(ctx, types.StringType, zvols)
+		diags.Append(d...)
+		data.Zvols = list
+	}
+
+	return true
+}
+
+// vmCloneResult is a VM created by cloneVM
+type vmCloneResult struct {
+	ID   string
+	Name string
+	// Zvols are the zvols cloned for the disks of the VM
+	Zvols []string
+}
+
+// cloneVM clones a VM with /vm/id/{id}/clone. The clone is named name, or
+// the source VM's name followed by nameSuffix if that is set, and no VM of
+// that name may exist yet. If the clone call fails after creating the VM,
+// e.g. because the operation timed out, the VM and its zvols are removed
+// again. Only a VM that did not exist before the call is taken for the
+// clone, so that another VM of the same name is never removed with it.
+func cloneVM(ctx context.Context, client *truenas.Client, sourceID, name, nameSuffix string) (*vmCloneResult, error) {
+	source, err := client.GetVMStatus(ctx, sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("reading source VM %s: %w", sourceID, err)
+	}
+
+	cloneName := name
+	if nameSuffix != "" {
+		sourceName, _ := source["name"].(string)
+		cloneName = sourceName + nameSuffix
+	}
+
+	vms, err := listVMs(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]bool{}
+	for _, vm := range vms {
+		if vmName, _ := vm["name"].(string); vmName == cloneName {
+			return nil, fmt.Errorf("a VM named %q already exists", cloneName)
+		}
+		existing[vmIDString(vm)] = true
+	}
+
+	_, cloneErr := client.CloneVM(ctx, sourceID, cloneName)
+
+	// A rejected clone created nothing, and the VM now holding the name,
+	// if any, was created by someone else since the check above
+	var apiErr *truenas.APIError
+	if errors.As(cloneErr, &apiErr) && apiErr.Class == truenas.ErrorClassValidation {
+		return nil, cloneErr
+	}
+
+	// After a failed clone, e.g. one that ran past the create timeout, the
+	// partial clone is looked up and removed on a context of its own
+	lookupCtx := ctx
+	if cloneErr != nil {
+		var cancel context.CancelFunc
+		lookupCtx, cancel = cleanupContext(ctx)
+		defer cancel()
+	}
+
+	vm, err := findNewVM(lookupCtx, client, cloneName, existing)
+	if err != nil {
+		return nil, errors.Join(cloneErr, err)
+	}
+	if vm == nil {
+		if cloneErr != nil {
+			return nil, cloneErr
+		}
+		return nil, fmt.Errorf("cloned VM %q not found", cloneName)
+	}
+
+	clone := &vmCloneResult{ID: vmIDString(vm), Name: cloneName}
+
+	// The disks that do not point at a zvol of the source VM use clones
+	sourcePaths := map[string]bool{}
+	for _, device := range parseVMDevices(source) {
+		if device.DType == "DISK" {
+			sourcePaths[device.key()] = true
+		}
+	}
+	for _, device := range parseVMDevices(vm) {
+		if device.DType != "DISK" || sourcePaths[device.key()] {
+			continue
+		}
+		if zvol := strings.TrimPrefix(device.key(), "/dev/zvol/"); zvol != device.key() {
+			clone.Zvols = append(clone.Zvols, zvol)
+		}
+	}
+
+	if cloneErr != nil {
+		var cleanupDiags diag.Diagnostics
+		removeVMClone(lookupCtx, client, clone.ID, clone.Zvols, &cleanupDiags)
+		if cleanupDiags.HasError() {
+			return nil, fmt.Errorf("%w; the partial clone %s could not be removed", cloneErr, cloneName)
+		}
+		return nil, cloneErr
+	}
+
+	return clone, nil
+}
+
+// listVMs returns all VMs
+func listVMs(ctx context.Context, client *truenas.Client) ([]map[string]interface{}, error) {
+	respBody, err := client.Get(ctx, "/vm")
+	if err != nil {
+		return nil, err
+	}
+
+	var vms []map[string]interface{}
+	if err := json.Unmarshal(respBody, &vms); err != nil {
+		return nil, fmt.Errorf("parsing VMs: %w", err)
+	}
+	return vms, nil
+}
+
+// findNewVM returns the VM with the given name whose ID is not in existing,
+// or nil if there is none
+func findNewVM(ctx context.Context, client *truenas.Client, name string, existing map[string]bool) (map[string]interface{}, error) {
+	vms, err := listVMs(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, vm := range vms {
+		if vmName, ok := vm["name"].(string); ok && vmName == name && !existing[vmIDString(vm)] {
+			return vm, nil
+		}
+	}
+	return nil, nil
+}
+
+// vmIDString returns the ID of a VM returned by the API as a string
+func vmIDString(vm map[string]interface{}) string {
+	if id, ok := vm["id"].(float64); ok {
+		return strconv.Itoa(int(id))
+	}
+	return ""
+}
+
+// zvolOrigin returns the snapshot a zvol was cloned from, or "" if it is
+// not a clone
+func zvolOrigin(ctx context.Context, client *truenas.Client, zvol string) (string, error) {
+	respBody, err := client.Get(ctx, fmt.Sprintf("/pool/dataset/id/%s", url.PathEscape(zvol)))
+	if err != nil {
+		return "", err
+	}
+
+	origin := ""
+	var dataset map[string]interface{}
+	if err := json.Unmarshal(respBody, &dataset); err == nil {
+		if property, ok := dataset["origin"].(map[string]interface{}); ok {
+			origin, _ = property["value"].(string)
+		}
+	}
+	return origin, nil
+}
+
+// clonedDiskZvols returns the zvols of a VM's disks that are clones of a
+// snapshot. Disks on zvols that are not clones are left out, so that they
+// are never deleted with the VM.
+func clonedDiskZvols(ctx context.Context, client *truenas.Client, vm map[string]interface{}) ([]string, error) {
+	var zvols []string
+	for _, device := range parseVMDevices(vm) {
+		if device.DType != "DISK" {
+			continue
+		}
+		zvol := strings.TrimPrefix(device.key(), "/dev/zvol/")
+		if zvol == device.key() {
+			continue
+		}
+
+		origin, err := zvolOrigin(ctx, client, zvol)
+		if err != nil {
+			if truenas.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("reading zvol %s: %w", zvol, err)
+		}
+		if origin != "" {
+			zvols = append(zvols, zvol)
+		}
+	}
+	return zvols, nil
+}
+
+// deleteClonedZvols deletes zvols created by a VM clone, followed by the
+// snapshots they were cloned from
+func deleteClonedZvols(ctx context.Context, client *truenas.Client, zvols []string) error {
+	var errs []error
+	for _, zvol := range zvols {
+		endpoint := fmt.Sprintf("/pool/dataset/id/%s", url.PathEscape(zvol))
+
+		origin, err := zvolOrigin(ctx, client, zvol)
+		if err != nil {
+			if !truenas.IsNotFound(err) {
+				errs = append(errs, fmt.Errorf("reading zvol %s: %w", zvol, err))
+			}
+			continue
+		}
+
+		if _, err := client.DeleteJob(ctx, endpoint, map[string]bool{"recursive": true}); err != nil && !truenas.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("deleting zvol %s: %w", zvol, err))
+			continue
+		}
+
+		if origin != "" {
+			snapshotEndpoint := fmt.Sprintf("/zfs/snapshot/id/%s", url.PathEscape(origin))
+			if _, err := client.DeleteWithBody(ctx, snapshotEndpoint, map[string]bool{"defer": false, "recursive": false}); err != nil && !truenas.IsNotFound(err) {
+				errs = append(errs, fmt.Errorf("deleting snapshot %s: %w", origin, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// removeVMClone deletes a cloned VM and its zvols after a failed create, so
+// that they are not left behind outside of Terraform's state
+func removeVMClone(ctx context.Context, client *truenas.Client, vmID string, zvols []string, diags *diag.Diagnostics) {
+	var errs []error
+	if vmID != "" {
+		if _, err := client.Delete(ctx, fmt.Sprintf("/vm/id/%s", vmID)); err != nil && !truenas.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("deleting VM %s: %w", vmID, err))
+		}
+	}
+	if err := deleteClonedZvols(ctx, client, zvols); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		diags.AddError(
+			"Clone Cleanup Error",
+			fmt.Sprintf("Unable to remove the cloned VM %s and zvols %v after the failure: %s. Remove them manually.", vmID, zvols, err),
+		)
+	}
+}
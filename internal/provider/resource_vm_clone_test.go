@@ -0,0 +1,402 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/terraform"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas/fake"
+)
+
+// testAccGoldenVM creates a template VM named golden, with ID 1, a NIC and a
+// disk on the zvol tank/golden
+func testAccGoldenVM(t *testing.T, server *fake.Server) {
+	t.Helper()
+
+	if _, err := server.Create("pool/dataset", map[string]interface{}{"name": "tank/golden", "type": "VOLUME", "volsize": 10737418240}); err != nil {
+		t.Fatalf("creating zvol: %s", err)
+	}
+	if _, err := server.Create("vm", map[string]interface{}{"name": "golden", "memory": 2048, "vcpus": 2}); err != nil {
+		t.Fatalf("creating VM: %s", err)
+	}
+	for _, device := range []map[string]interface{}{
+		{"vm": 1, "dtype": "NIC", "attributes": map[string]interface{}{"type": "VIRTIO", "nic_attach": "eno1"}},
+		{"vm": 1, "dtype": "DISK", "attributes": map[string]interface{}{"type": "VIRTIO", "path": "/dev/zvol/tank/golden"}},
+	} {
+		if _, err := server.Create("vm/device", device); err != nil {
+			t.Fatalf("creating device: %s", err)
+		}
+	}
+}
+
+// testAccCheckVMClonesRemoved verifies that only the template VM is left
+// and that no clone zvols or clone snapshots remain
+func testAccCheckVMClonesRemoved(server *fake.Server) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		if vms := server.Objects("vm"); len(vms) != 1 {
+			return fmt.Errorf("expected only the template VM, found %d VMs", len(vms))
+		}
+		for _, dataset := range server.Objects("pool/dataset") {
+			if id := fmt.Sprint(dataset["id"]); strings.HasPrefix(id, "tank/golden_") {
+				return fmt.Errorf("clone zvol %s still exists", id)
+			}
+		}
+		for _, snapshot := range server.Objects("zfs/snapshot") {
+			return fmt.Errorf("clone snapshot %s still exists", snapshot["id"])
+		}
+		return nil
+	}
+}
+
+// TestAccVMResource_cloneFrom tests creating a VM as a clone of a template
+// and overriding its settings and devices
+func TestAccVMResource_cloneFrom(t *testing.T) {
+	server := testAccFakeServer(t)
+	testAccGoldenVM(t, server)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckVMClonesRemoved(server),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "lab" {
+  name          = "lab1"
+  memory        = 4096
+  desired_state = "STOPPED"
+
+  clone_from = {
+    vm_id = "1"
+  }
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_vm.lab", "id", "2"),
+					resource.TestCheckResourceAttr("truenas_vm.lab", "memory", "4096"),
+					resource.TestCheckResourceAttr("truenas_vm.lab", "vcpus", "2"),
+					resource.TestCheckResourceAttr("truenas_vm.lab", "clone_from.zvols.#", "1"),
+					resource.TestCheckResourceAttr("truenas_vm.lab", "clone_from.zvols.0", "tank/golden_lab1"),
+					resource.TestCheckResourceAttr("truenas_vm.lab", "mac_addresses.#", "1"),
+					testAccCheckExists(server, "vm", "truenas_vm.lab"),
+					func(s *terraform.State) error {
+						if _, ok := server.Object("pool/dataset", "tank/golden_lab1"); !ok {
+							return fmt.Errorf("clone zvol tank/golden_lab1 does not exist")
+						}
+						return nil
+					},
+					testAccCheckClonedMAC(server),
+				),
+			},
+			{
+				// Device lists override the cloned devices
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "lab" {
+  name          = "lab1"
+  memory        = 4096
+  desired_state = "STOPPED"
+
+  clone_from = {
+    vm_id = "1"
+  }
+
+  nic_devices = [
+    { nic_attach = "eno1", type = "E1000" },
+  ]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_vm.lab", "nic_devices.#", "1"),
+					resource.TestCheckResourceAttr("truenas_vm.lab", "nic_devices.0.type", "E1000"),
+					testAccCheckVMDevices(server, "NIC", 2),
+				),
+			},
+		},
+	})
+}
+
+// TestAccVMResource_cloneFromFailure tests that the clone is removed when
+// applying the configuration to it fails
+func TestAccVMResource_cloneFromFailure(t *testing.T) {
+	server := testAccFakeServer(t)
+	testAccGoldenVM(t, server)
+	server.InjectFault(fake.Fault{
+		Method:     "PUT",
+		Path:       "/vm/id/2",
+		StatusCode: 422,
+		Body:       `{"vm_update.memory": [{"message": "Not enough free memory", "errno": 22}]}`,
+	})
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckVMClonesRemoved(server),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "lab" {
+  name   = "lab1"
+  memory = 65536
+
+  clone_from = {
+    vm_id = "1"
+  }
+}
+`,
+				ExpectError: regexp.MustCompile(`Not enough free memory`),
+			},
+		},
+	})
+}
+
+// TestAccVMResource_cloneFromExistingName tests that cloning to the name of
+// an existing VM fails without touching that VM or its disks
+func TestAccVMResource_cloneFromExistingName(t *testing.T) {
+	server := testAccFakeServer(t)
+	testAccGoldenVM(t, server)
+	if _, err := server.Create("pool/dataset", map[string]interface{}{"name": "tank/lab1", "type": "VOLUME", "volsize": 10737418240}); err != nil {
+		t.Fatalf("creating zvol: %s", err)
+	}
+	if _, err := server.Create("vm", map[string]interface{}{"name": "lab1", "memory": 2048, "vcpus": 2}); err != nil {
+		t.Fatalf("creating VM: %s", err)
+	}
+	if _, err := server.Create("vm/device", map[string]interface{}{"vm": 2, "dtype": "DISK", "attributes": map[string]interface{}{"type": "VIRTIO", "path": "/dev/zvol/tank/lab1"}}); err != nil {
+		t.Fatalf("creating device: %s", err)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "lab" {
+  name   = "lab1"
+  memory = 4096
+
+  clone_from = {
+    vm_id = "1"
+  }
+}
+`,
+				ExpectError: regexp.MustCompile(`already exists`),
+			},
+			{
+				Config: testAccProviderConfig(server),
+				Check:  testAccCheckVMKept(server, "2", "tank/lab1"),
+			},
+		},
+	})
+}
+
+// TestAccVMResource_cloneFromTimeout tests that a clone running past the
+// create timeout is removed together with its zvols
+func TestAccVMResource_cloneFromTimeout(t *testing.T) {
+	server := testAccFakeServer(t)
+	testAccGoldenVM(t, server)
+	server.InjectFault(fake.Fault{Method: "POST", Path: "/vm/id/1/clone", Delay: time.Minute})
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckVMClonesRemoved(server),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "lab" {
+  name   = "lab1"
+  memory = 4096
+
+  clone_from = {
+    vm_id = "1"
+  }
+
+  timeouts {
+    create = "1s"
+  }
+}
+`,
+				ExpectError: regexp.MustCompile(`deadline exceeded`),
+			},
+			{
+				Config: testAccProviderConfig(server),
+				Check:  testAccCheckVMClonesRemoved(server),
+			},
+		},
+	})
+}
+
+// testAccCheckVMKept verifies that a VM not managed by the test and the
+// zvol of its disk still exist
+func testAccCheckVMKept(server *fake.Server, id, zvol string) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		if _, ok := server.Object("vm", id); !ok {
+			return fmt.Errorf("VM %s was removed", id)
+		}
+		if _, ok := server.Object("pool/dataset", zvol); !ok {
+			return fmt.Errorf("zvol %s was removed", zvol)
+		}
+		return nil
+	}
+}
+
+// TestAccVMCloneResource tests cloning a VM as is with name_suffix
+func TestAccVMCloneResource(t *testing.T) {
+	server := testAccFakeServer(t)
+	testAccGoldenVM(t, server)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckVMClonesRemoved(server),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm_clone" "test" {
+  source_vm_id = "1"
+  name         = "lab2"
+  name_suffix  = "lab2"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_vm_clone.test", "name", "lab2"),
+					resource.TestCheckResourceAttr("truenas_vm_clone.test", "zvols.0", "tank/golden_goldenlab2"),
+					testAccCheckExists(server, "vm", "truenas_vm_clone.test"),
+				),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm_clone" "test" {
+  source_vm_id = "1"
+  name         = "lab2renamed"
+  name_suffix  = "lab2"
+}
+`,
+				Check: resource.TestCheckResourceAttr("truenas_vm_clone.test", "name", "lab2renamed"),
+			},
+			{
+				ResourceName:            "truenas_vm_clone.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"source_vm_id", "name_suffix", "timeouts"},
+			},
+		},
+	})
+}
+
+// TestAccVMCloneResource_timeout tests that a clone running past the create
+// timeout is removed together with its zvols
+func TestAccVMCloneResource_timeout(t *testing.T) {
+	server := testAccFakeServer(t)
+	testAccGoldenVM(t, server)
+	server.InjectFault(fake.Fault{Method: "POST", Path: "/vm/id/1/clone", Delay: time.Minute})
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm_clone" "test" {
+  source_vm_id = "1"
+  name         = "lab2"
+
+  timeouts {
+    create = "1s"
+  }
+}
+`,
+				ExpectError: regexp.MustCompile(`deadline exceeded`),
+			},
+			{
+				Config: testAccProviderConfig(server),
+				Check:  testAccCheckVMClonesRemoved(server),
+			},
+		},
+	})
+}
+
+// TestAccVMCloneResource_importDeletesZvols tests that destroying an
+// imported clone deletes its cloned zvols but not its other disks
+func TestAccVMCloneResource_importDeletesZvols(t *testing.T) {
+	server := testAccFakeServer(t)
+	testAccGoldenVM(t, server)
+
+	client, err := truenas.NewClient(server.URL, "test-key")
+	if err != nil {
+		t.Fatalf("creating client: %s", err)
+	}
+	if _, err := client.CloneVM(context.Background(), "1", "lab2"); err != nil {
+		t.Fatalf("cloning VM: %s", err)
+	}
+	if _, err := server.Create("pool/dataset", map[string]interface{}{"name": "tank/data", "type": "VOLUME", "volsize": 10737418240}); err != nil {
+		t.Fatalf("creating zvol: %s", err)
+	}
+	if _, err := server.Create("vm/device", map[string]interface{}{"vm": 2, "dtype": "DISK", "attributes": map[string]interface{}{"type": "VIRTIO", "path": "/dev/zvol/tank/data"}}); err != nil {
+		t.Fatalf("creating device: %s", err)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy: resource.ComposeAggregateTestCheckFunc(
+			testAccCheckVMClonesRemoved(server),
+			testAccCheckDatasetKept(server, "tank/data"),
+		),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm_clone" "test" {
+  source_vm_id = "1"
+  name         = "lab2"
+}
+`,
+				ResourceName:       "truenas_vm_clone.test",
+				ImportState:        true,
+				ImportStateId:      "2",
+				ImportStatePersist: true,
+				ImportStateCheck: func(states []*terraform.InstanceState) error {
+					if len(states) != 1 {
+						return fmt.Errorf("expected 1 imported resource, got %d", len(states))
+					}
+					if zvols := states[0].Attributes["zvols.#"]; zvols != "1" {
+						return fmt.Errorf("expected 1 zvol, got %s", zvols)
+					}
+					if zvol := states[0].Attributes["zvols.0"]; zvol != "tank/golden_lab2" {
+						return fmt.Errorf("expected zvol tank/golden_lab2, got %s", zvol)
+					}
+					return nil
+				},
+			},
+		},
+	})
+}
+
+// testAccCheckDatasetKept verifies that a dataset not managed by the test
+// still exists
+func testAccCheckDatasetKept(server *fake.Server, id string) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		if _, ok := server.Object("pool/dataset", id); !ok {
+			return fmt.Errorf("dataset %s was removed", id)
+		}
+		return nil
+	}
+}
+
+// testAccCheckClonedMAC verifies that the NIC of the clone did not keep the
+// template's MAC address
+func testAccCheckClonedMAC(server *fake.Server) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		macs := map[string]bool{}
+		for _, device := range server.Objects("vm/device") {
+			if device["dtype"] != "NIC" {
+				continue
+			}
+			mac := fmt.Sprint(device["attributes"].(map[string]interface{})["mac"])
+			if macs[mac] {
+				return fmt.Errorf("MAC address %s is used by the template and the clone", mac)
+			}
+			macs[mac] = true
+		}
+		return nil
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
 	"github.com/hashicorp/terraform-plugin-framework/attr"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
@@ -41,6 +43,21 @@ type VMDeviceResourceModel struct {
 	USBConfig     types.List   `tfsdk:"usb_config"`
 	DisplayConfig types.List   `tfsdk:"display_config"`
 	RAWConfig     types.List   `tfsdk:"raw_config"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
+}
+
+// vmDeviceAPIFields maps VM device API fields to the schema. Device
+// attributes are reported on the config block of the device type.
+func vmDeviceAPIFields(deviceType string) map[string]path.Path {
+	fields := map[string]path.Path{
+		"vm":    path.Root("vm_id"),
+		"dtype": path.Root("device_type"),
+	}
+	if deviceType != "" {
+		fields["attributes"] = path.Root(strings.ToLower(deviceType) + "_config").AtListIndex(0)
+	}
+	return fields
 }
 
 type NICConfigModel struct {
@@ -296,6 +313,14 @@ func (r *VMDeviceResource) Schema(ctx context.Context, req resource.SchemaReques
 				},
 			},
 		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
 	}
 }
 
@@ -324,6 +349,15 @@ func (r *VMDeviceResource) Create(ctx context.Context, req resource.CreateReques
 		return
 	}
 
+	createTimeout, diags := data.Timeouts.Create(ctx, defaultTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
 	// Build device request
 	deviceReq := map[string]interface{}{
 		"vm":    data.VMID.ValueString(),
@@ -331,7 +365,7 @@ func (r *VMDeviceResource) Create(ctx context.Context, req resource.CreateReques
 	}
 
 	// Set order if specified, otherwise use default
-	if !data.Order.IsNull() {
+	if !data.Order.IsNull() && !data.Order.IsUnknown() {
 		deviceReq["order"] = int(data.Order.ValueInt64())
 	} else {
 		deviceReq["order"] = 1000
@@ -360,7 +394,7 @@ func (r *VMDeviceResource) Create(ctx context.Context, req resource.CreateReques
 				if !nic.MAC.IsNull() && nic.MAC.ValueString() != "" {
 					attributes["mac"] = nic.MAC.ValueString()
 				}
-				if !nic.TrustGuestRxFilters.IsNull() {
+				if !nic.TrustGuestRxFilters.IsNull() && !nic.TrustGuestRxFilters.IsUnknown() {
 					attributes["trust_guest_rx_filters"] = nic.TrustGuestRxFilters.ValueBool()
 				} else {
 					attributes["trust_guest_rx_filters"] = false
@@ -449,28 +483,28 @@ func (r *VMDeviceResource) Create(ctx context.Context, req resource.CreateReques
 			}
 			if len(displayConfigs) > 0 {
 				display := displayConfigs[0]
-				if !display.Port.IsNull() {
+				if !display.Port.IsNull() && !display.Port.IsUnknown() {
 					attributes["port"] = int(display.Port.ValueInt64())
 				}
-				if !display.Bind.IsNull() {
+				if !display.Bind.IsNull() && !display.Bind.IsUnknown() {
 					attributes["bind"] = display.Bind.ValueString()
 				}
-				if !display.Password.IsNull() {
+				if !display.Password.IsNull() && !display.Password.IsUnknown() {
 					attributes["password"] = display.Password.ValueString()
 				}
-				if !display.Web.IsNull() {
+				if !display.Web.IsNull() && !display.Web.IsUnknown() {
 					attributes["web"] = display.Web.ValueBool()
 				}
-				if !display.Type.IsNull() {
+				if !display.Type.IsNull() && !display.Type.IsUnknown() {
 					attributes["type"] = display.Type.ValueString()
 				}
-				if !display.Resolution.IsNull() {
+				if !display.Resolution.IsNull() && !display.Resolution.IsUnknown() {
 					attributes["resolution"] = display.Resolution.ValueString()
 				}
-				if !display.WebPort.IsNull() {
+				if !display.WebPort.IsNull() && !display.WebPort.IsUnknown() {
 					attributes["web_port"] = int(display.WebPort.ValueInt64())
 				}
-				if !display.Wait.IsNull() {
+				if !display.Wait.IsNull() && !display.Wait.IsUnknown() {
 					attributes["wait"] = display.Wait.ValueBool()
 				}
 			}
@@ -487,21 +521,28 @@ func (r *VMDeviceResource) Create(ctx context.Context, req resource.CreateReques
 			if len(rawConfigs) > 0 {
 				raw := rawConfigs[0]
 				attributes["path"] = raw.Path.ValueString()
-				if !raw.Size.IsNull() {
+				if !raw.Size.IsNull() && !raw.Size.IsUnknown() {
 					attributes["size"] = raw.Size.ValueInt64()
 				}
-				if !raw.Boot.IsNull() {
+				if !raw.Boot.IsNull() && !raw.Boot.IsUnknown() {
 					attributes["boot"] = raw.Boot.ValueBool()
 				}
 			}
 		}
 	}
 
+	if data.DeviceType.ValueString() == "DISPLAY" {
+		if err := allocateDisplayPorts(ctx, r.client, attributes); err != nil {
+			addClientError(&resp.Diagnostics, "create VM device", err, &data, nil)
+			return
+		}
+	}
+
 	deviceReq["attributes"] = attributes
 
-	respBody, err := r.client.CreateVMDevice(deviceReq)
+	respBody, err := r.client.CreateVMDevice(ctx, deviceReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create VM device, got error: %s", err))
+		addClientError(&resp.Diagnostics, "create VM device", err, &data, vmDeviceAPIFields(data.DeviceType.ValueString()))
 		return
 	}
 
@@ -516,7 +557,9 @@ func (r *VMDeviceResource) Create(ctx context.Context, req resource.CreateReques
 	}
 
 	// Read back the created device to populate computed values
-	r.readVMDevice(ctx, &data, &resp.Diagnostics)
+	if !r.readVMDevice(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read VM device: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -528,11 +571,26 @@ func (r *VMDeviceResource) Read(ctx context.Context, req resource.ReadRequest, r
 		return
 	}
 
-	r.readVMDevice(ctx, &data, &resp.Diagnostics)
+	readTimeout, diags := data.Timeouts.Read(ctx, defaultTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	found := r.readVMDevice(ctx, &data, &resp.Diagnostics)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
+	if !found {
+		// Deleted outside of Terraform; drop it from state so it is re-created
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -544,11 +602,20 @@ func (r *VMDeviceResource) Update(ctx context.Context, req resource.UpdateReques
 		return
 	}
 
+	updateTimeout, diags := data.Timeouts.Update(ctx, defaultTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
 	// Build update request
 	updateReq := map[string]interface{}{}
 
 	// Set order if specified
-	if !data.Order.IsNull() {
+	if !data.Order.IsNull() && !data.Order.IsUnknown() {
 		updateReq["order"] = int(data.Order.ValueInt64())
 	}
 
@@ -567,13 +634,13 @@ func (r *VMDeviceResource) Update(ctx context.Context, req resource.UpdateReques
 			if len(nicConfigs) > 0 {
 				nic := nicConfigs[0]
 				attributes["nic_attach"] = nic.NICAttach.ValueString()
-				if !nic.Type.IsNull() {
+				if !nic.Type.IsNull() && !nic.Type.IsUnknown() {
 					attributes["type"] = nic.Type.ValueString()
 				}
-				if !nic.MAC.IsNull() {
+				if !nic.MAC.IsNull() && !nic.MAC.IsUnknown() {
 					attributes["mac"] = nic.MAC.ValueString()
 				}
-				if !nic.TrustGuestRxFilters.IsNull() {
+				if !nic.TrustGuestRxFilters.IsNull() && !nic.TrustGuestRxFilters.IsUnknown() {
 					attributes["trust_guest_rx_filters"] = nic.TrustGuestRxFilters.ValueBool()
 				}
 			}
@@ -590,16 +657,16 @@ func (r *VMDeviceResource) Update(ctx context.Context, req resource.UpdateReques
 			if len(diskConfigs) > 0 {
 				disk := diskConfigs[0]
 				attributes["path"] = disk.Path.ValueString()
-				if !disk.Type.IsNull() {
+				if !disk.Type.IsNull() && !disk.Type.IsUnknown() {
 					attributes["type"] = disk.Type.ValueString()
 				}
-				if !disk.IOType.IsNull() {
+				if !disk.IOType.IsNull() && !disk.IOType.IsUnknown() {
 					attributes["iotype"] = disk.IOType.ValueString()
 				}
-				if !disk.PhysicalSectorSize.IsNull() {
+				if !disk.PhysicalSectorSize.IsNull() && !disk.PhysicalSectorSize.IsUnknown() {
 					attributes["physical_sectorsize"] = disk.PhysicalSectorSize.ValueInt64()
 				}
-				if !disk.LogicalSectorSize.IsNull() {
+				if !disk.LogicalSectorSize.IsNull() && !disk.LogicalSectorSize.IsUnknown() {
 					attributes["logical_sectorsize"] = disk.LogicalSectorSize.ValueInt64()
 				}
 			}
@@ -642,7 +709,7 @@ func (r *VMDeviceResource) Update(ctx context.Context, req resource.UpdateReques
 			if len(usbConfigs) > 0 {
 				usb := usbConfigs[0]
 				attributes["device"] = usb.Device.ValueString()
-				if !usb.Controller.IsNull() {
+				if !usb.Controller.IsNull() && !usb.Controller.IsUnknown() {
 					attributes["controller"] = usb.Controller.ValueString()
 				}
 			}
@@ -658,28 +725,28 @@ func (r *VMDeviceResource) Update(ctx context.Context, req resource.UpdateReques
 			}
 			if len(displayConfigs) > 0 {
 				display := displayConfigs[0]
-				if !display.Port.IsNull() {
+				if !display.Port.IsNull() && !display.Port.IsUnknown() {
 					attributes["port"] = int(display.Port.ValueInt64())
 				}
-				if !display.Bind.IsNull() {
+				if !display.Bind.IsNull() && !display.Bind.IsUnknown() {
 					attributes["bind"] = display.Bind.ValueString()
 				}
-				if !display.Password.IsNull() {
+				if !display.Password.IsNull() && !display.Password.IsUnknown() {
 					attributes["password"] = display.Password.ValueString()
 				}
-				if !display.Web.IsNull() {
+				if !display.Web.IsNull() && !display.Web.IsUnknown() {
 					attributes["web"] = display.Web.ValueBool()
 				}
-				if !display.Type.IsNull() {
+				if !display.Type.IsNull() && !display.Type.IsUnknown() {
 					attributes["type"] = display.Type.ValueString()
 				}
-				if !display.Resolution.IsNull() {
+				if !display.Resolution.IsNull() && !display.Resolution.IsUnknown() {
 					attributes["resolution"] = display.Resolution.ValueString()
 				}
-				if !display.WebPort.IsNull() {
+				if !display.WebPort.IsNull() && !display.WebPort.IsUnknown() {
 					attributes["web_port"] = int(display.WebPort.ValueInt64())
 				}
-				if !display.Wait.IsNull() {
+				if !display.Wait.IsNull() && !display.Wait.IsUnknown() {
 					attributes["wait"] = display.Wait.ValueBool()
 				}
 			}
@@ -696,10 +763,10 @@ func (r *VMDeviceResource) Update(ctx context.Context, req resource.UpdateReques
 			if len(rawConfigs) > 0 {
 				raw := rawConfigs[0]
 				attributes["path"] = raw.Path.ValueString()
-				if !raw.Size.IsNull() {
+				if !raw.Size.IsNull() && !raw.Size.IsUnknown() {
 					attributes["size"] = raw.Size.ValueInt64()
 				}
-				if !raw.Boot.IsNull() {
+				if !raw.Boot.IsNull() && !raw.Boot.IsUnknown() {
 					attributes["boot"] = raw.Boot.ValueBool()
 				}
 			}
@@ -710,13 +777,15 @@ func (r *VMDeviceResource) Update(ctx context.Context, req resource.UpdateReques
 		updateReq["attributes"] = attributes
 	}
 
-	_, err := r.client.UpdateVMDevice(data.ID.ValueString(), updateReq)
+	_, err := r.client.UpdateVMDevice(ctx, data.ID.ValueString(), updateReq)
 	if err != nil {
-		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to update VM device, got error: %s", err))
+		addClientError(&resp.Diagnostics, "update VM device", err, &data, vmDeviceAPIFields(data.DeviceType.ValueString()))
 		return
 	}
 
-	r.readVMDevice(ctx, &data, &resp.Diagnostics)
+	if !r.readVMDevice(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read VM device: it no longer exists")
+	}
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
 
@@ -728,7 +797,16 @@ func (r *VMDeviceResource) Delete(ctx context.Context, req resource.DeleteReques
 		return
 	}
 
-	_, err := r.client.DeleteVMDevice(data.ID.ValueString())
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, defaultTimeouts.Delete)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
+	_, err := r.client.DeleteVMDevice(ctx, data.ID.ValueString())
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete VM device, got error: %s", err))
 		return
@@ -739,17 +817,22 @@ func (r *VMDeviceResource) ImportState(ctx context.Context, req resource.ImportS
 	resource.ImportStatePassthroughID(ctx, path.Root("id"), req, resp)
 }
 
-func (r *VMDeviceResource) readVMDevice(ctx context.Context, data *VMDeviceResourceModel, diags *diag.Diagnostics) {
-	respBody, err := r.client.GetVMDevice(data.ID.ValueString())
+// readVMDevice refreshes data from the API. It returns false, without adding a
+// diagnostic, when the VM device no longer exists.
+func (r *VMDeviceResource) readVMDevice(ctx context.Context, data *VMDeviceResourceModel, diags *diag.Diagnostics) bool {
+	respBody, err := r.client.GetVMDevice(ctx, data.ID.ValueString())
 	if err != nil {
+		if truenas.IsNotFound(err) {
+			return false
+		}
 		diags.AddError("Client Error", fmt.Sprintf("Unable to read VM device, got error: %s", err))
-		return
+		return false
 	}
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(respBody, &result); err != nil {
 		diags.AddError("Parse Error", fmt.Sprintf("Unable to parse response: %s", err))
-		return
+		return false
 	}
 
 	// Read ID
@@ -956,4 +1039,6 @@ func (r *VMDeviceResource) readVMDevice(ctx context.Context, data *VMDeviceResou
 			}
 		}
 	}
+
+	return true
 }
@@ -5,6 +5,7 @@ import (
 
 	"github.com/hashicorp/terraform-plugin-framework/attr"
 	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -439,3 +440,88 @@ func TestVMDevice_MultipleDeviceTypesStructure(t *testing.T) {
 		assert.Contains(t, []string{"NIC", "DISK", "CDROM", "PCI", "USB", "DISPLAY", "RAW"}, deviceType)
 	}
 }
+
+// TestAccVMDeviceResource tests attaching, importing and updating standalone
+// VM devices
+func TestAccVMDeviceResource(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "vm/device", "truenas_vm_device"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "vm" {
+  name          = "db"
+  memory        = 2048
+  desired_state = "STOPPED"
+}
+
+resource "truenas_vm_device" "nic" {
+  vm_id       = truenas_vm.vm.id
+  device_type = "NIC"
+
+  nic_config = [
+    { nic_attach = "eno1" },
+  ]
+}
+
+resource "truenas_vm_device" "display" {
+  vm_id       = truenas_vm.vm.id
+  device_type = "DISPLAY"
+
+  display_config = [
+    { type = "SPICE", bind = "0.0.0.0", password = "secret" },
+  ]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttrPair("truenas_vm_device.nic", "vm_id", "truenas_vm.vm", "id"),
+					resource.TestCheckResourceAttr("truenas_vm_device.nic", "nic_config.0.type", "VIRTIO"),
+					resource.TestCheckResourceAttrSet("truenas_vm_device.nic", "nic_config.0.mac"),
+					resource.TestCheckResourceAttr("truenas_vm_device.display", "display_config.0.port", "5900"),
+					resource.TestCheckResourceAttr("truenas_vm_device.display", "display_config.0.web_port", "5901"),
+					testAccCheckExists(server, "vm/device", "truenas_vm_device.nic"),
+				),
+			},
+			{
+				ResourceName:            "truenas_vm_device.nic",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"timeouts"},
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "vm" {
+  name          = "db"
+  memory        = 2048
+  desired_state = "STOPPED"
+}
+
+resource "truenas_vm_device" "nic" {
+  vm_id       = truenas_vm.vm.id
+  device_type = "NIC"
+
+  nic_config = [
+    { nic_attach = "eno1", type = "E1000" },
+  ]
+}
+
+resource "truenas_vm_device" "display" {
+  vm_id       = truenas_vm.vm.id
+  device_type = "DISPLAY"
+
+  display_config = [
+    { type = "SPICE", bind = "0.0.0.0", password = "secret", resolution = "1920x1080" },
+  ]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_vm_device.nic", "nic_config.0.type", "E1000"),
+					resource.TestCheckResourceAttr("truenas_vm_device.display", "display_config.0.resolution", "1920x1080"),
+				),
+			},
+		},
+	})
+}
@@ -0,0 +1,454 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+)
+
+// zvolDevicePrefix is the directory of the block devices of zvols
+const zvolDevicePrefix = "/dev/zvol/"
+
+// diskImageVolsizeAlignment is the multiple default zvol sizes are rounded
+// up to. It is a multiple of every volblocksize.
+const diskImageVolsizeAlignment = 1 << 20
+
+var _ resource.Resource = &VMDiskImageResource{}
+var _ resource.ResourceWithModifyPlan = &VMDiskImageResource{}
+
+func NewVMDiskImageResource() resource.Resource {
+	return &VMDiskImageResource{}
+}
+
+type VMDiskImageResource struct {
+	client *truenas.Client
+}
+
+type VMDiskImageResourceModel struct {
+	ID          types.String `tfsdk:"id"`
+	Name        types.String `tfsdk:"name"`
+	Source      types.String `tfsdk:"source"`
+	SourceHash  types.String `tfsdk:"source_hash"`
+	Format      types.String `tfsdk:"format"`
+	VirtualSize types.Int64  `tfsdk:"virtual_size"`
+	Volsize     types.Int64  `tfsdk:"volsize"`
+	Path        types.String `tfsdk:"path"`
+
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
+}
+
+func (r *VMDiskImageResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_vm_disk_image"
+}
+
+func (r *VMDiskImageResource) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Creates a zvol from a local raw or qcow2 disk image, such as a cloud image, for use as a VM disk. qcow2 images are converted to raw by the provider while the image is uploaded, so no tools are needed on either host.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Name of the zvol",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"name": schema.StringAttribute{
+				MarkdownDescription: "Name of the zvol to create, including its pool and parent datasets (e.g. `tank/vms/debian-root`)",
+				Required:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"source": schema.StringAttribute{
+				MarkdownDescription: "Path of the image file on the machine running Terraform",
+				Required:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"source_hash": schema.StringAttribute{
+				MarkdownDescription: "Any value that changes with the content of `source`, such as `filesha256(\"debian.qcow2\")`. The image is only read when the zvol is created, so changing the file does not update the zvol unless this changes too; changing it replaces the zvol.",
+				Optional:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"format": schema.StringAttribute{
+				MarkdownDescription: "Format of the image: `raw` or `qcow2`. Detected from the content of the file by default.",
+				Optional:            true,
+				Computed:            true,
+				Validators: []validator.String{
+					stringvalidator.OneOf(diskImageFormatRaw, diskImageFormatQCOW2),
+				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"virtual_size": schema.Int64Attribute{
+				MarkdownDescription: "Size in bytes of the disk held by the image",
+				Computed:            true,
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.UseStateForUnknown(),
+				},
+			},
+			"volsize": schema.Int64Attribute{
+				MarkdownDescription: "Size of the zvol in bytes. It must be at least `virtual_size`, and defaults to `virtual_size` rounded up to a MiB. Growing it resizes the zvol in place, while shrinking it replaces the zvol.",
+				Optional:            true,
+				Computed:            true,
+				Validators: []validator.Int64{
+					int64validator.AtLeast(1),
+				},
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.UseStateForUnknown(),
+					int64planmodifier.RequiresReplaceIf(
+						volsizeShrinks,
+						"Shrinking the zvol replaces it.",
+						"Shrinking the zvol replaces it.",
+					),
+				},
+			},
+			"path": schema.StringAttribute{
+				MarkdownDescription: "Path of the zvol's block device, for `path` in the `disk_devices` of `truenas_vm`",
+				Computed:            true,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Read:   true,
+				Update: true,
+				Delete: true,
+			}),
+		},
+	}
+}
+
+func (r *VMDiskImageResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	client, ok := req.ProviderData.(*truenas.Client)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected *truenas.Client, got: %T.", req.ProviderData),
+		)
+		return
+	}
+
+	r.client = client
+}
+
+// ModifyPlan reads the image of a zvol about to be created, so that an
+// unreadable or unsupported image fails the plan and its format, virtual
+// size and the default volsize are known before apply
+func (r *VMDiskImageResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	// Nothing to check on destroy
+	if req.Plan.Raw.IsNull() {
+		return
+	}
+
+	var plan, config VMDiskImageResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Existing zvols only read the image again when they are replaced by a
+	// new image; a lower volsize replaces them with the same image
+	if !req.State.Raw.IsNull() {
+		var state VMDiskImageResourceModel
+		resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+		if plan.Name.Equal(state.Name) && plan.Source.Equal(state.Source) && plan.SourceHash.Equal(state.SourceHash) &&
+			(config.Format.IsNull() || config.Format.Equal(state.Format)) {
+			checkDiskImageVolsize(config.Volsize, state.VirtualSize.ValueInt64(), &resp.Diagnostics)
+			return
+		}
+	}
+
+	if plan.Source.IsUnknown() || config.Format.IsUnknown() {
+		// The image is read at apply; drop the values of a replaced zvol
+		plan.Format = config.Format
+		if config.Format.IsNull() {
+			plan.Format = types.StringUnknown()
+		}
+		plan.VirtualSize = types.Int64Unknown()
+		if config.Volsize.IsNull() {
+			plan.Volsize = types.Int64Unknown()
+		}
+		resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+		return
+	}
+
+	image, err := openDiskImage(plan.Source.ValueString(), config.Format.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(path.Root("source"), "Disk Image Error", fmt.Sprintf("Unable to read the disk image: %s", err))
+		return
+	}
+	image.Close()
+
+	plan.Format = types.StringValue(image.Format)
+	plan.VirtualSize = types.Int64Value(image.VirtualSize)
+	if config.Volsize.IsNull() {
+		plan.Volsize = types.Int64Value(diskImageVolsize(image.VirtualSize))
+	} else if !checkDiskImageVolsize(config.Volsize, image.VirtualSize, &resp.Diagnostics) {
+		return
+	}
+
+	resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+}
+
+func (r *VMDiskImageResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data VMDiskImageResourceModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	createTimeout, diags := data.Timeouts.Create(ctx, diskImageTimeouts.Create)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
+	format := ""
+	if !data.Format.IsUnknown() {
+		format = data.Format.ValueString()
+	}
+	image, err := openDiskImage(data.Source.ValueString(), format)
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(path.Root("source"), "Disk Image Error", fmt.Sprintf("Unable to read the disk image: %s", err))
+		return
+	}
+	defer image.Close()
+
+	if !data.VirtualSize.IsUnknown() && data.VirtualSize.ValueInt64() != image.VirtualSize {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("source"),
+			"Disk Image Error",
+			fmt.Sprintf("The virtual size of the disk image changed from %d to %d bytes since the plan was made. Plan again.", data.VirtualSize.ValueInt64(), image.VirtualSize),
+		)
+		return
+	}
+	data.Format = types.StringValue(image.Format)
+	data.VirtualSize = types.Int64Value(image.VirtualSize)
+	if data.Volsize.IsUnknown() {
+		data.Volsize = types.Int64Value(diskImageVolsize(image.VirtualSize))
+	}
+
+	name := data.Name.ValueString()
+	createReq := map[string]interface{}{
+		"name":    name,
+		"type":    "VOLUME",
+		"volsize": data.Volsize.ValueInt64(),
+	}
+	if _, err := r.client.PostJob(ctx, "/pool/dataset", createReq); err != nil {
+		addClientError(&resp.Diagnostics, "create zvol", err, &data, nil)
+		return
+	}
+	data.ID = types.StringValue(name)
+
+	// Write the raw disk straight to the zvol's block device
+	if _, err := r.client.UploadReader(ctx, zvolDevicePrefix+name, image, image.VirtualSize); err != nil {
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to write the disk image to zvol %s, got error: %s", name, err))
+		cleanupCtx, cleanupCancel := cleanupContext(ctx)
+		defer cleanupCancel()
+		if err := deleteZvol(cleanupCtx, r.client, name); err != nil {
+			resp.Diagnostics.AddError(
+				"Disk Image Cleanup Error",
+				fmt.Sprintf("Unable to remove the partially written zvol %s after the failure: %s. Remove it manually.", name, err),
+			)
+		}
+		return
+	}
+
+	if !r.readDiskImage(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read zvol: it no longer exists")
+	}
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *VMDiskImageResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data VMDiskImageResourceModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	readTimeout, diags := data.Timeouts.Read(ctx, diskImageTimeouts.Read)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	found := r.readDiskImage(ctx, &data, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !found {
+		// Deleted outside of Terraform; drop it from state so it is re-created
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *VMDiskImageResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var data, state VMDiskImageResourceModel
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	updateTimeout, diags := data.Timeouts.Update(ctx, diskImageTimeouts.Update)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	// Only growing the zvol happens in place
+	if !data.Volsize.Equal(state.Volsize) {
+		endpoint := fmt.Sprintf("/pool/dataset/id/%s", url.PathEscape(data.ID.ValueString()))
+		if _, err := r.client.Put(ctx, endpoint, map[string]interface{}{"volsize": data.Volsize.ValueInt64()}); err != nil {
+			addClientError(&resp.Diagnostics, "resize zvol", err, &data, nil)
+			return
+		}
+	}
+
+	if !r.readDiskImage(ctx, &data, &resp.Diagnostics) && !resp.Diagnostics.HasError() {
+		resp.Diagnostics.AddError("Client Error", "Unable to read zvol: it no longer exists")
+	}
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *VMDiskImageResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data VMDiskImageResourceModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	deleteTimeout, diags := data.Timeouts.Delete(ctx, diskImageTimeouts.Delete)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deleteTimeout)
+	defer cancel()
+
+	if err := deleteZvol(ctx, r.client, data.ID.ValueString()); err != nil {
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete zvol, got error: %s", err))
+	}
+}
+
+// readDiskImage refreshes data from the zvol. It returns false, without
+// adding a diagnostic, when the zvol no longer exists.
+func (r *VMDiskImageResource) readDiskImage(ctx context.Context, data *VMDiskImageResourceModel, diags *diag.Diagnostics) bool {
+	endpoint := fmt.Sprintf("/pool/dataset/id/%s", url.PathEscape(data.ID.ValueString()))
+	respBody, err := r.client.Get(ctx, endpoint)
+	if err != nil {
+		if truenas.IsNotFound(err) {
+			return false
+		}
+		diags.AddError("Client Error", fmt.Sprintf("Unable to read zvol, got error: %s", err))
+		return false
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		diags.AddError("Parse Error", fmt.Sprintf("Unable to parse zvol response: %s", err))
+		return false
+	}
+
+	if datasetType, _ := result["type"].(string); datasetType != "VOLUME" {
+		diags.AddError("Client Error", fmt.Sprintf("Dataset %s is a %s, not a zvol", data.ID.ValueString(), datasetType))
+		return false
+	}
+	if volsize, ok := result["volsize"].(map[string]interface{}); ok {
+		if value, ok := volsize["parsed"].(float64); ok {
+			data.Volsize = types.Int64Value(int64(value))
+		}
+	}
+	data.Path = types.StringValue(zvolDevicePrefix + data.ID.ValueString())
+
+	return true
+}
+
+// deleteZvol deletes a zvol, succeeding if it does not exist
+func deleteZvol(ctx context.Context, client *truenas.Client, name string) error {
+	endpoint := fmt.Sprintf("/pool/dataset/id/%s", url.PathEscape(name))
+	if _, err := client.DeleteJob(ctx, endpoint, map[string]bool{"recursive": false}); err != nil && !truenas.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// checkDiskImageVolsize reports an error if a configured volsize is too
+// small for the disk image, returning false
+func checkDiskImageVolsize(volsize types.Int64, virtualSize int64, diags *diag.Diagnostics) bool {
+	if volsize.IsNull() || volsize.IsUnknown() || volsize.ValueInt64() >= virtualSize {
+		return true
+	}
+	diags.AddAttributeError(
+		path.Root("volsize"),
+		"Invalid Attribute Value",
+		fmt.Sprintf("volsize must be at least the virtual size of the image, %d bytes.", virtualSize),
+	)
+	return false
+}
+
+// diskImageVolsize returns the default size of a zvol holding a disk of the
+// given virtual size
+func diskImageVolsize(virtualSize int64) int64 {
+	return (virtualSize + diskImageVolsizeAlignment - 1) / diskImageVolsizeAlignment * diskImageVolsizeAlignment
+}
+
+// volsizeShrinks replaces a zvol whose volsize is lowered, which ZFS does
+// not allow in place
+func volsizeShrinks(ctx context.Context, req planmodifier.Int64Request, resp *int64planmodifier.RequiresReplaceIfFuncResponse) {
+	if req.PlanValue.IsUnknown() || req.PlanValue.IsNull() || req.StateValue.IsNull() {
+		return
+	}
+	resp.RequiresReplace = req.PlanValue.ValueInt64() < req.StateValue.ValueInt64()
+}
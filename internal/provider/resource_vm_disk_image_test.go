@@ -0,0 +1,205 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/terraform"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas/fake"
+)
+
+func TestAccVMDiskImageResource(t *testing.T) {
+	server := testAccFakeServer(t)
+	qcow2, raw := buildQCOW2(t, 10, 129*1024, map[int64]testQCOW2Cluster{
+		0:   {data: bytes.Repeat([]byte("boot"), 256)},
+		7:   {data: bytes.Repeat([]byte("compressed"), 100), compressed: true},
+		128: {data: bytes.Repeat([]byte("root"), 256)},
+	})
+	source := writeTestFile(t, "debian.qcow2", qcow2)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "pool/dataset", "truenas_vm_disk_image"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + fmt.Sprintf(`
+resource "truenas_vm_disk_image" "test" {
+  name   = "tank/debian-root"
+  source = %q
+}
+`, source),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_vm_disk_image.test", "id", "tank/debian-root"),
+					resource.TestCheckResourceAttr("truenas_vm_disk_image.test", "format", "qcow2"),
+					resource.TestCheckResourceAttr("truenas_vm_disk_image.test", "virtual_size", "132096"),
+					resource.TestCheckResourceAttr("truenas_vm_disk_image.test", "volsize", "1048576"),
+					resource.TestCheckResourceAttr("truenas_vm_disk_image.test", "path", "/dev/zvol/tank/debian-root"),
+					testAccCheckExists(server, "pool/dataset", "truenas_vm_disk_image.test"),
+					testAccCheckZvolContent(server, "tank/debian-root", raw),
+				),
+			},
+			{
+				// Growing the zvol keeps its content
+				Config: testAccProviderConfig(server) + fmt.Sprintf(`
+resource "truenas_vm_disk_image" "test" {
+  name    = "tank/debian-root"
+  source  = %q
+  volsize = 2097152
+}
+`, source),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_vm_disk_image.test", "volsize", "2097152"),
+					testAccCheckZvolContent(server, "tank/debian-root", raw),
+				),
+			},
+			{
+				// A raw image replaces the zvol
+				Config: testAccProviderConfig(server) + fmt.Sprintf(`
+resource "truenas_vm_disk_image" "test" {
+  name    = "tank/debian-root"
+  source  = %q
+  format  = "raw"
+  volsize = 2097152
+}
+`, source),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_vm_disk_image.test", "format", "raw"),
+					resource.TestCheckResourceAttr("truenas_vm_disk_image.test", "virtual_size", fmt.Sprint(len(qcow2))),
+					testAccCheckZvolContent(server, "tank/debian-root", qcow2),
+				),
+			},
+		},
+	})
+}
+
+// TestAccVMDiskImageResource_invalidImage tests that images that cannot be
+// converted fail the plan
+func TestAccVMDiskImageResource_invalidImage(t *testing.T) {
+	server := testAccFakeServer(t)
+	qcow2, _ := buildQCOW2(t, 9, 4096, nil)
+	binary.BigEndian.PutUint64(qcow2[8:], 512)
+	source := writeTestFile(t, "overlay.qcow2", qcow2)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + fmt.Sprintf(`
+resource "truenas_vm_disk_image" "test" {
+  name   = "tank/overlay"
+  source = %q
+}
+`, source),
+				ExpectError: regexp.MustCompile(`backing file are not supported`),
+			},
+			{
+				Config: testAccProviderConfig(server) + fmt.Sprintf(`
+resource "truenas_vm_disk_image" "test" {
+  name    = "tank/overlay"
+  source  = %q
+  format  = "raw"
+  volsize = 512
+}
+`, source),
+				ExpectError: regexp.MustCompile(`volsize must be at least the virtual size of the image`),
+			},
+		},
+	})
+}
+
+// TestAccVMDiskImageResource_uploadFailure tests that the zvol is removed
+// when writing the image to it fails
+func TestAccVMDiskImageResource_uploadFailure(t *testing.T) {
+	server := testAccFakeServer(t)
+	source := writeTestFile(t, "disk.img", bytes.Repeat([]byte("raw"), 1024))
+	server.InjectFault(fake.Fault{
+		Path:     "/filesystem/put",
+		JobError: "[EIO] Input/output error",
+	})
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy: func(*terraform.State) error {
+			if _, ok := server.Object("pool/dataset", "tank/disk"); ok {
+				return fmt.Errorf("zvol tank/disk was not removed")
+			}
+			return nil
+		},
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + fmt.Sprintf(`
+resource "truenas_vm_disk_image" "test" {
+  name   = "tank/disk"
+  source = %q
+}
+`, source),
+				ExpectError: regexp.MustCompile(`Input/output error`),
+			},
+		},
+	})
+}
+
+// TestAccVMDiskImageResource_uploadTimeout tests that the zvol is removed
+// when writing the image to it runs past the create timeout
+func TestAccVMDiskImageResource_uploadTimeout(t *testing.T) {
+	server := testAccFakeServer(t)
+	source := writeTestFile(t, "disk.img", bytes.Repeat([]byte("raw"), 1024))
+	server.InjectFault(fake.Fault{
+		Path:  "/filesystem/put",
+		Delay: time.Minute,
+	})
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckZvolRemoved(server, "tank/disk"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + fmt.Sprintf(`
+resource "truenas_vm_disk_image" "test" {
+  name   = "tank/disk"
+  source = %q
+
+  timeouts {
+    create = "1s"
+  }
+}
+`, source),
+				ExpectError: regexp.MustCompile(`deadline exceeded`),
+			},
+			{
+				Config: testAccProviderConfig(server),
+				Check:  testAccCheckZvolRemoved(server, "tank/disk"),
+			},
+		},
+	})
+}
+
+// testAccCheckZvolRemoved verifies that a zvol no longer exists
+func testAccCheckZvolRemoved(server *fake.Server, zvol string) func(*terraform.State) error {
+	return func(*terraform.State) error {
+		if _, ok := server.Object("pool/dataset", zvol); ok {
+			return fmt.Errorf("zvol %s was not removed", zvol)
+		}
+		return nil
+	}
+}
+
+// testAccCheckZvolContent verifies the content written to the block device
+// of a zvol
+func testAccCheckZvolContent(server *fake.Server, zvol string, want []byte) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		content, ok := server.File(zvolDevicePrefix + zvol)
+		if !ok {
+			return fmt.Errorf("nothing was written to zvol %s", zvol)
+		}
+		if !bytes.Equal(content, want) {
+			return fmt.Errorf("zvol %s holds %d bytes that differ from the %d expected", zvol, len(content), len(want))
+		}
+		return nil
+	}
+}
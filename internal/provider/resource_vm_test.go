@@ -1,10 +1,16 @@
 package provider
 
 import (
+	"fmt"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/terraform"
 	"github.com/stretchr/testify/assert"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas/fake"
 )
 
 // TestVMUpdate_OnlySendsChangedFields tests that the Update() function logic
@@ -431,3 +437,709 @@ func TestVMLifecycle_StartOnCreateBackwardCompat(t *testing.T) {
 	assert.True(t, vm.StartOnCreate.ValueBool())
 	assert.True(t, vm.DesiredState.IsNull())
 }
+
+// TestAccVMResource tests creating a VM with inline devices, starting it and
+// updating it
+func TestAccVMResource(t *testing.T) {
+	server := testAccFakeServer(t)
+	server.PutFile("/mnt/tank/isos/debian.iso", []byte("iso"))
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "vm", "truenas_vm"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset" "disk" {
+  name    = "tank/web-disk0"
+  type    = "VOLUME"
+  volsize = 21474836480
+}
+
+resource "truenas_vm" "test" {
+  name          = "web"
+  memory        = 2048
+  desired_state = "STOPPED"
+
+  nic_devices = [
+    { nic_attach = "eno1" },
+  ]
+
+  disk_devices = [
+    { path = "/dev/zvol/${truenas_dataset.disk.name}" },
+  ]
+
+  cdrom_devices = [
+    { path = "/mnt/tank/isos/debian.iso" },
+  ]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_vm.test", "name", "web"),
+					resource.TestCheckResourceAttr("truenas_vm.test", "memory", "2048"),
+					resource.TestCheckResourceAttr("truenas_vm.test", "status", "STOPPED"),
+					resource.TestCheckResourceAttr("truenas_vm.test", "nic_devices.0.type", "VIRTIO"),
+					resource.TestCheckResourceAttr("truenas_vm.test", "mac_addresses.#", "1"),
+					resource.TestCheckResourceAttr("truenas_vm.test", "disk_devices.0.path", "/dev/zvol/tank/web-disk0"),
+					resource.TestCheckResourceAttr("truenas_vm.test", "cdrom_devices.0.path", "/mnt/tank/isos/debian.iso"),
+					testAccCheckExists(server, "vm", "truenas_vm.test"),
+				),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_dataset" "disk" {
+  name    = "tank/web-disk0"
+  type    = "VOLUME"
+  volsize = 21474836480
+}
+
+resource "truenas_vm" "test" {
+  name          = "web"
+  memory        = 4096
+  vcpus         = 2
+  desired_state = "RUNNING"
+
+  nic_devices = [
+    { nic_attach = "eno1" },
+  ]
+
+  disk_devices = [
+    { path = "/dev/zvol/${truenas_dataset.disk.name}" },
+  ]
+
+  cdrom_devices = [
+    { path = "/mnt/tank/isos/debian.iso" },
+  ]
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_vm.test", "memory", "4096"),
+					resource.TestCheckResourceAttr("truenas_vm.test", "vcpus", "2"),
+					resource.TestCheckResourceAttr("truenas_vm.test", "status", "RUNNING"),
+				),
+			},
+		},
+	})
+}
+
+// TestAccVMResource_deviceChanges tests that changes to the inline device
+// lists are applied to the VM's devices
+func TestAccVMResource_deviceChanges(t *testing.T) {
+	server := testAccFakeServer(t)
+	server.PutFile("/mnt/tank/isos/debian.iso", []byte("iso"))
+	server.PutFile("/mnt/tank/isos/ubuntu.iso", []byte("iso"))
+
+	config := func(nics, disks, cdroms string) string {
+		return testAccProviderConfig(server) + fmt.Sprintf(`
+resource "truenas_vm" "test" {
+  name          = "app"
+  memory        = 2048
+  desired_state = "STOPPED"
+
+  nic_devices   = [%s]
+  disk_devices  = [%s]
+  cdrom_devices = [%s]
+}
+`, nics, disks, cdroms)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "vm", "truenas_vm"),
+		Steps: []resource.TestStep{
+			{
+				Config: config(
+					`{ nic_attach = "eno1" }`,
+					`{ path = "/dev/zvol/tank/app-disk0" }`,
+					`{ path = "/mnt/tank/isos/debian.iso" }`,
+				),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testAccCheckVMDevices(server, "NIC", 1),
+					testAccCheckVMDevices(server, "DISK", 1),
+					testAccCheckVMDevices(server, "CDROM", 1),
+				),
+			},
+			{
+				// Add a NIC and a disk, swap the ISO and retype the first NIC
+				Config: config(
+					`{ nic_attach = "eno1", type = "E1000" }, { nic_attach = "eno1" }`,
+					`{ path = "/dev/zvol/tank/app-disk0" }, { path = "/dev/zvol/tank/app-disk1", iotype = "NATIVE" }`,
+					`{ path = "/mnt/tank/isos/ubuntu.iso" }`,
+				),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testAccCheckVMDevices(server, "NIC", 2),
+					testAccCheckVMDevices(server, "DISK", 2),
+					testAccCheckVMDevices(server, "CDROM", 1),
+					resource.TestCheckResourceAttr("truenas_vm.test", "nic_devices.0.type", "E1000"),
+					resource.TestCheckResourceAttr("truenas_vm.test", "nic_devices.1.type", "VIRTIO"),
+					resource.TestCheckResourceAttr("truenas_vm.test", "disk_devices.1.path", "/dev/zvol/tank/app-disk1"),
+					resource.TestCheckResourceAttr("truenas_vm.test", "disk_devices.1.iotype", "NATIVE"),
+					resource.TestCheckResourceAttr("truenas_vm.test", "cdrom_devices.0.path", "/mnt/tank/isos/ubuntu.iso"),
+					resource.TestCheckResourceAttr("truenas_vm.test", "mac_addresses.#", "2"),
+				),
+			},
+			{
+				// Remove the first disk and every CD-ROM
+				Config: config(
+					`{ nic_attach = "eno1", type = "E1000" }, { nic_attach = "eno1" }`,
+					`{ path = "/dev/zvol/tank/app-disk1", iotype = "NATIVE" }`,
+					``,
+				),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testAccCheckVMDevices(server, "NIC", 2),
+					testAccCheckVMDevices(server, "DISK", 1),
+					testAccCheckVMDevices(server, "CDROM", 0),
+					resource.TestCheckResourceAttr("truenas_vm.test", "disk_devices.0.path", "/dev/zvol/tank/app-disk1"),
+					resource.TestCheckResourceAttr("truenas_vm.test", "cdrom_devices.#", "0"),
+				),
+			},
+		},
+	})
+}
+
+// TestAccVMResource_deviceChangesRunning tests that a running VM is stopped
+// around device changes when allow_stop_for_device_changes is set
+func TestAccVMResource_deviceChangesRunning(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	config := func(disks string) string {
+		return testAccProviderConfig(server) + fmt.Sprintf(`
+resource "truenas_vm" "test" {
+  name                          = "cache"
+  memory                        = 1024
+  desired_state                 = "RUNNING"
+  allow_stop_for_device_changes = true
+
+  disk_devices = [%s]
+}
+`, disks)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "vm", "truenas_vm"),
+		Steps: []resource.TestStep{
+			{
+				Config: config(`{ path = "/dev/zvol/tank/cache-disk0" }`),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_vm.test", "status", "RUNNING"),
+					testAccCheckVMDevices(server, "DISK", 1),
+				),
+			},
+			{
+				Config: config(`{ path = "/dev/zvol/tank/cache-disk0" }, { path = "/dev/zvol/tank/cache-disk1" }`),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_vm.test", "status", "RUNNING"),
+					testAccCheckVMDevices(server, "DISK", 2),
+					testAccCheckVMStopRequested(server),
+				),
+			},
+		},
+	})
+}
+
+// testAccCheckVMDevices verifies the number of devices of a type on the
+// fake server
+func testAccCheckVMDevices(server *fake.Server, dtype string, count int) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		found := 0
+		for _, device := range server.Objects("vm/device") {
+			if device["dtype"] == dtype {
+				found++
+			}
+		}
+		if found != count {
+			return fmt.Errorf("expected %d %s devices, found %d", count, dtype, found)
+		}
+		return nil
+	}
+}
+
+// testAccCheckVMStopRequested verifies that the provider stopped a VM
+func testAccCheckVMStopRequested(server *fake.Server) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		for _, request := range server.Requests() {
+			if request.Method == "POST" && strings.HasSuffix(request.Path, "/stop") {
+				return nil
+			}
+		}
+		return fmt.Errorf("the VM was not stopped")
+	}
+}
+
+// TestAccVMResource_displays tests that displays without a port are given
+// free ones and that the URIs to connect to them are reported
+func TestAccVMResource_displays(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "vm", "truenas_vm"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "web" {
+  name          = "web"
+  memory        = 2048
+  desired_state = "STOPPED"
+
+  display_devices = [
+    { type = "SPICE", bind = "0.0.0.0", password = "secret" },
+  ]
+}
+
+resource "truenas_vm" "db" {
+  name          = "db"
+  memory        = 2048
+  desired_state = "STOPPED"
+
+  display_devices = [
+    { type = "VNC", bind = "10.0.0.5", password = "vnc", web = false },
+  ]
+
+  depends_on = [truenas_vm.web]
+}
+
+data "truenas_vm_display" "web" {
+  vm_id = truenas_vm.web.id
+  host  = "nas.example.com"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_vm.web", "display_devices.0.port", "5900"),
+					resource.TestCheckResourceAttr("truenas_vm.web", "display_devices.0.web_port", "5901"),
+					resource.TestCheckResourceAttr("truenas_vm.web", "displays.#", "1"),
+					resource.TestCheckResourceAttr("truenas_vm.web", "displays.0.type", "SPICE"),
+					resource.TestCheckResourceAttr("truenas_vm.web", "displays.0.port", "5900"),
+					resource.TestCheckResourceAttr("truenas_vm.web", "displays.0.remote_viewer_uri", "spice://127.0.0.1:5900"),
+					resource.TestMatchResourceAttr("truenas_vm.web", "displays.0.web_uri", regexp.MustCompile(`^http://127\.0\.0\.1/vm/display/\d+/spice_auto\.html\?.*password=secret`)),
+					resource.TestCheckResourceAttr("truenas_vm.db", "display_devices.0.port", "5902"),
+					resource.TestCheckResourceAttr("truenas_vm.db", "display_devices.0.web_port", "5903"),
+					resource.TestCheckResourceAttr("truenas_vm.db", "displays.0.remote_viewer_uri", "vnc://10.0.0.5:5902"),
+					resource.TestCheckNoResourceAttr("truenas_vm.db", "displays.0.web_uri"),
+					resource.TestCheckResourceAttrSet("data.truenas_vm_display.web", "console"),
+					resource.TestCheckResourceAttr("data.truenas_vm_display.web", "displays.0.password", "secret"),
+					resource.TestCheckResourceAttr("data.truenas_vm_display.web", "displays.0.web", "true"),
+					resource.TestCheckResourceAttr("data.truenas_vm_display.web", "displays.0.remote_viewer_uri", "spice://nas.example.com:5900"),
+					resource.TestMatchResourceAttr("data.truenas_vm_display.web", "displays.0.web_uri", regexp.MustCompile(`^http://nas\.example\.com/vm/display/`)),
+				),
+			},
+		},
+	})
+}
+
+// TestAccVMResource_hostCapacity tests that a VM the host cannot run fails
+// the plan
+func TestAccVMResource_hostCapacity(t *testing.T) {
+	server := testAccFakeServer(t)
+	server.SetHostCapacity(fake.HostCapacity{Memory: 4096 << 20, MaxVCPUs: 4})
+
+	config := func(vms string) string {
+		return testAccProviderConfig(server) + vms + `
+data "truenas_vm_host_capacity" "host" {
+  depends_on = [truenas_vm.web]
+}
+`
+	}
+	web := func(memory int, vcpus int, state string) string {
+		return fmt.Sprintf(`
+resource "truenas_vm" "web" {
+  name          = "web"
+  memory        = %d
+  vcpus         = %d
+  cores         = 2
+  desired_state = %q
+}
+`, memory, vcpus, state)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "vm", "truenas_vm"),
+		Steps: []resource.TestStep{
+			{
+				Config:      config(web(8192, 1, "RUNNING")),
+				ExpectError: regexp.MustCompile(`Insufficient Host Memory`),
+			},
+			{
+				Config:      config(web(2048, 4, "STOPPED")),
+				ExpectError: regexp.MustCompile(`The VM has 8 vCPUs`),
+			},
+			{
+				// A stopped VM may need more memory than is free
+				Config: config(web(8192, 2, "STOPPED")),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("data.truenas_vm_host_capacity.host", "available_memory_mb", "4096"),
+					resource.TestCheckResourceAttr("data.truenas_vm_host_capacity.host", "maximum_supported_vcpus", "4"),
+					resource.TestCheckResourceAttr("data.truenas_vm_host_capacity.host", "virtualization_supported", "true"),
+					resource.TestCheckNoResourceAttr("data.truenas_vm_host_capacity.host", "virtualization_error"),
+					resource.TestCheckResourceAttr("data.truenas_vm_host_capacity.host", "vm_memory_in_use", "0"),
+				),
+			},
+			{
+				Config:      config(web(8192, 2, "RUNNING")),
+				ExpectError: regexp.MustCompile(`needs 8192 MiB of memory to run`),
+			},
+			{
+				Config: config(web(2048, 2, "RUNNING")),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_vm.web", "status", "RUNNING"),
+					resource.TestCheckResourceAttr("data.truenas_vm_host_capacity.host", "available_memory_mb", "2048"),
+					resource.TestCheckResourceAttr("data.truenas_vm_host_capacity.host", "vm_memory_in_use", "2147483648"),
+				),
+			},
+			{
+				// Only the memory added to a running VM must be free
+				Config: config(web(4096, 2, "RUNNING")),
+				Check:  resource.TestCheckResourceAttr("truenas_vm.web", "memory", "4096"),
+			},
+			{
+				PreConfig: func() {
+					server.SetHostCapacity(fake.HostCapacity{Memory: 4096 << 20, MaxVCPUs: 4, VirtualizationError: "Your CPU does not support KVM extensions"})
+				},
+				Config: config(web(4096, 2, "RUNNING") + `
+resource "truenas_vm" "db" {
+  name          = "db"
+  memory        = 1024
+  desired_state = "RUNNING"
+}
+`),
+				ExpectError: regexp.MustCompile(`Virtualization Not Supported`),
+			},
+		},
+	})
+}
+
+// TestAccVMResource_cloudInitNetwork tests that network-config and
+// vendor-data are written to the seed ISO
+func TestAccVMResource_cloudInitNetwork(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "vm", "truenas_vm"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "test" {
+  name   = "web"
+  memory = 2048
+
+  cloud_init = {
+    network_config = "version: 2\n"
+    network = {
+      interfaces = [{ name = "eth0" }]
+    }
+  }
+}
+`,
+				ExpectError: regexp.MustCompile(`Invalid Attribute Combination`),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "test" {
+  name          = "web"
+  memory        = 2048
+  desired_state = "STOPPED"
+
+  cloud_init = {
+    user_data   = "#cloud-config\n"
+    vendor_data = "#cloud-config\npackages: [qemu-guest-agent]\n"
+
+    network = {
+      interfaces = [
+        { name = "eth0", addresses = ["192.168.1.100/24"], gateway4 = "192.168.1.1" },
+      ]
+      nameservers = ["192.168.1.1"]
+    }
+  }
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_vm.test", "cloud_init.upload_path", "/mnt/tank/isos"),
+					testAccCheckCloudInitISO(t, server, "/mnt/tank/isos/cloud-init-web.iso", "network-config", "via: 192.168.1.1"),
+					testAccCheckCloudInitISO(t, server, "/mnt/tank/isos/cloud-init-web.iso", "vendor-data", "qemu-guest-agent"),
+				),
+			},
+			{
+				// Raw network_config replaces the rendered one
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "test" {
+  name          = "web"
+  memory        = 2048
+  desired_state = "STOPPED"
+
+  cloud_init = {
+    user_data      = "#cloud-config\n"
+    network_config = "version: 2\nethernets:\n  eth0:\n    dhcp4: true\n"
+  }
+}
+`,
+				Check: testAccCheckCloudInitISO(t, server, "/mnt/tank/isos/cloud-init-web.iso", "network-config", "dhcp4: true"),
+			},
+		},
+	})
+}
+
+// testAccCheckCloudInitISO verifies that a file in the seed ISO uploaded to
+// the fake server contains the given text
+func testAccCheckCloudInitISO(t *testing.T, server *fake.Server, isoPath, name, contains string) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		iso, ok := server.File(isoPath)
+		if !ok {
+			return fmt.Errorf("cloud-init ISO %s was not uploaded", isoPath)
+		}
+		if content := testISOFiles(t, iso)[name]; !strings.Contains(content, contains) {
+			return fmt.Errorf("expected %s to contain %q, got %q", name, contains, content)
+		}
+		return nil
+	}
+}
+
+// TestAccVMResource_cloudInitUserDataConfig tests rendering user_data_config
+// and checking cloud-config YAML at plan time
+func TestAccVMResource_cloudInitUserDataConfig(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "vm", "truenas_vm"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "test" {
+  name   = "web"
+  memory = 2048
+
+  cloud_init = {
+    user_data = "#cloud-config\npackages: [curl\n"
+  }
+}
+`,
+				PlanOnly:    true,
+				ExpectError: regexp.MustCompile(`The user-data is not valid YAML`),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "test" {
+  name          = "web"
+  memory        = 2048
+  desired_state = "STOPPED"
+
+  cloud_init = {
+    user_data_config = {
+      users = [
+        { name = "default" },
+        { name = "ops", groups = ["sudo"], ssh_authorized_keys = ["ssh-ed25519 AAAA ops"] },
+      ]
+      packages = ["qemu-guest-agent"]
+      runcmd   = ["systemctl enable --now qemu-guest-agent"]
+    }
+  }
+}
+`,
+				Check: testAccCheckCloudInitISO(t, server, "/mnt/tank/isos/cloud-init-web.iso", "user-data", "#cloud-config\nusers:\n    - default\n    - name: ops"),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "test" {
+  name          = "web"
+  memory        = 2048
+  desired_state = "STOPPED"
+
+  cloud_init = {
+    user_data = "#cloud-config\nhostname: web\n"
+    user_data_config = {
+      packages = ["qemu-guest-agent"]
+    }
+  }
+}
+`,
+				Check: testAccCheckCloudInitISO(t, server, "/mnt/tank/isos/cloud-init-web.iso", "user-data", "Content-Type: multipart/mixed"),
+			},
+		},
+	})
+}
+
+// TestAccVMResource_seedFormats tests the talos and ignition seed formats
+// and the seed alias of cloud_init
+func TestAccVMResource_seedFormats(t *testing.T) {
+	server := testAccFakeServer(t)
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "vm", "truenas_vm"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "test" {
+  name   = "talos"
+  memory = 2048
+
+  seed = {
+    seed_format    = "talos"
+    user_data      = "machine:\n  type: worker\n"
+    network_config = "version: 2\n"
+  }
+}
+`,
+				PlanOnly:    true,
+				ExpectError: regexp.MustCompile(`network_config is only supported with seed_format "nocloud"`),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "test" {
+  name   = "talos"
+  memory = 2048
+
+  seed = {
+    seed_format = "ignition"
+    user_data   = "variant: fcos\n"
+  }
+}
+`,
+				PlanOnly:    true,
+				ExpectError: regexp.MustCompile(`not a valid JSON Ignition config`),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "test" {
+  name   = "talos"
+  memory = 2048
+
+  cloud_init = {
+    user_data = "#cloud-config\n"
+  }
+  seed = {
+    user_data = "#cloud-config\n"
+  }
+}
+`,
+				PlanOnly:    true,
+				ExpectError: regexp.MustCompile(`Invalid Attribute Combination`),
+			},
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "test" {
+  name          = "talos"
+  memory        = 2048
+  desired_state = "STOPPED"
+
+  seed = {
+    seed_format = "talos"
+    user_data   = "version: v1alpha1\nmachine:\n  type: worker\n"
+  }
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("truenas_vm.test", "seed.filename", "cloud-init-talos.iso"),
+					testAccCheckCloudInitISO(t, server, "/mnt/tank/isos/cloud-init-talos.iso", "config.yaml", "type: worker"),
+					testAccCheckVMDevices(server, "CDROM", 1),
+				),
+			},
+		},
+	})
+}
+
+// TestAccVMResource_seedDevice tests that the seed ISO device is tracked
+// and pointed at a new ISO when the configuration changes
+func TestAccVMResource_seedDevice(t *testing.T) {
+	server := testAccFakeServer(t)
+	var deviceID string
+
+	resource.Test(t, resource.TestCase{
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		CheckDestroy:             testAccCheckDestroyed(server, "vm", "truenas_vm"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "test" {
+  name          = "web"
+  memory        = 2048
+  desired_state = "STOPPED"
+
+  cloud_init = {
+    user_data = "#cloud-config\nhostname: web\n"
+  }
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttrSet("truenas_vm.test", "cloud_init.device_id"),
+					resource.TestMatchResourceAttr("truenas_vm.test", "cloud_init.content_hash", regexp.MustCompile(`^[0-9a-f]{64}$`)),
+					testAccCheckVMCDROMPaths(server, "/mnt/tank/isos/cloud-init-web.iso"),
+					func(s *terraform.State) error {
+						deviceID = s.RootModule().Resources["truenas_vm.test"].Primary.Attributes["cloud_init.device_id"]
+						return nil
+					},
+				),
+			},
+			{
+				// A new path swaps the device to the new ISO and deletes the old one
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "test" {
+  name          = "web"
+  memory        = 2048
+  desired_state = "STOPPED"
+
+  cloud_init = {
+    user_data            = "#cloud-config\nhostname: web01\n"
+    meta_data            = "instance-id: web\n"
+    filename             = "seed-web.iso"
+    regenerate_on_change = true
+  }
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					func(s *terraform.State) error {
+						return resource.TestCheckResourceAttr("truenas_vm.test", "cloud_init.device_id", deviceID)(s)
+					},
+					testAccCheckVMCDROMPaths(server, "/mnt/tank/isos/seed-web.iso"),
+					testAccCheckCloudInitISO(t, server, "/mnt/tank/isos/seed-web.iso", "user-data", "hostname: web01"),
+					testAccCheckCloudInitISO(t, server, "/mnt/tank/isos/seed-web.iso", "meta-data", "instance-id: web-"),
+					testAccCheckFileDeleted(server, "/mnt/tank/isos/cloud-init-web.iso"),
+				),
+			},
+			{
+				// Removing the block detaches and deletes the ISO
+				Config: testAccProviderConfig(server) + `
+resource "truenas_vm" "test" {
+  name          = "web"
+  memory        = 2048
+  desired_state = "STOPPED"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testAccCheckVMCDROMPaths(server),
+					testAccCheckFileDeleted(server, "/mnt/tank/isos/seed-web.iso"),
+				),
+			},
+		},
+	})
+}
+
+// testAccCheckVMCDROMPaths verifies the paths of the CD-ROM devices on the
+// fake server
+func testAccCheckVMCDROMPaths(server *fake.Server, paths ...string) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		var found []string
+		for _, device := range server.Objects("vm/device") {
+			if device["dtype"] == "CDROM" {
+				found = append(found, fmt.Sprint(device["attributes"].(map[string]interface{})["path"]))
+			}
+		}
+		if strings.Join(found, ",") != strings.Join(paths, ",") {
+			return fmt.Errorf("expected CD-ROM paths %v, found %v", paths, found)
+		}
+		return nil
+	}
+}
+
+// testAccCheckFileDeleted verifies that a file is gone from the fake server
+func testAccCheckFileDeleted(server *fake.Server, path string) func(*terraform.State) error {
+	return func(s *terraform.State) error {
+		if _, ok := server.File(path); ok {
+			return fmt.Errorf("file %s still exists", path)
+		}
+		return nil
+	}
+}
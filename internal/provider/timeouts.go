@@ -0,0 +1,105 @@
+package provider
+
+import (
+	"context"
+	"time"
+)
+
+// operationTimeouts holds the default duration of each CRUD operation. They
+// apply when the practitioner does not set the matching key in the resource's
+// timeouts block.
+type operationTimeouts struct {
+	Create time.Duration
+	Read   time.Duration
+	Update time.Duration
+	Delete time.Duration
+}
+
+// defaultTimeouts covers resources that map to a single quick API call
+var defaultTimeouts = operationTimeouts{
+	Create: 5 * time.Minute,
+	Read:   2 * time.Minute,
+	Update: 5 * time.Minute,
+	Delete: 5 * time.Minute,
+}
+
+// datasetTimeouts allows for large zvol creation and recursive destroys on slow pools
+var datasetTimeouts = operationTimeouts{
+	Create: 20 * time.Minute,
+	Read:   2 * time.Minute,
+	Update: 20 * time.Minute,
+	Delete: 20 * time.Minute,
+}
+
+// snapshotTimeouts allows for recursive snapshots of large dataset trees
+var snapshotTimeouts = operationTimeouts{
+	Create: 10 * time.Minute,
+	Read:   2 * time.Minute,
+	Update: 10 * time.Minute,
+	Delete: 10 * time.Minute,
+}
+
+// vmTimeouts allows for device creation, cloud-init uploads and state transitions
+var vmTimeouts = operationTimeouts{
+	Create: 30 * time.Minute,
+	Read:   5 * time.Minute,
+	Update: 30 * time.Minute,
+	Delete: 15 * time.Minute,
+}
+
+// diskImageTimeouts allows for uploading large disk images to a zvol
+var diskImageTimeouts = operationTimeouts{
+	Create: 60 * time.Minute,
+	Read:   2 * time.Minute,
+	Update: 20 * time.Minute,
+	Delete: 20 * time.Minute,
+}
+
+// fileTimeouts allows for uploading large files such as installer ISOs
+var fileTimeouts = operationTimeouts{
+	Create: 60 * time.Minute,
+	Read:   2 * time.Minute,
+	Update: 60 * time.Minute,
+	Delete: 5 * time.Minute,
+}
+
+// permissionTimeouts allows for recursive permission and ACL changes on
+// large directory trees
+var permissionTimeouts = operationTimeouts{
+	Create: 30 * time.Minute,
+	Read:   2 * time.Minute,
+	Update: 30 * time.Minute,
+	Delete: 5 * time.Minute,
+}
+
+// chartReleaseTimeouts allows for image pulls and app deployment
+var chartReleaseTimeouts = operationTimeouts{
+	Create: 30 * time.Minute,
+	Read:   5 * time.Minute,
+	Update: 30 * time.Minute,
+	Delete: 15 * time.Minute,
+}
+
+// cleanupTimeout bounds the removal of what a failed create left behind
+const cleanupTimeout = 5 * time.Minute
+
+// cleanupContext returns a context for removing what a failed operation
+// left behind. It is not cancelled with ctx, since the operation may have
+// failed because its own timeout expired, and ends after cleanupTimeout.
+func cleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+}
+
+// sleepWithContext pauses for d, returning early with the context error if
+// ctx is done first.
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,159 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+)
+
+// vmHostCapacity is what the TrueNAS host offers to VMs
+type vmHostCapacity struct {
+	// availableMemory is the memory in bytes free to start VMs
+	availableMemory int64
+	// maxVCPUs is the maximum of vcpus × cores × threads of a VM
+	maxVCPUs int64
+	// virtualizationSupported is false when the host cannot run VMs, for
+	// the reason in virtualizationError
+	virtualizationSupported bool
+	virtualizationError     string
+}
+
+// readVMHostCapacity reads the capacity of the host from
+// /vm/get_available_memory, /vm/maximum_supported_vcpus and
+// /vm/virtualization_details
+func readVMHostCapacity(ctx context.Context, client *truenas.Client) (*vmHostCapacity, error) {
+	var capacity vmHostCapacity
+
+	respBody, err := client.GetVMAvailableMemory(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("reading available memory: %w", err)
+	}
+	if err := json.Unmarshal(respBody, &capacity.availableMemory); err != nil {
+		return nil, fmt.Errorf("parsing available memory: %w", err)
+	}
+
+	respBody, err = client.GetVMMaximumSupportedVCPUs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading maximum supported vCPUs: %w", err)
+	}
+	if err := json.Unmarshal(respBody, &capacity.maxVCPUs); err != nil {
+		return nil, fmt.Errorf("parsing maximum supported vCPUs: %w", err)
+	}
+
+	respBody, err = client.GetVMVirtualizationDetails(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading virtualization details: %w", err)
+	}
+	var details struct {
+		Supported bool    `json:"supported"`
+		Error     *string `json:"error"`
+	}
+	if err := json.Unmarshal(respBody, &details); err != nil {
+		return nil, fmt.Errorf("parsing virtualization details: %w", err)
+	}
+	capacity.virtualizationSupported = details.Supported
+	if details.Error != nil {
+		capacity.virtualizationError = *details.Error
+	}
+
+	return &capacity, nil
+}
+
+// checkVMCapacity reports an error when the host cannot run the planned VM:
+// when its vCPUs exceed what the host supports, or when it is planned to
+// run and the host lacks the memory or virtualization support to start it.
+// state is nil when the VM is created. The host is only queried when the
+// plan changes the CPU topology, the memory or the desired state.
+func checkVMCapacity(ctx context.Context, client *truenas.Client, plan, state *VMResourceModel, diags *diag.Diagnostics) {
+	vcpus := plannedVMInt64(plan.VCPUs, state, func(m *VMResourceModel) types.Int64 { return m.VCPUs })
+	cores := plannedVMInt64(plan.Cores, state, func(m *VMResourceModel) types.Int64 { return m.Cores })
+	threads := plannedVMInt64(plan.Threads, state, func(m *VMResourceModel) types.Int64 { return m.Threads })
+	running := plannedVMRunning(plan, state)
+
+	if state != nil {
+		wasRunning := strings.EqualFold(state.Status.ValueString(), "RUNNING")
+		unchanged := plan.Memory.Equal(state.Memory) &&
+			vcpus*cores*threads == state.VCPUs.ValueInt64()*state.Cores.ValueInt64()*state.Threads.ValueInt64() &&
+			running == wasRunning
+		if unchanged {
+			return
+		}
+	}
+
+	capacity, err := readVMHostCapacity(ctx, client)
+	if err != nil {
+		diags.AddWarning(
+			"Unable to Check Host Capacity",
+			fmt.Sprintf("The memory and vCPUs of the VM could not be checked against the capacity of the host: %s", err),
+		)
+		return
+	}
+
+	if total := vcpus * cores * threads; total > capacity.maxVCPUs {
+		diags.AddAttributeError(
+			path.Root("vcpus"),
+			"Insufficient Host CPUs",
+			fmt.Sprintf("The VM has %d vCPUs (vcpus × cores × threads = %d × %d × %d), but the host supports at most %d.",
+				total, vcpus, cores, threads, capacity.maxVCPUs),
+		)
+	}
+
+	if !running {
+		return
+	}
+
+	if !capacity.virtualizationSupported {
+		diags.AddAttributeError(
+			path.Root("desired_state"),
+			"Virtualization Not Supported",
+			fmt.Sprintf("The VM cannot be started because the host does not support virtualization: %s", capacity.virtualizationError),
+		)
+		return
+	}
+
+	if plan.Memory.IsUnknown() {
+		return
+	}
+	// A running VM already holds its current memory
+	needed := plan.Memory.ValueInt64() << 20
+	if state != nil && strings.EqualFold(state.Status.ValueString(), "RUNNING") {
+		needed -= state.Memory.ValueInt64() << 20
+	}
+	if needed > capacity.availableMemory {
+		diags.AddAttributeError(
+			path.Root("memory"),
+			"Insufficient Host Memory",
+			fmt.Sprintf("The VM needs %d MiB of memory to run, but only %d MiB are available on the host.",
+				needed>>20, capacity.availableMemory>>20),
+		)
+	}
+}
+
+// plannedVMInt64 returns a planned CPU topology value. A value left to the
+// server keeps its current value, or the default of 1 for a new VM.
+func plannedVMInt64(planned types.Int64, state *VMResourceModel, current func(*VMResourceModel) types.Int64) int64 {
+	if !planned.IsNull() && !planned.IsUnknown() && planned.ValueInt64() > 0 {
+		return planned.ValueInt64()
+	}
+	if state != nil && current(state).ValueInt64() > 0 {
+		return current(state).ValueInt64()
+	}
+	return 1
+}
+
+// plannedVMRunning reports whether the plan leaves the VM running
+func plannedVMRunning(plan, state *VMResourceModel) bool {
+	if !plan.DesiredState.IsNull() && !plan.DesiredState.IsUnknown() {
+		return strings.EqualFold(plan.DesiredState.ValueString(), "RUNNING")
+	}
+	if state == nil {
+		return plan.StartOnCreate.ValueBool()
+	}
+	return strings.EqualFold(state.Status.ValueString(), "RUNNING")
+}
@@ -0,0 +1,637 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// vmDeviceTypes are the device types managed by the inline device lists of
+// truenas_vm, in the order new devices are created
+var vmDeviceTypes = []string{"NIC", "DISK", "CDROM", "DISPLAY", "PCI"}
+
+// vmDeviceIdentity is the attribute that identifies a device of each type
+// across plans. Display devices have none and are matched by position.
+var vmDeviceIdentity = map[string]string{
+	"NIC":   "mac",
+	"DISK":  "path",
+	"CDROM": "path",
+	"PCI":   "pptdev",
+}
+
+// vmDeviceCreateDefaults are the attributes sent for a new device when the
+// configuration leaves them unset
+var vmDeviceCreateDefaults = map[string]map[string]interface{}{
+	"NIC": {
+		"type":                   "VIRTIO",
+		"trust_guest_rx_filters": false,
+	},
+	"DISK": {
+		"type": "VIRTIO",
+	},
+}
+
+// firstVMDeviceOrder is the boot order given to the first device of a VM
+const firstVMDeviceOrder = 1000
+
+var vmNICDeviceAttrTypes = map[string]attr.Type{
+	"type":                   types.StringType,
+	"mac":                    types.StringType,
+	"nic_attach":             types.StringType,
+	"trust_guest_rx_filters": types.BoolType,
+	"order":                  types.Int64Type,
+}
+
+var vmDiskDeviceAttrTypes = map[string]attr.Type{
+	"path":                types.StringType,
+	"type":                types.StringType,
+	"iotype":              types.StringType,
+	"physical_sectorsize": types.Int64Type,
+	"logical_sectorsize":  types.Int64Type,
+	"order":               types.Int64Type,
+}
+
+var vmCDROMDeviceAttrTypes = map[string]attr.Type{
+	"path":  types.StringType,
+	"order": types.Int64Type,
+}
+
+var vmDisplayDeviceAttrTypes = map[string]attr.Type{
+	"port":       types.Int64Type,
+	"bind":       types.StringType,
+	"password":   types.StringType,
+	"web":        types.BoolType,
+	"type":       types.StringType,
+	"resolution": types.StringType,
+	"web_port":   types.Int64Type,
+	"wait":       types.BoolType,
+	"order":      types.Int64Type,
+}
+
+var vmPCIDeviceAttrTypes = map[string]attr.Type{
+	"pptdev": types.StringType,
+	"order":  types.Int64Type,
+}
+
+// vmDevice is a device of a VM as returned by GET /vm/id/{id}
+type vmDevice struct {
+	ID         int64
+	DType      string
+	Order      int64
+	Attributes map[string]interface{}
+}
+
+// key returns the identity of the device, or "" if its type has none
+func (d vmDevice) key() string {
+	field, ok := vmDeviceIdentity[d.DType]
+	if !ok {
+		return ""
+	}
+	key, _ := d.Attributes[field].(string)
+	return key
+}
+
+// plannedVMDevice is an entry of an inline device list. Attributes only
+// holds the values known in the plan, and Order is 0 when the order is
+// left to the provider. Key is "" when the entry has no known identity.
+type plannedVMDevice struct {
+	DType      string
+	Key        string
+	Order      int64
+	Attributes map[string]interface{}
+}
+
+// vmDeviceChange is a device create, update or delete request
+type vmDeviceChange struct {
+	DType  string
+	ID     int64
+	Params map[string]interface{}
+}
+
+// vmDeviceChanges are the requests that bring the devices of a VM in line
+// with its inline device lists
+type vmDeviceChanges struct {
+	Create []vmDeviceChange
+	Update []vmDeviceChange
+	Delete []vmDeviceChange
+}
+
+func (c vmDeviceChanges) empty() bool {
+	return len(c.Create) == 0 && len(c.Update) == 0 && len(c.Delete) == 0
+}
+
+// parseVMDevices returns the devices of a VM from its API representation
+func parseVMDevices(result map[string]interface{}) []vmDevice {
+	var devices []vmDevice
+
+	items, _ := result["devices"].([]interface{})
+	for _, item := range items {
+		deviceMap, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		device := vmDevice{}
+		if id, ok := deviceMap["id"].(float64); ok {
+			device.ID = int64(id)
+		}
+		device.DType, _ = deviceMap["dtype"].(string)
+		if order, ok := deviceMap["order"].(float64); ok {
+			device.Order = int64(order)
+		}
+		device.Attributes, _ = deviceMap["attributes"].(map[string]interface{})
+		if device.Attributes == nil {
+			device.Attributes = map[string]interface{}{}
+		}
+		devices = append(devices, device)
+	}
+
+	return devices
+}
+
+// managedVMDevices returns the devices of one type, or of all types if
+// dtype is "", leaving out the cloud-init ISO which is managed through the
+// cloud_init attribute
+func managedVMDevices(devices []vmDevice, dtype string, cloudInitPath string) []vmDevice {
+	var managed []vmDevice
+	for _, device := range devices {
+		if dtype != "" && device.DType != dtype {
+			continue
+		}
+		if device.DType == "CDROM" && cloudInitPath != "" && device.key() == cloudInitPath {
+			continue
+		}
+		managed = append(managed, device)
+	}
+	return managed
+}
+
+// cloudInitISOPath returns the path of the cloud-init ISO of a VM, or "" if
+// the VM has no cloud-init configuration
+func cloudInitISOPath(data *VMResourceModel) string {
+	cloudInit := data.seedConfig()
+	if cloudInit == nil || cloudInit.UploadPath.IsNull() || cloudInit.Filename.IsNull() {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s", strings.TrimRight(cloudInit.UploadPath.ValueString(), "/"), cloudInit.Filename.ValueString())
+}
+
+// vmDeviceList returns the inline device list of a device type
+func vmDeviceList(data *VMResourceModel, dtype string) types.List {
+	switch dtype {
+	case "NIC":
+		return data.NICDevices
+	case "DISK":
+		return data.DiskDevices
+	case "CDROM":
+		return data.CDROMDevices
+	case "DISPLAY":
+		return data.DisplayDevices
+	case "PCI":
+		return data.PCIDevices
+	}
+	return types.ListNull(types.ObjectType{})
+}
+
+// plannedVMDevices converts an inline device list into planned entries
+func plannedVMDevices(ctx context.Context, data *VMResourceModel, dtype string) ([]plannedVMDevice, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	list := vmDeviceList(data, dtype)
+	if list.IsNull() || list.IsUnknown() {
+		return nil, diags
+	}
+
+	var planned []plannedVMDevice
+	add := func(attributes map[string]interface{}, order types.Int64) {
+		entry := plannedVMDevice{
+			DType:      dtype,
+			Attributes: attributes,
+		}
+		if key, ok := attributes[vmDeviceIdentity[dtype]].(string); ok {
+			entry.Key = key
+		}
+		if v, ok := knownInt64(order); ok {
+			entry.Order = v
+		}
+		planned = append(planned, entry)
+	}
+
+	switch dtype {
+	case "NIC":
+		var nics []NICDeviceModel
+		diags.Append(list.ElementsAs(ctx, &nics, false)...)
+		for _, nic := range nics {
+			attributes := map[string]interface{}{}
+			setKnownString(attributes, "type", nic.Type)
+			setKnownString(attributes, "mac", nic.MAC)
+			setKnownString(attributes, "nic_attach", nic.NICAttach)
+			setKnownBool(attributes, "trust_guest_rx_filters", nic.TrustGuestRxFilters)
+			add(attributes, nic.Order)
+		}
+	case "DISK":
+		var disks []DiskDeviceModel
+		diags.Append(list.ElementsAs(ctx, &disks, false)...)
+		for _, disk := range disks {
+			attributes := map[string]interface{}{}
+			setKnownString(attributes, "path", disk.Path)
+			setKnownString(attributes, "type", disk.Type)
+			setKnownString(attributes, "iotype", disk.IOType)
+			setKnownInt64(attributes, "physical_sectorsize", disk.PhysicalSectorSize)
+			setKnownInt64(attributes, "logical_sectorsize", disk.LogicalSectorSize)
+			add(attributes, disk.Order)
+		}
+	case "CDROM":
+		var cdroms []CDROMDeviceModel
+		diags.Append(list.ElementsAs(ctx, &cdroms, false)...)
+		for _, cdrom := range cdroms {
+			attributes := map[string]interface{}{}
+			setKnownString(attributes, "path", cdrom.Path)
+			add(attributes, cdrom.Order)
+		}
+	case "DISPLAY":
+		var displays []DisplayDeviceModel
+		diags.Append(list.ElementsAs(ctx, &displays, false)...)
+		for _, display := range displays {
+			attributes := map[string]interface{}{}
+			setKnownInt64(attributes, "port", display.Port)
+			setKnownString(attributes, "bind", display.Bind)
+			setKnownString(attributes, "password", display.Password)
+			setKnownBool(attributes, "web", display.Web)
+			setKnownString(attributes, "type", display.Type)
+			setKnownString(attributes, "resolution", display.Resolution)
+			setKnownInt64(attributes, "web_port", display.WebPort)
+			setKnownBool(attributes, "wait", display.Wait)
+			add(attributes, display.Order)
+		}
+	case "PCI":
+		var pciDevices []PCIDeviceModel
+		diags.Append(list.ElementsAs(ctx, &pciDevices, false)...)
+		for _, pci := range pciDevices {
+			attributes := map[string]interface{}{}
+			setKnownString(attributes, "pptdev", pci.PPTDev)
+			add(attributes, pci.Order)
+		}
+	}
+
+	return planned, diags
+}
+
+func setKnownString(attributes map[string]interface{}, field string, v types.String) {
+	if !v.IsNull() && !v.IsUnknown() && v.ValueString() != "" {
+		attributes[field] = v.ValueString()
+	}
+}
+
+func setKnownInt64(attributes map[string]interface{}, field string, v types.Int64) {
+	if value, ok := knownInt64(v); ok {
+		attributes[field] = value
+	}
+}
+
+func setKnownBool(attributes map[string]interface{}, field string, v types.Bool) {
+	if !v.IsNull() && !v.IsUnknown() {
+		attributes[field] = v.ValueBool()
+	}
+}
+
+func knownInt64(v types.Int64) (int64, bool) {
+	if v.IsNull() || v.IsUnknown() || v.ValueInt64() <= 0 {
+		return 0, false
+	}
+	return v.ValueInt64(), true
+}
+
+// matchVMDevices pairs planned entries with existing devices of the same
+// type. Entries with a key are matched by it first, then the entries
+// without one take the remaining devices in order. It returns the index of
+// the matched device for each entry, -1 if there is none, and the devices
+// no entry matched.
+func matchVMDevices(planned []plannedVMDevice, current []vmDevice) ([]int, []vmDevice) {
+	matches := make([]int, len(planned))
+	used := make([]bool, len(current))
+
+	for i, entry := range planned {
+		matches[i] = -1
+		if entry.Key == "" {
+			continue
+		}
+		for j, device := range current {
+			if !used[j] && device.key() == entry.Key {
+				matches[i] = j
+				used[j] = true
+				break
+			}
+		}
+	}
+
+	next := 0
+	for i, entry := range planned {
+		if entry.Key != "" {
+			continue
+		}
+		for next < len(current) && used[next] {
+			next++
+		}
+		if next == len(current) {
+			break
+		}
+		matches[i] = next
+		used[next] = true
+	}
+
+	var unmatched []vmDevice
+	for j, device := range current {
+		if !used[j] {
+			unmatched = append(unmatched, device)
+		}
+	}
+
+	return matches, unmatched
+}
+
+// diffVMDevices works out the requests that turn the current devices of one
+// type into the planned ones. New devices without an order take the next
+// value of nextOrder.
+func diffVMDevices(planned []plannedVMDevice, current []vmDevice, nextOrder *int64) vmDeviceChanges {
+	var changes vmDeviceChanges
+
+	matches, unmatched := matchVMDevices(planned, current)
+	for i, entry := range planned {
+		if matches[i] < 0 {
+			attributes := map[string]interface{}{}
+			for k, v := range vmDeviceCreateDefaults[entry.DType] {
+				attributes[k] = v
+			}
+			for k, v := range entry.Attributes {
+				attributes[k] = v
+			}
+
+			order := *nextOrder
+			if entry.Order > 0 {
+				order = entry.Order
+			}
+			*nextOrder++
+
+			changes.Create = append(changes.Create, vmDeviceChange{
+				DType: entry.DType,
+				Params: map[string]interface{}{
+					"dtype":      entry.DType,
+					"order":      order,
+					"attributes": attributes,
+				},
+			})
+			continue
+		}
+
+		device := current[matches[i]]
+		attributes := map[string]interface{}{}
+		for k, v := range device.Attributes {
+			attributes[k] = v
+		}
+		for k, v := range entry.Attributes {
+			attributes[k] = v
+		}
+
+		params := map[string]interface{}{}
+		if !sameJSON(attributes, device.Attributes) {
+			params["attributes"] = attributes
+		}
+		if entry.Order > 0 && entry.Order != device.Order {
+			params["order"] = entry.Order
+		}
+		if len(params) > 0 {
+			changes.Update = append(changes.Update, vmDeviceChange{
+				DType:  entry.DType,
+				ID:     device.ID,
+				Params: params,
+			})
+		}
+	}
+
+	for _, device := range unmatched {
+		changes.Delete = append(changes.Delete, vmDeviceChange{
+			DType: device.DType,
+			ID:    device.ID,
+		})
+	}
+
+	return changes
+}
+
+// sameJSON reports whether two values encode to the same JSON, which
+// compares API numbers with the integers of the plan
+func sameJSON(a, b interface{}) bool {
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(aJSON) == string(bJSON)
+}
+
+// planVMDeviceChanges works out the changes for every inline device list
+// that is set in data. Device types whose list is null are left alone, so
+// that they can be managed with truenas_vm_device instead.
+func planVMDeviceChanges(ctx context.Context, data *VMResourceModel, devices []vmDevice, nextOrder int64) (vmDeviceChanges, diag.Diagnostics) {
+	var changes vmDeviceChanges
+	var diags diag.Diagnostics
+
+	cloudInitPath := cloudInitISOPath(data)
+	for _, dtype := range vmDeviceTypes {
+		list := vmDeviceList(data, dtype)
+		if list.IsNull() || list.IsUnknown() {
+			continue
+		}
+
+		planned, d := plannedVMDevices(ctx, data, dtype)
+		diags.Append(d...)
+		if diags.HasError() {
+			return changes, diags
+		}
+
+		typeChanges := diffVMDevices(planned, managedVMDevices(devices, dtype, cloudInitPath), &nextOrder)
+		changes.Create = append(changes.Create, typeChanges.Create...)
+		changes.Update = append(changes.Update, typeChanges.Update...)
+		changes.Delete = append(changes.Delete, typeChanges.Delete...)
+	}
+
+	return changes, diags
+}
+
+// applyVMDeviceChanges sends the device requests. Deletes go first so that
+// the ports and PCI devices they hold are free for new devices.
+func (r *VMResource) applyVMDeviceChanges(ctx context.Context, vmID string, changes vmDeviceChanges, diags *diag.Diagnostics) {
+	for _, change := range changes.Delete {
+		if _, err := r.client.DeleteVMDevice(ctx, strconv.FormatInt(change.ID, 10)); err != nil {
+			diags.AddError("Device Deletion Error", fmt.Sprintf("Unable to delete %s device %d: %s", change.DType, change.ID, err))
+			return
+		}
+	}
+
+	for _, change := range changes.Update {
+		if _, err := r.client.UpdateVMDevice(ctx, strconv.FormatInt(change.ID, 10), change.Params); err != nil {
+			diags.AddError("Device Update Error", fmt.Sprintf("Unable to update %s device %d: %s", change.DType, change.ID, err))
+			return
+		}
+	}
+
+	for _, change := range changes.Create {
+		deviceReq := map[string]interface{}{"vm": vmID}
+		for k, v := range change.Params {
+			deviceReq[k] = v
+		}
+		if attributes, ok := change.Params["attributes"].(map[string]interface{}); ok && change.DType == "DISPLAY" {
+			if err := allocateDisplayPorts(ctx, r.client, attributes); err != nil {
+				diags.AddError("Device Creation Error", fmt.Sprintf("Unable to create %s device: %s", change.DType, err))
+				return
+			}
+		}
+		if _, err := r.client.CreateVMDevice(ctx, deviceReq); err != nil {
+			diags.AddError("Device Creation Error", fmt.Sprintf("Unable to create %s device: %s", change.DType, err))
+			return
+		}
+	}
+}
+
+// readVMDeviceList sets the inline device list of one type from the
+// devices of the VM. The devices are listed in the order of the entries
+// they match in the prior list, followed by any new ones.
+func readVMDeviceList(ctx context.Context, data *VMResourceModel, dtype string, devices []vmDevice) diag.Diagnostics {
+	prior, diags := plannedVMDevices(ctx, data, dtype)
+	if diags.HasError() {
+		return diags
+	}
+
+	matches, unmatched := matchVMDevices(prior, devices)
+	ordered := make([]vmDevice, 0, len(devices))
+	for _, match := range matches {
+		if match >= 0 {
+			ordered = append(ordered, devices[match])
+		}
+	}
+	ordered = append(ordered, unmatched...)
+
+	var list types.List
+	var d diag.Diagnostics
+	switch dtype {
+	case "NIC":
+		nics := make([]NICDeviceModel, 0, len(ordered))
+		for _, device := range ordered {
+			nics = append(nics, nicDeviceModel(device))
+		}
+		list, d = types.ListValueFrom(ctx, types.ObjectType{AttrTypes: vmNICDeviceAttrTypes}, nics)
+	case "DISK":
+		disks := make([]DiskDeviceModel, 0, len(ordered))
+		for _, device := range ordered {
+			disks = append(disks, diskDeviceModel(device))
+		}
+		list, d = types.ListValueFrom(ctx, types.ObjectType{AttrTypes: vmDiskDeviceAttrTypes}, disks)
+	case "CDROM":
+		cdroms := make([]CDROMDeviceModel, 0, len(ordered))
+		for _, device := range ordered {
+			cdroms = append(cdroms, CDROMDeviceModel{
+				Path:  deviceString(device, "path"),
+				Order: types.Int64Value(device.Order),
+			})
+		}
+		list, d = types.ListValueFrom(ctx, types.ObjectType{AttrTypes: vmCDROMDeviceAttrTypes}, cdroms)
+	case "DISPLAY":
+		displays := make([]DisplayDeviceModel, 0, len(ordered))
+		for _, device := range ordered {
+			displays = append(displays, displayDeviceModel(device))
+		}
+		list, d = types.ListValueFrom(ctx, types.ObjectType{AttrTypes: vmDisplayDeviceAttrTypes}, displays)
+	case "PCI":
+		pciDevices := make([]PCIDeviceModel, 0, len(ordered))
+		for _, device := range ordered {
+			pciDevices = append(pciDevices, PCIDeviceModel{
+				PPTDev: deviceString(device, "pptdev"),
+				Order:  types.Int64Value(device.Order),
+			})
+		}
+		list, d = types.ListValueFrom(ctx, types.ObjectType{AttrTypes: vmPCIDeviceAttrTypes}, pciDevices)
+	}
+	diags.Append(d...)
+	if diags.HasError() {
+		return diags
+	}
+
+	switch dtype {
+	case "NIC":
+		data.NICDevices = list
+	case "DISK":
+		data.DiskDevices = list
+	case "CDROM":
+		data.CDROMDevices = list
+	case "DISPLAY":
+		data.DisplayDevices = list
+	case "PCI":
+		data.PCIDevices = list
+	}
+
+	return diags
+}
+
+func nicDeviceModel(device vmDevice) NICDeviceModel {
+	nic := NICDeviceModel{
+		Type:                deviceString(device, "type"),
+		MAC:                 deviceString(device, "mac"),
+		NICAttach:           deviceString(device, "nic_attach"),
+		TrustGuestRxFilters: deviceBool(device, "trust_guest_rx_filters"),
+		Order:               types.Int64Value(device.Order),
+	}
+	if nic.MAC.ValueString() == "" {
+		nic.MAC = types.StringNull()
+	}
+	return nic
+}
+
+func diskDeviceModel(device vmDevice) DiskDeviceModel {
+	return DiskDeviceModel{
+		Path:               deviceString(device, "path"),
+		Type:               deviceString(device, "type"),
+		IOType:             deviceString(device, "iotype"),
+		PhysicalSectorSize: deviceInt64(device, "physical_sectorsize"),
+		LogicalSectorSize:  deviceInt64(device, "logical_sectorsize"),
+		Order:              types.Int64Value(device.Order),
+	}
+}
+
+func displayDeviceModel(device vmDevice) DisplayDeviceModel {
+	return DisplayDeviceModel{
+		Port:       deviceInt64(device, "port"),
+		Bind:       deviceString(device, "bind"),
+		Password:   deviceString(device, "password"),
+		Web:        deviceBool(device, "web"),
+		Type:       deviceString(device, "type"),
+		Resolution: deviceString(device, "resolution"),
+		WebPort:    deviceInt64(device, "web_port"),
+		Wait:       deviceBool(device, "wait"),
+		Order:      types.Int64Value(device.Order),
+	}
+}
+
+func deviceString(device vmDevice, field string) types.String {
+	if v, ok := device.Attributes[field].(string); ok {
+		return types.StringValue(v)
+	}
+	return types.StringNull()
+}
+
+func deviceInt64(device vmDevice, field string) types.Int64 {
+	if v, ok := device.Attributes[field].(float64); ok {
+		return types.Int64Value(int64(v))
+	}
+	return types.Int64Null()
+}
+
+func deviceBool(device vmDevice, field string) types.Bool {
+	if v, ok := device.Attributes[field].(bool); ok {
+		return types.BoolValue(v)
+	}
+	return types.BoolNull()
+}
@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchVMDevices_ByKeyThenPosition(t *testing.T) {
+	current := []vmDevice{
+		{ID: 1, DType: "NIC", Attributes: map[string]interface{}{"mac": "00:a0:98:00:00:01"}},
+		{ID: 2, DType: "NIC", Attributes: map[string]interface{}{"mac": "00:a0:98:00:00:02"}},
+		{ID: 3, DType: "NIC", Attributes: map[string]interface{}{"mac": "00:a0:98:00:00:03"}},
+	}
+	planned := []plannedVMDevice{
+		{DType: "NIC"},
+		{DType: "NIC", Key: "00:a0:98:00:00:02"},
+	}
+
+	matches, unmatched := matchVMDevices(planned, current)
+
+	// The keyed entry takes its device, the other one the first device left
+	assert.Equal(t, []int{0, 1}, matches)
+	assert.Len(t, unmatched, 1)
+	assert.Equal(t, int64(3), unmatched[0].ID)
+}
+
+func TestMatchVMDevices_UnknownKeyIsNotMatched(t *testing.T) {
+	current := []vmDevice{
+		{ID: 1, DType: "DISK", Attributes: map[string]interface{}{"path": "/dev/zvol/tank/a"}},
+	}
+	planned := []plannedVMDevice{
+		{DType: "DISK", Key: "/dev/zvol/tank/b"},
+	}
+
+	matches, unmatched := matchVMDevices(planned, current)
+
+	assert.Equal(t, []int{-1}, matches)
+	assert.Len(t, unmatched, 1)
+}
+
+func TestDiffVMDevices_CreateUpdateDelete(t *testing.T) {
+	current := []vmDevice{
+		{ID: 1, DType: "DISK", Order: 1001, Attributes: map[string]interface{}{"path": "/dev/zvol/tank/a", "type": "VIRTIO", "logical_sectorsize": float64(512)}},
+		{ID: 2, DType: "DISK", Order: 1002, Attributes: map[string]interface{}{"path": "/dev/zvol/tank/b", "type": "VIRTIO"}},
+	}
+	planned := []plannedVMDevice{
+		{DType: "DISK", Key: "/dev/zvol/tank/a", Attributes: map[string]interface{}{"path": "/dev/zvol/tank/a", "logical_sectorsize": int64(512)}},
+		{DType: "DISK", Key: "/dev/zvol/tank/b", Attributes: map[string]interface{}{"path": "/dev/zvol/tank/b", "type": "AHCI"}},
+		{DType: "DISK", Key: "/dev/zvol/tank/c", Attributes: map[string]interface{}{"path": "/dev/zvol/tank/c"}},
+	}
+	nextOrder := int64(1003)
+
+	changes := diffVMDevices(planned, current, &nextOrder)
+
+	// Disk a is unchanged, since the planned integer matches the API number
+	assert.Len(t, changes.Update, 1)
+	assert.Equal(t, int64(2), changes.Update[0].ID)
+	assert.Equal(t, "AHCI", changes.Update[0].Params["attributes"].(map[string]interface{})["type"])
+	assert.NotContains(t, changes.Update[0].Params, "order")
+
+	assert.Len(t, changes.Create, 1)
+	assert.Equal(t, int64(1003), changes.Create[0].Params["order"])
+	assert.Equal(t, "VIRTIO", changes.Create[0].Params["attributes"].(map[string]interface{})["type"])
+	assert.Equal(t, int64(1004), nextOrder)
+
+	assert.Empty(t, changes.Delete)
+}
+
+func TestDiffVMDevices_OrderChange(t *testing.T) {
+	current := []vmDevice{
+		{ID: 7, DType: "CDROM", Order: 1002, Attributes: map[string]interface{}{"path": "/mnt/tank/isos/a.iso"}},
+	}
+	planned := []plannedVMDevice{
+		{DType: "CDROM", Key: "/mnt/tank/isos/a.iso", Order: 999, Attributes: map[string]interface{}{"path": "/mnt/tank/isos/a.iso"}},
+	}
+	nextOrder := int64(1003)
+
+	changes := diffVMDevices(planned, current, &nextOrder)
+
+	assert.Len(t, changes.Update, 1)
+	assert.Equal(t, int64(999), changes.Update[0].Params["order"])
+	assert.NotContains(t, changes.Update[0].Params, "attributes")
+}
+
+func TestDiffVMDevices_RemovedEntriesAreDeleted(t *testing.T) {
+	current := []vmDevice{
+		{ID: 4, DType: "DISPLAY", Attributes: map[string]interface{}{"type": "SPICE", "port": float64(5900)}},
+		{ID: 5, DType: "DISPLAY", Attributes: map[string]interface{}{"type": "VNC", "port": float64(5901)}},
+	}
+	planned := []plannedVMDevice{
+		{DType: "DISPLAY", Attributes: map[string]interface{}{"type": "SPICE"}},
+	}
+	nextOrder := int64(1000)
+
+	changes := diffVMDevices(planned, current, &nextOrder)
+
+	assert.Empty(t, changes.Create)
+	assert.Empty(t, changes.Update)
+	assert.Len(t, changes.Delete, 1)
+	assert.Equal(t, int64(5), changes.Delete[0].ID)
+}
+
+func TestManagedVMDevices_SkipsCloudInitISO(t *testing.T) {
+	devices := []vmDevice{
+		{ID: 1, DType: "CDROM", Attributes: map[string]interface{}{"path": "/mnt/tank/isos/cloud-init-web.iso"}},
+		{ID: 2, DType: "CDROM", Attributes: map[string]interface{}{"path": "/mnt/tank/isos/debian.iso"}},
+		{ID: 3, DType: "NIC", Attributes: map[string]interface{}{}},
+	}
+
+	managed := managedVMDevices(devices, "CDROM", "/mnt/tank/isos/cloud-init-web.iso")
+
+	assert.Len(t, managed, 1)
+	assert.Equal(t, int64(2), managed[0].ID)
+	assert.Len(t, managedVMDevices(devices, "", "/mnt/tank/isos/cloud-init-web.iso"), 2)
+}
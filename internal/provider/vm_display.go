@@ -0,0 +1,200 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+)
+
+// vmDisplayAttrTypes are the attributes of the displays reported by
+// truenas_vm
+var vmDisplayAttrTypes = map[string]attr.Type{
+	"id":                types.Int64Type,
+	"type":              types.StringType,
+	"port":              types.Int64Type,
+	"web_port":          types.Int64Type,
+	"web_uri":           types.StringType,
+	"remote_viewer_uri": types.StringType,
+}
+
+// VMDisplayModel describes how to connect to a display device of a VM
+type VMDisplayModel struct {
+	ID              types.Int64  `tfsdk:"id"`
+	Type            types.String `tfsdk:"type"`
+	Port            types.Int64  `tfsdk:"port"`
+	WebPort         types.Int64  `tfsdk:"web_port"`
+	WebURI          types.String `tfsdk:"web_uri"`
+	RemoteViewerURI types.String `tfsdk:"remote_viewer_uri"`
+}
+
+// vmDisplay is a display device with the URIs to connect to it
+type vmDisplay struct {
+	device vmDevice
+	// webURI is the URI of the web client, empty when web access is off
+	webURI string
+	// remoteViewerURI is the spice:// or vnc:// URI for remote-viewer
+	remoteViewerURI string
+}
+
+// readVMDisplays returns the display devices of a VM and the URIs to
+// connect to them. host is the address of the TrueNAS system the URIs
+// point to; it defaults to the host of the provider's URL.
+func readVMDisplays(ctx context.Context, client *truenas.Client, vmID, host string) ([]vmDisplay, error) {
+	respBody, err := client.GetVMDisplayDevices(ctx, vmID)
+	if err != nil {
+		return nil, fmt.Errorf("reading display devices: %w", err)
+	}
+
+	var items []interface{}
+	if err := json.Unmarshal(respBody, &items); err != nil {
+		return nil, fmt.Errorf("parsing display devices: %w", err)
+	}
+	return vmDisplays(ctx, client, vmID, host, parseVMDevices(map[string]interface{}{"devices": items}))
+}
+
+// vmDisplays returns the URIs to connect to the display devices of a VM
+func vmDisplays(ctx context.Context, client *truenas.Client, vmID, host string, devices []vmDevice) ([]vmDisplay, error) {
+	if len(devices) == 0 {
+		return nil, nil
+	}
+
+	defaultHost, scheme := displayHost(client)
+	if host == "" {
+		host = defaultHost
+	}
+	protocol := "HTTPS"
+	if scheme == "http" {
+		protocol = "HTTP"
+	}
+
+	webURIs := map[string]struct {
+		Error *string `json:"error"`
+		URI   *string `json:"uri"`
+	}{}
+	if hasWebDisplay(devices) {
+		respBody, err := client.GetVMDisplayWebURIs(ctx, vmID, host, protocol)
+		if err != nil {
+			return nil, fmt.Errorf("reading display web URIs: %w", err)
+		}
+		if err := json.Unmarshal(respBody, &webURIs); err != nil {
+			return nil, fmt.Errorf("parsing display web URIs: %w", err)
+		}
+	}
+
+	displays := make([]vmDisplay, 0, len(devices))
+	for _, device := range devices {
+		display := vmDisplay{
+			device:          device,
+			remoteViewerURI: remoteViewerURI(device, host),
+		}
+		if uri, ok := webURIs[strconv.FormatInt(device.ID, 10)]; ok && uri.URI != nil {
+			display.webURI = *uri.URI
+		}
+		displays = append(displays, display)
+	}
+	return displays, nil
+}
+
+// hasWebDisplay reports whether any display device has web access enabled
+func hasWebDisplay(devices []vmDevice) bool {
+	for _, device := range devices {
+		if web, _ := device.Attributes["web"].(bool); web {
+			return true
+		}
+	}
+	return false
+}
+
+// displayHost returns the host and scheme of the provider's URL
+func displayHost(client *truenas.Client) (string, string) {
+	u, err := url.Parse(client.BaseURL)
+	if err != nil {
+		return "", ""
+	}
+	return u.Hostname(), strings.ToLower(u.Scheme)
+}
+
+// remoteViewerURI returns the URI remote-viewer connects to a display
+// with. Displays bound to every address are reached through host.
+func remoteViewerURI(device vmDevice, host string) string {
+	port, ok := device.Attributes["port"].(float64)
+	if !ok || port <= 0 {
+		return ""
+	}
+
+	bind, _ := device.Attributes["bind"].(string)
+	if bind == "" || bind == "0.0.0.0" || bind == "::" {
+		bind = host
+	}
+
+	scheme := "spice"
+	if displayType, _ := device.Attributes["type"].(string); strings.EqualFold(displayType, "VNC") {
+		scheme = "vnc"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(bind, strconv.FormatInt(int64(port), 10)))
+}
+
+// vmDisplayModels converts displays to the displays attribute of truenas_vm
+func vmDisplayModels(ctx context.Context, displays []vmDisplay) (types.List, error) {
+	models := make([]VMDisplayModel, 0, len(displays))
+	for _, display := range displays {
+		models = append(models, VMDisplayModel{
+			ID:              types.Int64Value(display.device.ID),
+			Type:            deviceString(display.device, "type"),
+			Port:            deviceInt64(display.device, "port"),
+			WebPort:         deviceInt64(display.device, "web_port"),
+			WebURI:          optionalString(display.webURI),
+			RemoteViewerURI: optionalString(display.remoteViewerURI),
+		})
+	}
+
+	list, diags := types.ListValueFrom(ctx, types.ObjectType{AttrTypes: vmDisplayAttrTypes}, models)
+	if diags.HasError() {
+		return list, fmt.Errorf("converting displays: %v", diags)
+	}
+	return list, nil
+}
+
+// allocateDisplayPorts fills in the ports of a new display device left
+// unset with free ones from /vm/port_wizard, so that displays of different
+// VMs do not collide on the same port
+func allocateDisplayPorts(ctx context.Context, client *truenas.Client, attributes map[string]interface{}) error {
+	if _, ok := attributes["port"]; ok {
+		return nil
+	}
+
+	respBody, err := client.VMPortWizard(ctx)
+	if err != nil {
+		return fmt.Errorf("allocating display ports: %w", err)
+	}
+
+	var ports struct {
+		Port int64 `json:"port"`
+		Web  int64 `json:"web"`
+	}
+	if err := json.Unmarshal(respBody, &ports); err != nil {
+		return fmt.Errorf("parsing display ports: %w", err)
+	}
+
+	attributes["port"] = ports.Port
+	if _, ok := attributes["web_port"]; !ok && ports.Web > 0 && ports.Web != ports.Port {
+		attributes["web_port"] = ports.Web
+	}
+	return nil
+}
+
+// optionalString returns a null string for an empty value
+func optionalString(v string) types.String {
+	if v == "" {
+		return types.StringNull()
+	}
+	return types.StringValue(v)
+}
@@ -0,0 +1,287 @@
+package truenas
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// ACL types reported and accepted by the filesystem ACL endpoints
+const (
+	ACLTypeNFS4     = "NFS4"
+	ACLTypePOSIX1E  = "POSIX1E"
+	ACLTypeDisabled = "DISABLED"
+)
+
+// NFS4Perms are the advanced permissions of NFSv4 entries
+var NFS4Perms = []string{
+	"READ_DATA", "WRITE_DATA", "APPEND_DATA", "READ_NAMED_ATTRS", "WRITE_NAMED_ATTRS", "EXECUTE", "DELETE_CHILD",
+	"READ_ATTRIBUTES", "WRITE_ATTRIBUTES", "DELETE", "READ_ACL", "WRITE_ACL", "WRITE_OWNER", "SYNCHRONIZE",
+}
+
+// NFS4Flags are the advanced inheritance flags of NFSv4 entries
+var NFS4Flags = []string{"FILE_INHERIT", "DIRECTORY_INHERIT", "NO_PROPAGATE_INHERIT", "INHERIT_ONLY", "INHERITED"}
+
+// NFS4BasicPerms are the advanced permissions each basic NFSv4 permission
+// set stands for
+var NFS4BasicPerms = map[string][]string{
+	"FULL_CONTROL": NFS4Perms,
+	"MODIFY": {
+		"READ_DATA", "WRITE_DATA", "APPEND_DATA", "READ_NAMED_ATTRS", "WRITE_NAMED_ATTRS", "EXECUTE", "DELETE_CHILD",
+		"READ_ATTRIBUTES", "WRITE_ATTRIBUTES", "DELETE", "READ_ACL", "SYNCHRONIZE",
+	},
+	"READ":     {"READ_DATA", "READ_NAMED_ATTRS", "EXECUTE", "READ_ATTRIBUTES", "READ_ACL", "SYNCHRONIZE"},
+	"TRAVERSE": {"READ_NAMED_ATTRS", "EXECUTE", "READ_ATTRIBUTES", "READ_ACL", "SYNCHRONIZE"},
+}
+
+// NFS4BasicFlags are the advanced flags each basic NFSv4 flag set stands for
+var NFS4BasicFlags = map[string][]string{
+	"INHERIT":   {"FILE_INHERIT", "DIRECTORY_INHERIT"},
+	"NOINHERIT": {},
+}
+
+// POSIX1EPerms are the permissions of POSIX.1e entries
+var POSIX1EPerms = []string{"READ", "WRITE", "EXECUTE"}
+
+// ACL is the access control list of a path, as returned by
+// /filesystem/getacl
+type ACL struct {
+	Path string `json:"path"`
+	// Trivial is true when the ACL only reflects the mode of the path
+	Trivial bool   `json:"trivial"`
+	UID     *int64 `json:"uid"`
+	GID     *int64 `json:"gid"`
+	// ACLType is NFS4, POSIX1E or DISABLED
+	ACLType string     `json:"acltype"`
+	Entries []ACLEntry `json:"acl"`
+}
+
+// ACLEntry is an NFSv4 or POSIX.1e access control entry. Perms and Flags
+// map permissions and inheritance flags to whether they are set; NFSv4
+// entries may instead name a basic set under the BASIC key.
+type ACLEntry struct {
+	// Tag is owner@, group@, everyone@, USER or GROUP for NFSv4 entries,
+	// and USER_OBJ, GROUP_OBJ, OTHER, MASK, USER or GROUP for POSIX.1e
+	Tag string `json:"tag"`
+	// ID is the uid or gid of USER and GROUP entries. It is null for other
+	// NFSv4 entries and -1 for other POSIX.1e entries.
+	ID *int64 `json:"id"`
+	// Who is the name of the user or group of USER and GROUP entries, as
+	// an alternative to ID
+	Who   *string                `json:"who,omitempty"`
+	Perms map[string]interface{} `json:"perms"`
+	// Type is ALLOW or DENY, for NFSv4 entries
+	Type  string                 `json:"type,omitempty"`
+	Flags map[string]interface{} `json:"flags,omitempty"`
+	// Default marks the POSIX.1e entries new files and directories inherit
+	Default *bool `json:"default,omitempty"`
+}
+
+// ACLOptions control how SetFilesystemACL applies an ACL
+type ACLOptions struct {
+	// StripACL removes the ACL, leaving the permissions of the mode
+	StripACL bool
+	// Recursive applies the ACL to the contents of a directory, and
+	// Traverse also to the child datasets mounted below it
+	Recursive bool
+	Traverse  bool
+	// Canonicalize sorts NFSv4 entries into the order Windows expects
+	Canonicalize bool
+}
+
+// GetFilesystemACL returns the ACL of a path on the TrueNAS system. NFSv4
+// permissions and flags are returned in their advanced form, and the
+// entries of users and groups carry their names.
+func (c *Client) GetFilesystemACL(ctx context.Context, path string) (*ACL, error) {
+	respBody, err := c.PostIdempotent(ctx, "/filesystem/getacl", map[string]interface{}{
+		"path":        path,
+		"simplified":  false,
+		"resolve_ids": true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var acl ACL
+	if err := json.Unmarshal(respBody, &acl); err != nil {
+		return nil, fmt.Errorf("error unmarshaling ACL of %s: %w", path, err)
+	}
+	return &acl, nil
+}
+
+// SetFilesystemACL sets the ACL and, when UID or GID are set, the owner of
+// acl.Path through filesystem.setacl, and waits for the job to finish
+func (c *Client) SetFilesystemACL(ctx context.Context, acl ACL, options ACLOptions) error {
+	entries := acl.Entries
+	if entries == nil {
+		entries = []ACLEntry{}
+	}
+	data := map[string]interface{}{
+		"path":    acl.Path,
+		"dacl":    entries,
+		"acltype": acl.ACLType,
+		"options": map[string]interface{}{
+			"stripacl":     options.StripACL,
+			"recursive":    options.Recursive,
+			"traverse":     options.Traverse,
+			"canonicalize": options.Canonicalize,
+		},
+	}
+	if acl.UID != nil {
+		data["uid"] = *acl.UID
+	}
+	if acl.GID != nil {
+		data["gid"] = *acl.GID
+	}
+
+	_, err := c.PostJob(ctx, "/filesystem/setacl", data)
+	return err
+}
+
+// ChownFile changes the owner of a path on the TrueNAS system through
+// filesystem.chown, and waits for the job to finish. perm.Mode and
+// perm.StripACL are ignored.
+func (c *Client) ChownFile(ctx context.Context, path string, perm FilePermissions) error {
+	data := map[string]interface{}{
+		"path": path,
+		"options": map[string]interface{}{
+			"recursive": perm.Recursive,
+			"traverse":  perm.Traverse,
+		},
+	}
+	if perm.UID != nil {
+		data["uid"] = *perm.UID
+	}
+	if perm.GID != nil {
+		data["gid"] = *perm.GID
+	}
+
+	_, err := c.PostJob(ctx, "/filesystem/chown", data)
+	return err
+}
+
+// SetDatasetPermission changes the permissions and ownership of the
+// mountpoint of a dataset through pool.dataset.permission, and waits for
+// the job to finish
+func (c *Client) SetDatasetPermission(ctx context.Context, id string, perm FilePermissions) error {
+	data := permissionData(perm)
+	endpoint := fmt.Sprintf("/pool/dataset/id/%s/permission", url.PathEscape(id))
+	_, err := c.PostJob(ctx, endpoint, data)
+	return err
+}
+
+// ACLTemplate is a named ACL that can be applied to paths of its ACL type,
+// as returned by /filesystem/acltemplate
+type ACLTemplate struct {
+	ID int64 `json:"id"`
+	// Builtin is true for the templates TrueNAS ships, which cannot be
+	// changed or deleted
+	Builtin bool       `json:"builtin"`
+	Name    string     `json:"name"`
+	ACLType string     `json:"acltype"`
+	Comment string     `json:"comment"`
+	Entries []ACLEntry `json:"acl"`
+}
+
+// ACLTemplateFormat controls how /filesystem/acltemplate/by_path formats
+// the entries of the templates it returns
+type ACLTemplateFormat struct {
+	// Canonicalize sorts NFSv4 entries into the order Windows expects. It
+	// cannot be used with a POSIX1E path.
+	Canonicalize bool
+	// EnsureBuiltins adds entries for the builtin_users and
+	// builtin_administrators groups when the template has none
+	EnsureBuiltins bool
+	// ResolveNames sets the who of USER and GROUP entries. It requires a
+	// path.
+	ResolveNames bool
+}
+
+// templateData returns the create and update body of an ACL template
+func templateData(template ACLTemplate) map[string]interface{} {
+	entries := template.Entries
+	if entries == nil {
+		entries = []ACLEntry{}
+	}
+	return map[string]interface{}{
+		"name":    template.Name,
+		"acltype": template.ACLType,
+		"comment": template.Comment,
+		"acl":     entries,
+	}
+}
+
+// CreateACLTemplate creates an ACL template and returns it
+func (c *Client) CreateACLTemplate(ctx context.Context, template ACLTemplate) (*ACLTemplate, error) {
+	respBody, err := c.Post(ctx, "/filesystem/acltemplate", templateData(template))
+	if err != nil {
+		return nil, err
+	}
+	return parseACLTemplate(respBody)
+}
+
+// GetACLTemplate returns the ACL template with the given ID
+func (c *Client) GetACLTemplate(ctx context.Context, id string) (*ACLTemplate, error) {
+	respBody, err := c.Get(ctx, fmt.Sprintf("/filesystem/acltemplate/id/%s", id))
+	if err != nil {
+		return nil, err
+	}
+	return parseACLTemplate(respBody)
+}
+
+// UpdateACLTemplate replaces the name, ACL type, comment and entries of an
+// ACL template
+func (c *Client) UpdateACLTemplate(ctx context.Context, id string, template ACLTemplate) (*ACLTemplate, error) {
+	respBody, err := c.Put(ctx, fmt.Sprintf("/filesystem/acltemplate/id/%s", id), templateData(template))
+	if err != nil {
+		return nil, err
+	}
+	return parseACLTemplate(respBody)
+}
+
+// DeleteACLTemplate deletes an ACL template
+func (c *Client) DeleteACLTemplate(ctx context.Context, id string) error {
+	_, err := c.Delete(ctx, fmt.Sprintf("/filesystem/acltemplate/id/%s", id))
+	return err
+}
+
+// ListACLTemplatesByPath returns the ACL templates matching filters, such
+// as [["name", "=", "NFS4_RESTRICTED"]]. With a path, only the templates
+// of its ACL type are returned, and none when ACLs are disabled on it.
+func (c *Client) ListACLTemplatesByPath(ctx context.Context, path string, filters []interface{}, format ACLTemplateFormat) ([]ACLTemplate, error) {
+	if filters == nil {
+		filters = []interface{}{}
+	}
+	data := map[string]interface{}{
+		"query-filters": filters,
+		"format-options": map[string]interface{}{
+			"canonicalize":    format.Canonicalize,
+			"ensure_builtins": format.EnsureBuiltins,
+			"resolve_names":   format.ResolveNames,
+		},
+	}
+	if path != "" {
+		data["path"] = path
+	}
+
+	respBody, err := c.PostIdempotent(ctx, "/filesystem/acltemplate/by_path", data)
+	if err != nil {
+		return nil, err
+	}
+
+	var templates []ACLTemplate
+	if err := json.Unmarshal(respBody, &templates); err != nil {
+		return nil, fmt.Errorf("error unmarshaling ACL templates: %w", err)
+	}
+	return templates, nil
+}
+
+// parseACLTemplate decodes an ACL template returned by the API
+func parseACLTemplate(respBody []byte) (*ACLTemplate, error) {
+	var template ACLTemplate
+	if err := json.Unmarshal(respBody, &template); err != nil {
+		return nil, fmt.Errorf("error unmarshaling ACL template: %w", err)
+	}
+	return &template, nil
+}
@@ -0,0 +1,174 @@
+package truenas
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultTokenTTL is the lifetime requested for session tokens
+const defaultTokenTTL = 10 * time.Minute
+
+// Authenticator adds credentials to outgoing API requests
+type Authenticator interface {
+	Authenticate(ctx context.Context, req *http.Request) error
+}
+
+// refreshableAuthenticator is implemented by authenticators whose
+// credentials can expire; Invalidate is called when the API answers 401 so
+// the next Authenticate fetches fresh credentials
+type refreshableAuthenticator interface {
+	Authenticator
+	Invalidate()
+}
+
+// clientBoundAuthenticator is implemented by authenticators that need to
+// call the API themselves, e.g. to exchange credentials for a token
+type clientBoundAuthenticator interface {
+	bind(c *Client)
+}
+
+// rpcAuthenticator is implemented by authenticators that can log in a
+// WebSocket session, returning the login method and its parameters
+type rpcAuthenticator interface {
+	rpcLogin() (string, []interface{})
+}
+
+// WithAuthenticator sets how the client authenticates its requests,
+// replacing API key authentication
+func WithAuthenticator(auth Authenticator) ClientOption {
+	return func(c *Client) error {
+		if auth == nil {
+			return fmt.Errorf("authenticator cannot be nil")
+		}
+		if bound, ok := auth.(clientBoundAuthenticator); ok {
+			bound.bind(c)
+		}
+		c.Authenticator = auth
+		return nil
+	}
+}
+
+// APIKeyAuth authenticates with a TrueNAS API key
+type APIKeyAuth struct {
+	Key string
+}
+
+// Authenticate sets the bearer token header
+func (a *APIKeyAuth) Authenticate(ctx context.Context, req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+a.Key)
+	return nil
+}
+
+func (a *APIKeyAuth) rpcLogin() (string, []interface{}) {
+	return "auth.login_with_api_key", []interface{}{a.Key}
+}
+
+// BasicAuth authenticates with a username and password on every request
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// Authenticate sets the basic auth header
+func (a *BasicAuth) Authenticate(ctx context.Context, req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+func (a *BasicAuth) rpcLogin() (string, []interface{}) {
+	return "auth.login", []interface{}{a.Username, a.Password}
+}
+
+// SessionTokenAuth exchanges a username and password for a short-lived
+// token via /auth/generate_token on first use, and authenticates later
+// requests with the token. An expired token is replaced transparently.
+type SessionTokenAuth struct {
+	Username string
+	Password string
+
+	// TTL is the requested token lifetime
+	TTL time.Duration
+
+	client *Client
+
+	mu    sync.Mutex
+	token string
+}
+
+// NewSessionTokenAuth returns a SessionTokenAuth for the given credentials
+func NewSessionTokenAuth(username, password string, ttl time.Duration) *SessionTokenAuth {
+	if ttl <= 0 {
+		ttl = defaultTokenTTL
+	}
+	return &SessionTokenAuth{
+		Username: username,
+		Password: password,
+		TTL:      ttl,
+	}
+}
+
+func (a *SessionTokenAuth) bind(c *Client) {
+	a.client = c
+}
+
+// Authenticate sets the token header, generating a token if needed
+func (a *SessionTokenAuth) Authenticate(ctx context.Context, req *http.Request) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token == "" {
+		token, err := a.generateToken(ctx)
+		if err != nil {
+			return err
+		}
+		a.token = token
+	}
+
+	req.Header.Set("Authorization", "Token "+a.token)
+	return nil
+}
+
+// rpcLogin logs WebSocket sessions in with the credentials directly; a
+// session outlives any token, so none is generated
+func (a *SessionTokenAuth) rpcLogin() (string, []interface{}) {
+	return "auth.login", []interface{}{a.Username, a.Password}
+}
+
+// Invalidate discards the current token
+func (a *SessionTokenAuth) Invalidate() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.token = ""
+}
+
+// generateToken exchanges the credentials for a new token
+func (a *SessionTokenAuth) generateToken(ctx context.Context) (string, error) {
+	if a.client == nil {
+		return "", fmt.Errorf("session token authenticator is not attached to a client")
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"ttl":   int(a.TTL.Seconds()),
+		"attrs": map[string]interface{}{},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error marshaling token request: %w", err)
+	}
+
+	basic := &BasicAuth{Username: a.Username, Password: a.Password}
+	respBody, err := a.client.doAttempt(ctx, basic, http.MethodPost, "/auth/generate_token", body)
+	if err != nil {
+		return "", fmt.Errorf("error generating session token: %w", err)
+	}
+
+	var token string
+	if err := json.Unmarshal(respBody, &token); err != nil || token == "" {
+		return "", fmt.Errorf("error generating session token: unexpected response %s", string(respBody))
+	}
+
+	return token, nil
+}
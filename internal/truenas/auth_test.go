@@ -0,0 +1,146 @@
+package truenas
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAuth_APIKey tests that API keys are sent as bearer tokens by both
+// DoRequest and UploadFile, including the stat verifying the upload
+func TestAuth_APIKey(t *testing.T) {
+	var seen []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "secret-key")
+	require.NoError(t, err)
+
+	_, err = client.Get(context.Background(), "/system/info")
+	require.NoError(t, err)
+	require.NoError(t, client.UploadFile(context.Background(), "/mnt/tank/iso/seed.iso", []byte("data")))
+
+	assert.Equal(t, []string{"Bearer secret-key", "Bearer secret-key", "Bearer secret-key"}, seen)
+}
+
+// TestAuth_Basic tests username and password authentication for both DoRequest and UploadFile
+func TestAuth_Basic(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "root" || password != "hunter2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "", WithAuthenticator(&BasicAuth{Username: "root", Password: "hunter2"}))
+	require.NoError(t, err)
+
+	_, err = client.Get(context.Background(), "/system/info")
+	require.NoError(t, err)
+	require.NoError(t, client.UploadFile(context.Background(), "/mnt/tank/iso/seed.iso", []byte("data")))
+	// The upload is followed by a stat verifying it
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+// TestAuth_MissingCredentials tests that a client needs an API key or an authenticator
+func TestAuth_MissingCredentials(t *testing.T) {
+	_, err := NewClient("https://truenas.local", "")
+	require.Error(t, err)
+
+	_, err = NewClient("https://truenas.local", "", WithAuthenticator(nil))
+	require.Error(t, err)
+}
+
+// newTokenTestServer returns a server that issues numbered tokens from
+// /auth/generate_token and accepts only the most recent one elsewhere
+func newTokenTestServer(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var issued int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v2.0/auth/generate_token" {
+			username, password, ok := r.BasicAuth()
+			if !ok || username != "root" || password != "hunter2" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			var req map[string]interface{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, float64(300), req["ttl"])
+
+			n := atomic.AddInt32(&issued, 1)
+			_ = json.NewEncoder(w).Encode(fmt.Sprintf("token-%d", n))
+			return
+		}
+
+		if r.Header.Get("Authorization") != fmt.Sprintf("Token token-%d", atomic.LoadInt32(&issued)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &issued
+}
+
+// TestAuth_SessionToken tests that credentials are exchanged for a token once and reused
+func TestAuth_SessionToken(t *testing.T) {
+	server, issued := newTokenTestServer(t)
+
+	client, err := NewClient(server.URL, "", WithAuthenticator(NewSessionTokenAuth("root", "hunter2", 5*time.Minute)))
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = client.Get(context.Background(), "/system/info")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(issued))
+}
+
+// TestAuth_SessionTokenRefresh tests that an expired token is replaced and the request resent
+func TestAuth_SessionTokenRefresh(t *testing.T) {
+	server, issued := newTokenTestServer(t)
+
+	auth := NewSessionTokenAuth("root", "hunter2", 5*time.Minute)
+	client, err := NewClient(server.URL, "", WithAuthenticator(auth))
+	require.NoError(t, err)
+
+	_, err = client.Get(context.Background(), "/system/info")
+	require.NoError(t, err)
+
+	// Expire the token server-side by issuing a newer one out of band
+	atomic.AddInt32(issued, 1)
+
+	_, err = client.Put(context.Background(), "/sharing/nfs/id/1", map[string]interface{}{"enabled": true})
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(issued))
+}
+
+// TestAuth_SessionTokenBadCredentials tests that a failed exchange is reported
+func TestAuth_SessionTokenBadCredentials(t *testing.T) {
+	server, _ := newTokenTestServer(t)
+
+	client, err := NewClient(server.URL, "", WithAuthenticator(NewSessionTokenAuth("root", "wrong", 5*time.Minute)))
+	require.NoError(t, err)
+
+	_, err = client.Get(context.Background(), "/system/info")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "error generating session token")
+}
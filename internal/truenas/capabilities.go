@@ -0,0 +1,103 @@
+package truenas
+
+import (
+	"fmt"
+)
+
+// Feature names an API area whose availability depends on the TrueNAS
+// release
+type Feature string
+
+// Features gated by server version
+const (
+	// FeatureChartRelease is the Kubernetes apps API (/chart/release),
+	// replaced by the Docker based /app API in 24.10
+	FeatureChartRelease Feature = "chart.release"
+)
+
+// VersionRange is the range of releases a feature is available in. Min is
+// inclusive and Max is exclusive; a nil bound is open.
+type VersionRange struct {
+	Min *Version
+	Max *Version
+}
+
+// Contains reports whether v falls within the range
+func (r VersionRange) Contains(v Version) bool {
+	if r.Min != nil && v.Compare(*r.Min) < 0 {
+		return false
+	}
+	if r.Max != nil && v.Compare(*r.Max) >= 0 {
+		return false
+	}
+	return true
+}
+
+// String describes the range, e.g. "24.04 or later, before 25.04"
+func (r VersionRange) String() string {
+	switch {
+	case r.Min != nil && r.Max != nil:
+		return fmt.Sprintf("%s or later, before %s", r.Min, r.Max)
+	case r.Min != nil:
+		return fmt.Sprintf("%s or later", r.Min)
+	case r.Max != nil:
+		return fmt.Sprintf("before %s", r.Max)
+	}
+	return "any version"
+}
+
+// versionPtr returns a pointer to the parsed version constant
+func versionPtr(s string) *Version {
+	v := MustParseVersion(s)
+	return &v
+}
+
+// SupportedVersions is the range of releases the provider is built and
+// tested against
+var SupportedVersions = VersionRange{
+	Min: versionPtr("24.04"),
+	Max: versionPtr("25.04"),
+}
+
+// featureVersions is the capability registry: the releases each feature is
+// available in
+var featureVersions = map[Feature]VersionRange{
+	FeatureChartRelease: {Max: versionPtr("24.10")},
+}
+
+// FeatureVersions returns the releases the feature is available in
+func FeatureVersions(f Feature) VersionRange {
+	return featureVersions[f]
+}
+
+// UnsupportedFeatureError is returned by CheckFeature when the server
+// release does not provide a feature
+type UnsupportedFeatureError struct {
+	Feature  Feature
+	Version  Version
+	Required VersionRange
+}
+
+func (e *UnsupportedFeatureError) Error() string {
+	return fmt.Sprintf("%s is not available on TrueNAS %s (available %s)", e.Feature, e.Version, e.Required)
+}
+
+// CheckFeature returns an *UnsupportedFeatureError if the detected server
+// release does not provide the feature. Nothing is checked when the server
+// version has not been detected.
+func (c *Client) CheckFeature(f Feature) error {
+	if c.ServerVersion == nil {
+		return nil
+	}
+
+	required := FeatureVersions(f)
+	if required.Contains(*c.ServerVersion) {
+		return nil
+	}
+
+	return &UnsupportedFeatureError{
+		Feature:  f,
+		Version:  *c.ServerVersion,
+		Required: required,
+	}
+}
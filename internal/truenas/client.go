@@ -2,18 +2,21 @@ package truenas
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
 
 const (
-	defaultTimeout = 30 * time.Second
-	apiVersion     = "v2.0"
+	// defaultRequestTimeout bounds a request whose context carries no deadline
+	defaultRequestTimeout = 30 * time.Second
+	apiVersion            = "v2.0"
 )
 
 // Client is the TrueNAS API client
@@ -21,49 +24,156 @@ type Client struct {
 	BaseURL    string
 	APIKey     string
 	HTTPClient *http.Client
+
+	// Authenticator adds credentials to every request. NewClient defaults
+	// it to API key authentication, see WithAuthenticator for alternatives.
+	Authenticator Authenticator
+
+	// Transport carries API calls to the middleware. NewClient defaults it
+	// to REST, see WithTransport.
+	Transport Transport
+
+	// RequestTimeout bounds a single request when its context has no deadline
+	RequestTimeout time.Duration
+
+	// JobPollInterval is how often WaitForJob polls /core/get_jobs
+	JobPollInterval time.Duration
+
+	// RetryPolicy controls retries of transient failures. Only idempotent
+	// methods are retried unless the caller opts in, see PostIdempotent.
+	RetryPolicy RetryPolicy
+
+	// ServerVersion and SystemInfo describe the server once DetectServer
+	// has run; they are nil until then
+	ServerVersion *Version
+	SystemInfo    *SystemInfo
 }
 
-// NewClient creates a new TrueNAS API client
-func NewClient(baseURL, apiKey string) (*Client, error) {
+// ClientOption customises a Client created by NewClient
+type ClientOption func(*Client) error
+
+// NewClient creates a new TrueNAS API client. The API key may be empty when
+// another authenticator is supplied with WithAuthenticator.
+func NewClient(baseURL, apiKey string, opts ...ClientOption) (*Client, error) {
 	if baseURL == "" {
 		return nil, fmt.Errorf("base URL cannot be empty")
 	}
-	if apiKey == "" {
-		return nil, fmt.Errorf("API key cannot be empty")
-	}
 
 	// Ensure baseURL doesn't have trailing slash
 	baseURL = strings.TrimSuffix(baseURL, "/")
 
-	return &Client{
+	c := &Client{
 		BaseURL: baseURL,
 		APIKey:  apiKey,
+		// No client-wide timeout: requests are bounded by the context of the
+		// Terraform operation, which honours the resource timeouts block.
 		HTTPClient: &http.Client{
-			Timeout: defaultTimeout,
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
 		},
-	}, nil
+		RequestTimeout:  defaultRequestTimeout,
+		JobPollInterval: defaultJobPollInterval,
+		RetryPolicy:     DefaultRetryPolicy(),
+	}
+
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Authenticator == nil {
+		if apiKey == "" {
+			return nil, fmt.Errorf("API key cannot be empty")
+		}
+		c.Authenticator = &APIKeyAuth{Key: apiKey}
+	}
+
+	if c.Transport == nil {
+		c.Transport = &restTransport{client: c}
+	}
+
+	return c, nil
 }
 
-// DoRequest performs an HTTP request to the TrueNAS API
-func (c *Client) DoRequest(method, endpoint string, body interface{}) ([]byte, error) {
-	var reqBody io.Reader
+// transport returns the client's *http.Transport for customisation
+func (c *Client) transport() (*http.Transport, error) {
+	transport, ok := c.HTTPClient.Transport.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("HTTP client transport is %T, not *http.Transport", c.HTTPClient.Transport)
+	}
+	return transport, nil
+}
+
+// DoRequest performs an HTTP request to the TrueNAS API. The request is
+// cancelled when ctx is done. Transient failures of idempotent methods are
+// retried according to the client's RetryPolicy.
+func (c *Client) DoRequest(ctx context.Context, method, endpoint string, body interface{}) ([]byte, error) {
+	return c.doRequest(ctx, method, endpoint, body, isIdempotentMethod(method))
+}
+
+func (c *Client) doRequest(ctx context.Context, method, endpoint string, body interface{}, retryable bool) ([]byte, error) {
+	var jsonData []byte
 	if body != nil {
-		jsonData, err := json.Marshal(body)
+		var err error
+		jsonData, err = json.Marshal(body)
 		if err != nil {
 			return nil, fmt.Errorf("error marshaling request body: %w", err)
 		}
-		reqBody = bytes.NewBuffer(jsonData)
+	}
+
+	return c.withRetry(ctx, method, endpoint, retryable, func() ([]byte, error) {
+		return c.Transport.Call(ctx, method, endpoint, jsonData)
+	})
+}
+
+// doAttempt performs a single JSON request over REST, authenticated by auth
+func (c *Client) doAttempt(ctx context.Context, auth Authenticator, method, endpoint string, jsonData []byte) ([]byte, error) {
+	ctx, cancel := c.requestContext(ctx)
+	defer cancel()
+
+	var reqBody io.Reader
+	if jsonData != nil {
+		reqBody = bytes.NewReader(jsonData)
 	}
 
 	url := fmt.Sprintf("%s/api/%s%s", c.BaseURL, apiVersion, endpoint)
-	req, err := http.NewRequest(method, url, reqBody)
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
 	req.Header.Set("Content-Type", "application/json")
 
+	return c.send(ctx, auth, req)
+}
+
+// send authenticates and performs req, returning the response body. When
+// the API rejects expired credentials, they are refreshed and the request
+// is sent once more.
+func (c *Client) send(ctx context.Context, auth Authenticator, req *http.Request) ([]byte, error) {
+	respBody, err := c.sendOnce(ctx, auth, req)
+
+	refreshable, ok := auth.(refreshableAuthenticator)
+	if !ok || !isUnauthorized(err) || (req.Body != nil && req.GetBody == nil) {
+		return respBody, err
+	}
+
+	refreshable.Invalidate()
+	if req.GetBody != nil {
+		body, bodyErr := req.GetBody()
+		if bodyErr != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+	return c.sendOnce(ctx, auth, req)
+}
+
+func (c *Client) sendOnce(ctx context.Context, auth Authenticator, req *http.Request) ([]byte, error) {
+	if err := auth.Authenticate(ctx, req); err != nil {
+		return nil, err
+	}
+
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("error performing request: %w", err)
@@ -76,92 +186,127 @@ func (c *Client) DoRequest(method, endpoint string, body interface{}) ([]byte, e
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(respBody))
+		return nil, newAPIError(resp, respBody)
 	}
 
 	return respBody, nil
 }
 
+// isUnauthorized reports whether err is an HTTP 401 from the API
+func isUnauthorized(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized
+}
+
+// requestContext applies RequestTimeout to contexts without a deadline
+func (c *Client) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || c.RequestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.RequestTimeout)
+}
+
 // Get performs a GET request
-func (c *Client) Get(endpoint string) ([]byte, error) {
-	return c.DoRequest(http.MethodGet, endpoint, nil)
+func (c *Client) Get(ctx context.Context, endpoint string) ([]byte, error) {
+	return c.DoRequest(ctx, http.MethodGet, endpoint, nil)
 }
 
 // Post performs a POST request
-func (c *Client) Post(endpoint string, body interface{}) ([]byte, error) {
-	return c.DoRequest(http.MethodPost, endpoint, body)
+func (c *Client) Post(ctx context.Context, endpoint string, body interface{}) ([]byte, error) {
+	return c.DoRequest(ctx, http.MethodPost, endpoint, body)
+}
+
+// PostIdempotent performs a POST request that is safe to repeat, so it is
+// retried on transient failures like the idempotent methods. Use it only
+// for queries that are exposed as POST, such as /filesystem/stat. Creates
+// must not use it: when a create succeeds but its response is lost, the
+// retry fails as a duplicate and the object is left outside of state.
+func (c *Client) PostIdempotent(ctx context.Context, endpoint string, body interface{}) ([]byte, error) {
+	return c.doRequest(ctx, http.MethodPost, endpoint, body, true)
 }
 
 // Put performs a PUT request
-func (c *Client) Put(endpoint string, body interface{}) ([]byte, error) {
-	return c.DoRequest(http.MethodPut, endpoint, body)
+func (c *Client) Put(ctx context.Context, endpoint string, body interface{}) ([]byte, error) {
+	return c.DoRequest(ctx, http.MethodPut, endpoint, body)
 }
 
 // Delete performs a DELETE request
-func (c *Client) Delete(endpoint string) ([]byte, error) {
-	return c.DoRequest(http.MethodDelete, endpoint, nil)
+func (c *Client) Delete(ctx context.Context, endpoint string) ([]byte, error) {
+	return c.DoRequest(ctx, http.MethodDelete, endpoint, nil)
 }
 
 // DeleteWithBody performs a DELETE request with a JSON body (some TrueNAS endpoints require this)
-func (c *Client) DeleteWithBody(endpoint string, body interface{}) ([]byte, error) {
-	return c.DoRequest(http.MethodDelete, endpoint, body)
+func (c *Client) DeleteWithBody(ctx context.Context, endpoint string, body interface{}) ([]byte, error) {
+	return c.DoRequest(ctx, http.MethodDelete, endpoint, body)
 }
 
 // Patch performs a PATCH request
-func (c *Client) Patch(endpoint string, body interface{}) ([]byte, error) {
-	return c.DoRequest(http.MethodPatch, endpoint, body)
+func (c *Client) Patch(ctx context.Context, endpoint string, body interface{}) ([]byte, error) {
+	return c.DoRequest(ctx, http.MethodPatch, endpoint, body)
 }
 
 // VM Device API methods
 
 // GetVMDevice retrieves a VM device by ID
-func (c *Client) GetVMDevice(id string) ([]byte, error) {
+func (c *Client) GetVMDevice(ctx context.Context, id string) ([]byte, error) {
 	endpoint := fmt.Sprintf("/vm/device/id/%s", id)
-	return c.Get(endpoint)
+	return c.Get(ctx, endpoint)
 }
 
 // VM Lifecycle API methods
 
-// StartVM starts a VM
-func (c *Client) StartVM(id string) ([]byte, error) {
+// StartVM starts a VM and waits for the start job
+func (c *Client) StartVM(ctx context.Context, id string) ([]byte, error) {
 	endpoint := fmt.Sprintf("/vm/id/%s/start", id)
-	return c.Post(endpoint, nil)
+	return c.PostJob(ctx, endpoint, nil)
 }
 
-// StopVM gracefully stops a VM
-func (c *Client) StopVM(id string) ([]byte, error) {
+// StopVM gracefully stops a VM and waits for the stop job
+func (c *Client) StopVM(ctx context.Context, id string) ([]byte, error) {
 	endpoint := fmt.Sprintf("/vm/id/%s/stop", id)
-	return c.Post(endpoint, nil)
+	return c.PostJob(ctx, endpoint, nil)
 }
 
 // PowerOffVM forces a VM power off
-func (c *Client) PowerOffVM(id string) ([]byte, error) {
+func (c *Client) PowerOffVM(ctx context.Context, id string) ([]byte, error) {
 	endpoint := fmt.Sprintf("/vm/id/%s/poweroff", id)
-	return c.Post(endpoint, nil)
+	return c.Post(ctx, endpoint, nil)
 }
 
-// RestartVM restarts a VM
-func (c *Client) RestartVM(id string) ([]byte, error) {
+// RestartVM restarts a VM and waits for the restart job
+func (c *Client) RestartVM(ctx context.Context, id string) ([]byte, error) {
 	endpoint := fmt.Sprintf("/vm/id/%s/restart", id)
-	return c.Post(endpoint, nil)
+	return c.PostJob(ctx, endpoint, nil)
+}
+
+// CloneVM clones a VM, including zvol clones of its disks, as a new VM
+// with the given name. The middleware names the clone itself when name is
+// empty.
+func (c *Client) CloneVM(ctx context.Context, id string, name string) ([]byte, error) {
+	endpoint := fmt.Sprintf("/vm/id/%s/clone", id)
+	body := map[string]interface{}{}
+	if name != "" {
+		body["name"] = name
+	}
+	return c.PostJob(ctx, endpoint, body)
 }
 
 // SuspendVM suspends a VM
-func (c *Client) SuspendVM(id string) ([]byte, error) {
+func (c *Client) SuspendVM(ctx context.Context, id string) ([]byte, error) {
 	endpoint := fmt.Sprintf("/vm/id/%s/suspend", id)
-	return c.Post(endpoint, nil)
+	return c.Post(ctx, endpoint, nil)
 }
 
 // ResumeVM resumes a suspended VM
-func (c *Client) ResumeVM(id string) ([]byte, error) {
+func (c *Client) ResumeVM(ctx context.Context, id string) ([]byte, error) {
 	endpoint := fmt.Sprintf("/vm/id/%s/resume", id)
-	return c.Post(endpoint, nil)
+	return c.Post(ctx, endpoint, nil)
 }
 
 // GetVMStatus retrieves the current status of a VM
-func (c *Client) GetVMStatus(id string) (map[string]interface{}, error) {
+func (c *Client) GetVMStatus(ctx context.Context, id string) (map[string]interface{}, error) {
 	endpoint := fmt.Sprintf("/vm/id/%s", id)
-	respBody, err := c.Get(endpoint)
+	respBody, err := c.Get(ctx, endpoint)
 	if err != nil {
 		return nil, err
 	}
@@ -174,76 +319,84 @@ func (c *Client) GetVMStatus(id string) (map[string]interface{}, error) {
 	return result, nil
 }
 
-// CreateVMDevice creates a new VM device
-func (c *Client) CreateVMDevice(device map[string]interface{}) ([]byte, error) {
-	return c.Post("/vm/device", device)
+// VM display API methods
+
+// GetVMDisplayDevices returns the SPICE/VNC display devices of a VM
+func (c *Client) GetVMDisplayDevices(ctx context.Context, id string) ([]byte, error) {
+	endpoint := fmt.Sprintf("/vm/id/%s/get_display_devices", id)
+	return c.PostIdempotent(ctx, endpoint, nil)
 }
 
-// UpdateVMDevice updates an existing VM device
-func (c *Client) UpdateVMDevice(id string, device map[string]interface{}) ([]byte, error) {
-	endpoint := fmt.Sprintf("/vm/device/id/%s", id)
-	return c.Put(endpoint, device)
+// GetVMDisplayWebURIs returns the web console URI of each display device of
+// a VM, keyed by device ID. host is the address the URIs point to and
+// protocol is HTTP or HTTPS.
+func (c *Client) GetVMDisplayWebURIs(ctx context.Context, id, host, protocol string) ([]byte, error) {
+	endpoint := fmt.Sprintf("/vm/id/%s/get_display_web_uri", id)
+	body := map[string]interface{}{
+		"host":    host,
+		"options": map[string]interface{}{"protocol": protocol},
+	}
+	return c.PostIdempotent(ctx, endpoint, body)
 }
 
-// DeleteVMDevice deletes a VM device
-func (c *Client) DeleteVMDevice(id string) ([]byte, error) {
-	endpoint := fmt.Sprintf("/vm/device/id/%s", id)
-	return c.Delete(endpoint)
+// GetVMConsole returns the console of a VM
+func (c *Client) GetVMConsole(ctx context.Context, id string) ([]byte, error) {
+	endpoint := fmt.Sprintf("/vm/id/%s/get_console", id)
+	return c.PostIdempotent(ctx, endpoint, nil)
 }
 
-// UploadFile uploads a file to the TrueNAS system
-func (c *Client) UploadFile(path string, content []byte) error {
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+// VMPortWizard returns a free display port and web port for a new display
+// device
+func (c *Client) VMPortWizard(ctx context.Context) ([]byte, error) {
+	return c.Get(ctx, "/vm/port_wizard")
+}
 
-	// Add data field
-	data := map[string]string{"path": path}
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return fmt.Errorf("error marshaling data: %w", err)
-	}
-	if err := writer.WriteField("data", string(jsonData)); err != nil {
-		return fmt.Errorf("error writing data field: %w", err)
-	}
+// VM host capacity API methods
 
-	// Add file field
-	part, err := writer.CreateFormFile("file", "file")
-	if err != nil {
-		return fmt.Errorf("error creating form file: %w", err)
-	}
-	if _, err := part.Write(content); err != nil {
-		return fmt.Errorf("error writing file content: %w", err)
-	}
+// GetVMAvailableMemory returns the memory in bytes available to start VMs.
+// With overcommit, the memory of running VMs is not reserved.
+func (c *Client) GetVMAvailableMemory(ctx context.Context, overcommit bool) ([]byte, error) {
+	return c.PostIdempotent(ctx, "/vm/get_available_memory", overcommit)
+}
 
-	if err := writer.Close(); err != nil {
-		return fmt.Errorf("error closing multipart writer: %w", err)
-	}
+// GetVMMaximumSupportedVCPUs returns the maximum number of vCPUs a VM can
+// have on the host
+func (c *Client) GetVMMaximumSupportedVCPUs(ctx context.Context) ([]byte, error) {
+	return c.Get(ctx, "/vm/maximum_supported_vcpus")
+}
 
-	url := fmt.Sprintf("%s/api/%s/filesystem/put", c.BaseURL, apiVersion)
-	req, err := http.NewRequest("POST", url, body)
-	if err != nil {
-		return fmt.Errorf("error creating request: %w", err)
-	}
+// GetVMVirtualizationDetails returns whether the host supports
+// virtualization, and why not
+func (c *Client) GetVMVirtualizationDetails(ctx context.Context) ([]byte, error) {
+	return c.Get(ctx, "/vm/virtualization_details")
+}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
-	req.Header.Set("Content-Type", writer.FormDataContentType())
+// GetVMMemoryInUse returns the memory in bytes of VMs, split into RNP
+// (running, no autostart), PRD (autostart, not running) and RPRD (running
+// with autostart)
+func (c *Client) GetVMMemoryInUse(ctx context.Context) ([]byte, error) {
+	return c.Get(ctx, "/vm/get_vmemory_in_use")
+}
 
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("error performing request: %w", err)
-	}
-	defer resp.Body.Close()
+// CreateVMDevice creates a new VM device
+func (c *Client) CreateVMDevice(ctx context.Context, device map[string]interface{}) ([]byte, error) {
+	return c.Post(ctx, "/vm/device", device)
+}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(respBody))
-	}
+// UpdateVMDevice updates an existing VM device
+func (c *Client) UpdateVMDevice(ctx context.Context, id string, device map[string]interface{}) ([]byte, error) {
+	endpoint := fmt.Sprintf("/vm/device/id/%s", id)
+	return c.Put(ctx, endpoint, device)
+}
 
-	return nil
+// DeleteVMDevice deletes a VM device
+func (c *Client) DeleteVMDevice(ctx context.Context, id string) ([]byte, error) {
+	endpoint := fmt.Sprintf("/vm/device/id/%s", id)
+	return c.Delete(ctx, endpoint)
 }
 
 // DeleteFile deletes a file from the TrueNAS system
-func (c *Client) DeleteFile(path string) error {
+func (c *Client) DeleteFile(ctx context.Context, path string) error {
 	// Note: /filesystem/delete is not explicitly documented in some versions of the API spec,
 	// but follows the pattern of other filesystem operations.
 	endpoint := "/filesystem/delete"
@@ -251,6 +404,58 @@ func (c *Client) DeleteFile(path string) error {
 		"path": path,
 	}
 
-	_, err := c.Post(endpoint, data)
+	_, err := c.Post(ctx, endpoint, data)
 	return err
 }
+
+// Dataset encryption API methods
+
+// UnlockDataset loads the keys of a locked encryption root and waits for
+// the unlock job. The job reports the datasets it unlocked and those that
+// failed rather than failing itself.
+func (c *Client) UnlockDataset(ctx context.Context, id string, options map[string]interface{}) ([]byte, error) {
+	endpoint := fmt.Sprintf("/pool/dataset/id/%s/unlock", url.PathEscape(id))
+	return c.PostJob(ctx, endpoint, options)
+}
+
+// LockDataset unloads the key of an encryption root encrypted with a
+// passphrase and waits for the lock job. forceUmount unmounts the dataset
+// even when it is busy.
+func (c *Client) LockDataset(ctx context.Context, id string, forceUmount bool) ([]byte, error) {
+	endpoint := fmt.Sprintf("/pool/dataset/id/%s/lock", url.PathEscape(id))
+	return c.PostJob(ctx, endpoint, map[string]interface{}{"force_umount": forceUmount})
+}
+
+// GetDatasetUnlockServicesRestartChoices returns the services that can be
+// restarted when a dataset is unlocked, as identifiers mapped to labels
+func (c *Client) GetDatasetUnlockServicesRestartChoices(ctx context.Context, id string) ([]byte, error) {
+	return c.PostIdempotent(ctx, "/pool/dataset/unlock_services_restart_choices", id)
+}
+
+// GetDatasetEncryptionSummary reports, for each encryption root at or
+// below a dataset, whether the keys in options or those stored by TrueNAS
+// can unlock it
+func (c *Client) GetDatasetEncryptionSummary(ctx context.Context, id string, options map[string]interface{}) ([]byte, error) {
+	endpoint := fmt.Sprintf("/pool/dataset/id/%s/encryption_summary", url.PathEscape(id))
+	return c.PostJob(ctx, endpoint, options)
+}
+
+// ExportDatasetKey returns the hex key of an encryption root as a JSON
+// string. Passphrases cannot be exported.
+func (c *Client) ExportDatasetKey(ctx context.Context, id string) ([]byte, error) {
+	endpoint := fmt.Sprintf("/pool/dataset/id/%s/export_key", url.PathEscape(id))
+	return c.PostJob(ctx, endpoint, map[string]interface{}{"download": false})
+}
+
+// ExportDatasetKeys returns the keys stored by TrueNAS for a dataset and
+// its children, such as all datasets of a pool, as a JSON object of
+// dataset names to keys
+func (c *Client) ExportDatasetKeys(ctx context.Context, id string) ([]byte, error) {
+	return c.Download(ctx, "pool.dataset.export_keys", []interface{}{id}, "dataset_keys.json")
+}
+
+// ExportReplicationKeys returns the keys stored by TrueNAS for the source
+// datasets of a replication task, as a JSON object of dataset names to keys
+func (c *Client) ExportReplicationKeys(ctx context.Context, taskID int64) ([]byte, error) {
+	return c.Download(ctx, "pool.dataset.export_keys_for_replication", []interface{}{taskID}, "replication_keys.json")
+}
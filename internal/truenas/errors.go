@@ -0,0 +1,177 @@
+package truenas
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound matches (via errors.Is) any API error reporting that the
+// requested instance does not exist
+var ErrNotFound = errors.New("not found")
+
+// Error classes reported by the TrueNAS middleware
+const (
+	ErrorClassValidation       = "ValidationErrors"
+	ErrorClassCallError        = "CallError"
+	ErrorClassInstanceNotFound = "InstanceNotFound"
+)
+
+// errnoENOENT is the errno of call errors for a missing file or directory
+const errnoENOENT = 2
+
+// FieldError is a validation message for a single field of a request
+type FieldError struct {
+	// Field is the middleware's path of the field, prefixed with the
+	// method's schema name, e.g. pool_dataset_create.quota
+	Field   string
+	Message string
+	Errno   int
+}
+
+// Attribute returns the field path without the schema name prefix, e.g.
+// quota for pool_dataset_create.quota
+func (f FieldError) Attribute() string {
+	if i := strings.Index(f.Field, "."); i >= 0 {
+		return f.Field[i+1:]
+	}
+	return f.Field
+}
+
+// APIError is returned when the API responds with a non-2xx status
+type APIError struct {
+	StatusCode int
+
+	// Class is the middleware error class, e.g. ValidationErrors or
+	// CallError, when the response reports one
+	Class   string
+	Message string
+	Errno   int
+
+	// Fields holds the per-field messages of a validation error
+	Fields []FieldError
+
+	// Body is the raw response body
+	Body string
+
+	// retryAfter is the server supplied Retry-After delay, if any
+	retryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	var detail string
+	switch {
+	case len(e.Fields) > 0:
+		msgs := make([]string, 0, len(e.Fields))
+		for _, f := range e.Fields {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", f.Field, f.Message))
+		}
+		detail = strings.Join(msgs, "; ")
+	case e.Message != "":
+		detail = e.Message
+	default:
+		detail = e.Body
+	}
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, detail)
+}
+
+// Is reports whether the error matches target; an APIError matches
+// ErrNotFound when it describes a missing instance
+func (e *APIError) Is(target error) bool {
+	return target == ErrNotFound && e.NotFound()
+}
+
+// NotFound reports whether the error describes a missing instance
+func (e *APIError) NotFound() bool {
+	return e.StatusCode == http.StatusNotFound || e.Class == ErrorClassInstanceNotFound
+}
+
+// IsNotFound reports whether err is an API error for a missing instance
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// IsNoEntry reports whether err is a call error for a missing file or
+// directory, which filesystem calls such as /filesystem/stat return. It is
+// kept apart from IsNotFound because other calls report ENOENT for reasons
+// that do not mean the resource is gone.
+func IsNoEntry(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Class == ErrorClassCallError && apiErr.Errno == errnoENOENT
+}
+
+// newAPIError builds an APIError from a response and its body
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		apiErr.retryAfter = time.Duration(seconds) * time.Second
+	}
+
+	apiErr.parseBody(body)
+	return apiErr
+}
+
+// parseBody fills the error from the middleware's error shapes: a call error
+// ({"message": ..., "errno": ..., "trace": {"class": ...}}) or validation
+// errors keyed by field ({"schema.field": [{"message": ..., "errno": ...}]})
+func (e *APIError) parseBody(body []byte) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		if msg := strings.TrimSpace(string(body)); msg != "" && !strings.HasPrefix(msg, "<") {
+			e.Message = msg
+		}
+		return
+	}
+
+	if msgRaw, ok := raw["message"]; ok {
+		var callErr struct {
+			Message string `json:"message"`
+			Errno   int    `json:"errno"`
+			Trace   struct {
+				Class string `json:"class"`
+			} `json:"trace"`
+		}
+		if err := json.Unmarshal(body, &callErr); err == nil {
+			e.Message = callErr.Message
+			e.Errno = callErr.Errno
+			e.Class = callErr.Trace.Class
+			return
+		}
+		_ = json.Unmarshal(msgRaw, &e.Message)
+		return
+	}
+
+	fields := make([]string, 0, len(raw))
+	for field := range raw {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		var entries []struct {
+			Message string `json:"message"`
+			Errno   int    `json:"errno"`
+		}
+		if err := json.Unmarshal(raw[field], &entries); err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			e.Fields = append(e.Fields, FieldError{
+				Field:   field,
+				Message: entry.Message,
+				Errno:   entry.Errno,
+			})
+		}
+	}
+	if len(e.Fields) > 0 {
+		e.Class = ErrorClassValidation
+	}
+}
@@ -0,0 +1,131 @@
+package truenas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newErrorTestServer returns a client whose server always responds with the given status and body
+func newErrorTestServer(t *testing.T, status int, body string) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(server.URL, "test-key")
+	require.NoError(t, err)
+	client.RetryPolicy.MaxRetries = 0
+
+	return client
+}
+
+// TestAPIError_Validation tests that per-field validation messages are parsed
+func TestAPIError_Validation(t *testing.T) {
+	client := newErrorTestServer(t, http.StatusUnprocessableEntity, `{
+		"pool_dataset_create.quota": [{"message": "Quota must be at least 1 GiB", "errno": 22}],
+		"pool_dataset_create.name": [{"message": "Parent dataset does not exist", "errno": 2}]
+	}`)
+
+	_, err := client.Post(context.Background(), "/pool/dataset", map[string]interface{}{"name": "tank/x"})
+	require.Error(t, err)
+
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+	assert.Equal(t, ErrorClassValidation, apiErr.Class)
+	require.Len(t, apiErr.Fields, 2)
+	assert.Equal(t, "pool_dataset_create.name", apiErr.Fields[0].Field)
+	assert.Equal(t, "name", apiErr.Fields[0].Attribute())
+	assert.Equal(t, "pool_dataset_create.quota", apiErr.Fields[1].Field)
+	assert.Equal(t, "quota", apiErr.Fields[1].Attribute())
+	assert.Equal(t, "Quota must be at least 1 GiB", apiErr.Fields[1].Message)
+	assert.Equal(t, 22, apiErr.Fields[1].Errno)
+	assert.Contains(t, err.Error(), "pool_dataset_create.quota: Quota must be at least 1 GiB")
+	assert.False(t, IsNotFound(err))
+}
+
+// TestAPIError_CallError tests that call errors keep their message, errno and class
+func TestAPIError_CallError(t *testing.T) {
+	client := newErrorTestServer(t, http.StatusUnprocessableEntity, `{
+		"message": "[EFAULT] VM is not running",
+		"errno": 14,
+		"trace": {"class": "CallError", "formatted": "Traceback ..."}
+	}`)
+
+	_, err := client.Post(context.Background(), "/vm/id/1/stop", nil)
+	require.Error(t, err)
+
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, ErrorClassCallError, apiErr.Class)
+	assert.Equal(t, "[EFAULT] VM is not running", apiErr.Message)
+	assert.Equal(t, 14, apiErr.Errno)
+	assert.Empty(t, apiErr.Fields)
+	assert.Equal(t, "API request failed with status 422: [EFAULT] VM is not running", err.Error())
+}
+
+// TestAPIError_NotFound tests that a 404 matches the ErrNotFound sentinel
+func TestAPIError_NotFound(t *testing.T) {
+	client := newErrorTestServer(t, http.StatusNotFound, `{"message": "Not Found"}`)
+
+	_, err := client.Get(context.Background(), "/sharing/nfs/id/7")
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.True(t, IsNotFound(fmt.Errorf("reading share: %w", err)))
+}
+
+// TestAPIError_InstanceNotFoundClass tests that an InstanceNotFound call error matches ErrNotFound
+func TestAPIError_InstanceNotFoundClass(t *testing.T) {
+	client := newErrorTestServer(t, http.StatusUnprocessableEntity, `{
+		"message": "[ENOENT] VM 9 does not exist",
+		"errno": 2,
+		"trace": {"class": "InstanceNotFound"}
+	}`)
+
+	_, err := client.Get(context.Background(), "/vm/id/9")
+	require.Error(t, err)
+	assert.True(t, IsNotFound(err))
+}
+
+// TestAPIError_ENOENTCallError tests that a call error for a missing path
+// matches IsNoEntry but not ErrNotFound
+func TestAPIError_ENOENTCallError(t *testing.T) {
+	client := newErrorTestServer(t, http.StatusUnprocessableEntity, `{
+		"message": "[ENOENT] Path /mnt/tank/isos/missing.iso not found",
+		"errno": 2,
+		"trace": {"class": "CallError"}
+	}`)
+
+	_, err := client.Post(context.Background(), "/filesystem/stat", "/mnt/tank/isos/missing.iso")
+	require.Error(t, err)
+	assert.True(t, IsNoEntry(fmt.Errorf("reading file: %w", err)))
+	assert.False(t, IsNotFound(err))
+}
+
+// TestIsNoEntry_OtherErrors tests that missing instances and other call
+// errors do not match IsNoEntry
+func TestIsNoEntry_OtherErrors(t *testing.T) {
+	assert.False(t, IsNoEntry(&APIError{StatusCode: http.StatusNotFound}))
+	assert.False(t, IsNoEntry(&APIError{Class: ErrorClassInstanceNotFound, Errno: 2}))
+	assert.False(t, IsNoEntry(&APIError{Class: ErrorClassCallError, Errno: 22}))
+	assert.False(t, IsNoEntry(errors.New("connection refused")))
+}
+
+// TestAPIError_PlainBody tests that non-JSON bodies are kept as the message
+func TestAPIError_PlainBody(t *testing.T) {
+	client := newErrorTestServer(t, http.StatusInternalServerError, "Internal Server Error")
+
+	_, err := client.Get(context.Background(), "/pool")
+	require.Error(t, err)
+	assert.Equal(t, "API request failed with status 500: Internal Server Error", err.Error())
+}
@@ -0,0 +1,128 @@
+package fake
+
+import "fmt"
+
+// firstLocalID is the first uid and gid allocated to local accounts
+const firstLocalID = 3000
+
+func userCollection() *collection {
+	return &collection{
+		name:     "user",
+		schema:   "user",
+		required: []string{"username", "full_name"},
+		unique:   []string{"username", "uid"},
+		defaults: func() object {
+			return object{
+				"email":     nil,
+				"home":      "/var/empty",
+				"shell":     "/usr/bin/zsh",
+				"sshpubkey": nil,
+				"locked":    false,
+				"sudo":      false,
+				"smb":       true,
+				"builtin":   false,
+			}
+		},
+		create: func(s *Server, obj object) *Error {
+			if _, ok := obj["uid"]; !ok {
+				obj["uid"] = nextAccountID(s, "user", "uid")
+			}
+
+			groupCreate, _ := obj["group_create"].(bool)
+			delete(obj, "group_create")
+			switch {
+			case obj["group"] != nil:
+				if _, ok := s.lookup("group", obj["group"]); !ok {
+					return errValidation("user_create.group", fmt.Sprintf("Group %v not found", obj["group"]))
+				}
+			case groupCreate:
+				group, apiErr := s.collections["group"].createObject(s, object{"name": str(obj, "username")})
+				if apiErr != nil {
+					return apiErr
+				}
+				obj["group"] = group["id"]
+			default:
+				return errValidation("user_create.group", "Enter either a group name or create a new group to continue.")
+			}
+
+			// The password is write-only
+			delete(obj, "password")
+			return nil
+		},
+		update: func(s *Server, obj, params object) *Error {
+			if group, ok := params["group"]; ok {
+				if _, ok := s.lookup("group", group); !ok {
+					return errValidation("user_update.group", fmt.Sprintf("Group %v not found", group))
+				}
+			}
+			delete(params, "password")
+			for k, v := range params {
+				obj[k] = v
+			}
+			return nil
+		},
+		render: func(s *Server, obj object) object {
+			// The primary group is reported as an object
+			group := object{"id": obj["group"]}
+			if g, ok := s.lookup("group", obj["group"]); ok {
+				group["bsdgrp_gid"] = g["gid"]
+				group["bsdgrp_group"] = g["name"]
+			}
+			obj["group"] = group
+			return obj
+		},
+		remove: func(s *Server, obj, params object) *Error {
+			if deleteGroup, _ := params["delete_group"].(bool); deleteGroup {
+				delete(s.collections["group"].objects, fmt.Sprint(obj["group"]))
+			}
+			return nil
+		},
+	}
+}
+
+func groupCollection() *collection {
+	return &collection{
+		name:     "group",
+		schema:   "group",
+		required: []string{"name"},
+		unique:   []string{"name", "gid"},
+		defaults: func() object {
+			return object{
+				"sudo":    false,
+				"smb":     true,
+				"users":   []interface{}{},
+				"builtin": false,
+			}
+		},
+		create: func(s *Server, obj object) *Error {
+			if _, ok := obj["gid"]; !ok {
+				obj["gid"] = nextAccountID(s, "group", "gid")
+			}
+			return nil
+		},
+		render: func(s *Server, obj object) object {
+			// The name is reported under both keys
+			obj["group"] = obj["name"]
+			return obj
+		},
+		remove: func(s *Server, obj, params object) *Error {
+			for _, user := range s.collections["user"].objects {
+				if fmt.Sprint(user["group"]) == fmt.Sprint(obj["id"]) {
+					return errCall(fmt.Sprintf("Group %s is the primary group of user %s", str(obj, "name"), str(user, "username")))
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// nextAccountID returns the lowest unused uid or gid of local accounts
+func nextAccountID(s *Server, namespace, field string) int64 {
+	next := int64(firstLocalID)
+	for _, obj := range s.collections[namespace].objects {
+		if id, ok := jsonNumber(obj[field]); ok && id >= next {
+			next = id + 1
+		}
+	}
+	return next
+}
@@ -0,0 +1,837 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// nfs4Perms are the advanced permissions of NFSv4 entries
+var nfs4Perms = []string{
+	"READ_DATA", "WRITE_DATA", "APPEND_DATA", "READ_NAMED_ATTRS", "WRITE_NAMED_ATTRS", "EXECUTE", "DELETE_CHILD",
+	"READ_ATTRIBUTES", "WRITE_ATTRIBUTES", "DELETE", "READ_ACL", "WRITE_ACL", "WRITE_OWNER", "SYNCHRONIZE",
+}
+
+// nfs4Flags are the advanced inheritance flags of NFSv4 entries
+var nfs4Flags = []string{"FILE_INHERIT", "DIRECTORY_INHERIT", "NO_PROPAGATE_INHERIT", "INHERIT_ONLY", "INHERITED"}
+
+// nfs4BasicPerms and nfs4BasicFlags are the sets the middleware simplifies
+// advanced permissions and flags into
+var nfs4BasicPerms = map[string][]string{
+	"FULL_CONTROL": nfs4Perms,
+	"MODIFY": {
+		"READ_DATA", "WRITE_DATA", "APPEND_DATA", "READ_NAMED_ATTRS", "WRITE_NAMED_ATTRS", "EXECUTE", "DELETE_CHILD",
+		"READ_ATTRIBUTES", "WRITE_ATTRIBUTES", "DELETE", "READ_ACL", "SYNCHRONIZE",
+	},
+	"READ":     {"READ_DATA", "READ_NAMED_ATTRS", "EXECUTE", "READ_ATTRIBUTES", "READ_ACL", "SYNCHRONIZE"},
+	"TRAVERSE": {"READ_NAMED_ATTRS", "EXECUTE", "READ_ATTRIBUTES", "READ_ACL", "SYNCHRONIZE"},
+}
+
+var nfs4BasicFlags = map[string][]string{
+	"INHERIT":   {"FILE_INHERIT", "DIRECTORY_INHERIT"},
+	"NOINHERIT": {},
+}
+
+var nfs4Tags = map[string]bool{"owner@": true, "group@": true, "everyone@": true, "USER": true, "GROUP": true}
+
+var posix1eTags = map[string]bool{"USER_OBJ": true, "GROUP_OBJ": true, "OTHER": true, "MASK": true, "USER": true, "GROUP": true}
+
+// pathAttrs returns the attributes of a stored file or directory, creating
+// those of a directory on first use. It returns nil when the path does not
+// exist.
+func (s *Server) pathAttrs(path string) *fileAttrs {
+	if attrs, ok := s.fileAttrs[path]; ok {
+		return attrs
+	}
+	if !pathExists(s, path) {
+		return nil
+	}
+	attrs := &fileAttrs{mode: 0o755}
+	s.fileAttrs[path] = attrs
+	return attrs
+}
+
+// pathACLType returns the ACL type of the dataset a path is stored on:
+// NFS4 for an acltype of NFSV4, DISABLED for OFF and POSIX1E otherwise
+func (s *Server) pathACLType(path string) string {
+	var dataset object
+	for _, candidate := range s.collections["pool/dataset"].objects {
+		mountpoint := str(candidate, "mountpoint")
+		if mountpoint == "" || (path != mountpoint && !strings.HasPrefix(path, mountpoint+"/")) {
+			continue
+		}
+		if dataset == nil || len(mountpoint) > len(str(dataset, "mountpoint")) {
+			dataset = candidate
+		}
+	}
+	switch str(dataset, "acltype") {
+	case "NFSV4":
+		return "NFS4"
+	case "OFF":
+		return "DISABLED"
+	}
+	return "POSIX1E"
+}
+
+// pathTargets returns a path and, when recursive, the stored files and
+// dataset mountpoints below it. Those on child datasets are only included
+// with traverse.
+func (s *Server) pathTargets(path string, recursive, traverse bool) []string {
+	targets := []string{path}
+	if !recursive {
+		return targets
+	}
+
+	var mountpoints, candidates []string
+	for _, dataset := range s.collections["pool/dataset"].objects {
+		if mountpoint := str(dataset, "mountpoint"); strings.HasPrefix(mountpoint, path+"/") {
+			mountpoints = append(mountpoints, mountpoint)
+			candidates = append(candidates, mountpoint)
+		}
+	}
+	for file := range s.files {
+		if strings.HasPrefix(file, path+"/") {
+			candidates = append(candidates, file)
+		}
+	}
+	sort.Strings(candidates)
+
+	for _, candidate := range candidates {
+		onChild := false
+		for _, mountpoint := range mountpoints {
+			if candidate == mountpoint || strings.HasPrefix(candidate, mountpoint+"/") {
+				onChild = true
+			}
+		}
+		if !onChild || traverse {
+			targets = append(targets, candidate)
+		}
+	}
+	return targets
+}
+
+// trivialACL returns the ACL reflecting the mode of a path without one
+func trivialACL(acltype string, mode int64) []interface{} {
+	if acltype == "NFS4" {
+		entries := []interface{}{}
+		for i, tag := range []string{"owner@", "group@", "everyone@"} {
+			bits := mode >> (6 - 3*i) & 0o7
+			perms := map[string]bool{"READ_ATTRIBUTES": true, "READ_NAMED_ATTRS": true, "READ_ACL": true, "SYNCHRONIZE": true}
+			if bits&0o4 != 0 {
+				perms["READ_DATA"] = true
+			}
+			if bits&0o2 != 0 {
+				for _, perm := range []string{"WRITE_DATA", "APPEND_DATA", "WRITE_ATTRIBUTES", "WRITE_NAMED_ATTRS", "DELETE_CHILD"} {
+					perms[perm] = true
+				}
+			}
+			if bits&0o1 != 0 {
+				perms["EXECUTE"] = true
+			}
+			if tag == "owner@" {
+				perms["WRITE_ACL"] = true
+				perms["WRITE_OWNER"] = true
+			}
+			entries = append(entries, object{
+				"tag":   tag,
+				"id":    nil,
+				"type":  "ALLOW",
+				"perms": boolMap(nfs4Perms, perms),
+				"flags": boolMap(nfs4Flags, nil),
+			})
+		}
+		return entries
+	}
+	if acltype == "DISABLED" {
+		return []interface{}{}
+	}
+
+	entries := []interface{}{}
+	for i, tag := range []string{"USER_OBJ", "GROUP_OBJ", "OTHER"} {
+		bits := mode >> (6 - 3*i) & 0o7
+		entries = append(entries, object{
+			"tag":     tag,
+			"id":      -1,
+			"perms":   object{"READ": bits&0o4 != 0, "WRITE": bits&0o2 != 0, "EXECUTE": bits&0o1 != 0},
+			"default": false,
+		})
+	}
+	return entries
+}
+
+// boolMap maps each of keys to whether it is set
+func boolMap(keys []string, set map[string]bool) object {
+	m := object{}
+	for _, key := range keys {
+		m[key] = set[key]
+	}
+	return m
+}
+
+// getACL serves /filesystem/getacl. Entries are stored in their advanced
+// form and simplified into basic sets when asked, as the middleware does.
+func (s *Server) getACL(body []byte) (interface{}, *Error) {
+	data := struct {
+		Path       string `json:"path"`
+		Simplified *bool  `json:"simplified"`
+		ResolveIDs bool   `json:"resolve_ids"`
+	}{}
+	if err := json.Unmarshal(body, &data); err != nil || data.Path == "" {
+		return nil, errValidation("filesystem_acl.path", "Path is required")
+	}
+	attrs := s.pathAttrs(data.Path)
+	if attrs == nil {
+		return nil, errNoEntry(data.Path)
+	}
+	simplified := data.Simplified == nil || *data.Simplified
+
+	acltype := s.pathACLType(data.Path)
+	entries := attrs.acl
+	if entries == nil {
+		entries = trivialACL(acltype, attrs.mode)
+	}
+
+	rendered := make([]interface{}, 0, len(entries))
+	for _, raw := range entries {
+		entry := copyObject(raw.(object))
+		tag := str(entry, "tag")
+		if acltype == "NFS4" && simplified {
+			entry["perms"] = simplifyNFS4(entry["perms"].(object), nfs4BasicPerms)
+			entry["flags"] = simplifyNFS4(entry["flags"].(object), nfs4BasicFlags)
+		}
+		if data.ResolveIDs && (tag == "USER" || tag == "GROUP") {
+			s.resolveEntryName(entry)
+		}
+		rendered = append(rendered, entry)
+	}
+
+	return map[string]interface{}{
+		"path":    data.Path,
+		"trivial": attrs.acl == nil,
+		"uid":     attrs.uid,
+		"gid":     attrs.gid,
+		"acltype": acltype,
+		"acl":     rendered,
+	}, nil
+}
+
+// resolveEntryName sets the who of a USER or GROUP entry from its id
+func (s *Server) resolveEntryName(entry object) {
+	id, ok := jsonNumber(entry["id"])
+	if !ok {
+		return
+	}
+	if str(entry, "tag") == "USER" {
+		entry["who"] = s.accountName("user", "uid", "username", id)
+	} else {
+		entry["who"] = s.accountName("group", "gid", "name", id)
+	}
+}
+
+// simplifyNFS4 returns the basic set matching advanced permissions or
+// flags, or the advanced form when none does
+func simplifyNFS4(advanced object, basic map[string][]string) object {
+	names := make([]string, 0, len(basic))
+	for name := range basic {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		set := map[string]bool{}
+		for _, key := range basic[name] {
+			set[key] = true
+		}
+		matches := true
+		for key, v := range advanced {
+			if on, _ := v.(bool); on != set[key] {
+				matches = false
+			}
+		}
+		if matches {
+			return object{"BASIC": name}
+		}
+	}
+	return advanced
+}
+
+// aclRequest is the body of /filesystem/setacl, and the acl fields of
+// pool.dataset.permission
+type aclRequest struct {
+	Path    string        `json:"path"`
+	DACL    []interface{} `json:"dacl"`
+	ACLType string        `json:"acltype"`
+	UID     *int64        `json:"uid"`
+	GID     *int64        `json:"gid"`
+	Options struct {
+		StripACL  bool `json:"stripacl"`
+		Recursive bool `json:"recursive"`
+		Traverse  bool `json:"traverse"`
+	} `json:"options"`
+}
+
+// setACL serves the /filesystem/setacl job
+func (s *Server) setACL(body []byte) (interface{}, *Error) {
+	var data aclRequest
+	if err := json.Unmarshal(body, &data); err != nil || data.Path == "" {
+		return nil, errValidation("filesystem_acl.path", "Path is required")
+	}
+	if apiErr := s.applyACL(data, "filesystem_acl"); apiErr != nil {
+		return nil, apiErr
+	}
+	return s.startJob("filesystem.setacl", nil), nil
+}
+
+// applyACL validates an ACL and sets it on the targets of its path. field
+// prefixes the attributes of validation errors.
+func (s *Server) applyACL(data aclRequest, field string) *Error {
+	if s.pathAttrs(data.Path) == nil {
+		return errNoEntry(data.Path)
+	}
+
+	acltype := s.pathACLType(data.Path)
+	if acltype == "DISABLED" {
+		return errCall(fmt.Sprintf("ACLs are disabled on %s", data.Path))
+	}
+	if data.ACLType != "" && data.ACLType != acltype {
+		return errValidation(field+".acltype", fmt.Sprintf("%s ACL type does not match the %s ACL type of %s", data.ACLType, acltype, data.Path))
+	}
+	if apiErr := s.checkOwner(data.UID, data.GID, field); apiErr != nil {
+		return apiErr
+	}
+
+	var entries []interface{}
+	if !data.Options.StripACL {
+		if len(data.DACL) == 0 {
+			return errValidation(field+".dacl", "At least one entry is required")
+		}
+		var apiErr *Error
+		if acltype == "NFS4" {
+			entries, apiErr = s.normalizeNFS4(data.DACL, field+".dacl")
+		} else {
+			entries, apiErr = s.normalizePOSIX1E(data.DACL, field+".dacl")
+		}
+		if apiErr != nil {
+			return apiErr
+		}
+	}
+
+	for _, target := range s.pathTargets(data.Path, data.Options.Recursive, data.Options.Traverse) {
+		attrs := s.pathAttrs(target)
+		attrs.acl = entries
+		if data.UID != nil {
+			attrs.uid = *data.UID
+		}
+		if data.GID != nil {
+			attrs.gid = *data.GID
+		}
+	}
+	return nil
+}
+
+// checkOwner checks that the given user and group exist
+func (s *Server) checkOwner(uid, gid *int64, field string) *Error {
+	if uid != nil && s.accountName("user", "uid", "username", *uid) == nil {
+		return errValidation(field+".uid", fmt.Sprintf("User %d does not exist", *uid))
+	}
+	if gid != nil && s.accountName("group", "gid", "name", *gid) == nil {
+		return errValidation(field+".gid", fmt.Sprintf("Group %d does not exist", *gid))
+	}
+	return nil
+}
+
+// entryAccount resolves the id or who of a USER or GROUP entry to an ID
+func (s *Server) entryAccount(entry object, field string) (int64, *Error) {
+	namespace, idField, nameField, label := "user", "uid", "username", "User"
+	if str(entry, "tag") == "GROUP" {
+		namespace, idField, nameField, label = "group", "gid", "name", "Group"
+	}
+
+	if who := str(entry, "who"); who != "" {
+		if who == "root" {
+			return 0, nil
+		}
+		for _, account := range s.collections[namespace].objects {
+			if str(account, nameField) == who {
+				id, _ := jsonNumber(account[idField])
+				return id, nil
+			}
+		}
+		return 0, errValidation(field+".who", fmt.Sprintf("%s does not exist", who))
+	}
+
+	id, ok := jsonNumber(entry["id"])
+	if !ok {
+		return 0, errValidation(field+".id", "An id or who is required for USER and GROUP entries")
+	}
+	if s.accountName(namespace, idField, nameField, id) == nil {
+		return 0, errValidation(field+".id", fmt.Sprintf("%s %d does not exist", label, id))
+	}
+	return id, nil
+}
+
+// normalizeNFS4 validates NFSv4 entries and expands their basic permissions
+// and flags into the advanced form
+func (s *Server) normalizeNFS4(dacl []interface{}, field string) ([]interface{}, *Error) {
+	entries := make([]interface{}, 0, len(dacl))
+	for i, raw := range dacl {
+		entry, _ := raw.(map[string]interface{})
+		entryField := field + "." + strconv.Itoa(i)
+		tag := str(entry, "tag")
+		if !nfs4Tags[tag] {
+			return nil, errValidation(entryField+".tag", fmt.Sprintf("Invalid choice: %s", tag))
+		}
+		if t := str(entry, "type"); t != "ALLOW" && t != "DENY" {
+			return nil, errValidation(entryField+".type", fmt.Sprintf("Invalid choice: %s", t))
+		}
+
+		normalized := object{"tag": tag, "id": nil, "type": str(entry, "type")}
+		if tag == "USER" || tag == "GROUP" {
+			id, apiErr := s.entryAccount(entry, entryField)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			normalized["id"] = id
+		}
+
+		var apiErr *Error
+		if normalized["perms"], apiErr = expandNFS4(entry["perms"], nfs4Perms, nfs4BasicPerms, entryField+".perms"); apiErr != nil {
+			return nil, apiErr
+		}
+		if normalized["flags"], apiErr = expandNFS4(entry["flags"], nfs4Flags, nfs4BasicFlags, entryField+".flags"); apiErr != nil {
+			return nil, apiErr
+		}
+		entries = append(entries, normalized)
+	}
+	return entries, nil
+}
+
+// expandNFS4 returns the advanced form of NFSv4 permissions or flags given
+// either as a basic set or as advanced keys
+func expandNFS4(v interface{}, keys []string, basic map[string][]string, field string) (object, *Error) {
+	given, _ := v.(map[string]interface{})
+	set := map[string]bool{}
+	if name, ok := given["BASIC"]; ok {
+		members, ok := basic[fmt.Sprint(name)]
+		if !ok {
+			return nil, errValidation(field+".BASIC", fmt.Sprintf("Invalid choice: %v", name))
+		}
+		for _, key := range members {
+			set[key] = true
+		}
+		return boolMap(keys, set), nil
+	}
+
+	valid := map[string]bool{}
+	for _, key := range keys {
+		valid[key] = true
+	}
+	for key, on := range given {
+		if !valid[key] {
+			return nil, errValidation(field+"."+key, "Field was not expected")
+		}
+		set[key], _ = on.(bool)
+	}
+	return boolMap(keys, set), nil
+}
+
+// normalizePOSIX1E validates POSIX.1e entries: the access entries, and the
+// default entries if there are any, need USER_OBJ, GROUP_OBJ and OTHER, and
+// a MASK when they name users or groups
+func (s *Server) normalizePOSIX1E(dacl []interface{}, field string) ([]interface{}, *Error) {
+	entries := make([]interface{}, 0, len(dacl))
+	tags := map[bool]map[string]bool{false: {}, true: {}}
+	for i, raw := range dacl {
+		entry, _ := raw.(map[string]interface{})
+		entryField := field + "." + strconv.Itoa(i)
+		tag := str(entry, "tag")
+		if !posix1eTags[tag] {
+			return nil, errValidation(entryField+".tag", fmt.Sprintf("Invalid choice: %s", tag))
+		}
+		isDefault, _ := entry["default"].(bool)
+
+		normalized := object{"tag": tag, "id": -1, "default": isDefault}
+		if tag == "USER" || tag == "GROUP" {
+			id, apiErr := s.entryAccount(entry, entryField)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			normalized["id"] = id
+		}
+
+		given, _ := entry["perms"].(map[string]interface{})
+		perms := object{}
+		for _, perm := range []string{"READ", "WRITE", "EXECUTE"} {
+			on, ok := given[perm].(bool)
+			if !ok {
+				return nil, errValidation(entryField+".perms."+perm, "This field is required")
+			}
+			perms[perm] = on
+		}
+		normalized["perms"] = perms
+
+		tags[isDefault][tag] = true
+		entries = append(entries, normalized)
+	}
+
+	for _, isDefault := range []bool{false, true} {
+		present := tags[isDefault]
+		if isDefault && len(present) == 0 {
+			continue
+		}
+		for _, tag := range []string{"USER_OBJ", "GROUP_OBJ", "OTHER"} {
+			if !present[tag] {
+				return nil, errValidation(field, fmt.Sprintf("%s entry is required", tag))
+			}
+		}
+		if (present["USER"] || present["GROUP"]) && !present["MASK"] {
+			return nil, errValidation(field, "MASK entry is required when the ACL names users or groups")
+		}
+	}
+	return entries, nil
+}
+
+// permissionRequest is the body of /filesystem/setperm and
+// /filesystem/chown, and the mode fields of pool.dataset.permission
+type permissionRequest struct {
+	Path    string  `json:"path"`
+	Mode    *string `json:"mode"`
+	UID     *int64  `json:"uid"`
+	GID     *int64  `json:"gid"`
+	Options struct {
+		StripACL  bool `json:"stripacl"`
+		Recursive bool `json:"recursive"`
+		Traverse  bool `json:"traverse"`
+	} `json:"options"`
+}
+
+// applyPermissions validates a mode and owner and sets them on the targets
+// of a path. Changing the mode of a path with a non-trivial ACL requires
+// stripacl, which removes the ACL.
+func (s *Server) applyPermissions(data permissionRequest, field string) *Error {
+	attrs := s.pathAttrs(data.Path)
+	if attrs == nil {
+		return errNoEntry(data.Path)
+	}
+
+	var mode int64
+	if data.Mode != nil {
+		var err error
+		if mode, err = strconv.ParseInt(*data.Mode, 8, 64); err != nil || mode > 0o7777 {
+			return errValidation(field+".mode", fmt.Sprintf("%q is not a valid mode", *data.Mode))
+		}
+		if attrs.acl != nil && !data.Options.StripACL {
+			return errCall(fmt.Sprintf("Non-trivial ACL present on [%s]. Option \"stripacl\" required to change permission.", data.Path))
+		}
+	}
+	if apiErr := s.checkOwner(data.UID, data.GID, field); apiErr != nil {
+		return apiErr
+	}
+
+	for _, target := range s.pathTargets(data.Path, data.Options.Recursive, data.Options.Traverse) {
+		attrs := s.pathAttrs(target)
+		if data.Options.StripACL {
+			attrs.acl = nil
+		}
+		if data.Mode != nil {
+			attrs.mode = mode
+		}
+		if data.UID != nil {
+			attrs.uid = *data.UID
+		}
+		if data.GID != nil {
+			attrs.gid = *data.GID
+		}
+	}
+	return nil
+}
+
+// chownFile serves the /filesystem/chown job
+func (s *Server) chownFile(body []byte) (interface{}, *Error) {
+	var data permissionRequest
+	if err := json.Unmarshal(body, &data); err != nil || data.Path == "" {
+		return nil, errValidation("filesystem_chown.path", "Path is required")
+	}
+	if data.UID == nil && data.GID == nil {
+		return nil, errValidation("filesystem_chown.uid", "At least one of uid and gid is required")
+	}
+	// chown leaves the mode and ACL alone
+	data.Mode = nil
+	data.Options.StripACL = false
+	if apiErr := s.applyPermissions(data, "filesystem_chown"); apiErr != nil {
+		return nil, apiErr
+	}
+	return s.startJob("filesystem.chown", nil), nil
+}
+
+// datasetPermission serves the pool.dataset.permission job, which sets the
+// ACL or the mode and owner of the mountpoint of a dataset
+func (s *Server) datasetPermission(obj, params object) (interface{}, *Error) {
+	mountpoint := str(obj, "mountpoint")
+	if mountpoint == "" {
+		return nil, errCall(fmt.Sprintf("%s is not a filesystem", str(obj, "name")))
+	}
+
+	body, _ := json.Marshal(params)
+	if acl, _ := params["acl"].([]interface{}); len(acl) > 0 {
+		var data aclRequest
+		if err := json.Unmarshal(body, &data); err != nil {
+			return nil, errCall(fmt.Sprintf("Invalid JSON body: %s", err))
+		}
+		data.Path = mountpoint
+		data.DACL = acl
+		if apiErr := s.applyACL(data, "pool_dataset_permission"); apiErr != nil {
+			return nil, apiErr
+		}
+		return s.startJob("pool.dataset.permission", nil), nil
+	}
+
+	var data permissionRequest
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, errCall(fmt.Sprintf("Invalid JSON body: %s", err))
+	}
+	data.Path = mountpoint
+	if apiErr := s.applyPermissions(data, "pool_dataset_permission"); apiErr != nil {
+		return nil, apiErr
+	}
+	return s.startJob("pool.dataset.permission", nil), nil
+}
+
+// builtinUsersGID and builtinAdministratorsGID are the groups
+// ensure_builtins adds to ACL templates
+const (
+	builtinUsersGID          = 545
+	builtinAdministratorsGID = 544
+)
+
+func aclTemplateCollection() *collection {
+	validate := func(s *Server, obj object, verb string) *Error {
+		field := "filesystem_acltemplate_" + verb
+		acltype := str(obj, "acltype")
+		if acltype != "NFS4" && acltype != "POSIX1E" {
+			return errValidation(field+".acltype", fmt.Sprintf("Invalid choice: %s", acltype))
+		}
+		dacl, _ := obj["acl"].([]interface{})
+		if len(dacl) == 0 {
+			return errValidation(field+".acl", "At least one entry is required")
+		}
+		var apiErr *Error
+		if acltype == "NFS4" {
+			_, apiErr = s.normalizeNFS4(dacl, field+".acl")
+		} else {
+			_, apiErr = s.normalizePOSIX1E(dacl, field+".acl")
+		}
+		return apiErr
+	}
+
+	return &collection{
+		name:     "filesystem/acltemplate",
+		schema:   "filesystem_acltemplate",
+		required: []string{"name", "acltype"},
+		unique:   []string{"name"},
+		defaults: func() object {
+			return object{"comment": "", "acl": []interface{}{}}
+		},
+		create: func(s *Server, obj object) *Error {
+			obj["builtin"] = false
+			return validate(s, obj, "create")
+		},
+		update: func(s *Server, obj, params object) *Error {
+			if builtin, _ := obj["builtin"].(bool); builtin {
+				return errValidation("filesystem_acltemplate_update.builtin", "Built-in ACL templates may not be changed")
+			}
+			delete(params, "builtin")
+			merged := copyObject(obj)
+			for k, v := range params {
+				merged[k] = v
+			}
+			if apiErr := validate(s, merged, "update"); apiErr != nil {
+				return apiErr
+			}
+			for k, v := range params {
+				obj[k] = v
+			}
+			return nil
+		},
+		remove: func(s *Server, obj, params object) *Error {
+			if builtin, _ := obj["builtin"].(bool); builtin {
+				return errCall("Deletion of builtin templates is not permitted")
+			}
+			return nil
+		},
+	}
+}
+
+// seedACLTemplates adds some of the built-in templates TrueNAS ships
+func (s *Server) seedACLTemplates() {
+	nfs4 := func(tag, perms, flags string) object {
+		return object{"tag": tag, "id": nil, "type": "ALLOW", "perms": object{"BASIC": perms}, "flags": object{"BASIC": flags}}
+	}
+	posix1e := func(tag string, write, execute, isDefault bool) object {
+		return object{"tag": tag, "id": -1, "perms": object{"READ": true, "WRITE": write, "EXECUTE": execute}, "default": isDefault}
+	}
+	posixACL := func(other bool) []interface{} {
+		var entries []interface{}
+		for _, isDefault := range []bool{false, true} {
+			entries = append(entries,
+				posix1e("USER_OBJ", true, true, isDefault),
+				posix1e("GROUP_OBJ", true, true, isDefault),
+				object{"tag": "OTHER", "id": -1, "perms": object{"READ": other, "WRITE": false, "EXECUTE": other}, "default": isDefault},
+			)
+		}
+		return entries
+	}
+
+	c := s.collections["filesystem/acltemplate"]
+	for _, template := range []object{
+		{"name": "NFS4_OPEN", "acltype": "NFS4", "comment": "", "acl": []interface{}{
+			nfs4("owner@", "FULL_CONTROL", "INHERIT"),
+			nfs4("group@", "FULL_CONTROL", "INHERIT"),
+			nfs4("everyone@", "MODIFY", "INHERIT"),
+		}},
+		{"name": "NFS4_RESTRICTED", "acltype": "NFS4", "comment": "", "acl": []interface{}{
+			nfs4("owner@", "FULL_CONTROL", "INHERIT"),
+			nfs4("group@", "FULL_CONTROL", "INHERIT"),
+		}},
+		{"name": "NFS4_HOME", "acltype": "NFS4", "comment": "", "acl": []interface{}{
+			nfs4("owner@", "FULL_CONTROL", "INHERIT"),
+			nfs4("group@", "MODIFY", "INHERIT"),
+			nfs4("everyone@", "TRAVERSE", "NOINHERIT"),
+		}},
+		{"name": "POSIX_OPEN", "acltype": "POSIX1E", "comment": "", "acl": posixACL(true)},
+		{"name": "POSIX_RESTRICTED", "acltype": "POSIX1E", "comment": "", "acl": posixACL(false)},
+	} {
+		c.nextID++
+		template["id"] = c.nextID
+		template["builtin"] = true
+		c.objects[fmt.Sprint(c.nextID)] = template
+	}
+}
+
+// aclTemplatesByPath serves /filesystem/acltemplate/by_path. With a path,
+// only the templates of its ACL type are returned.
+func (s *Server) aclTemplatesByPath(body []byte) (interface{}, *Error) {
+	data := struct {
+		Path    string          `json:"path"`
+		Filters [][]interface{} `json:"query-filters"`
+		Format  struct {
+			Canonicalize   bool `json:"canonicalize"`
+			EnsureBuiltins bool `json:"ensure_builtins"`
+			ResolveNames   bool `json:"resolve_names"`
+		} `json:"format-options"`
+	}{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &data); err != nil {
+			return nil, errCall(fmt.Sprintf("Invalid JSON body: %s", err))
+		}
+	}
+
+	filters := data.Filters
+	if data.Path != "" {
+		if s.pathAttrs(data.Path) == nil {
+			return nil, errNoEntry(data.Path)
+		}
+		acltype := s.pathACLType(data.Path)
+		if acltype == "DISABLED" {
+			return []interface{}{}, nil
+		}
+		if acltype == "POSIX1E" && data.Format.Canonicalize {
+			return nil, errValidation("filesystem.acltemplate_by_path.format-options.canonicalize", "POSIX1E ACLs may not be sorted into Windows canonical order.")
+		}
+		filters = append(filters, []interface{}{"acltype", "=", acltype})
+	} else if data.Format.ResolveNames {
+		return nil, errValidation("filesystem.acltemplate_by_path.format-options.resolve_names", "ACL entry ids may not be resolved into names unless path is provided.")
+	}
+
+	c := s.collections["filesystem/acltemplate"]
+	templates := []interface{}{}
+	for _, key := range sortedKeys(c.objects) {
+		template := copyObject(c.objects[key])
+		matches := true
+		for _, filter := range filters {
+			if len(filter) != 3 || filter[1] != "=" {
+				return nil, errValidation("filesystem.acltemplate_by_path.query-filters", fmt.Sprintf("Unsupported filter: %v", filter))
+			}
+			matches = matches && fmt.Sprint(template[fmt.Sprint(filter[0])]) == fmt.Sprint(filter[2])
+		}
+		if !matches {
+			continue
+		}
+
+		entries, _ := template["acl"].([]interface{})
+		if data.Format.EnsureBuiltins {
+			entries = ensureBuiltins(str(template, "acltype"), entries)
+		}
+		for _, raw := range entries {
+			entry, _ := raw.(map[string]interface{})
+			if tag := str(entry, "tag"); data.Format.ResolveNames && (tag == "USER" || tag == "GROUP") {
+				s.resolveEntryName(entry)
+			}
+		}
+		if data.Format.Canonicalize && str(template, "acltype") == "NFS4" {
+			sort.SliceStable(entries, func(i, j int) bool {
+				return canonicalRank(entries[i]) < canonicalRank(entries[j])
+			})
+		}
+		template["acl"] = entries
+		templates = append(templates, template)
+	}
+	return templates, nil
+}
+
+// ensureBuiltins adds entries for the builtin_users and
+// builtin_administrators groups to template entries that have none
+func ensureBuiltins(acltype string, entries []interface{}) []interface{} {
+	has := map[int64]bool{}
+	hasMask := map[bool]bool{}
+	for _, raw := range entries {
+		entry, _ := raw.(map[string]interface{})
+		if id, ok := jsonNumber(entry["id"]); ok && str(entry, "tag") == "GROUP" {
+			has[id] = true
+		}
+		if str(entry, "tag") == "MASK" {
+			isDefault, _ := entry["default"].(bool)
+			hasMask[isDefault] = true
+		}
+	}
+
+	for _, builtin := range []struct {
+		gid   int64
+		perms string
+	}{{builtinUsersGID, "MODIFY"}, {builtinAdministratorsGID, "FULL_CONTROL"}} {
+		if has[builtin.gid] {
+			continue
+		}
+		if acltype == "NFS4" {
+			entries = append(entries, object{"tag": "GROUP", "id": builtin.gid, "type": "ALLOW", "perms": object{"BASIC": builtin.perms}, "flags": object{"BASIC": "INHERIT"}})
+			continue
+		}
+		for _, isDefault := range []bool{false, true} {
+			entries = append(entries, object{"tag": "GROUP", "id": builtin.gid, "perms": object{"READ": true, "WRITE": true, "EXECUTE": true}, "default": isDefault})
+		}
+	}
+	if acltype == "POSIX1E" {
+		for _, isDefault := range []bool{false, true} {
+			if !hasMask[isDefault] {
+				entries = append(entries, object{"tag": "MASK", "id": -1, "perms": object{"READ": true, "WRITE": true, "EXECUTE": true}, "default": isDefault})
+			}
+		}
+	}
+	return entries
+}
+
+// canonicalRank orders NFSv4 entries as Windows expects: explicit DENY,
+// explicit ALLOW, inherited DENY, then inherited ALLOW
+func canonicalRank(raw interface{}) int {
+	entry, _ := raw.(map[string]interface{})
+	rank := 0
+	if flags, _ := entry["flags"].(map[string]interface{}); flags["INHERITED"] == true {
+		rank += 2
+	}
+	if str(entry, "type") != "DENY" {
+		rank++
+	}
+	return rank
+}
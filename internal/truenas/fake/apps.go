@@ -0,0 +1,46 @@
+package fake
+
+func chartReleaseCollection() *collection {
+	return &collection{
+		name:     "chart/release",
+		schema:   "chart_release",
+		jobs:     true,
+		required: []string{"release_name", "catalog", "train", "item"},
+		defaults: func() object {
+			return object{
+				"version": "latest",
+				"values":  object{},
+			}
+		},
+		key: func(obj object) (interface{}, *Error) {
+			return str(obj, "release_name"), nil
+		},
+		create: func(s *Server, obj object) *Error {
+			obj["name"] = obj["release_name"]
+			obj["catalog_train"] = obj["train"]
+			obj["chart_metadata"] = object{"name": obj["item"], "version": obj["version"]}
+			obj["config"] = obj["values"]
+			obj["status"] = "ACTIVE"
+			for _, field := range []string{"release_name", "train", "item", "version", "values"} {
+				delete(obj, field)
+			}
+			return nil
+		},
+		update: func(s *Server, obj, params object) *Error {
+			if version, ok := params["version"]; ok {
+				obj["chart_metadata"].(map[string]interface{})["version"] = version
+			}
+			if values, ok := params["values"].(map[string]interface{}); ok {
+				config, _ := obj["config"].(map[string]interface{})
+				if config == nil {
+					config = map[string]interface{}{}
+				}
+				for k, v := range values {
+					config[k] = v
+				}
+				obj["config"] = config
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,244 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// object is a stored API object
+type object = map[string]interface{}
+
+// actionFunc handles POST /<namespace>/id/<id>/<action>
+type actionFunc func(s *Server, obj, params object) (interface{}, *Error)
+
+// collection is the in-memory state of an API namespace such as
+// sharing/nfs, with hooks for the namespace's defaults, validation and
+// response shape
+type collection struct {
+	// name is the API namespace, e.g. sharing/nfs
+	name string
+
+	// schema prefixes the field names of validation errors, e.g.
+	// sharingnfs_create.path for schema sharingnfs
+	schema string
+
+	// jobs makes create, update and delete run as jobs
+	jobs bool
+
+	// defaults returns the fields of a new object the request may omit
+	defaults func() object
+
+	// required fields of a create request
+	required []string
+
+	// unique fields, which no two objects may share
+	unique []string
+
+	// key returns the ID of a new object; nil allocates sequential integers
+	key func(obj object) (interface{}, *Error)
+
+	// create validates and completes a new object before it is stored
+	create func(s *Server, obj object) *Error
+
+	// update applies an update request; nil merges the request into the
+	// object
+	update func(s *Server, obj, params object) *Error
+
+	// render converts a copy of the stored object into the API response
+	render func(s *Server, obj object) object
+
+	// remove validates a delete request and removes dependent state
+	remove func(s *Server, obj, params object) *Error
+
+	actions map[string]actionFunc
+
+	objects map[string]object
+	nextID  int64
+}
+
+// createObject stores a new object built from a create request
+func (c *collection) createObject(s *Server, params object) (object, *Error) {
+	obj := object{}
+	if c.defaults != nil {
+		obj = c.defaults()
+	}
+	for k, v := range copyObject(params) {
+		obj[k] = v
+	}
+
+	for _, field := range c.required {
+		if v, ok := obj[field]; !ok || v == nil || v == "" {
+			return nil, errValidation(c.schema+"_create."+field, "attribute required")
+		}
+	}
+	if apiErr := c.checkUnique(obj, "", "create"); apiErr != nil {
+		return nil, apiErr
+	}
+
+	var id interface{}
+	if c.key != nil {
+		var apiErr *Error
+		if id, apiErr = c.key(obj); apiErr != nil {
+			return nil, apiErr
+		}
+		if _, exists := c.objects[fmt.Sprint(id)]; exists {
+			return nil, errValidation(c.schema+"_create.name", fmt.Sprintf("%s already exists", id))
+		}
+	} else {
+		c.nextID++
+		id = c.nextID
+	}
+	obj["id"] = id
+
+	if c.create != nil {
+		if apiErr := c.create(s, obj); apiErr != nil {
+			return nil, apiErr
+		}
+	}
+
+	c.objects[fmt.Sprint(id)] = obj
+	return obj, nil
+}
+
+// updateObject applies an update request to a stored object
+func (c *collection) updateObject(s *Server, id string, params object) (object, *Error) {
+	obj, ok := c.objects[id]
+	if !ok {
+		return nil, errNotFound(c.name, id)
+	}
+
+	params = copyObject(params)
+	delete(params, "id")
+
+	if apiErr := c.checkUnique(params, id, "update"); apiErr != nil {
+		return nil, apiErr
+	}
+
+	if c.update != nil {
+		if apiErr := c.update(s, obj, params); apiErr != nil {
+			return nil, apiErr
+		}
+		return obj, nil
+	}
+
+	for k, v := range params {
+		obj[k] = v
+	}
+	return obj, nil
+}
+
+// deleteObject removes a stored object
+func (c *collection) deleteObject(s *Server, id string, params object) *Error {
+	obj, ok := c.objects[id]
+	if !ok {
+		return errNotFound(c.name, id)
+	}
+
+	if c.remove != nil {
+		if apiErr := c.remove(s, obj, params); apiErr != nil {
+			return apiErr
+		}
+	}
+
+	delete(c.objects, id)
+	return nil
+}
+
+// checkUnique returns a validation error if a unique field of obj is
+// already used by an object other than the one with ID self
+func (c *collection) checkUnique(obj object, self, verb string) *Error {
+	for _, field := range c.unique {
+		value, ok := obj[field]
+		if !ok {
+			continue
+		}
+		for id, other := range c.objects {
+			if id != self && fmt.Sprint(other[field]) == fmt.Sprint(value) {
+				return errValidation(fmt.Sprintf("%s_%s.%s", c.schema, verb, field), fmt.Sprintf("Object with this %s already exists", field))
+			}
+		}
+	}
+	return nil
+}
+
+// renderObject returns the API response for a stored object
+func (c *collection) renderObject(s *Server, obj object) object {
+	out := copyObject(obj)
+	if c.render != nil {
+		out = copyObject(c.render(s, out))
+	}
+	return out
+}
+
+// list returns the rendered objects matching the query filters
+func (c *collection) list(s *Server, query url.Values) []object {
+	result := []object{}
+	for _, id := range sortedKeys(c.objects) {
+		obj := c.renderObject(s, c.objects[id])
+		if matchesQuery(obj, query) {
+			result = append(result, obj)
+		}
+	}
+	return result
+}
+
+// copyObject deep copies an object through JSON, which also normalises
+// numbers to float64 as they are after decoding a request
+func copyObject(obj object) object {
+	if obj == nil {
+		return object{}
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		panic(err)
+	}
+	var out object
+	if err := json.Unmarshal(data, &out); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// newCollections returns the namespaces served by the fake
+func newCollections() map[string]*collection {
+	collections := []*collection{
+		poolCollection(),
+		datasetCollection(),
+		snapshotCollection(),
+		snapshotTaskCollection(),
+		replicationCollection(),
+		nfsShareCollection(),
+		smbShareCollection(),
+		iscsiPortalCollection(),
+		iscsiTargetCollection(),
+		iscsiExtentCollection(),
+		userCollection(),
+		groupCollection(),
+		staticRouteCollection(),
+		interfaceCollection(),
+		vmCollection(),
+		vmDeviceCollection(),
+		chartReleaseCollection(),
+		aclTemplateCollection(),
+	}
+
+	byName := make(map[string]*collection, len(collections))
+	for _, c := range collections {
+		c.objects = make(map[string]object)
+		byName[c.name] = c
+	}
+	return byName
+}
+
+// lookup returns a stored object of another collection
+func (s *Server) lookup(namespace string, id interface{}) (object, bool) {
+	obj, ok := s.collections[namespace].objects[fmt.Sprint(id)]
+	return obj, ok
+}
+
+// str returns a string field, or "" if it is missing or not a string
+func str(obj object, field string) string {
+	v, _ := obj[field].(string)
+	return v
+}
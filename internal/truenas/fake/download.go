@@ -0,0 +1,65 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// downloadPrefix is the path of the files of core.download jobs
+const downloadPrefix = "/_download/"
+
+// downloadMethods produce the output of the jobs core.download can run
+var downloadMethods = map[string]func(s *Server, args []interface{}) (interface{}, *Error){
+	"pool.dataset.export_keys":                 (*Server).exportDatasetKeys,
+	"pool.dataset.export_keys_for_replication": (*Server).exportReplicationKeys,
+}
+
+// coreDownload serves core.download: it runs a job whose output is a file
+// and returns the job ID with the URL to fetch the file from
+func (s *Server) coreDownload(body []byte) (interface{}, *Error) {
+	var req struct {
+		Method   string        `json:"method"`
+		Args     []interface{} `json:"args"`
+		Filename string        `json:"filename"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, errCall(fmt.Sprintf("Invalid JSON body: %s", err))
+	}
+
+	output, ok := downloadMethods[req.Method]
+	if !ok {
+		return nil, errCall(fmt.Sprintf("%s does not support downloads", req.Method))
+	}
+	result, apiErr := output(s, req.Args)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	content, err := json.Marshal(result)
+	if err != nil {
+		return nil, errCall(err.Error())
+	}
+
+	id := s.startJob(req.Method, nil)
+	s.downloads[id] = content
+	return []interface{}{id, fmt.Sprintf("%s%d?auth_token=fake", downloadPrefix, id)}, nil
+}
+
+// serveDownload serves the file of a core.download job, once
+func (s *Server) serveDownload(w http.ResponseWriter, rawPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(rawPath, downloadPrefix), 10, 64)
+	content, ok := s.downloads[id]
+	if err != nil || !ok {
+		http.NotFound(w, nil)
+		return
+	}
+	delete(s.downloads, id)
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(content)
+}
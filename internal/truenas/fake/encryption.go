@@ -0,0 +1,423 @@
+package fake
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Key formats of encrypted datasets
+const (
+	keyFormatHex        = "HEX"
+	keyFormatPassphrase = "PASSPHRASE"
+)
+
+// defaultPBKDF2Iters is the number of PBKDF2 iterations of a passphrase
+// when the request does not set one
+const defaultPBKDF2Iters = 350000
+
+var hexKeyPattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+var encryptionAlgorithms = map[string]bool{
+	"AES-128-CCM": true, "AES-192-CCM": true, "AES-256-CCM": true,
+	"AES-128-GCM": true, "AES-192-GCM": true, "AES-256-GCM": true,
+}
+
+// unlockServicesRestartChoices are the services that
+// pool.dataset.unlock can restart, by identifier
+var unlockServicesRestartChoices = map[string]string{
+	"cifs":        "SMB",
+	"ftp":         "FTP",
+	"iscsitarget": "iSCSI",
+	"nfs":         "NFS",
+	"webdav":      "WebDAV",
+	"vms":         "Virtual Machines",
+}
+
+// encryptionRoot is the encryption of a dataset that has its own key. The
+// key material is kept out of the dataset objects so that it is never
+// rendered in API responses.
+type encryptionRoot struct {
+	algorithm   string
+	format      string
+	key         string
+	passphrase  string
+	pbkdf2iters int64
+	locked      bool
+}
+
+// createDatasetEncryption applies the encryption request fields of a new
+// dataset. Datasets with encryption enabled become encryption roots, and
+// the others inherit the encryption of their parent.
+func (s *Server) createDatasetEncryption(obj object, parent object) *Error {
+	encryption, _ := obj["encryption"].(bool)
+	inherit := true
+	if v, ok := obj["inherit_encryption"].(bool); ok {
+		inherit = v
+	}
+	options, _ := obj["encryption_options"].(map[string]interface{})
+	delete(obj, "encryption")
+	delete(obj, "inherit_encryption")
+	delete(obj, "encryption_options")
+
+	parentRoot, _ := parent["encryption_root"].(string)
+	if !encryption {
+		if parentRoot != "" && !inherit {
+			return errValidation("pool_dataset_create.encryption", "Cannot create an unencrypted dataset within an encrypted dataset")
+		}
+		if parentRoot != "" {
+			if s.encryptionRoots[parentRoot].locked {
+				return errCall(fmt.Sprintf("%s must be unlocked to create a child dataset", parentRoot))
+			}
+			obj["encryption_root"] = parentRoot
+		} else {
+			obj["encryption_root"] = nil
+		}
+		return nil
+	}
+
+	if inherit {
+		return errValidation("pool_dataset_create.inherit_encryption", "Must be disabled when encryption is enabled")
+	}
+
+	root := &encryptionRoot{algorithm: "AES-256-GCM"}
+	if algorithm, ok := options["algorithm"].(string); ok {
+		if !encryptionAlgorithms[algorithm] {
+			return errValidation("pool_dataset_create.encryption_options.algorithm", "Invalid choice")
+		}
+		root.algorithm = algorithm
+	}
+	if apiErr := setEncryptionKey(root, "pool_dataset_create.encryption_options", options); apiErr != nil {
+		return apiErr
+	}
+
+	name := str(obj, "name")
+	obj["encryption_root"] = name
+	s.encryptionRoots[name] = root
+	return nil
+}
+
+// setEncryptionKey sets the key of an encryption root from the
+// generate_key, key, passphrase and pbkdf2iters options
+func setEncryptionKey(root *encryptionRoot, schema string, options map[string]interface{}) *Error {
+	generate, _ := options["generate_key"].(bool)
+	key, _ := options["key"].(string)
+	passphrase, _ := options["passphrase"].(string)
+
+	set := 0
+	for _, ok := range []bool{generate, key != "", passphrase != ""} {
+		if ok {
+			set++
+		}
+	}
+	switch {
+	case set == 0:
+		return errValidation(schema+".generate_key", "One of generate_key, key or passphrase must be specified")
+	case set > 1:
+		return errValidation(schema+".generate_key", "Only one of generate_key, key or passphrase can be specified")
+	}
+
+	switch {
+	case passphrase != "":
+		if len(passphrase) < 8 {
+			return errValidation(schema+".passphrase", "Passphrase must be at least 8 characters")
+		}
+		iters := int64(defaultPBKDF2Iters)
+		if v, ok := jsonNumber(options["pbkdf2iters"]); ok {
+			if v < 100000 {
+				return errValidation(schema+".pbkdf2iters", "Should be greater than or equal to 100000")
+			}
+			iters = v
+		}
+		*root = encryptionRoot{algorithm: root.algorithm, format: keyFormatPassphrase, passphrase: passphrase, pbkdf2iters: iters}
+	case key != "":
+		if !hexKeyPattern.MatchString(key) {
+			return errValidation(schema+".key", "Key must be 64 hexadecimal characters")
+		}
+		*root = encryptionRoot{algorithm: root.algorithm, format: keyFormatHex, key: key}
+	default:
+		raw := make([]byte, 32)
+		_, _ = rand.Read(raw)
+		*root = encryptionRoot{algorithm: root.algorithm, format: keyFormatHex, key: hex.EncodeToString(raw)}
+	}
+	return nil
+}
+
+// renderDatasetEncryption adds the encryption fields and properties of a
+// dataset to its API response
+func (s *Server) renderDatasetEncryption(obj object) {
+	rootName, _ := obj["encryption_root"].(string)
+	root, ok := s.encryptionRoots[rootName]
+	if !ok {
+		obj["encrypted"] = false
+		obj["encryption_root"] = nil
+		obj["key_loaded"] = false
+		obj["locked"] = false
+		obj["key_format"] = object{"value": nil, "rawvalue": "none", "parsed": "none", "source": "DEFAULT"}
+		obj["encryption_algorithm"] = object{"value": "off", "rawvalue": "off", "parsed": "off", "source": "DEFAULT"}
+		return
+	}
+
+	source := "INHERITED"
+	if rootName == str(obj, "name") {
+		source = "LOCAL"
+	}
+	obj["encrypted"] = true
+	obj["key_loaded"] = !root.locked
+	obj["locked"] = root.locked
+	obj["key_format"] = object{"value": root.format, "rawvalue": root.format, "parsed": root.format, "source": source}
+	obj["encryption_algorithm"] = object{"value": root.algorithm, "rawvalue": root.algorithm, "parsed": root.algorithm, "source": source}
+	iters := strconv.FormatInt(root.pbkdf2iters, 10)
+	obj["pbkdf2iters"] = object{"value": iters, "rawvalue": iters, "parsed": root.pbkdf2iters, "source": source}
+}
+
+// changeDatasetKey serves pool.dataset.change_key: it replaces the key of
+// an unlocked encryption root
+func (s *Server) changeDatasetKey(obj, params object) (interface{}, *Error) {
+	name := str(obj, "name")
+	root, ok := s.encryptionRoots[name]
+	if !ok || str(obj, "encryption_root") != name {
+		return nil, errCall(fmt.Sprintf("%s is not an encryption root", name))
+	}
+	if root.locked {
+		return nil, errCall(fmt.Sprintf("%s must be unlocked to change its key", name))
+	}
+
+	changed := *root
+	if apiErr := setEncryptionKey(&changed, "change_key_options", params); apiErr != nil {
+		return nil, apiErr
+	}
+	*root = changed
+	return s.startJob("pool.dataset.change_key", nil), nil
+}
+
+// matches reports whether the key or passphrase of an unlock option entry
+// opens the encryption root. Hex keys are kept in the database, so they
+// are used when the entry has no key material.
+func (root *encryptionRoot) matches(entry object) (bool, string) {
+	key, _ := entry["key"].(string)
+	passphrase, _ := entry["passphrase"].(string)
+	switch {
+	case root.format == keyFormatPassphrase && passphrase == "":
+		return false, "Passphrase not provided"
+	case root.format == keyFormatPassphrase:
+		if passphrase != root.passphrase {
+			return false, "Invalid Key"
+		}
+	case key != "" && key != root.key, passphrase != "":
+		return false, "Invalid Key"
+	}
+	return true, ""
+}
+
+// encryptionRootsUnder returns the names of the encryption roots at or
+// below a dataset, sorted
+func (s *Server) encryptionRootsUnder(name string) []string {
+	var names []string
+	for root := range s.encryptionRoots {
+		if root == name || strings.HasPrefix(root, name+"/") {
+			names = append(names, root)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// unlockEntries returns the entries of the datasets option of unlock and
+// encryption_summary by dataset name
+func unlockEntries(params object) map[string]object {
+	entries := map[string]object{}
+	datasets, _ := params["datasets"].([]interface{})
+	for _, v := range datasets {
+		if entry, ok := v.(map[string]interface{}); ok {
+			entries[str(entry, "name")] = entry
+		}
+	}
+	return entries
+}
+
+// unlockDataset serves pool.dataset.unlock: it loads the key of a locked
+// encryption root, and of the locked encryption roots below it when
+// recursive is set. Datasets whose key does not match are reported as
+// failed rather than failing the job.
+func (s *Server) unlockDataset(obj, params object) (interface{}, *Error) {
+	name := str(obj, "name")
+	root, ok := s.encryptionRoots[name]
+	if !ok || str(obj, "encryption_root") != name {
+		return nil, errCall(fmt.Sprintf("%s is not an encryption root", name))
+	}
+	if !root.locked {
+		return nil, errCall(fmt.Sprintf("%s dataset is not locked", name))
+	}
+
+	services, _ := params["services_restart"].([]interface{})
+	for _, service := range services {
+		if _, ok := unlockServicesRestartChoices[fmt.Sprint(service)]; !ok {
+			return nil, errValidation("unlock_options.services_restart", fmt.Sprintf("%v is not a valid service to restart", service))
+		}
+	}
+
+	targets := []string{name}
+	if recursive, _ := params["recursive"].(bool); recursive {
+		targets = s.encryptionRootsUnder(name)
+	}
+
+	entries := unlockEntries(params)
+	unlocked := []string{}
+	failed := object{}
+	for _, target := range targets {
+		root := s.encryptionRoots[target]
+		if !root.locked {
+			continue
+		}
+		if ok, reason := root.matches(entries[target]); !ok {
+			failed[target] = object{"error": reason, "skipped": []string{}}
+			continue
+		}
+		root.locked = false
+		unlocked = append(unlocked, target)
+	}
+	return s.startJob("pool.dataset.unlock", object{"unlocked": unlocked, "failed": failed}), nil
+}
+
+// lockDataset serves pool.dataset.lock: it unloads the key of an
+// encryption root and of the encryption roots below it. Only passphrase
+// keys can be locked, as hex keys are loaded from the database.
+func (s *Server) lockDataset(obj, params object) (interface{}, *Error) {
+	name := str(obj, "name")
+	root, ok := s.encryptionRoots[name]
+	if !ok || str(obj, "encryption_root") != name {
+		return nil, errCall(fmt.Sprintf("%s is not an encryption root", name))
+	}
+	if root.locked {
+		return nil, errCall(fmt.Sprintf("%s dataset is already locked", name))
+	}
+	if root.format != keyFormatPassphrase {
+		return nil, errCall("Only datasets which are encrypted with passphrase can be locked")
+	}
+
+	for _, target := range s.encryptionRootsUnder(name) {
+		s.encryptionRoots[target].locked = true
+	}
+	return s.startJob("pool.dataset.lock", true), nil
+}
+
+// encryptionSummary serves pool.dataset.encryption_summary: whether the
+// keys given in the datasets option, or those in the database, open each
+// encryption root at or below a dataset
+func (s *Server) encryptionSummary(obj, params object) (interface{}, *Error) {
+	name := str(obj, "name")
+	rootName, _ := obj["encryption_root"].(string)
+	if _, ok := s.encryptionRoots[rootName]; !ok {
+		return nil, errCall(fmt.Sprintf("%s is not encrypted", name))
+	}
+
+	names := s.encryptionRootsUnder(name)
+	if len(names) == 0 {
+		names = []string{rootName}
+	}
+
+	entries := unlockEntries(params)
+	summary := []object{}
+	for _, target := range names {
+		root := s.encryptionRoots[target]
+		valid, reason := root.matches(entries[target])
+		var unlockError interface{}
+		if !valid {
+			unlockError = reason
+		}
+		summary = append(summary, object{
+			"name":                    target,
+			"key_format":              root.format,
+			"key_present_in_database": root.format == keyFormatHex,
+			"valid_key":               valid,
+			"locked":                  root.locked,
+			"unlock_error":            unlockError,
+			"unlock_successful":       valid,
+		})
+	}
+	return s.startJob("pool.dataset.encryption_summary", summary), nil
+}
+
+// unlockServicesRestart serves pool.dataset.unlock_services_restart_choices
+func (s *Server) unlockServicesRestart(body []byte) (interface{}, *Error) {
+	var name string
+	if err := json.Unmarshal(body, &name); err != nil || name == "" {
+		return nil, errValidation("pool_dataset_unlock_services_restart_choices.dataset", "Dataset is required")
+	}
+	if _, ok := s.lookup("pool/dataset", name); !ok {
+		return nil, errNotFound("pool/dataset", name)
+	}
+	return unlockServicesRestartChoices, nil
+}
+
+// exportDatasetKey serves pool.dataset.export_key: the hex key of an
+// encryption root
+func (s *Server) exportDatasetKey(obj object) (interface{}, *Error) {
+	name := str(obj, "name")
+	root, ok := s.encryptionRoots[name]
+	if !ok || str(obj, "encryption_root") != name {
+		return nil, errCall(fmt.Sprintf("%s is not an encryption root", name))
+	}
+	if root.format != keyFormatHex {
+		return nil, errCall(fmt.Sprintf("%s is encrypted with a passphrase, which cannot be exported", name))
+	}
+	return s.startJob("pool.dataset.export_key", root.key), nil
+}
+
+// storedKeys adds the hex keys, which TrueNAS stores, of the encryption
+// roots at or below a dataset to keys
+func (s *Server) storedKeys(name string, keys map[string]string) {
+	for _, root := range s.encryptionRootsUnder(name) {
+		if s.encryptionRoots[root].format == keyFormatHex {
+			keys[root] = s.encryptionRoots[root].key
+		}
+	}
+}
+
+// exportDatasetKeys is the output of pool.dataset.export_keys: the stored
+// keys of a dataset and its children
+func (s *Server) exportDatasetKeys(args []interface{}) (interface{}, *Error) {
+	name := ""
+	if len(args) > 0 {
+		name = fmt.Sprint(args[0])
+	}
+	if _, ok := s.lookup("pool/dataset", name); !ok {
+		return nil, errNotFound("pool/dataset", name)
+	}
+	keys := map[string]string{}
+	s.storedKeys(name, keys)
+	return keys, nil
+}
+
+// exportReplicationKeys is the output of
+// pool.dataset.export_keys_for_replication: the stored keys of the source
+// datasets of a replication task and their children
+func (s *Server) exportReplicationKeys(args []interface{}) (interface{}, *Error) {
+	id := ""
+	if len(args) > 0 {
+		id = fmt.Sprint(args[0])
+	}
+	task, ok := s.lookup("replication", id)
+	if !ok {
+		return nil, errNotFound("replication", id)
+	}
+	keys := map[string]string{}
+	sources, _ := task["source_datasets"].([]interface{})
+	for _, source := range sources {
+		s.storedKeys(fmt.Sprint(source), keys)
+	}
+	return keys, nil
+}
+
+// deleteEncryptionRoots forgets the keys of deleted datasets
+func (s *Server) deleteEncryptionRoots(names ...string) {
+	for _, name := range names {
+		delete(s.encryptionRoots, name)
+	}
+}
@@ -0,0 +1,152 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Error is an API error response in one of the middleware's error shapes
+type Error struct {
+	StatusCode int
+	Body       interface{}
+}
+
+func (e *Error) Error() string {
+	body, _ := json.Marshal(e.Body)
+	return fmt.Sprintf("status %d: %s", e.StatusCode, body)
+}
+
+// Fault is a failure injected into matching requests
+type Fault struct {
+	// Method matches the request method; empty matches any method
+	Method string
+
+	// Path is a prefix of the request path without the /api/v2.0 prefix,
+	// e.g. /pool/dataset or /vm/id/1/start
+	Path string
+
+	// StatusCode and Body are the response returned instead of handling
+	// the request. StatusCode defaults to 500.
+	StatusCode int
+	Body       string
+
+	// JobError, when set, makes the request return a job that fails with
+	// this error, without applying the request, instead of returning
+	// StatusCode
+	JobError string
+
+	// Delay, when set, applies the request as usual but holds back the
+	// response for this long, like a slow middleware call that outlives
+	// the client's timeout, instead of returning StatusCode or JobError
+	Delay time.Duration
+
+	// Count is how many requests fail before the fault is cleared; zero
+	// fails every matching request until ClearFaults is called
+	Count int
+}
+
+// InjectFault makes matching requests fail until the fault is used up or
+// cleared. Faults are matched in the order they were injected.
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes all injected faults
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// matchFault returns the first fault matching the request, consuming one
+// of its uses. Delayed faults are matched only when delayed is set.
+func (s *Server) matchFault(method, path string, delayed bool) *Fault {
+	for i, f := range s.faults {
+		if (f.Delay > 0) != delayed {
+			continue
+		}
+		if f.Method != "" && f.Method != method {
+			continue
+		}
+		if !strings.HasPrefix(path, f.Path) {
+			continue
+		}
+		if f.Count > 0 {
+			f.Count--
+			if f.Count == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+// errNotFound is the error for a missing instance
+func errNotFound(namespace, id string) *Error {
+	return &Error{
+		StatusCode: http.StatusNotFound,
+		Body: map[string]interface{}{
+			"message": fmt.Sprintf("%s %s does not exist", namespace, id),
+			"errno":   2,
+			"trace":   map[string]interface{}{"class": "InstanceNotFound"},
+		},
+	}
+}
+
+// errValidation is a validation error for a single field. field is the
+// middleware's path of the field, e.g. pool_dataset_create.name.
+func errValidation(field, message string) *Error {
+	return &Error{
+		StatusCode: http.StatusUnprocessableEntity,
+		Body: map[string]interface{}{
+			field: []map[string]interface{}{
+				{"message": message, "errno": 22},
+			},
+		},
+	}
+}
+
+// errCall is a generic call error
+func errCall(message string) *Error {
+	return &Error{
+		StatusCode: http.StatusUnprocessableEntity,
+		Body: map[string]interface{}{
+			"message": message,
+			"errno":   22,
+			"trace":   map[string]interface{}{"class": "CallError"},
+		},
+	}
+}
+
+// errNoEntry is the error for a missing path on the filesystem
+func errNoEntry(path string) *Error {
+	return &Error{
+		StatusCode: http.StatusUnprocessableEntity,
+		Body: map[string]interface{}{
+			"message": fmt.Sprintf("[ENOENT] Path %s not found", path),
+			"errno":   2,
+			"trace":   map[string]interface{}{"class": "CallError"},
+		},
+	}
+}
+
+// errUnsupported is returned for endpoints the fake does not implement.
+// It uses 501 so that it is never mistaken for a missing instance.
+func errUnsupported(method, path string) *Error {
+	return &Error{
+		StatusCode: http.StatusNotImplemented,
+		Body: map[string]interface{}{
+			"message": fmt.Sprintf("fake: %s %s is not implemented", method, path),
+		},
+	}
+}
+
+func writeError(w http.ResponseWriter, e *Error) {
+	writeJSON(w, e.StatusCode, e.Body)
+}
@@ -0,0 +1,113 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// job is an emulated middleware job. The operation it stands for has
+// already been applied; only its reported state is delayed.
+type job struct {
+	id     int64
+	method string
+	result interface{}
+	err    string
+	polls  int
+}
+
+// startJob records a successful job of a middleware method, e.g.
+// pool.dataset.create, and returns its ID
+func (s *Server) startJob(method string, result interface{}) int64 {
+	j := &job{
+		id:     s.nextJobID,
+		method: method,
+		result: result,
+		polls:  s.jobPolls,
+	}
+	s.nextJobID++
+	s.jobs[j.id] = j
+	return j.id
+}
+
+// failJob records a job that fails with the given error and returns its ID
+func (s *Server) failJob(path, message string) int64 {
+	id := s.startJob(jobMethod(path), nil)
+	s.jobs[id].err = message
+	return id
+}
+
+// getJobs serves /core/get_jobs?id=<id>
+func (s *Server) getJobs(query url.Values) (interface{}, *Error) {
+	id, err := strconv.ParseInt(query.Get("id"), 10, 64)
+	if err != nil {
+		return nil, errCall(fmt.Sprintf("Invalid job id %q", query.Get("id")))
+	}
+
+	j, ok := s.jobs[id]
+	if !ok {
+		return []interface{}{}, nil
+	}
+
+	state, percent := "SUCCESS", 100
+	if j.polls > 0 {
+		j.polls--
+		state, percent = "RUNNING", 50
+	} else if j.err != "" {
+		state = "FAILED"
+	}
+
+	entry := map[string]interface{}{
+		"id":     j.id,
+		"method": j.method,
+		"state":  state,
+		"progress": map[string]interface{}{
+			"percent":     percent,
+			"description": "",
+		},
+		"result": nil,
+		"error":  nil,
+	}
+	if state == "SUCCESS" {
+		entry["result"] = j.result
+	}
+	if state == "FAILED" {
+		entry["error"] = j.err
+		entry["exception"] = "Traceback (most recent call last):\n" + j.err
+	}
+
+	return []interface{}{entry}, nil
+}
+
+// jobMethod turns an API path or namespace into a middleware method name,
+// e.g. /vm/id/1/start into vm.start
+func jobMethod(path string) string {
+	namespace, _, action := splitPath(path)
+	method := strings.ReplaceAll(namespace, "/", ".")
+	if action != "" {
+		method += "." + action
+	}
+	return method
+}
+
+// jsonNumber normalises a decoded JSON value into an int64 when it is a
+// whole number, so that IDs passed as strings or floats compare equal
+func jsonNumber(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return int64(n), n == float64(int64(n))
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	case string:
+		i, err := strconv.ParseInt(n, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
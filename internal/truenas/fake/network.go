@@ -0,0 +1,109 @@
+package fake
+
+import (
+	"fmt"
+	"strings"
+)
+
+func staticRouteCollection() *collection {
+	return &collection{
+		name:     "staticroute",
+		schema:   "staticroute",
+		required: []string{"destination", "gateway"},
+		defaults: func() object {
+			return object{"description": ""}
+		},
+	}
+}
+
+// interfacePrefixes are the name prefixes required for virtual interfaces
+var interfacePrefixes = map[string]string{
+	"VLAN":             "vlan",
+	"BRIDGE":           "br",
+	"LINK_AGGREGATION": "bond",
+}
+
+func interfaceCollection() *collection {
+	return &collection{
+		name:     "interface",
+		schema:   "interface",
+		required: []string{"name", "type"},
+		defaults: func() object {
+			return object{
+				"description":           "",
+				"ipv4_dhcp":             false,
+				"ipv6_auto":             false,
+				"aliases":               []interface{}{},
+				"mtu":                   nil,
+				"vlan_parent_interface": nil,
+				"vlan_tag":              nil,
+				"vlan_pcp":              nil,
+				"bridge_members":        []interface{}{},
+				"lag_ports":             []interface{}{},
+				"lag_protocol":          nil,
+			}
+		},
+		key: func(obj object) (interface{}, *Error) {
+			return str(obj, "name"), nil
+		},
+		create: func(s *Server, obj object) *Error {
+			name, ifType := str(obj, "name"), str(obj, "type")
+			prefix, ok := interfacePrefixes[ifType]
+			if !ok {
+				return errValidation("interface_create.type", "Invalid choice")
+			}
+			if !strings.HasPrefix(name, prefix) {
+				return errValidation("interface_create.name", fmt.Sprintf("%s interfaces must be named %s<number>", ifType, prefix))
+			}
+
+			if ifType == "VLAN" {
+				parent := str(obj, "vlan_parent_interface")
+				if _, ok := s.lookup("interface", parent); !ok {
+					return errValidation("interface_create.vlan_parent_interface", fmt.Sprintf("Interface %q not found", parent))
+				}
+				if obj["vlan_tag"] == nil {
+					return errValidation("interface_create.vlan_tag", "This field is required for VLAN interfaces")
+				}
+			}
+
+			obj["state"] = interfaceState(obj)
+			return nil
+		},
+		update: func(s *Server, obj, params object) *Error {
+			for _, field := range []string{"name", "type"} {
+				if v, ok := params[field]; ok && v != obj[field] {
+					return errValidation("interface_update."+field, "Field cannot be changed")
+				}
+			}
+			for k, v := range params {
+				obj[k] = v
+			}
+			return nil
+		},
+	}
+}
+
+// interfaceState is the runtime state reported for an interface
+func interfaceState(obj object) object {
+	return object{
+		"name":                 obj["name"],
+		"link_state":           "LINK_STATE_UP",
+		"link_address":         "00:a0:98:00:00:01",
+		"aliases":              obj["aliases"],
+		"active_media_type":    "Ethernet",
+		"active_media_subtype": "autoselect",
+	}
+}
+
+// seedPhysicalInterface adds a physical interface, which cannot be created
+// through the API
+func (s *Server) seedPhysicalInterface(name string) {
+	c := s.collections["interface"]
+	obj := c.defaults()
+	obj["id"] = name
+	obj["name"] = name
+	obj["type"] = "PHYSICAL"
+	obj["ipv4_dhcp"] = true
+	obj["state"] = interfaceState(obj)
+	c.objects[name] = obj
+}
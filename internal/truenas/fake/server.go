@@ -0,0 +1,560 @@
+// Package fake provides an in-memory implementation of the subset of the
+// TrueNAS SCALE 24.04 REST API used by the provider, for acceptance tests
+// that run without a real NAS.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const apiPrefix = "/api/v2.0"
+
+// DefaultVersion is the release reported by /system/version until changed
+// with SetVersion
+const DefaultVersion = "TrueNAS-SCALE-24.04.2"
+
+// Request is a request received by the server
+type Request struct {
+	Method string
+	// Path is the request path without the /api/v2.0 prefix
+	Path string
+	Body string
+}
+
+// Server is an httptest.Server backed by in-memory state. All exported
+// methods are safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	version     string
+	collections map[string]*collection
+	jobs        map[int64]*job
+	nextJobID   int64
+	jobPolls    int
+	files       map[string][]byte
+	fileAttrs   map[string]*fileAttrs
+	vmStates    map[string]string
+	host        HostCapacity
+	faults      []*Fault
+	requests    []Request
+
+	// encryptionRoots holds the keys of encrypted datasets by the name of
+	// their encryption root
+	encryptionRoots map[string]*encryptionRoot
+	// downloads holds the files of core.download jobs by job ID
+	downloads map[int64][]byte
+}
+
+// NewServer starts a server seeded with a pool named tank, its root
+// dataset, a physical interface named eno1 and the built-in ACL templates.
+// Callers must Close it.
+func NewServer() *Server {
+	s := &Server{
+		version:   DefaultVersion,
+		jobs:      make(map[int64]*job),
+		nextJobID: 1,
+		files:     make(map[string][]byte),
+		fileAttrs: make(map[string]*fileAttrs),
+		vmStates:  make(map[string]string),
+		host:      DefaultHostCapacity,
+
+		encryptionRoots: make(map[string]*encryptionRoot),
+		downloads:       make(map[int64][]byte),
+	}
+	s.collections = newCollections()
+
+	s.mustCreate("pool", map[string]interface{}{"name": "tank"})
+	s.mustCreate("pool/dataset", map[string]interface{}{"name": "tank"})
+	s.seedPhysicalInterface("eno1")
+	s.seedACLTemplates()
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handleDelayed))
+	return s
+}
+
+// SetVersion changes the release reported by /system/version and
+// /system/info, e.g. to TrueNAS-SCALE-24.10.0
+func (s *Server) SetVersion(version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version = version
+}
+
+// SetJobPolls makes new jobs report RUNNING for the given number of polls
+// before they finish. Jobs finish immediately by default.
+func (s *Server) SetJobPolls(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobPolls = n
+}
+
+// SetHostCapacity changes the memory, vCPUs and virtualization support of
+// the host that VMs run on
+func (s *Server) SetHostCapacity(host HostCapacity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.host = host
+}
+
+// LockDataset unloads the key of an encryption root, as a reboot of the
+// TrueNAS system does for datasets encrypted with a passphrase
+func (s *Server) LockDataset(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	root, ok := s.encryptionRoots[name]
+	if !ok {
+		return fmt.Errorf("%s is not an encryption root", name)
+	}
+	root.locked = true
+	return nil
+}
+
+// SetACL sets the ACL of a path, as if it had been changed outside
+// Terraform. dacl holds entries in the form /filesystem/setacl takes.
+func (s *Server) SetACL(path string, dacl []interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if apiErr := s.applyACL(aclRequest{Path: path, DACL: dacl}, "filesystem_acl"); apiErr != nil {
+		return fmt.Errorf("setting ACL of %s: %w", path, apiErr)
+	}
+	return nil
+}
+
+// StripACL removes the ACL of a path, as if it had been stripped outside
+// Terraform
+func (s *Server) StripACL(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attrs := s.pathAttrs(path)
+	if attrs == nil {
+		return fmt.Errorf("path %s does not exist", path)
+	}
+	attrs.acl = nil
+	return nil
+}
+
+// HasACL reports whether a path has a non-trivial ACL
+func (s *Server) HasACL(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attrs := s.pathAttrs(path)
+	return attrs != nil && attrs.acl != nil
+}
+
+// Chmod changes the mode of a path, as if it had been changed outside
+// Terraform
+func (s *Server) Chmod(path string, mode int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attrs := s.pathAttrs(path)
+	if attrs == nil {
+		return fmt.Errorf("path %s does not exist", path)
+	}
+	attrs.mode = mode
+	return nil
+}
+
+// Requests returns the requests received so far, in order
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Create adds an object to a collection, e.g. pool/dataset, as if it had
+// been created through the API, and returns the object as the API reports it
+func (s *Server) Create(namespace string, body map[string]interface{}) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.collections[namespace]
+	if !ok {
+		return nil, fmt.Errorf("unknown collection %q", namespace)
+	}
+	obj, apiErr := c.createObject(s, body)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return c.renderObject(s, obj), nil
+}
+
+// Update changes fields of an object out of band, e.g. to simulate drift
+func (s *Server) Update(namespace string, id interface{}, fields map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.collections[namespace]
+	if !ok {
+		return fmt.Errorf("unknown collection %q", namespace)
+	}
+	if _, apiErr := c.updateObject(s, fmt.Sprint(id), fields); apiErr != nil {
+		return apiErr
+	}
+	return nil
+}
+
+// Delete removes an object out of band, e.g. to simulate deletion outside
+// Terraform
+func (s *Server) Delete(namespace string, id interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.collections[namespace]
+	if !ok {
+		return fmt.Errorf("unknown collection %q", namespace)
+	}
+	if apiErr := c.deleteObject(s, fmt.Sprint(id), map[string]interface{}{"recursive": true, "force": true}); apiErr != nil {
+		return apiErr
+	}
+	return nil
+}
+
+// Object returns an object as the API reports it
+func (s *Server) Object(namespace string, id interface{}) (map[string]interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.collections[namespace]
+	if !ok {
+		return nil, false
+	}
+	obj, ok := c.objects[fmt.Sprint(id)]
+	if !ok {
+		return nil, false
+	}
+	return c.renderObject(s, obj), true
+}
+
+// Objects returns all objects of a collection as the API reports them
+func (s *Server) Objects(namespace string) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.collections[namespace]
+	if !ok {
+		return nil
+	}
+	return c.list(s, nil)
+}
+
+// File returns the content of a file uploaded through /filesystem/put
+func (s *Server) File(path string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, ok := s.files[path]
+	return content, ok
+}
+
+// PutFile stores a file as if it had been uploaded, e.g. an installer ISO
+// referenced by a VM's CD-ROM
+func (s *Server) PutFile(path string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[path] = content
+	s.fileAttrs[path] = newFileAttrs()
+}
+
+// DeleteFile removes a file, as if it had been deleted outside Terraform
+func (s *Server) DeleteFile(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.files[path]; !ok {
+		return fmt.Errorf("file %s does not exist", path)
+	}
+	delete(s.files, path)
+	delete(s.fileAttrs, path)
+	return nil
+}
+
+// FileMode returns the permissions and ownership of a file uploaded
+// through /filesystem/put, or of a directory
+func (s *Server) FileMode(path string) (mode, uid, gid int64, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attrs := s.pathAttrs(path)
+	if attrs == nil {
+		return 0, 0, 0, false
+	}
+	return attrs.mode, attrs.uid, attrs.gid, true
+}
+
+func (s *Server) mustCreate(namespace string, body map[string]interface{}) {
+	if _, apiErr := s.collections[namespace].createObject(s, body); apiErr != nil {
+		panic(apiErr)
+	}
+}
+
+// handleDelayed handles a request, holding back the response when a
+// delayed fault matches it. The server is not locked during the delay, so
+// that other requests are served meanwhile.
+func (s *Server) handleDelayed(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	fault := s.matchFault(r.Method, strings.TrimPrefix(r.URL.EscapedPath(), apiPrefix), true)
+	s.mu.Unlock()
+	if fault == nil {
+		s.handle(w, r)
+		return
+	}
+
+	rec := httptest.NewRecorder()
+	s.handle(rec, r)
+	select {
+	case <-r.Context().Done():
+		return
+	case <-time.After(fault.Delay):
+	}
+
+	for key, values := range rec.Header() {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(rec.Code)
+	_, _ = w.Write(rec.Body.Bytes())
+}
+
+// handle dispatches a request to the endpoint handlers
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	rawPath := r.URL.EscapedPath()
+	if strings.HasPrefix(rawPath, downloadPrefix) {
+		s.serveDownload(w, rawPath)
+		return
+	}
+	if !strings.HasPrefix(rawPath, apiPrefix+"/") {
+		writeError(w, errUnsupported(r.Method, rawPath))
+		return
+	}
+	rawPath = strings.TrimPrefix(rawPath, apiPrefix)
+
+	var body []byte
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		body, _ = io.ReadAll(r.Body)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, Request{Method: r.Method, Path: rawPath, Body: string(body)})
+
+	if fault := s.matchFault(r.Method, rawPath, false); fault != nil {
+		if fault.JobError != "" {
+			// The request is accepted, but the job it starts fails
+			// without changing any state
+			writeJSON(w, http.StatusOK, s.failJob(rawPath, fault.JobError))
+			return
+		}
+		status := fault.StatusCode
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, fault.Body)
+		return
+	}
+
+	var result interface{}
+	var apiErr *Error
+	switch {
+	case rawPath == "/system/version":
+		result = s.version
+	case rawPath == "/system/info":
+		result = s.systemInfo()
+	case rawPath == "/core/download" && r.Method == http.MethodPost:
+		result, apiErr = s.coreDownload(body)
+	case rawPath == "/core/get_jobs":
+		result, apiErr = s.getJobs(r.URL.Query())
+	case rawPath == "/filesystem/put" && r.Method == http.MethodPost:
+		result, apiErr = s.putFile(r)
+	case rawPath == "/filesystem/delete" && r.Method == http.MethodPost:
+		result, apiErr = s.deleteFile(body)
+	case rawPath == "/filesystem/stat" && r.Method == http.MethodPost:
+		result, apiErr = s.statFile(body)
+	case rawPath == "/filesystem/setperm" && r.Method == http.MethodPost:
+		result, apiErr = s.setFilePermissions(body)
+	case rawPath == "/filesystem/chown" && r.Method == http.MethodPost:
+		result, apiErr = s.chownFile(body)
+	case rawPath == "/filesystem/getacl" && r.Method == http.MethodPost:
+		result, apiErr = s.getACL(body)
+	case rawPath == "/filesystem/setacl" && r.Method == http.MethodPost:
+		result, apiErr = s.setACL(body)
+	case rawPath == "/filesystem/acltemplate/by_path" && r.Method == http.MethodPost:
+		result, apiErr = s.aclTemplatesByPath(body)
+	case rawPath == "/pool/dataset/unlock_services_restart_choices" && r.Method == http.MethodPost:
+		result, apiErr = s.unlockServicesRestart(body)
+	case rawPath == "/vm/port_wizard" && r.Method == http.MethodGet:
+		result = s.portWizard()
+	case rawPath == "/vm/get_available_memory" && r.Method == http.MethodPost:
+		result = s.availableVMMemory()
+	case rawPath == "/vm/maximum_supported_vcpus" && r.Method == http.MethodGet:
+		result = s.host.MaxVCPUs
+	case rawPath == "/vm/virtualization_details" && r.Method == http.MethodGet:
+		result = s.virtualizationDetails()
+	case rawPath == "/vm/get_vmemory_in_use" && r.Method == http.MethodGet:
+		result = s.vmMemoryInUse()
+	default:
+		result, apiErr = s.handleCollection(r.Method, rawPath, r.URL.Query(), body)
+	}
+
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleCollection serves the CRUD endpoints of a collection:
+// GET/POST /<namespace> and GET/PUT/DELETE /<namespace>/id/<id>, plus
+// actions at /<namespace>/id/<id>/<action>
+func (s *Server) handleCollection(method, rawPath string, query url.Values, body []byte) (interface{}, *Error) {
+	namespace, rawID, action := splitPath(rawPath)
+
+	c, ok := s.collections[namespace]
+	if !ok {
+		return nil, errUnsupported(method, rawPath)
+	}
+
+	var params map[string]interface{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &params); err != nil {
+			// Job actions such as /vm/id/1/start take no parameters
+			if strings.TrimSpace(string(body)) != "null" {
+				return nil, errCall(fmt.Sprintf("Invalid JSON body: %s", err))
+			}
+		}
+	}
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	if rawID == "" {
+		switch method {
+		case http.MethodGet:
+			return c.list(s, query), nil
+		case http.MethodPost:
+			obj, apiErr := c.createObject(s, params)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			return s.respond(c, "create", c.renderObject(s, obj)), nil
+		}
+		return nil, errUnsupported(method, rawPath)
+	}
+
+	id, err := url.PathUnescape(rawID)
+	if err != nil {
+		return nil, errCall(fmt.Sprintf("Invalid id %q", rawID))
+	}
+
+	if action != "" {
+		handler, ok := c.actions[action]
+		if !ok || method != http.MethodPost {
+			return nil, errUnsupported(method, rawPath)
+		}
+		obj, ok := c.objects[id]
+		if !ok {
+			return nil, errNotFound(namespace, id)
+		}
+		return handler(s, obj, params)
+	}
+
+	switch method {
+	case http.MethodGet:
+		obj, ok := c.objects[id]
+		if !ok {
+			return nil, errNotFound(namespace, id)
+		}
+		return c.renderObject(s, obj), nil
+	case http.MethodPut:
+		obj, apiErr := c.updateObject(s, id, params)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		return s.respond(c, "update", c.renderObject(s, obj)), nil
+	case http.MethodDelete:
+		if apiErr := c.deleteObject(s, id, params); apiErr != nil {
+			return nil, apiErr
+		}
+		return s.respond(c, "delete", true), nil
+	}
+	return nil, errUnsupported(method, rawPath)
+}
+
+// respond returns the result of a create, update or delete directly, or as
+// the ID of a finished job for collections whose methods run as jobs
+func (s *Server) respond(c *collection, verb string, result interface{}) interface{} {
+	if !c.jobs {
+		return result
+	}
+	return s.startJob(strings.ReplaceAll(c.name, "/", ".")+"."+verb, result)
+}
+
+// splitPath splits /pool/dataset/id/tank%2Fvm/action into the namespace,
+// the escaped ID and the action
+func splitPath(rawPath string) (namespace, rawID, action string) {
+	rawPath = strings.Trim(rawPath, "/")
+	i := strings.Index(rawPath, "/id/")
+	if i < 0 {
+		return rawPath, "", ""
+	}
+	namespace = rawPath[:i]
+	rest := rawPath[i+len("/id/"):]
+	if j := strings.Index(rest, "/"); j >= 0 {
+		return namespace, rest[:j], rest[j+1:]
+	}
+	return namespace, rest, ""
+}
+
+// matchesQuery reports whether an object matches the equality filters of
+// a query string, e.g. ?name=tank or ?vm=1
+func matchesQuery(obj map[string]interface{}, query url.Values) bool {
+	for key, values := range query {
+		if strings.HasPrefix(key, "limit") || strings.HasPrefix(key, "offset") || strings.HasPrefix(key, "sort") {
+			continue
+		}
+		if fmt.Sprint(obj[key]) != values[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedKeys returns the keys of m in ascending order, numerically when
+// they are integers
+func sortedKeys(m map[string]map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, errA := strconv.ParseInt(keys[i], 10, 64)
+		b, errB := strconv.ParseInt(keys[j], 10, 64)
+		if errA == nil && errB == nil {
+			return a < b
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
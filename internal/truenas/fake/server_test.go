@@ -0,0 +1,730 @@
+package fake_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas"
+	"github.com/baladithyab/terraform-provider-truenas/internal/truenas/fake"
+)
+
+// newTestClient starts a fake server and returns a client for it
+func newTestClient(t *testing.T) (*fake.Server, *truenas.Client) {
+	server := fake.NewServer()
+	t.Cleanup(server.Close)
+
+	client, err := truenas.NewClient(server.URL, "test-key")
+	require.NoError(t, err)
+	client.RetryPolicy.MaxRetries = 0
+	client.JobPollInterval = time.Millisecond
+
+	return server, client
+}
+
+// TestServer_DatasetCRUD tests the dataset endpoints and their property objects
+func TestServer_DatasetCRUD(t *testing.T) {
+	server, client := newTestClient(t)
+	ctx := context.Background()
+
+	_, err := client.PostJob(ctx, "/pool/dataset", map[string]interface{}{"name": "tank/apps", "comments": "apps"})
+	require.NoError(t, err)
+
+	body, err := client.Get(ctx, "/pool/dataset/id/tank%2Fapps")
+	require.NoError(t, err)
+
+	var dataset map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &dataset))
+	assert.Equal(t, "tank/apps", dataset["id"])
+	assert.Equal(t, "/mnt/tank/apps", dataset["mountpoint"])
+	assert.Equal(t, "LZ4", dataset["compression"].(map[string]interface{})["value"])
+	assert.Equal(t, "apps", dataset["comments"].(map[string]interface{})["value"])
+	assert.Nil(t, dataset["quota"].(map[string]interface{})["parsed"])
+
+	_, err = client.Put(ctx, "/pool/dataset/id/tank%2Fapps", map[string]interface{}{"quota": 1073741824})
+	require.NoError(t, err)
+	dataset, ok := server.Object("pool/dataset", "tank/apps")
+	require.True(t, ok)
+	assert.Equal(t, float64(1073741824), dataset["quota"].(map[string]interface{})["parsed"])
+
+	// Snapshots block a non-recursive delete
+	_, err = client.Post(ctx, "/zfs/snapshot", map[string]interface{}{"dataset": "tank/apps", "name": "before"})
+	require.NoError(t, err)
+	_, err = client.DeleteJob(ctx, "/pool/dataset/id/tank%2Fapps", map[string]bool{"recursive": false})
+	assert.ErrorContains(t, err, "filesystem has children")
+
+	_, err = client.DeleteJob(ctx, "/pool/dataset/id/tank%2Fapps", map[string]bool{"recursive": true})
+	require.NoError(t, err)
+	_, err = client.Get(ctx, "/pool/dataset/id/tank%2Fapps")
+	assert.True(t, truenas.IsNotFound(err))
+	assert.Empty(t, server.Objects("zfs/snapshot"))
+}
+
+// TestServer_DatasetEncryption tests encryption roots, inherited
+// encryption and changing the key of a root
+func TestServer_DatasetEncryption(t *testing.T) {
+	server, client := newTestClient(t)
+	ctx := context.Background()
+
+	_, err := client.PostJob(ctx, "/pool/dataset", map[string]interface{}{
+		"name":               "tank/secure",
+		"encryption":         true,
+		"encryption_options": map[string]interface{}{"passphrase": "correct horse battery"},
+	})
+	assert.ErrorContains(t, err, "Must be disabled when encryption is enabled")
+
+	_, err = client.PostJob(ctx, "/pool/dataset", map[string]interface{}{
+		"name":               "tank/secure",
+		"encryption":         true,
+		"inherit_encryption": false,
+		"encryption_options": map[string]interface{}{"passphrase": "correct horse battery"},
+	})
+	require.NoError(t, err)
+	_, err = client.PostJob(ctx, "/pool/dataset", map[string]interface{}{"name": "tank/secure/child"})
+	require.NoError(t, err)
+
+	child, ok := server.Object("pool/dataset", "tank/secure/child")
+	require.True(t, ok)
+	assert.Equal(t, true, child["encrypted"])
+	assert.Equal(t, "tank/secure", child["encryption_root"])
+	assert.Equal(t, "PASSPHRASE", child["key_format"].(map[string]interface{})["value"])
+	assert.Equal(t, "INHERITED", child["key_format"].(map[string]interface{})["source"])
+
+	_, err = client.PostJob(ctx, "/pool/dataset/id/tank%2Fsecure%2Fchild/change_key", map[string]interface{}{"generate_key": true})
+	assert.ErrorContains(t, err, "tank/secure/child is not an encryption root")
+
+	_, err = client.PostJob(ctx, "/pool/dataset/id/tank%2Fsecure/change_key", map[string]interface{}{"key": "abc"})
+	assert.ErrorContains(t, err, "Key must be 64 hexadecimal characters")
+
+	_, err = client.PostJob(ctx, "/pool/dataset/id/tank%2Fsecure/change_key", map[string]interface{}{"generate_key": true})
+	require.NoError(t, err)
+	child, _ = server.Object("pool/dataset", "tank/secure/child")
+	assert.Equal(t, "HEX", child["key_format"].(map[string]interface{})["value"])
+}
+
+// TestServer_DatasetLock tests locking and unlocking an encryption root
+func TestServer_DatasetLock(t *testing.T) {
+	server, client := newTestClient(t)
+	ctx := context.Background()
+
+	_, err := client.PostJob(ctx, "/pool/dataset", map[string]interface{}{
+		"name":               "tank/secure",
+		"encryption":         true,
+		"inherit_encryption": false,
+		"encryption_options": map[string]interface{}{"passphrase": "correct horse battery"},
+	})
+	require.NoError(t, err)
+
+	_, err = client.LockDataset(ctx, "tank/secure", false)
+	require.NoError(t, err)
+	dataset, _ := server.Object("pool/dataset", "tank/secure")
+	assert.Equal(t, true, dataset["locked"])
+
+	respBody, err := client.UnlockDataset(ctx, "tank/secure", map[string]interface{}{
+		"datasets": []interface{}{map[string]interface{}{"name": "tank/secure", "passphrase": "wrong passphrase"}},
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"unlocked": [], "failed": {"tank/secure": {"error": "Invalid Key", "skipped": []}}}`, string(respBody))
+
+	_, err = client.UnlockDataset(ctx, "tank/secure", map[string]interface{}{"services_restart": []string{"docker"}})
+	assert.ErrorContains(t, err, "docker is not a valid service to restart")
+
+	respBody, err = client.UnlockDataset(ctx, "tank/secure", map[string]interface{}{
+		"services_restart": []string{"cifs"},
+		"datasets":         []interface{}{map[string]interface{}{"name": "tank/secure", "passphrase": "correct horse battery"}},
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"unlocked": ["tank/secure"], "failed": {}}`, string(respBody))
+
+	respBody, err = client.GetDatasetEncryptionSummary(ctx, "tank/secure", nil)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"name": "tank/secure", "key_format": "PASSPHRASE", "key_present_in_database": false, "valid_key": false,
+		"locked": false, "unlock_error": "Passphrase not provided", "unlock_successful": false}]`, string(respBody))
+
+	respBody, err = client.GetDatasetUnlockServicesRestartChoices(ctx, "tank/secure")
+	require.NoError(t, err)
+	assert.Contains(t, string(respBody), `"cifs":"SMB"`)
+}
+
+// TestServer_ExportKeys tests exporting the keys of encryption roots,
+// directly and through core.download
+func TestServer_ExportKeys(t *testing.T) {
+	server, client := newTestClient(t)
+	ctx := context.Background()
+
+	key := strings.Repeat("ab", 32)
+	for _, dataset := range []map[string]interface{}{
+		{"name": "tank/hex", "encryption": true, "inherit_encryption": false, "encryption_options": map[string]interface{}{"key": key}},
+		{"name": "tank/hex/child"},
+		{"name": "tank/secure", "encryption": true, "inherit_encryption": false, "encryption_options": map[string]interface{}{"passphrase": "correct horse battery"}},
+	} {
+		_, err := client.PostJob(ctx, "/pool/dataset", dataset)
+		require.NoError(t, err)
+	}
+	_, err := server.Create("replication", map[string]interface{}{"name": "offsite", "source_datasets": []interface{}{"tank/hex"}, "target_dataset": "backup/hex"})
+	require.NoError(t, err)
+
+	respBody, err := client.ExportDatasetKey(ctx, "tank/hex")
+	require.NoError(t, err)
+	assert.JSONEq(t, `"`+key+`"`, string(respBody))
+
+	_, err = client.ExportDatasetKey(ctx, "tank/secure")
+	assert.ErrorContains(t, err, "cannot be exported")
+
+	respBody, err = client.ExportDatasetKeys(ctx, "tank")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"tank/hex": "`+key+`"}`, string(respBody))
+
+	respBody, err = client.ExportReplicationKeys(ctx, 1)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"tank/hex": "`+key+`"}`, string(respBody))
+
+	_, err = client.ExportReplicationKeys(ctx, 2)
+	assert.True(t, truenas.IsNotFound(err))
+}
+
+// TestServer_Validation tests that validation errors use the middleware's shape
+func TestServer_Validation(t *testing.T) {
+	_, client := newTestClient(t)
+
+	_, err := client.Post(context.Background(), "/sharing/nfs", map[string]interface{}{"path": "/mnt/tank/missing"})
+	require.Error(t, err)
+
+	var apiErr *truenas.APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, truenas.ErrorClassValidation, apiErr.Class)
+	require.Len(t, apiErr.Fields, 1)
+	assert.Equal(t, "path", apiErr.Fields[0].Attribute())
+}
+
+// TestServer_Jobs tests that job endpoints return job IDs which can be polled to completion
+func TestServer_Jobs(t *testing.T) {
+	server, client := newTestClient(t)
+	server.SetJobPolls(2)
+	ctx := context.Background()
+
+	body, err := client.Post(ctx, "/chart/release", map[string]interface{}{
+		"release_name": "plex",
+		"catalog":      "TRUENAS",
+		"train":        "charts",
+		"item":         "plex",
+		"version":      "1.0.0",
+	})
+	require.NoError(t, err)
+
+	var jobID int64
+	require.NoError(t, json.Unmarshal(body, &jobID))
+
+	job, err := client.GetJob(ctx, jobID)
+	require.NoError(t, err)
+	assert.Equal(t, truenas.JobStateRunning, job.State)
+
+	job, err = client.WaitForJob(ctx, jobID)
+	require.NoError(t, err)
+	assert.Equal(t, truenas.JobStateSuccess, job.State)
+	assert.Contains(t, string(job.Result), `"name":"plex"`)
+}
+
+// TestServer_InjectFault tests status and job failure faults
+func TestServer_InjectFault(t *testing.T) {
+	server, client := newTestClient(t)
+	ctx := context.Background()
+
+	server.InjectFault(fake.Fault{
+		Method:     http.MethodPost,
+		Path:       "/staticroute",
+		StatusCode: http.StatusServiceUnavailable,
+		Body:       `{"message": "middleware is restarting"}`,
+		Count:      1,
+	})
+
+	_, err := client.Post(ctx, "/staticroute", map[string]interface{}{"destination": "10.1.0.0/16", "gateway": "10.0.0.1"})
+	assert.ErrorContains(t, err, "middleware is restarting")
+
+	// The fault is used up
+	_, err = client.Post(ctx, "/staticroute", map[string]interface{}{"destination": "10.1.0.0/16", "gateway": "10.0.0.1"})
+	require.NoError(t, err)
+
+	server.InjectFault(fake.Fault{Path: "/chart/release", JobError: "[EFAULT] Failed to install chart"})
+	_, err = client.PostJob(ctx, "/chart/release", map[string]interface{}{
+		"release_name": "plex",
+		"catalog":      "TRUENAS",
+		"train":        "charts",
+		"item":         "plex",
+	})
+
+	var jobErr *truenas.JobError
+	require.True(t, errors.As(err, &jobErr))
+	assert.Equal(t, "[EFAULT] Failed to install chart", jobErr.Message)
+	assert.Empty(t, server.Objects("chart/release"))
+
+	server.ClearFaults()
+	_, err = client.Get(ctx, "/chart/release")
+	assert.NoError(t, err)
+}
+
+// TestServer_DelayedFault tests that a delayed request is applied even when
+// the client gives up waiting for its response
+func TestServer_DelayedFault(t *testing.T) {
+	server, client := newTestClient(t)
+
+	server.InjectFault(fake.Fault{Method: http.MethodPost, Path: "/staticroute", Delay: time.Minute, Count: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := client.Post(ctx, "/staticroute", map[string]interface{}{"destination": "10.1.0.0/16", "gateway": "10.0.0.1"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Len(t, server.Objects("staticroute"), 1)
+
+	// Other requests are served during the delay, and the fault is used up
+	_, err = client.Get(context.Background(), "/staticroute")
+	require.NoError(t, err)
+}
+
+// TestServer_VM tests VM devices and lifecycle actions
+func TestServer_VM(t *testing.T) {
+	server, client := newTestClient(t)
+	ctx := context.Background()
+
+	_, err := client.Post(ctx, "/vm", map[string]interface{}{"name": "web", "memory": 2048})
+	require.NoError(t, err)
+
+	_, err = client.CreateVMDevice(ctx, map[string]interface{}{
+		"vm":         "1",
+		"dtype":      "NIC",
+		"attributes": map[string]interface{}{"type": "VIRTIO", "nic_attach": "br0"},
+	})
+	require.NoError(t, err)
+
+	_, err = client.StartVM(ctx, "1")
+	require.NoError(t, err)
+
+	status, err := client.GetVMStatus(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "RUNNING", status["status"].(map[string]interface{})["state"])
+
+	devices := status["devices"].([]interface{})
+	require.Len(t, devices, 1)
+	nic := devices[0].(map[string]interface{})
+	assert.Equal(t, float64(1), nic["vm"])
+	assert.Equal(t, float64(1001), nic["order"])
+	assert.NotEmpty(t, nic["attributes"].(map[string]interface{})["mac"])
+
+	_, err = client.Delete(ctx, "/vm/id/1")
+	require.NoError(t, err)
+	assert.Empty(t, server.Objects("vm/device"))
+}
+
+// TestServer_VMHostCapacity tests that VMs are only started when the host
+// has the memory for them
+func TestServer_VMHostCapacity(t *testing.T) {
+	server, client := newTestClient(t)
+	server.SetHostCapacity(fake.HostCapacity{Memory: 3072 << 20, MaxVCPUs: 8})
+	ctx := context.Background()
+
+	_, err := client.Post(ctx, "/vm", map[string]interface{}{"name": "web", "memory": 2048, "autostart": false})
+	require.NoError(t, err)
+	_, err = client.Post(ctx, "/vm", map[string]interface{}{"name": "db", "memory": 2048, "autostart": true})
+	require.NoError(t, err)
+
+	_, err = client.StartVM(ctx, "1")
+	require.NoError(t, err)
+
+	respBody, err := client.GetVMAvailableMemory(ctx, false)
+	require.NoError(t, err)
+	assert.JSONEq(t, `1073741824`, string(respBody))
+
+	respBody, err = client.GetVMMemoryInUse(ctx)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"RNP": 2147483648, "PRD": 2147483648, "RPRD": 0}`, string(respBody))
+
+	_, err = client.StartVM(ctx, "2")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Cannot guarantee memory for guest db")
+
+	respBody, err = client.GetVMMaximumSupportedVCPUs(ctx)
+	require.NoError(t, err)
+	assert.JSONEq(t, `8`, string(respBody))
+
+	respBody, err = client.GetVMVirtualizationDetails(ctx)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"supported": true, "error": null}`, string(respBody))
+}
+
+// TestServer_VMClone tests that a VM clone copies the devices and clones
+// the disk zvols
+func TestServer_VMClone(t *testing.T) {
+	server, client := newTestClient(t)
+	ctx := context.Background()
+
+	_, err := server.Create("pool/dataset", map[string]interface{}{"name": "tank/golden", "type": "VOLUME", "volsize": 1073741824})
+	require.NoError(t, err)
+	_, err = client.Post(ctx, "/vm", map[string]interface{}{"name": "golden", "memory": 2048})
+	require.NoError(t, err)
+	for _, device := range []map[string]interface{}{
+		{"vm": "1", "dtype": "NIC", "attributes": map[string]interface{}{"nic_attach": "eno1"}},
+		{"vm": "1", "dtype": "DISK", "attributes": map[string]interface{}{"path": "/dev/zvol/tank/golden"}},
+	} {
+		_, err = client.CreateVMDevice(ctx, device)
+		require.NoError(t, err)
+	}
+
+	_, err = client.CloneVM(ctx, "1", "lab1")
+	require.NoError(t, err)
+
+	status, err := client.GetVMStatus(ctx, "2")
+	require.NoError(t, err)
+	assert.Equal(t, "lab1", status["name"])
+
+	devices := status["devices"].([]interface{})
+	require.Len(t, devices, 2)
+	source, _ := server.Object("vm", 1)
+	sourceNIC := source["devices"].([]interface{})[0].(map[string]interface{})["attributes"].(map[string]interface{})
+	nic := devices[0].(map[string]interface{})["attributes"].(map[string]interface{})
+	assert.NotEqual(t, sourceNIC["mac"], nic["mac"])
+	disk := devices[1].(map[string]interface{})["attributes"].(map[string]interface{})
+	assert.Equal(t, "/dev/zvol/tank/golden_lab1", disk["path"])
+
+	clone, ok := server.Object("pool/dataset", "tank/golden_lab1")
+	require.True(t, ok)
+	assert.Equal(t, "tank/golden@lab1", clone["origin"].(map[string]interface{})["value"])
+
+	// A name is generated when none is given
+	_, err = client.CloneVM(ctx, "1", "")
+	require.NoError(t, err)
+	status, err = client.GetVMStatus(ctx, "3")
+	require.NoError(t, err)
+	assert.Equal(t, "golden_clone0", status["name"])
+}
+
+// TestServer_UploadFile tests that uploaded files are stored and can be deleted
+func TestServer_UploadFile(t *testing.T) {
+	server, client := newTestClient(t)
+	ctx := context.Background()
+
+	require.NoError(t, client.UploadFile(ctx, "/mnt/tank/isos/seed.iso", []byte("iso")))
+
+	content, ok := server.File("/mnt/tank/isos/seed.iso")
+	require.True(t, ok)
+	assert.Equal(t, "iso", string(content))
+
+	require.NoError(t, client.DeleteFile(ctx, "/mnt/tank/isos/seed.iso"))
+	_, ok = server.File("/mnt/tank/isos/seed.iso")
+	assert.False(t, ok)
+}
+
+// TestServer_UploadReader tests streamed uploads, including to the block
+// device of a zvol
+func TestServer_UploadReader(t *testing.T) {
+	server, client := newTestClient(t)
+	ctx := context.Background()
+
+	content := strings.Repeat("disk", 4096)
+	_, err := client.UploadReader(ctx, "/mnt/tank/images/disk.img", strings.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+	stored, ok := server.File("/mnt/tank/images/disk.img")
+	require.True(t, ok)
+	assert.Equal(t, content, string(stored))
+
+	// A source shorter than announced fails the upload
+	_, err = client.UploadReader(ctx, "/mnt/tank/images/short.img", strings.NewReader("disk"), 8)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "read 4 bytes, expected 8")
+	_, ok = server.File("/mnt/tank/images/short.img")
+	assert.False(t, ok)
+
+	// Zvol devices only exist for zvols, and hold at most volsize bytes
+	_, err = client.UploadReader(ctx, "/dev/zvol/tank/disk", strings.NewReader(content), int64(len(content)))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "No such file or directory")
+
+	_, err = client.PostJob(ctx, "/pool/dataset", map[string]interface{}{"name": "tank/disk", "type": "VOLUME", "volsize": 1024})
+	require.NoError(t, err)
+	_, err = client.UploadReader(ctx, "/dev/zvol/tank/disk", strings.NewReader(content), int64(len(content)))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "No space left on device")
+
+	_, err = client.UploadReader(ctx, "/dev/zvol/tank/disk", strings.NewReader("boot"), 4)
+	require.NoError(t, err)
+	stored, ok = server.File("/dev/zvol/tank/disk")
+	require.True(t, ok)
+	assert.Equal(t, "boot", string(stored))
+}
+
+// TestServer_UploadReaderResume tests that an interrupted upload is resumed
+// from the end of the partially written file
+func TestServer_UploadReaderResume(t *testing.T) {
+	server, client := newTestClient(t)
+	client.RetryPolicy.MaxRetries = 1
+	client.RetryPolicy.MinWait = time.Millisecond
+	ctx := context.Background()
+
+	content := strings.Repeat("0123456789", 1000)
+	server.PutFile("/mnt/tank/isos/installer.iso", []byte(content[:4000]))
+	server.InjectFault(fake.Fault{Path: "/filesystem/put", StatusCode: http.StatusServiceUnavailable, Count: 1})
+
+	var sent []int64
+	result, err := client.UploadReader(ctx, "/mnt/tank/isos/installer.iso", strings.NewReader(content), int64(len(content)),
+		truenas.WithUploadProgress(func(n, total int64) {
+			assert.Equal(t, int64(len(content)), total)
+			sent = append(sent, n)
+		}))
+	require.NoError(t, err)
+
+	stored, ok := server.File("/mnt/tank/isos/installer.iso")
+	require.True(t, ok)
+	assert.Equal(t, content, string(stored))
+
+	sum := sha256.Sum256([]byte(content))
+	assert.Equal(t, hex.EncodeToString(sum[:]), result.SHA256)
+	assert.Equal(t, int64(len(content)), result.Size)
+	require.NotEmpty(t, sent)
+	assert.Equal(t, int64(len(content)), sent[len(sent)-1])
+
+	// The retry stats the partial file and appends the rest to it
+	var puts, stats int
+	for _, req := range server.Requests() {
+		switch req.Path {
+		case "/filesystem/put":
+			puts++
+		case "/filesystem/stat":
+			stats++
+		}
+	}
+	assert.Equal(t, 2, puts)
+	assert.Equal(t, 2, stats)
+
+	// A reader that cannot seek is not retried
+	server.InjectFault(fake.Fault{Path: "/filesystem/put", StatusCode: http.StatusServiceUnavailable, Count: 1})
+	_, err = client.UploadReader(ctx, "/mnt/tank/isos/other.iso", io.LimitReader(strings.NewReader(content), 10), 10)
+	require.Error(t, err)
+}
+
+// TestServer_FilePermissions tests the mode of uploads, /filesystem/stat
+// and /filesystem/setperm
+func TestServer_FilePermissions(t *testing.T) {
+	_, client := newTestClient(t)
+	ctx := context.Background()
+
+	_, err := client.UploadReader(ctx, "/mnt/tank/scripts/run.sh", strings.NewReader("#!/bin/sh"), 9, truenas.WithUploadMode(0o750))
+	require.NoError(t, err)
+
+	stat, err := client.StatFile(ctx, "/mnt/tank/scripts/run.sh")
+	require.NoError(t, err)
+	assert.Equal(t, "FILE", stat.Type)
+	assert.Equal(t, int64(9), stat.Size)
+	assert.Equal(t, os.FileMode(0o750), stat.Permissions())
+	require.NotNil(t, stat.User)
+	assert.Equal(t, "root", *stat.User)
+
+	_, err = client.PostJob(ctx, "/user", map[string]interface{}{"username": "alice", "full_name": "Alice", "uid": 3000, "group_create": true})
+	require.NoError(t, err)
+	mode, uid := os.FileMode(0o700), int64(3000)
+	require.NoError(t, client.SetFilePermissions(ctx, "/mnt/tank/scripts/run.sh", truenas.FilePermissions{Mode: &mode, UID: &uid}))
+
+	stat, err = client.StatFile(ctx, "/mnt/tank/scripts/run.sh")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o700), stat.Permissions())
+	assert.Equal(t, int64(3000), stat.UID)
+	assert.Equal(t, int64(0), stat.GID)
+	require.NotNil(t, stat.User)
+	assert.Equal(t, "alice", *stat.User)
+
+	stat, err = client.StatFile(ctx, "/mnt/tank")
+	require.NoError(t, err)
+	assert.Equal(t, "DIRECTORY", stat.Type)
+
+	_, err = client.StatFile(ctx, "/mnt/tank/missing")
+	require.Error(t, err)
+	assert.True(t, truenas.IsNoEntry(err))
+}
+
+// TestServer_FilesystemACL tests /filesystem/getacl, /filesystem/setacl,
+// /filesystem/chown and pool.dataset.permission
+func TestServer_FilesystemACL(t *testing.T) {
+	_, client := newTestClient(t)
+	ctx := context.Background()
+
+	_, err := client.PostJob(ctx, "/user", map[string]interface{}{"username": "alice", "full_name": "Alice", "uid": 3000, "group_create": true})
+	require.NoError(t, err)
+	_, err = client.Post(ctx, "/pool/dataset", map[string]interface{}{"name": "tank/smb", "acltype": "NFSV4"})
+	require.NoError(t, err)
+	_, err = client.Post(ctx, "/pool/dataset", map[string]interface{}{"name": "tank/smb/child", "acltype": "NFSV4"})
+	require.NoError(t, err)
+
+	// A path without an ACL has a trivial one reflecting its mode
+	acl, err := client.GetFilesystemACL(ctx, "/mnt/tank/smb")
+	require.NoError(t, err)
+	assert.True(t, acl.Trivial)
+	assert.Equal(t, truenas.ACLTypeNFS4, acl.ACLType)
+	require.Len(t, acl.Entries, 3)
+	assert.Equal(t, "owner@", acl.Entries[0].Tag)
+
+	uid := int64(3000)
+	alice := "alice"
+	err = client.SetFilesystemACL(ctx, truenas.ACL{
+		Path:    "/mnt/tank/smb",
+		ACLType: truenas.ACLTypeNFS4,
+		UID:     &uid,
+		Entries: []truenas.ACLEntry{
+			{Tag: "owner@", Type: "ALLOW", Perms: map[string]interface{}{"BASIC": "FULL_CONTROL"}, Flags: map[string]interface{}{"BASIC": "INHERIT"}},
+			{Tag: "USER", Who: &alice, Type: "ALLOW", Perms: map[string]interface{}{"READ_DATA": true, "EXECUTE": true}, Flags: map[string]interface{}{}},
+		},
+	}, truenas.ACLOptions{Recursive: true})
+	require.NoError(t, err)
+
+	acl, err = client.GetFilesystemACL(ctx, "/mnt/tank/smb")
+	require.NoError(t, err)
+	assert.False(t, acl.Trivial)
+	assert.Equal(t, uid, *acl.UID)
+	require.Len(t, acl.Entries, 2)
+	assert.Equal(t, true, acl.Entries[0].Perms["WRITE_OWNER"])
+	assert.Equal(t, true, acl.Entries[0].Flags["FILE_INHERIT"])
+	assert.Equal(t, uid, *acl.Entries[1].ID)
+	assert.Equal(t, "alice", *acl.Entries[1].Who)
+	assert.Equal(t, false, acl.Entries[1].Perms["WRITE_DATA"])
+
+	// Without traverse, child datasets keep their ACL
+	acl, err = client.GetFilesystemACL(ctx, "/mnt/tank/smb/child")
+	require.NoError(t, err)
+	assert.True(t, acl.Trivial)
+
+	// The ACL type must match the dataset
+	err = client.SetFilesystemACL(ctx, truenas.ACL{
+		Path:    "/mnt/tank/smb",
+		ACLType: truenas.ACLTypePOSIX1E,
+		Entries: []truenas.ACLEntry{{Tag: "USER_OBJ", Perms: map[string]interface{}{"READ": true, "WRITE": true, "EXECUTE": true}}},
+	}, truenas.ACLOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match")
+
+	// The mode cannot change without stripping the ACL
+	mode := os.FileMode(0o770)
+	err = client.SetFilePermissions(ctx, "/mnt/tank/smb", truenas.FilePermissions{Mode: &mode})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stripacl")
+	require.NoError(t, client.SetDatasetPermission(ctx, "tank/smb", truenas.FilePermissions{Mode: &mode, StripACL: true}))
+
+	acl, err = client.GetFilesystemACL(ctx, "/mnt/tank/smb")
+	require.NoError(t, err)
+	assert.True(t, acl.Trivial)
+	stat, err := client.StatFile(ctx, "/mnt/tank/smb")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o770), stat.Permissions())
+	assert.Equal(t, uid, stat.UID)
+
+	gid := int64(0)
+	require.NoError(t, client.ChownFile(ctx, "/mnt/tank/smb", truenas.FilePermissions{UID: &gid, GID: &gid, Recursive: true, Traverse: true}))
+	stat, err = client.StatFile(ctx, "/mnt/tank/smb/child")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stat.UID)
+
+	// POSIX.1e ACLs need a MASK when they name users
+	_, err = client.Post(ctx, "/pool/dataset", map[string]interface{}{"name": "tank/posix"})
+	require.NoError(t, err)
+	rwx := map[string]interface{}{"READ": true, "WRITE": true, "EXECUTE": true}
+	entries := []truenas.ACLEntry{
+		{Tag: "USER_OBJ", Perms: rwx},
+		{Tag: "GROUP_OBJ", Perms: rwx},
+		{Tag: "OTHER", Perms: map[string]interface{}{"READ": false, "WRITE": false, "EXECUTE": false}},
+		{Tag: "USER", ID: &uid, Perms: rwx},
+	}
+	err = client.SetFilesystemACL(ctx, truenas.ACL{Path: "/mnt/tank/posix", ACLType: truenas.ACLTypePOSIX1E, Entries: entries}, truenas.ACLOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "MASK")
+	entries = append(entries, truenas.ACLEntry{Tag: "MASK", Perms: rwx})
+	require.NoError(t, client.SetFilesystemACL(ctx, truenas.ACL{Path: "/mnt/tank/posix", ACLType: truenas.ACLTypePOSIX1E, Entries: entries}, truenas.ACLOptions{}))
+
+	acl, err = client.GetFilesystemACL(ctx, "/mnt/tank/posix")
+	require.NoError(t, err)
+	assert.Equal(t, truenas.ACLTypePOSIX1E, acl.ACLType)
+	require.Len(t, acl.Entries, 5)
+	assert.Equal(t, int64(-1), *acl.Entries[0].ID)
+	assert.Equal(t, "alice", *acl.Entries[3].Who)
+}
+
+// TestServer_ACLTemplates tests ACL template CRUD and the formatting of
+// /filesystem/acltemplate/by_path
+func TestServer_ACLTemplates(t *testing.T) {
+	_, client := newTestClient(t)
+	ctx := context.Background()
+
+	_, err := client.PostJob(ctx, "/user", map[string]interface{}{"username": "alice", "full_name": "Alice", "uid": 3000, "group_create": true})
+	require.NoError(t, err)
+	_, err = client.Post(ctx, "/pool/dataset", map[string]interface{}{"name": "tank/smb", "acltype": "NFSV4"})
+	require.NoError(t, err)
+
+	uid := int64(3000)
+	template, err := client.CreateACLTemplate(ctx, truenas.ACLTemplate{
+		Name:    "SHARE",
+		ACLType: truenas.ACLTypeNFS4,
+		Entries: []truenas.ACLEntry{
+			{Tag: "owner@", Type: "ALLOW", Perms: map[string]interface{}{"BASIC": "FULL_CONTROL"}, Flags: map[string]interface{}{"BASIC": "INHERIT"}},
+			{Tag: "USER", ID: &uid, Type: "ALLOW", Perms: map[string]interface{}{"BASIC": "READ"}, Flags: map[string]interface{}{"BASIC": "INHERIT"}},
+			{Tag: "everyone@", Type: "DENY", Perms: map[string]interface{}{"WRITE_DATA": true}, Flags: map[string]interface{}{}},
+		},
+	})
+	require.NoError(t, err)
+	assert.False(t, template.Builtin)
+	require.Len(t, template.Entries, 3)
+
+	_, err = client.CreateACLTemplate(ctx, truenas.ACLTemplate{Name: "SHARE", ACLType: truenas.ACLTypeNFS4, Entries: template.Entries})
+	require.Error(t, err)
+
+	// Only the templates of the ACL type of the path are returned, with the
+	// names of users and DENY entries first
+	templates, err := client.ListACLTemplatesByPath(ctx, "/mnt/tank/smb", nil, truenas.ACLTemplateFormat{Canonicalize: true, ResolveNames: true})
+	require.NoError(t, err)
+	names := []string{}
+	for _, found := range templates {
+		names = append(names, found.Name)
+	}
+	assert.Equal(t, []string{"NFS4_OPEN", "NFS4_RESTRICTED", "NFS4_HOME", "SHARE"}, names)
+	share := templates[3]
+	assert.Equal(t, "everyone@", share.Entries[0].Tag)
+	assert.Equal(t, "alice", *share.Entries[2].Who)
+
+	templates, err = client.ListACLTemplatesByPath(ctx, "", []interface{}{[]interface{}{"name", "=", "POSIX_OPEN"}}, truenas.ACLTemplateFormat{EnsureBuiltins: true})
+	require.NoError(t, err)
+	require.Len(t, templates, 1)
+	assert.True(t, templates[0].Builtin)
+	assert.Len(t, templates[0].Entries, 12)
+
+	_, err = client.ListACLTemplatesByPath(ctx, "", nil, truenas.ACLTemplateFormat{ResolveNames: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unless path is provided")
+
+	// Built-in templates cannot change
+	err = client.DeleteACLTemplate(ctx, fmt.Sprint(templates[0].ID))
+	require.Error(t, err)
+
+	template.Comment = "Department shares"
+	template, err = client.UpdateACLTemplate(ctx, fmt.Sprint(template.ID), *template)
+	require.NoError(t, err)
+	assert.Equal(t, "Department shares", template.Comment)
+
+	require.NoError(t, client.DeleteACLTemplate(ctx, fmt.Sprint(template.ID)))
+	_, err = client.GetACLTemplate(ctx, fmt.Sprint(template.ID))
+	assert.True(t, truenas.IsNotFound(err))
+}
+
+// TestServer_DetectServer tests the version endpoints used at provider configuration
+func TestServer_DetectServer(t *testing.T) {
+	server, client := newTestClient(t)
+	server.SetVersion("TrueNAS-SCALE-24.10.1")
+
+	require.NoError(t, client.DetectServer(context.Background()))
+	assert.Equal(t, "24.10.1", client.ServerVersion.String())
+	assert.Equal(t, "truenas", client.SystemInfo.Hostname)
+}
@@ -0,0 +1,213 @@
+package fake
+
+import (
+	"fmt"
+	"strings"
+)
+
+func nfsShareCollection() *collection {
+	return &collection{
+		name:     "sharing/nfs",
+		schema:   "sharingnfs",
+		required: []string{"path"},
+		unique:   []string{"path"},
+		defaults: func() object {
+			return object{
+				"comment":       "",
+				"networks":      []interface{}{},
+				"hosts":         []interface{}{},
+				"ro":            false,
+				"maproot_user":  nil,
+				"maproot_group": nil,
+				"mapall_user":   nil,
+				"mapall_group":  nil,
+				"security":      []interface{}{},
+				"enabled":       true,
+				"locked":        false,
+			}
+		},
+		create: func(s *Server, obj object) *Error {
+			return validateSharePath(s, "sharingnfs_create", obj)
+		},
+		update: func(s *Server, obj, params object) *Error {
+			if _, ok := params["path"]; ok {
+				if apiErr := validateSharePath(s, "sharingnfs_update", params); apiErr != nil {
+					return apiErr
+				}
+			}
+			for k, v := range params {
+				obj[k] = v
+			}
+			return nil
+		},
+	}
+}
+
+func smbShareCollection() *collection {
+	return &collection{
+		name:     "sharing/smb",
+		schema:   "sharingsmb",
+		required: []string{"name", "path"},
+		unique:   []string{"name"},
+		defaults: func() object {
+			return object{
+				"purpose":    "DEFAULT_SHARE",
+				"comment":    "",
+				"enabled":    true,
+				"browsable":  true,
+				"guestok":    false,
+				"ro":         false,
+				"recyclebin": false,
+				"shadowcopy": true,
+				"hostsallow": []interface{}{},
+				"hostsdeny":  []interface{}{},
+				"locked":     false,
+			}
+		},
+		create: func(s *Server, obj object) *Error {
+			return validateSharePath(s, "sharingsmb_create", obj)
+		},
+		update: func(s *Server, obj, params object) *Error {
+			if _, ok := params["path"]; ok {
+				if apiErr := validateSharePath(s, "sharingsmb_update", params); apiErr != nil {
+					return apiErr
+				}
+			}
+			for k, v := range params {
+				obj[k] = v
+			}
+			return nil
+		},
+	}
+}
+
+// validateSharePath checks that a share's path lies within a dataset
+func validateSharePath(s *Server, schema string, obj object) *Error {
+	path := str(obj, "path")
+	if !strings.HasPrefix(path, "/mnt/") {
+		return errValidation(schema+".path", "Path must reside within a pool mount point")
+	}
+	if !pathExists(s, path) {
+		return errValidation(schema+".path", fmt.Sprintf("Path %s does not exist", path))
+	}
+	return nil
+}
+
+func iscsiPortalCollection() *collection {
+	return &collection{
+		name:     "iscsi/portal",
+		schema:   "iscsiportal",
+		required: []string{"listen"},
+		defaults: func() object {
+			return object{
+				"comment":              "",
+				"discovery_authmethod": "NONE",
+				"discovery_authgroup":  nil,
+			}
+		},
+		create: func(s *Server, obj object) *Error {
+			listen, _ := obj["listen"].([]interface{})
+			if len(listen) == 0 {
+				return errValidation("iscsiportal_create.listen", "At least one listen entry is required")
+			}
+			obj["tag"] = obj["id"]
+			return nil
+		},
+	}
+}
+
+func iscsiTargetCollection() *collection {
+	return &collection{
+		name:     "iscsi/target",
+		schema:   "iscsi_target",
+		required: []string{"name"},
+		unique:   []string{"name"},
+		defaults: func() object {
+			return object{
+				"alias":         nil,
+				"mode":          "ISCSI",
+				"groups":        []interface{}{},
+				"auth_networks": []interface{}{},
+			}
+		},
+		create: func(s *Server, obj object) *Error {
+			return validateTargetGroups(s, "iscsi_target_create", obj)
+		},
+		update: func(s *Server, obj, params object) *Error {
+			if apiErr := validateTargetGroups(s, "iscsi_target_update", params); apiErr != nil {
+				return apiErr
+			}
+			for k, v := range params {
+				obj[k] = v
+			}
+			return nil
+		},
+	}
+}
+
+// validateTargetGroups checks that the groups of a target are
+// {"portal": <id>, ...} objects referencing existing portals
+func validateTargetGroups(s *Server, schema string, obj object) *Error {
+	groups, _ := obj["groups"].([]interface{})
+	for i, g := range groups {
+		group, ok := g.(map[string]interface{})
+		if !ok {
+			return errValidation(fmt.Sprintf("%s.groups.%d", schema, i), "Not a dictionary")
+		}
+		if _, ok := s.lookup("iscsi/portal", group["portal"]); !ok {
+			return errValidation(fmt.Sprintf("%s.groups.%d.portal", schema, i), fmt.Sprintf("Portal %v not found", group["portal"]))
+		}
+		for k, v := range map[string]interface{}{"initiator": nil, "authmethod": "NONE", "auth": nil} {
+			if _, ok := group[k]; !ok {
+				group[k] = v
+			}
+		}
+	}
+	return nil
+}
+
+func iscsiExtentCollection() *collection {
+	return &collection{
+		name:     "iscsi/extent",
+		schema:   "iscsi_extent",
+		required: []string{"name"},
+		unique:   []string{"name"},
+		defaults: func() object {
+			return object{
+				"type":            "DISK",
+				"disk":            nil,
+				"path":            nil,
+				"filesize":        0,
+				"comment":         "",
+				"enabled":         true,
+				"ro":              false,
+				"blocksize":       512,
+				"pblocksize":      false,
+				"avail_threshold": nil,
+				"rpm":             "SSD",
+				"xen":             false,
+				"insecure_tpc":    true,
+			}
+		},
+		create: func(s *Server, obj object) *Error {
+			switch str(obj, "type") {
+			case "DISK":
+				if str(obj, "disk") == "" {
+					return errValidation("iscsi_extent_create.disk", "This field is required for DISK extents")
+				}
+				obj["path"] = "/dev/" + str(obj, "disk")
+			case "FILE":
+				if !pathExists(s, str(obj, "path")) {
+					return errValidation("iscsi_extent_create.path", "Path must reside within a pool mount point")
+				}
+			default:
+				return errValidation("iscsi_extent_create.type", "Invalid choice")
+			}
+			if _, ok := obj["serial"]; !ok {
+				obj["serial"] = fmt.Sprintf("fake%012d", obj["id"])
+			}
+			obj["naa"] = fmt.Sprintf("0x6589cfc000000%019d", obj["id"])
+			return nil
+		},
+	}
+}
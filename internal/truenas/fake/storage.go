@@ -0,0 +1,378 @@
+package fake
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// datasetStringProperties are the ZFS properties reported as
+// {"value": ..., "rawvalue": ..., "parsed": ...} objects with string values
+var datasetStringProperties = []string{"compression", "sync", "deduplication", "readonly", "atime", "exec", "recordsize", "snapdir", "origin", "acltype"}
+
+// datasetSizeProperties are the ZFS properties whose parsed value is a
+// number of bytes
+var datasetSizeProperties = []string{"reservation", "refreservation", "quota", "refquota", "volsize"}
+
+// filesystemOnlyProperties are not reported for volumes
+var filesystemOnlyProperties = map[string]bool{"atime": true, "exec": true, "recordsize": true, "snapdir": true, "quota": true, "refquota": true, "acltype": true}
+
+func poolCollection() *collection {
+	return &collection{
+		name:     "pool",
+		schema:   "pool",
+		required: []string{"name"},
+		unique:   []string{"name"},
+		defaults: func() object {
+			return object{
+				"status":  "ONLINE",
+				"healthy": true,
+				"size":    int64(1099511627776),
+				"free":    int64(824633720832),
+				"encrypt": 0,
+				"topology": object{
+					"data":  []interface{}{},
+					"log":   []interface{}{},
+					"cache": []interface{}{},
+					"spare": []interface{}{},
+				},
+			}
+		},
+		create: func(s *Server, obj object) *Error {
+			obj["path"] = "/mnt/" + str(obj, "name")
+			return nil
+		},
+	}
+}
+
+func datasetCollection() *collection {
+	return &collection{
+		name:     "pool/dataset",
+		schema:   "pool_dataset",
+		required: []string{"name"},
+		defaults: func() object {
+			return object{
+				"type":           "FILESYSTEM",
+				"compression":    "LZ4",
+				"sync":           "STANDARD",
+				"deduplication":  "OFF",
+				"readonly":       "OFF",
+				"copies":         1,
+				"reservation":    0,
+				"refreservation": 0,
+			}
+		},
+		key: func(obj object) (interface{}, *Error) {
+			return str(obj, "name"), nil
+		},
+		create: func(s *Server, obj object) *Error {
+			name := str(obj, "name")
+			pool := strings.SplitN(name, "/", 2)[0]
+			if !poolExists(s, pool) {
+				return errValidation("pool_dataset_create.name", fmt.Sprintf("Pool %s does not exist", pool))
+			}
+			var parent object
+			if i := strings.LastIndex(name, "/"); i >= 0 {
+				var ok bool
+				if parent, ok = s.lookup("pool/dataset", name[:i]); !ok {
+					return errValidation("pool_dataset_create.name", fmt.Sprintf("Parent dataset %s does not exist", name[:i]))
+				}
+			}
+			if apiErr := s.createDatasetEncryption(obj, parent); apiErr != nil {
+				return apiErr
+			}
+
+			obj["pool"] = pool
+			switch str(obj, "type") {
+			case "VOLUME":
+				if _, ok := obj["volsize"]; !ok {
+					return errValidation("pool_dataset_create.volsize", "This field is required for VOLUME")
+				}
+				obj["mountpoint"] = nil
+				obj["volblocksize"] = "16K"
+			case "FILESYSTEM":
+				if _, ok := obj["volsize"]; ok {
+					return errValidation("pool_dataset_create.volsize", "This field is not valid for FILESYSTEM")
+				}
+				obj["mountpoint"] = "/mnt/" + name
+				for k, v := range map[string]interface{}{"atime": "ON", "exec": "ON", "recordsize": "128K", "snapdir": "HIDDEN", "quota": 0, "refquota": 0, "acltype": "POSIX"} {
+					if _, ok := obj[k]; !ok {
+						obj[k] = v
+					}
+				}
+			default:
+				return errValidation("pool_dataset_create.type", "Invalid choice")
+			}
+			return nil
+		},
+		update: func(s *Server, obj, params object) *Error {
+			for _, field := range []string{"name", "type"} {
+				if _, ok := params[field]; ok {
+					return errValidation("pool_dataset_update."+field, "Field cannot be changed")
+				}
+			}
+			for k, v := range params {
+				obj[k] = v
+			}
+			return nil
+		},
+		render: func(s *Server, obj object) object {
+			isVolume := str(obj, "type") == "VOLUME"
+			for _, prop := range datasetStringProperties {
+				if v, ok := obj[prop]; ok && !(isVolume && filesystemOnlyProperties[prop]) {
+					obj[prop] = stringProperty(fmt.Sprint(v))
+				}
+			}
+			for _, prop := range datasetSizeProperties {
+				if v, ok := obj[prop]; ok && !(isVolume && filesystemOnlyProperties[prop]) {
+					obj[prop] = sizeProperty(prop, v)
+				}
+			}
+			if v, ok := obj["copies"]; ok {
+				n, _ := jsonNumber(v)
+				obj["copies"] = object{"value": strconv.FormatInt(n, 10), "rawvalue": strconv.FormatInt(n, 10), "parsed": n, "source": "LOCAL"}
+			}
+			if v, ok := obj["comments"]; ok {
+				obj["comments"] = object{"value": v, "rawvalue": v, "parsed": v, "source": "LOCAL"}
+			}
+			s.renderDatasetEncryption(obj)
+			return obj
+		},
+		remove: func(s *Server, obj, params object) *Error {
+			name := str(obj, "name")
+			recursive, _ := params["recursive"].(bool)
+
+			children := datasetChildren(s, name)
+			snapshots := datasetSnapshots(s, name, true)
+			if len(children)+len(snapshots) > 0 && !recursive {
+				dependents := append(append([]string{}, children...), snapshots...)
+				sort.Strings(dependents)
+				return errCall(fmt.Sprintf("Failed to delete dataset: cannot destroy '%s': filesystem has children\nuse '-r' to destroy the following datasets:\n%s", name, strings.Join(dependents, "\n")))
+			}
+
+			for _, snapshot := range snapshots {
+				delete(s.collections["zfs/snapshot"].objects, snapshot)
+			}
+			for _, child := range append(children, name) {
+				delete(s.fileAttrs, str(s.collections["pool/dataset"].objects[child], "mountpoint"))
+				delete(s.collections["pool/dataset"].objects, child)
+				delete(s.files, zvolDevicePrefix+child)
+			}
+			s.deleteEncryptionRoots(append(children, name)...)
+			return nil
+		},
+		actions: map[string]actionFunc{
+			"change_key": func(s *Server, obj, params object) (interface{}, *Error) {
+				return s.changeDatasetKey(obj, params)
+			},
+			"unlock": func(s *Server, obj, params object) (interface{}, *Error) {
+				return s.unlockDataset(obj, params)
+			},
+			"lock": func(s *Server, obj, params object) (interface{}, *Error) {
+				return s.lockDataset(obj, params)
+			},
+			"encryption_summary": func(s *Server, obj, params object) (interface{}, *Error) {
+				return s.encryptionSummary(obj, params)
+			},
+			"export_key": func(s *Server, obj, params object) (interface{}, *Error) {
+				return s.exportDatasetKey(obj)
+			},
+			"permission": func(s *Server, obj, params object) (interface{}, *Error) {
+				return s.datasetPermission(obj, params)
+			},
+		},
+	}
+}
+
+// zvolDevicePrefix is the directory of the block devices of zvols
+const zvolDevicePrefix = "/dev/zvol/"
+
+// stringProperty renders a ZFS property with a string value
+func stringProperty(value string) object {
+	return object{"value": value, "rawvalue": strings.ToLower(value), "parsed": strings.ToLower(value), "source": "LOCAL"}
+}
+
+// sizeProperty renders a ZFS property with a size in bytes. Unset quotas
+// are reported with a null value and parsed value, as the middleware does.
+func sizeProperty(prop string, v interface{}) object {
+	n, _ := jsonNumber(v)
+	if n == 0 && (prop == "quota" || prop == "refquota") {
+		return object{"value": nil, "rawvalue": "0", "parsed": nil, "source": "DEFAULT"}
+	}
+	return object{"value": strconv.FormatInt(n, 10), "rawvalue": strconv.FormatInt(n, 10), "parsed": n, "source": "LOCAL"}
+}
+
+func poolExists(s *Server, name string) bool {
+	for _, pool := range s.collections["pool"].objects {
+		if str(pool, "name") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// datasetChildren returns the names of the descendants of a dataset
+func datasetChildren(s *Server, name string) []string {
+	var children []string
+	for id := range s.collections["pool/dataset"].objects {
+		if strings.HasPrefix(id, name+"/") {
+			children = append(children, id)
+		}
+	}
+	return children
+}
+
+// datasetSnapshots returns the IDs of the snapshots of a dataset, and of
+// its descendants when recursive is set
+func datasetSnapshots(s *Server, name string, recursive bool) []string {
+	var snapshots []string
+	for id, snapshot := range s.collections["zfs/snapshot"].objects {
+		dataset := str(snapshot, "dataset")
+		if dataset == name || (recursive && strings.HasPrefix(dataset, name+"/")) {
+			snapshots = append(snapshots, id)
+		}
+	}
+	return snapshots
+}
+
+// pathExists reports whether a path is the mountpoint of a filesystem
+// dataset, a stored file or a directory containing one
+func pathExists(s *Server, path string) bool {
+	for _, dataset := range s.collections["pool/dataset"].objects {
+		if mountpoint := str(dataset, "mountpoint"); mountpoint != "" && path == mountpoint {
+			return true
+		}
+	}
+	for file := range s.files {
+		if file == path || strings.HasPrefix(file, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func snapshotCollection() *collection {
+	return &collection{
+		name:     "zfs/snapshot",
+		schema:   "zfs_snapshot",
+		required: []string{"dataset", "name"},
+		key: func(obj object) (interface{}, *Error) {
+			return str(obj, "dataset") + "@" + str(obj, "name"), nil
+		},
+		create: func(s *Server, obj object) *Error {
+			dataset := str(obj, "dataset")
+			if _, ok := s.lookup("pool/dataset", dataset); !ok {
+				return errValidation("zfs_snapshot_create.dataset", fmt.Sprintf("Dataset %s does not exist", dataset))
+			}
+
+			snapshotName := str(obj, "name")
+			obj["snapshot_name"] = snapshotName
+			obj["name"] = dataset + "@" + snapshotName
+			obj["pool"] = strings.SplitN(dataset, "/", 2)[0]
+			obj["type"] = "SNAPSHOT"
+			obj["properties"] = object{
+				"used":       object{"value": "0B", "rawvalue": "0", "parsed": 0, "source": "NONE"},
+				"referenced": object{"value": "96K", "rawvalue": "98304", "parsed": 98304, "source": "NONE"},
+				"creation":   object{"value": "Mon Jan  1  0:00 2024", "rawvalue": "1704067200", "parsed": 1704067200, "source": "NONE"},
+			}
+
+			if recursive, _ := obj["recursive"].(bool); recursive {
+				for _, child := range datasetChildren(s, dataset) {
+					id := child + "@" + snapshotName
+					childSnapshot := copyObject(obj)
+					childSnapshot["id"] = id
+					childSnapshot["name"] = id
+					childSnapshot["dataset"] = child
+					s.collections["zfs/snapshot"].objects[id] = childSnapshot
+				}
+			}
+
+			// Request-only options are not reported by the API
+			delete(obj, "recursive")
+			delete(obj, "vmware_sync")
+			return nil
+		},
+		update: func(s *Server, obj, params object) *Error {
+			return errCall("Snapshots cannot be updated")
+		},
+	}
+}
+
+func snapshotTaskCollection() *collection {
+	return &collection{
+		name:     "pool/snapshottask",
+		schema:   "periodic_snapshot",
+		required: []string{"dataset"},
+		defaults: func() object {
+			return object{
+				"recursive":      false,
+				"exclude":        []interface{}{},
+				"lifetime_value": 2,
+				"lifetime_unit":  "WEEK",
+				"naming_schema":  "auto-%Y-%m-%d_%H-%M",
+				"allow_empty":    true,
+				"enabled":        true,
+				"vmware_sync":    false,
+			}
+		},
+		create: func(s *Server, obj object) *Error {
+			if _, ok := s.lookup("pool/dataset", str(obj, "dataset")); !ok {
+				return errValidation("periodic_snapshot_create.dataset", "Dataset not found")
+			}
+			obj["schedule"] = snapshotSchedule(obj["schedule"])
+			obj["state"] = object{"state": "PENDING"}
+			return nil
+		},
+		update: func(s *Server, obj, params object) *Error {
+			if dataset, ok := params["dataset"]; ok {
+				if _, ok := s.lookup("pool/dataset", dataset); !ok {
+					return errValidation("periodic_snapshot_update.dataset", "Dataset not found")
+				}
+			}
+			for k, v := range params {
+				obj[k] = v
+			}
+			obj["schedule"] = snapshotSchedule(obj["schedule"])
+			return nil
+		},
+	}
+}
+
+// replicationCollection holds replication tasks, so that the keys of their
+// source datasets can be exported. Replication itself is not simulated.
+func replicationCollection() *collection {
+	return &collection{
+		name:     "replication",
+		schema:   "replication",
+		required: []string{"name", "source_datasets", "target_dataset"},
+		defaults: func() object {
+			return object{
+				"direction": "PUSH",
+				"transport": "LOCAL",
+				"recursive": false,
+				"enabled":   true,
+			}
+		},
+		create: func(s *Server, obj object) *Error {
+			sources, _ := obj["source_datasets"].([]interface{})
+			for _, source := range sources {
+				if _, ok := s.lookup("pool/dataset", source); !ok {
+					return errValidation("replication_create.source_datasets", fmt.Sprintf("Dataset %v not found", source))
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// snapshotSchedule fills the fields of a cron schedule the request omits
+func snapshotSchedule(v interface{}) object {
+	schedule := object{"minute": "00", "hour": "*", "dom": "*", "month": "*", "dow": "*", "begin": "00:00", "end": "23:59"}
+	if m, ok := v.(map[string]interface{}); ok {
+		for k, v := range m {
+			schedule[k] = v
+		}
+	}
+	return schedule
+}
@@ -0,0 +1,175 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// systemInfo serves /system/info
+func (s *Server) systemInfo() map[string]interface{} {
+	return map[string]interface{}{
+		"version":             s.version,
+		"hostname":            "truenas",
+		"model":               "Fake CPU @ 3.00GHz",
+		"cores":               8,
+		"physical_cores":      4,
+		"physmem":             int64(34359738368),
+		"uptime_seconds":      3600.5,
+		"system_product":      "Fake Server",
+		"system_manufacturer": "Fake",
+		"system_serial":       "FAKE0001",
+		"timezone":            "UTC",
+		"ecc_memory":          true,
+	}
+}
+
+// fileAttrs are the permissions, ownership and ACL of a stored file or a
+// directory
+type fileAttrs struct {
+	mode int64
+	uid  int64
+	gid  int64
+	// acl holds the normalized entries of a non-trivial ACL, and is nil
+	// for a trivial one
+	acl []interface{}
+}
+
+// newFileAttrs returns the attributes of a file written by the middleware,
+// which runs as root with a 022 umask
+func newFileAttrs() *fileAttrs {
+	return &fileAttrs{mode: 0o644}
+}
+
+// putFile serves the multipart /filesystem/put upload. The file is stored
+// and a finished job is returned, as the middleware does. The append and
+// mode options are honoured. A path under /dev/zvol writes to the block
+// device of a zvol, which must exist and be large enough for the content.
+func (s *Server) putFile(r *http.Request) (interface{}, *Error) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		return nil, errCall(fmt.Sprintf("Invalid multipart body: %s", err))
+	}
+
+	var data struct {
+		Path    string `json:"path"`
+		Options struct {
+			Append bool   `json:"append"`
+			Mode   *int64 `json:"mode"`
+		} `json:"options"`
+	}
+	if err := json.Unmarshal([]byte(r.FormValue("data")), &data); err != nil || data.Path == "" {
+		return nil, errValidation("filesystem_put.path", "Path is required")
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, errValidation("filesystem_put.file", "File is required")
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, errCall(fmt.Sprintf("Unable to read file: %s", err))
+	}
+
+	if data.Options.Append {
+		if _, ok := s.files[data.Path]; !ok {
+			return nil, errCall(fmt.Sprintf("[Errno 2] No such file or directory: '%s'", data.Path))
+		}
+		content = append(append([]byte{}, s.files[data.Path]...), content...)
+	}
+
+	if zvol := strings.TrimPrefix(data.Path, zvolDevicePrefix); zvol != data.Path {
+		dataset, ok := s.lookup("pool/dataset", zvol)
+		if !ok || str(dataset, "type") != "VOLUME" {
+			return nil, errCall(fmt.Sprintf("[Errno 2] No such file or directory: '%s'", data.Path))
+		}
+		if volsize, _ := jsonNumber(dataset["volsize"]); int64(len(content)) > volsize {
+			return nil, errCall(fmt.Sprintf("[Errno 28] No space left on device: '%s'", data.Path))
+		}
+	}
+
+	s.files[data.Path] = content
+	if _, ok := s.fileAttrs[data.Path]; !ok {
+		s.fileAttrs[data.Path] = newFileAttrs()
+	}
+	if data.Options.Mode != nil {
+		s.fileAttrs[data.Path].mode = *data.Options.Mode & 0o7777
+	}
+	return s.startJob("filesystem.put", true), nil
+}
+
+// deleteFile serves /filesystem/delete
+func (s *Server) deleteFile(body []byte) (interface{}, *Error) {
+	var data struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil || data.Path == "" {
+		return nil, errValidation("filesystem_delete.path", "Path is required")
+	}
+
+	if _, ok := s.files[data.Path]; !ok {
+		return nil, errNotFound("filesystem", data.Path)
+	}
+	delete(s.files, data.Path)
+	delete(s.fileAttrs, data.Path)
+	return true, nil
+}
+
+// statFile serves /filesystem/stat. Stored files are regular files, and
+// the mountpoints of datasets and the parents of stored files directories.
+func (s *Server) statFile(body []byte) (interface{}, *Error) {
+	var path string
+	if err := json.Unmarshal(body, &path); err != nil || path == "" {
+		return nil, errValidation("filesystem_stat.path", "Path is required")
+	}
+	attrs := s.pathAttrs(path)
+	if attrs == nil {
+		return nil, errNoEntry(path)
+	}
+
+	stat := map[string]interface{}{
+		"realpath": path,
+		"type":     "DIRECTORY",
+		"size":     0,
+		"mode":     0o40000 | attrs.mode,
+		"uid":      attrs.uid,
+		"gid":      attrs.gid,
+		"user":     s.accountName("user", "uid", "username", attrs.uid),
+		"group":    s.accountName("group", "gid", "name", attrs.gid),
+	}
+	if content, ok := s.files[path]; ok {
+		stat["type"] = "FILE"
+		stat["size"] = len(content)
+		stat["mode"] = 0o100000 | attrs.mode
+	}
+	return stat, nil
+}
+
+// setFilePermissions serves the /filesystem/setperm job
+func (s *Server) setFilePermissions(body []byte) (interface{}, *Error) {
+	var data permissionRequest
+	if err := json.Unmarshal(body, &data); err != nil || data.Path == "" {
+		return nil, errValidation("filesystem_setperm.path", "Path is required")
+	}
+	if apiErr := s.applyPermissions(data, "filesystem_setperm"); apiErr != nil {
+		return nil, apiErr
+	}
+	return s.startJob("filesystem.setperm", nil), nil
+}
+
+// accountName returns the name of the user or group with the given ID, or
+// nil when there is none. ID 0 is root.
+func (s *Server) accountName(namespace, idField, nameField string, id int64) interface{} {
+	if id == 0 {
+		return "root"
+	}
+	for _, account := range s.collections[namespace].objects {
+		if n, _ := jsonNumber(account[idField]); n == id {
+			return str(account, nameField)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,556 @@
+package fake
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// VM states reported in status.state
+const (
+	vmStopped   = "STOPPED"
+	vmRunning   = "RUNNING"
+	vmSuspended = "SUSPENDED"
+)
+
+// firstDeviceOrder is the boot order given to the first device of a VM
+// that does not set one
+const firstDeviceOrder = 1001
+
+var vmNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// HostCapacity is what the host offers to VMs
+type HostCapacity struct {
+	// Memory is the memory in bytes available to VMs when none is running
+	Memory int64
+	// MaxVCPUs is the maximum number of vCPUs of a VM
+	MaxVCPUs int64
+	// VirtualizationError is the reason the host cannot run VMs, if any
+	VirtualizationError string
+}
+
+// DefaultHostCapacity is the host capacity until changed
+var DefaultHostCapacity = HostCapacity{Memory: 64 << 30, MaxVCPUs: 16}
+
+func vmCollection() *collection {
+	return &collection{
+		name:     "vm",
+		schema:   "vm",
+		required: []string{"name", "memory"},
+		unique:   []string{"name"},
+		defaults: func() object {
+			return object{
+				"description":           "",
+				"vcpus":                 1,
+				"cores":                 1,
+				"threads":               1,
+				"cpu_mode":              "CUSTOM",
+				"cpu_model":             nil,
+				"bootloader":            "UEFI",
+				"bootloader_ovmf":       "OVMF_CODE.fd",
+				"autostart":             true,
+				"hide_from_msr":         false,
+				"ensure_display_device": true,
+				"time":                  "LOCAL",
+				"shutdown_timeout":      90,
+				"arch_type":             nil,
+				"machine_type":          nil,
+				"min_memory":            nil,
+				"hyperv_enlightenments": false,
+				"command_line_args":     "",
+			}
+		},
+		create: func(s *Server, obj object) *Error {
+			if !vmNamePattern.MatchString(str(obj, "name")) {
+				return errValidation("vm_create.name", "Only alphanumeric characters are allowed.")
+			}
+			delete(obj, "devices")
+			obj["uuid"] = fmt.Sprintf("00000000-0000-4000-8000-%012d", obj["id"])
+			s.vmStates[fmt.Sprint(obj["id"])] = vmStopped
+			return nil
+		},
+		update: func(s *Server, obj, params object) *Error {
+			if name, ok := params["name"]; ok && !vmNamePattern.MatchString(fmt.Sprint(name)) {
+				return errValidation("vm_update.name", "Only alphanumeric characters are allowed.")
+			}
+			delete(params, "devices")
+			for k, v := range params {
+				obj[k] = v
+			}
+			return nil
+		},
+		render: func(s *Server, obj object) object {
+			devices := []object{}
+			for _, device := range s.collections["vm/device"].list(s, nil) {
+				if fmt.Sprint(device["vm"]) == fmt.Sprint(obj["id"]) {
+					devices = append(devices, device)
+				}
+			}
+			obj["devices"] = devices
+			obj["status"] = vmStatus(s.vmStates[fmt.Sprint(obj["id"])])
+			obj["display_available"] = false
+			return obj
+		},
+		remove: func(s *Server, obj, params object) *Error {
+			// A running VM is powered off before it is deleted
+			id := fmt.Sprint(obj["id"])
+			for deviceID, device := range s.collections["vm/device"].objects {
+				if fmt.Sprint(device["vm"]) == id {
+					delete(s.collections["vm/device"].objects, deviceID)
+				}
+			}
+			delete(s.vmStates, id)
+			return nil
+		},
+		actions: map[string]actionFunc{
+			"start": func(s *Server, obj, params object) (interface{}, *Error) {
+				if apiErr := s.checkVMCapacity(obj, params); apiErr != nil {
+					return nil, apiErr
+				}
+				return s.startJob("vm.start", s.setVMState(obj, vmRunning)), nil
+			},
+			"stop": func(s *Server, obj, params object) (interface{}, *Error) {
+				return s.startJob("vm.stop", s.setVMState(obj, vmStopped)), nil
+			},
+			"restart": func(s *Server, obj, params object) (interface{}, *Error) {
+				return s.startJob("vm.restart", s.setVMState(obj, vmRunning)), nil
+			},
+			"poweroff": func(s *Server, obj, params object) (interface{}, *Error) {
+				return s.setVMState(obj, vmStopped), nil
+			},
+			"suspend": func(s *Server, obj, params object) (interface{}, *Error) {
+				if s.vmStates[fmt.Sprint(obj["id"])] != vmRunning {
+					return nil, errCall(fmt.Sprintf("VM %s is not running", str(obj, "name")))
+				}
+				return s.setVMState(obj, vmSuspended), nil
+			},
+			"resume": func(s *Server, obj, params object) (interface{}, *Error) {
+				if s.vmStates[fmt.Sprint(obj["id"])] != vmSuspended {
+					return nil, errCall(fmt.Sprintf("VM %s is not suspended", str(obj, "name")))
+				}
+				return s.setVMState(obj, vmRunning), nil
+			},
+			"clone": func(s *Server, obj, params object) (interface{}, *Error) {
+				return s.cloneVM(obj, params)
+			},
+			"get_display_devices": func(s *Server, obj, params object) (interface{}, *Error) {
+				return s.vmDisplayDevices(obj), nil
+			},
+			"get_display_web_uri": func(s *Server, obj, params object) (interface{}, *Error) {
+				return s.vmDisplayWebURIs(obj, params)
+			},
+			"get_console": func(s *Server, obj, params object) (interface{}, *Error) {
+				return fmt.Sprintf("%v_%s", obj["id"], str(obj, "name")), nil
+			},
+		},
+	}
+}
+
+// vmCloneSuffix separates a VM name from the index of a generated clone name
+const vmCloneSuffix = "_clone"
+
+// cloneVM copies a VM and its devices like vm.clone. NICs get new MAC
+// addresses, displays new ports, and the zvol of each disk is cloned from a
+// snapshot named after the new VM. Everything created is rolled back if a
+// step fails.
+func (s *Server) cloneVM(source, params object) (interface{}, *Error) {
+	name, _ := params["name"].(string)
+	if name == "" {
+		for i := 0; ; i++ {
+			name = fmt.Sprintf("%s%s%d", str(source, "name"), vmCloneSuffix, i)
+			if !vmNameExists(s, name) {
+				break
+			}
+		}
+	}
+
+	vm := copyObject(source)
+	for _, field := range []string{"id", "uuid", "devices", "status", "display_available"} {
+		delete(vm, field)
+	}
+	vm["name"] = name
+
+	var createdDatasets, createdSnapshots []string
+	var created object
+	rollback := func() {
+		for _, id := range createdDatasets {
+			delete(s.collections["pool/dataset"].objects, id)
+		}
+		for _, id := range createdSnapshots {
+			delete(s.collections["zfs/snapshot"].objects, id)
+		}
+		if created != nil {
+			_ = s.collections["vm"].deleteObject(s, fmt.Sprint(created["id"]), nil)
+		}
+	}
+
+	created, apiErr := s.collections["vm"].createObject(s, vm)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	sourceID, _ := jsonNumber(source["id"])
+	for _, device := range s.collections["vm/device"].list(s, nil) {
+		if id, _ := jsonNumber(device["vm"]); id != sourceID {
+			continue
+		}
+
+		device = copyObject(device)
+		delete(device, "id")
+		device["vm"] = created["id"]
+		attributes, _ := device["attributes"].(map[string]interface{})
+		switch str(device, "dtype") {
+		case "NIC":
+			delete(attributes, "mac")
+		case "DISPLAY":
+			delete(attributes, "port")
+			delete(attributes, "web_port")
+		case "DISK":
+			zvol := strings.TrimPrefix(fmt.Sprint(attributes["path"]), "/dev/zvol/")
+			dataset, ok := s.collections["pool/dataset"].objects[zvol]
+			if !ok {
+				rollback()
+				return nil, errCall(fmt.Sprintf("zvol %s does not exist.", zvol))
+			}
+
+			snapshot := zvol + "@" + name
+			if _, apiErr := s.collections["zfs/snapshot"].createObject(s, object{"dataset": zvol, "name": name}); apiErr != nil {
+				rollback()
+				return nil, apiErr
+			}
+			createdSnapshots = append(createdSnapshots, snapshot)
+
+			clone := copyObject(dataset)
+			delete(clone, "id")
+			clone["name"] = zvol + "_" + name
+			if _, apiErr := s.collections["pool/dataset"].createObject(s, clone); apiErr != nil {
+				rollback()
+				return nil, apiErr
+			}
+			s.collections["pool/dataset"].objects[zvol+"_"+name]["origin"] = snapshot
+			createdDatasets = append(createdDatasets, zvol+"_"+name)
+			attributes["path"] = "/dev/zvol/" + zvol + "_" + name
+		}
+
+		if _, apiErr := s.collections["vm/device"].createObject(s, device); apiErr != nil {
+			rollback()
+			return nil, apiErr
+		}
+	}
+
+	return true, nil
+}
+
+// vmNameExists reports whether a VM has the given name
+func vmNameExists(s *Server, name string) bool {
+	for _, vm := range s.collections["vm"].objects {
+		if str(vm, "name") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// setVMState changes the power state of a VM and returns nil, the result
+// of the middleware's lifecycle methods
+func (s *Server) setVMState(obj object, state string) interface{} {
+	s.vmStates[fmt.Sprint(obj["id"])] = state
+	return nil
+}
+
+// vmStatus is the status block of a VM in the given state
+func vmStatus(state string) object {
+	status := object{"state": state, "pid": nil, "domain_state": "SHUTOFF"}
+	switch state {
+	case vmRunning:
+		status["pid"] = 4242
+		status["domain_state"] = "RUNNING"
+	case vmSuspended:
+		status["pid"] = 4242
+		status["domain_state"] = "PAUSED"
+	}
+	return status
+}
+
+// vmDeviceDefaults are the attribute defaults of each device type
+var vmDeviceDefaults = map[string]object{
+	"NIC":     {"type": "E1000", "nic_attach": nil, "trust_guest_rx_filters": false},
+	"DISK":    {"type": "AHCI", "iotype": "THREADS", "logical_sectorsize": nil, "physical_sectorsize": nil},
+	"CDROM":   {},
+	"DISPLAY": {"bind": "127.0.0.1", "password": "", "web": true, "type": "SPICE", "resolution": "1024x768", "wait": false},
+	"PCI":     {},
+	"USB":     {"controller_type": "nec-xhci", "device": nil},
+	"RAW":     {"type": "AHCI", "iotype": "THREADS", "boot": false, "size": nil},
+}
+
+// vmDeviceRequired are the required attributes of each device type
+var vmDeviceRequired = map[string][]string{
+	"DISK":  {"path"},
+	"CDROM": {"path"},
+	"PCI":   {"pptdev"},
+	"RAW":   {"path"},
+}
+
+func vmDeviceCollection() *collection {
+	return &collection{
+		name:     "vm/device",
+		schema:   "vmdevice",
+		required: []string{"vm", "dtype"},
+		create: func(s *Server, obj object) *Error {
+			vmID, ok := jsonNumber(obj["vm"])
+			if !ok {
+				return errValidation("vmdevice_create.vm", "Not an integer")
+			}
+			// The middleware accepts the VM ID as a numeric string
+			obj["vm"] = vmID
+			if _, ok := s.lookup("vm", vmID); !ok {
+				return errValidation("vmdevice_create.vm", fmt.Sprintf("VM %d not found", vmID))
+			}
+
+			if obj["order"] == nil {
+				obj["order"] = nextDeviceOrder(s, vmID)
+			}
+
+			return s.completeDeviceAttributes("vmdevice_create", obj, nil)
+		},
+		update: func(s *Server, obj, params object) *Error {
+			if _, ok := params["vm"]; ok {
+				return errValidation("vmdevice_update.vm", "Field cannot be changed")
+			}
+			updated := copyObject(obj)
+			for k, v := range params {
+				updated[k] = v
+			}
+			if apiErr := s.completeDeviceAttributes("vmdevice_update", updated, obj); apiErr != nil {
+				return apiErr
+			}
+			for k, v := range updated {
+				obj[k] = v
+			}
+			return nil
+		},
+	}
+}
+
+// completeDeviceAttributes validates the attributes of a device and fills
+// in their defaults. previous is the device before an update, whose
+// generated NIC MAC address and display ports are kept.
+func (s *Server) completeDeviceAttributes(schema string, obj, previous object) *Error {
+	dtype := str(obj, "dtype")
+	defaults, ok := vmDeviceDefaults[dtype]
+	if !ok {
+		return errValidation(schema+".dtype", "Invalid choice")
+	}
+
+	attributes, _ := obj["attributes"].(map[string]interface{})
+	if attributes == nil {
+		attributes = map[string]interface{}{}
+	}
+	for k, v := range copyObject(defaults) {
+		if _, ok := attributes[k]; !ok {
+			attributes[k] = v
+		}
+	}
+	for _, field := range vmDeviceRequired[dtype] {
+		if v, ok := attributes[field]; !ok || v == nil || v == "" {
+			return errValidation(fmt.Sprintf("%s.attributes.%s", schema, field), "attribute required")
+		}
+	}
+
+	var previousAttributes map[string]interface{}
+	if previous != nil {
+		previousAttributes, _ = previous["attributes"].(map[string]interface{})
+	}
+	keep := func(field string, generate func() interface{}) {
+		if v, ok := attributes[field]; ok && v != nil && v != "" {
+			return
+		}
+		if v, ok := previousAttributes[field]; ok && v != nil {
+			attributes[field] = v
+			return
+		}
+		attributes[field] = generate()
+	}
+
+	switch dtype {
+	case "NIC":
+		keep("mac", func() interface{} {
+			id, _ := jsonNumber(obj["id"])
+			return fmt.Sprintf("00:a0:98:%02x:%02x:%02x", (id>>16)&0xff, (id>>8)&0xff, id&0xff)
+		})
+	case "CDROM":
+		path := fmt.Sprint(attributes["path"])
+		if _, uploaded := s.files[path]; !uploaded && !pathExists(s, path) {
+			return errValidation(schema+".attributes.path", fmt.Sprintf("%s does not exist", path))
+		}
+	case "DISPLAY":
+		keep("port", func() interface{} { return nextDisplayPort(s) })
+		keep("web_port", func() interface{} { return nextDisplayPort(s) + 1000 })
+	}
+
+	obj["attributes"] = attributes
+	return nil
+}
+
+// nextDeviceOrder returns the boot order after the highest one of a VM's
+// devices
+func nextDeviceOrder(s *Server, vmID int64) int64 {
+	next := int64(firstDeviceOrder)
+	for _, device := range s.collections["vm/device"].objects {
+		if id, _ := jsonNumber(device["vm"]); id != vmID {
+			continue
+		}
+		if order, ok := jsonNumber(device["order"]); ok && order >= next {
+			next = order + 1
+		}
+	}
+	return next
+}
+
+// vmDisplayDevices returns the display devices of a VM
+func (s *Server) vmDisplayDevices(vm object) []object {
+	displays := []object{}
+	for _, device := range s.collections["vm/device"].list(s, nil) {
+		if fmt.Sprint(device["vm"]) == fmt.Sprint(vm["id"]) && str(device, "dtype") == "DISPLAY" {
+			displays = append(displays, device)
+		}
+	}
+	return displays
+}
+
+// vmDisplayWebURIs serves vm.get_display_web_uri: the URI of the web client
+// of each display, which the middleware's nginx proxies to its web port
+func (s *Server) vmDisplayWebURIs(vm, params object) (interface{}, *Error) {
+	host := str(params, "host")
+	if host == "" {
+		host = "truenas.local"
+	}
+	protocol := "HTTP"
+	if options, ok := params["options"].(map[string]interface{}); ok && options["protocol"] != nil {
+		protocol = fmt.Sprint(options["protocol"])
+	}
+	if protocol != "HTTP" && protocol != "HTTPS" {
+		return nil, errValidation("vm_get_display_web_uri.options.protocol", "Invalid choice")
+	}
+
+	uris := map[string]interface{}{}
+	for _, device := range s.vmDisplayDevices(vm) {
+		attributes, _ := device["attributes"].(map[string]interface{})
+		if web, _ := attributes["web"].(bool); !web {
+			uris[fmt.Sprint(device["id"])] = map[string]interface{}{"error": "Web display is not configured", "uri": nil}
+			continue
+		}
+
+		query := url.Values{}
+		query.Set("path", fmt.Sprintf("vm/display/%v/websockify", device["id"]))
+		query.Set("autoconnect", "1")
+		if password := fmt.Sprint(attributes["password"]); attributes["password"] != nil && password != "" {
+			query.Set("password", password)
+		}
+		uris[fmt.Sprint(device["id"])] = map[string]interface{}{
+			"error": nil,
+			"uri":   fmt.Sprintf("%s://%s/vm/display/%v/spice_auto.html?%s", strings.ToLower(protocol), host, device["id"], query.Encode()),
+		}
+	}
+	return uris, nil
+}
+
+// portWizard serves vm.port_wizard: the first two ports from 5900 that no
+// display device uses
+func (s *Server) portWizard() map[string]interface{} {
+	used := map[int64]bool{}
+	for _, device := range s.collections["vm/device"].objects {
+		attributes, _ := device["attributes"].(map[string]interface{})
+		for _, field := range []string{"port", "web_port"} {
+			if port, ok := jsonNumber(attributes[field]); ok {
+				used[port] = true
+			}
+		}
+	}
+
+	var free []int64
+	for port := int64(5900); len(free) < 2; port++ {
+		if !used[port] {
+			free = append(free, port)
+		}
+	}
+	return map[string]interface{}{"port": free[0], "web": free[1]}
+}
+
+// vmMemoryInUse serves vm.get_vmemory_in_use: the memory in bytes of
+// running VMs without autostart (RNP), stopped VMs with autostart (PRD) and
+// running VMs with autostart (RPRD)
+func (s *Server) vmMemoryInUse() map[string]int64 {
+	inUse := map[string]int64{"RNP": 0, "PRD": 0, "RPRD": 0}
+	for id, vm := range s.collections["vm"].objects {
+		memory, _ := jsonNumber(vm["memory"])
+		running := s.vmStates[id] != vmStopped
+		autostart, _ := vm["autostart"].(bool)
+		switch {
+		case running && autostart:
+			inUse["RPRD"] += memory << 20
+		case running:
+			inUse["RNP"] += memory << 20
+		case autostart:
+			inUse["PRD"] += memory << 20
+		}
+	}
+	return inUse
+}
+
+// runningVMMemory returns the memory in bytes of the running VMs
+func (s *Server) runningVMMemory() int64 {
+	inUse := s.vmMemoryInUse()
+	return inUse["RNP"] + inUse["RPRD"]
+}
+
+// availableVMMemory serves vm.get_available_memory: the memory of the host
+// not taken by running VMs
+func (s *Server) availableVMMemory() int64 {
+	return max(s.host.Memory-s.runningVMMemory(), 0)
+}
+
+// virtualizationDetails serves vm.virtualization_details
+func (s *Server) virtualizationDetails() map[string]interface{} {
+	if s.host.VirtualizationError != "" {
+		return map[string]interface{}{"supported": false, "error": s.host.VirtualizationError}
+	}
+	return map[string]interface{}{"supported": true, "error": nil}
+}
+
+// checkVMCapacity fails the start of a VM that the host cannot run, like
+// vm.start does unless overcommit is set
+func (s *Server) checkVMCapacity(vm, params object) *Error {
+	if s.host.VirtualizationError != "" {
+		return errCall(s.host.VirtualizationError)
+	}
+
+	vcpus, _ := jsonNumber(vm["vcpus"])
+	cores, _ := jsonNumber(vm["cores"])
+	threads, _ := jsonNumber(vm["threads"])
+	if vcpus*cores*threads > s.host.MaxVCPUs {
+		return errCall(fmt.Sprintf("Maximum %d vCPUs are supported", s.host.MaxVCPUs))
+	}
+
+	if overcommit, _ := params["overcommit"].(bool); overcommit {
+		return nil
+	}
+	memory, _ := jsonNumber(vm["memory"])
+	if memory<<20 > s.availableVMMemory() {
+		return errCall(fmt.Sprintf("Cannot guarantee memory for guest %s", str(vm, "name")))
+	}
+	return nil
+}
+
+// nextDisplayPort returns an unused display port
+func nextDisplayPort(s *Server) int64 {
+	next := int64(5900)
+	for _, device := range s.collections["vm/device"].objects {
+		attributes, _ := device["attributes"].(map[string]interface{})
+		if port, ok := jsonNumber(attributes["port"]); ok && port >= next {
+			next = port + 1
+		}
+	}
+	return next
+}
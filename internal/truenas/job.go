@@ -0,0 +1,266 @@
+package truenas
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	defaultJobPollInterval = 2 * time.Second
+
+	// jobWatchPollInterval is how often a job whose updates are pushed by
+	// the transport is polled anyway, in case an update was missed
+	jobWatchPollInterval = 30 * time.Second
+)
+
+// Job states reported by the TrueNAS middleware
+const (
+	JobStateWaiting = "WAITING"
+	JobStateRunning = "RUNNING"
+	JobStateSuccess = "SUCCESS"
+	JobStateFailed  = "FAILED"
+	JobStateAborted = "ABORTED"
+)
+
+// JobProgress is the progress block of a TrueNAS job
+type JobProgress struct {
+	Percent     float64 `json:"percent"`
+	Description string  `json:"description"`
+}
+
+// Job is a long-running TrueNAS middleware job as returned by /core/get_jobs
+type Job struct {
+	ID        int64           `json:"id"`
+	Method    string          `json:"method"`
+	State     string          `json:"state"`
+	Progress  JobProgress     `json:"progress"`
+	Result    json.RawMessage `json:"result"`
+	Error     string          `json:"error"`
+	Exception string          `json:"exception"`
+}
+
+// Finished reports whether the job has reached a terminal state
+func (j *Job) Finished() bool {
+	switch j.State {
+	case JobStateSuccess, JobStateFailed, JobStateAborted:
+		return true
+	}
+	return false
+}
+
+// JobError is returned when a job ends in the FAILED or ABORTED state
+type JobError struct {
+	ID        int64
+	Method    string
+	State     string
+	Message   string
+	Exception string
+}
+
+func (e *JobError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = "no error message reported"
+	}
+	if e.Method != "" {
+		return fmt.Sprintf("job %d (%s) %s: %s", e.ID, e.Method, e.State, msg)
+	}
+	return fmt.Sprintf("job %d %s: %s", e.ID, e.State, msg)
+}
+
+// parseJobID returns the job ID if the response body is a bare job ID
+func parseJobID(body []byte) (int64, bool) {
+	id, err := strconv.ParseInt(string(bytes.TrimSpace(body)), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// GetJob retrieves a single job by ID
+func (c *Client) GetJob(ctx context.Context, id int64) (*Job, error) {
+	respBody, err := c.Get(ctx, fmt.Sprintf("/core/get_jobs?id=%d", id))
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []Job
+	if err := json.Unmarshal(respBody, &jobs); err != nil {
+		return nil, fmt.Errorf("error unmarshaling job %d: %w", id, err)
+	}
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("job %d not found", id)
+	}
+
+	return &jobs[0], nil
+}
+
+// WaitForJob polls a job until it reaches a terminal state or ctx is done.
+// When the transport pushes job updates they are used instead, with a slow
+// poll as a safety net. Progress changes are reported through tflog. A
+// FAILED or ABORTED job is returned together with a *JobError.
+func (c *Client) WaitForJob(ctx context.Context, id int64) (*Job, error) {
+	pollInterval := c.JobPollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultJobPollInterval
+	}
+	interval := pollInterval
+
+	var updates <-chan Job
+	if watcher, ok := c.Transport.(jobWatcher); ok {
+		ch, stop, err := watcher.watchJob(ctx, id)
+		if err != nil {
+			tflog.Debug(ctx, "Falling back to polling for TrueNAS job", map[string]interface{}{
+				"job_id": id,
+				"error":  err.Error(),
+			})
+		} else {
+			defer stop()
+			updates = ch
+			interval = jobWatchPollInterval
+		}
+	}
+
+	var lastProgress JobProgress
+	job, err := c.GetJob(ctx, id)
+	for {
+		if err != nil {
+			return nil, err
+		}
+
+		if job.Progress != lastProgress {
+			lastProgress = job.Progress
+			tflog.Info(ctx, "TrueNAS job progress", map[string]interface{}{
+				"job_id":      job.ID,
+				"method":      job.Method,
+				"state":       job.State,
+				"percent":     job.Progress.Percent,
+				"description": job.Progress.Description,
+			})
+		}
+
+		if job.Finished() {
+			if job.State != JobStateSuccess {
+				return job, &JobError{
+					ID:        job.ID,
+					Method:    job.Method,
+					State:     job.State,
+					Message:   job.Error,
+					Exception: job.Exception,
+				}
+			}
+			return job, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return job, fmt.Errorf("waiting for job %d: %w", id, ctx.Err())
+		case update, ok := <-updates:
+			if !ok {
+				// The watch was interrupted, e.g. by a reconnect
+				updates = nil
+				interval = pollInterval
+			} else if update.State != "" {
+				job = &update
+				continue
+			}
+		case <-time.After(interval):
+		}
+
+		job, err = c.GetJob(ctx, id)
+	}
+}
+
+// DoJobRequest performs a request against an endpoint that runs as a
+// middleware job. If the response is a job ID, the job is waited on and its
+// result is returned instead of the ID.
+func (c *Client) DoJobRequest(ctx context.Context, method, endpoint string, body interface{}) ([]byte, error) {
+	respBody, err := c.DoRequest(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+
+	id, ok := parseJobID(respBody)
+	if !ok {
+		return respBody, nil
+	}
+
+	tflog.Debug(ctx, "Waiting for TrueNAS job", map[string]interface{}{
+		"job_id":   id,
+		"endpoint": endpoint,
+	})
+
+	job, err := c.WaitForJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return job.Result, nil
+}
+
+// PostJob performs a POST request and waits for the resulting job
+func (c *Client) PostJob(ctx context.Context, endpoint string, body interface{}) ([]byte, error) {
+	return c.DoJobRequest(ctx, http.MethodPost, endpoint, body)
+}
+
+// PutJob performs a PUT request and waits for the resulting job
+func (c *Client) PutJob(ctx context.Context, endpoint string, body interface{}) ([]byte, error) {
+	return c.DoJobRequest(ctx, http.MethodPut, endpoint, body)
+}
+
+// DeleteJob performs a DELETE request (with an optional body) and waits for the resulting job
+func (c *Client) DeleteJob(ctx context.Context, endpoint string, body interface{}) ([]byte, error) {
+	return c.DoJobRequest(ctx, http.MethodDelete, endpoint, body)
+}
+
+// Download runs a middleware job that writes its output to a file, such as
+// pool.dataset.export_keys, through /core/download. The file is fetched
+// from the URL the middleware returns, and the job is waited on so that
+// its failure is reported instead of a partial file.
+func (c *Client) Download(ctx context.Context, method string, args []interface{}, filename string) ([]byte, error) {
+	if args == nil {
+		args = []interface{}{}
+	}
+	respBody, err := c.Post(ctx, "/core/download", map[string]interface{}{
+		"method":   method,
+		"args":     args,
+		"filename": filename,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var download []json.RawMessage
+	if err := json.Unmarshal(respBody, &download); err != nil || len(download) != 2 {
+		return nil, fmt.Errorf("unexpected core.download response: %s", respBody)
+	}
+	var jobID int64
+	var downloadURL string
+	if err := json.Unmarshal(download[0], &jobID); err != nil {
+		return nil, fmt.Errorf("parsing download job ID: %w", err)
+	}
+	if err := json.Unmarshal(download[1], &downloadURL); err != nil {
+		return nil, fmt.Errorf("parsing download URL: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+downloadURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	content, err := c.send(ctx, c.Authenticator, req)
+	if err != nil {
+		return nil, fmt.Errorf("downloading output of %s: %w", method, err)
+	}
+
+	if _, err := c.WaitForJob(ctx, jobID); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
@@ -0,0 +1,105 @@
+package truenas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newJobTestServer returns a server whose POST /chart/release starts job 42
+// and whose /core/get_jobs reports the given states in sequence
+func newJobTestServer(t *testing.T, states []Job) (*Client, *int32) {
+	t.Helper()
+
+	var polls int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2.0/chart/release", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("42"))
+	})
+	mux.HandleFunc("/api/v2.0/core/get_jobs", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "42", r.URL.Query().Get("id"))
+		n := int(atomic.AddInt32(&polls, 1)) - 1
+		if n >= len(states) {
+			n = len(states) - 1
+		}
+		_ = json.NewEncoder(w).Encode([]Job{states[n]})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(server.URL, "test-key")
+	require.NoError(t, err)
+	client.JobPollInterval = time.Millisecond
+
+	return client, &polls
+}
+
+// TestWaitForJob_Success tests that the job result replaces the job ID
+func TestWaitForJob_Success(t *testing.T) {
+	client, polls := newJobTestServer(t, []Job{
+		{ID: 42, Method: "chart.release.create", State: JobStateRunning, Progress: JobProgress{Percent: 10, Description: "Installing"}},
+		{ID: 42, Method: "chart.release.create", State: JobStateRunning, Progress: JobProgress{Percent: 80, Description: "Deploying"}},
+		{ID: 42, Method: "chart.release.create", State: JobStateSuccess, Result: json.RawMessage(`{"name":"plex"}`)},
+	})
+
+	result, err := client.PostJob(context.Background(), "/chart/release", map[string]interface{}{"release_name": "plex"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"plex"}`, string(result))
+	assert.Equal(t, int32(3), atomic.LoadInt32(polls))
+}
+
+// TestWaitForJob_Failed tests that a FAILED job surfaces a typed JobError
+func TestWaitForJob_Failed(t *testing.T) {
+	client, _ := newJobTestServer(t, []Job{
+		{ID: 42, Method: "chart.release.create", State: JobStateFailed, Error: "[EFAULT] Failed to install chart", Exception: "Traceback (most recent call last): ..."},
+	})
+
+	_, err := client.PostJob(context.Background(), "/chart/release", nil)
+	require.Error(t, err)
+
+	var jobErr *JobError
+	require.True(t, errors.As(err, &jobErr))
+	assert.Equal(t, int64(42), jobErr.ID)
+	assert.Equal(t, JobStateFailed, jobErr.State)
+	assert.Equal(t, "[EFAULT] Failed to install chart", jobErr.Message)
+	assert.Contains(t, jobErr.Exception, "Traceback")
+	assert.Contains(t, err.Error(), "Failed to install chart")
+}
+
+// TestWaitForJob_ContextCancelled tests that waiting stops when the context is done
+func TestWaitForJob_ContextCancelled(t *testing.T) {
+	client, _ := newJobTestServer(t, []Job{
+		{ID: 42, State: JobStateRunning},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := client.WaitForJob(ctx, 42)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+// TestDoJobRequest_NonJobResponse tests that non-job responses pass through unchanged
+func TestDoJobRequest_NonJobResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"tank/data"}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "test-key")
+	require.NoError(t, err)
+
+	result, err := client.PostJob(context.Background(), "/pool/dataset", map[string]interface{}{"name": "tank/data"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"tank/data"}`, string(result))
+}
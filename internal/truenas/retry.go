@@ -0,0 +1,147 @@
+package truenas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	defaultMaxRetries   = 4
+	defaultRetryMinWait = 1 * time.Second
+	defaultRetryMaxWait = 30 * time.Second
+)
+
+// RetryPolicy controls how transient API failures are retried
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt. Zero
+	// disables retries.
+	MaxRetries int
+
+	// MinWait is the backoff before the first retry; it doubles on each
+	// subsequent retry
+	MinWait time.Duration
+
+	// MaxWait caps the backoff between two attempts
+	MaxWait time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy used by NewClient
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: defaultMaxRetries,
+		MinWait:    defaultRetryMinWait,
+		MaxWait:    defaultRetryMaxWait,
+	}
+}
+
+// IsRetryable reports whether err is a transient failure worth retrying:
+// refused or reset connections, truncated responses, rate limiting and the
+// gateway errors nginx returns while middlewared restarts. Validation
+// errors and cancelled contexts are never retried.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// isIdempotentMethod reports whether requests with this method are safe to
+// retry without the caller opting in
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// backoff returns the wait before the given retry (starting at 1): an
+// exponential delay capped at MaxWait, with jitter over its upper half so
+// that parallel requests do not retry in lockstep
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	minWait := p.MinWait
+	if minWait <= 0 {
+		minWait = defaultRetryMinWait
+	}
+	maxWait := p.MaxWait
+	if maxWait < minWait {
+		maxWait = minWait
+	}
+
+	wait := minWait
+	for i := 1; i < retry && wait < maxWait; i++ {
+		wait *= 2
+	}
+	if wait > maxWait {
+		wait = maxWait
+	}
+
+	half := wait / 2
+	return half + time.Duration(rand.Int63n(int64(wait-half)+1))
+}
+
+// withRetry runs attempt until it succeeds, fails with a non-retryable
+// error, exhausts the retry policy or ctx is done
+func (c *Client) withRetry(ctx context.Context, method, endpoint string, retryable bool, attempt func() ([]byte, error)) ([]byte, error) {
+	for retry := 0; ; retry++ {
+		respBody, err := attempt()
+		if err == nil {
+			return respBody, nil
+		}
+		if !retryable || retry >= c.RetryPolicy.MaxRetries || !IsRetryable(err) {
+			return nil, err
+		}
+
+		wait := c.RetryPolicy.backoff(retry + 1)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.retryAfter > 0 {
+			wait = apiErr.retryAfter
+			if c.RetryPolicy.MaxWait > 0 && wait > c.RetryPolicy.MaxWait {
+				wait = c.RetryPolicy.MaxWait
+			}
+		}
+
+		tflog.Warn(ctx, "Retrying TrueNAS API request", map[string]interface{}{
+			"method":   method,
+			"endpoint": endpoint,
+			"retry":    retry + 1,
+			"wait":     wait.String(),
+			"error":    err.Error(),
+		})
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w (gave up retrying: %s)", err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
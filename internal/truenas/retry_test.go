@@ -0,0 +1,161 @@
+package truenas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRetryTestServer returns a client whose server fails the first `failures`
+// requests with the given status and then succeeds
+func newRetryTestServer(t *testing.T, failures int32, status int) (*Client, *int32) {
+	t.Helper()
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"message":"try again"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":1}`))
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(server.URL, "test-key")
+	require.NoError(t, err)
+	client.RetryPolicy = RetryPolicy{MaxRetries: 3, MinWait: time.Millisecond, MaxWait: 5 * time.Millisecond}
+
+	return client, &calls
+}
+
+// TestRetry_IdempotentMethods tests that transient gateway errors are retried for GET, PUT and DELETE
+func TestRetry_IdempotentMethods(t *testing.T) {
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		t.Run(method, func(t *testing.T) {
+			client, calls := newRetryTestServer(t, 2, http.StatusBadGateway)
+
+			result, err := client.DoRequest(context.Background(), method, "/pool/dataset", nil)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"id":1}`, string(result))
+			assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+		})
+	}
+}
+
+// TestRetry_PostNotRetried tests that a plain POST is attempted once
+func TestRetry_PostNotRetried(t *testing.T) {
+	client, calls := newRetryTestServer(t, 1, http.StatusServiceUnavailable)
+
+	_, err := client.Post(context.Background(), "/sharing/nfs", map[string]interface{}{"path": "/mnt/tank"})
+	require.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+}
+
+// TestRetry_PostIdempotent tests that an opted-in POST is retried
+func TestRetry_PostIdempotent(t *testing.T) {
+	client, calls := newRetryTestServer(t, 1, http.StatusServiceUnavailable)
+
+	_, err := client.PostIdempotent(context.Background(), "/filesystem/stat", "/mnt/tank")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+// TestRetry_ValidationErrorNotRetried tests that a 422 fails immediately
+func TestRetry_ValidationErrorNotRetried(t *testing.T) {
+	client, calls := newRetryTestServer(t, 1, http.StatusUnprocessableEntity)
+
+	_, err := client.Get(context.Background(), "/pool/dataset")
+	require.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+}
+
+// TestRetry_Exhausted tests that the last error is returned once retries run out
+func TestRetry_Exhausted(t *testing.T) {
+	client, calls := newRetryTestServer(t, 100, http.StatusGatewayTimeout)
+
+	_, err := client.Get(context.Background(), "/pool/dataset")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 504")
+	assert.Equal(t, int32(4), atomic.LoadInt32(calls))
+}
+
+// TestRetry_ConnectionRefused tests that a refused connection is retried
+func TestRetry_ConnectionRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	client, err := NewClient("http://"+addr, "test-key")
+	require.NoError(t, err)
+	client.RetryPolicy = RetryPolicy{MaxRetries: 2, MinWait: time.Millisecond, MaxWait: time.Millisecond}
+
+	_, err = client.Get(context.Background(), "/pool/dataset")
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, syscall.ECONNREFUSED))
+}
+
+// TestIsRetryable tests error classification
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"connection refused", fmt.Errorf("error performing request: %w", syscall.ECONNREFUSED), true},
+		{"connection reset", fmt.Errorf("error performing request: %w", syscall.ECONNRESET), true},
+		{"EOF", fmt.Errorf("error performing request: %w", io.EOF), true},
+		{"unexpected EOF", fmt.Errorf("error reading response body: %w", io.ErrUnexpectedEOF), true},
+		{"429", &APIError{StatusCode: http.StatusTooManyRequests}, true},
+		{"502", &APIError{StatusCode: http.StatusBadGateway}, true},
+		{"503", &APIError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"504", &APIError{StatusCode: http.StatusGatewayTimeout}, true},
+		{"404", &APIError{StatusCode: http.StatusNotFound}, false},
+		{"422", &APIError{StatusCode: http.StatusUnprocessableEntity}, false},
+		{"500", &APIError{StatusCode: http.StatusInternalServerError}, false},
+		{"context cancelled", fmt.Errorf("error performing request: %w", context.Canceled), false},
+		{"other", errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsRetryable(tt.err))
+		})
+	}
+}
+
+// TestRetryPolicy_Backoff tests that the backoff grows exponentially with jitter and is capped
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 10, MinWait: 100 * time.Millisecond, MaxWait: time.Second}
+
+	for i := 0; i < 50; i++ {
+		first := policy.backoff(1)
+		assert.GreaterOrEqual(t, first, 50*time.Millisecond)
+		assert.LessOrEqual(t, first, 100*time.Millisecond)
+
+		third := policy.backoff(3)
+		assert.GreaterOrEqual(t, third, 200*time.Millisecond)
+		assert.LessOrEqual(t, third, 400*time.Millisecond)
+
+		capped := policy.backoff(10)
+		assert.GreaterOrEqual(t, capped, 500*time.Millisecond)
+		assert.LessOrEqual(t, capped, time.Second)
+	}
+}
@@ -0,0 +1,110 @@
+package truenas
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TLSConfig describes how the client verifies the TrueNAS server and, for
+// mutual TLS, authenticates itself
+type TLSConfig struct {
+	// CACertPEM is a PEM bundle of CAs trusted in addition to the system pool
+	CACertPEM string
+
+	// CACertFile is the path of a PEM bundle of CAs trusted in addition to
+	// the system pool
+	CACertFile string
+
+	// ClientCert and ClientKey are the client certificate and private key
+	// presented for mutual TLS, each as PEM content or a path to a PEM file
+	ClientCert string
+	ClientKey  string
+
+	// ServerName overrides the name used to verify the server certificate
+	ServerName string
+
+	// InsecureSkipVerify disables server certificate verification
+	InsecureSkipVerify bool
+}
+
+// WithTLSConfig configures the TLS settings of the client's transport
+func WithTLSConfig(cfg TLSConfig) ClientOption {
+	return func(c *Client) error {
+		tlsConfig, err := cfg.build()
+		if err != nil {
+			return err
+		}
+		transport, err := c.transport()
+		if err != nil {
+			return err
+		}
+		transport.TLSClientConfig = tlsConfig
+		return nil
+	}
+}
+
+// build converts the settings into a *tls.Config
+func (cfg TLSConfig) build() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CACertPEM != "" || cfg.CACertFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+
+		if cfg.CACertPEM != "" && !pool.AppendCertsFromPEM([]byte(cfg.CACertPEM)) {
+			return nil, fmt.Errorf("no valid certificates found in CA certificate PEM")
+		}
+		if cfg.CACertFile != "" {
+			caPEM, err := os.ReadFile(cfg.CACertFile)
+			if err != nil {
+				return nil, fmt.Errorf("error reading CA certificate file: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(caPEM) {
+				return nil, fmt.Errorf("no valid certificates found in CA certificate file %s", cfg.CACertFile)
+			}
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCert != "" || cfg.ClientKey != "" {
+		if cfg.ClientCert == "" || cfg.ClientKey == "" {
+			return nil, fmt.Errorf("client certificate and client key must be set together")
+		}
+
+		certPEM, err := readPEM(cfg.ClientCert)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client certificate: %w", err)
+		}
+		keyPEM, err := readPEM(cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client key: %w", err)
+		}
+
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// readPEM returns value itself if it holds PEM content, otherwise the
+// content of the file it names
+func readPEM(value string) ([]byte, error) {
+	if strings.Contains(value, "-----BEGIN") {
+		return []byte(value), nil
+	}
+	return os.ReadFile(value)
+}
@@ -0,0 +1,194 @@
+package truenas
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTLSTestServer starts a TLS server answering every request with an empty JSON object
+func newTLSTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// serverCAPEM returns the PEM encoding of the test server's certificate
+func serverCAPEM(server *httptest.Server) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+}
+
+// newTLSTestClient creates a client for the server with no retries
+func newTLSTestClient(t *testing.T, server *httptest.Server, cfg TLSConfig) *Client {
+	t.Helper()
+
+	client, err := NewClient(server.URL, "test-key", WithTLSConfig(cfg))
+	require.NoError(t, err)
+	client.RetryPolicy.MaxRetries = 0
+	return client
+}
+
+// TestTLS_UntrustedServerRejected tests that an unknown CA fails verification
+func TestTLS_UntrustedServerRejected(t *testing.T) {
+	server := newTLSTestServer(t)
+	client := newTLSTestClient(t, server, TLSConfig{})
+
+	_, err := client.Get(context.Background(), "/system/info")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "certificate")
+}
+
+// TestTLS_CACertPEM tests that a CA supplied as PEM content is trusted
+func TestTLS_CACertPEM(t *testing.T) {
+	server := newTLSTestServer(t)
+	client := newTLSTestClient(t, server, TLSConfig{CACertPEM: serverCAPEM(server)})
+
+	_, err := client.Get(context.Background(), "/system/info")
+	require.NoError(t, err)
+}
+
+// TestTLS_CACertFile tests that a CA supplied as a file is trusted
+func TestTLS_CACertFile(t *testing.T) {
+	server := newTLSTestServer(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, []byte(serverCAPEM(server)), 0o600))
+
+	client := newTLSTestClient(t, server, TLSConfig{CACertFile: caFile})
+
+	_, err := client.Get(context.Background(), "/system/info")
+	require.NoError(t, err)
+}
+
+// TestTLS_ServerName tests that the verified name can be overridden
+func TestTLS_ServerName(t *testing.T) {
+	server := newTLSTestServer(t)
+
+	// The httptest certificate is issued for example.com
+	client := newTLSTestClient(t, server, TLSConfig{CACertPEM: serverCAPEM(server), ServerName: "example.com"})
+	_, err := client.Get(context.Background(), "/system/info")
+	require.NoError(t, err)
+
+	client = newTLSTestClient(t, server, TLSConfig{CACertPEM: serverCAPEM(server), ServerName: "truenas.internal"})
+	_, err = client.Get(context.Background(), "/system/info")
+	require.Error(t, err)
+}
+
+// TestTLS_InsecureSkipVerify tests that verification can be disabled
+func TestTLS_InsecureSkipVerify(t *testing.T) {
+	server := newTLSTestServer(t)
+	client := newTLSTestClient(t, server, TLSConfig{InsecureSkipVerify: true})
+
+	_, err := client.Get(context.Background(), "/system/info")
+	require.NoError(t, err)
+}
+
+// TestTLS_ClientCertificate tests mutual TLS with PEM content and files
+func TestTLS_ClientCertificate(t *testing.T) {
+	certPEM, keyPEM := generateClientCertificate(t)
+
+	certPool := x509.NewCertPool()
+	require.True(t, certPool.AppendCertsFromPEM(certPEM))
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  certPool,
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	// Without a client certificate the handshake is rejected
+	client := newTLSTestClient(t, server, TLSConfig{CACertPEM: serverCAPEM(server)})
+	_, err := client.Get(context.Background(), "/system/info")
+	require.Error(t, err)
+
+	client = newTLSTestClient(t, server, TLSConfig{
+		CACertPEM:  serverCAPEM(server),
+		ClientCert: string(certPEM),
+		ClientKey:  string(keyPEM),
+	})
+	_, err = client.Get(context.Background(), "/system/info")
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+
+	client = newTLSTestClient(t, server, TLSConfig{
+		CACertPEM:  serverCAPEM(server),
+		ClientCert: certFile,
+		ClientKey:  keyFile,
+	})
+	_, err = client.Get(context.Background(), "/system/info")
+	require.NoError(t, err)
+}
+
+// TestTLS_InvalidConfig tests that bad TLS settings fail client creation
+func TestTLS_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  TLSConfig
+	}{
+		{"garbage CA PEM", TLSConfig{CACertPEM: "not a certificate"}},
+		{"missing CA file", TLSConfig{CACertFile: filepath.Join(t.TempDir(), "missing.pem")}},
+		{"cert without key", TLSConfig{ClientCert: "-----BEGIN CERTIFICATE-----"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient("https://truenas.local", "test-key", WithTLSConfig(tt.cfg))
+			require.Error(t, err)
+		})
+	}
+}
+
+// generateClientCertificate returns a self-signed client certificate and key in PEM form
+func generateClientCertificate(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "terraform"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM
+}
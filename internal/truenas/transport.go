@@ -0,0 +1,54 @@
+package truenas
+
+import (
+	"context"
+	"fmt"
+)
+
+// Transport names accepted by WithTransport
+const (
+	TransportREST      = "rest"
+	TransportWebSocket = "websocket"
+)
+
+// Transport carries a single API call to the TrueNAS middleware. Calls are
+// addressed by REST method and endpoint (e.g. GET /pool/dataset/id/tank);
+// transports speaking another protocol translate them to middleware method
+// calls. The returned body is the JSON result of the call.
+type Transport interface {
+	Call(ctx context.Context, method, endpoint string, body []byte) ([]byte, error)
+}
+
+// jobWatcher is implemented by transports that can push job updates, which
+// WaitForJob then uses instead of polling
+type jobWatcher interface {
+	// watchJob returns a channel of updates for the job and a function that
+	// stops the watch. The channel is closed if the watch is interrupted.
+	watchJob(ctx context.Context, id int64) (<-chan Job, func(), error)
+}
+
+// WithTransport selects the transport by name: TransportREST (the default)
+// or TransportWebSocket
+func WithTransport(name string) ClientOption {
+	return func(c *Client) error {
+		switch name {
+		case "", TransportREST:
+			c.Transport = &restTransport{client: c}
+		case TransportWebSocket:
+			c.Transport = newWebSocketTransport(c)
+		default:
+			return fmt.Errorf("unknown transport %q, expected %q or %q", name, TransportREST, TransportWebSocket)
+		}
+		return nil
+	}
+}
+
+// restTransport calls the REST API at /api/v2.0
+type restTransport struct {
+	client *Client
+}
+
+// Call performs the request over HTTP
+func (t *restTransport) Call(ctx context.Context, method, endpoint string, body []byte) ([]byte, error) {
+	return t.client.doAttempt(ctx, t.client.Authenticator, method, endpoint, body)
+}
@@ -0,0 +1,405 @@
+package truenas
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	// uploadLogInterval is the minimum time between two progress logs
+	uploadLogInterval = 10 * time.Second
+
+	// fileTypeRegular is the type /filesystem/stat reports for regular files
+	fileTypeRegular = "FILE"
+)
+
+// FileStat describes a path on the TrueNAS system, as returned by
+// /filesystem/stat
+type FileStat struct {
+	RealPath string `json:"realpath"`
+	// Type is FILE, DIRECTORY, SYMLINK or OTHER
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+	// Mode is the st_mode of the path, including the file type bits
+	Mode int64 `json:"mode"`
+	UID  int64 `json:"uid"`
+	GID  int64 `json:"gid"`
+	// User and Group are the names of the owner, when they resolve
+	User  *string `json:"user"`
+	Group *string `json:"group"`
+}
+
+// Permissions returns the permission bits of the mode, e.g. 0644
+func (s *FileStat) Permissions() os.FileMode {
+	return os.FileMode(s.Mode) & os.ModePerm
+}
+
+// StatFile returns the attributes of a path on the TrueNAS system. A missing
+// path is reported as an error matching IsNoEntry.
+func (c *Client) StatFile(ctx context.Context, path string) (*FileStat, error) {
+	respBody, err := c.PostIdempotent(ctx, "/filesystem/stat", path)
+	if err != nil {
+		return nil, err
+	}
+
+	var stat FileStat
+	if err := json.Unmarshal(respBody, &stat); err != nil {
+		return nil, fmt.Errorf("error unmarshaling stat of %s: %w", path, err)
+	}
+	return &stat, nil
+}
+
+// FilePermissions are the permissions and ownership applied by
+// SetFilePermissions. Nil fields are left unchanged.
+type FilePermissions struct {
+	Mode *os.FileMode
+	UID  *int64
+	GID  *int64
+	// StripACL removes a non-trivial ACL, without which the mode of a path
+	// carrying one cannot be changed
+	StripACL bool
+	// Recursive applies the change to the contents of a directory, and
+	// Traverse also to the child datasets mounted below it
+	Recursive bool
+	Traverse  bool
+}
+
+// SetFilePermissions changes the permissions and ownership of a path on the
+// TrueNAS system through filesystem.setperm, and waits for the job to finish
+func (c *Client) SetFilePermissions(ctx context.Context, path string, perm FilePermissions) error {
+	data := permissionData(perm)
+	data["path"] = path
+
+	_, err := c.PostJob(ctx, "/filesystem/setperm", data)
+	return err
+}
+
+// permissionData returns the body of filesystem.setperm and
+// pool.dataset.permission, without the path. Options are only sent when
+// set, for the versions that predate them.
+func permissionData(perm FilePermissions) map[string]interface{} {
+	data := map[string]interface{}{}
+	if perm.Mode != nil {
+		data["mode"] = fmt.Sprintf("%03o", perm.Mode.Perm())
+	}
+	if perm.UID != nil {
+		data["uid"] = *perm.UID
+	}
+	if perm.GID != nil {
+		data["gid"] = *perm.GID
+	}
+	if perm.StripACL || perm.Recursive || perm.Traverse {
+		data["options"] = map[string]interface{}{
+			"stripacl":  perm.StripACL,
+			"recursive": perm.Recursive,
+			"traverse":  perm.Traverse,
+		}
+	}
+	return data
+}
+
+// UploadResult describes a file written by UploadReader
+type UploadResult struct {
+	// Size is the number of bytes written
+	Size int64
+	// SHA256 is the hex encoded SHA-256 checksum of the content, computed
+	// while it was sent
+	SHA256 string
+}
+
+// UploadOption customises an upload made by UploadReader
+type UploadOption func(*uploadOptions)
+
+type uploadOptions struct {
+	mode     os.FileMode
+	progress func(sent, total int64)
+}
+
+// WithUploadMode sets the permissions of the uploaded file, e.g. 0644. By
+// default the middleware's umask applies.
+func WithUploadMode(mode os.FileMode) UploadOption {
+	return func(o *uploadOptions) {
+		o.mode = mode
+	}
+}
+
+// WithUploadProgress calls fn with the number of bytes sent so far each
+// time a chunk of the content is sent. Progress is also logged through
+// tflog, whether or not a callback is set.
+func WithUploadProgress(fn func(sent, total int64)) UploadOption {
+	return func(o *uploadOptions) {
+		o.progress = fn
+	}
+}
+
+// UploadFile uploads a file to the TrueNAS system and waits for the
+// filesystem.put job to finish writing it
+func (c *Client) UploadFile(ctx context.Context, path string, content []byte) error {
+	_, err := c.UploadReader(ctx, path, bytes.NewReader(content), int64(len(content)))
+	return err
+}
+
+// UploadReader streams the content of r to path on the TrueNAS system and
+// waits for the filesystem.put job to finish writing it. The content is
+// never held in memory, and only ctx bounds the upload.
+// size is the number of bytes r is expected to return; the upload fails if
+// r returns a different number, so that a truncated source does not leave a
+// partial file behind unnoticed.
+//
+// When r is also an io.Seeker, an upload interrupted by a transient failure
+// or an expired session is retried according to the client's RetryPolicy.
+// It resumes from the end of the partially written file, unless path is not
+// a regular file, such as the block device of a zvol. Regular files are
+// checked to have size bytes once written.
+func (c *Client) UploadReader(ctx context.Context, path string, r io.Reader, size int64, opts ...UploadOption) (*UploadResult, error) {
+	var options uploadOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	checksum := sha256.New()
+	progress := &uploadProgress{ctx: ctx, path: path, total: size, callback: options.progress}
+	seeker, resumable := r.(io.Seeker)
+
+	var offset int64
+	for retry := 0; ; retry++ {
+		progress.sent = offset
+		err := c.uploadPart(ctx, path, io.TeeReader(r, checksum), offset, size, &options, progress)
+		if err == nil {
+			break
+		}
+		if !resumable || retry >= c.RetryPolicy.MaxRetries || !c.canRetryUpload(err) {
+			return nil, err
+		}
+
+		wait := c.RetryPolicy.backoff(retry + 1)
+		tflog.Warn(ctx, "Retrying TrueNAS file upload", map[string]interface{}{
+			"path":  path,
+			"retry": retry + 1,
+			"wait":  wait.String(),
+			"error": err.Error(),
+		})
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil, fmt.Errorf("uploading %s: %w", path, err)
+		}
+
+		if offset, err = c.resumeOffset(ctx, path, size); err != nil {
+			return nil, err
+		}
+		if err := rewindUpload(seeker, r, checksum, offset); err != nil {
+			return nil, fmt.Errorf("rewinding upload of %s: %w", path, err)
+		}
+		if offset > 0 {
+			tflog.Info(ctx, "Resuming TrueNAS file upload", map[string]interface{}{
+				"path":   path,
+				"offset": offset,
+				"total":  size,
+			})
+		}
+	}
+
+	result := &UploadResult{Size: size, SHA256: hex.EncodeToString(checksum.Sum(nil))}
+	if isDevicePath(path) {
+		return result, nil
+	}
+
+	stat, err := c.StatFile(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("verifying upload of %s: %w", path, err)
+	}
+	if stat.Type == fileTypeRegular && stat.Size != size {
+		return nil, fmt.Errorf("verifying upload of %s: the file has %d bytes, expected %d", path, stat.Size, size)
+	}
+	return result, nil
+}
+
+// uploadPart streams the content of r from offset to the end in a single
+// filesystem.put call. Content after the start of the file is appended.
+func (c *Client) uploadPart(ctx context.Context, path string, r io.Reader, offset, size int64, options *uploadOptions, progress *uploadProgress) error {
+	data := map[string]interface{}{"path": path}
+	putOptions := map[string]interface{}{}
+	if offset > 0 {
+		putOptions["append"] = true
+	}
+	if options.mode != 0 {
+		putOptions["mode"] = int64(options.mode.Perm())
+	}
+	if len(putOptions) > 0 {
+		data["options"] = putOptions
+	}
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error marshaling data: %w", err)
+	}
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	written := make(chan error, 1)
+	go func() {
+		err := writeUpload(writer, string(jsonData), io.TeeReader(r, progress), size-offset)
+		pw.CloseWithError(err)
+		written <- err
+	}()
+
+	url := fmt.Sprintf("%s/api/%s/filesystem/put", c.BaseURL, apiVersion)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, pr)
+	if err != nil {
+		pr.Close()
+		<-written
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	respBody, err := c.send(ctx, c.Authenticator, req)
+
+	// Unblock the writer if the request ended before reading all of it, and
+	// prefer its error, which explains why the body was cut short
+	pr.Close()
+	if writeErr := <-written; writeErr != nil && !errors.Is(writeErr, io.ErrClosedPipe) {
+		return writeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if id, ok := parseJobID(respBody); ok {
+		if _, err := c.WaitForJob(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeUpload writes the multipart body of a filesystem.put upload
+func writeUpload(writer *multipart.Writer, data string, r io.Reader, size int64) error {
+	if err := writer.WriteField("data", data); err != nil {
+		return fmt.Errorf("error writing data field: %w", err)
+	}
+
+	part, err := writer.CreateFormFile("file", "file")
+	if err != nil {
+		return fmt.Errorf("error creating form file: %w", err)
+	}
+	n, err := io.Copy(part, r)
+	if err != nil {
+		return fmt.Errorf("error writing file content: %w", err)
+	}
+	if n != size {
+		return fmt.Errorf("error writing file content: read %d bytes, expected %d", n, size)
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("error closing multipart writer: %w", err)
+	}
+	return nil
+}
+
+// canRetryUpload reports whether an upload that failed with err may be
+// retried. Expired sessions are refreshed first.
+func (c *Client) canRetryUpload(err error) bool {
+	if refreshable, ok := c.Authenticator.(refreshableAuthenticator); ok && isUnauthorized(err) {
+		refreshable.Invalidate()
+		return true
+	}
+	return IsRetryable(err)
+}
+
+// resumeOffset returns where to resume an interrupted upload: the size of
+// the partially written file, or zero to start over
+func (c *Client) resumeOffset(ctx context.Context, path string, size int64) (int64, error) {
+	if isDevicePath(path) {
+		return 0, nil
+	}
+
+	stat, err := c.StatFile(ctx, path)
+	if err != nil {
+		if IsNoEntry(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("checking partial upload of %s: %w", path, err)
+	}
+	if stat.Type != fileTypeRegular || stat.Size >= size {
+		return 0, nil
+	}
+	return stat.Size, nil
+}
+
+// rewindUpload positions r at offset, with the checksum covering the content
+// before it
+func rewindUpload(seeker io.Seeker, r io.Reader, checksum hash.Hash, offset int64) error {
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	checksum.Reset()
+	_, err := io.CopyN(checksum, r, offset)
+	return err
+}
+
+// isDevicePath reports whether path is a device, such as the block device
+// of a zvol. Devices cannot be appended to, and their size is not that of
+// the content written to them.
+func isDevicePath(path string) bool {
+	return strings.HasPrefix(path, "/dev/")
+}
+
+// uploadProgress counts the bytes of an upload as they are sent, reporting
+// them to the callback and logging them through tflog
+type uploadProgress struct {
+	ctx      context.Context
+	path     string
+	total    int64
+	sent     int64
+	callback func(sent, total int64)
+	logged   time.Time
+}
+
+func (p *uploadProgress) Write(b []byte) (int, error) {
+	p.sent += int64(len(b))
+	if p.callback != nil {
+		p.callback(p.sent, p.total)
+	}
+
+	if now := time.Now(); now.Sub(p.logged) >= uploadLogInterval || p.sent == p.total {
+		p.logged = now
+		percent := int64(100)
+		if p.total > 0 {
+			percent = p.sent * 100 / p.total
+		}
+		tflog.Info(p.ctx, "TrueNAS file upload progress", map[string]interface{}{
+			"path":    p.path,
+			"sent":    p.sent,
+			"total":   p.total,
+			"percent": percent,
+		})
+	}
+	return len(b), nil
+}
+
+// sleepContext pauses for d, returning early with the context error if ctx
+// is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
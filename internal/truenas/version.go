@@ -0,0 +1,177 @@
+package truenas
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// versionPattern matches the release number in version strings such as
+// "TrueNAS-SCALE-24.04.2", "TrueNAS-SCALE-24.10-RC.1" or "25.04.0"
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-([0-9A-Za-z.-]+))?$`)
+
+// Version is a parsed TrueNAS release number
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Build      int
+	PreRelease string
+
+	// Product is the product prefix of the version string, e.g. "SCALE"
+	Product string
+
+	// Raw is the version string as reported by the server
+	Raw string
+}
+
+// ParseVersion parses a TrueNAS version string as returned by
+// /system/version
+func ParseVersion(s string) (Version, error) {
+	raw := strings.TrimSpace(s)
+	m := versionPattern.FindStringSubmatchIndex(raw)
+	if m == nil {
+		return Version{}, fmt.Errorf("unrecognised TrueNAS version %q", s)
+	}
+
+	v := Version{Raw: raw}
+	parts := []*int{&v.Major, &v.Minor, &v.Patch, &v.Build}
+	for i, part := range parts {
+		start, end := m[2*(i+1)], m[2*(i+1)+1]
+		if start < 0 {
+			continue
+		}
+		n, err := strconv.Atoi(raw[start:end])
+		if err != nil {
+			return Version{}, fmt.Errorf("unrecognised TrueNAS version %q: %w", s, err)
+		}
+		*part = n
+	}
+	if m[10] >= 0 {
+		v.PreRelease = raw[m[10]:m[11]]
+	}
+
+	// "TrueNAS-SCALE-" leaves "SCALE" as the product
+	prefix := strings.Trim(raw[:m[0]], "-")
+	if i := strings.LastIndex(prefix, "-"); i >= 0 {
+		prefix = prefix[i+1:]
+	}
+	v.Product = prefix
+
+	return v, nil
+}
+
+// MustParseVersion is like ParseVersion but panics on error. It is meant for
+// version constants.
+func MustParseVersion(s string) Version {
+	v, err := ParseVersion(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// String returns the release number, e.g. "24.04.2" or "24.10-RC.1"
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%02d", v.Major, v.Minor)
+	if v.Patch > 0 || v.Build > 0 {
+		s += fmt.Sprintf(".%d", v.Patch)
+	}
+	if v.Build > 0 {
+		s += fmt.Sprintf(".%d", v.Build)
+	}
+	if v.PreRelease != "" {
+		s += "-" + v.PreRelease
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 as v is older than, the same release as, or
+// newer than o. Pre-releases compare equal to their final release, so a
+// 24.10 release candidate is gated like 24.10.
+func (v Version) Compare(o Version) int {
+	a := []int{v.Major, v.Minor, v.Patch, v.Build}
+	b := []int{o.Major, o.Minor, o.Patch, o.Build}
+	for i := range a {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	return 0
+}
+
+// AtLeast reports whether v is the same release as o or newer
+func (v Version) AtLeast(o Version) bool {
+	return v.Compare(o) >= 0
+}
+
+// SystemInfo is the subset of /system/info the provider exposes
+type SystemInfo struct {
+	Version            string  `json:"version"`
+	Hostname           string  `json:"hostname"`
+	Model              string  `json:"model"`
+	Cores              int64   `json:"cores"`
+	PhysicalCores      int64   `json:"physical_cores"`
+	PhysMem            int64   `json:"physmem"`
+	UptimeSeconds      float64 `json:"uptime_seconds"`
+	SystemProduct      string  `json:"system_product"`
+	SystemManufacturer string  `json:"system_manufacturer"`
+	SystemSerial       string  `json:"system_serial"`
+	Timezone           string  `json:"timezone"`
+	ECCMemory          bool    `json:"ecc_memory"`
+}
+
+// GetSystemVersion retrieves and parses the server version from
+// /system/version
+func (c *Client) GetSystemVersion(ctx context.Context) (Version, error) {
+	respBody, err := c.Get(ctx, "/system/version")
+	if err != nil {
+		return Version{}, err
+	}
+
+	var raw string
+	if err := json.Unmarshal(respBody, &raw); err != nil {
+		return Version{}, fmt.Errorf("error unmarshaling system version: %w", err)
+	}
+
+	return ParseVersion(raw)
+}
+
+// GetSystemInfo retrieves /system/info
+func (c *Client) GetSystemInfo(ctx context.Context) (*SystemInfo, error) {
+	respBody, err := c.Get(ctx, "/system/info")
+	if err != nil {
+		return nil, err
+	}
+
+	var info SystemInfo
+	if err := json.Unmarshal(respBody, &info); err != nil {
+		return nil, fmt.Errorf("error unmarshaling system info: %w", err)
+	}
+
+	return &info, nil
+}
+
+// DetectServer queries the server version and system information and
+// stores them on the client, where CheckFeature uses them to gate features
+func (c *Client) DetectServer(ctx context.Context) error {
+	version, err := c.GetSystemVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("error detecting TrueNAS version: %w", err)
+	}
+
+	info, err := c.GetSystemInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading TrueNAS system info: %w", err)
+	}
+
+	c.ServerVersion = &version
+	c.SystemInfo = info
+	return nil
+}
@@ -0,0 +1,124 @@
+package truenas
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseVersion tests parsing of the version strings reported by SCALE releases
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		raw        string
+		major      int
+		minor      int
+		patch      int
+		build      int
+		preRelease string
+		product    string
+		str        string
+	}{
+		{"TrueNAS-SCALE-24.04.2", 24, 4, 2, 0, "", "SCALE", "24.04.2"},
+		{"TrueNAS-SCALE-24.04.2.3", 24, 4, 2, 3, "", "SCALE", "24.04.2.3"},
+		{"TrueNAS-SCALE-24.04.0", 24, 4, 0, 0, "", "SCALE", "24.04"},
+		{"TrueNAS-SCALE-23.10.2", 23, 10, 2, 0, "", "SCALE", "23.10.2"},
+		{"TrueNAS-SCALE-24.10-RC.1", 24, 10, 0, 0, "RC.1", "SCALE", "24.10-RC.1"},
+		{"25.04.0", 25, 4, 0, 0, "", "", "25.04"},
+		{" TrueNAS-SCALE-25.04.1\n", 25, 4, 1, 0, "", "SCALE", "25.04.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			v, err := ParseVersion(tt.raw)
+			require.NoError(t, err)
+			assert.Equal(t, tt.major, v.Major)
+			assert.Equal(t, tt.minor, v.Minor)
+			assert.Equal(t, tt.patch, v.Patch)
+			assert.Equal(t, tt.build, v.Build)
+			assert.Equal(t, tt.preRelease, v.PreRelease)
+			assert.Equal(t, tt.product, v.Product)
+			assert.Equal(t, tt.str, v.String())
+		})
+	}
+
+	_, err := ParseVersion("TrueNAS-SCALE-MASTER")
+	assert.Error(t, err)
+}
+
+// TestVersion_Compare tests release ordering, ignoring pre-release tags
+func TestVersion_Compare(t *testing.T) {
+	v := MustParseVersion
+
+	assert.Equal(t, -1, v("23.10.2").Compare(v("24.04")))
+	assert.Equal(t, -1, v("24.04").Compare(v("24.04.1")))
+	assert.Equal(t, 1, v("24.04.2.1").Compare(v("24.04.2")))
+	assert.Equal(t, 0, v("24.10-RC.1").Compare(v("24.10")))
+	assert.True(t, v("25.04").AtLeast(v("24.10")))
+	assert.False(t, v("24.04.2").AtLeast(v("24.10")))
+}
+
+// TestVersionRange_Contains tests inclusive minimum and exclusive maximum bounds
+func TestVersionRange_Contains(t *testing.T) {
+	v := MustParseVersion
+
+	assert.True(t, SupportedVersions.Contains(v("24.04")))
+	assert.True(t, SupportedVersions.Contains(v("24.04.2.3")))
+	assert.False(t, SupportedVersions.Contains(v("23.10.2")))
+	assert.True(t, SupportedVersions.Contains(v("24.10-RC.1")))
+	assert.False(t, SupportedVersions.Contains(v("25.04.0")))
+	assert.True(t, VersionRange{}.Contains(v("13.0")))
+	assert.Equal(t, "24.04 or later, before 25.04", SupportedVersions.String())
+}
+
+// TestCheckFeature tests gating of features by the detected server version
+func TestCheckFeature(t *testing.T) {
+	client := &Client{}
+
+	// Nothing is gated before the version is detected
+	assert.NoError(t, client.CheckFeature(FeatureChartRelease))
+
+	v := MustParseVersion("TrueNAS-SCALE-24.04.2")
+	client.ServerVersion = &v
+	assert.NoError(t, client.CheckFeature(FeatureChartRelease))
+
+	v = MustParseVersion("TrueNAS-SCALE-24.10.0")
+	err := client.CheckFeature(FeatureChartRelease)
+	require.Error(t, err)
+
+	var unsupported *UnsupportedFeatureError
+	require.True(t, errors.As(err, &unsupported))
+	assert.Equal(t, FeatureChartRelease, unsupported.Feature)
+	assert.Equal(t, "chart.release is not available on TrueNAS 24.10 (available before 24.10)", err.Error())
+}
+
+// TestDetectServer tests that the version and system info are stored on the client
+func TestDetectServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2.0/system/version":
+			_, _ = w.Write([]byte(`"TrueNAS-SCALE-24.04.2"`))
+		case "/api/v2.0/system/info":
+			_, _ = w.Write([]byte(`{"version": "TrueNAS-SCALE-24.04.2", "hostname": "nas", "cores": 8, "physmem": 34359738368, "ecc_memory": true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(server.URL, "test-key")
+	require.NoError(t, err)
+
+	require.NoError(t, client.DetectServer(context.Background()))
+	require.NotNil(t, client.ServerVersion)
+	assert.Equal(t, "24.04.2", client.ServerVersion.String())
+	require.NotNil(t, client.SystemInfo)
+	assert.Equal(t, "nas", client.SystemInfo.Hostname)
+	assert.Equal(t, int64(8), client.SystemInfo.Cores)
+	assert.Equal(t, int64(34359738368), client.SystemInfo.PhysMem)
+	assert.True(t, client.SystemInfo.ECCMemory)
+}
@@ -0,0 +1,421 @@
+package truenas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/coder/websocket"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	// wsReadLimit bounds a single message; query results for large pools
+	// easily exceed the library's 32 KiB default
+	wsReadLimit = 64 << 20
+
+	// wsJobBuffer is the number of job updates buffered per watcher
+	wsJobBuffer = 16
+)
+
+// errConnectionLost is returned for calls in flight when the WebSocket
+// connection drops. It wraps io.ErrUnexpectedEOF so that idempotent calls
+// are retried, on a new connection.
+var errConnectionLost = fmt.Errorf("websocket connection lost: %w", io.ErrUnexpectedEOF)
+
+// wsRequest is an outgoing message of the middleware's DDP-style protocol
+type wsRequest struct {
+	Msg     string        `json:"msg"`
+	ID      string        `json:"id,omitempty"`
+	Method  string        `json:"method,omitempty"`
+	Params  []interface{} `json:"params,omitempty"`
+	Name    string        `json:"name,omitempty"`
+	Version string        `json:"version,omitempty"`
+	Support []string      `json:"support,omitempty"`
+}
+
+// wsMessage is an incoming message. ID is a call ID for results and a job
+// ID for collection events, so it is left raw.
+type wsMessage struct {
+	Msg        string          `json:"msg"`
+	ID         json.RawMessage `json:"id"`
+	Result     json.RawMessage `json:"result"`
+	Error      json.RawMessage `json:"error"`
+	Collection string          `json:"collection"`
+	Fields     json.RawMessage `json:"fields"`
+}
+
+// wsTransport calls the middleware over its WebSocket JSON-RPC endpoint.
+// REST requests are translated to method calls by restToRPC. One
+// connection is shared by all calls and reopened after it drops.
+type wsTransport struct {
+	client *Client
+
+	mu   sync.Mutex
+	conn *wsConn
+}
+
+func newWebSocketTransport(c *Client) *wsTransport {
+	return &wsTransport{client: c}
+}
+
+// Call performs the request as a middleware method call
+func (t *wsTransport) Call(ctx context.Context, method, endpoint string, body []byte) ([]byte, error) {
+	call, err := restToRPC(method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := t.client.requestContext(ctx)
+	defer cancel()
+
+	conn, err := t.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tflog.Trace(ctx, "TrueNAS method call", map[string]interface{}{
+		"method":   call.Method,
+		"endpoint": endpoint,
+	})
+
+	return conn.call(ctx, call.Method, call.Params)
+}
+
+// watchJob subscribes to job events on the shared connection
+func (t *wsTransport) watchJob(ctx context.Context, id int64) (<-chan Job, func(), error) {
+	conn, err := t.connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn.watchJob(ctx, id)
+}
+
+// connect returns the open connection, dialing and logging in if needed
+func (t *wsTransport) connect(ctx context.Context) (*wsConn, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn != nil && !t.conn.closed() {
+		return t.conn, nil
+	}
+
+	conn, err := t.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t.conn = conn
+	return conn, nil
+}
+
+// dial opens a connection, completes the protocol handshake and logs in
+func (t *wsTransport) dial(ctx context.Context) (*wsConn, error) {
+	auth, ok := t.client.Authenticator.(rpcAuthenticator)
+	if !ok {
+		return nil, fmt.Errorf("authenticator %T does not support the websocket transport", t.client.Authenticator)
+	}
+
+	url := websocketURL(t.client.BaseURL)
+	tflog.Debug(ctx, "Connecting to TrueNAS websocket", map[string]interface{}{
+		"url": url,
+	})
+
+	ws, _, err := websocket.Dial(ctx, url, &websocket.DialOptions{HTTPClient: t.client.HTTPClient})
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %w", url, err)
+	}
+	ws.SetReadLimit(wsReadLimit)
+
+	conn := newWSConn(ws)
+	if err := conn.handshake(ctx); err != nil {
+		conn.close(err)
+		return nil, err
+	}
+	go conn.readLoop()
+
+	loginMethod, loginParams := auth.rpcLogin()
+	result, err := conn.call(ctx, loginMethod, loginParams)
+	if err != nil {
+		conn.close(err)
+		return nil, fmt.Errorf("error logging in: %w", err)
+	}
+	var loggedIn bool
+	if err := json.Unmarshal(result, &loggedIn); err != nil || !loggedIn {
+		conn.close(errors.New("login rejected"))
+		return nil, &APIError{
+			StatusCode: http.StatusUnauthorized,
+			Message:    "login rejected: invalid credentials",
+			Body:       string(result),
+		}
+	}
+
+	return conn, nil
+}
+
+// websocketURL returns the JSON-RPC endpoint for a base URL
+func websocketURL(baseURL string) string {
+	switch {
+	case strings.HasPrefix(baseURL, "https://"):
+		baseURL = "wss://" + strings.TrimPrefix(baseURL, "https://")
+	case strings.HasPrefix(baseURL, "http://"):
+		baseURL = "ws://" + strings.TrimPrefix(baseURL, "http://")
+	}
+	return baseURL + "/websocket"
+}
+
+// wsConn is a single logged-in connection multiplexing concurrent calls
+type wsConn struct {
+	ws *websocket.Conn
+
+	writeMu sync.Mutex
+	nextID  atomic.Uint64
+
+	mu         sync.Mutex
+	pending    map[string]chan *wsMessage
+	watchers   map[int64]map[chan Job]struct{}
+	subscribed bool
+	done       chan struct{}
+	err        error
+}
+
+func newWSConn(ws *websocket.Conn) *wsConn {
+	return &wsConn{
+		ws:       ws,
+		pending:  make(map[string]chan *wsMessage),
+		watchers: make(map[int64]map[chan Job]struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// handshake negotiates the protocol version
+func (c *wsConn) handshake(ctx context.Context) error {
+	if err := c.write(ctx, &wsRequest{Msg: "connect", Version: "1", Support: []string{"1"}}); err != nil {
+		return fmt.Errorf("error starting websocket session: %w", err)
+	}
+
+	_, data, err := c.ws.Read(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting websocket session: %w", err)
+	}
+	var msg wsMessage
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Msg != "connected" {
+		return fmt.Errorf("error starting websocket session: unexpected response %s", string(data))
+	}
+	return nil
+}
+
+// call invokes a method and waits for its result
+func (c *wsConn) call(ctx context.Context, method string, params []interface{}) ([]byte, error) {
+	if params == nil {
+		params = []interface{}{}
+	}
+	id := strconv.FormatUint(c.nextID.Add(1), 10)
+	ch := make(chan *wsMessage, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, errConnectionLost
+	}
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.write(ctx, &wsRequest{Msg: "method", ID: id, Method: method, Params: params}); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		c.close(err)
+		return nil, errConnectionLost
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.done:
+		return nil, errConnectionLost
+	case msg := <-ch:
+		if len(msg.Error) > 0 && string(msg.Error) != "null" {
+			var callErr rpcError
+			if err := json.Unmarshal(msg.Error, &callErr); err != nil {
+				return nil, fmt.Errorf("error parsing %s error: %w", method, err)
+			}
+			return nil, callErr.apiError(msg.Error)
+		}
+		if len(msg.Result) == 0 {
+			return []byte("null"), nil
+		}
+		return msg.Result, nil
+	}
+}
+
+// watchJob registers for updates of a job, subscribing to job events the
+// first time it is called on the connection
+func (c *wsConn) watchJob(ctx context.Context, id int64) (<-chan Job, func(), error) {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, nil, errConnectionLost
+	}
+	subscribe := !c.subscribed
+	c.subscribed = true
+
+	ch := make(chan Job, wsJobBuffer)
+	if c.watchers[id] == nil {
+		c.watchers[id] = make(map[chan Job]struct{})
+	}
+	c.watchers[id][ch] = struct{}{}
+	c.mu.Unlock()
+
+	stop := func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if _, ok := c.watchers[id][ch]; ok {
+			delete(c.watchers[id], ch)
+			if len(c.watchers[id]) == 0 {
+				delete(c.watchers, id)
+			}
+		}
+	}
+
+	if subscribe {
+		subID := "jobs-" + strconv.FormatUint(c.nextID.Add(1), 10)
+		if err := c.write(ctx, &wsRequest{Msg: "sub", ID: subID, Name: "core.get_jobs"}); err != nil {
+			stop()
+			c.mu.Lock()
+			c.subscribed = false
+			c.mu.Unlock()
+			return nil, nil, fmt.Errorf("error subscribing to job events: %w", err)
+		}
+	}
+
+	return ch, stop, nil
+}
+
+// readLoop dispatches incoming messages until the connection fails
+func (c *wsConn) readLoop() {
+	for {
+		_, data, err := c.ws.Read(context.Background())
+		if err != nil {
+			c.close(err)
+			return
+		}
+
+		var msg wsMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+
+		switch msg.Msg {
+		case "result":
+			var id string
+			if err := json.Unmarshal(msg.ID, &id); err != nil {
+				continue
+			}
+			c.mu.Lock()
+			ch := c.pending[id]
+			c.mu.Unlock()
+			if ch != nil {
+				ch <- &msg
+			}
+
+		case "ping":
+			pong := &wsRequest{Msg: "pong"}
+			_ = json.Unmarshal(msg.ID, &pong.ID)
+			go func() {
+				_ = c.write(context.Background(), pong)
+			}()
+
+		case "added", "changed":
+			if msg.Collection == "core.get_jobs" {
+				c.dispatchJob(&msg)
+			}
+		}
+	}
+}
+
+// dispatchJob forwards a job event to the job's watchers. A watcher that
+// falls behind loses its oldest update rather than blocking the reader.
+func (c *wsConn) dispatchJob(msg *wsMessage) {
+	var job Job
+	if len(msg.Fields) > 0 {
+		if err := json.Unmarshal(msg.Fields, &job); err != nil {
+			return
+		}
+	}
+	if job.ID == 0 {
+		if err := json.Unmarshal(msg.ID, &job.ID); err != nil {
+			return
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for ch := range c.watchers[job.ID] {
+		select {
+		case ch <- job:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- job:
+			default:
+			}
+		}
+	}
+}
+
+// write sends a message, serialising concurrent writers
+func (c *wsConn) write(ctx context.Context, req *wsRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("error marshaling message: %w", err)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.ws.Write(ctx, websocket.MessageText, data)
+}
+
+// closed reports whether the connection has failed
+func (c *wsConn) closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err != nil
+}
+
+// close shuts the connection down, failing calls in flight and ending
+// job watches
+func (c *wsConn) close(cause error) {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return
+	}
+	c.err = cause
+	close(c.done)
+	for id, chans := range c.watchers {
+		for ch := range chans {
+			close(ch)
+		}
+		delete(c.watchers, id)
+	}
+	c.mu.Unlock()
+
+	_ = c.ws.Close(websocket.StatusNormalClosure, "")
+}
@@ -0,0 +1,284 @@
+package truenas
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// rpcNamespaces lists the middleware CRUD namespaces the provider calls. A
+// REST endpoint is resolved against the longest matching namespace, so
+// /vm/device/id/3 maps to vm.device while /vm/id/3/start maps to vm.
+var rpcNamespaces = map[string]bool{
+	"catalog":                true,
+	"chart.release":          true,
+	"filesystem.acltemplate": true,
+	"group":                  true,
+	"interface":              true,
+	"iscsi.auth":             true,
+	"iscsi.extent":           true,
+	"iscsi.initiator":        true,
+	"iscsi.portal":           true,
+	"iscsi.target":           true,
+	"iscsi.targetextent":     true,
+	"pool":                   true,
+	"pool.dataset":           true,
+	"pool.snapshottask":      true,
+	"sharing.nfs":            true,
+	"sharing.smb":            true,
+	"staticroute":            true,
+	"user":                   true,
+	"vm":                     true,
+	"vm.device":              true,
+	"zfs.snapshot":           true,
+}
+
+// rpcArgNames gives the positional argument names of methods taking more
+// than one argument. REST passes such arguments as one object keyed by
+// name; JSON-RPC passes them positionally. Arguments after the instance ID
+// of /id/{id}/action endpoints are listed without the ID.
+var rpcArgNames = map[string][]string{
+	"auth.generate_token":     {"ttl", "attrs", "match_origin"},
+	"core.download":           {"method", "args", "filename"},
+	"filesystem.getacl":       {"path", "simplified", "resolve_ids"},
+	"pool.dataset.export_key": {"download"},
+	"vm.clone":                {"name"},
+	"vm.get_display_web_uri":  {"host", "options"},
+}
+
+// rpcCall is a middleware method call
+type rpcCall struct {
+	Method string
+	Params []interface{}
+}
+
+// restToRPC translates a REST request into the equivalent middleware call:
+//
+//	GET    /ns                -> ns.query [filters]
+//	GET    /ns/id/{id}        -> ns.get_instance [id]
+//	POST   /ns                -> ns.create [body]
+//	PUT    /ns/id/{id}        -> ns.update [id, body]
+//	DELETE /ns/id/{id}        -> ns.delete [id, body]
+//	POST   /ns/id/{id}/action -> ns.action [id, args...]
+//	ANY    /ns/method         -> ns.method [args...]
+//
+// Query string parameters of GET requests become equality filters.
+func restToRPC(method, endpoint string, body []byte) (*rpcCall, error) {
+	endpointPath, rawQuery, _ := strings.Cut(endpoint, "?")
+	segments := strings.Split(strings.Trim(endpointPath, "/"), "/")
+	if len(segments) == 0 || segments[0] == "" {
+		return nil, fmt.Errorf("cannot map endpoint %q to a method call", endpoint)
+	}
+
+	filters, err := queryFilters(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace, rest := splitNamespace(segments)
+
+	switch {
+	case len(rest) == 0:
+		switch method {
+		case http.MethodGet:
+			return &rpcCall{Method: namespace + ".query", Params: []interface{}{filters}}, nil
+		case http.MethodPost:
+			return &rpcCall{Method: namespace + ".create", Params: bodyParams("", body)}, nil
+		}
+
+	case rest[0] == "id" && len(rest) >= 2:
+		if method == http.MethodPost {
+			if len(rest) < 3 {
+				break
+			}
+			action := namespace + "." + rest[len(rest)-1]
+			id, err := instanceID(rest[1 : len(rest)-1])
+			if err != nil {
+				return nil, err
+			}
+			return &rpcCall{Method: action, Params: append([]interface{}{id}, bodyParams(action, body)...)}, nil
+		}
+
+		id, err := instanceID(rest[1:])
+		if err != nil {
+			return nil, err
+		}
+		switch method {
+		case http.MethodGet:
+			return &rpcCall{Method: namespace + ".get_instance", Params: []interface{}{id}}, nil
+		case http.MethodPut:
+			return &rpcCall{Method: namespace + ".update", Params: append([]interface{}{id}, bodyParams("", body)...)}, nil
+		case http.MethodDelete:
+			return &rpcCall{Method: namespace + ".delete", Params: append([]interface{}{id}, bodyParams("", body)...)}, nil
+		}
+
+	default:
+		name := namespace + "." + strings.Join(rest, ".")
+		if method == http.MethodGet {
+			if rawQuery != "" {
+				return &rpcCall{Method: name, Params: []interface{}{filters}}, nil
+			}
+			return &rpcCall{Method: name, Params: []interface{}{}}, nil
+		}
+		return &rpcCall{Method: name, Params: bodyParams(name, body)}, nil
+	}
+
+	return nil, fmt.Errorf("cannot map %s %s to a method call", method, endpoint)
+}
+
+// splitNamespace returns the longest known namespace prefix of the path and
+// the remaining segments. Unknown paths are split before their last segment,
+// e.g. /system/info is system.info.
+func splitNamespace(segments []string) (string, []string) {
+	for i := len(segments); i > 0; i-- {
+		namespace := strings.Join(segments[:i], ".")
+		if rpcNamespaces[namespace] {
+			return namespace, segments[i:]
+		}
+	}
+	if len(segments) == 1 {
+		return segments[0], nil
+	}
+	return strings.Join(segments[:len(segments)-1], "."), segments[len(segments)-1:]
+}
+
+// instanceID returns the unescaped instance ID, as a number when numeric
+func instanceID(segments []string) (interface{}, error) {
+	raw, err := url.PathUnescape(strings.Join(segments, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid instance ID %q: %w", strings.Join(segments, "/"), err)
+	}
+	if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return n, nil
+	}
+	return raw, nil
+}
+
+// queryFilters converts query string parameters into equality filters
+func queryFilters(rawQuery string) ([]interface{}, error) {
+	filters := []interface{}{}
+	if rawQuery == "" {
+		return filters, nil
+	}
+
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query string %q: %w", rawQuery, err)
+	}
+	for key, vals := range values {
+		for _, v := range vals {
+			filters = append(filters, []interface{}{key, "=", filterValue(v)})
+		}
+	}
+	return filters, nil
+}
+
+// filterValue converts a query string value to a number or boolean when it
+// looks like one
+func filterValue(v string) interface{} {
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n
+	}
+	if b, err := strconv.ParseBool(v); err == nil && (v == "true" || v == "false") {
+		return b
+	}
+	return v
+}
+
+// bodyParams converts a REST body into positional parameters. Methods
+// listed in rpcArgNames take their arguments from the body's keys; others
+// take the body as their only argument.
+func bodyParams(method string, body []byte) []interface{} {
+	if len(body) == 0 || string(body) == "null" {
+		return []interface{}{}
+	}
+
+	names, ok := rpcArgNames[method]
+	if !ok {
+		return []interface{}{json.RawMessage(body)}
+	}
+
+	var args map[string]json.RawMessage
+	if err := json.Unmarshal(body, &args); err != nil {
+		return []interface{}{json.RawMessage(body)}
+	}
+
+	// Pass arguments up to the last one supplied; omitted ones in between
+	// are sent as null so the middleware applies its defaults
+	last := -1
+	for i, name := range names {
+		if _, ok := args[name]; ok {
+			last = i
+		}
+	}
+	params := make([]interface{}, 0, last+1)
+	for _, name := range names[:last+1] {
+		if arg, ok := args[name]; ok {
+			params = append(params, arg)
+		} else {
+			params = append(params, nil)
+		}
+	}
+	return params
+}
+
+// rpcError is the error member of a failed method call result
+type rpcError struct {
+	Errno   int             `json:"error"`
+	Errname string          `json:"errname"`
+	Type    string          `json:"type"`
+	Reason  string          `json:"reason"`
+	Extra   json.RawMessage `json:"extra"`
+	Trace   *struct {
+		Class string `json:"class"`
+	} `json:"trace"`
+}
+
+// apiError converts the call error into the APIError REST would return
+func (e *rpcError) apiError(raw []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: http.StatusUnprocessableEntity,
+		Message:    e.Reason,
+		Errno:      e.Errno,
+		Body:       string(raw),
+	}
+	if e.Trace != nil {
+		apiErr.Class = e.Trace.Class
+	}
+
+	if e.Type == "VALIDATION" {
+		var extra [][]interface{}
+		if err := json.Unmarshal(e.Extra, &extra); err == nil {
+			for _, entry := range extra {
+				if len(entry) < 2 {
+					continue
+				}
+				field, _ := entry[0].(string)
+				message, _ := entry[1].(string)
+				fieldErr := FieldError{Field: field, Message: message}
+				if len(entry) > 2 {
+					if errno, ok := entry[2].(float64); ok {
+						fieldErr.Errno = int(errno)
+					}
+				}
+				apiErr.Fields = append(apiErr.Fields, fieldErr)
+			}
+		}
+		if apiErr.Class == "" {
+			apiErr.Class = ErrorClassValidation
+		}
+	}
+
+	switch apiErr.Class {
+	case ErrorClassInstanceNotFound:
+		apiErr.StatusCode = http.StatusNotFound
+	case "", ErrorClassValidation, ErrorClassCallError:
+	default:
+		apiErr.StatusCode = http.StatusInternalServerError
+	}
+
+	return apiErr
+}
@@ -0,0 +1,380 @@
+package truenas
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wsTestCall is a method call received by the test server
+type wsTestCall struct {
+	Method string
+	Params []json.RawMessage
+}
+
+// wsTestServer is a minimal stand-in for the middleware's websocket endpoint.
+// Calls are answered by handler, which returns a result or an error payload.
+type wsTestServer struct {
+	*httptest.Server
+
+	handler     func(conn *wsTestConn, call wsTestCall) (interface{}, interface{})
+	connections int32
+
+	mu    sync.Mutex
+	calls []wsTestCall
+	conns []*wsTestConn
+}
+
+// wsTestConn is one client connection to the test server
+type wsTestConn struct {
+	ws      *websocket.Conn
+	writeMu sync.Mutex
+}
+
+func (c *wsTestConn) send(t *testing.T, msg interface{}) {
+	data, err := json.Marshal(msg)
+	require.NoError(t, err)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_ = c.ws.Write(context.Background(), websocket.MessageText, data)
+}
+
+// newWSTestServer starts a server accepting the API key "test-key"
+func newWSTestServer(t *testing.T, handler func(conn *wsTestConn, call wsTestCall) (interface{}, interface{})) *wsTestServer {
+	t.Helper()
+
+	s := &wsTestServer{handler: handler}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/websocket" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		ws, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(&s.connections, 1)
+		conn := &wsTestConn{ws: ws}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+		s.serve(t, conn)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *wsTestServer) serve(t *testing.T, conn *wsTestConn) {
+	ctx := context.Background()
+	for {
+		_, data, err := conn.ws.Read(ctx)
+		if err != nil {
+			return
+		}
+
+		var msg struct {
+			Msg    string            `json:"msg"`
+			ID     string            `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		require.NoError(t, json.Unmarshal(data, &msg))
+
+		switch msg.Msg {
+		case "connect":
+			conn.send(t, map[string]interface{}{"msg": "connected", "session": "test"})
+		case "method":
+			call := wsTestCall{Method: msg.Method, Params: msg.Params}
+			if call.Method == "auth.login_with_api_key" {
+				var key string
+				require.NoError(t, json.Unmarshal(call.Params[0], &key))
+				conn.send(t, map[string]interface{}{"msg": "result", "id": msg.ID, "result": key == "test-key"})
+				continue
+			}
+
+			s.mu.Lock()
+			s.calls = append(s.calls, call)
+			s.mu.Unlock()
+
+			// Answer concurrently so results can arrive out of order
+			go func(id string) {
+				result, callErr := s.handler(conn, call)
+				if callErr != nil {
+					conn.send(t, map[string]interface{}{"msg": "result", "id": id, "error": callErr})
+					return
+				}
+				conn.send(t, map[string]interface{}{"msg": "result", "id": id, "result": result})
+			}(msg.ID)
+		}
+	}
+}
+
+// dropConnections closes every open connection
+func (s *wsTestServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		_ = conn.ws.CloseNow()
+	}
+	s.conns = nil
+}
+
+func (s *wsTestServer) recordedCalls() []wsTestCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]wsTestCall(nil), s.calls...)
+}
+
+func newWSTestClient(t *testing.T, server *wsTestServer, apiKey string) *Client {
+	t.Helper()
+
+	client, err := NewClient(server.URL, apiKey, WithTransport(TransportWebSocket))
+	require.NoError(t, err)
+	client.RetryPolicy = RetryPolicy{MaxRetries: 2, MinWait: time.Millisecond, MaxWait: time.Millisecond}
+	return client
+}
+
+// TestWebSocket_CallTranslation tests that REST requests become the equivalent method calls
+func TestWebSocket_CallTranslation(t *testing.T) {
+	server := newWSTestServer(t, func(conn *wsTestConn, call wsTestCall) (interface{}, interface{}) {
+		return map[string]interface{}{"id": "tank/apps"}, nil
+	})
+	client := newWSTestClient(t, server, "test-key")
+	ctx := context.Background()
+
+	body, err := client.Get(ctx, "/pool/dataset/id/tank%2Fapps")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"tank/apps"}`, string(body))
+
+	_, err = client.Post(ctx, "/pool/dataset", map[string]interface{}{"name": "tank/apps"})
+	require.NoError(t, err)
+	_, err = client.Put(ctx, "/vm/device/id/3", map[string]interface{}{"order": 1001})
+	require.NoError(t, err)
+	_, err = client.DeleteWithBody(ctx, "/pool/dataset/id/tank%2Fapps", map[string]interface{}{"recursive": true})
+	require.NoError(t, err)
+	_, err = client.Post(ctx, "/vm/id/7/stop", map[string]interface{}{"force": true})
+	require.NoError(t, err)
+	_, err = client.Get(ctx, "/sharing/nfs")
+	require.NoError(t, err)
+	_, err = client.Get(ctx, "/system/info")
+	require.NoError(t, err)
+
+	calls := server.recordedCalls()
+	require.Len(t, calls, 7)
+
+	params := func(call wsTestCall) string {
+		data, err := json.Marshal(call.Params)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	assert.Equal(t, "pool.dataset.get_instance", calls[0].Method)
+	assert.JSONEq(t, `["tank/apps"]`, params(calls[0]))
+	assert.Equal(t, "pool.dataset.create", calls[1].Method)
+	assert.JSONEq(t, `[{"name":"tank/apps"}]`, params(calls[1]))
+	assert.Equal(t, "vm.device.update", calls[2].Method)
+	assert.JSONEq(t, `[3,{"order":1001}]`, params(calls[2]))
+	assert.Equal(t, "pool.dataset.delete", calls[3].Method)
+	assert.JSONEq(t, `["tank/apps",{"recursive":true}]`, params(calls[3]))
+	assert.Equal(t, "vm.stop", calls[4].Method)
+	assert.JSONEq(t, `[7,{"force":true}]`, params(calls[4]))
+	assert.Equal(t, "sharing.nfs.query", calls[5].Method)
+	assert.JSONEq(t, `[[]]`, params(calls[5]))
+	assert.Equal(t, "system.info", calls[6].Method)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.connections))
+}
+
+// TestRESTToRPC tests the endpoint translation table
+func TestRESTToRPC(t *testing.T) {
+	tests := []struct {
+		method   string
+		endpoint string
+		body     string
+		want     string
+		params   string
+	}{
+		{http.MethodGet, "/core/get_jobs?id=12", "", "core.get_jobs", `[[["id","=",12]]]`},
+		{http.MethodGet, "/zfs/snapshot/id/tank%2Fapps@daily", "", "zfs.snapshot.get_instance", `["tank/apps@daily"]`},
+		{http.MethodGet, "/user?username=alice", "", "user.query", `[[["username","=","alice"]]]`},
+		{http.MethodPost, "/vm/id/4/start", "", "vm.start", `[4]`},
+		{http.MethodPost, "/vm/id/4/clone", `{"name":"lab2"}`, "vm.clone", `[4,"lab2"]`},
+		{http.MethodPost, "/vm/id/4/clone", `{}`, "vm.clone", `[4]`},
+		{http.MethodDelete, "/user/id/1000", "", "user.delete", `[1000]`},
+		{http.MethodPost, "/auth/generate_token", `{"ttl":600,"match_origin":false}`, "auth.generate_token", `[600,null,false]`},
+		{http.MethodPost, "/filesystem/delete", `"/mnt/tank/iso/seed.iso"`, "filesystem.delete", `["/mnt/tank/iso/seed.iso"]`},
+		{http.MethodGet, "/vm/port_wizard", "", "vm.port_wizard", `[]`},
+		{http.MethodPost, "/vm/get_available_memory", `false`, "vm.get_available_memory", `[false]`},
+		{http.MethodPost, "/vm/id/4/get_display_web_uri", `{"host":"nas","options":{"protocol":"HTTPS"}}`, "vm.get_display_web_uri", `[4,"nas",{"protocol":"HTTPS"}]`},
+		{http.MethodPost, "/pool/dataset/id/tank%2Fsecure/unlock", `{"recursive":false}`, "pool.dataset.unlock", `["tank/secure",{"recursive":false}]`},
+		{http.MethodPost, "/pool/dataset/unlock_services_restart_choices", `"tank/secure"`, "pool.dataset.unlock_services_restart_choices", `["tank/secure"]`},
+		{http.MethodPost, "/pool/dataset/id/tank%2Fhex/export_key", `{"download":false}`, "pool.dataset.export_key", `["tank/hex",false]`},
+		{http.MethodPost, "/core/download", `{"method":"pool.dataset.export_keys","args":["tank"],"filename":"keys.json"}`, "core.download", `["pool.dataset.export_keys",["tank"],"keys.json"]`},
+		{http.MethodPost, "/filesystem/getacl", `{"path":"/mnt/tank/smb","simplified":false,"resolve_ids":true}`, "filesystem.getacl", `["/mnt/tank/smb",false,true]`},
+		{http.MethodPost, "/filesystem/setacl", `{"path":"/mnt/tank/smb","dacl":[]}`, "filesystem.setacl", `[{"dacl":[],"path":"/mnt/tank/smb"}]`},
+		{http.MethodPost, "/pool/dataset/id/tank%2Fsmb/permission", `{"mode":"770"}`, "pool.dataset.permission", `["tank/smb",{"mode":"770"}]`},
+		{http.MethodGet, "/filesystem/acltemplate/id/3", "", "filesystem.acltemplate.get_instance", `[3]`},
+		{http.MethodPost, "/filesystem/acltemplate/by_path", `{"path":"/mnt/tank/smb"}`, "filesystem.acltemplate.by_path", `[{"path":"/mnt/tank/smb"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.endpoint, func(t *testing.T) {
+			var body []byte
+			if tt.body != "" {
+				body = []byte(tt.body)
+			}
+			call, err := restToRPC(tt.method, tt.endpoint, body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, call.Method)
+
+			params, err := json.Marshal(call.Params)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.params, string(params))
+		})
+	}
+
+	_, err := restToRPC(http.MethodPatch, "/pool/dataset", nil)
+	require.Error(t, err)
+}
+
+// TestWebSocket_Errors tests that call errors are converted to APIErrors
+func TestWebSocket_Errors(t *testing.T) {
+	server := newWSTestServer(t, func(conn *wsTestConn, call wsTestCall) (interface{}, interface{}) {
+		switch call.Method {
+		case "pool.dataset.create":
+			return nil, map[string]interface{}{
+				"error":  22,
+				"type":   "VALIDATION",
+				"reason": "[EINVAL] pool_dataset_create.name: Dataset already exists",
+				"extra":  [][]interface{}{{"pool_dataset_create.name", "Dataset already exists", 22}},
+				"trace":  map[string]interface{}{"class": "ValidationErrors"},
+			}
+		default:
+			return nil, map[string]interface{}{
+				"error":  2,
+				"reason": "[ENOENT] None: VM 9 does not exist",
+				"trace":  map[string]interface{}{"class": "InstanceNotFound"},
+			}
+		}
+	})
+	client := newWSTestClient(t, server, "test-key")
+
+	_, err := client.Post(context.Background(), "/pool/dataset", map[string]interface{}{"name": "tank"})
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+	assert.Equal(t, ErrorClassValidation, apiErr.Class)
+	require.Len(t, apiErr.Fields, 1)
+	assert.Equal(t, "name", apiErr.Fields[0].Attribute())
+	assert.Equal(t, "Dataset already exists", apiErr.Fields[0].Message)
+
+	_, err = client.Get(context.Background(), "/vm/id/9")
+	assert.True(t, IsNotFound(err))
+}
+
+// TestWebSocket_LoginRejected tests that a bad API key fails without retrying
+func TestWebSocket_LoginRejected(t *testing.T) {
+	server := newWSTestServer(t, func(conn *wsTestConn, call wsTestCall) (interface{}, interface{}) {
+		return nil, nil
+	})
+	client := newWSTestClient(t, server, "wrong-key")
+
+	_, err := client.Get(context.Background(), "/system/info")
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.connections))
+}
+
+// TestWebSocket_ConcurrentCalls tests that calls answered out of order reach the right caller
+func TestWebSocket_ConcurrentCalls(t *testing.T) {
+	server := newWSTestServer(t, func(conn *wsTestConn, call wsTestCall) (interface{}, interface{}) {
+		var id int
+		_ = json.Unmarshal(call.Params[0], &id)
+		// Later calls are answered first
+		time.Sleep(time.Duration(20-id) * time.Millisecond)
+		return map[string]interface{}{"id": id}, nil
+	})
+	client := newWSTestClient(t, server, "test-key")
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			body, err := client.Get(context.Background(), fmt.Sprintf("/vm/id/%d", id))
+			assert.NoError(t, err)
+			assert.JSONEq(t, fmt.Sprintf(`{"id":%d}`, id), string(body))
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.connections))
+}
+
+// TestWebSocket_Reconnect tests that a dropped connection is reopened and idempotent calls retried
+func TestWebSocket_Reconnect(t *testing.T) {
+	var dropped int32
+	var server *wsTestServer
+	server = newWSTestServer(t, func(conn *wsTestConn, call wsTestCall) (interface{}, interface{}) {
+		if atomic.CompareAndSwapInt32(&dropped, 0, 1) {
+			server.dropConnections()
+			return nil, nil
+		}
+		return map[string]interface{}{"version": "TrueNAS-SCALE-24.04.2"}, nil
+	})
+	client := newWSTestClient(t, server, "test-key")
+
+	body, err := client.Get(context.Background(), "/system/info")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"version":"TrueNAS-SCALE-24.04.2"}`, string(body))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.connections))
+}
+
+// TestWebSocket_JobEvents tests that job completion is taken from pushed events rather than polling
+func TestWebSocket_JobEvents(t *testing.T) {
+	var polls int32
+	server := newWSTestServer(t, func(conn *wsTestConn, call wsTestCall) (interface{}, interface{}) {
+		switch call.Method {
+		case "vm.start":
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				conn.send(t, map[string]interface{}{
+					"msg": "changed", "collection": "core.get_jobs", "id": 42,
+					"fields": map[string]interface{}{"id": 42, "method": "vm.start", "state": "RUNNING", "progress": map[string]interface{}{"percent": 50}},
+				})
+				conn.send(t, map[string]interface{}{
+					"msg": "changed", "collection": "core.get_jobs", "id": 42,
+					"fields": map[string]interface{}{"id": 42, "method": "vm.start", "state": "SUCCESS", "result": true},
+				})
+			}()
+			return 42, nil
+		case "core.get_jobs":
+			atomic.AddInt32(&polls, 1)
+			return []map[string]interface{}{{"id": 42, "method": "vm.start", "state": "WAITING"}}, nil
+		}
+		return nil, nil
+	})
+	client := newWSTestClient(t, server, "test-key")
+	// Polling alone would not finish within the test's deadline
+	client.JobPollInterval = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := client.StartVM(ctx, "4")
+	require.NoError(t, err)
+	assert.Equal(t, "true", string(result))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&polls))
+}